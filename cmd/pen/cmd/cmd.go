@@ -11,8 +11,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/penguintop/penguin/pkg/localstore"
 	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/pinning/remote"
+	"github.com/penguintop/penguin/pkg/postage/batchstore"
+	"github.com/penguintop/penguin/pkg/statestore"
     "github.com/penguintop/penguin/pkg/penguin"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -21,11 +26,21 @@ import (
 
 const (
 	optionNameDataDir                  = "data-dir"
+	optionNameStateStoreBackend        = "statestore-backend"
 	optionNameCacheCapacity            = "cache-capacity"
+	optionNameCacheEviction            = "cache-eviction"
+	optionNameReserveCapacity          = "reserve-capacity"
+	optionNamePinQuota                 = "pin-quota"
+	optionNameCacheDir                 = "cache-dir"
+	optionNameReserveDir               = "reserve-dir"
+	optionNamePinDir                   = "pin-dir"
 	optionNameDBOpenFilesLimit         = "db-open-files-limit"
 	optionNameDBBlockCacheCapacity     = "db-block-cache-capacity"
 	optionNameDBWriteBufferSize        = "db-write-buffer-size"
 	optionNameDBDisableSeeksCompaction = "db-disable-seeks-compaction"
+	optionNameDBScrubRate              = "db-scrub-rate"
+	optionNameDBScrubInterval          = "db-scrub-interval"
+	optionNameDBQuarantineCapacity     = "db-quarantine-capacity"
 	optionNamePassword                 = "password"
 	optionNamePasswordFile             = "password-file"
 	optionNameAPIAddr                  = "api-addr"
@@ -45,9 +60,16 @@ const (
 	optionNameTracingServiceName        = "tracing-service-name"
 	optionNameVerbosity                 = "verbosity"
 	optionNameGlobalPinningEnabled      = "global-pinning-enable"
+	optionNameRemotePinningEnabled      = "remote-pinning-enable"
+	optionNameRemotePinningOwners       = "remote-pinning-owners"
+	optionNameRemotePinningQuota        = "remote-pinning-quota"
+	optionNameRemotePinningEndpoints    = "remote-pinning-endpoints"
 	optionNamePaymentThreshold          = "payment-threshold"
 	optionNamePaymentTolerance          = "payment-tolerance"
 	optionNamePaymentEarly              = "payment-early"
+	optionNameRefreshRate               = "refresh-rate"
+	optionNameLightRefreshRate          = "light-refresh-rate"
+	optionNameTimeSettlementLimit       = "time-settlement-limit"
 	optionNameResolverEndpoints         = "resolver-options"
 	optionNameBootnodeMode              = "bootnode-mode"
 	optionNameGatewayMode               = "gateway-mode"
@@ -58,7 +80,20 @@ const (
 	//optionNameSwapFactoryAddress         = "swap-factory-address"
 	optionNameSwapLegacyFactoryAddresses = "swap-legacy-factory-addresses"
 	optionNameSwapInitialDeposit         = "swap-initial-deposit"
+	optionNameSwapDelegatedChequebook    = "swap-delegated-chequebook"
+	optionNameSwapPriceOracleAddress     = "swap-price-oracle-address"
 	optionNameSwapEnable                 = "swap-enable"
+	optionNameSwapAutoCashoutThreshold   = "swap-auto-cashout-threshold"
+	optionNameSwapAutoCashoutFee         = "swap-auto-cashout-fee"
+	optionNameSwapSolvencyThreshold      = "swap-solvency-threshold"
+	optionNameSwapSolvencyDisconnect     = "swap-solvency-disconnect"
+	optionNameDynamicPricing             = "dynamic-pricing"
+	optionNameAccountingLedger           = "accounting-ledger"
+	optionNameAccountingLedgerRetention  = "accounting-ledger-retention"
+	optionNameBudgetWindow               = "budget-window"
+	optionNameBudgetSoftLimit            = "budget-soft-limit"
+	optionNameBudgetHardLimit            = "budget-hard-limit"
+	optionNameBudgetRequireKey           = "budget-require-key"
 	optionNameTransactionHash            = "transaction"
 	optionNameSwapDeploymentGasPrice     = "swap-deployment-gas-price"
 	optionNameFullNode                   = "full-node"
@@ -129,6 +164,7 @@ func newCommand(opts ...option) (c *command, err error) {
 
 	c.initVersionCmd()
 	c.initDBCmd()
+	c.initStateStoreCmd()
 
 	if err := c.initConfigurateOptionsCmd(); err != nil {
 		return nil, err
@@ -201,11 +237,21 @@ func (c *command) setHomeDir() (err error) {
 
 func (c *command) setAllFlags(cmd *cobra.Command) {
 	cmd.Flags().String(optionNameDataDir, filepath.Join(c.homeDir, ".pen"), "data directory")
+	cmd.Flags().String(optionNameStateStoreBackend, statestore.BackendLevelDB, fmt.Sprintf("statestore backend, %q or %q, an existing statestore has to be migrated with the statestore migrate command", statestore.BackendLevelDB, statestore.BackendBoltDB))
 	cmd.Flags().Uint64(optionNameCacheCapacity, 5000000, fmt.Sprintf("cache capacity in chunks, multiply by %d to get approximate capacity in bytes", penguin.ChunkSize))
+	cmd.Flags().String(optionNameCacheEviction, localstore.EvictionLRU, fmt.Sprintf("cache eviction policy, one of %q, %q or %q", localstore.EvictionLRU, localstore.EvictionFrequency, localstore.EvictionProximity))
+	cmd.Flags().Uint64(optionNameReserveCapacity, uint64(batchstore.Capacity), "reserve capacity in chunks, the postage batch chunks stored within the radius of responsibility, a smaller reserve raises the storage radius and a larger one lowers it")
+	cmd.Flags().Uint64(optionNamePinQuota, 0, "maximal number of distinct chunks of all pins, 0 means no limit")
+	cmd.Flags().String(optionNameCacheDir, "", "directory of the cache chunk payloads, defaults to the data directory")
+	cmd.Flags().String(optionNameReserveDir, "", "directory of the reserve chunk payloads, defaults to the data directory")
+	cmd.Flags().String(optionNamePinDir, "", "directory of the pinned chunk payloads, defaults to the data directory")
 	cmd.Flags().Uint64(optionNameDBOpenFilesLimit, 500, "number of open files allowed by database")
 	cmd.Flags().Uint64(optionNameDBBlockCacheCapacity, 32*1024*1024, "size of block cache of the database in bytes")
 	cmd.Flags().Uint64(optionNameDBWriteBufferSize, 32*1024*1024, "size of the database write buffer in bytes")
 	cmd.Flags().Bool(optionNameDBDisableSeeksCompaction, false, "disables db compactions triggered by seeks")
+	cmd.Flags().Float64(optionNameDBScrubRate, 0, "number of chunks per second checked by the storage integrity scrubber, 0 disables the scrubber")
+	cmd.Flags().Duration(optionNameDBScrubInterval, 24*time.Hour, "pause between two passes of the storage integrity scrubber")
+	cmd.Flags().Uint64(optionNameDBQuarantineCapacity, localstore.DefaultQuarantineCapacity, "number of corrupt chunks remembered by the storage integrity scrubber, the oldest are forgotten first")
 	cmd.Flags().String(optionNamePassword, "", "password for decrypting keys")
 	cmd.Flags().String(optionNamePasswordFile, "", "path to a file that contains password for decrypting keys")
 	cmd.Flags().String(optionNameAPIAddr, ":1633", "HTTP API listen address")
@@ -225,9 +271,16 @@ func (c *command) setAllFlags(cmd *cobra.Command) {
 	cmd.Flags().String(optionNameVerbosity, "info", "log verbosity level 0=silent, 1=error, 2=warn, 3=info, 4=debug, 5=trace")
 	cmd.Flags().String(optionWelcomeMessage, "", "send a welcome message string during handshakes")
 	cmd.Flags().Bool(optionNameGlobalPinningEnabled, false, "enable global pinning")
+	cmd.Flags().Bool(optionNameRemotePinningEnabled, false, "enable the remote pinning service api")
+	cmd.Flags().StringSlice(optionNameRemotePinningOwners, []string{}, "ethereum addresses of the owners allowed to use the remote pinning service, no owner if empty")
+	cmd.Flags().Int(optionNameRemotePinningQuota, remote.DefaultQuota, "maximal number of remote pin requests of an owner, 0 means no limit")
+	cmd.Flags().StringSlice(optionNameRemotePinningEndpoints, []string{}, "urls of the remote pinning services the api may delegate pins to, none if empty")
 	cmd.Flags().String(optionNamePaymentThreshold, "10000", "threshold in PEN where you expect to get paid from your peers")
 	cmd.Flags().String(optionNamePaymentTolerance, "100000", "excess debt above payment threshold in PEN where you disconnect from your peer")
 	cmd.Flags().String(optionNamePaymentEarly, "100000", "amount in PEN below the peers payment threshold when we initiate settlement")
+	cmd.Flags().String(optionNameRefreshRate, "1000000000000", "amount in PEN per second of time based settlement granted to full node peers")
+	cmd.Flags().String(optionNameLightRefreshRate, "100000000000", "amount in PEN per second of time based settlement granted to light node peers")
+	cmd.Flags().String(optionNameTimeSettlementLimit, "0", "debt in PEN below which only time based settlement is used, saving on-chain fees")
 	cmd.Flags().StringSlice(optionNameResolverEndpoints, []string{}, "ENS compatible API endpoint for a TLD and with contract address, can be repeated, format [tld:][contract-addr@]url")
 	cmd.Flags().Bool(optionNameGatewayMode, false, "disable a set of sensitive features in the api")
 	cmd.Flags().Bool(optionNameBootnodeMode, false, "cause the node to always accept incoming connections")
@@ -238,7 +291,20 @@ func (c *command) setAllFlags(cmd *cobra.Command) {
 	//cmd.Flags().String(optionNameSwapFactoryAddress, "", "swap factory addresses")
 	cmd.Flags().StringSlice(optionNameSwapLegacyFactoryAddresses, nil, "legacy swap factory addresses")
 	cmd.Flags().String(optionNameSwapInitialDeposit, "100000000", "initial deposit if deploying a new chequebook")
+	cmd.Flags().String(optionNameSwapDelegatedChequebook, "", "multi-issuer chequebook to issue delegated cheques from instead of deploying a chequebook")
+	cmd.Flags().String(optionNameSwapPriceOracleAddress, "", "price oracle contract of the exchange rate and first cheque deduction, without it the rate is 1 and there is no deduction")
 	cmd.Flags().Bool(optionNameSwapEnable, true, "enable swap")
+	cmd.Flags().String(optionNameSwapAutoCashoutThreshold, "0", "uncashed amount of a chequebook above which it is cashed automatically, 0 disables auto cashout")
+	cmd.Flags().String(optionNameSwapAutoCashoutFee, "3000000", "expected fee of a cashout transaction, smaller payouts are not cashed automatically")
+	cmd.Flags().String(optionNameSwapSolvencyThreshold, "0", "payment threshold announced to and enforced for peers with insolvent chequebooks, 0 keeps the payment threshold")
+	cmd.Flags().Bool(optionNameSwapSolvencyDisconnect, false, "disconnect peers with insolvent chequebooks")
+	cmd.Flags().Bool(optionNameDynamicPricing, false, "adjust the chunk prices to the load of the node")
+	cmd.Flags().Bool(optionNameAccountingLedger, false, "record the balance changes with peers in the accounting ledger")
+	cmd.Flags().Duration(optionNameAccountingLedgerRetention, 7*24*time.Hour, "age of the accounting ledger entries after which they are pruned, 0 keeps all entries")
+	cmd.Flags().Duration(optionNameBudgetWindow, 24*time.Hour, "time window of the spending budgets")
+	cmd.Flags().String(optionNameBudgetSoftLimit, "0", "amount spent on retrieval and push sync in a budget window above which content is served from the local store only, 0 disables the limit")
+	cmd.Flags().String(optionNameBudgetHardLimit, "0", "amount spent on retrieval and push sync in a budget window above which requests are rejected, 0 disables the limit")
+	cmd.Flags().Bool(optionNameBudgetRequireKey, false, "reject the api requests without the api key of a spending budget")
 	cmd.Flags().Bool(optionNameFullNode, false, "cause the node to start in full mode")
 	cmd.Flags().String(optionNamePostageContractAddress, "", "postage stamp contract address")
 	cmd.Flags().String(optionNameTransactionHash, "", "proof-of-identity transaction hash")
@@ -5,63 +5,95 @@
 package cmd
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/penguintop/penguin/pkg/crypto"
+	filekeystore "github.com/penguintop/penguin/pkg/keystore/file"
 	"github.com/penguintop/penguin/pkg/localstore"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/property"
 	"github.com/spf13/cobra"
 )
 
+const (
+	optionNameDBExportPinned   = "pinned"
+	optionNameDBExportBatch    = "batch"
+	optionNameDBExportBin      = "bin"
+	optionNameDBExportSince    = "since"
+	optionNameDBExportUntil    = "until"
+	optionNameDBExportFrom     = "from"
+	optionNameDBExportManifest = "manifest"
+	optionNameDBImportVerify   = "verify-only"
+	optionNameDBImportSigner   = "signer"
+
+	// dbProgressInterval is the minimal pause between
+	// two progress reports of an import.
+	dbProgressInterval = 5 * time.Second
+)
+
 func (c *command) initDBCmd() {
 	cmd := &cobra.Command{
 		Use:   "db",
 		Short: "Perform basic DB related operations",
 	}
 
-	dbExportCmd(cmd)
-	dbImportCmd(cmd)
+	c.dbExportCmd(cmd)
+	c.dbImportCmd(cmd)
 
 	c.root.AddCommand(cmd)
 }
 
-func dbExportCmd(cmd *cobra.Command) {
-	c := &cobra.Command{
+func (c *command) dbExportCmd(cmd *cobra.Command) {
+	cc := &cobra.Command{
 		Use:   "export <filename>",
 		Short: "Perform DB export to a file. Use \"-\" as filename in order to write to STDOUT",
+		Long: `Perform DB export to a file. Use "-" as filename in order to write to STDOUT.
+
+The export can be limited to pinned chunks, a postage batch, proximity order bins
+or a time range. With --from only the chunks stored after the export with the
+given manifest are exported. The manifest of the export is signed with the node
+key and written at the end of the export, --manifest also writes it to a file.`,
 		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			if (len(args)) != 1 {
 				return cmd.Help()
 			}
-			v, err := cmd.Flags().GetString(optionNameVerbosity)
+			logger, dataDir, err := dbCmdSetup(cmd)
 			if err != nil {
-				return fmt.Errorf("get verbosity: %v", err)
+				return err
 			}
-			v = strings.ToLower(v)
-			logger, err := newLogger(cmd, v)
+
+			o, err := dbExportOptions(cmd)
 			if err != nil {
-				return fmt.Errorf("new logger: %v", err)
+				return err
 			}
 
-			dataDir, err := cmd.Flags().GetString(optionNameDataDir)
+			key, overlay, err := c.dbNodeKey(cmd, dataDir)
 			if err != nil {
-				return fmt.Errorf("get data-dir: %v", err)
-			}
-			if dataDir == "" {
-				return errors.New("no data-dir provided")
+				return err
 			}
+			o.Signer = crypto.NewDefaultSigner(key)
 
 			logger.Infof("starting export process with data-dir at %s", dataDir)
 
 			path := filepath.Join(dataDir, "localstore")
 
-			storer, err := localstore.New(path, nil, nil, logger)
+			storer, err := localstore.New(path, overlay.Bytes(), nil, logger)
 			if err != nil {
 				return fmt.Errorf("localstore: %w", err)
 			}
+			defer storer.Close()
 
 			var out io.Writer
 			if args[0] == "-" {
@@ -74,58 +106,118 @@ func dbExportCmd(cmd *cobra.Command) {
 				defer f.Close()
 				out = f
 			}
-			c, err := storer.Export(out)
+			m, err := storer.Export(out, o)
 			if err != nil {
 				return fmt.Errorf("error exporting database: %v", err)
 			}
 
-			logger.Infof("database exported %d records successfully", c)
+			if manifestFile, _ := cmd.Flags().GetString(optionNameDBExportManifest); manifestFile != "" {
+				data, err := json.MarshalIndent(m, "", "  ")
+				if err != nil {
+					return err
+				}
+				if err := ioutil.WriteFile(manifestFile, data, 0644); err != nil {
+					return fmt.Errorf("write manifest: %w", err)
+				}
+			}
+
+			logger.Infof("database exported %d records successfully", m.Count)
 
 			return nil
 		},
 	}
-	c.Flags().String(optionNameDataDir, "", "data directory")
-	c.Flags().String(optionNameVerbosity, "info", "verbosity level")
-	cmd.AddCommand(c)
+	cc.Flags().String(optionNameDataDir, "", "data directory")
+	cc.Flags().String(optionNameVerbosity, "info", "verbosity level")
+	cc.Flags().String(optionNamePassword, "", "password for decrypting keys")
+	cc.Flags().String(optionNamePasswordFile, "", "path to a file that contains password for decrypting keys")
+	cc.Flags().Bool(optionNameDBExportPinned, false, "export only pinned chunks")
+	cc.Flags().String(optionNameDBExportBatch, "", "export only chunks stamped by the postage batch with this id")
+	cc.Flags().UintSlice(optionNameDBExportBin, nil, "export only chunks in these proximity order bins")
+	cc.Flags().String(optionNameDBExportSince, "", "export only chunks stored at or after this time (RFC 3339)")
+	cc.Flags().String(optionNameDBExportUntil, "", "export only chunks stored before this time (RFC 3339)")
+	cc.Flags().String(optionNameDBExportFrom, "", "export only chunks stored after the export with the manifest in this file")
+	cc.Flags().String(optionNameDBExportManifest, "", "write the manifest of the export to this file")
+	cmd.AddCommand(cc)
 }
 
-func dbImportCmd(cmd *cobra.Command) {
-	c := &cobra.Command{
+func (c *command) dbImportCmd(cmd *cobra.Command) {
+	cc := &cobra.Command{
 		Use:   "import <filename>",
 		Short: "Perform DB import from a file. Use \"-\" as filename in order to feed from STDIN",
+		Long: `Perform DB import from a file. Use "-" as filename in order to feed from STDIN.
+
+Chunks already in the database are skipped. The chunks and the manifest signature
+are verified against the manifest before any chunk is imported, --verify-only checks
+an export without importing it. An export read from STDIN is buffered in a temporary
+file to be read twice.`,
 		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			if (len(args)) != 1 {
 				return cmd.Help()
 			}
-			v, err := cmd.Flags().GetString(optionNameVerbosity)
+			logger, dataDir, err := dbCmdSetup(cmd)
 			if err != nil {
-				return fmt.Errorf("get verbosity: %v", err)
+				return err
 			}
-			v = strings.ToLower(v)
-			logger, err := newLogger(cmd, v)
-			if err != nil {
-				return fmt.Errorf("new logger: %v", err)
+
+			var o localstore.ImportOptions
+			if o.VerifyOnly, err = cmd.Flags().GetBool(optionNameDBImportVerify); err != nil {
+				return err
 			}
-			dataDir, err := cmd.Flags().GetString(optionNameDataDir)
-			if err != nil {
-				return fmt.Errorf("get data-dir: %v", err)
+			if s, _ := cmd.Flags().GetString(optionNameDBImportSigner); s != "" {
+				b, err := hex.DecodeString(s)
+				if err != nil {
+					return fmt.Errorf("decode signer public key: %w", err)
+				}
+				if o.Signer, err = crypto.DecodeSecp256k1PublicKey(b); err != nil {
+					return fmt.Errorf("decode signer public key: %w", err)
+				}
 			}
-			if dataDir == "" {
-				return errors.New("no data-dir provided")
+			lastProgress := time.Now()
+			o.Progress = func(p localstore.ImportProgress) {
+				if time.Since(lastProgress) < dbProgressInterval {
+					return
+				}
+				lastProgress = time.Now()
+				logger.Infof("read %d chunks, imported %d, skipped %d, invalid %d", p.Read, p.Imported, p.Skipped, p.Invalid)
+			}
+
+			// the proximity order bins of the chunks depend on the overlay
+			// address, which is not needed to only verify the export
+			var baseKey []byte
+			if !o.VerifyOnly {
+				_, overlay, err := c.dbNodeKey(cmd, dataDir)
+				if err != nil {
+					return err
+				}
+				baseKey = overlay.Bytes()
 			}
 
 			fmt.Printf("starting import process with data-dir at %s\n", dataDir)
 
 			path := filepath.Join(dataDir, "localstore")
 
-			storer, err := localstore.New(path, nil, nil, logger)
+			storer, err := localstore.New(path, baseKey, nil, logger)
 			if err != nil {
 				return fmt.Errorf("localstore: %w", err)
 			}
+			defer storer.Close()
 
-			var in io.Reader
+			var in io.ReadSeeker
 			if args[0] == "-" {
-				in = os.Stdin
+				// the export is verified before it is imported
+				tmp, err := ioutil.TempFile("", "penguin-import-")
+				if err != nil {
+					return fmt.Errorf("error buffering input: %s", err)
+				}
+				defer os.Remove(tmp.Name())
+				defer tmp.Close()
+				if _, err := io.Copy(tmp, os.Stdin); err != nil {
+					return fmt.Errorf("error buffering input: %s", err)
+				}
+				if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+					return fmt.Errorf("error buffering input: %s", err)
+				}
+				in = tmp
 			} else {
 				f, err := os.Open(args[0])
 				if err != nil {
@@ -134,17 +226,140 @@ func dbImportCmd(cmd *cobra.Command) {
 				defer f.Close()
 				in = f
 			}
-			c, err := storer.Import(cmd.Context(), in)
+			res, err := storer.Import(cmd.Context(), in, o)
+			if res != nil {
+				fmt.Printf("read %d chunks, imported %d, skipped %d, invalid %d\n", res.Read, res.Imported, res.Skipped, res.Invalid)
+			}
 			if err != nil {
 				return fmt.Errorf("error importing database: %v", err)
 			}
 
-			fmt.Printf("database imported %d records successfully\n", c)
+			switch {
+			case res.Manifest == nil:
+				fmt.Println("export has no manifest, it could not be verified")
+			case res.Signer == nil:
+				fmt.Println("export verified against its manifest, the manifest is not signed")
+			default:
+				fmt.Printf("export verified against its manifest signed by %x\n", crypto.EncodeSecp256k1PublicKey(res.Signer))
+			}
+			if !o.VerifyOnly {
+				fmt.Printf("database imported %d records successfully\n", res.Imported)
+			}
 
 			return nil
 		},
 	}
-	c.Flags().String(optionNameDataDir, "", "data directory")
-	c.Flags().String(optionNameVerbosity, "info", "verbosity level")
-	cmd.AddCommand(c)
+	cc.Flags().String(optionNameDataDir, "", "data directory")
+	cc.Flags().String(optionNameVerbosity, "info", "verbosity level")
+	cc.Flags().String(optionNamePassword, "", "password for decrypting keys")
+	cc.Flags().String(optionNamePasswordFile, "", "path to a file that contains password for decrypting keys")
+	cc.Flags().Bool(optionNameDBImportVerify, false, "verify the export without importing it")
+	cc.Flags().String(optionNameDBImportSigner, "", "hex encoded public key expected to sign the export manifest")
+	cmd.AddCommand(cc)
+}
+
+// dbCmdSetup returns the logger and the data directory of a db command.
+func dbCmdSetup(cmd *cobra.Command) (logging.Logger, string, error) {
+	v, err := cmd.Flags().GetString(optionNameVerbosity)
+	if err != nil {
+		return nil, "", fmt.Errorf("get verbosity: %v", err)
+	}
+	v = strings.ToLower(v)
+	logger, err := newLogger(cmd, v)
+	if err != nil {
+		return nil, "", fmt.Errorf("new logger: %v", err)
+	}
+
+	dataDir, err := cmd.Flags().GetString(optionNameDataDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("get data-dir: %v", err)
+	}
+	if dataDir == "" {
+		return nil, "", errors.New("no data-dir provided")
+	}
+	return logger, dataDir, nil
+}
+
+// dbExportOptions returns the export filters set by the flags.
+func dbExportOptions(cmd *cobra.Command) (o localstore.ExportOptions, err error) {
+	if o.Pinned, err = cmd.Flags().GetBool(optionNameDBExportPinned); err != nil {
+		return o, err
+	}
+	if s, _ := cmd.Flags().GetString(optionNameDBExportBatch); s != "" {
+		if o.BatchID, err = hex.DecodeString(s); err != nil {
+			return o, fmt.Errorf("decode batch id: %w", err)
+		}
+	}
+	bins, err := cmd.Flags().GetUintSlice(optionNameDBExportBin)
+	if err != nil {
+		return o, err
+	}
+	for _, bin := range bins {
+		if bin > uint(penguin.MaxPO) {
+			return o, fmt.Errorf("invalid bin %d", bin)
+		}
+		o.Bins = append(o.Bins, uint8(bin))
+	}
+	if s, _ := cmd.Flags().GetString(optionNameDBExportSince); s != "" {
+		if o.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			return o, fmt.Errorf("parse since: %w", err)
+		}
+	}
+	if s, _ := cmd.Flags().GetString(optionNameDBExportUntil); s != "" {
+		if o.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			return o, fmt.Errorf("parse until: %w", err)
+		}
+	}
+	if f, _ := cmd.Flags().GetString(optionNameDBExportFrom); f != "" {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return o, fmt.Errorf("read manifest: %w", err)
+		}
+		var m localstore.ExportManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return o, fmt.Errorf("decode manifest: %w", err)
+		}
+		o.From = m.Checkpoint
+	}
+	return o, nil
+}
+
+// dbNodeKey unlocks the penguin key of the node in the data directory. It
+// signs the export manifests and its overlay address is the base key of
+// the localstore.
+func (c *command) dbNodeKey(cmd *cobra.Command, dataDir string) (*ecdsa.PrivateKey, penguin.Address, error) {
+	keystore := filekeystore.New(filepath.Join(dataDir, "keys"))
+	exists, err := keystore.Exists("penguin")
+	if err != nil {
+		return nil, penguin.ZeroAddress, err
+	}
+	if !exists {
+		return nil, penguin.ZeroAddress, errors.New("no node keys in data-dir")
+	}
+
+	var password string
+	if p, _ := cmd.Flags().GetString(optionNamePassword); p != "" {
+		password = p
+	} else if pf, _ := cmd.Flags().GetString(optionNamePasswordFile); pf != "" {
+		b, err := ioutil.ReadFile(pf)
+		if err != nil {
+			return nil, penguin.ZeroAddress, err
+		}
+		password = string(bytes.Trim(b, "\n"))
+	} else {
+		password, err = terminalPromptPassword(cmd, c.passwordReader, "Password")
+		if err != nil {
+			return nil, penguin.ZeroAddress, err
+		}
+	}
+
+	key, _, err := keystore.Key("penguin", password)
+	if err != nil {
+		return nil, penguin.ZeroAddress, fmt.Errorf("penguin key: %w", err)
+	}
+	overlay, err := crypto.NewOverlayAddress(key.PublicKey, uint64(property.CHAIN_ID_NUM))
+	if err != nil {
+		return nil, penguin.ZeroAddress, err
+	}
+	return key, overlay, nil
 }
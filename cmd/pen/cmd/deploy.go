@@ -36,7 +36,7 @@ func (c *command) initDeployCmd() error {
 			swapEndpoint := c.config.GetString(optionNameSwapEndpoint)
 			deployGasPrice := c.config.GetString(optionNameSwapDeploymentGasPrice)
 
-			stateStore, err := node.InitStateStore(logger, dataDir)
+			stateStore, err := node.InitStateStore(logger, dataDir, c.config.GetString(optionNameStateStoreBackend))
 			if err != nil {
 				return err
 			}
@@ -96,6 +96,7 @@ func (c *command) initDeployCmd() error {
 				chequebookFactory,
 				swapInitialDeposit,
 				deployGasPrice,
+				"",
 			)
 
 			return err
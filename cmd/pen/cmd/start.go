@@ -128,11 +128,21 @@ HHHHHHHHHHHHHHHHHHHHH
 
 			b, err := node.NewPen(c.config.GetString(optionNameP2PAddr), signerConfig.address, *signerConfig.publicKey, signerConfig.signer, uint64(property.CHAIN_ID_NUM), logger, signerConfig.libp2pPrivateKey, signerConfig.pssPrivateKey, node.Options{
 				DataDir:                  c.config.GetString(optionNameDataDir),
+				StateStoreBackend:        c.config.GetString(optionNameStateStoreBackend),
 				CacheCapacity:            c.config.GetUint64(optionNameCacheCapacity),
+				CacheEviction:            c.config.GetString(optionNameCacheEviction),
+				ReserveCapacity:          c.config.GetUint64(optionNameReserveCapacity),
+				PinQuota:                 c.config.GetUint64(optionNamePinQuota),
+				CacheDir:                 c.config.GetString(optionNameCacheDir),
+				ReserveDir:               c.config.GetString(optionNameReserveDir),
+				PinDir:                   c.config.GetString(optionNamePinDir),
 				DBOpenFilesLimit:         c.config.GetUint64(optionNameDBOpenFilesLimit),
 				DBBlockCacheCapacity:     c.config.GetUint64(optionNameDBBlockCacheCapacity),
 				DBWriteBufferSize:        c.config.GetUint64(optionNameDBWriteBufferSize),
 				DBDisableSeeksCompaction: c.config.GetBool(optionNameDBDisableSeeksCompaction),
+				DBScrubRate:              c.config.GetFloat64(optionNameDBScrubRate),
+				DBScrubInterval:          c.config.GetDuration(optionNameDBScrubInterval),
+				DBQuarantineCapacity:     c.config.GetUint64(optionNameDBQuarantineCapacity),
 				APIAddr:                  c.config.GetString(optionNameAPIAddr),
 				DebugAPIAddr:             debugAPIAddr,
 				Addr:                     c.config.GetString(optionNameP2PAddr),
@@ -148,9 +158,16 @@ HHHHHHHHHHHHHHHHHHHHH
 				TracingServiceName:       c.config.GetString(optionNameTracingServiceName),
 				Logger:                   logger,
 				GlobalPinningEnabled:     c.config.GetBool(optionNameGlobalPinningEnabled),
+				RemotePinningEnabled:     c.config.GetBool(optionNameRemotePinningEnabled),
+				RemotePinningOwners:      c.config.GetStringSlice(optionNameRemotePinningOwners),
+				RemotePinningQuota:       c.config.GetInt(optionNameRemotePinningQuota),
+				RemotePinningEndpoints:   c.config.GetStringSlice(optionNameRemotePinningEndpoints),
 				PaymentThreshold:         c.config.GetString(optionNamePaymentThreshold),
 				PaymentTolerance:         c.config.GetString(optionNamePaymentTolerance),
 				PaymentEarly:             c.config.GetString(optionNamePaymentEarly),
+				RefreshRate:              c.config.GetString(optionNameRefreshRate),
+				LightRefreshRate:         c.config.GetString(optionNameLightRefreshRate),
+				TimeSettlementLimit:      c.config.GetString(optionNameTimeSettlementLimit),
 				ResolverConnectionCfgs:   resolverCfgs,
 				GatewayMode:              c.config.GetBool(optionNameGatewayMode),
 				BootnodeMode:             bootNode,
@@ -159,7 +176,20 @@ HHHHHHHHHHHHHHHHHHHHH
 				SwapFactoryAddress:         "",
 				SwapLegacyFactoryAddresses: c.config.GetStringSlice(optionNameSwapLegacyFactoryAddresses),
 				SwapInitialDeposit:         c.config.GetString(optionNameSwapInitialDeposit),
+				SwapDelegatedChequebook:    c.config.GetString(optionNameSwapDelegatedChequebook),
+				SwapPriceOracleAddress:     c.config.GetString(optionNameSwapPriceOracleAddress),
 				SwapEnable:                 c.config.GetBool(optionNameSwapEnable),
+				SwapAutoCashoutThreshold:   c.config.GetString(optionNameSwapAutoCashoutThreshold),
+				SwapAutoCashoutFee:         c.config.GetString(optionNameSwapAutoCashoutFee),
+				SwapSolvencyThreshold:      c.config.GetString(optionNameSwapSolvencyThreshold),
+				SwapSolvencyDisconnect:     c.config.GetBool(optionNameSwapSolvencyDisconnect),
+				DynamicPricing:             c.config.GetBool(optionNameDynamicPricing),
+				AccountingLedger:           c.config.GetBool(optionNameAccountingLedger),
+				AccountingLedgerRetention:  c.config.GetDuration(optionNameAccountingLedgerRetention),
+				BudgetWindow:               c.config.GetDuration(optionNameBudgetWindow),
+				BudgetSoftLimit:            c.config.GetString(optionNameBudgetSoftLimit),
+				BudgetHardLimit:            c.config.GetString(optionNameBudgetHardLimit),
+				BudgetRequireKey:           c.config.GetBool(optionNameBudgetRequireKey),
 				FullNodeMode:               fullNode,
 				Transaction:                c.config.GetString(optionNameTransactionHash),
 				PostageContractAddress:     c.config.GetString(optionNamePostageContractAddress),
@@ -0,0 +1,365 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/statestore"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	optionNameStateStorePrefix = "prefix"
+	optionNameStateStoreTo     = "to"
+)
+
+func (c *command) initStateStoreCmd() {
+	cmd := &cobra.Command{
+		Use:   "statestore",
+		Short: "Inspect, compact and migrate the node statestore",
+		Long: `Inspect, compact and migrate the node statestore.
+
+The commands open the statestore in the data directory, the node
+must not be running while they are executed.`,
+	}
+
+	c.stateStoreListCmd(cmd)
+	c.stateStoreGetCmd(cmd)
+	c.stateStoreDeleteCmd(cmd)
+	c.stateStoreExportCmd(cmd)
+	c.stateStoreCompactCmd(cmd)
+	c.stateStoreMigrateCmd(cmd)
+
+	c.root.AddCommand(cmd)
+}
+
+func (c *command) stateStoreListCmd(cmd *cobra.Command) {
+	cc := &cobra.Command{
+		Use:   "list",
+		Short: "List the keys and the value sizes of the statestore entries",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			s, _, err := stateStoreCmdOpen(cmd)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			prefix, err := cmd.Flags().GetString(optionNameStateStorePrefix)
+			if err != nil {
+				return err
+			}
+			var count int
+			err = s.Iterate(prefix, func(key, value []byte) (bool, error) {
+				cmd.Printf("%s\t%d\n", key, len(value))
+				count++
+				return false, nil
+			})
+			if err != nil {
+				return fmt.Errorf("iterate statestore: %w", err)
+			}
+			cmd.Printf("%d entries\n", count)
+			return nil
+		},
+	}
+	stateStoreCmdFlags(cc)
+	cc.Flags().String(optionNameStateStorePrefix, "", "list only the keys with this prefix")
+	cmd.AddCommand(cc)
+}
+
+func (c *command) stateStoreGetCmd(cmd *cobra.Command) {
+	cc := &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print the value of a statestore entry",
+		Long: `Print the value of a statestore entry.
+
+JSON values are printed as they are, binary values are hex encoded.`,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if len(args) != 1 {
+				return cmd.Help()
+			}
+			s, _, err := stateStoreCmdOpen(cmd)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			var v statestore.RawValue
+			if err := s.Get(args[0], &v); err != nil {
+				if errors.Is(err, storage.ErrNotFound) {
+					return fmt.Errorf("key %q not found", args[0])
+				}
+				return fmt.Errorf("get %q: %w", args[0], err)
+			}
+			if json.Valid(v) {
+				cmd.Println(string(v))
+			} else {
+				cmd.Println(hex.EncodeToString(v))
+			}
+			return nil
+		},
+	}
+	stateStoreCmdFlags(cc)
+	cmd.AddCommand(cc)
+}
+
+func (c *command) stateStoreDeleteCmd(cmd *cobra.Command) {
+	cc := &cobra.Command{
+		Use:   "delete [key]",
+		Short: "Delete a statestore entry or all entries with a key prefix",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			prefix, err := cmd.Flags().GetString(optionNameStateStorePrefix)
+			if err != nil {
+				return err
+			}
+			if (len(args) == 1) == (prefix != "") {
+				return errors.New("either a key or a key prefix has to be provided")
+			}
+			s, _, err := stateStoreCmdOpen(cmd)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			var keys []string
+			if prefix == "" {
+				if err := s.Get(args[0], new(statestore.RawValue)); err != nil {
+					if errors.Is(err, storage.ErrNotFound) {
+						return fmt.Errorf("key %q not found", args[0])
+					}
+					return fmt.Errorf("get %q: %w", args[0], err)
+				}
+				keys = append(keys, args[0])
+			} else {
+				err = s.Iterate(prefix, func(key, _ []byte) (bool, error) {
+					keys = append(keys, string(key))
+					return false, nil
+				})
+				if err != nil {
+					return fmt.Errorf("iterate statestore: %w", err)
+				}
+			}
+			for _, key := range keys {
+				if err := s.Delete(key); err != nil {
+					return fmt.Errorf("delete %q: %w", key, err)
+				}
+			}
+			cmd.Printf("deleted %d entries\n", len(keys))
+			return nil
+		},
+	}
+	stateStoreCmdFlags(cc)
+	cc.Flags().String(optionNameStateStorePrefix, "", "delete all the entries with this key prefix")
+	cmd.AddCommand(cc)
+}
+
+// stateStoreExportEntry is a single line of a statestore export.
+type stateStoreExportEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (c *command) stateStoreExportCmd(cmd *cobra.Command) {
+	cc := &cobra.Command{
+		Use:   "export <filename>",
+		Short: "Export the statestore entries to a file. Use \"-\" as filename in order to write to STDOUT",
+		Long: `Export the statestore entries to a file. Use "-" as filename in order to write to STDOUT.
+
+Every entry is written as a JSON object on its own line, with the key
+and the hex encoded value.`,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if len(args) != 1 {
+				return cmd.Help()
+			}
+			s, logger, err := stateStoreCmdOpen(cmd)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			prefix, err := cmd.Flags().GetString(optionNameStateStorePrefix)
+			if err != nil {
+				return err
+			}
+
+			var out io.Writer
+			if args[0] == "-" {
+				out = os.Stdout
+			} else {
+				f, err := os.Create(args[0])
+				if err != nil {
+					return fmt.Errorf("error opening output file: %s", err)
+				}
+				defer f.Close()
+				out = f
+			}
+			enc := json.NewEncoder(out)
+			var count int
+			err = s.Iterate(prefix, func(key, value []byte) (bool, error) {
+				count++
+				return false, enc.Encode(stateStoreExportEntry{
+					Key:   string(key),
+					Value: hex.EncodeToString(value),
+				})
+			})
+			if err != nil {
+				return fmt.Errorf("export statestore: %w", err)
+			}
+			logger.Infof("statestore exported %d entries successfully", count)
+			return nil
+		},
+	}
+	stateStoreCmdFlags(cc)
+	cc.Flags().String(optionNameStateStorePrefix, "", "export only the entries with this key prefix")
+	cmd.AddCommand(cc)
+}
+
+func (c *command) stateStoreCompactCmd(cmd *cobra.Command) {
+	cc := &cobra.Command{
+		Use:   "compact",
+		Short: "Compact the statestore to reclaim the space of deleted entries",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			s, logger, err := stateStoreCmdOpen(cmd)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			logger.Info("compacting statestore")
+			if err := statestore.Compact(s); err != nil {
+				return fmt.Errorf("compact statestore: %w", err)
+			}
+			logger.Info("statestore compacted successfully")
+			return nil
+		},
+	}
+	stateStoreCmdFlags(cc)
+	cmd.AddCommand(cc)
+}
+
+func (c *command) stateStoreMigrateCmd(cmd *cobra.Command) {
+	cc := &cobra.Command{
+		Use:   "migrate",
+		Short: "Copy the statestore to another backend",
+		Long: `Copy the statestore to another backend.
+
+All the entries of the statestore of the --statestore-backend are copied
+to a new statestore of the --to backend in the same data directory. The
+kademlia metrics, which the leveldb statestore keeps itself, are copied
+to their separate database for the other backends and back. The source
+statestore is left as it is, the node uses the new statestore once it is
+started with the new backend and the source statestore is removed.`,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			logger, dataDir, err := dbCmdSetup(cmd)
+			if err != nil {
+				return err
+			}
+			from, err := cmd.Flags().GetString(optionNameStateStoreBackend)
+			if err != nil {
+				return err
+			}
+			to, err := cmd.Flags().GetString(optionNameStateStoreTo)
+			if err != nil {
+				return err
+			}
+			if _, err := statestore.Path(dataDir, to); err != nil {
+				return err
+			}
+			if from == to {
+				return fmt.Errorf("statestore is already using the %s backend", to)
+			}
+			exists, err := statestore.Exists(dataDir, from)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("no %s statestore in data-dir", from)
+			}
+			exists, err = statestore.Exists(dataDir, to)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return fmt.Errorf("%s statestore already exists in data-dir", to)
+			}
+
+			src, err := statestore.OpenPath(dataDir, from, logger)
+			if err != nil {
+				return fmt.Errorf("open %s statestore: %w", from, err)
+			}
+			defer src.Close()
+			dst, err := statestore.OpenPath(dataDir, to, logger)
+			if err != nil {
+				return fmt.Errorf("create %s statestore: %w", to, err)
+			}
+
+			n, err := statestore.Copy(dst, src, "")
+			if err != nil {
+				_ = dst.Close()
+				return fmt.Errorf("copy statestore: %w", err)
+			}
+			m, err := statestore.MigrateMetrics(dataDir, dst, src)
+			if err != nil {
+				_ = dst.Close()
+				return fmt.Errorf("migrate kademlia metrics: %w", err)
+			}
+			if err := dst.Close(); err != nil {
+				return fmt.Errorf("close %s statestore: %w", to, err)
+			}
+
+			path, _ := statestore.Path(dataDir, from)
+			logger.Infof("statestore migrated %d entries from %s to %s successfully", n, from, to)
+			if m > 0 {
+				logger.Infof("kademlia metrics migrated %d entries", m)
+			}
+			logger.Infof("start the node with --%s=%s and remove %s", optionNameStateStoreBackend, to, path)
+			if m > 0 && to == statestore.BackendLevelDB {
+				logger.Infof("remove %s as well, the %s statestore keeps the kademlia metrics", statestore.MetricsPath(dataDir), to)
+			}
+			return nil
+		},
+	}
+	stateStoreCmdFlags(cc)
+	cc.Flags().String(optionNameStateStoreTo, statestore.BackendBoltDB, "backend of the new statestore")
+	cmd.AddCommand(cc)
+}
+
+// stateStoreCmdFlags sets the flags common to all statestore commands.
+func stateStoreCmdFlags(cmd *cobra.Command) {
+	cmd.Flags().String(optionNameDataDir, "", "data directory")
+	cmd.Flags().String(optionNameVerbosity, "info", "verbosity level")
+	cmd.Flags().String(optionNameStateStoreBackend, statestore.BackendLevelDB, "statestore backend")
+}
+
+// stateStoreCmdOpen opens the statestore of a statestore command.
+func stateStoreCmdOpen(cmd *cobra.Command) (storage.StateStorer, logging.Logger, error) {
+	logger, dataDir, err := dbCmdSetup(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	backend, err := cmd.Flags().GetString(optionNameStateStoreBackend)
+	if err != nil {
+		return nil, nil, err
+	}
+	exists, err := statestore.Exists(dataDir, backend)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exists {
+		return nil, nil, fmt.Errorf("no %s statestore in data-dir", backend)
+	}
+	s, err := statestore.Open(dataDir, backend, logger)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open statestore: %w", err)
+	}
+	return s, logger, nil
+}
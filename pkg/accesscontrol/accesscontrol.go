@@ -0,0 +1,311 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package accesscontrol restricts access to uploaded content to the grantees
+// of the publisher.
+//
+// The reference of the content is encrypted with an access key. The access key
+// is stored in an access control trie, encrypted once for every grantee with a
+// key that only the publisher and the grantee can derive using ECDH. The
+// tries are kept in a history, so that the grantees can be changed over time
+// without losing access to content uploaded earlier.
+package accesscontrol
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/encryption"
+	"github.com/penguintop/penguin/pkg/file"
+	"github.com/penguintop/penguin/pkg/manifest"
+	"github.com/penguintop/penguin/pkg/penguin"
+)
+
+var (
+	// ErrNotFound is returned when the history has no access control trie
+	// at the requested time.
+	ErrNotFound = errors.New("accesscontrol: not found")
+	// ErrNotGranted is returned when the requester is not a grantee of the
+	// publisher.
+	ErrNotGranted = errors.New("accesscontrol: access not granted")
+)
+
+var (
+	lookupKeyNonce              = []byte{0}
+	accessKeyDecryptionKeyNonce = []byte{1}
+)
+
+// saltLength is the length of the random salt of the keys of every access
+// control trie, so that the keys shared with a grantee differ between the
+// versions of the history.
+const saltLength = 32
+
+// Controller encrypts and decrypts references and manages the grantees of
+// the publisher.
+type Controller interface {
+	// Upload encrypts the reference with the access key of the history that
+	// is in effect now. A new history with the publisher as the only grantee
+	// is created if the history reference is zero.
+	Upload(ctx context.Context, ls file.LoadSaver, reference, historyRef penguin.Address) (encryptedRef, newHistoryRef penguin.Address, err error)
+	// Download decrypts the reference encrypted by the publisher with the
+	// access key of the history that was in effect at the unix timestamp.
+	Download(ctx context.Context, ls file.LoadSaver, encryptedRef penguin.Address, publisher *ecdsa.PublicKey, historyRef penguin.Address, timestamp int64) (penguin.Address, error)
+	// UpdateGrantees adds and revokes grantees, storing the new grantee list
+	// and a new history entry. Revoking a grantee changes the access key, so
+	// that the revoked grantee has no access to content uploaded later.
+	UpdateGrantees(ctx context.Context, ls file.LoadSaver, granteeRef, historyRef penguin.Address, add, revoke []*ecdsa.PublicKey) (newGranteeRef, newHistoryRef penguin.Address, err error)
+	// Grantees returns the grantee list stored by UpdateGrantees.
+	Grantees(ctx context.Context, ls file.LoadSaver, granteeRef penguin.Address) ([]*ecdsa.PublicKey, error)
+}
+
+// Service is the Controller of the node key.
+type Service struct {
+	session   Session
+	publisher *ecdsa.PublicKey
+	timeNow   func() time.Time
+}
+
+// New returns a Controller that publishes and accesses content with the key.
+func New(key *ecdsa.PrivateKey) *Service {
+	return &Service{
+		session:   NewDefaultSession(key),
+		publisher: &key.PublicKey,
+		timeNow:   time.Now,
+	}
+}
+
+func (s *Service) Upload(ctx context.Context, ls file.LoadSaver, reference, historyRef penguin.Address) (penguin.Address, penguin.Address, error) {
+	var (
+		accessKey []byte
+		err       error
+	)
+	if historyRef.IsZero() {
+		accessKey = encryption.GenerateRandomKey(encryption.KeyLength)
+		h, err := newHistory(ls)
+		if err != nil {
+			return penguin.ZeroAddress, penguin.ZeroAddress, err
+		}
+		historyRef, err = s.addVersion(ctx, ls, h, accessKey, nil)
+		if err != nil {
+			return penguin.ZeroAddress, penguin.ZeroAddress, err
+		}
+	} else {
+		accessKey, err = s.accessKey(ctx, ls, historyRef, s.publisher, s.timeNow().UnixNano())
+		if err != nil {
+			return penguin.ZeroAddress, penguin.ZeroAddress, err
+		}
+	}
+
+	encryptedRef, err := encryption.New(accessKey, 0, 0, penguin.NewHasher).Encrypt(reference.Bytes())
+	if err != nil {
+		return penguin.ZeroAddress, penguin.ZeroAddress, fmt.Errorf("encrypt reference: %w", err)
+	}
+	return penguin.NewAddress(encryptedRef), historyRef, nil
+}
+
+func (s *Service) Download(ctx context.Context, ls file.LoadSaver, encryptedRef penguin.Address, publisher *ecdsa.PublicKey, historyRef penguin.Address, timestamp int64) (penguin.Address, error) {
+	// the timestamp is in seconds, the trie in effect is the one
+	// of the last history entry within the second
+	accessKey, err := s.accessKey(ctx, ls, historyRef, publisher, time.Unix(timestamp+1, 0).UnixNano()-1)
+	if err != nil {
+		return penguin.ZeroAddress, err
+	}
+
+	ref, err := encryption.New(accessKey, 0, 0, penguin.NewHasher).Decrypt(encryptedRef.Bytes())
+	if err != nil {
+		return penguin.ZeroAddress, fmt.Errorf("decrypt reference: %w", err)
+	}
+	return penguin.NewAddress(ref), nil
+}
+
+func (s *Service) UpdateGrantees(ctx context.Context, ls file.LoadSaver, granteeRef, historyRef penguin.Address, add, revoke []*ecdsa.PublicKey) (penguin.Address, penguin.Address, error) {
+	list := new(granteeList)
+	if !granteeRef.IsZero() {
+		var err error
+		if list, err = s.loadGrantees(ctx, ls, granteeRef); err != nil {
+			return penguin.ZeroAddress, penguin.ZeroAddress, err
+		}
+	}
+	list.add(add)
+	revoked := list.remove(revoke)
+
+	var (
+		h         *history
+		accessKey []byte
+		err       error
+	)
+	if historyRef.IsZero() {
+		h, err = newHistory(ls)
+	} else {
+		h, err = newHistoryReference(historyRef, ls)
+		// keep the access key if nobody is revoked, so that new grantees
+		// have access to the content uploaded earlier
+		if err == nil && revoked == 0 {
+			accessKey, err = s.accessKey(ctx, ls, historyRef, s.publisher, s.timeNow().UnixNano())
+		}
+	}
+	if err != nil {
+		return penguin.ZeroAddress, penguin.ZeroAddress, err
+	}
+	if accessKey == nil {
+		accessKey = encryption.GenerateRandomKey(encryption.KeyLength)
+	}
+
+	newHistoryRef, err := s.addVersion(ctx, ls, h, accessKey, list.keys)
+	if err != nil {
+		return penguin.ZeroAddress, penguin.ZeroAddress, err
+	}
+	newGranteeRef, err := s.storeGrantees(ctx, ls, list)
+	if err != nil {
+		return penguin.ZeroAddress, penguin.ZeroAddress, err
+	}
+	return newGranteeRef, newHistoryRef, nil
+}
+
+func (s *Service) Grantees(ctx context.Context, ls file.LoadSaver, granteeRef penguin.Address) ([]*ecdsa.PublicKey, error) {
+	list, err := s.loadGrantees(ctx, ls, granteeRef)
+	if err != nil {
+		return nil, err
+	}
+	return list.keys, nil
+}
+
+// addVersion stores the access control trie with the access key encrypted
+// for the grantees and the publisher, and adds it to the history. The keys
+// of the trie are derived with a new random salt.
+func (s *Service) addVersion(ctx context.Context, ls file.LoadSaver, h *history, accessKey []byte, grantees []*ecdsa.PublicKey) (penguin.Address, error) {
+	act, err := manifest.NewMantarayManifest(ls, false)
+	if err != nil {
+		return penguin.ZeroAddress, err
+	}
+	salt := encryption.GenerateRandomKey(saltLength)
+
+	all := new(granteeList)
+	all.add([]*ecdsa.PublicKey{s.publisher})
+	all.add(grantees)
+	for _, grantee := range all.keys {
+		lookupKey, decryptionKey, err := s.keys(grantee, salt)
+		if err != nil {
+			return penguin.ZeroAddress, err
+		}
+		encryptedKey, err := encryption.New(decryptionKey, 0, 0, penguin.NewHasher).Encrypt(accessKey)
+		if err != nil {
+			return penguin.ZeroAddress, fmt.Errorf("encrypt access key: %w", err)
+		}
+		if err := act.Add(ctx, hex.EncodeToString(lookupKey), manifest.NewEntry(penguin.NewAddress(encryptedKey), nil)); err != nil {
+			return penguin.ZeroAddress, err
+		}
+	}
+
+	actRef, err := act.Store(ctx)
+	if err != nil {
+		return penguin.ZeroAddress, fmt.Errorf("store access control trie: %w", err)
+	}
+	if err := h.add(ctx, s.timeNow().UnixNano(), actRef, salt); err != nil {
+		return penguin.ZeroAddress, err
+	}
+	historyRef, err := h.store(ctx)
+	if err != nil {
+		return penguin.ZeroAddress, fmt.Errorf("store history: %w", err)
+	}
+	return historyRef, nil
+}
+
+// accessKey returns the access key of the history at the timestamp in
+// nanoseconds, decrypted with the key shared with the publisher.
+func (s *Service) accessKey(ctx context.Context, ls file.LoadSaver, historyRef penguin.Address, publisher *ecdsa.PublicKey, timestamp int64) ([]byte, error) {
+	h, err := newHistoryReference(historyRef, ls)
+	if err != nil {
+		return nil, err
+	}
+	actRef, salt, err := h.lookup(ctx, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	act, err := manifest.NewMantarayManifestReference(actRef, ls)
+	if err != nil {
+		return nil, err
+	}
+
+	lookupKey, decryptionKey, err := s.keys(publisher, salt)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := act.Lookup(ctx, hex.EncodeToString(lookupKey))
+	if err != nil {
+		if errors.Is(err, manifest.ErrNotFound) {
+			return nil, ErrNotGranted
+		}
+		return nil, err
+	}
+	accessKey, err := encryption.New(decryptionKey, 0, 0, penguin.NewHasher).Decrypt(entry.Reference().Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("decrypt access key: %w", err)
+	}
+	return accessKey, nil
+}
+
+// keys returns the lookup key and the access key decryption key shared with
+// the counterparty for the access control trie with the salt.
+func (s *Service) keys(publicKey *ecdsa.PublicKey, salt []byte) (lookupKey, decryptionKey []byte, err error) {
+	nonces := [][]byte{
+		append(append([]byte{}, salt...), lookupKeyNonce...),
+		append(append([]byte{}, salt...), accessKeyDecryptionKeyNonce...),
+	}
+	keys, err := s.session.Key(publicKey, nonces)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys[0], keys[1], nil
+}
+
+// storeGrantees stores the grantee list encrypted with a key that only the
+// publisher can derive. The random nonce of the key is prepended to the data.
+func (s *Service) storeGrantees(ctx context.Context, ls file.LoadSaver, list *granteeList) (penguin.Address, error) {
+	data, err := list.MarshalBinary()
+	if err != nil {
+		return penguin.ZeroAddress, err
+	}
+	nonce := encryption.GenerateRandomKey(encryption.KeyLength)
+	keys, err := s.session.Key(s.publisher, [][]byte{nonce})
+	if err != nil {
+		return penguin.ZeroAddress, err
+	}
+	encrypted, err := encryption.New(keys[0], 0, 0, penguin.NewHasher).Encrypt(data)
+	if err != nil {
+		return penguin.ZeroAddress, fmt.Errorf("encrypt grantee list: %w", err)
+	}
+	ref, err := ls.Save(ctx, append(nonce, encrypted...))
+	if err != nil {
+		return penguin.ZeroAddress, fmt.Errorf("store grantee list: %w", err)
+	}
+	return penguin.NewAddress(ref), nil
+}
+
+func (s *Service) loadGrantees(ctx context.Context, ls file.LoadSaver, granteeRef penguin.Address) (*granteeList, error) {
+	data, err := ls.Load(ctx, granteeRef.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("load grantee list: %w", err)
+	}
+	if len(data) < encryption.KeyLength {
+		return nil, errInvalidGranteeList
+	}
+	keys, err := s.session.Key(s.publisher, [][]byte{data[:encryption.KeyLength]})
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := encryption.New(keys[0], 0, 0, penguin.NewHasher).Decrypt(data[encryption.KeyLength:])
+	if err != nil {
+		return nil, fmt.Errorf("decrypt grantee list: %w", err)
+	}
+	list := new(granteeList)
+	if err := list.UnmarshalBinary(decrypted); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package accesscontrol_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/accesscontrol"
+	"github.com/penguintop/penguin/pkg/crypto"
+	"github.com/penguintop/penguin/pkg/file/loadsave"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/penguintop/penguin/pkg/storage/mock"
+)
+
+func TestAccessControl(t *testing.T) {
+	ctx := context.Background()
+	ls := loadsave.New(mock.NewStorer(), storage.ModePutUpload, false)
+
+	publisherKey, grantee := newKey(t), newKey(t)
+	publisher := accesscontrol.New(publisherKey)
+	requester := accesscontrol.New(grantee)
+	setTime := func(ts int64) {
+		f := func() time.Time { return time.Unix(ts, 0) }
+		publisher.SetTimeNow(f)
+		requester.SetTimeNow(f)
+	}
+
+	ref1 := penguin.MustParseHexAddress("aa00000000000000000000000000000000000000000000000000000000000001")
+	ref2 := penguin.MustParseHexAddress("bb00000000000000000000000000000000000000000000000000000000000002")
+
+	download := func(t *testing.T, c accesscontrol.Controller, encryptedRef, historyRef penguin.Address, ts int64, want penguin.Address, wantErr error) {
+		t.Helper()
+
+		got, err := c.Download(ctx, ls, encryptedRef, &publisherKey.PublicKey, historyRef, ts)
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("got error %v, want %v", err, wantErr)
+		}
+		if wantErr == nil && !got.Equal(want) {
+			t.Fatalf("got reference %s, want %s", got, want)
+		}
+	}
+
+	setTime(1)
+	encryptedRef1, historyRef, err := publisher.Upload(ctx, ls, ref1, penguin.ZeroAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encryptedRef1.Equal(ref1) {
+		t.Fatal("reference not encrypted")
+	}
+	download(t, publisher, encryptedRef1, historyRef, 1, ref1, nil)
+	download(t, requester, encryptedRef1, historyRef, 1, penguin.ZeroAddress, accesscontrol.ErrNotGranted)
+	download(t, publisher, encryptedRef1, historyRef, 0, penguin.ZeroAddress, accesscontrol.ErrNotFound)
+
+	// granting access gives access to the earlier content
+	setTime(2)
+	granteeRef, historyRef, err := publisher.UpdateGrantees(ctx, ls, penguin.ZeroAddress, historyRef, []*ecdsa.PublicKey{&grantee.PublicKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download(t, requester, encryptedRef1, historyRef, 2, ref1, nil)
+	download(t, requester, encryptedRef1, historyRef, 1, penguin.ZeroAddress, accesscontrol.ErrNotGranted)
+
+	grantees, err := publisher.Grantees(ctx, ls, granteeRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grantees) != 1 || !grantees[0].Equal(&grantee.PublicKey) {
+		t.Fatalf("got grantees %v, want only the grantee", grantees)
+	}
+	// only the publisher can decrypt the grantee list
+	if grantees, err := requester.Grantees(ctx, ls, granteeRef); err == nil && len(grantees) == 1 && grantees[0].Equal(&grantee.PublicKey) {
+		t.Fatal("grantee list decrypted by other key")
+	}
+
+	// revoking access changes the key of the content uploaded later
+	setTime(3)
+	granteeRef, historyRef, err = publisher.UpdateGrantees(ctx, ls, granteeRef, historyRef, nil, []*ecdsa.PublicKey{&grantee.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTime(4)
+	encryptedRef2, _, err := publisher.Upload(ctx, ls, ref2, historyRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download(t, publisher, encryptedRef2, historyRef, 4, ref2, nil)
+	download(t, requester, encryptedRef2, historyRef, 4, penguin.ZeroAddress, accesscontrol.ErrNotGranted)
+	download(t, publisher, encryptedRef1, historyRef, 2, ref1, nil)
+
+	grantees, err = publisher.Grantees(ctx, ls, granteeRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grantees) != 0 {
+		t.Fatalf("got grantees %v, want none", grantees)
+	}
+
+	// granting access again at the time of the revocation adds a new
+	// history entry with the same access key
+	setTime(3)
+	_, historyRef, err = publisher.UpdateGrantees(ctx, ls, granteeRef, historyRef, []*ecdsa.PublicKey{&grantee.PublicKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download(t, requester, encryptedRef2, historyRef, 4, ref2, nil)
+	download(t, requester, encryptedRef1, historyRef, 2, ref1, nil)
+
+	// the keys of the versions are salted, so that the lookup keys
+	// of the publisher differ between all of them
+	versions, err := accesscontrol.HistoryLookupKeys(ctx, ls, historyRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 4 {
+		t.Fatalf("got %d history entries, want 4", len(versions))
+	}
+	seen := make(map[string]bool)
+	for _, keys := range versions {
+		for _, k := range keys {
+			if seen[k] {
+				t.Fatalf("lookup key %s used in more than one version", k)
+			}
+			seen[k] = true
+		}
+	}
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,42 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package accesscontrol
+
+import (
+	"context"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/file"
+	"github.com/penguintop/penguin/pkg/manifest"
+	"github.com/penguintop/penguin/pkg/penguin"
+)
+
+func (s *Service) SetTimeNow(f func() time.Time) {
+	s.timeNow = f
+}
+
+// HistoryLookupKeys returns the lookup keys of the access control tries
+// of every history entry, in the order of the history.
+func HistoryLookupKeys(ctx context.Context, ls file.LoadSaver, historyRef penguin.Address) ([][]string, error) {
+	h, err := newHistoryReference(historyRef, ls)
+	if err != nil {
+		return nil, err
+	}
+	var keys [][]string
+	err = h.m.IterateEntries(ctx, "", func(_ string, e manifest.Entry) error {
+		act, err := manifest.NewMantarayManifestReference(e.Reference(), ls)
+		if err != nil {
+			return err
+		}
+		var actKeys []string
+		err = act.IterateEntries(ctx, "", func(p string, _ manifest.Entry) error {
+			actKeys = append(actKeys, p)
+			return nil
+		})
+		keys = append(keys, actKeys)
+		return err
+	})
+	return keys, err
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package accesscontrol
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+
+	"github.com/penguintop/penguin/pkg/crypto"
+)
+
+// publicKeySize is the size of the compressed public key of a grantee.
+const publicKeySize = 33
+
+var errInvalidGranteeList = errors.New("invalid grantee list")
+
+// granteeList is the set of public keys that the publisher grants access to.
+type granteeList struct {
+	keys []*ecdsa.PublicKey
+}
+
+// add adds the keys that are not already in the list.
+func (g *granteeList) add(keys []*ecdsa.PublicKey) {
+	for _, k := range keys {
+		if g.index(k) < 0 {
+			g.keys = append(g.keys, k)
+		}
+	}
+}
+
+// remove removes the keys from the list, returning the number of removed keys.
+func (g *granteeList) remove(keys []*ecdsa.PublicKey) int {
+	var removed int
+	for _, k := range keys {
+		if i := g.index(k); i >= 0 {
+			g.keys = append(g.keys[:i], g.keys[i+1:]...)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (g *granteeList) index(key *ecdsa.PublicKey) int {
+	for i, k := range g.keys {
+		if k.Equal(key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// MarshalBinary encodes the list as the concatenation of compressed keys.
+func (g *granteeList) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, len(g.keys)*publicKeySize)
+	for _, k := range g.keys {
+		data = append(data, crypto.EncodeSecp256k1PublicKey(k)...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes the list from the concatenation of compressed keys.
+func (g *granteeList) UnmarshalBinary(data []byte) error {
+	if len(data)%publicKeySize != 0 {
+		return errInvalidGranteeList
+	}
+	keys := make([]*ecdsa.PublicKey, 0, len(data)/publicKeySize)
+	for i := 0; i < len(data); i += publicKeySize {
+		k, err := crypto.DecodeSecp256k1PublicKey(data[i : i+publicKeySize])
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidGranteeList, err)
+		}
+		keys = append(keys, k)
+	}
+	g.keys = keys
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package accesscontrol
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/penguintop/penguin/pkg/file"
+	"github.com/penguintop/penguin/pkg/manifest"
+	"github.com/penguintop/penguin/pkg/penguin"
+)
+
+// history is a manifest of access control trie references keyed by the unix
+// time in nanoseconds from which they are in effect. Every change of the
+// grantees results in a new entry, so that content uploaded under an earlier
+// access key can still be accessed by the grantees of that time. The entries
+// carry the random salt of the keys derived for the trie in their metadata.
+type history struct {
+	m manifest.Interface
+}
+
+// historySaltKey is the entry metadata key of the salt of the trie keys.
+const historySaltKey = "salt"
+
+func newHistory(ls file.LoadSaver) (*history, error) {
+	m, err := manifest.NewMantarayManifest(ls, false)
+	if err != nil {
+		return nil, err
+	}
+	return &history{m: m}, nil
+}
+
+func newHistoryReference(reference penguin.Address, ls file.LoadSaver) (*history, error) {
+	m, err := manifest.NewMantarayManifestReference(reference, ls)
+	if err != nil {
+		return nil, err
+	}
+	return &history{m: m}, nil
+}
+
+// historyPath returns the manifest path of the timestamp. Paths are of equal
+// length so that their lexicographic order is the order of time.
+func historyPath(timestamp int64) string {
+	return fmt.Sprintf("%020d", timestamp)
+}
+
+// add sets the access control trie that is in effect from the timestamp on.
+// The timestamp is moved past the entries that already exist, so that
+// entries added at the same time do not replace each other.
+func (h *history) add(ctx context.Context, timestamp int64, act penguin.Address, salt []byte) error {
+	for {
+		_, err := h.m.Lookup(ctx, historyPath(timestamp))
+		if errors.Is(err, manifest.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		timestamp++
+	}
+	metadata := map[string]string{
+		historySaltKey: hex.EncodeToString(salt),
+	}
+	return h.m.Add(ctx, historyPath(timestamp), manifest.NewEntry(act, metadata))
+}
+
+// lookup returns the access control trie that is in effect at the timestamp
+// together with the salt of its keys. The ErrNotFound error is returned if
+// the history starts later.
+func (h *history) lookup(ctx context.Context, timestamp int64) (act penguin.Address, salt []byte, err error) {
+	var (
+		at    = historyPath(timestamp)
+		found string
+		entry manifest.Entry
+	)
+	err = h.m.IterateEntries(ctx, "", func(p string, e manifest.Entry) error {
+		if p <= at && p > found {
+			found, entry = p, e
+		}
+		return nil
+	})
+	if err != nil {
+		return penguin.ZeroAddress, nil, err
+	}
+	if found == "" {
+		return penguin.ZeroAddress, nil, ErrNotFound
+	}
+	salt, err = hex.DecodeString(entry.Metadata()[historySaltKey])
+	if err != nil {
+		return penguin.ZeroAddress, nil, fmt.Errorf("history entry %s salt: %w", found, err)
+	}
+	return entry.Reference(), salt, nil
+}
+
+func (h *history) store(ctx context.Context) (penguin.Address, error) {
+	return h.m.Store(ctx)
+}
@@ -0,0 +1,42 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package accesscontrol
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/penguintop/penguin/pkg/crypto"
+)
+
+// Session derives symmetric keys shared between the private key of the
+// session and the public key of a counterparty. Both parties derive the same
+// keys from the same nonces.
+type Session interface {
+	Key(publicKey *ecdsa.PublicKey, nonces [][]byte) ([][]byte, error)
+}
+
+type session struct {
+	dh crypto.DH
+}
+
+// NewDefaultSession returns a Session using the in-memory private key.
+func NewDefaultSession(key *ecdsa.PrivateKey) Session {
+	return &session{
+		dh: crypto.NewDH(key),
+	}
+}
+
+// Key returns a shared key for every nonce.
+func (s *session) Key(publicKey *ecdsa.PublicKey, nonces [][]byte) ([][]byte, error) {
+	keys := make([][]byte, 0, len(nonces))
+	for _, nonce := range nonces {
+		key, err := s.dh.SharedKey(publicKey, nonce)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -42,9 +42,9 @@ type Interface interface {
 	// Release releases the reserved funds.
 	Release(peer penguin.Address, price uint64)
 	// Credit increases the balance the peer has with us (we "pay" the peer).
-	Credit(peer penguin.Address, price uint64) error
+	Credit(peer penguin.Address, price uint64, provenance Provenance) error
 	// PrepareDebit returns an accounting Action for the later debit to be executed on and to implement shadowing a possibly credited part of reserve on the other side.
-	PrepareDebit(peer penguin.Address, price uint64) Action
+	PrepareDebit(peer penguin.Address, price uint64, provenance Provenance) Action
 	// Balance returns the current balance for the given peer.
 	Balance(peer penguin.Address) (*big.Int, error)
 	// SurplusBalance returns the current surplus balance for the given peer.
@@ -70,6 +70,7 @@ type debitAction struct {
 	accounting     *Accounting
 	price          *big.Int
 	peer           penguin.Address
+	provenance     Provenance
 	accountingPeer *accountingPeer
 	applied        bool
 }
@@ -86,6 +87,7 @@ type accountingPeer struct {
 	reservedBalance       *big.Int   // amount currently reserved for active peer interaction
 	shadowReservedBalance *big.Int   // amount potentially to be debited for active peer interaction
 	paymentThreshold      *big.Int   // the threshold at which the peer expects us to pay
+	disconnectLimit       *big.Int   // the debt of the peer at which it is disconnected, if lowered
 	refreshTimestamp      int64      // last time we attempted time-based settlement
 	paymentOngoing        bool       // indicate if we are currently settling with the peer
 }
@@ -117,6 +119,8 @@ type Accounting struct {
 	pricing        pricing.Interface
 	metrics        metrics
 	timeNow        func() time.Time
+	// ledger records the balance changes, if set
+	ledger *Ledger
 }
 
 var (
@@ -128,6 +132,8 @@ var (
 	ErrPeerNoBalance = errors.New("no balance for peer")
 	// ErrInvalidValue denotes an invalid value read from store
 	ErrInvalidValue = errors.New("invalid value")
+	// ErrInvalidTimeSettlementLimit denotes a time settlement limit not below the early payment point.
+	ErrInvalidTimeSettlementLimit = errors.New("time settlement limit not below the early payment point")
 )
 
 // NewAccounting creates a new Accounting instance with the provided options.
@@ -240,7 +246,7 @@ func (a *Accounting) Release(peer penguin.Address, price uint64) {
 
 // Credit increases the amount of credit we have with the given peer
 // (and decreases existing debt).
-func (a *Accounting) Credit(peer penguin.Address, price uint64) error {
+func (a *Accounting) Credit(peer penguin.Address, price uint64, provenance Provenance) error {
 	accountingPeer := a.getAccountingPeer(peer)
 
 	accountingPeer.lock.Lock()
@@ -265,6 +271,7 @@ func (a *Accounting) Credit(peer penguin.Address, price uint64) error {
 
 	a.metrics.TotalCreditedAmount.Add(float64(price))
 	a.metrics.CreditEventsCount.Inc()
+	a.record(peer, LedgerActionCredit, provenance, new(big.Int).SetUint64(price))
 	return nil
 }
 
@@ -312,6 +319,7 @@ func (a *Accounting) settle(peer penguin.Address, balance *accountingPeer) error
 		if err != nil {
 			return fmt.Errorf("settle: failed to persist balance: %w", err)
 		}
+		a.record(peer, LedgerActionRefreshmentSent, Provenance{}, acceptedAmount)
 	}
 
 	if a.payFunction != nil && !balance.paymentOngoing {
@@ -626,6 +634,7 @@ func (a *Accounting) NotifyPaymentSent(peer penguin.Address, amount *big.Int, re
 		a.logger.Errorf("accounting: notifypaymentsent failed to persist balance: %v", err)
 		return
 	}
+	a.record(peer, LedgerActionChequeSent, Provenance{}, amount)
 }
 
 // NotifyPaymentThreshold should be called to notify accounting of changes in the payment threshold
@@ -639,6 +648,23 @@ func (a *Accounting) NotifyPaymentThreshold(peer penguin.Address, paymentThresho
 	return nil
 }
 
+// EnforcePaymentThreshold lowers the debt at which the peer is disconnected to
+// the payment threshold plus the payment tolerance, so that a lower payment
+// threshold announced to the peer is enforced. A nil threshold restores the
+// payment threshold of all peers.
+func (a *Accounting) EnforcePaymentThreshold(peer penguin.Address, paymentThreshold *big.Int) {
+	accountingPeer := a.getAccountingPeer(peer)
+
+	accountingPeer.lock.Lock()
+	defer accountingPeer.lock.Unlock()
+
+	if paymentThreshold == nil || paymentThreshold.Cmp(a.paymentThreshold) >= 0 {
+		accountingPeer.disconnectLimit = nil
+		return
+	}
+	accountingPeer.disconnectLimit = new(big.Int).Add(paymentThreshold, a.paymentTolerance)
+}
+
 // NotifyPayment is called by Settlement when we receive a payment.
 func (a *Accounting) NotifyPaymentReceived(peer penguin.Address, amount *big.Int) error {
 	accountingPeer := a.getAccountingPeer(peer)
@@ -667,6 +693,7 @@ func (a *Accounting) NotifyPaymentReceived(peer penguin.Address, amount *big.Int
 		if err != nil {
 			return fmt.Errorf("failed to persist surplus balance: %w", err)
 		}
+		a.record(peer, LedgerActionChequeReceived, Provenance{}, amount)
 
 		return nil
 	}
@@ -708,6 +735,7 @@ func (a *Accounting) NotifyPaymentReceived(peer penguin.Address, amount *big.Int
 			return fmt.Errorf("failed to persist surplus balance: %w", err)
 		}
 	}
+	a.record(peer, LedgerActionChequeReceived, Provenance{}, amount)
 
 	return nil
 }
@@ -736,12 +764,13 @@ func (a *Accounting) NotifyRefreshmentReceived(peer penguin.Address, amount *big
 	if err != nil {
 		return fmt.Errorf("failed to persist balance: %w", err)
 	}
+	a.record(peer, LedgerActionRefreshmentReceived, Provenance{}, amount)
 
 	return nil
 }
 
 // PrepareDebit prepares a debit operation by increasing the shadowReservedBalance
-func (a *Accounting) PrepareDebit(peer penguin.Address, price uint64) Action {
+func (a *Accounting) PrepareDebit(peer penguin.Address, price uint64, provenance Provenance) Action {
 	accountingPeer := a.getAccountingPeer(peer)
 
 	accountingPeer.lock.Lock()
@@ -755,6 +784,7 @@ func (a *Accounting) PrepareDebit(peer penguin.Address, price uint64) Action {
 		accounting:     a,
 		price:          bigPrice,
 		peer:           peer,
+		provenance:     provenance,
 		accountingPeer: accountingPeer,
 		applied:        false,
 	}
@@ -845,8 +875,13 @@ func (d *debitAction) Apply() error {
 
 	a.metrics.TotalDebitedAmount.Add(tot)
 	a.metrics.DebitEventsCount.Inc()
+	a.record(d.peer, LedgerActionDebit, d.provenance, d.price)
 
-	if nextBalance.Cmp(a.disconnectLimit) >= 0 {
+	disconnectLimit := a.disconnectLimit
+	if d.accountingPeer.disconnectLimit != nil {
+		disconnectLimit = d.accountingPeer.disconnectLimit
+	}
+	if nextBalance.Cmp(disconnectLimit) >= 0 {
 		// peer too much in debt
 		a.metrics.AccountingDisconnectsCount.Inc()
 		return p2p.NewBlockPeerError(24*time.Hour, ErrDisconnectThresholdExceeded)
@@ -871,3 +906,20 @@ func (a *Accounting) SetRefreshFunc(f RefreshFunc) {
 func (a *Accounting) SetPayFunc(f PayFunc) {
 	a.payFunction = f
 }
+
+// SetTimeSettlementLimit prefers time based settlement for debts below the
+// limit, which are left to later refreshments instead of triggering a monetary
+// settlement with its on-chain fees. The limit must stay below the early
+// payment point, the payment threshold less the early payment, otherwise the
+// debts settlement starts at are not paid and time based settlement alone has
+// to keep up with them.
+func (a *Accounting) SetTimeSettlementLimit(limit *big.Int) error {
+	earlyPaymentPoint := new(big.Int).Sub(a.paymentThreshold, a.earlyPayment)
+	if limit.Cmp(earlyPaymentPoint) >= 0 {
+		return fmt.Errorf("%w: limit %d, early payment point %d", ErrInvalidTimeSettlementLimit, limit, earlyPaymentPoint)
+	}
+	if limit.Cmp(a.minimumPayment) > 0 {
+		a.minimumPayment = new(big.Int).Set(limit)
+	}
+	return nil
+}
@@ -78,13 +78,13 @@ func TestAccountingAddBalance(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			err = acc.Credit(booking.peer, uint64(-booking.price))
+			err = acc.Credit(booking.peer, uint64(-booking.price), accounting.Provenance{})
 			if err != nil {
 				t.Fatal(err)
 			}
 			acc.Release(booking.peer, uint64(-booking.price))
 		} else {
-			debitAction := acc.PrepareDebit(booking.peer, uint64(booking.price))
+			debitAction := acc.PrepareDebit(booking.peer, uint64(booking.price), accounting.Provenance{})
 			err = debitAction.Apply()
 			if err != nil {
 				t.Fatal(err)
@@ -128,7 +128,7 @@ func TestAccountingAdd_persistentBalances(t *testing.T) {
 	}
 
 	peer1DebitAmount := testPrice
-	debitAction := acc.PrepareDebit(peer1Addr, peer1DebitAmount)
+	debitAction := acc.PrepareDebit(peer1Addr, peer1DebitAmount, accounting.Provenance{})
 	err = debitAction.Apply()
 	if err != nil {
 		t.Fatal(err)
@@ -136,7 +136,7 @@ func TestAccountingAdd_persistentBalances(t *testing.T) {
 	debitAction.Cleanup()
 
 	peer2CreditAmount := 2 * testPrice
-	err = acc.Credit(peer2Addr, peer2CreditAmount)
+	err = acc.Credit(peer2Addr, peer2CreditAmount, accounting.Provenance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -211,7 +211,7 @@ func TestAccountingDisconnect(t *testing.T) {
 	}
 
 	// put the peer 1 unit away from disconnect
-	debitAction := acc.PrepareDebit(peer1Addr, testPaymentThreshold.Uint64()+testPaymentTolerance.Uint64()-1)
+	debitAction := acc.PrepareDebit(peer1Addr, testPaymentThreshold.Uint64()+testPaymentTolerance.Uint64()-1, accounting.Provenance{})
 	err = debitAction.Apply()
 	if err != nil {
 		t.Fatal("expected no error while still within tolerance")
@@ -219,7 +219,7 @@ func TestAccountingDisconnect(t *testing.T) {
 	debitAction.Cleanup()
 
 	// put the peer over thee threshold
-	debitAction = acc.PrepareDebit(peer1Addr, 1)
+	debitAction = acc.PrepareDebit(peer1Addr, 1, accounting.Provenance{})
 	err = debitAction.Apply()
 	if err == nil {
 		t.Fatal("expected Add to return error")
@@ -232,6 +232,49 @@ func TestAccountingDisconnect(t *testing.T) {
 	}
 }
 
+// TestAccountingEnforcePaymentThreshold tests that a peer is disconnected at
+// the lowered payment threshold and at the regular one after it is restored.
+func TestAccountingEnforcePaymentThreshold(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+
+	store := mock.NewStateStore()
+	defer store.Close()
+
+	acc, err := accounting.NewAccounting(testPaymentThreshold, testPaymentTolerance, testPaymentEarly, logger, store, nil, big.NewInt(testRefreshRate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peer1Addr, err := penguin.ParseHexAddress("00112233")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lowered := new(big.Int).Div(testPaymentThreshold, big.NewInt(2))
+	acc.EnforcePaymentThreshold(peer1Addr, lowered)
+
+	debit := func(price uint64) error {
+		t.Helper()
+		debitAction := acc.PrepareDebit(peer1Addr, price, accounting.Provenance{})
+		defer debitAction.Cleanup()
+		return debitAction.Apply()
+	}
+
+	// put the peer 1 unit away from the lowered disconnect limit
+	if err := debit(lowered.Uint64() + testPaymentTolerance.Uint64() - 1); err != nil {
+		t.Fatalf("expected no error while still within tolerance, got %v", err)
+	}
+	var e *p2p.BlockPeerError
+	if err := debit(1); !errors.As(err, &e) {
+		t.Fatalf("expected BlockPeerError at the lowered threshold, got %v", err)
+	}
+
+	acc.EnforcePaymentThreshold(peer1Addr, nil)
+	if err := debit(1); err != nil {
+		t.Fatalf("expected no error after restoring the threshold, got %v", err)
+	}
+}
+
 // TestAccountingCallSettlement tests that settlement is called correctly if the payment threshold is hit
 func TestAccountingCallSettlement(t *testing.T) {
 	logger := logging.New(ioutil.Discard, 0)
@@ -270,7 +313,7 @@ func TestAccountingCallSettlement(t *testing.T) {
 	}
 
 	// Credit until payment threshold
-	err = acc.Credit(peer1Addr, requestPrice)
+	err = acc.Credit(peer1Addr, requestPrice, accounting.Provenance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -322,7 +365,7 @@ func TestAccountingCallSettlement(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = acc.Credit(peer1Addr, expectedAmount)
+	err = acc.Credit(peer1Addr, expectedAmount, accounting.Provenance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -394,7 +437,7 @@ func TestAccountingCallSettlementMonetary(t *testing.T) {
 	}
 
 	// Credit until payment threshold
-	err = acc.Credit(peer1Addr, requestPrice)
+	err = acc.Credit(peer1Addr, requestPrice, accounting.Provenance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -473,6 +516,79 @@ func TestAccountingCallSettlementMonetary(t *testing.T) {
 	}
 }
 
+func TestAccountingTimeSettlementLimit(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+
+	store := mock.NewStateStore()
+	defer store.Close()
+
+	acc, err := accounting.NewAccounting(testPaymentThreshold, testPaymentTolerance, testPaymentEarly, logger, store, nil, big.NewInt(testRefreshRate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the limit must be below the early payment point
+	earlyPaymentPoint := new(big.Int).Sub(testPaymentThreshold, testPaymentEarly)
+	if err := acc.SetTimeSettlementLimit(earlyPaymentPoint); !errors.Is(err, accounting.ErrInvalidTimeSettlementLimit) {
+		t.Fatalf("got error %v, want %v", err, accounting.ErrInvalidTimeSettlementLimit)
+	}
+
+	notTimeSettledAmount := big.NewInt(testRefreshRate * 2)
+	if err := acc.SetTimeSettlementLimit(new(big.Int).Add(notTimeSettledAmount, big.NewInt(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	refreshchan := make(chan paymentCall, 1)
+	paychan := make(chan paymentCall, 1)
+
+	acc.SetRefreshFunc(func(ctx context.Context, peer penguin.Address, amount *big.Int, shadowBalance *big.Int) (*big.Int, int64, error) {
+		refreshchan <- paymentCall{peer: peer, amount: amount}
+		return new(big.Int).Sub(amount, notTimeSettledAmount), 0, nil
+	})
+
+	acc.SetPayFunc(func(ctx context.Context, peer penguin.Address, amount *big.Int) {
+		paychan <- paymentCall{peer: peer, amount: amount}
+	})
+
+	peer1Addr, err := penguin.ParseHexAddress("00112233")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestPrice := testPaymentThreshold.Uint64() - 1000
+
+	err = acc.Reserve(context.Background(), peer1Addr, requestPrice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = acc.Credit(peer1Addr, requestPrice, accounting.Provenance{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acc.Release(peer1Addr, requestPrice)
+
+	err = acc.Reserve(context.Background(), peer1Addr, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc.Release(peer1Addr, 1)
+
+	select {
+	case <-refreshchan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting for refreshment")
+	}
+
+	// the remaining debt is below the limit and left to time based settlement
+	select {
+	case <-paychan:
+		t.Fatal("pay called for debt below the time settlement limit")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
 func TestAccountingCallSettlementTooSoon(t *testing.T) {
 	logger := logging.New(ioutil.Discard, 0)
 
@@ -511,7 +627,7 @@ func TestAccountingCallSettlementTooSoon(t *testing.T) {
 	}
 
 	// Credit until payment threshold
-	err = acc.Credit(peer1Addr, requestPrice)
+	err = acc.Credit(peer1Addr, requestPrice, accounting.Provenance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -554,7 +670,7 @@ func TestAccountingCallSettlementTooSoon(t *testing.T) {
 	}
 
 	// Credit until payment threshold
-	err = acc.Credit(peer1Addr, requestPrice)
+	err = acc.Credit(peer1Addr, requestPrice, accounting.Provenance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -638,7 +754,7 @@ func TestAccountingCallSettlementEarly(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = acc.Credit(peer1Addr, debt)
+	err = acc.Credit(peer1Addr, debt, accounting.Provenance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -687,7 +803,7 @@ func TestAccountingSurplusBalance(t *testing.T) {
 		t.Fatal(err)
 	}
 	// Try Debiting a large amount to peer so balance is large positive
-	debitAction := acc.PrepareDebit(peer1Addr, testPaymentThreshold.Uint64()-1)
+	debitAction := acc.PrepareDebit(peer1Addr, testPaymentThreshold.Uint64()-1, accounting.Provenance{})
 	err = debitAction.Apply()
 	if err != nil {
 		t.Fatal(err)
@@ -736,7 +852,7 @@ func TestAccountingSurplusBalance(t *testing.T) {
 		t.Fatal("Not expected balance, expected 0")
 	}
 	// Debit for same peer, so balance stays 0 with surplusbalance decreasing to 2
-	debitAction = acc.PrepareDebit(peer1Addr, testPaymentThreshold.Uint64())
+	debitAction = acc.PrepareDebit(peer1Addr, testPaymentThreshold.Uint64(), accounting.Provenance{})
 	err = debitAction.Apply()
 	if err != nil {
 		t.Fatal("Unexpected error from Credit")
@@ -759,7 +875,7 @@ func TestAccountingSurplusBalance(t *testing.T) {
 		t.Fatal("Not expected balance, expected 0")
 	}
 	// Debit for same peer, so balance goes to 9998 (testpaymentthreshold - 2) with surplusbalance decreasing to 0
-	debitAction = acc.PrepareDebit(peer1Addr, testPaymentThreshold.Uint64())
+	debitAction = acc.PrepareDebit(peer1Addr, testPaymentThreshold.Uint64(), accounting.Provenance{})
 	err = debitAction.Apply()
 	if err != nil {
 		t.Fatal("Unexpected error from Debit")
@@ -801,7 +917,7 @@ func TestAccountingNotifyPaymentReceived(t *testing.T) {
 	}
 
 	debtAmount := uint64(100)
-	debitAction := acc.PrepareDebit(peer1Addr, debtAmount+testPaymentTolerance.Uint64())
+	debitAction := acc.PrepareDebit(peer1Addr, debtAmount+testPaymentTolerance.Uint64(), accounting.Provenance{})
 	err = debitAction.Apply()
 	if err != nil {
 		t.Fatal(err)
@@ -813,7 +929,7 @@ func TestAccountingNotifyPaymentReceived(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	debitAction = acc.PrepareDebit(peer1Addr, debtAmount)
+	debitAction = acc.PrepareDebit(peer1Addr, debtAmount, accounting.Provenance{})
 	err = debitAction.Apply()
 	if err != nil {
 		t.Fatal(err)
@@ -917,7 +1033,7 @@ func TestAccountingNotifyPaymentThreshold(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = acc.Credit(peer1Addr, debt)
+	err = acc.Credit(peer1Addr, debt, accounting.Provenance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -959,7 +1075,7 @@ func TestAccountingPeerDebt(t *testing.T) {
 
 	peer1Addr := penguin.MustParseHexAddress("00112233")
 	debt := uint64(1000)
-	debitAction := acc.PrepareDebit(peer1Addr, debt)
+	debitAction := acc.PrepareDebit(peer1Addr, debt, accounting.Provenance{})
 	err = debitAction.Apply()
 	if err != nil {
 		t.Fatal(err)
@@ -974,7 +1090,7 @@ func TestAccountingPeerDebt(t *testing.T) {
 	}
 
 	peer2Addr := penguin.MustParseHexAddress("11112233")
-	err = acc.Credit(peer2Addr, 500)
+	err = acc.Credit(peer2Addr, 500, accounting.Provenance{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -19,3 +19,7 @@ func (s *Accounting) SetTime(k int64) {
 func (a *Accounting) IsPaymentOngoing(peer penguin.Address) bool {
 	return a.getAccountingPeer(peer).paymentOngoing
 }
+
+func (l *Ledger) SetTimeNow(f func() time.Time) {
+	l.timeNow = f
+}
@@ -0,0 +1,456 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package accounting
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/storage"
+)
+
+const (
+	ledgerPagePrefix = "accounting_ledger_page_"
+	ledgerOldestKey  = "accounting_ledger_oldest"
+
+	// ledgerBucketDuration is the time span of the entries whose pages share
+	// a key prefix, the unit in which time ranges are read and pruned.
+	ledgerBucketDuration = int64(time.Hour)
+	// ledgerFlushInterval is the longest time recorded entries are kept in
+	// memory before they are written to the state store.
+	ledgerFlushInterval = 5 * time.Second
+	// ledgerFlushSize is the number of recorded entries that are written to
+	// the state store without waiting for the flush interval.
+	ledgerFlushSize = 1000
+)
+
+// Protocols the balance changes for chunk requests are attributed to.
+const (
+	ProtocolRetrieval = "retrieval"
+	ProtocolPushSync  = "pushsync"
+)
+
+// Actions recorded in the ledger.
+const (
+	LedgerActionCredit              = "credit"
+	LedgerActionDebit               = "debit"
+	LedgerActionRefreshmentSent     = "refreshmentSent"
+	LedgerActionRefreshmentReceived = "refreshmentReceived"
+	LedgerActionChequeSent          = "chequeSent"
+	LedgerActionChequeReceived      = "chequeReceived"
+)
+
+// Provenance identifies the request a balance change is accounted for.
+type Provenance struct {
+	Protocol string
+	Chunk    penguin.Address
+	// Client is the identifier of the API key of the client the request is
+	// made for, if any, as returned by ClientID.
+	Client string
+	// Forwarded is set for the requests forwarded for peers, which are paid
+	// for by the peers.
+	Forwarded bool
+}
+
+type clientContextKey struct{}
+
+// ClientID returns the identifier of the API key recorded as the client of the
+// provenance, the hex encoded first 8 bytes of its SHA-256 hash, so that the
+// secret key is neither persisted nor exported. It is empty for an empty key.
+func ClientID(key string) string {
+	if key == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:8])
+}
+
+// SetClient sets the API key identifier of the client the requests are made
+// for in the context, to be recorded as the client of their provenance.
+func SetClient(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, id)
+}
+
+// GetClient gets the API key identifier of the client from the context.
+func GetClient(ctx context.Context) string {
+	v, ok := ctx.Value(clientContextKey{}).(string)
+	if ok {
+		return v
+	}
+	return ""
+}
+
+// LedgerEntry is a single balance change with a peer.
+type LedgerEntry struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Peer      penguin.Address `json:"peer"`
+	Action    string          `json:"action"`
+	Protocol  string          `json:"protocol"`
+	Chunk     penguin.Address `json:"chunk"`
+	Client    string          `json:"client,omitempty"`
+	Amount    *big.Int        `json:"amount"`
+}
+
+// LedgerFilter selects the ledger entries returned by a query. Zero values
+// match all entries.
+type LedgerFilter struct {
+	Peer     penguin.Address
+	Protocol string
+	Client   string
+	// From and To limit the entries to the time range [From, To).
+	From time.Time
+	To   time.Time
+}
+
+func (f LedgerFilter) match(e *LedgerEntry) bool {
+	if !f.Peer.IsZero() && !f.Peer.Equal(e.Peer) {
+		return false
+	}
+	if f.Protocol != "" && f.Protocol != e.Protocol {
+		return false
+	}
+	if f.Client != "" && f.Client != e.Client {
+		return false
+	}
+	ts := e.Timestamp.UnixNano()
+	if !f.From.IsZero() && ts < f.From.UnixNano() {
+		return false
+	}
+	if !f.To.IsZero() && ts >= f.To.UnixNano() {
+		return false
+	}
+	return true
+}
+
+// Ledger is an append-only record of the balance changes with peers kept in
+// the state store. Recorded entries are buffered and written in pages, one
+// state store entry per flush, keyed by the hour they were recorded in, so
+// that time ranges are read and pruned without iterating the whole ledger.
+type Ledger struct {
+	store   storage.StateStorer
+	logger  logging.Logger
+	timeNow func() time.Time
+
+	mu      sync.Mutex
+	last    int64 // timestamp of the last recorded entry, keeps the timestamps unique
+	pending []LedgerEntry
+
+	// writeMu serializes the writes of the pages and the pruning
+	writeMu sync.Mutex
+	flushC  chan struct{}
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// NewLedger creates a new Ledger in the state store.
+func NewLedger(store storage.StateStorer, logger logging.Logger) *Ledger {
+	return &Ledger{
+		store:   store,
+		logger:  logger,
+		timeNow: time.Now,
+		flushC:  make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+	}
+}
+
+// Record appends a balance change with the peer to the ledger. The entry is
+// written to the state store with the next flush.
+func (l *Ledger) Record(peer penguin.Address, action string, provenance Provenance, amount *big.Int) {
+	l.mu.Lock()
+	ts := l.timeNow().UnixNano()
+	if ts <= l.last {
+		ts = l.last + 1
+	}
+	l.last = ts
+	l.pending = append(l.pending, LedgerEntry{
+		Timestamp: time.Unix(0, ts).UTC(),
+		Peer:      peer,
+		Action:    action,
+		Protocol:  provenance.Protocol,
+		Chunk:     provenance.Chunk,
+		Client:    provenance.Client,
+		Amount:    new(big.Int).Set(amount),
+	})
+	full := len(l.pending) >= ledgerFlushSize
+	l.mu.Unlock()
+
+	if full {
+		select {
+		case l.flushC <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush writes the recorded entries to the state store.
+func (l *Ledger) Flush() error {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+	return l.flush()
+}
+
+// flush writes the pending entries in one page per bucket. The entries that
+// could not be written are kept for the next flush. It must be called with
+// the writeMu held.
+func (l *Ledger) flush() error {
+	l.mu.Lock()
+	entries := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	for len(entries) > 0 {
+		bucket := ledgerBucket(entries[0].Timestamp.UnixNano())
+		n := 1
+		for n < len(entries) && ledgerBucket(entries[n].Timestamp.UnixNano()) == bucket {
+			n++
+		}
+		if err := l.writePage(bucket, entries[:n]); err != nil {
+			l.mu.Lock()
+			l.pending = append(entries, l.pending...)
+			l.mu.Unlock()
+			return err
+		}
+		entries = entries[n:]
+	}
+	return nil
+}
+
+func (l *Ledger) writePage(bucket int64, entries []LedgerEntry) error {
+	oldest, ok, err := l.oldestBucket()
+	if err != nil {
+		return err
+	}
+	if err := l.store.Put(ledgerPageKey(bucket, entries[0].Timestamp.UnixNano()), entries); err != nil {
+		return err
+	}
+	if !ok || bucket < oldest {
+		return l.store.Put(ledgerOldestKey, bucket)
+	}
+	return nil
+}
+
+// oldestBucket returns the bucket of the oldest page in the state store.
+func (l *Ledger) oldestBucket() (bucket int64, ok bool, err error) {
+	err = l.store.Get(ledgerOldestKey, &bucket)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return bucket, true, nil
+}
+
+// Entries returns the ledger entries matching the filter, oldest first. Only
+// the buckets in the time range of the filter are read.
+func (l *Ledger) Entries(filter LedgerFilter) ([]LedgerEntry, error) {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	if err := l.flush(); err != nil {
+		return nil, err
+	}
+
+	from, ok, err := l.oldestBucket()
+	if err != nil || !ok {
+		return nil, err
+	}
+	if !filter.From.IsZero() {
+		if b := ledgerBucket(filter.From.UnixNano()); b > from {
+			from = b
+		}
+	}
+	l.mu.Lock()
+	last := l.last
+	l.mu.Unlock()
+	if now := l.timeNow().UnixNano(); now > last {
+		last = now
+	}
+	to := ledgerBucket(last)
+	if !filter.To.IsZero() {
+		if b := ledgerBucket(filter.To.UnixNano()); b < to {
+			to = b
+		}
+	}
+
+	var entries []LedgerEntry
+	for bucket := from; bucket <= to; bucket++ {
+		err := l.iteratePages(bucket, func(_ string, page []LedgerEntry) error {
+			for i := range page {
+				if filter.match(&page[i]) {
+					entries = append(entries, page[i])
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Prune removes the entries recorded before the given time and returns their
+// number. Only the buckets up to the given time are read.
+func (l *Ledger) Prune(before time.Time) (int, error) {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	if err := l.flush(); err != nil {
+		return 0, err
+	}
+
+	oldest, ok, err := l.oldestBucket()
+	if err != nil || !ok {
+		return 0, err
+	}
+	last := ledgerBucket(before.UnixNano())
+
+	type page struct {
+		key     string
+		entries []LedgerEntry
+	}
+	var pruned int
+	for bucket := oldest; bucket <= last; bucket++ {
+		var pages []page
+		err := l.iteratePages(bucket, func(key string, entries []LedgerEntry) error {
+			pages = append(pages, page{key: key, entries: entries})
+			return nil
+		})
+		if err != nil {
+			return pruned, err
+		}
+		for _, p := range pages {
+			kept := p.entries[:0]
+			for _, e := range p.entries {
+				if !e.Timestamp.Before(before) {
+					kept = append(kept, e)
+				}
+			}
+			n := len(p.entries) - len(kept)
+			switch {
+			case len(kept) == 0:
+				err = l.store.Delete(p.key)
+			case n > 0:
+				err = l.store.Put(p.key, kept)
+			}
+			if err != nil {
+				return pruned, err
+			}
+			pruned += n
+		}
+	}
+
+	if last > oldest {
+		if err := l.store.Put(ledgerOldestKey, last); err != nil {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
+
+// iteratePages calls the function with the pages of the bucket in the order
+// they were written.
+func (l *Ledger) iteratePages(bucket int64, fn func(key string, entries []LedgerEntry) error) error {
+	return l.store.Iterate(ledgerBucketPrefix(bucket), func(key, val []byte) (stop bool, err error) {
+		var entries []LedgerEntry
+		if err := json.Unmarshal(val, &entries); err != nil {
+			return true, fmt.Errorf("decode ledger page %s: %w", key, err)
+		}
+		return false, fn(string(key), entries)
+	})
+}
+
+// Start periodically writes the recorded entries to the state store and,
+// with a non zero retention, prunes the entries older than the retention
+// period.
+func (l *Ledger) Start(pruneInterval, retention time.Duration) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+
+		flushTicker := time.NewTicker(ledgerFlushInterval)
+		defer flushTicker.Stop()
+
+		var pruneC <-chan time.Time
+		if retention > 0 {
+			pruneTicker := time.NewTicker(pruneInterval)
+			defer pruneTicker.Stop()
+			pruneC = pruneTicker.C
+		}
+
+		for {
+			select {
+			case <-l.quit:
+				return
+			case <-flushTicker.C:
+			case <-l.flushC:
+			case <-pruneC:
+				n, err := l.Prune(l.timeNow().Add(-retention))
+				if err != nil {
+					l.logger.Debugf("accounting ledger: prune: %v", err)
+					l.logger.Error("accounting ledger: prune failed")
+					continue
+				}
+				if n > 0 {
+					l.logger.Tracef("accounting ledger: pruned %d entries", n)
+				}
+				continue
+			}
+			if err := l.Flush(); err != nil {
+				l.logger.Debugf("accounting ledger: flush: %v", err)
+				l.logger.Error("accounting ledger: flush failed")
+			}
+		}
+	}()
+}
+
+// Close stops the periodic writes and pruning and writes the entries
+// recorded since the last flush.
+func (l *Ledger) Close() error {
+	close(l.quit)
+	l.wg.Wait()
+	return l.Flush()
+}
+
+// ledgerBucket returns the bucket of the entries recorded at the timestamp.
+func ledgerBucket(ts int64) int64 {
+	return ts / ledgerBucketDuration
+}
+
+// ledgerBucketPrefix returns the storage key prefix of the pages in the
+// bucket. The bucket is zero padded so that the keys sort by time.
+func ledgerBucketPrefix(bucket int64) string {
+	return fmt.Sprintf("%s%012d_", ledgerPagePrefix, bucket)
+}
+
+// ledgerPageKey returns the storage key of the page in the bucket starting
+// with the entry recorded at the timestamp.
+func ledgerPageKey(bucket, ts int64) string {
+	return fmt.Sprintf("%s%020d", ledgerBucketPrefix(bucket), ts)
+}
+
+// record records the balance change in the ledger, if there is one.
+func (a *Accounting) record(peer penguin.Address, action string, provenance Provenance, amount *big.Int) {
+	if a.ledger == nil {
+		return
+	}
+	a.ledger.Record(peer, action, provenance, amount)
+}
+
+// SetLedger sets the ledger the balance changes are recorded in.
+func (a *Accounting) SetLedger(ledger *Ledger) {
+	a.ledger = ledger
+}
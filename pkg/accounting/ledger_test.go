@@ -0,0 +1,228 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package accounting_test
+
+import (
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/accounting"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/statestore/mock"
+)
+
+func TestLedger(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+
+	store := mock.NewStateStore()
+	defer store.Close()
+
+	acc, err := accounting.NewAccounting(testPaymentThreshold, testPaymentTolerance, testPaymentEarly, logger, store, nil, big.NewInt(testRefreshRate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1000, 0)
+	ledger := accounting.NewLedger(store, logger)
+	ledger.SetTimeNow(func() time.Time { return now })
+	acc.SetLedger(ledger)
+
+	peer1Addr := penguin.MustParseHexAddress("00112233")
+	peer2Addr := penguin.MustParseHexAddress("00112244")
+	chunk1 := penguin.MustParseHexAddress("aa")
+	chunk2 := penguin.MustParseHexAddress("bb")
+
+	err = acc.Credit(peer1Addr, 100, accounting.Provenance{Protocol: accounting.ProtocolRetrieval, Chunk: chunk1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = time.Unix(2000, 0)
+	debitAction := acc.PrepareDebit(peer2Addr, 200, accounting.Provenance{Protocol: accounting.ProtocolPushSync, Chunk: chunk2})
+	if err := debitAction.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	debitAction.Cleanup()
+
+	// not applied debits are not recorded
+	debitAction = acc.PrepareDebit(peer2Addr, 300, accounting.Provenance{Protocol: accounting.ProtocolPushSync, Chunk: chunk2})
+	debitAction.Cleanup()
+
+	now = time.Unix(3000, 0)
+	if err := acc.NotifyPaymentReceived(peer2Addr, big.NewInt(50)); err != nil {
+		t.Fatal(err)
+	}
+	if err := acc.NotifyRefreshmentReceived(peer1Addr, big.NewInt(20)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ledger.Entries(accounting.LedgerFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []accounting.LedgerEntry{
+		{Peer: peer1Addr, Action: accounting.LedgerActionCredit, Protocol: accounting.ProtocolRetrieval, Chunk: chunk1, Amount: big.NewInt(100)},
+		{Peer: peer2Addr, Action: accounting.LedgerActionDebit, Protocol: accounting.ProtocolPushSync, Chunk: chunk2, Amount: big.NewInt(200)},
+		{Peer: peer2Addr, Action: accounting.LedgerActionChequeReceived, Amount: big.NewInt(50)},
+		{Peer: peer1Addr, Action: accounting.LedgerActionRefreshmentReceived, Amount: big.NewInt(20)},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		w := want[i]
+		if !e.Peer.Equal(w.Peer) || e.Action != w.Action || e.Protocol != w.Protocol || !e.Chunk.Equal(w.Chunk) || e.Amount.Cmp(w.Amount) != 0 {
+			t.Fatalf("got entry %d %+v, want %+v", i, e, w)
+		}
+	}
+	// entries recorded at the same time are kept apart and in order
+	if !entries[3].Timestamp.After(entries[2].Timestamp) {
+		t.Fatalf("got entry timestamps %v and %v, want increasing", entries[2].Timestamp, entries[3].Timestamp)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter accounting.LedgerFilter
+		want   int
+	}{
+		{name: "peer", filter: accounting.LedgerFilter{Peer: peer1Addr}, want: 2},
+		{name: "protocol", filter: accounting.LedgerFilter{Protocol: accounting.ProtocolPushSync}, want: 1},
+		{name: "from", filter: accounting.LedgerFilter{From: time.Unix(2000, 0)}, want: 3},
+		{name: "to", filter: accounting.LedgerFilter{To: time.Unix(2000, 0)}, want: 1},
+		{name: "peer and range", filter: accounting.LedgerFilter{Peer: peer2Addr, From: time.Unix(1500, 0), To: time.Unix(2500, 0)}, want: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := ledger.Entries(tc.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tc.want {
+				t.Fatalf("got %d entries, want %d", len(entries), tc.want)
+			}
+		})
+	}
+
+	pruned, err := ledger.Prune(time.Unix(2500, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 2 {
+		t.Fatalf("pruned %d entries, want 2", pruned)
+	}
+	entries, err = ledger.Entries(accounting.LedgerFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries after pruning, want 2", len(entries))
+	}
+
+	// the ledger entries are not mistaken for balances
+	balances, err := acc.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 2 {
+		t.Fatalf("got %d balances, want 2", len(balances))
+	}
+}
+
+func TestLedgerPages(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+
+	store := mock.NewStateStore()
+	defer store.Close()
+
+	now := time.Unix(0, 0)
+	ledger := accounting.NewLedger(store, logger)
+	ledger.SetTimeNow(func() time.Time { return now })
+
+	countPages := func(t *testing.T) int {
+		t.Helper()
+		var n int
+		err := store.Iterate("accounting_ledger_page_", func(_, _ []byte) (bool, error) {
+			n++
+			return false, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	peer := penguin.MustParseHexAddress("00112233")
+	provenance := accounting.Provenance{Protocol: accounting.ProtocolRetrieval, Chunk: penguin.MustParseHexAddress("aa"), Client: "key"}
+	for _, ts := range []time.Time{
+		time.Unix(0, 0),
+		time.Unix(10, 0),
+		time.Unix(3600, 0),
+		time.Unix(3700, 0),
+		time.Unix(3*3600, 0),
+	} {
+		now = ts
+		ledger.Record(peer, accounting.LedgerActionCredit, provenance, big.NewInt(1))
+	}
+
+	// the entries are written with the flush, one page per hour
+	if n := countPages(t); n != 0 {
+		t.Fatalf("got %d pages before flush, want 0", n)
+	}
+	if err := ledger.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countPages(t); n != 3 {
+		t.Fatalf("got %d pages, want 3", n)
+	}
+
+	entries, err := ledger.Entries(accounting.LedgerFilter{Client: "key", From: time.Unix(3600, 0), To: time.Unix(3*3600, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].Client != "key" {
+		t.Fatalf("got client %q, want %q", entries[0].Client, "key")
+	}
+	entries, err = ledger.Entries(accounting.LedgerFilter{Client: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("got %d entries of another client, want 0", len(entries))
+	}
+
+	pruned, err := ledger.Prune(time.Unix(3650, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 3 {
+		t.Fatalf("pruned %d entries, want 3", pruned)
+	}
+	if n := countPages(t); n != 2 {
+		t.Fatalf("got %d pages after pruning, want 2", n)
+	}
+}
+
+func TestClientID(t *testing.T) {
+	id := accounting.ClientID("secret key")
+	if len(id) != 16 || strings.Contains(id, "secret") {
+		t.Fatalf("got client id %q", id)
+	}
+	if got := accounting.ClientID("secret key"); got != id {
+		t.Fatalf("got client id %q, want the stable %q", got, id)
+	}
+	if got := accounting.ClientID("other key"); got == id {
+		t.Fatalf("got the same client id %q for another key", got)
+	}
+	if got := accounting.ClientID(""); got != "" {
+		t.Fatalf("got client id %q for no key, want none", got)
+	}
+}
@@ -21,8 +21,8 @@ type Service struct {
 	balances                map[string]*big.Int
 	reserveFunc             func(ctx context.Context, peer penguin.Address, price uint64) error
 	releaseFunc             func(peer penguin.Address, price uint64)
-	creditFunc              func(peer penguin.Address, price uint64) error
-	prepareDebitFunc        func(peer penguin.Address, price uint64) accounting.Action
+	creditFunc              func(peer penguin.Address, price uint64, provenance accounting.Provenance) error
+	prepareDebitFunc        func(peer penguin.Address, price uint64, provenance accounting.Provenance) accounting.Action
 	balanceFunc             func(penguin.Address) (*big.Int, error)
 	shadowBalanceFunc       func(penguin.Address) (*big.Int, error)
 	balancesFunc            func() (map[string]*big.Int, error)
@@ -54,14 +54,14 @@ func WithReleaseFunc(f func(peer penguin.Address, price uint64)) Option {
 }
 
 // WithCreditFunc sets the mock Credit function
-func WithCreditFunc(f func(peer penguin.Address, price uint64) error) Option {
+func WithCreditFunc(f func(peer penguin.Address, price uint64, provenance accounting.Provenance) error) Option {
 	return optionFunc(func(s *Service) {
 		s.creditFunc = f
 	})
 }
 
 // WithDebitFunc sets the mock Debit function
-func WithPrepareDebitFunc(f func(peer penguin.Address, price uint64) accounting.Action) Option {
+func WithPrepareDebitFunc(f func(peer penguin.Address, price uint64, provenance accounting.Provenance) accounting.Action) Option {
 	return optionFunc(func(s *Service) {
 		s.prepareDebitFunc = f
 	})
@@ -128,9 +128,9 @@ func (s *Service) Release(peer penguin.Address, price uint64) {
 }
 
 // Credit is the mock function wrapper that calls the set implementation
-func (s *Service) Credit(peer penguin.Address, price uint64) error {
+func (s *Service) Credit(peer penguin.Address, price uint64, provenance accounting.Provenance) error {
 	if s.creditFunc != nil {
-		return s.creditFunc(peer, price)
+		return s.creditFunc(peer, price, provenance)
 	}
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -144,9 +144,9 @@ func (s *Service) Credit(peer penguin.Address, price uint64) error {
 }
 
 // Debit is the mock function wrapper that calls the set implementation
-func (s *Service) PrepareDebit(peer penguin.Address, price uint64) accounting.Action {
+func (s *Service) PrepareDebit(peer penguin.Address, price uint64, provenance accounting.Provenance) accounting.Action {
 	if s.prepareDebitFunc != nil {
-		return s.prepareDebitFunc(peer, price)
+		return s.prepareDebitFunc(peer, price, provenance)
 	}
 
 	bigPrice := new(big.Int).SetUint64(price)
@@ -0,0 +1,329 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/penguintop/penguin/pkg/accesscontrol"
+	"github.com/penguintop/penguin/pkg/crypto"
+	"github.com/penguintop/penguin/pkg/file/loadsave"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/penguintop/penguin/pkg/tracing"
+)
+
+var (
+	errInvalidActHistoryAddress = errors.New("invalid access control history address")
+	errInvalidActPublisher      = errors.New("invalid access control publisher")
+	errInvalidActTimestamp      = errors.New("invalid access control timestamp")
+	errInvalidGrantee           = errors.New("invalid grantee public key")
+)
+
+type granteesPostRequest struct {
+	Grantees []string `json:"grantees"`
+}
+
+type granteesPatchRequest struct {
+	Add    []string `json:"add"`
+	Revoke []string `json:"revoke"`
+}
+
+type granteesResponse struct {
+	Reference        penguin.Address `json:"reference"`
+	HistoryReference penguin.Address `json:"historyReference"`
+}
+
+func requestAct(r *http.Request) bool {
+	return strings.ToLower(r.Header.Get(PenguinActHeader)) == "true"
+}
+
+// requestActHistoryAddress returns the history address from the request
+// header, or the zero address if the header is not set.
+func requestActHistoryAddress(r *http.Request) (penguin.Address, error) {
+	h := r.Header.Get(PenguinActHistoryAddressHeader)
+	if h == "" {
+		return penguin.ZeroAddress, nil
+	}
+	a, err := penguin.ParseHexAddress(h)
+	if err != nil {
+		return penguin.ZeroAddress, errInvalidActHistoryAddress
+	}
+	return a, nil
+}
+
+func parsePublicKey(s string) (*ecdsa.PublicKey, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DecodeSecp256k1PublicKey(b)
+}
+
+func parsePublicKeys(ss []string) ([]*ecdsa.PublicKey, error) {
+	keys := make([]*ecdsa.PublicKey, 0, len(ss))
+	for _, s := range ss {
+		k, err := parsePublicKey(s)
+		if err != nil {
+			return nil, errInvalidGrantee
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// actEncryptReference encrypts the uploaded reference with the access key of
+// the history in the request if access control is requested. The address of
+// the history is returned in the response header.
+func (s *server) actEncryptReference(w http.ResponseWriter, r *http.Request, storer storage.Storer, reference penguin.Address) (penguin.Address, bool) {
+	if !requestAct(r) {
+		return reference, true
+	}
+	logger := tracing.NewLoggerWithTraceID(r.Context(), s.logger)
+
+	historyRef, err := requestActHistoryAddress(r)
+	if err != nil {
+		logger.Debugf("act upload: history address: %v", err)
+		logger.Error("act upload: history address")
+		jsonhttp.BadRequest(w, err)
+		return penguin.ZeroAddress, false
+	}
+
+	ls := loadsave.New(storer, requestModePut(r), false)
+	encryptedRef, historyRef, err := s.accessControl.Upload(r.Context(), ls, reference, historyRef)
+	if err != nil {
+		logger.Debugf("act upload: encrypt reference: %v", err)
+		logger.Error("act upload: encrypt reference")
+		if errors.Is(err, accesscontrol.ErrNotFound) || errors.Is(err, storage.ErrNotFound) {
+			jsonhttp.NotFound(w, errInvalidActHistoryAddress)
+			return penguin.ZeroAddress, false
+		}
+		jsonhttp.InternalServerError(w, nil)
+		return penguin.ZeroAddress, false
+	}
+
+	w.Header().Set(PenguinActHistoryAddressHeader, historyRef.String())
+	return encryptedRef, true
+}
+
+// actDecryptionHandler replaces the encrypted address of the request with
+// the decrypted one if access control is requested.
+func (s *server) actDecryptionHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requestAct(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		logger := tracing.NewLoggerWithTraceID(r.Context(), s.logger)
+
+		publisher, err := parsePublicKey(r.Header.Get(PenguinActPublisherHeader))
+		if err != nil {
+			logger.Debugf("act download: publisher: %v", err)
+			logger.Error("act download: publisher")
+			jsonhttp.BadRequest(w, errInvalidActPublisher)
+			return
+		}
+		historyRef, err := requestActHistoryAddress(r)
+		if err != nil || historyRef.IsZero() {
+			logger.Debugf("act download: history address: %v", err)
+			logger.Error("act download: history address")
+			jsonhttp.BadRequest(w, errInvalidActHistoryAddress)
+			return
+		}
+		timestamp := time.Now().Unix()
+		if h := r.Header.Get(PenguinActTimestampHeader); h != "" {
+			if timestamp, err = strconv.ParseInt(h, 10, 64); err != nil {
+				logger.Debugf("act download: timestamp: %v", err)
+				logger.Error("act download: timestamp")
+				jsonhttp.BadRequest(w, errInvalidActTimestamp)
+				return
+			}
+		}
+
+		vars := mux.Vars(r)
+		encryptedRef, err := s.resolveNameOrAddress(vars["address"])
+		if err != nil {
+			logger.Debugf("act download: parse address %s: %v", vars["address"], err)
+			logger.Error("act download: parse address")
+			jsonhttp.NotFound(w, nil)
+			return
+		}
+
+		ls := loadsave.New(s.storer, storage.ModePutRequest, false)
+		reference, err := s.accessControl.Download(r.Context(), ls, encryptedRef, publisher, historyRef, timestamp)
+		if err != nil {
+			logger.Debugf("act download: decrypt reference %s: %v", encryptedRef, err)
+			logger.Error("act download: decrypt reference")
+			switch {
+			case errors.Is(err, accesscontrol.ErrNotGranted):
+				jsonhttp.Forbidden(w, nil)
+			case errors.Is(err, accesscontrol.ErrNotFound), errors.Is(err, storage.ErrNotFound):
+				jsonhttp.NotFound(w, nil)
+			default:
+				jsonhttp.InternalServerError(w, nil)
+			}
+			return
+		}
+
+		vars["address"] = reference.String()
+		h.ServeHTTP(w, mux.SetURLVars(r, vars))
+	})
+}
+
+// granteesPostHandler creates a grantee list and a history that grants the
+// access to the content of the node to the grantees.
+func (s *server) granteesPostHandler(w http.ResponseWriter, r *http.Request) {
+	var req granteesPostRequest
+	if !s.decodeGranteesRequest(w, r, &req) {
+		return
+	}
+	grantees, err := parsePublicKeys(req.Grantees)
+	if err != nil {
+		s.logger.Debugf("grantees post: %v", err)
+		s.logger.Error("grantees post: parse grantees")
+		jsonhttp.BadRequest(w, err)
+		return
+	}
+	s.updateGrantees(w, r, penguin.ZeroAddress, grantees, nil, http.StatusCreated)
+}
+
+// granteesPatchHandler adds and revokes grantees of the grantee list, adding
+// a new entry to the history.
+func (s *server) granteesPatchHandler(w http.ResponseWriter, r *http.Request) {
+	granteeRef, err := penguin.ParseHexAddress(mux.Vars(r)["address"])
+	if err != nil {
+		s.logger.Debugf("grantees patch: parse address: %v", err)
+		s.logger.Error("grantees patch: parse address")
+		jsonhttp.BadRequest(w, "invalid address")
+		return
+	}
+
+	var req granteesPatchRequest
+	if !s.decodeGranteesRequest(w, r, &req) {
+		return
+	}
+	add, err := parsePublicKeys(req.Add)
+	if err != nil {
+		s.logger.Debugf("grantees patch: %v", err)
+		s.logger.Error("grantees patch: parse grantees")
+		jsonhttp.BadRequest(w, err)
+		return
+	}
+	revoke, err := parsePublicKeys(req.Revoke)
+	if err != nil {
+		s.logger.Debugf("grantees patch: %v", err)
+		s.logger.Error("grantees patch: parse grantees")
+		jsonhttp.BadRequest(w, err)
+		return
+	}
+	s.updateGrantees(w, r, granteeRef, add, revoke, http.StatusOK)
+}
+
+// granteesGetHandler returns the public keys of the grantee list.
+func (s *server) granteesGetHandler(w http.ResponseWriter, r *http.Request) {
+	granteeRef, err := penguin.ParseHexAddress(mux.Vars(r)["address"])
+	if err != nil {
+		s.logger.Debugf("grantees get: parse address: %v", err)
+		s.logger.Error("grantees get: parse address")
+		jsonhttp.BadRequest(w, "invalid address")
+		return
+	}
+
+	ls := loadsave.New(s.storer, storage.ModePutRequest, false)
+	grantees, err := s.accessControl.Grantees(r.Context(), ls, granteeRef)
+	if err != nil {
+		s.logger.Debugf("grantees get: %s: %v", granteeRef, err)
+		s.logger.Error("grantees get")
+		if errors.Is(err, storage.ErrNotFound) {
+			jsonhttp.NotFound(w, nil)
+			return
+		}
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+
+	keys := make([]string, 0, len(grantees))
+	for _, k := range grantees {
+		keys = append(keys, hex.EncodeToString(crypto.EncodeSecp256k1PublicKey(k)))
+	}
+	jsonhttp.OK(w, keys)
+}
+
+func (s *server) decodeGranteesRequest(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		if jsonhttp.HandleBodyReadError(err, w) {
+			return false
+		}
+		s.logger.Debugf("grantees: read request body: %v", err)
+		s.logger.Error("grantees: read request body")
+		jsonhttp.InternalServerError(w, "cannot read request")
+		return false
+	}
+	if err := json.Unmarshal(body, req); err != nil {
+		s.logger.Debugf("grantees: unmarshal request body: %v", err)
+		s.logger.Error("grantees: unmarshal request body")
+		jsonhttp.BadRequest(w, "error unmarshaling request")
+		return false
+	}
+	return true
+}
+
+func (s *server) updateGrantees(w http.ResponseWriter, r *http.Request, granteeRef penguin.Address, add, revoke []*ecdsa.PublicKey, status int) {
+	logger := tracing.NewLoggerWithTraceID(r.Context(), s.logger)
+
+	historyRef, err := requestActHistoryAddress(r)
+	if err != nil {
+		logger.Debugf("grantees: history address: %v", err)
+		logger.Error("grantees: history address")
+		jsonhttp.BadRequest(w, err)
+		return
+	}
+
+	batch, err := requestPostageBatchId(r)
+	if err != nil {
+		logger.Debugf("grantees: postage batch id: %v", err)
+		logger.Error("grantees: postage batch id")
+		jsonhttp.BadRequest(w, errInvalidPostageBatch)
+		return
+	}
+	putter, err := newStamperPutter(s.storer, s.post, s.signer, batch)
+	if err != nil {
+		logger.Debugf("grantees: putter: %v", err)
+		logger.Error("grantees: putter")
+		jsonhttp.BadRequest(w, nil)
+		return
+	}
+
+	ls := loadsave.New(putter, requestModePut(r), false)
+	granteeRef, historyRef, err = s.accessControl.UpdateGrantees(r.Context(), ls, granteeRef, historyRef, add, revoke)
+	if err != nil {
+		logger.Debugf("grantees: update: %v", err)
+		logger.Error("grantees: update")
+		if errors.Is(err, accesscontrol.ErrNotFound) || errors.Is(err, storage.ErrNotFound) {
+			jsonhttp.NotFound(w, nil)
+			return
+		}
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+
+	w.Header().Set(PenguinActHistoryAddressHeader, historyRef.String())
+	jsonhttp.Respond(w, status, granteesResponse{
+		Reference:        granteeRef,
+		HistoryReference: historyRef,
+	})
+}
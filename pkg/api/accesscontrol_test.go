@@ -0,0 +1,153 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/accesscontrol"
+	"github.com/penguintop/penguin/pkg/api"
+	"github.com/penguintop/penguin/pkg/crypto"
+	"github.com/penguintop/penguin/pkg/jsonhttp/jsonhttptest"
+	"github.com/penguintop/penguin/pkg/logging"
+	mockpost "github.com/penguintop/penguin/pkg/postage/mock"
+	statestore "github.com/penguintop/penguin/pkg/statestore/mock"
+	"github.com/penguintop/penguin/pkg/storage/mock"
+	"github.com/penguintop/penguin/pkg/tags"
+)
+
+// TestAccessControl tests that content uploaded with access control can
+// be downloaded only through the grantee list of the publisher.
+func TestAccessControl(t *testing.T) {
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		logger     = logging.New(ioutil.Discard, 0)
+		serverOpts = testServerOptions{
+			Storer:        mock.NewStorer(),
+			Tags:          tags.NewTags(statestore.NewStateStore(), logger),
+			Logger:        logger,
+			Post:          mockpost.New(mockpost.WithAcceptAll()),
+			AccessControl: accesscontrol.New(key),
+		}
+		client, _, _ = newTestServer(t, serverOpts)
+		publisher    = hex.EncodeToString(crypto.EncodeSecp256k1PublicKey(&key.PublicKey))
+		other        = hex.EncodeToString(crypto.EncodeSecp256k1PublicKey(&otherKey.PublicKey))
+		content      = []byte("access controlled content")
+	)
+
+	var upload api.BytesPostResponse
+	header := jsonhttptest.Request(t, client, http.MethodPost, "/bytes", http.StatusCreated,
+		jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+		jsonhttptest.WithRequestHeader(api.PenguinActHeader, "true"),
+		jsonhttptest.WithRequestBody(bytes.NewReader(content)),
+		jsonhttptest.WithUnmarshalJSONResponse(&upload),
+	)
+	history := header.Get(api.PenguinActHistoryAddressHeader)
+	if history == "" {
+		t.Fatal("history address not returned")
+	}
+	resource := "/bytes/" + upload.Reference.String()
+
+	t.Run("download", func(t *testing.T) {
+		jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusOK,
+			jsonhttptest.WithRequestHeader(api.PenguinActHeader, "true"),
+			jsonhttptest.WithRequestHeader(api.PenguinActPublisherHeader, publisher),
+			jsonhttptest.WithRequestHeader(api.PenguinActHistoryAddressHeader, history),
+			jsonhttptest.WithExpectedResponse(content),
+		)
+	})
+
+	t.Run("download without access control", func(t *testing.T) {
+		jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusNotFound)
+	})
+
+	t.Run("download not granted", func(t *testing.T) {
+		jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusForbidden,
+			jsonhttptest.WithRequestHeader(api.PenguinActHeader, "true"),
+			jsonhttptest.WithRequestHeader(api.PenguinActPublisherHeader, other),
+			jsonhttptest.WithRequestHeader(api.PenguinActHistoryAddressHeader, history),
+		)
+	})
+
+	t.Run("download before history", func(t *testing.T) {
+		jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusNotFound,
+			jsonhttptest.WithRequestHeader(api.PenguinActHeader, "true"),
+			jsonhttptest.WithRequestHeader(api.PenguinActPublisherHeader, publisher),
+			jsonhttptest.WithRequestHeader(api.PenguinActHistoryAddressHeader, history),
+			jsonhttptest.WithRequestHeader(api.PenguinActTimestampHeader, "1"),
+		)
+	})
+
+	t.Run("invalid headers", func(t *testing.T) {
+		jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusBadRequest,
+			jsonhttptest.WithRequestHeader(api.PenguinActHeader, "true"),
+			jsonhttptest.WithRequestHeader(api.PenguinActHistoryAddressHeader, history),
+		)
+		jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusBadRequest,
+			jsonhttptest.WithRequestHeader(api.PenguinActHeader, "true"),
+			jsonhttptest.WithRequestHeader(api.PenguinActPublisherHeader, publisher),
+		)
+	})
+
+	t.Run("grantees", func(t *testing.T) {
+		var resp api.GranteesResponse
+		jsonhttptest.Request(t, client, http.MethodPost, "/grantee", http.StatusCreated,
+			jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+			jsonhttptest.WithRequestHeader(api.PenguinActHistoryAddressHeader, history),
+			jsonhttptest.WithJSONRequestBody(api.GranteesPostRequest{
+				Grantees: []string{other},
+			}),
+			jsonhttptest.WithUnmarshalJSONResponse(&resp),
+		)
+		if resp.HistoryReference.String() == history {
+			t.Fatal("history reference not changed")
+		}
+
+		jsonhttptest.Request(t, client, http.MethodGet, "/grantee/"+resp.Reference.String(), http.StatusOK,
+			jsonhttptest.WithExpectedJSONResponse([]string{other}),
+		)
+
+		jsonhttptest.Request(t, client, http.MethodPatch, "/grantee/"+resp.Reference.String(), http.StatusOK,
+			jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+			jsonhttptest.WithRequestHeader(api.PenguinActHistoryAddressHeader, resp.HistoryReference.String()),
+			jsonhttptest.WithJSONRequestBody(api.GranteesPatchRequest{
+				Revoke: []string{other},
+			}),
+			jsonhttptest.WithUnmarshalJSONResponse(&resp),
+		)
+		jsonhttptest.Request(t, client, http.MethodGet, "/grantee/"+resp.Reference.String(), http.StatusOK,
+			jsonhttptest.WithExpectedJSONResponse([]string{}),
+		)
+
+		jsonhttptest.Request(t, client, http.MethodPost, "/grantee", http.StatusBadRequest,
+			jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+			jsonhttptest.WithJSONRequestBody(api.GranteesPostRequest{
+				Grantees: []string{"invalid"},
+			}),
+		)
+	})
+
+	t.Run("gateway mode", func(t *testing.T) {
+		serverOpts.GatewayMode = true
+		client, _, _ := newTestServer(t, serverOpts)
+		jsonhttptest.Request(t, client, http.MethodPost, "/bytes", http.StatusForbidden,
+			jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+			jsonhttptest.WithRequestHeader(api.PenguinActHeader, "true"),
+			jsonhttptest.WithRequestBody(bytes.NewReader(content)),
+		)
+		jsonhttptest.Request(t, client, http.MethodPost, "/grantee", http.StatusForbidden)
+	})
+}
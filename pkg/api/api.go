@@ -20,12 +20,15 @@ import (
 	"time"
 	"unicode/utf8"
 
+	"github.com/penguintop/penguin/pkg/accesscontrol"
+	"github.com/penguintop/penguin/pkg/budget"
 	"github.com/penguintop/penguin/pkg/crypto"
 	"github.com/penguintop/penguin/pkg/feeds"
 	"github.com/penguintop/penguin/pkg/file/pipeline/builder"
 	"github.com/penguintop/penguin/pkg/logging"
 	m "github.com/penguintop/penguin/pkg/metrics"
 	"github.com/penguintop/penguin/pkg/pinning"
+	"github.com/penguintop/penguin/pkg/pinning/remote"
 	"github.com/penguintop/penguin/pkg/postage"
 	"github.com/penguintop/penguin/pkg/postage/postagecontract"
 	"github.com/penguintop/penguin/pkg/pss"
@@ -48,6 +51,13 @@ const (
 	PenguinFeedIndexNextHeader  = "Penguin-Feed-Index-Next"
 	PenguinCollectionHeader     = "Penguin-Collection"
 	PenguinPostageBatchIdHeader = "Penguin-Postage-Batch-Id"
+
+	PenguinActHeader               = "Penguin-Act"
+	PenguinActPublisherHeader      = "Penguin-Act-Publisher"
+	PenguinActHistoryAddressHeader = "Penguin-Act-History-Address"
+	PenguinActTimestampHeader      = "Penguin-Act-Timestamp"
+
+	PenguinAPIKeyHeader = "Penguin-Api-Key"
 )
 
 // The size of buffer used for prefetching content with Langos.
@@ -99,6 +109,9 @@ type server struct {
 	signer          crypto.Signer
 	post            postage.Service
 	postageContract postagecontract.Interface
+	accessControl   accesscontrol.Controller
+	budget          *budget.Service
+	remotePinning   *remote.Service
 	Options
 	http.Handler
 	metrics metrics
@@ -111,6 +124,9 @@ type Options struct {
 	CORSAllowedOrigins []string
 	GatewayMode        bool
 	WsPingPeriod       time.Duration
+	// RemotePinningEndpoints are the urls of the remote pinning
+	// services the pins may be delegated to.
+	RemotePinningEndpoints []string
 }
 
 const (
@@ -119,7 +135,7 @@ const (
 )
 
 // New will create a and initialize a new API service.
-func New(tags *tags.Tags, storer storage.Storer, resolver resolver.Interface, pss pss.Interface, traversalService traversal.Traverser, pinning pinning.Interface, feedFactory feeds.Factory, post postage.Service, postageContract postagecontract.Interface, steward steward.Reuploader, signer crypto.Signer, logger logging.Logger, tracer *tracing.Tracer, o Options) Service {
+func New(tags *tags.Tags, storer storage.Storer, resolver resolver.Interface, pss pss.Interface, traversalService traversal.Traverser, pinning pinning.Interface, feedFactory feeds.Factory, post postage.Service, postageContract postagecontract.Interface, steward steward.Reuploader, accessControl accesscontrol.Controller, budget *budget.Service, remotePinning *remote.Service, signer crypto.Signer, logger logging.Logger, tracer *tracing.Tracer, o Options) Service {
 	s := &server{
 		tags:            tags,
 		storer:          storer,
@@ -131,6 +147,9 @@ func New(tags *tags.Tags, storer storage.Storer, resolver resolver.Interface, ps
 		post:            post,
 		postageContract: postageContract,
 		steward:         steward,
+		accessControl:   accessControl,
+		budget:          budget,
+		remotePinning:   remotePinning,
 		signer:          signer,
 		Options:         o,
 		logger:          logger,
@@ -166,13 +185,15 @@ func (s *server) Close() error {
 
 // getOrCreateTag attempts to get the tag if an id is supplied, and returns an error if it does not exist.
 // If no id is supplied, it will attempt to create a new tag with a generated name and return it.
-func (s *server) getOrCreateTag(tagUid string) (*tags.Tag, bool, error) {
+// The created tag records the api key identifier of the client, so that the chunks are pushed at its expense.
+func (s *server) getOrCreateTag(tagUid, client string) (*tags.Tag, bool, error) {
 	// if tag ID is not supplied, create a new tag
 	if tagUid == "" {
 		tag, err := s.tags.Create(0)
 		if err != nil {
 			return nil, false, fmt.Errorf("cannot create tag: %w", err)
 		}
+		tag.Client = client
 		return tag, true, nil
 	}
 	t, err := s.getTag(tagUid)
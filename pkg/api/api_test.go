@@ -6,6 +6,7 @@ package api_test
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
@@ -17,12 +18,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/penguintop/penguin/pkg/accesscontrol"
+	"github.com/penguintop/penguin/pkg/budget"
 	"github.com/penguintop/penguin/pkg/api"
 	"github.com/penguintop/penguin/pkg/crypto"
 	"github.com/penguintop/penguin/pkg/feeds"
 	"github.com/penguintop/penguin/pkg/jsonhttp/jsonhttptest"
 	"github.com/penguintop/penguin/pkg/logging"
 	"github.com/penguintop/penguin/pkg/pinning"
+	"github.com/penguintop/penguin/pkg/pinning/remote"
 	"github.com/penguintop/penguin/pkg/postage"
 	mockpost "github.com/penguintop/penguin/pkg/postage/mock"
 	"github.com/penguintop/penguin/pkg/postage/postagecontract"
@@ -70,11 +74,19 @@ type testServerOptions struct {
 	PostageContract    postagecontract.Interface
 	Post               postage.Service
 	Steward            steward.Reuploader
+	AccessControl      accesscontrol.Controller
+	Budget             *budget.Service
+	RemotePinning      *remote.Service
+	RemotePinEndpoints []string
+	Key                *ecdsa.PrivateKey
 }
 
 func newTestServer(t *testing.T, o testServerOptions) (*http.Client, *websocket.Conn, string) {
 	t.Helper()
-	pk, _ := crypto.GenerateSecp256k1Key()
+	pk := o.Key
+	if pk == nil {
+		pk, _ = crypto.GenerateSecp256k1Key()
+	}
 	signer := crypto.NewDefaultSigner(pk)
 
 	if o.Logger == nil {
@@ -89,10 +101,15 @@ func newTestServer(t *testing.T, o testServerOptions) (*http.Client, *websocket.
 	if o.Post == nil {
 		o.Post = mockpost.New()
 	}
-	s := api.New(o.Tags, o.Storer, o.Resolver, o.Pss, o.Traversal, o.Pinning, o.Feeds, o.Post, o.PostageContract, o.Steward, signer, o.Logger, nil, api.Options{
+	if o.AccessControl == nil {
+		o.AccessControl = accesscontrol.New(pk)
+	}
+	s := api.New(o.Tags, o.Storer, o.Resolver, o.Pss, o.Traversal, o.Pinning, o.Feeds, o.Post, o.PostageContract, o.Steward, o.AccessControl, o.Budget, o.RemotePinning, signer, o.Logger, nil, api.Options{
 		CORSAllowedOrigins: o.CORSAllowedOrigins,
 		GatewayMode:        o.GatewayMode,
 		WsPingPeriod:       o.WsPingPeriod,
+
+		RemotePinningEndpoints: o.RemotePinEndpoints,
 	})
 	ts := httptest.NewServer(s)
 	t.Cleanup(ts.Close)
@@ -208,7 +225,7 @@ func TestParseName(t *testing.T) {
 		signer := crypto.NewDefaultSigner(pk)
 		mockPostage := mockpost.New()
 
-		s := api.New(nil, nil, tC.res, nil, nil, nil, nil, mockPostage, nil, nil, signer, log, nil, api.Options{}).(*api.Server)
+		s := api.New(nil, nil, tC.res, nil, nil, nil, nil, mockPostage, nil, nil, nil, nil, nil, signer, log, nil, api.Options{}).(*api.Server)
 
 		t.Run(tC.desc, func(t *testing.T) {
 			got, err := s.ResolveNameOrAddress(tC.name)
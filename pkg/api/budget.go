@@ -0,0 +1,51 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/penguintop/penguin/pkg/accounting"
+	"github.com/penguintop/penguin/pkg/budget"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/sctx"
+)
+
+// budgetHandler enforces the spending budgets of the client identified by the
+// api key header. Requests with unknown api keys are rejected, as are
+// requests over the hard limit. Requests over the soft limit are served from
+// the local store only.
+func (s *server) budgetHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.budget == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.Header.Get(PenguinAPIKeyHeader)
+		// the key is a secret, it is only identified in the logs
+		id := accounting.ClientID(key)
+		if err := s.budget.Authenticate(key); err != nil {
+			s.logger.Debugf("budget: api key %s: %v", id, err)
+			jsonhttp.Unauthorized(w, "invalid api key")
+			return
+		}
+		ctx := accounting.SetClient(r.Context(), id)
+
+		err := s.budget.Check(key)
+		switch {
+		case errors.Is(err, budget.ErrHardLimit):
+			s.logger.Debugf("budget: api key %s: %v", id, err)
+			jsonhttp.PaymentRequired(w, "spending budget exceeded")
+			return
+		case errors.Is(err, budget.ErrSoftLimit):
+			s.logger.Tracef("budget: api key %s: serving from local store: %v", id, err)
+			ctx = sctx.SetCacheOnly(ctx)
+		}
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
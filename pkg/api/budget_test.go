@@ -0,0 +1,167 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api_test
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/accounting"
+	"github.com/penguintop/penguin/pkg/api"
+	"github.com/penguintop/penguin/pkg/budget"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/jsonhttp/jsonhttptest"
+	"github.com/penguintop/penguin/pkg/logging"
+	mockpost "github.com/penguintop/penguin/pkg/postage/mock"
+	statestore "github.com/penguintop/penguin/pkg/statestore/mock"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/penguintop/penguin/pkg/storage/mock"
+	testingc "github.com/penguintop/penguin/pkg/storage/testing"
+	"github.com/penguintop/penguin/pkg/tags"
+)
+
+func TestBudget(t *testing.T) {
+	var (
+		chunk      = testingc.GenerateTestRandomChunk()
+		resource   = "/chunks/" + chunk.Address().String()
+		storerMock = mock.NewStorer()
+		logger     = logging.New(ioutil.Discard, 0)
+	)
+
+	budgets, err := budget.New(statestore.NewStateStore(), logger, time.Hour, budget.Limits{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := budgets.SetBudget("soft", budget.Limits{Soft: big.NewInt(10), Hard: big.NewInt(20)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := budgets.SetBudget("hard", budget.Limits{Soft: big.NewInt(10), Hard: big.NewInt(20)}); err != nil {
+		t.Fatal(err)
+	}
+	budgets.Spend(accounting.ClientID("soft"), 10)
+	budgets.Spend(accounting.ClientID("hard"), 20)
+
+	_, err = storerMock.Put(context.Background(), storage.ModePutUpload, chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, _, _ := newTestServer(t, testServerOptions{
+		Storer: storerMock,
+		Budget: budgets,
+		Logger: logger,
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusOK)
+	})
+
+	t.Run("soft limit", func(t *testing.T) {
+		// local chunks are still served
+		jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusOK,
+			jsonhttptest.WithRequestHeader(api.PenguinAPIKeyHeader, "soft"),
+		)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusUnauthorized,
+			jsonhttptest.WithRequestHeader(api.PenguinAPIKeyHeader, "unknown"),
+			jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
+				Message: "invalid api key",
+				Code:    http.StatusUnauthorized,
+			}),
+		)
+	})
+
+	t.Run("hard limit", func(t *testing.T) {
+		jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusPaymentRequired,
+			jsonhttptest.WithRequestHeader(api.PenguinAPIKeyHeader, "hard"),
+			jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
+				Message: "spending budget exceeded",
+				Code:    http.StatusPaymentRequired,
+			}),
+		)
+	})
+}
+
+func TestBudgetRequireKey(t *testing.T) {
+	var (
+		chunk      = testingc.GenerateTestRandomChunk()
+		resource   = "/chunks/" + chunk.Address().String()
+		storerMock = mock.NewStorer()
+		logger     = logging.New(ioutil.Discard, 0)
+	)
+
+	budgets, err := budget.New(statestore.NewStateStore(), logger, time.Hour, budget.Limits{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := budgets.SetBudget("key", budget.Limits{}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = storerMock.Put(context.Background(), storage.ModePutUpload, chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, _, _ := newTestServer(t, testServerOptions{
+		Storer: storerMock,
+		Budget: budgets,
+		Logger: logger,
+	})
+
+	jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusUnauthorized)
+	jsonhttptest.Request(t, client, http.MethodGet, resource, http.StatusOK,
+		jsonhttptest.WithRequestHeader(api.PenguinAPIKeyHeader, "key"),
+	)
+}
+
+func TestBudgetUploadTag(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+	tag := tags.NewTags(statestore.NewStateStore(), logger)
+
+	budgets, err := budget.New(statestore.NewStateStore(), logger, time.Hour, budget.Limits{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := budgets.SetBudget("key", budget.Limits{}); err != nil {
+		t.Fatal(err)
+	}
+
+	client, _, _ := newTestServer(t, testServerOptions{
+		Storer: mock.NewStorer(),
+		Tags:   tag,
+		Budget: budgets,
+		Logger: logger,
+		Post:   mockpost.New(mockpost.WithAcceptAll()),
+	})
+
+	respHeaders := jsonhttptest.Request(t, client, http.MethodPost, "/bytes", http.StatusCreated,
+		jsonhttptest.WithRequestHeader(api.PenguinAPIKeyHeader, "key"),
+		jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+		jsonhttptest.WithRequestBody(strings.NewReader("data")),
+	)
+	uid, err := strconv.ParseUint(respHeaders.Get(api.PenguinTagHeader), 10, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg, err := tag.Get(uint32(uid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the chunks are pushed at the expense of the client, the secret key is
+	// not persisted with the tag
+	if want := accounting.ClientID("key"); tg.Client != want {
+		t.Fatalf("got tag client %q, want %q", tg.Client, want)
+	}
+}
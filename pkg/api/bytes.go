@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/penguintop/penguin/pkg/accounting"
 	"github.com/penguintop/penguin/pkg/jsonhttp"
 	"github.com/penguintop/penguin/pkg/sctx"
     "github.com/penguintop/penguin/pkg/penguin"
@@ -25,7 +26,7 @@ type bytesPostResponse struct {
 func (s *server) bytesUploadHandler(w http.ResponseWriter, r *http.Request) {
 	logger := tracing.NewLoggerWithTraceID(r.Context(), s.logger)
 
-	tag, created, err := s.getOrCreateTag(r.Header.Get(PenguinTagHeader))
+	tag, created, err := s.getOrCreateTag(r.Header.Get(PenguinTagHeader), accounting.GetClient(r.Context()))
 	if err != nil {
 		logger.Debugf("bytes upload: get or create tag: %v", err)
 		logger.Error("bytes upload: get or create tag")
@@ -93,6 +94,11 @@ func (s *server) bytesUploadHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	address, ok := s.actEncryptReference(w, r, putter, address)
+	if !ok {
+		return
+	}
+
 	w.Header().Set(PenguinTagHeader, fmt.Sprint(tag.Uid))
 	w.Header().Set("Access-Control-Expose-Headers", PenguinTagHeader)
 	jsonhttp.Created(w, bytesPostResponse{
@@ -7,6 +7,7 @@ package api_test
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"testing"
@@ -129,6 +130,54 @@ func TestBytes(t *testing.T) {
 		}
 	})
 
+	t.Run("download-range", func(t *testing.T) {
+		var body []byte
+		header := jsonhttptest.Request(t, client, http.MethodGet, resource+"/"+expHash, http.StatusPartialContent,
+			jsonhttptest.WithRequestHeader("Range", "bytes=4090-4105"),
+			jsonhttptest.WithPutResponseBody(&body),
+		)
+		if !bytes.Equal(body, content[4090:4106]) {
+			t.Fatalf("data mismatch. got %x, want %x", body, content[4090:4106])
+		}
+		if got, want := header.Get("Content-Range"), fmt.Sprintf("bytes 4090-4105/%d", len(content)); got != want {
+			t.Fatalf("content range mismatch. got %q, want %q", got, want)
+		}
+		if got := header.Get("Accept-Ranges"); got != "bytes" {
+			t.Fatalf("accept ranges mismatch. got %q, want %q", got, "bytes")
+		}
+		if got, want := header.Get("ETag"), fmt.Sprintf("%q", expHash); got != want {
+			t.Fatalf("etag mismatch. got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("download-if-range", func(t *testing.T) {
+		var body []byte
+		jsonhttptest.Request(t, client, http.MethodGet, resource+"/"+expHash, http.StatusPartialContent,
+			jsonhttptest.WithRequestHeader("Range", "bytes=10-19"),
+			jsonhttptest.WithRequestHeader("If-Range", fmt.Sprintf("%q", expHash)),
+			jsonhttptest.WithPutResponseBody(&body),
+		)
+		if !bytes.Equal(body, content[10:20]) {
+			t.Fatalf("data mismatch. got %x, want %x", body, content[10:20])
+		}
+
+		// stale validator results in the whole content
+		jsonhttptest.Request(t, client, http.MethodGet, resource+"/"+expHash, http.StatusOK,
+			jsonhttptest.WithRequestHeader("Range", "bytes=10-19"),
+			jsonhttptest.WithRequestHeader("If-Range", `"0xabcd"`),
+			jsonhttptest.WithExpectedResponse(content),
+		)
+	})
+
+	t.Run("download-range-not-satisfiable", func(t *testing.T) {
+		header := jsonhttptest.Request(t, client, http.MethodGet, resource+"/"+expHash, http.StatusRequestedRangeNotSatisfiable,
+			jsonhttptest.WithRequestHeader("Range", fmt.Sprintf("bytes=%d-", len(content)+10)),
+		)
+		if got, want := header.Get("Content-Range"), fmt.Sprintf("bytes */%d", len(content)); got != want {
+			t.Fatalf("content range mismatch. got %q, want %q", got, want)
+		}
+	})
+
 	t.Run("not found", func(t *testing.T) {
 		jsonhttptest.Request(t, client, http.MethodGet, resource+"/0xabcd", http.StatusNotFound,
 			jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
@@ -13,12 +13,14 @@ import (
 	"mime"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gorilla/mux"
 
+	"github.com/penguintop/penguin/pkg/accounting"
 	"github.com/penguintop/penguin/pkg/feeds"
 	"github.com/penguintop/penguin/pkg/file/joiner"
 	"github.com/penguintop/penguin/pkg/file/loadsave"
@@ -86,7 +88,7 @@ func (s *server) fileUploadHandler(w http.ResponseWriter, r *http.Request, store
 	// Content-Type has already been validated by this time
 	contentType := r.Header.Get(contentTypeHeader)
 
-	tag, created, err := s.getOrCreateTag(r.Header.Get(PenguinTagHeader))
+	tag, created, err := s.getOrCreateTag(r.Header.Get(PenguinTagHeader), accounting.GetClient(r.Context()))
 	if err != nil {
 		logger.Debugf("pen upload file: get or create tag: %v", err)
 		logger.Error("pen upload file: get or create tag")
@@ -111,7 +113,8 @@ func (s *server) fileUploadHandler(w http.ResponseWriter, r *http.Request, store
 	ctx := sctx.SetTag(r.Context(), tag)
 
 	fileName = r.URL.Query().Get("name")
-	reader = r.Body
+	body := &countingReader{r: r.Body}
+	reader = body
 
 	p := requestPipelineFn(storer, r)
 
@@ -155,6 +158,7 @@ func (s *server) fileUploadHandler(w http.ResponseWriter, r *http.Request, store
 	fileMtdt := map[string]string{
 		manifest.EntryMetadataContentTypeKey: contentType,
 		manifest.EntryMetadataFilenameKey:    fileName,
+		manifest.EntryMetadataSizeKey:        strconv.FormatInt(body.n, 10),
 	}
 
 	err = m.Add(ctx, fileName, manifest.NewEntry(fr, fileMtdt))
@@ -211,6 +215,11 @@ func (s *server) fileUploadHandler(w http.ResponseWriter, r *http.Request, store
 		}
 	}
 
+	manifestReference, ok := s.actEncryptReference(w, r, storer, manifestReference)
+	if !ok {
+		return
+	}
+
 	w.Header().Set("ETag", fmt.Sprintf("%q", manifestReference.String()))
 	w.Header().Set(PenguinTagHeader, fmt.Sprint(tag.Uid))
 	w.Header().Set("Access-Control-Expose-Headers", PenguinTagHeader)
@@ -306,7 +315,21 @@ FETCH:
 		}
 	}
 
+	if _, ok := r.URL.Query()["list"]; ok {
+		s.manifestListHandler(w, r, m, pathVar)
+		return
+	}
+	if _, ok := r.URL.Query()["dir"]; ok {
+		s.manifestDirectoryHandler(w, r, m, pathVar)
+		return
+	}
+
 	if pathVar == "" {
+		if format := r.URL.Query().Get("format"); format != "" {
+			s.dirDownloadHandler(w, r, address, format)
+			return
+		}
+
 		logger.Tracef("pen download: handle empty path %s", address)
 
 		if indexDocumentSuffixKey, ok := manifestMetadataLoad(ctx, m, manifest.RootPath, manifest.WebsiteIndexDocumentSuffixKey); ok {
@@ -362,6 +385,16 @@ FETCH:
 				}
 			}
 
+			// generate the index page of a directory for browsers if the
+			// collection is not configured as a website
+			if !s.GatewayMode && acceptsHTML(r) && (pathVar == "" || strings.HasSuffix(pathVar, "/")) {
+				if _, ok := manifestMetadataLoad(ctx, m, manifest.RootPath, manifest.WebsiteIndexDocumentSuffixKey); !ok {
+					if s.serveDirectoryIndex(w, r, m, pathVar) {
+						return
+					}
+				}
+			}
+
 			// check if error document is to be shown
 			if errorDocumentPath, ok := manifestMetadataLoad(ctx, m, manifest.RootPath, manifest.WebsiteErrorDocumentPathKey); ok {
 				if pathVar != errorDocumentPath {
@@ -439,11 +472,17 @@ func (s *server) downloadHandler(w http.ResponseWriter, r *http.Request, referen
 	}
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", l))
 	w.Header().Set("Decompressed-Content-Length", fmt.Sprintf("%d", l))
-	w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition")
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, Content-Range, Accept-Ranges, ETag")
 	if targets != "" {
 		w.Header().Set(TargetsRecoveryHeader, targets)
 	}
-	http.ServeContent(w, r, "", time.Now(), langos.NewBufferedLangos(reader, lookaheadBufferSize(l)))
+
+	// Range, If-Range and multipart byte ranges are handled by ServeContent
+	// which seeks the joiner to the start of every requested range. The
+	// content is addressed by its reference, so the modification time is
+	// not set and If-Range is validated only against the ETag.
+	http.ServeContent(w, r, "", time.Time{}, langos.NewBufferedLangos(reader, lookaheadBufferSize(l)))
 }
 
 // manifestMetadataLoad returns the value for a key stored in the metadata of
@@ -90,7 +90,7 @@ func TestPenFiles(t *testing.T) {
 				},
 			},
 		})
-		address := penguin.MustParseHexAddress("f30c0aa7e9e2a0ef4c9b1b750ebfeaeb7c7c24da700bb089da19a46e3677824b")
+		address := penguin.MustParseHexAddress("baad492fc117512eb25ad3d41655ed6a2d121f8ce6568707abb365ea7fefd291")
 		jsonhttptest.Request(t, client, http.MethodPost, fileUploadResource, http.StatusCreated,
 			jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
 			jsonhttptest.WithRequestBody(tr),
@@ -144,7 +144,7 @@ func TestPenFiles(t *testing.T) {
 				},
 			},
 		})
-		reference := penguin.MustParseHexAddress("f30c0aa7e9e2a0ef4c9b1b750ebfeaeb7c7c24da700bb089da19a46e3677824b")
+		reference := penguin.MustParseHexAddress("baad492fc117512eb25ad3d41655ed6a2d121f8ce6568707abb365ea7fefd291")
 		jsonhttptest.Request(t, client, http.MethodPost, fileUploadResource, http.StatusCreated,
 			jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
 			jsonhttptest.WithRequestHeader(api.PenguinPinHeader, "true"),
@@ -208,7 +208,7 @@ func TestPenFiles(t *testing.T) {
 
 	t.Run("check-content-type-detection", func(t *testing.T) {
 		fileName := "my-pictures.jpeg"
-		rootHash := "4f9146b3813ccbd7ce45a18be23763d7e436ab7a3982ef39961c6f3cd4da1dcf"
+		rootHash := "09a8fca584eab900bfd11212fd9d9677df5441e56b0a9196c76362907445050c"
 
 		jsonhttptest.Request(t, client, http.MethodPost,
 			fileUploadResource+"?name="+fileName, http.StatusCreated,
@@ -239,7 +239,7 @@ func TestPenFiles(t *testing.T) {
 
 	t.Run("upload-then-download-and-check-data", func(t *testing.T) {
 		fileName := "sample.html"
-		rootHash := "36e6c1bbdfee6ac21485d5f970479fd1df458d36df9ef4e8179708ed46da557f"
+		rootHash := "1743655809ed1b686e4c20343601d6f278b53ad4fe5e8c312b6f9b5aa5227c94"
 		sampleHtml := `<!DOCTYPE html>
 		<html>
 		<body>
@@ -288,7 +288,7 @@ func TestPenFiles(t *testing.T) {
 
 	t.Run("upload-then-download-with-targets", func(t *testing.T) {
 		fileName := "simple_file.txt"
-		rootHash := "65148cd89b58e91616773f5acea433f7b5a6274f2259e25f4893a332b74a7e28"
+		rootHash := "4415f5e0b938baf82fca8567055ff1884eadbc2d4e35349cb63fe40f505bf48e"
 
 		jsonhttptest.Request(t, client, http.MethodPost,
 			fileUploadResource+"?name="+fileName, http.StatusCreated,
@@ -6,6 +6,7 @@ package api
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"context"
 	"errors"
 	"fmt"
@@ -18,7 +19,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/penguintop/penguin/pkg/accounting"
 	"github.com/penguintop/penguin/pkg/file"
+	"github.com/penguintop/penguin/pkg/file/joiner"
 	"github.com/penguintop/penguin/pkg/file/loadsave"
 	"github.com/penguintop/penguin/pkg/jsonhttp"
 	"github.com/penguintop/penguin/pkg/logging"
@@ -60,7 +63,7 @@ func (s *server) dirUploadHandler(w http.ResponseWriter, r *http.Request, storer
 	}
 	defer r.Body.Close()
 
-	tag, created, err := s.getOrCreateTag(r.Header.Get(PenguinTagHeader))
+	tag, created, err := s.getOrCreateTag(r.Header.Get(PenguinTagHeader), accounting.GetClient(r.Context()))
 	if err != nil {
 		logger.Debugf("pen upload dir: get or create tag: %v", err)
 		logger.Error("pen upload dir: get or create tag")
@@ -108,6 +111,11 @@ func (s *server) dirUploadHandler(w http.ResponseWriter, r *http.Request, storer
 		}
 	}
 
+	reference, ok := s.actEncryptReference(w, r, storer, reference)
+	if !ok {
+		return
+	}
+
 	w.Header().Set(PenguinTagHeader, fmt.Sprint(tag.Uid))
 	jsonhttp.Created(w, penUploadResponse{
 		Reference: reference,
@@ -161,7 +169,8 @@ func storeDir(
 			}
 		}
 
-		fileReference, err := p(ctx, fileInfo.Reader)
+		fileReader := &countingReader{r: fileInfo.Reader}
+		fileReference, err := p(ctx, fileReader)
 		if err != nil {
 			return penguin.ZeroAddress, fmt.Errorf("store dir file: %w", err)
 		}
@@ -170,6 +179,7 @@ func storeDir(
 		fileMtdt := map[string]string{
 			manifest.EntryMetadataContentTypeKey: fileInfo.ContentType,
 			manifest.EntryMetadataFilenameKey:    fileInfo.Name,
+			manifest.EntryMetadataSizeKey:        strconv.FormatInt(fileReader.n, 10),
 		}
 		// add file entry to dir manifest
 		err = dirManifest.Add(ctx, fileInfo.Path, manifest.NewEntry(fileReference, fileMtdt))
@@ -226,6 +236,146 @@ func storeDir(
 	return manifestReference, nil
 }
 
+const (
+	archiveFormatTar = "tar"
+	archiveFormatZip = "zip"
+
+	contentTypeZip = "application/zip"
+
+	// paxContentTypeKey is the vendor specific PAX record which preserves
+	// the content type of a collection entry in a tar archive.
+	paxContentTypeKey = "PENGUIN.content-type"
+)
+
+// dirDownloadHandler streams all entries of the collection manifest as a tar
+// or zip archive, preserving their paths and content types. The entries are
+// written in path order as the manifest is traversed.
+func (s *server) dirDownloadHandler(w http.ResponseWriter, r *http.Request, address penguin.Address, format string) {
+	logger := tracing.NewLoggerWithTraceID(r.Context(), s.logger)
+	ctx := r.Context()
+
+	var contentType string
+	switch format {
+	case archiveFormatTar:
+		contentType = contentTypeTar
+	case archiveFormatZip:
+		contentType = contentTypeZip
+	default:
+		logger.Debugf("pen download dir: invalid archive format %q", format)
+		logger.Error("pen download dir: invalid archive format")
+		jsonhttp.BadRequest(w, "invalid archive format")
+		return
+	}
+
+	// the archive and the response headers are created with the first
+	// entry, errors after that point can only be reported by aborting
+	// the stream
+	var aw archiveWriter
+	err := s.traversal.TraverseEntries(ctx, address, func(p string, e manifest.Entry) error {
+		reader, size, err := joiner.New(ctx, s.storer, e.Reference())
+		if err != nil {
+			return fmt.Errorf("join file %q: %w", p, err)
+		}
+
+		if aw == nil {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", address, format))
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition")
+			if format == archiveFormatZip {
+				aw = &zipWriter{w: zip.NewWriter(w)}
+			} else {
+				aw = &tarWriter{w: tar.NewWriter(w)}
+			}
+		}
+
+		path := strings.TrimLeft(p, "/")
+		mimeType := e.Metadata()[manifest.EntryMetadataContentTypeKey]
+		if err := aw.WriteEntry(path, mimeType, size, reader); err != nil {
+			return fmt.Errorf("write file %q: %w", p, err)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Debugf("pen download dir: traverse %s: %v", address, err)
+		logger.Error("pen download dir: traverse collection")
+		if aw != nil {
+			return
+		}
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, manifest.ErrNotFound) {
+			jsonhttp.NotFound(w, nil)
+			return
+		}
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+	if aw == nil {
+		jsonhttp.NotFound(w, "no files in collection")
+		return
+	}
+
+	if err := aw.Close(); err != nil {
+		logger.Debugf("pen download dir: close archive %s: %v", address, err)
+		logger.Error("pen download dir: close archive")
+	}
+}
+
+// archiveWriter writes collection entries to an archive stream.
+type archiveWriter interface {
+	WriteEntry(path, contentType string, size int64, r io.Reader) error
+	Close() error
+}
+
+type tarWriter struct {
+	w *tar.Writer
+}
+
+func (t *tarWriter) WriteEntry(path, contentType string, size int64, r io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path,
+		Mode:     0644,
+		Size:     size,
+	}
+	if contentType != "" {
+		hdr.Format = tar.FormatPAX
+		hdr.PAXRecords = map[string]string{paxContentTypeKey: contentType}
+	}
+	if err := t.w.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write tar header: %w", err)
+	}
+	if _, err := io.CopyN(t.w, r, size); err != nil {
+		return fmt.Errorf("write tar entry: %w", err)
+	}
+	return nil
+}
+
+func (t *tarWriter) Close() error {
+	return t.w.Close()
+}
+
+type zipWriter struct {
+	w *zip.Writer
+}
+
+func (z *zipWriter) WriteEntry(path, contentType string, size int64, r io.Reader) error {
+	fw, err := z.w.CreateHeader(&zip.FileHeader{
+		Name:    path,
+		Method:  zip.Deflate,
+		Comment: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("write zip header: %w", err)
+	}
+	if _, err := io.CopyN(fw, r, size); err != nil {
+		return fmt.Errorf("write zip entry: %w", err)
+	}
+	return nil
+}
+
+func (z *zipWriter) Close() error {
+	return z.w.Close()
+}
+
 type FileInfo struct {
 	Path        string
 	Name        string
@@ -252,6 +402,10 @@ func (t *tarReader) Next() (*FileInfo, error) {
 
 		fileName := fileHeader.FileInfo().Name()
 		contentType := mime.TypeByExtension(filepath.Ext(fileHeader.Name))
+		if ct, ok := fileHeader.PAXRecords[paxContentTypeKey]; ok {
+			// preserved by the collection archive download
+			contentType = ct
+		}
 		fileSize := fileHeader.FileInfo().Size()
 		filePath := filepath.Clean(fileHeader.Name)
 
@@ -6,6 +6,7 @@ package api_test
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"context"
 	"fmt"
@@ -30,6 +31,7 @@ import (
 	"github.com/penguintop/penguin/pkg/storage/mock"
     "github.com/penguintop/penguin/pkg/penguin"
 	"github.com/penguintop/penguin/pkg/tags"
+	"github.com/penguintop/penguin/pkg/traversal"
 )
 
 func TestDirs(t *testing.T) {
@@ -113,7 +115,7 @@ func TestDirs(t *testing.T) {
 	}{
 		{
 			name:              "non-nested files without extension",
-			expectedReference: penguin.MustParseHexAddress("f3312af64715d26b5e1a3dc90f012d2c9cc74a167899dab1d07cdee8c107f939"),
+			expectedReference: penguin.MustParseHexAddress("10ff55c065b89d6f1dc1f07735d41093525fc94c71e5115c90f784954987842e"),
 			files: []f{
 				{
 					data: []byte("first file data"),
@@ -135,7 +137,7 @@ func TestDirs(t *testing.T) {
 		},
 		{
 			name:              "nested files with extension",
-			expectedReference: penguin.MustParseHexAddress("4c9c76d63856102e54092c38a7cd227d769752d768b7adc8c3542e3dd9fcf295"),
+			expectedReference: penguin.MustParseHexAddress("c759d6ab0fb6dbad420cc843719ace667e02a792370ebd76330dc14af3896f5d"),
 			files: []f{
 				{
 					data: []byte("robots text"),
@@ -534,3 +536,137 @@ type f struct {
 	filePath string
 	header   http.Header
 }
+
+// TestDirsArchiveDownload tests that a collection can be downloaded as an
+// archive and that the exported tar uploads back to the same collection.
+func TestDirsArchiveDownload(t *testing.T) {
+	var (
+		logger       = logging.New(ioutil.Discard, 0)
+		storer       = mock.NewStorer()
+		client, _, _ = newTestServer(t, testServerOptions{
+			Storer:    storer,
+			Traversal: traversal.New(storer),
+			Tags:      tags.NewTags(statestore.NewStateStore(), logger),
+			Logger:    logger,
+			Post:      mockpost.New(mockpost.WithAcceptAll()),
+		})
+		files = []f{
+			{
+				data: []byte("<h1>Penguin"),
+				name: "index.html",
+				dir:  "",
+			},
+			{
+				data: []byte("body { color: blue }"),
+				name: "style.css",
+				dir:  "css",
+			},
+			{
+				data: []byte("first file"),
+				name: "file.txt",
+				dir:  "docs/nested",
+			},
+		}
+		wantContentTypes = map[string]string{
+			"index.html":           "text/html; charset=utf-8",
+			"css/style.css":        "text/css; charset=utf-8",
+			"docs/nested/file.txt": "text/plain; charset=utf-8",
+		}
+	)
+
+	upload := func(t *testing.T, body io.Reader) penguin.Address {
+		t.Helper()
+
+		var resp api.PenUploadResponse
+		jsonhttptest.Request(t, client, http.MethodPost, "/pen", http.StatusCreated,
+			jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+			jsonhttptest.WithRequestBody(body),
+			jsonhttptest.WithRequestHeader(api.PenguinCollectionHeader, "True"),
+			jsonhttptest.WithRequestHeader("Content-Type", api.ContentTypeTar),
+			jsonhttptest.WithUnmarshalJSONResponse(&resp),
+		)
+		return resp.Reference
+	}
+
+	reference := upload(t, tarFiles(t, files))
+
+	t.Run("tar", func(t *testing.T) {
+		var body []byte
+		header := jsonhttptest.Request(t, client, http.MethodGet, "/pen/"+reference.String()+"?format=tar", http.StatusOK,
+			jsonhttptest.WithPutResponseBody(&body),
+		)
+		if got := header.Get("Content-Type"); got != api.ContentTypeTar {
+			t.Fatalf("got content type %q, want %q", got, api.ContentTypeTar)
+		}
+
+		var paths []string
+		tr := tar.NewReader(bytes.NewReader(body))
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, hdr.Name)
+
+			want, ok := wantContentTypes[hdr.Name]
+			if !ok {
+				t.Fatalf("unexpected archive entry %q", hdr.Name)
+			}
+			if got := hdr.PAXRecords["PENGUIN.content-type"]; got != want {
+				t.Errorf("entry %q: got content type %q, want %q", hdr.Name, got, want)
+			}
+			for _, file := range files {
+				if path.Join(file.dir, file.name) == hdr.Name && !bytes.Equal(data, file.data) {
+					t.Errorf("entry %q: data mismatch", hdr.Name)
+				}
+			}
+		}
+		if want := []string{"css/style.css", "docs/nested/file.txt", "index.html"}; fmt.Sprint(paths) != fmt.Sprint(want) {
+			t.Fatalf("got paths %v, want %v", paths, want)
+		}
+
+		if got := upload(t, bytes.NewReader(body)); !got.Equal(reference) {
+			t.Fatalf("reupload of exported archive: got reference %s, want %s", got, reference)
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		var body []byte
+		jsonhttptest.Request(t, client, http.MethodGet, "/pen/"+reference.String()+"?format=zip", http.StatusOK,
+			jsonhttptest.WithPutResponseBody(&body),
+		)
+
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(zr.File) != len(files) {
+			t.Fatalf("got %d zip entries, want %d", len(zr.File), len(files))
+		}
+		for _, zf := range zr.File {
+			want, ok := wantContentTypes[zf.Name]
+			if !ok {
+				t.Fatalf("unexpected archive entry %q", zf.Name)
+			}
+			if zf.Comment != want {
+				t.Errorf("entry %q: got content type %q, want %q", zf.Name, zf.Comment, want)
+			}
+		}
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		jsonhttptest.Request(t, client, http.MethodGet, "/pen/"+reference.String()+"?format=rar", http.StatusBadRequest,
+			jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
+				Message: "invalid archive format",
+				Code:    http.StatusBadRequest,
+			}),
+		)
+	})
+}
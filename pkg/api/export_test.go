@@ -20,6 +20,16 @@ type (
 	PostageCreateResponse = postageCreateResponse
 	PostageStampResponse  = postageStampResponse
 	PostageStampsResponse = postageStampsResponse
+	ManifestListResponse  = manifestListResponse
+	ManifestListEntry     = manifestListEntry
+	ManifestDirResponse   = manifestDirectoryResponse
+	ManifestDirEntry      = manifestDirectoryEntry
+	GranteesPostRequest   = granteesPostRequest
+	GranteesPatchRequest  = granteesPatchRequest
+	GranteesResponse      = granteesResponse
+	PinResponse           = pinResponse
+	ListPinsResponse      = listPinsResponse
+	PinVerification       = pinVerificationResponse
 )
 
 var (
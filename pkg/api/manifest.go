@@ -0,0 +1,418 @@
+// Copyright 2020 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/penguintop/penguin/pkg/accounting"
+	"github.com/penguintop/penguin/pkg/file/loadsave"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/manifest"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/sctx"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/penguintop/penguin/pkg/tracing"
+)
+
+var errInvalidManifestPath = errors.New("invalid manifest path")
+
+type manifestListEntry struct {
+	Path      string            `json:"path"`
+	Reference penguin.Address   `json:"reference"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+type manifestListResponse struct {
+	Entries []manifestListEntry `json:"entries"`
+}
+
+const (
+	manifestDirectoryEntryFile      = "file"
+	manifestDirectoryEntryDirectory = "directory"
+)
+
+type manifestDirectoryEntry struct {
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	Reference *penguin.Address  `json:"reference,omitempty"`
+	Size      int64             `json:"size,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+type manifestDirectoryResponse struct {
+	Path    string                   `json:"path"`
+	Entries []manifestDirectoryEntry `json:"entries"`
+}
+
+// manifestUpdateFunc changes the manifest loaded from an existing reference.
+// The storer is the one that new content has to be stored with.
+type manifestUpdateFunc func(ctx context.Context, m manifest.Interface, storer storage.Storer) error
+
+// penPutHandler stores the request body as a file and adds it to the
+// manifest on the requested path, returning the reference of the new
+// manifest.
+func (s *server) penPutHandler(w http.ResponseWriter, r *http.Request) {
+	pathVar := mux.Vars(r)["path"]
+	if pathVar == "" || strings.HasSuffix(pathVar, "/") {
+		jsonhttp.BadRequest(w, errInvalidManifestPath)
+		return
+	}
+
+	contentType := r.Header.Get(contentTypeHeader)
+	s.updateManifest(w, r, "pen put", func(ctx context.Context, m manifest.Interface, storer storage.Storer) error {
+		body := &countingReader{r: r.Body}
+		fr, err := requestPipelineFn(storer, r)(ctx, body)
+		if err != nil {
+			return fmt.Errorf("store file: %w", err)
+		}
+
+		fileMtdt := map[string]string{
+			manifest.EntryMetadataFilenameKey: path.Base(pathVar),
+			manifest.EntryMetadataSizeKey:     strconv.FormatInt(body.n, 10),
+		}
+		if contentType != "" {
+			fileMtdt[manifest.EntryMetadataContentTypeKey] = contentType
+		}
+		return m.Add(ctx, pathVar, manifest.NewEntry(fr, fileMtdt))
+	})
+}
+
+// penDeleteHandler removes the entry on the requested path from the manifest,
+// returning the reference of the new manifest.
+func (s *server) penDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	pathVar := mux.Vars(r)["path"]
+	if pathVar == "" {
+		jsonhttp.BadRequest(w, errInvalidManifestPath)
+		return
+	}
+
+	s.updateManifest(w, r, "pen delete", func(ctx context.Context, m manifest.Interface, _ storage.Storer) error {
+		if !strings.HasSuffix(pathVar, "/") {
+			return m.Remove(ctx, pathVar)
+		}
+
+		// remove all entries below the directory path
+		var paths []string
+		err := m.IterateEntries(ctx, pathVar, func(p string, _ manifest.Entry) error {
+			paths = append(paths, p)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return manifest.ErrNotFound
+		}
+		for _, p := range paths {
+			if err := m.Remove(ctx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// penPostHandler moves or copies the entry on the requested path to the path
+// given by the move or copy query parameter, returning the reference of the
+// new manifest.
+func (s *server) penPostHandler(w http.ResponseWriter, r *http.Request) {
+	pathVar := mux.Vars(r)["path"]
+	moveTo, copyTo := r.URL.Query().Get("move"), r.URL.Query().Get("copy")
+	if pathVar == "" || (moveTo == "") == (copyTo == "") {
+		jsonhttp.BadRequest(w, errInvalidManifestPath)
+		return
+	}
+
+	s.updateManifest(w, r, "pen post", func(ctx context.Context, m manifest.Interface, _ storage.Storer) error {
+		if moveTo != "" {
+			return manifest.Move(ctx, m, pathVar, strings.TrimLeft(moveTo, "/"))
+		}
+		return manifest.Copy(ctx, m, pathVar, strings.TrimLeft(copyTo, "/"))
+	})
+}
+
+// updateManifest loads the manifest on the requested address, applies the
+// update and stores only the changed manifest nodes. The reference of the
+// new manifest is returned in the response.
+func (s *server) updateManifest(w http.ResponseWriter, r *http.Request, name string, updateFn manifestUpdateFunc) {
+	logger := tracing.NewLoggerWithTraceID(r.Context(), s.logger)
+
+	nameOrHex := mux.Vars(r)["address"]
+	address, err := s.resolveNameOrAddress(nameOrHex)
+	if err != nil {
+		logger.Debugf("%s: parse address %s: %v", name, nameOrHex, err)
+		logger.Errorf("%s: parse address", name)
+		jsonhttp.NotFound(w, nil)
+		return
+	}
+
+	batch, err := requestPostageBatchId(r)
+	if err != nil {
+		logger.Debugf("%s: postage batch id: %v", name, err)
+		logger.Errorf("%s: postage batch id", name)
+		jsonhttp.BadRequest(w, errInvalidPostageBatch)
+		return
+	}
+
+	putter, err := newStamperPutter(s.storer, s.post, s.signer, batch)
+	if err != nil {
+		logger.Debugf("%s: putter: %v", name, err)
+		logger.Errorf("%s: putter", name)
+		jsonhttp.BadRequest(w, nil)
+		return
+	}
+
+	tag, created, err := s.getOrCreateTag(r.Header.Get(PenguinTagHeader), accounting.GetClient(r.Context()))
+	if err != nil {
+		logger.Debugf("%s: get or create tag: %v", name, err)
+		logger.Errorf("%s: get or create tag", name)
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+	ctx := sctx.SetTag(r.Context(), tag)
+
+	// new manifest nodes are encrypted in the same way as the existing ones
+	encrypt := len(address.Bytes()) > penguin.HashSize
+	ls := loadsave.New(putter, requestModePut(r), encrypt)
+	m, err := manifest.NewDefaultManifestReference(address, ls)
+	if err != nil {
+		logger.Debugf("%s: not manifest %s: %v", name, address, err)
+		logger.Errorf("%s: not manifest", name)
+		jsonhttp.NotFound(w, nil)
+		return
+	}
+
+	if err := updateFn(ctx, m, putter); err != nil {
+		logger.Debugf("%s: update manifest %s: %v", name, address, err)
+		logger.Errorf("%s: update manifest", name)
+		if errors.Is(err, manifest.ErrNotFound) || errors.Is(err, storage.ErrNotFound) {
+			jsonhttp.NotFound(w, nil)
+			return
+		}
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+
+	reference, err := m.Store(ctx)
+	if err != nil {
+		logger.Debugf("%s: store manifest %s: %v", name, address, err)
+		logger.Errorf("%s: store manifest", name)
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+
+	if created {
+		if _, err := tag.DoneSplit(reference); err != nil {
+			logger.Debugf("%s: done split: %v", name, err)
+			logger.Errorf("%s: done split failed", name)
+			jsonhttp.InternalServerError(w, nil)
+			return
+		}
+	}
+
+	if strings.ToLower(r.Header.Get(PenguinPinHeader)) == "true" {
+		if err := s.pinning.CreatePin(ctx, reference, false); err != nil {
+			logger.Debugf("%s: creation of pin for %q failed: %v", name, reference, err)
+			logger.Errorf("%s: creation of pin failed", name)
+			jsonhttp.InternalServerError(w, nil)
+			return
+		}
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf("%q", reference.String()))
+	w.Header().Set(PenguinTagHeader, fmt.Sprint(tag.Uid))
+	w.Header().Set("Access-Control-Expose-Headers", PenguinTagHeader)
+	jsonhttp.OK(w, penUploadResponse{
+		Reference: reference,
+	})
+}
+
+// manifestListHandler lists all entries of the manifest below the requested
+// path prefix in path order. Only the fork of the prefix is walked.
+func (s *server) manifestListHandler(w http.ResponseWriter, r *http.Request, m manifest.Interface, prefix string) {
+	logger := tracing.NewLoggerWithTraceID(r.Context(), s.logger)
+
+	entries := make([]manifestListEntry, 0)
+	err := m.IterateEntries(r.Context(), prefix, func(p string, e manifest.Entry) error {
+		entries = append(entries, manifestListEntry{
+			Path:      p,
+			Reference: e.Reference(),
+			Metadata:  e.Metadata(),
+		})
+		return nil
+	})
+	if err != nil {
+		logger.Debugf("pen list: iterate entries %q: %v", prefix, err)
+		logger.Error("pen list: iterate entries")
+		if errors.Is(err, manifest.ErrNotFound) {
+			jsonhttp.NotFound(w, "path address not found")
+			return
+		}
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+
+	jsonhttp.OK(w, manifestListResponse{
+		Entries: entries,
+	})
+}
+
+// manifestDirectoryHandler lists the immediate children of the requested
+// directory path. Files are listed with their reference, size and metadata,
+// while subdirectories are listed only by name.
+func (s *server) manifestDirectoryHandler(w http.ResponseWriter, r *http.Request, m manifest.Interface, dir string) {
+	logger := tracing.NewLoggerWithTraceID(r.Context(), s.logger)
+
+	dir = directoryPath(dir)
+	entries, err := s.manifestDirectory(r.Context(), m, dir)
+	if err != nil {
+		logger.Debugf("pen directory: list %q: %v", dir, err)
+		logger.Error("pen directory: list")
+		if errors.Is(err, manifest.ErrNotFound) {
+			jsonhttp.NotFound(w, "path address not found")
+			return
+		}
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+
+	jsonhttp.OK(w, manifestDirectoryResponse{
+		Path:    dir,
+		Entries: entries,
+	})
+}
+
+// manifestDirectory returns the immediate children of the directory path,
+// with subdirectories sorted before files. Only the fork of the directory is
+// loaded and the file sizes are taken from the entry metadata, files
+// uploaded without it are listed without a size. The manifest.ErrNotFound
+// error is returned if there are no entries below a non-root directory.
+func (s *server) manifestDirectory(ctx context.Context, m manifest.Interface, dir string) ([]manifestDirectoryEntry, error) {
+	var dirs, files []manifestDirectoryEntry
+	err := m.IterateDirectory(ctx, dir, func(name string, e manifest.Entry) error {
+		if e == nil {
+			dirs = append(dirs, manifestDirectoryEntry{
+				Name: name,
+				Type: manifestDirectoryEntryDirectory,
+			})
+			return nil
+		}
+		ref := e.Reference()
+		entry := manifestDirectoryEntry{
+			Name:      name,
+			Type:      manifestDirectoryEntryFile,
+			Reference: &ref,
+			Metadata:  e.Metadata(),
+		}
+		if v, ok := e.Metadata()[manifest.EntryMetadataSizeKey]; ok {
+			size, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("file %s: invalid size %q: %w", name, v, err)
+			}
+			entry.Size = size
+		}
+		files = append(files, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" && len(dirs) == 0 && len(files) == 0 {
+		return nil, manifest.ErrNotFound
+	}
+
+	entries := make([]manifestDirectoryEntry, 0, len(dirs)+len(files))
+	entries = append(entries, dirs...)
+	return append(entries, files...), nil
+}
+
+// directoryPath returns the manifest path with a trailing separator, as all
+// entries of a directory share it as the prefix.
+func directoryPath(p string) string {
+	if p == "" || strings.HasSuffix(p, "/") {
+		return p
+	}
+	return p + "/"
+}
+
+var directoryIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of /{{.Path}}</title>
+</head>
+<body>
+<h1>Index of /{{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Type</th><th>Reference</th></tr>
+{{- if .Path}}
+<tr><td><a href="../">../</a></td><td></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+<tr><td><a href="{{.Name}}">{{.Name}}</a></td><td>{{if .Reference}}{{.Size}}{{else}}-{{end}}</td><td>{{index .Metadata "Content-Type"}}</td><td>{{with .Reference}}{{.}}{{end}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// serveDirectoryIndex writes an automatically generated HTML index page of
+// the directory. It returns false if the directory has no entries, so that
+// the caller can respond with an error.
+func (s *server) serveDirectoryIndex(w http.ResponseWriter, r *http.Request, m manifest.Interface, dir string) bool {
+	logger := tracing.NewLoggerWithTraceID(r.Context(), s.logger)
+
+	entries, err := s.manifestDirectory(r.Context(), m, dir)
+	if err != nil || len(entries) == 0 {
+		logger.Debugf("pen download: directory index %q: %v", dir, err)
+		return false
+	}
+
+	var buf bytes.Buffer
+	if err := directoryIndexTemplate.Execute(&buf, manifestDirectoryResponse{
+		Path:    dir,
+		Entries: entries,
+	}); err != nil {
+		logger.Debugf("pen download: directory index %q: %v", dir, err)
+		return false
+	}
+
+	w.Header().Set(contentTypeHeader, "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", fmt.Sprint(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+	return true
+}
+
+// acceptsHTML reports whether the client, usually a web browser, asks for
+// an HTML response.
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// countingReader counts the bytes read from the underlying reader, so that
+// the size of an uploaded file can be stored in its manifest entry.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/api"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/jsonhttp/jsonhttptest"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	mockpost "github.com/penguintop/penguin/pkg/postage/mock"
+	statestore "github.com/penguintop/penguin/pkg/statestore/mock"
+	"github.com/penguintop/penguin/pkg/storage/mock"
+	"github.com/penguintop/penguin/pkg/tags"
+)
+
+// TestManifestUpdate tests that entries of an uploaded collection can be
+// added, removed, moved and copied, each change resulting in a new manifest.
+func TestManifestUpdate(t *testing.T) {
+	var (
+		logger       = logging.New(ioutil.Discard, 0)
+		client, _, _ = newTestServer(t, testServerOptions{
+			Storer: mock.NewStorer(),
+			Tags:   tags.NewTags(statestore.NewStateStore(), logger),
+			Logger: logger,
+			Post:   mockpost.New(mockpost.WithAcceptAll()),
+		})
+		indexData = []byte("<h1>Penguin")
+		imgData   = []byte("not really a png")
+		newData   = []byte("new file")
+	)
+
+	var upload api.PenUploadResponse
+	jsonhttptest.Request(t, client, http.MethodPost, "/pen", http.StatusCreated,
+		jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+		jsonhttptest.WithRequestBody(tarFiles(t, []f{
+			{data: indexData, name: "index.html"},
+			{data: imgData, name: "1.png", dir: "img"},
+		})),
+		jsonhttptest.WithRequestHeader(api.PenguinCollectionHeader, "True"),
+		jsonhttptest.WithRequestHeader("Content-Type", api.ContentTypeTar),
+		jsonhttptest.WithUnmarshalJSONResponse(&upload),
+	)
+
+	update := func(t *testing.T, method, url string, body []byte) penguin.Address {
+		t.Helper()
+
+		var resp api.PenUploadResponse
+		jsonhttptest.Request(t, client, method, url, http.StatusOK,
+			jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+			jsonhttptest.WithRequestHeader("Content-Type", "text/plain"),
+			jsonhttptest.WithRequestBody(bytes.NewReader(body)),
+			jsonhttptest.WithUnmarshalJSONResponse(&resp),
+		)
+		return resp.Reference
+	}
+	download := func(t *testing.T, reference penguin.Address, path string, status int, data []byte) {
+		t.Helper()
+
+		opts := []jsonhttptest.Option{}
+		if data != nil {
+			opts = append(opts, jsonhttptest.WithExpectedResponse(data))
+		}
+		jsonhttptest.Request(t, client, http.MethodGet, "/pen/"+reference.String()+"/"+path, status, opts...)
+	}
+
+	t.Run("add", func(t *testing.T) {
+		reference := update(t, http.MethodPut, "/pen/"+upload.Reference.String()+"/docs/new.txt", newData)
+		if reference.Equal(upload.Reference) {
+			t.Fatal("manifest reference not changed")
+		}
+		download(t, reference, "docs/new.txt", http.StatusOK, newData)
+		download(t, reference, "index.html", http.StatusOK, indexData)
+		download(t, reference, "img/1.png", http.StatusOK, imgData)
+		// the original manifest is unchanged
+		download(t, upload.Reference, "docs/new.txt", http.StatusNotFound, nil)
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		reference := update(t, http.MethodDelete, "/pen/"+upload.Reference.String()+"/img/1.png", nil)
+		download(t, reference, "img/1.png", http.StatusNotFound, nil)
+		download(t, reference, "index.html", http.StatusOK, indexData)
+	})
+
+	t.Run("remove directory", func(t *testing.T) {
+		reference := update(t, http.MethodDelete, "/pen/"+upload.Reference.String()+"/img/", nil)
+		download(t, reference, "img/1.png", http.StatusNotFound, nil)
+		download(t, reference, "index.html", http.StatusOK, indexData)
+	})
+
+	t.Run("move", func(t *testing.T) {
+		reference := update(t, http.MethodPost, "/pen/"+upload.Reference.String()+"/img/1.png?move=images/one.png", nil)
+		download(t, reference, "img/1.png", http.StatusNotFound, nil)
+		download(t, reference, "images/one.png", http.StatusOK, imgData)
+	})
+
+	t.Run("copy directory", func(t *testing.T) {
+		reference := update(t, http.MethodPost, "/pen/"+upload.Reference.String()+"/img/?copy=backup/", nil)
+		download(t, reference, "img/1.png", http.StatusOK, imgData)
+		download(t, reference, "backup/1.png", http.StatusOK, imgData)
+
+		var list api.ManifestListResponse
+		jsonhttptest.Request(t, client, http.MethodGet, "/pen/"+reference.String()+"/?list", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&list),
+		)
+		var paths []string
+		for _, e := range list.Entries {
+			paths = append(paths, e.Path)
+		}
+		want := []string{"backup/1.png", "img/1.png", "index.html"}
+		if len(paths) != len(want) {
+			t.Fatalf("got paths %v, want %v", paths, want)
+		}
+		for i := range want {
+			if paths[i] != want[i] {
+				t.Fatalf("got paths %v, want %v", paths, want)
+			}
+		}
+
+		jsonhttptest.Request(t, client, http.MethodGet, "/pen/"+reference.String()+"/backup/?list", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&list),
+		)
+		if len(list.Entries) != 1 || list.Entries[0].Path != "backup/1.png" {
+			t.Fatalf("got entries %v, want only backup/1.png", list.Entries)
+		}
+
+		jsonhttptest.Request(t, client, http.MethodGet, "/pen/"+reference.String()+"/missing/?list", http.StatusNotFound,
+			jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
+				Message: "path address not found",
+				Code:    http.StatusNotFound,
+			}),
+		)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		jsonhttptest.Request(t, client, http.MethodDelete, "/pen/"+upload.Reference.String()+"/missing.txt", http.StatusNotFound,
+			jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+		)
+		jsonhttptest.Request(t, client, http.MethodPost, "/pen/"+upload.Reference.String()+"/missing.txt?move=other.txt", http.StatusNotFound,
+			jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+		)
+	})
+}
+
+// TestManifestDirectory tests that the immediate children of a collection
+// directory are listed, and that browsers get a generated index page only
+// outside of the gateway mode.
+func TestManifestDirectory(t *testing.T) {
+	var (
+		logger     = logging.New(ioutil.Discard, 0)
+		serverOpts = testServerOptions{
+			Storer: mock.NewStorer(),
+			Tags:   tags.NewTags(statestore.NewStateStore(), logger),
+			Logger: logger,
+			Post:   mockpost.New(mockpost.WithAcceptAll()),
+		}
+		client, _, _ = newTestServer(t, serverOpts)
+		imgData      = []byte("not really a png")
+	)
+
+	var upload api.PenUploadResponse
+	jsonhttptest.Request(t, client, http.MethodPost, "/pen", http.StatusCreated,
+		jsonhttptest.WithRequestHeader(api.PenguinPostageBatchIdHeader, batchOkStr),
+		jsonhttptest.WithRequestBody(tarFiles(t, []f{
+			{data: []byte("readme"), name: "README.md"},
+			{data: imgData, name: "1.png", dir: "img"},
+			{data: []byte("thumbnail"), name: "1.png", dir: "img/thumbs"},
+		})),
+		jsonhttptest.WithRequestHeader(api.PenguinCollectionHeader, "True"),
+		jsonhttptest.WithRequestHeader("Content-Type", api.ContentTypeTar),
+		jsonhttptest.WithUnmarshalJSONResponse(&upload),
+	)
+	root := "/pen/" + upload.Reference.String() + "/"
+
+	t.Run("list", func(t *testing.T) {
+		var dir api.ManifestDirResponse
+		jsonhttptest.Request(t, client, http.MethodGet, root+"img?dir", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&dir),
+		)
+		if dir.Path != "img/" {
+			t.Fatalf("got path %q, want %q", dir.Path, "img/")
+		}
+		if len(dir.Entries) != 2 {
+			t.Fatalf("got entries %v, want 2", dir.Entries)
+		}
+		if e := dir.Entries[0]; e.Name != "thumbs/" || e.Type != "directory" || e.Reference != nil {
+			t.Fatalf("got entry %+v, want directory thumbs/", e)
+		}
+		if e := dir.Entries[1]; e.Name != "1.png" || e.Type != "file" || e.Reference == nil || e.Size != int64(len(imgData)) {
+			t.Fatalf("got entry %+v, want file 1.png of size %d", e, len(imgData))
+		}
+
+		jsonhttptest.Request(t, client, http.MethodGet, root+"?dir", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&dir),
+		)
+		if len(dir.Entries) != 2 || dir.Entries[0].Name != "img/" || dir.Entries[1].Name != "README.md" {
+			t.Fatalf("got root entries %v, want img/ and README.md", dir.Entries)
+		}
+
+		jsonhttptest.Request(t, client, http.MethodGet, root+"missing/?dir", http.StatusNotFound)
+	})
+
+	t.Run("index page", func(t *testing.T) {
+		var body []byte
+		header := jsonhttptest.Request(t, client, http.MethodGet, root+"img/", http.StatusOK,
+			jsonhttptest.WithRequestHeader("Accept", "text/html"),
+			jsonhttptest.WithPutResponseBody(&body),
+		)
+		if ct := header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Fatalf("got content type %q, want text/html", ct)
+		}
+		for _, s := range []string{`href="thumbs/"`, `href="1.png"`, `href="../"`} {
+			if !bytes.Contains(body, []byte(s)) {
+				t.Fatalf("index page does not contain %s", s)
+			}
+		}
+
+		// api clients still get the not found response
+		jsonhttptest.Request(t, client, http.MethodGet, root+"img/", http.StatusNotFound)
+	})
+
+	t.Run("gateway mode", func(t *testing.T) {
+		serverOpts.GatewayMode = true
+		client, _, _ := newTestServer(t, serverOpts)
+		jsonhttptest.Request(t, client, http.MethodGet, root+"img/", http.StatusNotFound,
+			jsonhttptest.WithRequestHeader("Accept", "text/html"),
+		)
+	})
+}
@@ -5,17 +5,51 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/penguin"
 	"github.com/penguintop/penguin/pkg/pinning"
 	"github.com/penguintop/penguin/pkg/storage"
-    "github.com/penguintop/penguin/pkg/penguin"
-	"github.com/gorilla/mux"
 )
 
-// pinRootHash pins root hash of given reference. This method is idempotent.
+type pinResponse struct {
+	Reference penguin.Address `json:"reference"`
+	Name      string          `json:"name,omitempty"`
+	Created   time.Time       `json:"created"`
+	Chunks    uint64          `json:"chunks"`
+	Size      uint64          `json:"size"`
+}
+
+type listPinsResponse struct {
+	References []penguin.Address `json:"references"`
+	Pins       []pinResponse     `json:"pins"`
+}
+
+type pinVerificationResponse struct {
+	Reference penguin.Address   `json:"reference"`
+	Chunks    uint64            `json:"chunks"`
+	Size      uint64            `json:"size"`
+	Missing   []penguin.Address `json:"missing"`
+	Complete  bool              `json:"complete"`
+}
+
+func newPinResponse(pin pinning.Pin) pinResponse {
+	return pinResponse{
+		Reference: pin.Reference,
+		Name:      pin.Name,
+		Created:   pin.Created,
+		Chunks:    pin.Chunks,
+		Size:      pin.Size,
+	}
+}
+
+// pinRootHash pins root hash of given reference. This method is idempotent,
+// the optional name query parameter names the pin.
 func (s *server) pinRootHash(w http.ResponseWriter, r *http.Request) {
 	ref, err := penguin.ParseHexAddress(mux.Vars(r)["reference"])
 	if err != nil {
@@ -32,7 +66,11 @@ func (s *server) pinRootHash(w http.ResponseWriter, r *http.Request) {
 		jsonhttp.InternalServerError(w, nil)
 		return
 	}
+	name, hasName := r.URL.Query()["name"]
 	if has {
+		if hasName && !s.setPinName(w, ref, name[0]) {
+			return
+		}
 		jsonhttp.OK(w, nil)
 		return
 	}
@@ -41,16 +79,34 @@ func (s *server) pinRootHash(w http.ResponseWriter, r *http.Request) {
 	case errors.Is(err, storage.ErrNotFound):
 		jsonhttp.NotFound(w, nil)
 		return
+	case errors.Is(err, storage.ErrPinQuotaExceeded):
+		jsonhttp.Forbidden(w, "pin quota exceeded")
+		return
 	case err != nil:
 		s.logger.Debugf("pin root hash: creation of tracking pin for %q failed: %v", ref, err)
 		s.logger.Error("pin root hash: creation of tracking pin failed")
 		jsonhttp.InternalServerError(w, nil)
 		return
 	}
+	if hasName && !s.setPinName(w, ref, name[0]) {
+		return
+	}
 
 	jsonhttp.Created(w, nil)
 }
 
+// setPinName names the pin of the reference and reports
+// whether it succeeded, writing the error response if not.
+func (s *server) setPinName(w http.ResponseWriter, ref penguin.Address, name string) bool {
+	if err := s.pinning.SetPinName(ref, name); err != nil {
+		s.logger.Debugf("pin root hash: naming of pin for %q failed: %v", ref, err)
+		s.logger.Error("pin root hash: naming of pin failed")
+		jsonhttp.InternalServerError(w, nil)
+		return false
+	}
+	return true
+}
+
 // unpinRootHash unpin's an already pinned root hash. This method is idempotent.
 func (s *server) unpinRootHash(w http.ResponseWriter, r *http.Request) {
 	ref, err := penguin.ParseHexAddress(mux.Vars(r)["reference"])
@@ -88,7 +144,7 @@ func (s *server) unpinRootHash(w http.ResponseWriter, r *http.Request) {
 	jsonhttp.OK(w, nil)
 }
 
-// getPinnedRootHash returns back the given reference if its root hash is pinned.
+// getPinnedRootHash returns back the details of the pin of the given reference.
 func (s *server) getPinnedRootHash(w http.ResponseWriter, r *http.Request) {
 	ref, err := penguin.ParseHexAddress(mux.Vars(r)["reference"])
 	if err != nil {
@@ -98,29 +154,25 @@ func (s *server) getPinnedRootHash(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	has, err := s.pinning.HasPin(ref)
-	if err != nil {
-		s.logger.Debugf("pinned root hash: unable to check reference %q in the localstore: %v", ref, err)
-		s.logger.Error("pinned root hash: unable to check reference in the localstore")
-		jsonhttp.InternalServerError(w, nil)
-		return
-	}
-
-	if !has {
+	pin, err := s.pinning.GetPin(ref)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
 		jsonhttp.NotFound(w, nil)
 		return
+	case err != nil:
+		s.logger.Debugf("pinned root hash: unable to get pin for reference %q: %v", ref, err)
+		s.logger.Error("pinned root hash: unable to get pin")
+		jsonhttp.InternalServerError(w, nil)
+		return
 	}
 
-	jsonhttp.OK(w, struct {
-		Reference penguin.Address `json:"reference"`
-	}{
-		Reference: ref,
-	})
+	jsonhttp.OK(w, newPinResponse(*pin))
 }
 
-// listPinnedRootHashes lists all the references of the pinned root hashes.
+// listPinnedRootHashes lists all the references of the pinned root hashes
+// together with the details of their pins.
 func (s *server) listPinnedRootHashes(w http.ResponseWriter, r *http.Request) {
-	pinned, err := s.pinning.Pins()
+	pins, err := s.pinning.ListPins()
 	if err != nil {
 		s.logger.Debugf("list pinned root references: unable to list references: %v", err)
 		s.logger.Error("list pinned root references: unable to list references")
@@ -128,9 +180,58 @@ func (s *server) listPinnedRootHashes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonhttp.OK(w, struct {
-		References []penguin.Address `json:"references"`
-	}{
-		References: pinned,
+	resp := listPinsResponse{
+		References: make([]penguin.Address, 0, len(pins)),
+		Pins:       make([]pinResponse, 0, len(pins)),
+	}
+	for _, pin := range pins {
+		resp.References = append(resp.References, pin.Reference)
+		resp.Pins = append(resp.Pins, newPinResponse(pin))
+	}
+	jsonhttp.OK(w, resp)
+}
+
+// verifyPin reports the chunks of a pinned reference missing from the localstore.
+func (s *server) verifyPin(w http.ResponseWriter, r *http.Request) {
+	s.checkPin(w, r, "verify pin", s.pinning.VerifyPin)
+}
+
+// repairPin retrieves the chunks of a pinned reference missing from the
+// localstore and reports the chunks that are still missing.
+func (s *server) repairPin(w http.ResponseWriter, r *http.Request) {
+	s.checkPin(w, r, "repair pin", s.pinning.RepairPin)
+}
+
+func (s *server) checkPin(w http.ResponseWriter, r *http.Request, op string, check func(context.Context, penguin.Address) (*pinning.Verification, error)) {
+	ref, err := penguin.ParseHexAddress(mux.Vars(r)["reference"])
+	if err != nil {
+		s.logger.Debugf("%s: unable to parse reference %q: %v", op, ref, err)
+		s.logger.Errorf("%s: unable to parse reference", op)
+		jsonhttp.BadRequest(w, "bad reference")
+		return
+	}
+
+	v, err := check(r.Context(), ref)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		jsonhttp.NotFound(w, nil)
+		return
+	case err != nil:
+		s.logger.Debugf("%s: reference %q: %v", op, ref, err)
+		s.logger.Errorf("%s: failed", op)
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+
+	missing := v.Missing
+	if missing == nil {
+		missing = []penguin.Address{}
+	}
+	jsonhttp.OK(w, pinVerificationResponse{
+		Reference: v.Reference,
+		Chunks:    v.Chunks,
+		Size:      v.Size,
+		Missing:   missing,
+		Complete:  v.Complete,
 	})
 }
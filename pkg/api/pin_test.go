@@ -52,21 +52,37 @@ func checkPinHandlers(t *testing.T, client *http.Client, rootHash string) {
 		}),
 	)
 
+	jsonhttptest.Request(t, client, http.MethodPost, pinsReferencePath+"?name=docs", http.StatusOK)
+
+	var pin api.PinResponse
 	jsonhttptest.Request(t, client, http.MethodGet, pinsReferencePath, http.StatusOK,
-		jsonhttptest.WithExpectedJSONResponse(struct {
-			Reference penguin.Address `json:"reference"`
-		}{
-			Reference: penguin.MustParseHexAddress(rootHash),
-		}),
+		jsonhttptest.WithUnmarshalJSONResponse(&pin),
 	)
+	if want := penguin.MustParseHexAddress(rootHash); !pin.Reference.Equal(want) || pin.Name != "docs" || pin.Created.IsZero() {
+		t.Fatalf("got pin %+v, want reference %s named docs", pin, want)
+	}
 
+	var pins api.ListPinsResponse
 	jsonhttptest.Request(t, client, http.MethodGet, pinsBasePath, http.StatusOK,
-		jsonhttptest.WithExpectedJSONResponse(struct {
-			References []penguin.Address `json:"references"`
-		}{
-			References: []penguin.Address{penguin.MustParseHexAddress(rootHash)},
-		}),
+		jsonhttptest.WithUnmarshalJSONResponse(&pins),
 	)
+	if len(pins.References) != 1 || !pins.References[0].Equal(pin.Reference) || len(pins.Pins) != 1 || pins.Pins[0].Name != "docs" {
+		t.Fatalf("got pins %+v, want the pin %s", pins, rootHash)
+	}
+
+	for _, path := range []struct{ method, path string }{
+		{http.MethodGet, pinsReferencePath + "/verify"},
+		{http.MethodPost, pinsReferencePath + "/repair"},
+	} {
+		jsonhttptest.Request(t, client, path.method, path.path, http.StatusOK,
+			jsonhttptest.WithExpectedJSONResponse(api.PinVerification{
+				Reference: penguin.MustParseHexAddress(rootHash),
+				Missing:   []penguin.Address{},
+				Complete:  true,
+			}),
+		)
+	}
+	jsonhttptest.Request(t, client, http.MethodGet, pinsUnknownReferencePath+"/verify", http.StatusNotFound)
 
 	jsonhttptest.Request(t, client, http.MethodDelete, pinsReferencePath, http.StatusOK)
 
@@ -0,0 +1,335 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/pinning/remote"
+)
+
+// remotePinAuthenticate authenticates the owner of the remote pinning request
+// with the bearer token of the authorization header, bound to the reference
+// of the added pin, writing the error response if it is not valid.
+func (s *server) remotePinAuthenticate(w http.ResponseWriter, r *http.Request, ref penguin.Address) (common.Address, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	owner, err := s.remotePinning.Authenticate(token, ref)
+	switch {
+	case errors.Is(err, remote.ErrUnauthorized):
+		s.logger.Debugf("remote pinning: authenticate: %v", err)
+		jsonhttp.Unauthorized(w, nil)
+		return common.Address{}, false
+	case err != nil:
+		s.logger.Debugf("remote pinning: authenticate: %v", err)
+		s.logger.Error("remote pinning: authenticate: failed")
+		jsonhttp.InternalServerError(w, nil)
+		return common.Address{}, false
+	}
+	return owner, true
+}
+
+func (s *server) remotePinListHandler(w http.ResponseWriter, r *http.Request) {
+	owner, ok := s.remotePinAuthenticate(w, r, penguin.ZeroAddress)
+	if !ok {
+		return
+	}
+	f, err := parseRemotePinFilter(r.URL.Query())
+	if err != nil {
+		s.logger.Debugf("remote pinning list: %v", err)
+		jsonhttp.BadRequest(w, err.Error())
+		return
+	}
+	count, results, err := s.remotePinning.List(owner, f)
+	if err != nil {
+		s.logger.Debugf("remote pinning list: %v", err)
+		s.logger.Error("remote pinning list: failed")
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+	if results == nil {
+		results = []remote.PinStatus{}
+	}
+	jsonhttp.OK(w, remote.PinResults{Count: count, Results: results})
+}
+
+func (s *server) remotePinAddHandler(w http.ResponseWriter, r *http.Request) {
+	pin, ok := s.readRemotePin(w, r)
+	if !ok {
+		return
+	}
+	owner, ok := s.remotePinAuthenticate(w, r, pin.Reference)
+	if !ok {
+		return
+	}
+	st, err := s.remotePinning.Add(owner, pin)
+	switch {
+	case errors.Is(err, remote.ErrQuotaExceeded):
+		jsonhttp.Forbidden(w, "pin request quota exceeded")
+		return
+	case err != nil:
+		s.logger.Debugf("remote pinning add: %v", err)
+		s.logger.Error("remote pinning add: failed")
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+	jsonhttp.Accepted(w, st)
+}
+
+func (s *server) remotePinGetHandler(w http.ResponseWriter, r *http.Request) {
+	owner, ok := s.remotePinAuthenticate(w, r, penguin.ZeroAddress)
+	if !ok {
+		return
+	}
+	st, err := s.remotePinning.Get(owner, mux.Vars(r)["requestid"])
+	switch {
+	case errors.Is(err, remote.ErrNotFound):
+		jsonhttp.NotFound(w, nil)
+		return
+	case err != nil:
+		s.logger.Debugf("remote pinning get: %v", err)
+		s.logger.Error("remote pinning get: failed")
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+	jsonhttp.OK(w, st)
+}
+
+func (s *server) remotePinReplaceHandler(w http.ResponseWriter, r *http.Request) {
+	pin, ok := s.readRemotePin(w, r)
+	if !ok {
+		return
+	}
+	owner, ok := s.remotePinAuthenticate(w, r, pin.Reference)
+	if !ok {
+		return
+	}
+	st, err := s.remotePinning.Replace(r.Context(), owner, mux.Vars(r)["requestid"], pin)
+	switch {
+	case errors.Is(err, remote.ErrNotFound):
+		jsonhttp.NotFound(w, nil)
+		return
+	case errors.Is(err, remote.ErrQuotaExceeded):
+		jsonhttp.Forbidden(w, "pin request quota exceeded")
+		return
+	case err != nil:
+		s.logger.Debugf("remote pinning replace: %v", err)
+		s.logger.Error("remote pinning replace: failed")
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+	jsonhttp.Accepted(w, st)
+}
+
+func (s *server) remotePinRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	owner, ok := s.remotePinAuthenticate(w, r, penguin.ZeroAddress)
+	if !ok {
+		return
+	}
+	err := s.remotePinning.Remove(r.Context(), owner, mux.Vars(r)["requestid"])
+	switch {
+	case errors.Is(err, remote.ErrNotFound):
+		jsonhttp.NotFound(w, nil)
+		return
+	case err != nil:
+		s.logger.Debugf("remote pinning remove: %v", err)
+		s.logger.Error("remote pinning remove: failed")
+		jsonhttp.InternalServerError(w, nil)
+		return
+	}
+	jsonhttp.Accepted(w, nil)
+}
+
+// readRemotePin reads the pin of the request body,
+// writing the error response if it is not valid.
+func (s *server) readRemotePin(w http.ResponseWriter, r *http.Request) (remote.Pin, bool) {
+	var pin remote.Pin
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &pin)
+	}
+	if err == nil && pin.Reference.IsZero() {
+		err = remote.ErrInvalidPin
+	}
+	if err != nil {
+		s.logger.Debugf("remote pinning: read pin: %v", err)
+		jsonhttp.BadRequest(w, remote.ErrInvalidPin.Error())
+		return remote.Pin{}, false
+	}
+	return pin, true
+}
+
+// parseRemotePinFilter parses the query parameters of the pin request
+// listing as defined by the IPFS Pinning Services API.
+func parseRemotePinFilter(q url.Values) (f remote.Filter, err error) {
+	if v := q.Get("cid"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			ref, err := penguin.ParseHexAddress(s)
+			if err != nil {
+				return remote.Filter{}, fmt.Errorf("invalid cid %q", s)
+			}
+			f.References = append(f.References, ref)
+		}
+	}
+	f.Name = q.Get("name")
+	if v := q.Get("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			st, err := remote.ParseStatus(s)
+			if err != nil {
+				return remote.Filter{}, err
+			}
+			f.Statuses = append(f.Statuses, st)
+		}
+	}
+	if v := q.Get("before"); v != "" {
+		if f.Before, err = time.Parse(time.RFC3339, v); err != nil {
+			return remote.Filter{}, fmt.Errorf("invalid before %q", v)
+		}
+	}
+	if v := q.Get("after"); v != "" {
+		if f.After, err = time.Parse(time.RFC3339, v); err != nil {
+			return remote.Filter{}, fmt.Errorf("invalid after %q", v)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > remote.MaxListLimit {
+			return remote.Filter{}, fmt.Errorf("invalid limit %q", v)
+		}
+	}
+	return f, nil
+}
+
+// remotePinFilterValues encodes the filter as the query
+// parameters parsed by parseRemotePinFilter.
+func remotePinFilterValues(f remote.Filter) url.Values {
+	q := make(url.Values)
+	if len(f.References) > 0 {
+		refs := make([]string, 0, len(f.References))
+		for _, ref := range f.References {
+			refs = append(refs, ref.String())
+		}
+		q.Set("cid", strings.Join(refs, ","))
+	}
+	if f.Name != "" {
+		q.Set("name", f.Name)
+	}
+	if len(f.Statuses) > 0 {
+		statuses := make([]string, 0, len(f.Statuses))
+		for _, st := range f.Statuses {
+			statuses = append(statuses, string(st))
+		}
+		q.Set("status", strings.Join(statuses, ","))
+	}
+	if !f.Before.IsZero() {
+		q.Set("before", f.Before.UTC().Format(time.RFC3339))
+	}
+	if !f.After.IsZero() {
+		q.Set("after", f.After.UTC().Format(time.RFC3339))
+	}
+	if f.Limit > 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+	return q
+}
+
+// remotePinDelegateHandler asks the remote pinning service of the endpoint
+// query parameter, served by the node of the overlay query parameter, to pin
+// the reference on behalf of the node.
+func (s *server) remotePinDelegateHandler(w http.ResponseWriter, r *http.Request) {
+	ref, client, ok := s.remotePinClient(w, r)
+	if !ok {
+		return
+	}
+	st, err := client.Add(r.Context(), remote.Pin{Reference: ref, Name: r.URL.Query().Get("name")})
+	if err != nil {
+		s.remotePinClientError(w, "remote pinning delegate", err)
+		return
+	}
+	jsonhttp.Accepted(w, st)
+}
+
+// remotePinDelegatedHandler lists the requests of the node to pin the
+// reference at the remote pinning service of the endpoint query parameter,
+// served by the node of the overlay query parameter.
+func (s *server) remotePinDelegatedHandler(w http.ResponseWriter, r *http.Request) {
+	ref, client, ok := s.remotePinClient(w, r)
+	if !ok {
+		return
+	}
+	count, results, err := client.List(r.Context(), remote.Filter{
+		References: []penguin.Address{ref},
+		Statuses:   []remote.Status{remote.StatusQueued, remote.StatusPinning, remote.StatusPinned, remote.StatusFailed},
+	})
+	if err != nil {
+		s.remotePinClientError(w, "remote pinning delegated", err)
+		return
+	}
+	jsonhttp.OK(w, remote.PinResults{Count: count, Results: results})
+}
+
+func (s *server) remotePinClient(w http.ResponseWriter, r *http.Request) (penguin.Address, *RemotePinningClient, bool) {
+	ref, err := penguin.ParseHexAddress(mux.Vars(r)["reference"])
+	if err != nil {
+		s.logger.Debugf("remote pinning: parse reference: %v", err)
+		jsonhttp.BadRequest(w, "bad reference")
+		return penguin.ZeroAddress, nil, false
+	}
+	overlay, err := penguin.ParseHexAddress(r.URL.Query().Get("overlay"))
+	if err != nil || overlay.IsZero() {
+		s.logger.Debugf("remote pinning: parse overlay: %v", err)
+		jsonhttp.BadRequest(w, "bad overlay")
+		return penguin.ZeroAddress, nil, false
+	}
+	client, err := NewRemotePinningClient(r.URL.Query().Get("endpoint"), overlay, s.signer, nil)
+	if err != nil {
+		s.logger.Debugf("remote pinning: endpoint: %v", err)
+		jsonhttp.BadRequest(w, "bad endpoint")
+		return penguin.ZeroAddress, nil, false
+	}
+	if !s.remotePinEndpointAllowed(client.endpoint) {
+		s.logger.Debugf("remote pinning: endpoint %s not allowed", client.endpoint)
+		jsonhttp.Forbidden(w, "remote pinning endpoint not allowed")
+		return penguin.ZeroAddress, nil, false
+	}
+	return ref, client, true
+}
+
+// remotePinEndpointAllowed reports whether the endpoint is one of the
+// configured remote pinning services. The requests to the services are
+// signed with the key of the node, so they are not sent anywhere else.
+func (s *server) remotePinEndpointAllowed(endpoint *url.URL) bool {
+	for _, e := range s.RemotePinningEndpoints {
+		if u, err := parseRemotePinningEndpoint(e); err == nil && u.String() == endpoint.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *server) remotePinClientError(w http.ResponseWriter, op string, err error) {
+	s.logger.Debugf("%s: %v", op, err)
+	s.logger.Errorf("%s: failed", op)
+	switch {
+	case errors.Is(err, remote.ErrUnauthorized):
+		jsonhttp.Forbidden(w, "not authorized by the remote pinning service")
+		return
+	case errors.Is(err, remote.ErrQuotaExceeded):
+		jsonhttp.Forbidden(w, "remote pinning quota exceeded")
+		return
+	}
+	jsonhttp.BadGateway(w, nil)
+}
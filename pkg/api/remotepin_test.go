@@ -0,0 +1,214 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/api"
+	"github.com/penguintop/penguin/pkg/crypto"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/jsonhttp/jsonhttptest"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	pinning "github.com/penguintop/penguin/pkg/pinning/mock"
+	"github.com/penguintop/penguin/pkg/pinning/remote"
+	statestore "github.com/penguintop/penguin/pkg/statestore/mock"
+)
+
+func TestRemotePinning(t *testing.T) {
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(key)
+	owner, err := signer.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ctx         = context.Background()
+		ref         = penguin.MustParseHexAddress("838d0a193ecd1152d1bb1432d5ecc02398533b2494889e23b8bd5ace30ac2aeb")
+		overlay     = penguin.MustParseHexAddress("ca1e9f3938cc1425c6061b96ad9eb93e134dfe8734ad490164ef20af9d1cf59c")
+		pinningMock = pinning.NewServiceMock()
+	)
+	remotePinning, err := remote.New(pinningMock, statestore.NewStateStore(), logging.New(ioutil.Discard, 0), remote.Options{
+		Overlay: overlay,
+		Owners:  []common.Address{owner},
+		Quota:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remotePinning.Close()
+
+	client, _, addr := newTestServer(t, testServerOptions{
+		Pinning:       pinningMock,
+		RemotePinning: remotePinning,
+	})
+	endpoint := "http://" + addr + "/pinning"
+
+	rc, err := api.NewRemotePinningClient(endpoint, overlay, signer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		jsonhttptest.Request(t, client, http.MethodGet, "/pinning/pins", http.StatusUnauthorized)
+		jsonhttptest.Request(t, client, http.MethodGet, "/pinning/pins", http.StatusUnauthorized,
+			jsonhttptest.WithRequestHeader("Authorization", "Bearer invalid"),
+		)
+
+		token, err := remote.NewToken(signer, overlay, penguin.ZeroAddress, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		jsonhttptest.Request(t, client, http.MethodGet, "/pinning/pins", http.StatusOK,
+			jsonhttptest.WithRequestHeader("Authorization", "Bearer "+token),
+		)
+		// tokens are accepted once only
+		jsonhttptest.Request(t, client, http.MethodGet, "/pinning/pins", http.StatusUnauthorized,
+			jsonhttptest.WithRequestHeader("Authorization", "Bearer "+token),
+		)
+		// the token must be bound to the reference of the added pin
+		jsonhttptest.Request(t, client, http.MethodPost, "/pinning/pins", http.StatusUnauthorized,
+			jsonhttptest.WithRequestHeader("Authorization", "Bearer "+token),
+			jsonhttptest.WithJSONRequestBody(remote.Pin{Reference: ref}),
+		)
+
+		// only the configured owners are allowed
+		other, err := crypto.GenerateSecp256k1Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		orc, err := api.NewRemotePinningClient(endpoint, overlay, crypto.NewDefaultSigner(other), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := orc.List(ctx, remote.Filter{}); !errors.Is(err, remote.ErrUnauthorized) {
+			t.Fatalf("got error %v, want %v", err, remote.ErrUnauthorized)
+		}
+		// the tokens are signed for the node
+		wrc, err := api.NewRemotePinningClient(endpoint, ref, signer, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := wrc.List(ctx, remote.Filter{}); !errors.Is(err, remote.ErrUnauthorized) {
+			t.Fatalf("got error %v, want %v", err, remote.ErrUnauthorized)
+		}
+	})
+
+	t.Run("pin and remove", func(t *testing.T) {
+		st, err := rc.Add(ctx, remote.Pin{Reference: ref, Name: "site"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for st.Status != remote.StatusPinned {
+			if time.Now().After(deadline) {
+				t.Fatalf("got status %q, want %q", st.Status, remote.StatusPinned)
+			}
+			time.Sleep(10 * time.Millisecond)
+			if st, err = rc.Get(ctx, st.RequestID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !st.Pin.Reference.Equal(ref) || st.Pin.Name != "site" {
+			t.Fatalf("got pin %+v", st.Pin)
+		}
+		if _, err := rc.Add(ctx, remote.Pin{Reference: ref}); !errors.Is(err, remote.ErrQuotaExceeded) {
+			t.Fatalf("got error %v, want %v", err, remote.ErrQuotaExceeded)
+		}
+
+		count, results, err := rc.List(ctx, remote.Filter{Name: "site"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 || len(results) != 1 || results[0].RequestID != st.RequestID {
+			t.Fatalf("got %d pins %+v, want the request %s", count, results, st.RequestID)
+		}
+
+		if err := rc.Remove(ctx, st.RequestID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rc.Get(ctx, st.RequestID); !errors.Is(err, remote.ErrNotFound) {
+			t.Fatalf("got error %v, want %v", err, remote.ErrNotFound)
+		}
+		if has, _ := pinningMock.HasPin(ref); has {
+			t.Fatal("reference pinned after the removal of the request")
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		if _, err := rc.Add(ctx, remote.Pin{}); !errors.Is(err, remote.ErrInvalidPin) {
+			t.Fatalf("got error %v, want %v", err, remote.ErrInvalidPin)
+		}
+		if _, _, err := rc.List(ctx, remote.Filter{Statuses: []remote.Status{"unknown"}}); err == nil {
+			t.Fatal("expected error listing an unknown status")
+		}
+	})
+
+	t.Run("delegate", func(t *testing.T) {
+		nodeClient, _, _ := newTestServer(t, testServerOptions{Key: key, RemotePinEndpoints: []string{endpoint + "/"}})
+		path := "/pins/" + ref.String() + "/remote?overlay=" + overlay.String() + "&endpoint=" + url.QueryEscape(endpoint)
+
+		var st remote.PinStatus
+		jsonhttptest.Request(t, nodeClient, http.MethodPost, path+"&name=delegated", http.StatusAccepted,
+			jsonhttptest.WithUnmarshalJSONResponse(&st),
+		)
+		if !st.Pin.Reference.Equal(ref) || st.Pin.Name != "delegated" {
+			t.Fatalf("got pin status %+v", st)
+		}
+
+		var res remote.PinResults
+		jsonhttptest.Request(t, nodeClient, http.MethodGet, path, http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&res),
+		)
+		if res.Count != 1 || len(res.Results) != 1 || res.Results[0].RequestID != st.RequestID {
+			t.Fatalf("got pins %+v, want the request %s", res, st.RequestID)
+		}
+
+		jsonhttptest.Request(t, nodeClient, http.MethodPost, "/pins/"+ref.String()+"/remote?overlay="+overlay.String()+"&endpoint=invalid", http.StatusBadRequest)
+		jsonhttptest.Request(t, nodeClient, http.MethodPost, "/pins/"+ref.String()+"/remote?endpoint="+url.QueryEscape(endpoint), http.StatusBadRequest)
+	})
+
+	t.Run("delegate to other endpoint", func(t *testing.T) {
+		forbidden := jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
+			Message: "remote pinning endpoint not allowed",
+			Code:    http.StatusForbidden,
+		})
+
+		// the node signs the requests only for the configured services
+		nodeClient, _, _ := newTestServer(t, testServerOptions{Key: key, RemotePinEndpoints: []string{endpoint}})
+		for _, other := range []string{
+			"http://" + addr + "/other",
+			"http://" + addr,
+			"https://" + addr + "/pinning",
+			"http://example.com/pinning",
+		} {
+			path := "/pins/" + ref.String() + "/remote?overlay=" + overlay.String() + "&endpoint=" + url.QueryEscape(other)
+			jsonhttptest.Request(t, nodeClient, http.MethodPost, path, http.StatusForbidden, forbidden)
+			jsonhttptest.Request(t, nodeClient, http.MethodGet, path, http.StatusForbidden, forbidden)
+		}
+
+		// no delegation without configured services
+		nodeClient, _, _ = newTestServer(t, testServerOptions{Key: key})
+		path := "/pins/" + ref.String() + "/remote?overlay=" + overlay.String() + "&endpoint=" + url.QueryEscape(endpoint)
+		jsonhttptest.Request(t, nodeClient, http.MethodPost, path, http.StatusForbidden, forbidden)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client, _, _ := newTestServer(t, testServerOptions{})
+		jsonhttptest.Request(t, client, http.MethodGet, "/pinning/pins", http.StatusNotFound)
+	})
+}
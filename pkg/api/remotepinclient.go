@@ -0,0 +1,172 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/crypto"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/pinning/remote"
+)
+
+// remotePinTokenTTL is the validity of the tokens of the remote pinning client.
+const remotePinTokenTTL = time.Minute
+
+// RemotePinningClient delegates pins to a remote pinning service,
+// authenticated as the owner of the signer.
+type RemotePinningClient struct {
+	endpoint *url.URL
+	overlay  penguin.Address
+	signer   crypto.Signer
+	client   *http.Client
+}
+
+// NewRemotePinningClient returns the client of the remote pinning service
+// at the endpoint, the url the pins path of the service is relative to,
+// served by the node with the overlay address. The default http client is
+// used if the client is nil.
+func NewRemotePinningClient(endpoint string, overlay penguin.Address, signer crypto.Signer, client *http.Client) (*RemotePinningClient, error) {
+	u, err := parseRemotePinningEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &RemotePinningClient{
+		endpoint: u,
+		overlay:  overlay,
+		signer:   signer,
+		client:   client,
+	}, nil
+}
+
+// parseRemotePinningEndpoint parses the url of a remote
+// pinning service, without the trailing slash of its path.
+func parseRemotePinningEndpoint(endpoint string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid remote pinning endpoint %q", endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u, nil
+}
+
+// Add asks the service to pin.
+func (c *RemotePinningClient) Add(ctx context.Context, pin remote.Pin) (*remote.PinStatus, error) {
+	st := new(remote.PinStatus)
+	if err := c.request(ctx, http.MethodPost, "/pins", nil, &pin, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Get returns the status of the pin request.
+func (c *RemotePinningClient) Get(ctx context.Context, id string) (*remote.PinStatus, error) {
+	st := new(remote.PinStatus)
+	if err := c.request(ctx, http.MethodGet, "/pins/"+url.PathEscape(id), nil, nil, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// List returns the number of the pin requests matching the
+// filter and the most recent of them up to the limit.
+func (c *RemotePinningClient) List(ctx context.Context, f remote.Filter) (int, []remote.PinStatus, error) {
+	var res remote.PinResults
+	if err := c.request(ctx, http.MethodGet, "/pins", remotePinFilterValues(f), nil, &res); err != nil {
+		return 0, nil, err
+	}
+	return res.Count, res.Results, nil
+}
+
+// Replace replaces the pin request with a new one.
+func (c *RemotePinningClient) Replace(ctx context.Context, id string, pin remote.Pin) (*remote.PinStatus, error) {
+	st := new(remote.PinStatus)
+	if err := c.request(ctx, http.MethodPost, "/pins/"+url.PathEscape(id), nil, &pin, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Remove removes the pin request.
+func (c *RemotePinningClient) Remove(ctx context.Context, id string) error {
+	return c.request(ctx, http.MethodDelete, "/pins/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// request sends the request with the pin as the body, if any, authenticated
+// with a new token bound to the reference of the pin.
+func (c *RemotePinningClient) request(ctx context.Context, method, path string, query url.Values, pin *remote.Pin, v interface{}) error {
+	u := *c.endpoint
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	var (
+		r   io.Reader
+		ref = penguin.ZeroAddress
+	)
+	if pin != nil {
+		b, err := json.Marshal(pin)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+		ref = pin.Reference
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return err
+	}
+	token, err := remote.NewToken(c.signer, c.overlay, ref, time.Now().Add(remotePinTokenTTL))
+	if err != nil {
+		return fmt.Errorf("remote pinning token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if pin != nil {
+		req.Header.Set(contentTypeHeader, "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+	case http.StatusUnauthorized:
+		return remote.ErrUnauthorized
+	case http.StatusForbidden:
+		return remote.ErrQuotaExceeded
+	case http.StatusNotFound:
+		return remote.ErrNotFound
+	case http.StatusBadRequest:
+		return remote.ErrInvalidPin
+	default:
+		return fmt.Errorf("remote pinning %s %s: unexpected status %s", method, path, resp.Status)
+	}
+	if v == nil {
+		_, err := io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.New("remote pinning: invalid response")
+	}
+	return nil
+}
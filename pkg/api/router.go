@@ -46,12 +46,15 @@ func (s *server) setupRouting() {
 	handle("/bytes", jsonhttp.MethodHandler{
 		"POST": web.ChainHandlers(
 			s.newTracingHandler("bytes-upload"),
+			s.budgetHandler,
 			web.FinalHandlerFunc(s.bytesUploadHandler),
 		),
 	})
 	handle("/bytes/{address}", jsonhttp.MethodHandler{
 		"GET": web.ChainHandlers(
 			s.newTracingHandler("bytes-download"),
+			s.budgetHandler,
+			s.actDecryptionHandler,
 			web.FinalHandlerFunc(s.bytesGetHandler),
 		),
 	})
@@ -59,25 +62,34 @@ func (s *server) setupRouting() {
 	handle("/chunks", jsonhttp.MethodHandler{
 		"POST": web.ChainHandlers(
 			jsonhttp.NewMaxBodyBytesHandler(penguin.ChunkWithSpanSize),
+			s.budgetHandler,
 			web.FinalHandlerFunc(s.chunkUploadHandler),
 		),
 	})
 
 	handle("/chunks/{addr}", jsonhttp.MethodHandler{
-		"GET": http.HandlerFunc(s.chunkGetHandler),
+		"GET": web.ChainHandlers(
+			s.budgetHandler,
+			web.FinalHandlerFunc(s.chunkGetHandler),
+		),
 	})
 
 	handle("/soc/{owner}/{id}", jsonhttp.MethodHandler{
 		"POST": web.ChainHandlers(
 			jsonhttp.NewMaxBodyBytesHandler(penguin.ChunkWithSpanSize),
+			s.budgetHandler,
 			web.FinalHandlerFunc(s.socUploadHandler),
 		),
 	})
 
 	handle("/feeds/{owner}/{topic}", jsonhttp.MethodHandler{
-		"GET": http.HandlerFunc(s.feedGetHandler),
+		"GET": web.ChainHandlers(
+			s.budgetHandler,
+			web.FinalHandlerFunc(s.feedGetHandler),
+		),
 		"POST": web.ChainHandlers(
 			jsonhttp.NewMaxBodyBytesHandler(penguin.ChunkWithSpanSize),
+			s.budgetHandler,
 			web.FinalHandlerFunc(s.feedPostHandler),
 		),
 	})
@@ -85,10 +97,21 @@ func (s *server) setupRouting() {
 	handle("/pen", jsonhttp.MethodHandler{
 		"POST": web.ChainHandlers(
 			s.newTracingHandler("pen-upload"),
+			s.budgetHandler,
 			web.FinalHandlerFunc(s.penUploadHandler),
 		),
 	})
 	handle("/pen/{address}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Query().Get("format") != "" {
+			// collection archive download
+			web.ChainHandlers(
+				s.newTracingHandler("pen-download-dir"),
+				s.budgetHandler,
+				s.actDecryptionHandler,
+				web.FinalHandlerFunc(s.penDownloadHandler),
+			).ServeHTTP(w, r)
+			return
+		}
 		u := r.URL
 		u.Path += "/"
 		http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
@@ -96,14 +119,52 @@ func (s *server) setupRouting() {
 	handle("/pen/{address}/{path:.*}", jsonhttp.MethodHandler{
 		"GET": web.ChainHandlers(
 			s.newTracingHandler("pen-download"),
+			s.budgetHandler,
+			s.actDecryptionHandler,
 			web.FinalHandlerFunc(s.penDownloadHandler),
 		),
 		"PATCH": web.ChainHandlers(
 			s.newTracingHandler("pen-patch"),
+			s.budgetHandler,
 			web.FinalHandlerFunc(s.penPatchHandler),
 		),
+		"PUT": web.ChainHandlers(
+			s.newTracingHandler("pen-put"),
+			s.budgetHandler,
+			web.FinalHandlerFunc(s.penPutHandler),
+		),
+		"POST": web.ChainHandlers(
+			s.newTracingHandler("pen-post"),
+			s.budgetHandler,
+			web.FinalHandlerFunc(s.penPostHandler),
+		),
+		"DELETE": web.ChainHandlers(
+			s.newTracingHandler("pen-delete"),
+			s.budgetHandler,
+			web.FinalHandlerFunc(s.penDeleteHandler),
+		),
 	})
 
+	handle("/grantee", web.ChainHandlers(
+		s.gatewayModeForbidEndpointHandler,
+		web.FinalHandler(jsonhttp.MethodHandler{
+			"POST": web.ChainHandlers(
+				jsonhttp.NewMaxBodyBytesHandler(penguin.ChunkSize),
+				web.FinalHandlerFunc(s.granteesPostHandler),
+			),
+		})),
+	)
+	handle("/grantee/{address}", web.ChainHandlers(
+		s.gatewayModeForbidEndpointHandler,
+		web.FinalHandler(jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.granteesGetHandler),
+			"PATCH": web.ChainHandlers(
+				jsonhttp.NewMaxBodyBytesHandler(penguin.ChunkSize),
+				web.FinalHandlerFunc(s.granteesPatchHandler),
+			),
+		})),
+	)
+
 	handle("/pss/send/{topic}/{targets}", web.ChainHandlers(
 		s.gatewayModeForbidEndpointHandler,
 		web.FinalHandler(jsonhttp.MethodHandler{
@@ -155,6 +216,38 @@ func (s *server) setupRouting() {
 			"DELETE": http.HandlerFunc(s.unpinRootHash),
 		})),
 	)
+	handle("/pins/{reference}/verify", web.ChainHandlers(
+		s.gatewayModeForbidEndpointHandler,
+		web.FinalHandler(jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.verifyPin),
+		})),
+	)
+	handle("/pins/{reference}/repair", web.ChainHandlers(
+		s.gatewayModeForbidEndpointHandler,
+		web.FinalHandler(jsonhttp.MethodHandler{
+			"POST": http.HandlerFunc(s.repairPin),
+		})),
+	)
+
+	handle("/pins/{reference}/remote", web.ChainHandlers(
+		s.gatewayModeForbidEndpointHandler,
+		web.FinalHandler(jsonhttp.MethodHandler{
+			"GET":  http.HandlerFunc(s.remotePinDelegatedHandler),
+			"POST": http.HandlerFunc(s.remotePinDelegateHandler),
+		})),
+	)
+
+	if s.remotePinning != nil {
+		handle("/pinning/pins", jsonhttp.MethodHandler{
+			"GET":  http.HandlerFunc(s.remotePinListHandler),
+			"POST": http.HandlerFunc(s.remotePinAddHandler),
+		})
+		handle("/pinning/pins/{requestid}", jsonhttp.MethodHandler{
+			"GET":    http.HandlerFunc(s.remotePinGetHandler),
+			"POST":   http.HandlerFunc(s.remotePinReplaceHandler),
+			"DELETE": http.HandlerFunc(s.remotePinRemoveHandler),
+		})
+	}
 
 	handle("/stamps", web.ChainHandlers(
 		s.gatewayModeForbidEndpointHandler,
@@ -188,7 +281,7 @@ func (s *server) setupRouting() {
 				if o := r.Header.Get("Origin"); o != "" && s.checkOrigin(r) {
 					w.Header().Set("Access-Control-Allow-Credentials", "true")
 					w.Header().Set("Access-Control-Allow-Origin", o)
-					w.Header().Set("Access-Control-Allow-Headers", "Origin, Accept, Authorization, Content-Type, X-Requested-With, Access-Control-Request-Headers, Access-Control-Request-Method, Penguin-Tag, Penguin-Pin, Penguin-Encrypt, Penguin-Index-Document, Penguin-Error-Document, Penguin-Collection, Penguin-Postage-Batch-Id, Gas-Price")
+					w.Header().Set("Access-Control-Allow-Headers", "Origin, Accept, Authorization, Content-Type, X-Requested-With, Access-Control-Request-Headers, Access-Control-Request-Method, Penguin-Tag, Penguin-Pin, Penguin-Encrypt, Penguin-Index-Document, Penguin-Error-Document, Penguin-Collection, Penguin-Postage-Batch-Id, Penguin-Act, Penguin-Act-Publisher, Penguin-Act-History-Address, Penguin-Act-Timestamp, Penguin-Api-Key, Gas-Price")
 					w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS, POST, PUT, DELETE")
 					w.Header().Set("Access-Control-Max-Age", "3600")
 				}
@@ -224,6 +317,11 @@ func (s *server) gatewayModeForbidHeadersHandler(h http.Handler) http.Handler {
 				jsonhttp.Forbidden(w, "encryption is disabled")
 				return
 			}
+			if requestAct(r) {
+				s.logger.Tracef("gateway mode: forbidden access control %s", r.URL.String())
+				jsonhttp.Forbidden(w, "access control is disabled")
+				return
+			}
 		}
 		h.ServeHTTP(w, r)
 	})
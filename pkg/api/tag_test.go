@@ -268,7 +268,7 @@ func TestTags(t *testing.T) {
 
 	t.Run("file tags", func(t *testing.T) {
 		// upload a file without supplying tag
-		expectedHash := penguin.MustParseHexAddress("40e739ebdfd18292925bba4138cd097db9aa18c1b57e74042f48469b48da33a8")
+		expectedHash := penguin.MustParseHexAddress("482c92963e8108064197ec66730f92eae66a7ee48e15983ce83a8e9c5ff3f6d6")
 		expectedResponse := api.PenUploadResponse{Reference: expectedHash}
 
 		respHeaders := jsonhttptest.Request(t, client, http.MethodPost,
@@ -292,7 +292,7 @@ func TestTags(t *testing.T) {
 			data: []byte("some dir data"),
 			name: "binary-file",
 		}})
-		expectedHash := penguin.MustParseHexAddress("42bc27c9137c93705ffbc2945fa1aab0e8e1826f1500b7f06f6e3f86f617213b")
+		expectedHash := penguin.MustParseHexAddress("aa1d586a6d95d041b6ca7032b1767ec74fcb60844f302cc0eb5b6fe59ec21c9e")
 		expectedResponse := api.PenUploadResponse{Reference: expectedHash}
 
 		respHeaders := jsonhttptest.Request(t, client, http.MethodPost, penResource, http.StatusCreated,
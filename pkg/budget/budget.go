@@ -0,0 +1,366 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package budget limits the amount the node spends paying peers for
+// retrieving and pushing chunks, globally and for the API keys of the
+// clients, in fixed time windows.
+//
+// Spending above the soft limit restricts the clients to the content in the
+// local store, spending above the hard limit rejects their requests.
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/accounting"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/storage"
+)
+
+const limitsPrefix = "budget_limits_"
+
+var (
+	// ErrSoftLimit is returned if the spending reached the soft limit.
+	ErrSoftLimit = errors.New("spending budget soft limit reached")
+	// ErrHardLimit is returned if the spending reached the hard limit.
+	ErrHardLimit = errors.New("spending budget hard limit reached")
+	// ErrNotFound is returned if there is no budget for the API key.
+	ErrNotFound = errors.New("budget not found")
+	// ErrInvalidLimits is returned if the soft limit exceeds the hard limit.
+	ErrInvalidLimits = errors.New("soft limit exceeds hard limit")
+	// ErrInvalidKey is returned for an empty API key.
+	ErrInvalidKey = errors.New("invalid api key")
+	// ErrUnauthorized is returned for the API keys without a budget and for
+	// missing API keys if the keys are required.
+	ErrUnauthorized = errors.New("unauthorized api key")
+)
+
+// Limits are the amounts that can be spent in a time window. Zero or nil
+// limits are not enforced.
+type Limits struct {
+	Soft *big.Int `json:"soft"`
+	Hard *big.Int `json:"hard"`
+}
+
+func (l Limits) validate() error {
+	if l.Soft != nil && l.Soft.Sign() < 0 || l.Hard != nil && l.Hard.Sign() < 0 {
+		return ErrInvalidLimits
+	}
+	if enforced(l.Soft) && enforced(l.Hard) && l.Soft.Cmp(l.Hard) > 0 {
+		return ErrInvalidLimits
+	}
+	return nil
+}
+
+// Status is the spending in the current time window with respect to the
+// limits.
+type Status struct {
+	// Key is the API key of the budget, empty for the global budget.
+	Key string
+	// ID is the identifier of the API key recorded as the client of the
+	// charged requests, see accounting.ClientID.
+	ID          string
+	Limits      Limits
+	Spent       *big.Int
+	WindowStart time.Time
+	WindowEnd   time.Time
+}
+
+type budget struct {
+	limits      Limits
+	spent       *big.Int
+	windowStart time.Time
+}
+
+func newBudget(limits Limits) *budget {
+	return &budget{
+		limits: limits,
+		spent:  big.NewInt(0),
+	}
+}
+
+// check returns the error for the limit reached by the spending.
+func (b *budget) check() error {
+	if enforced(b.limits.Hard) && b.spent.Cmp(b.limits.Hard) >= 0 {
+		return ErrHardLimit
+	}
+	if enforced(b.limits.Soft) && b.spent.Cmp(b.limits.Soft) >= 0 {
+		return ErrSoftLimit
+	}
+	return nil
+}
+
+func enforced(limit *big.Int) bool {
+	return limit != nil && limit.Sign() > 0
+}
+
+// Service keeps the budgets. The limits of the API keys are persisted in
+// the state store, the global limits and the spending are kept in memory
+// only.
+type Service struct {
+	store      storage.StateStorer
+	logger     logging.Logger
+	window     time.Duration
+	requireKey bool
+	timeNow    func() time.Time
+
+	mu     sync.Mutex
+	global *budget
+	keys   map[string]*budget
+	// ids are the budgets of the keys by the key identifiers the spending
+	// is charged to
+	ids map[string]*budget
+}
+
+// New creates the budgets with the global limits, loading the limits of the
+// API keys from the state store. With requireKey set, only the requests with
+// the API key of a budget are authorized.
+func New(store storage.StateStorer, logger logging.Logger, window time.Duration, global Limits, requireKey bool) (*Service, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("invalid budget window %v", window)
+	}
+	if err := global.validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Service{
+		store:      store,
+		logger:     logger,
+		window:     window,
+		requireKey: requireKey,
+		timeNow:    time.Now,
+		global:     newBudget(global),
+		keys:       make(map[string]*budget),
+		ids:        make(map[string]*budget),
+	}
+
+	err := store.Iterate(limitsPrefix, func(key, val []byte) (stop bool, err error) {
+		var limits Limits
+		if err := json.Unmarshal(val, &limits); err != nil {
+			return true, fmt.Errorf("decode budget limits %s: %w", key, err)
+		}
+		s.add(strings.TrimPrefix(string(key), limitsPrefix), newBudget(limits))
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("budget: loaded %d api key budgets", len(s.keys))
+	return s, nil
+}
+
+// Authenticate returns ErrUnauthorized if there is no budget for the API key
+// or, if the keys are required, if the key is missing. The API keys are the
+// secrets the budgets are set for, requests without a key are charged to the
+// global budget only.
+func (s *Service) Authenticate(key string) error {
+	if key == "" {
+		if s.requireKey {
+			return ErrUnauthorized
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key]; !ok {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// Check returns ErrHardLimit or ErrSoftLimit if the global spending or the
+// spending of the API key reached the respective limit. The hard limit takes
+// precedence.
+func (s *Service) Check(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timeNow()
+	errGlobal := s.roll(s.global, now).check()
+
+	var errKey error
+	if b, ok := s.keys[key]; ok {
+		errKey = s.roll(b, now).check()
+	}
+
+	if errGlobal == ErrHardLimit || errKey == ErrHardLimit {
+		return ErrHardLimit
+	}
+	if errGlobal != nil {
+		return errGlobal
+	}
+	return errKey
+}
+
+// Spend charges the amount to the global budget and to the budget of the API
+// key with the identifier, as returned by accounting.ClientID, if there is one.
+func (s *Service) Spend(id string, amount uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timeNow()
+	spent := new(big.Int).SetUint64(amount)
+
+	b := s.roll(s.global, now)
+	b.spent.Add(b.spent, spent)
+
+	if b, ok := s.ids[id]; ok {
+		b = s.roll(b, now)
+		b.spent.Add(b.spent, spent)
+	}
+}
+
+// roll starts a new time window for the budget if the current one is over.
+// It must be called with the lock held.
+func (s *Service) roll(b *budget, now time.Time) *budget {
+	if now.Before(b.windowStart.Add(s.window)) {
+		return b
+	}
+	b.windowStart = now.Truncate(s.window)
+	b.spent = big.NewInt(0)
+	return b
+}
+
+// Global returns the status of the global budget.
+func (s *Service) Global() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.status("", s.roll(s.global, s.timeNow()))
+}
+
+// SetGlobal sets the limits of the global budget until the node restarts.
+func (s *Service) SetGlobal(limits Limits) error {
+	if err := limits.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.global.limits = limits
+	return nil
+}
+
+// Budget returns the status of the budget of the API key.
+func (s *Service) Budget(key string) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.keys[key]
+	if !ok {
+		return Status{}, ErrNotFound
+	}
+	return s.status(key, s.roll(b, s.timeNow())), nil
+}
+
+// Budgets returns the status of the budgets of all API keys, ordered by key.
+func (s *Service) Budgets() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timeNow()
+	budgets := make([]Status, 0, len(s.keys))
+	for key, b := range s.keys {
+		budgets = append(budgets, s.status(key, s.roll(b, now)))
+	}
+	sort.Slice(budgets, func(i, j int) bool {
+		return budgets[i].Key < budgets[j].Key
+	})
+	return budgets
+}
+
+// SetBudget sets the limits of the API key, keeping the spending in the
+// current time window.
+func (s *Service) SetBudget(key string, limits Limits) error {
+	if key == "" {
+		return ErrInvalidKey
+	}
+	if err := limits.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store.Put(limitsPrefix+key, limits); err != nil {
+		return err
+	}
+	if b, ok := s.keys[key]; ok {
+		b.limits = limits
+	} else {
+		s.add(key, newBudget(limits))
+	}
+	return nil
+}
+
+// RemoveBudget removes the budget of the API key.
+func (s *Service) RemoveBudget(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key]; !ok {
+		return ErrNotFound
+	}
+	if err := s.store.Delete(limitsPrefix + key); err != nil {
+		return err
+	}
+	delete(s.keys, key)
+	delete(s.ids, accounting.ClientID(key))
+	return nil
+}
+
+// add adds the budget of the API key. It must be called with the lock held,
+// or before the service is used.
+func (s *Service) add(key string, b *budget) {
+	s.keys[key] = b
+	s.ids[accounting.ClientID(key)] = b
+}
+
+// status returns the status of the budget. It must be called with the lock
+// held.
+func (s *Service) status(key string, b *budget) Status {
+	return Status{
+		Key:         key,
+		ID:          accounting.ClientID(key),
+		Limits:      b.limits,
+		Spent:       new(big.Int).Set(b.spent),
+		WindowStart: b.windowStart,
+		WindowEnd:   b.windowStart.Add(s.window),
+	}
+}
+
+// Accounting returns the accounting that charges the credits of the chunk
+// requests to the budgets.
+func (s *Service) Accounting(acc accounting.Interface) accounting.Interface {
+	return &budgetAccounting{Interface: acc, budgets: s}
+}
+
+type budgetAccounting struct {
+	accounting.Interface
+	budgets *Service
+}
+
+// Credit charges the credit to the budgets of the client the request is made
+// for. The requests forwarded for peers are not charged, as the peers pay for
+// them.
+func (a *budgetAccounting) Credit(peer penguin.Address, price uint64, provenance accounting.Provenance) error {
+	if err := a.Interface.Credit(peer, price, provenance); err != nil {
+		return err
+	}
+	if !provenance.Forwarded {
+		a.budgets.Spend(provenance.Client, price)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package budget_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/accounting"
+	accountingmock "github.com/penguintop/penguin/pkg/accounting/mock"
+	"github.com/penguintop/penguin/pkg/budget"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	statestore "github.com/penguintop/penguin/pkg/statestore/mock"
+)
+
+func TestBudget(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+	store := statestore.NewStateStore()
+	now := time.Unix(3600, 0)
+
+	s, err := budget.New(store, logger, time.Hour, budget.Limits{Soft: big.NewInt(100), Hard: big.NewInt(200)}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetTimeNow(func() time.Time { return now })
+
+	if err := s.SetBudget("key", budget.Limits{Soft: big.NewInt(10), Hard: big.NewInt(20)}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkErr := func(t *testing.T, key string, want error) {
+		t.Helper()
+		if err := s.Check(key); !errors.Is(err, want) {
+			t.Fatalf("check %q: got error %v, want %v", key, err, want)
+		}
+	}
+
+	checkErr(t, "key", nil)
+	s.Spend(accounting.ClientID("key"), 10)
+	checkErr(t, "key", budget.ErrSoftLimit)
+	checkErr(t, "other", nil)
+	s.Spend(accounting.ClientID("key"), 10)
+	checkErr(t, "key", budget.ErrHardLimit)
+
+	// spending without a budget counts against the global budget only
+	s.Spend("other", 80)
+	checkErr(t, "other", budget.ErrSoftLimit)
+
+	global := s.Global()
+	if global.Spent.Cmp(big.NewInt(100)) != 0 {
+		t.Fatalf("got global spent %d, want 100", global.Spent)
+	}
+	if !global.WindowStart.Equal(now) || !global.WindowEnd.Equal(now.Add(time.Hour)) {
+		t.Fatalf("got window %v - %v", global.WindowStart, global.WindowEnd)
+	}
+
+	// a new window resets the spending
+	now = now.Add(time.Hour)
+	checkErr(t, "key", nil)
+	checkErr(t, "other", nil)
+
+	t.Run("persisted", func(t *testing.T) {
+		s, err := budget.New(store, logger, time.Hour, budget.Limits{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		budgets := s.Budgets()
+		if len(budgets) != 1 || budgets[0].Key != "key" || budgets[0].Limits.Hard.Cmp(big.NewInt(20)) != 0 {
+			t.Fatalf("got budgets %+v", budgets)
+		}
+	})
+
+	t.Run("invalid limits", func(t *testing.T) {
+		err := s.SetBudget("key", budget.Limits{Soft: big.NewInt(20), Hard: big.NewInt(10)})
+		if !errors.Is(err, budget.ErrInvalidLimits) {
+			t.Fatalf("got error %v, want %v", err, budget.ErrInvalidLimits)
+		}
+		if err := s.SetGlobal(budget.Limits{Soft: big.NewInt(-1)}); !errors.Is(err, budget.ErrInvalidLimits) {
+			t.Fatalf("got error %v, want %v", err, budget.ErrInvalidLimits)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err := s.RemoveBudget("key"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Budget("key"); !errors.Is(err, budget.ErrNotFound) {
+			t.Fatalf("got error %v, want %v", err, budget.ErrNotFound)
+		}
+		if err := s.RemoveBudget("key"); !errors.Is(err, budget.ErrNotFound) {
+			t.Fatalf("got error %v, want %v", err, budget.ErrNotFound)
+		}
+	})
+}
+
+func TestAccounting(t *testing.T) {
+	s, err := budget.New(statestore.NewStateStore(), logging.New(ioutil.Discard, 0), time.Hour, budget.Limits{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetBudget("key", budget.Limits{Hard: big.NewInt(5)}); err != nil {
+		t.Fatal(err)
+	}
+
+	acc := s.Accounting(accountingmock.NewAccounting())
+	peer := penguin.MustParseHexAddress("01")
+
+	// forwarded requests are paid by the peers
+	if err := acc.Credit(peer, 5, accounting.Provenance{Protocol: accounting.ProtocolPushSync, Forwarded: true}); err != nil {
+		t.Fatal(err)
+	}
+	if spent := s.Global().Spent; spent.Sign() != 0 {
+		t.Fatalf("got global spent %d for a forwarded request, want 0", spent)
+	}
+
+	if err := acc.Credit(peer, 5, accounting.Provenance{Protocol: accounting.ProtocolRetrieval, Client: accounting.ClientID("key")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Check("key"); !errors.Is(err, budget.ErrHardLimit) {
+		t.Fatalf("got error %v, want %v", err, budget.ErrHardLimit)
+	}
+	if spent := s.Global().Spent; spent.Cmp(big.NewInt(5)) != 0 {
+		t.Fatalf("got global spent %d, want 5", spent)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	for _, requireKey := range []bool{false, true} {
+		s, err := budget.New(statestore.NewStateStore(), logging.New(ioutil.Discard, 0), time.Hour, budget.Limits{}, requireKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetBudget("key", budget.Limits{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.Authenticate("key"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Authenticate("other"); !errors.Is(err, budget.ErrUnauthorized) {
+			t.Fatalf("got error %v, want %v", err, budget.ErrUnauthorized)
+		}
+		var want error
+		if requireKey {
+			want = budget.ErrUnauthorized
+		}
+		if err := s.Authenticate(""); !errors.Is(err, want) {
+			t.Fatalf("require key %v: got error %v, want %v", requireKey, err, want)
+		}
+	}
+}
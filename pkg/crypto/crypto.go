@@ -74,6 +74,16 @@ func EncodeSecp256k1PublicKey(k *ecdsa.PublicKey) []byte {
 	return (*btcec.PublicKey)(k).SerializeCompressed()
 }
 
+// DecodeSecp256k1PublicKey decodes ECDSA public key in the compressed or
+// uncompressed format.
+func DecodeSecp256k1PublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	pubk, err := btcec.ParsePubKey(data, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	return (*ecdsa.PublicKey)(pubk), nil
+}
+
 // DecodeSecp256k1PrivateKey decodes raw ECDSA private key.
 func DecodeSecp256k1PrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
 	if l := len(data); l != btcec.PrivKeyBytesLen {
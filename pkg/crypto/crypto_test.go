@@ -63,6 +63,21 @@ func TestEncodeSecp256k1PrivateKey(t *testing.T) {
 	}
 }
 
+func TestEncodeSecp256k1PublicKey(t *testing.T) {
+	k, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := crypto.EncodeSecp256k1PublicKey(&k.PublicKey)
+	pub, err := crypto.DecodeSecp256k1PublicKey(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k.PublicKey.Equal(pub) {
+		t.Fatal("encoded and decoded keys are not equal")
+	}
+}
+
 func TestSecp256k1PrivateKeyFromBytes(t *testing.T) {
 	data := []byte("data")
 
@@ -20,6 +20,7 @@ type signerMock struct {
 	signTypedData   func(*eip712.TypedData) ([]byte, error)
 	ethereumAddress func() (common.Address, error)
 	signFunc        func([]byte) ([]byte, error)
+	signXwcData     func([]byte) ([]byte, error)
 }
 
 func (m *signerMock) SignForAudit(data []byte) ([]byte, error) {
@@ -27,7 +28,10 @@ func (m *signerMock) SignForAudit(data []byte) ([]byte, error) {
 }
 
 func (m *signerMock) SignXwcData(data []byte) ([]byte, error) {
-	return nil, nil
+	if m.signXwcData == nil {
+		return nil, nil
+	}
+	return m.signXwcData(data)
 }
 
 func (m *signerMock) CompressedPubKeyHex() (string, error) {
@@ -97,6 +101,12 @@ func WithSignTxFunc(f func(transaction *types.Transaction, chainID *big.Int) (*t
 	})
 }
 
+func WithSignXwcDataFunc(f func(data []byte) ([]byte, error)) Option {
+	return optionFunc(func(s *signerMock) {
+		s.signXwcData = f
+	})
+}
+
 func WithSignTypedDataFunc(f func(*eip712.TypedData) ([]byte, error)) Option {
 	return optionFunc(func(s *signerMock) {
 		s.signTypedData = f
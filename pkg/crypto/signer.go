@@ -75,6 +75,23 @@ func Recover(signature, data []byte) (*ecdsa.PublicKey, error) {
 	return (*ecdsa.PublicKey)(p), err
 }
 
+// RecoverXwc recovers the public key from a signature made with SignXwcData,
+// in the r, s, v order. The data is hashed with sha256 as by SignXwcData.
+func RecoverXwc(signature, data []byte) (*ecdsa.PublicKey, error) {
+	if len(signature) != 65 {
+		return nil, ErrInvalidLength
+	}
+	// Convert to btcec input format with 'recovery id' v at the beginning.
+	btcsig := make([]byte, 65)
+	btcsig[0] = signature[64]
+	copy(btcsig[1:], signature)
+
+	hash := sha256.Sum256(data)
+
+	p, _, err := btcec.RecoverCompact(btcec.S256(), btcsig, hash[:])
+	return (*ecdsa.PublicKey)(p), err
+}
+
 type defaultSigner struct {
 	key *ecdsa.PrivateKey
 }
@@ -64,6 +64,40 @@ func TestDefaultSigner(t *testing.T) {
 	})
 }
 
+func TestRecoverXwc(t *testing.T) {
+	testBytes := []byte("test string")
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := crypto.NewDefaultSigner(privKey)
+	sig, err := signer.SignXwcData(testBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SignXwcData puts v first, RecoverXwc expects it last
+	signature := append(append([]byte{}, sig[1:]...), sig[0])
+
+	pubKey, err := crypto.RecoverXwc(signature, testBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pubKey.X.Cmp(privKey.PublicKey.X) != 0 || pubKey.Y.Cmp(privKey.PublicKey.Y) != 0 {
+		t.Fatalf("wanted %v but got %v", &privKey.PublicKey, pubKey)
+	}
+
+	pubKey, err = crypto.RecoverXwc(signature, []byte("invalid"))
+	if err == nil && pubKey.X.Cmp(privKey.PublicKey.X) == 0 && pubKey.Y.Cmp(privKey.PublicKey.Y) == 0 {
+		t.Fatal("expected different public key")
+	}
+
+	if _, err := crypto.RecoverXwc([]byte("invalid"), testBytes); !errors.Is(err, crypto.ErrInvalidLength) {
+		t.Fatalf("expected invalid length error but got %v", err)
+	}
+}
+
 func TestDefaultSignerEthereumAddress(t *testing.T) {
 	data, err := hex.DecodeString("634fb5a872396d9693e5c9f9d7233cfa93f395c093371017ff44aa9ae6564cdd")
 	if err != nil {
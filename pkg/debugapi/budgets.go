@@ -0,0 +1,172 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debugapi
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/penguintop/penguin/pkg/budget"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+)
+
+var (
+	errCantSetBudget    = "cannot set budget"
+	errCantRemoveBudget = "cannot remove budget"
+	errNoBudget         = "no budget for api key"
+	errBadBudgetLimits  = "invalid budget limits"
+)
+
+type budgetResponse struct {
+	Key         string    `json:"key,omitempty"`
+	ID          string    `json:"id,omitempty"`
+	SoftLimit   *big.Int  `json:"softLimit"`
+	HardLimit   *big.Int  `json:"hardLimit"`
+	Spent       *big.Int  `json:"spent"`
+	WindowStart time.Time `json:"windowStart"`
+	WindowEnd   time.Time `json:"windowEnd"`
+}
+
+type budgetsResponse struct {
+	Global  budgetResponse   `json:"global"`
+	Budgets []budgetResponse `json:"budgets"`
+}
+
+func newBudgetResponse(status budget.Status) budgetResponse {
+	return budgetResponse{
+		Key:         status.Key,
+		ID:          status.ID,
+		SoftLimit:   limitOrZero(status.Limits.Soft),
+		HardLimit:   limitOrZero(status.Limits.Hard),
+		Spent:       status.Spent,
+		WindowStart: status.WindowStart,
+		WindowEnd:   status.WindowEnd,
+	}
+}
+
+func limitOrZero(limit *big.Int) *big.Int {
+	if limit == nil {
+		return big.NewInt(0)
+	}
+	return limit
+}
+
+// budgetsHandler returns the global spending budget and the budgets of all
+// api keys.
+func (s *Service) budgetsHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := s.budgets.Budgets()
+	budgets := make([]budgetResponse, 0, len(statuses))
+	for _, status := range statuses {
+		budgets = append(budgets, newBudgetResponse(status))
+	}
+
+	jsonhttp.OK(w, budgetsResponse{
+		Global:  newBudgetResponse(s.budgets.Global()),
+		Budgets: budgets,
+	})
+}
+
+// budgetsGlobalSetHandler sets the limits of the global spending budget from
+// the soft and hard query parameters. Missing limits are not enforced.
+func (s *Service) budgetsGlobalSetHandler(w http.ResponseWriter, r *http.Request) {
+	limits, ok := parseBudgetLimits(r)
+	if !ok {
+		jsonhttp.BadRequest(w, errBadBudgetLimits)
+		return
+	}
+
+	if err := s.budgets.SetGlobal(limits); err != nil {
+		s.logger.Debugf("debug api: budgets: set global: %v", err)
+		jsonhttp.BadRequest(w, errBadBudgetLimits)
+		return
+	}
+
+	jsonhttp.OK(w, newBudgetResponse(s.budgets.Global()))
+}
+
+// budgetHandler returns the spending budget of an api key.
+func (s *Service) budgetHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	status, err := s.budgets.Budget(key)
+	if err != nil {
+		s.logger.Debugf("debug api: budget %q: %v", key, err)
+		jsonhttp.NotFound(w, errNoBudget)
+		return
+	}
+
+	jsonhttp.OK(w, newBudgetResponse(status))
+}
+
+// budgetSetHandler sets the limits of the spending budget of an api key from
+// the soft and hard query parameters. Missing limits are not enforced.
+func (s *Service) budgetSetHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	limits, ok := parseBudgetLimits(r)
+	if !ok {
+		jsonhttp.BadRequest(w, errBadBudgetLimits)
+		return
+	}
+
+	if err := s.budgets.SetBudget(key, limits); err != nil {
+		s.logger.Debugf("debug api: budget %q: set: %v", key, err)
+		if errors.Is(err, budget.ErrInvalidLimits) || errors.Is(err, budget.ErrInvalidKey) {
+			jsonhttp.BadRequest(w, errBadBudgetLimits)
+			return
+		}
+		s.logger.Errorf("debug api: can not set budget for api key %q", key)
+		jsonhttp.InternalServerError(w, errCantSetBudget)
+		return
+	}
+
+	status, err := s.budgets.Budget(key)
+	if err != nil {
+		s.logger.Debugf("debug api: budget %q: %v", key, err)
+		jsonhttp.InternalServerError(w, errCantSetBudget)
+		return
+	}
+
+	jsonhttp.OK(w, newBudgetResponse(status))
+}
+
+// budgetRemoveHandler removes the spending budget of an api key.
+func (s *Service) budgetRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	if err := s.budgets.RemoveBudget(key); err != nil {
+		s.logger.Debugf("debug api: budget %q: remove: %v", key, err)
+		if errors.Is(err, budget.ErrNotFound) {
+			jsonhttp.NotFound(w, errNoBudget)
+			return
+		}
+		s.logger.Errorf("debug api: can not remove budget for api key %q", key)
+		jsonhttp.InternalServerError(w, errCantRemoveBudget)
+		return
+	}
+
+	jsonhttp.OK(w, nil)
+}
+
+// parseBudgetLimits parses the soft and hard limits from the query
+// parameters.
+func parseBudgetLimits(r *http.Request) (limits budget.Limits, ok bool) {
+	query := r.URL.Query()
+
+	if soft := query.Get("soft"); soft != "" {
+		if limits.Soft, ok = new(big.Int).SetString(soft, 10); !ok {
+			return limits, false
+		}
+	}
+	if hard := query.Get("hard"); hard != "" {
+		if limits.Hard, ok = new(big.Int).SetString(hard, 10); !ok {
+			return limits, false
+		}
+	}
+	return limits, true
+}
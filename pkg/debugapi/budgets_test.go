@@ -0,0 +1,94 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debugapi_test
+
+import (
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/accounting"
+	"github.com/penguintop/penguin/pkg/budget"
+	"github.com/penguintop/penguin/pkg/debugapi"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/jsonhttp/jsonhttptest"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/statestore/mock"
+)
+
+func TestBudgets(t *testing.T) {
+	budgets, err := budget.New(mock.NewStateStore(), logging.New(ioutil.Discard, 0), time.Hour, budget.Limits{Soft: big.NewInt(100)}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	budgets.Spend("", 30)
+
+	testServer := newTestServer(t, testServerOptions{
+		Budgets: budgets,
+	})
+
+	t.Run("global", func(t *testing.T) {
+		var got debugapi.BudgetsResponse
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/budgets", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&got),
+		)
+		if got.Global.SoftLimit.Cmp(big.NewInt(100)) != 0 || got.Global.HardLimit.Sign() != 0 || got.Global.Spent.Cmp(big.NewInt(30)) != 0 {
+			t.Fatalf("got global budget %+v", got.Global)
+		}
+		if len(got.Budgets) != 0 {
+			t.Fatalf("got %d budgets, want 0", len(got.Budgets))
+		}
+
+		jsonhttptest.Request(t, testServer.Client, http.MethodPut, "/budgets?soft=200&hard=300", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&got.Global),
+		)
+		if got.Global.SoftLimit.Cmp(big.NewInt(200)) != 0 || got.Global.HardLimit.Cmp(big.NewInt(300)) != 0 {
+			t.Fatalf("got global budget %+v", got.Global)
+		}
+	})
+
+	t.Run("key", func(t *testing.T) {
+		var got debugapi.BudgetResponse
+		jsonhttptest.Request(t, testServer.Client, http.MethodPut, "/budgets/key1?hard=50", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&got),
+		)
+		if got.Key != "key1" || got.ID != accounting.ClientID("key1") || got.SoftLimit.Sign() != 0 || got.HardLimit.Cmp(big.NewInt(50)) != 0 {
+			t.Fatalf("got budget %+v", got)
+		}
+
+		budgets.Spend(accounting.ClientID("key1"), 20)
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/budgets/key1", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&got),
+		)
+		if got.Spent.Cmp(big.NewInt(20)) != 0 {
+			t.Fatalf("got spent %d, want 20", got.Spent)
+		}
+
+		jsonhttptest.Request(t, testServer.Client, http.MethodDelete, "/budgets/key1", http.StatusOK)
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/budgets/key1", http.StatusNotFound,
+			jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
+				Message: debugapi.ErrNoBudget,
+				Code:    http.StatusNotFound,
+			}),
+		)
+	})
+
+	t.Run("bad limits", func(t *testing.T) {
+		for _, path := range []string{
+			"/budgets/key1?soft=abc",
+			"/budgets/key1?soft=20&hard=10",
+			"/budgets?hard=-1",
+		} {
+			jsonhttptest.Request(t, testServer.Client, http.MethodPut, path, http.StatusBadRequest,
+				jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
+					Message: debugapi.ErrBadBudgetLimits,
+					Code:    http.StatusBadRequest,
+				}),
+			)
+		}
+	})
+}
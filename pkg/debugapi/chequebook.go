@@ -10,11 +10,13 @@ import (
 	"github.com/penguintop/penguin/pkg/xwcfmt"
 	"math/big"
 	"net/http"
+	"sort"
 	"strconv"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/penguintop/penguin/pkg/jsonhttp"
 	"github.com/penguintop/penguin/pkg/sctx"
+	"github.com/penguintop/penguin/pkg/settlement"
 	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
 
     "github.com/penguintop/penguin/pkg/penguin"
@@ -33,6 +35,7 @@ var (
 	errCannotCashStatus            = "cannot get cashout status"
 	errNoCashout                   = "no prior cashout"
 	errNoCheque                    = "no prior cheque"
+	errCantSolvency                = "cannot get chequebook solvency"
 	errBadGasPrice                 = "bad gas price"
 	errBadGasLimit                 = "bad gas limit"
 
@@ -419,3 +422,89 @@ func (s *Service) chequebookDepositHandler(w http.ResponseWriter, r *http.Reques
 
 	jsonhttp.OK(w, chequebookTxResponse{TransactionHash: txHash})
 }
+
+type chequebookSolvencyPeerResponse struct {
+	Peer             string   `json:"peer"`
+	Chequebook       string   `json:"chequebook"`
+	Issuer           string   `json:"issuer,omitempty"`
+	Balance          *big.Int `json:"balance"`
+	TotalPaidOut     *big.Int `json:"totalPaidOut"`
+	PaidOut          *big.Int `json:"paidOut"`
+	CumulativePayout *big.Int `json:"cumulativePayout"`
+	Uncashed         *big.Int `json:"uncashed"`
+	SharedUncashed   *big.Int `json:"sharedUncashed"`
+	Risk             float64  `json:"risk"`
+	Insolvent        bool     `json:"insolvent"`
+}
+
+type chequebookSolvencyResponse struct {
+	Solvencies []chequebookSolvencyPeerResponse `json:"solvencies"`
+}
+
+func newChequebookSolvencyPeerResponse(peer string, solvency *chequebook.Solvency) chequebookSolvencyPeerResponse {
+	conAddr, _ := xwcfmt.HexAddrToXwcConAddr(hex.EncodeToString(solvency.Chequebook[:]))
+	var issuer string
+	if solvency.Issuer != (common.Address{}) {
+		issuer, _ = xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(solvency.Issuer[:]))
+	}
+	return chequebookSolvencyPeerResponse{
+		Peer:             peer,
+		Chequebook:       conAddr,
+		Issuer:           issuer,
+		Balance:          solvency.Balance,
+		TotalPaidOut:     solvency.TotalPaidOut,
+		PaidOut:          solvency.PaidOut,
+		CumulativePayout: solvency.CumulativePayout,
+		Uncashed:         solvency.Uncashed,
+		SharedUncashed:   solvency.SharedUncashed,
+		Risk:             solvency.Risk,
+		Insolvent:        solvency.Insolvent,
+	}
+}
+
+func (s *Service) chequebookSolvencyPeerHandler(w http.ResponseWriter, r *http.Request) {
+	addr := mux.Vars(r)["peer"]
+	peer, err := penguin.ParseHexAddress(addr)
+	if err != nil {
+		s.logger.Debugf("debug api: chequebook solvency peer: invalid peer address %s: %v", addr, err)
+		s.logger.Errorf("debug api: chequebook solvency peer: invalid peer address %s", addr)
+		jsonhttp.NotFound(w, errInvalidAddress)
+		return
+	}
+
+	solvency, err := s.swap.PeerSolvency(r.Context(), peer)
+	if err != nil {
+		if errors.Is(err, settlement.ErrPeerNoSettlements) || errors.Is(err, chequebook.ErrNoCheque) {
+			jsonhttp.NotFound(w, errNoCheque)
+			return
+		}
+		s.logger.Debugf("debug api: chequebook solvency peer: get peer %s solvency: %v", addr, err)
+		s.logger.Errorf("debug api: chequebook solvency peer: can't get peer %s solvency", addr)
+		jsonhttp.InternalServerError(w, errCantSolvency)
+		return
+	}
+
+	jsonhttp.OK(w, newChequebookSolvencyPeerResponse(peer.String(), solvency))
+}
+
+func (s *Service) chequebookSolvencyHandler(w http.ResponseWriter, r *http.Request) {
+	solvencies, err := s.swap.PeerSolvencies(r.Context())
+	if err != nil {
+		s.logger.Debugf("debug api: chequebook solvency: get solvencies: %v", err)
+		s.logger.Error("debug api: chequebook solvency: can't get solvencies")
+		jsonhttp.InternalServerError(w, errCantSolvency)
+		return
+	}
+
+	resp := chequebookSolvencyResponse{
+		Solvencies: make([]chequebookSolvencyPeerResponse, 0, len(solvencies)),
+	}
+	for peer, solvency := range solvencies {
+		resp.Solvencies = append(resp.Solvencies, newChequebookSolvencyPeerResponse(peer, solvency))
+	}
+	sort.Slice(resp.Solvencies, func(i, j int) bool {
+		return resp.Solvencies[i].Peer < resp.Solvencies[j].Peer
+	})
+
+	jsonhttp.OK(w, resp)
+}
@@ -14,11 +14,14 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/penguintop/penguin/pkg/accounting"
+	"github.com/penguintop/penguin/pkg/budget"
+	"github.com/penguintop/penguin/pkg/localstore"
 	"github.com/penguintop/penguin/pkg/logging"
 	"github.com/penguintop/penguin/pkg/p2p"
 	"github.com/penguintop/penguin/pkg/pingpong"
 	"github.com/penguintop/penguin/pkg/postage"
 	"github.com/penguintop/penguin/pkg/settlement"
+	"github.com/penguintop/penguin/pkg/settlement/pseudosettle"
 	"github.com/penguintop/penguin/pkg/settlement/swap"
 	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
 	"github.com/penguintop/penguin/pkg/storage"
@@ -27,6 +30,7 @@ import (
 	"github.com/penguintop/penguin/pkg/topology"
 	"github.com/penguintop/penguin/pkg/topology/lightnode"
 	"github.com/penguintop/penguin/pkg/tracing"
+	"github.com/penguintop/penguin/pkg/wallet"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -45,11 +49,17 @@ type Service struct {
 	tracer             *tracing.Tracer
 	tags               *tags.Tags
 	accounting         accounting.Interface
+	ledger             *accounting.Ledger
+	budgets            *budget.Service
 	pseudosettle       settlement.Interface
+	timesettlements    pseudosettle.Interface
 	chequebookEnabled  bool
 	chequebook         chequebook.Service
 	swap               swap.Interface
+	wallet             *wallet.Service
 	batchStore         postage.Storer
+	scrubber           *localstore.Scrubber
+	localStore         *localstore.DB
 	corsAllowedOrigins []string
 	metricsRegistry    *prometheus.Registry
 	lightNodes         *lightnode.Container
@@ -83,19 +93,25 @@ func New(overlay penguin.Address, publicKey, pssPublicKey ecdsa.PublicKey, xwcAd
 // Configure injects required dependencies and configuration parameters and
 // constructs HTTP routes that depend on them. It is intended and safe to call
 // this method only once.
-func (s *Service) Configure(p2p p2p.DebugService, pingpong pingpong.Interface, topologyDriver topology.Driver, lightNodes *lightnode.Container, storer storage.Storer, tags *tags.Tags, accounting accounting.Interface, pseudosettle settlement.Interface, chequebookEnabled bool, swap swap.Interface, chequebook chequebook.Service, batchStore postage.Storer) {
+func (s *Service) Configure(p2p p2p.DebugService, pingpong pingpong.Interface, topologyDriver topology.Driver, lightNodes *lightnode.Container, storer storage.Storer, tags *tags.Tags, accounting accounting.Interface, ledger *accounting.Ledger, budgets *budget.Service, pseudosettle settlement.Interface, chequebookEnabled bool, swap swap.Interface, chequebook chequebook.Service, wallet *wallet.Service, batchStore postage.Storer, scrubber *localstore.Scrubber, localStore *localstore.DB) {
 	s.p2p = p2p
 	s.pingpong = pingpong
 	s.topologyDriver = topologyDriver
 	s.storer = storer
 	s.tags = tags
 	s.accounting = accounting
+	s.ledger = ledger
+	s.budgets = budgets
 	s.chequebookEnabled = chequebookEnabled
 	s.chequebook = chequebook
 	s.swap = swap
+	s.wallet = wallet
 	s.lightNodes = lightNodes
 	s.batchStore = batchStore
+	s.scrubber = scrubber
+	s.localStore = localStore
 	s.pseudosettle = pseudosettle
+	s.timesettlements = timeSettlements(pseudosettle)
 
 	s.setRouter(s.newRouter())
 }
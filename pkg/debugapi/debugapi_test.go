@@ -16,11 +16,14 @@ import (
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/accounting"
 	accountingmock "github.com/penguintop/penguin/pkg/accounting/mock"
+	"github.com/penguintop/penguin/pkg/budget"
 	"github.com/penguintop/penguin/pkg/crypto"
 	"github.com/penguintop/penguin/pkg/debugapi"
 	"github.com/penguintop/penguin/pkg/jsonhttp"
 	"github.com/penguintop/penguin/pkg/jsonhttp/jsonhttptest"
+	"github.com/penguintop/penguin/pkg/localstore"
 	"github.com/penguintop/penguin/pkg/logging"
 	p2pmock "github.com/penguintop/penguin/pkg/p2p/mock"
 	"github.com/penguintop/penguin/pkg/pingpong"
@@ -33,6 +36,7 @@ import (
 	"github.com/penguintop/penguin/pkg/tags"
 	"github.com/penguintop/penguin/pkg/topology/lightnode"
 	topologymock "github.com/penguintop/penguin/pkg/topology/mock"
+	"github.com/penguintop/penguin/pkg/wallet"
 	"github.com/multiformats/go-multiaddr"
 	"resenje.org/web"
 )
@@ -50,6 +54,11 @@ type testServerOptions struct {
 	TopologyOpts       []topologymock.Option
 	Tags               *tags.Tags
 	AccountingOpts     []accountingmock.Option
+	Ledger             *accounting.Ledger
+	Budgets            *budget.Service
+	Wallet             *wallet.Service
+	Scrubber           *localstore.Scrubber
+	LocalStore         *localstore.DB
 	SettlementOpts     []swapmock.Option
 	ChequebookOpts     []chequebookmock.Option
 	SwapOpts           []swapmock.Option
@@ -69,7 +78,7 @@ func newTestServer(t *testing.T, o testServerOptions) *testServer {
 	swapserv := swapmock.New(o.SwapOpts...)
 	ln := lightnode.NewContainer(o.Overlay)
 	s := debugapi.New(o.Overlay, o.PublicKey, o.PSSPublicKey, o.EthereumAddress, logging.New(ioutil.Discard, 0), nil, o.CORSAllowedOrigins)
-	s.Configure(o.P2P, o.Pingpong, topologyDriver, ln, o.Storer, o.Tags, acc, settlement, true, swapserv, chequebook, o.BatchStore)
+	s.Configure(o.P2P, o.Pingpong, topologyDriver, ln, o.Storer, o.Tags, acc, o.Ledger, o.Budgets, settlement, true, swapserv, chequebook, o.Wallet, o.BatchStore, o.Scrubber, o.LocalStore)
 	ts := httptest.NewServer(s)
 	t.Cleanup(ts.Close)
 
@@ -168,7 +177,7 @@ func TestServer_Configure(t *testing.T) {
 		}),
 	)
 
-	s.Configure(o.P2P, o.Pingpong, topologyDriver, ln, o.Storer, o.Tags, acc, settlement, true, swapserv, chequebook, nil)
+	s.Configure(o.P2P, o.Pingpong, topologyDriver, ln, o.Storer, o.Tags, acc, nil, nil, settlement, true, swapserv, chequebook, nil, nil, nil, nil)
 
 	testBasicRouter(t, client)
 	jsonhttptest.Request(t, client, http.MethodGet, "/readiness", http.StatusOK,
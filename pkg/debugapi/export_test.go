@@ -26,6 +26,20 @@ type (
 	SwapCashoutStatusResponse         = swapCashoutStatusResponse
 	SwapCashoutStatusResult           = swapCashoutStatusResult
 	TagResponse                       = tagResponse
+	LedgerResponse                    = ledgerResponse
+	LedgerPruneResponse               = ledgerPruneResponse
+	BudgetResponse                    = budgetResponse
+	BudgetsResponse                   = budgetsResponse
+	WalletResponse                    = walletResponse
+	WalletFeeResponse                 = walletFeeResponse
+	WalletTransferResponse            = walletTransferResponse
+	WalletHistoryResponse             = walletHistoryResponse
+	ScrubberStatusResponse            = scrubberStatusResponse
+	QuarantinedChunkResponse          = quarantinedChunkResponse
+	QuarantinedChunksResponse         = quarantinedChunksResponse
+	BatchStorageResponse              = batchStorageResponse
+	OwnerStorageResponse              = ownerStorageResponse
+	StorageBatchesResponse            = storageBatchesResponse
 )
 
 var (
@@ -36,4 +50,10 @@ var (
 	ErrCantSettlements     = errCantSettlements
 	ErrChequebookBalance   = errChequebookBalance
 	ErrInvalidAddress      = errInvalidAddress
+	ErrBadLedgerFilter     = errBadLedgerFilter
+	ErrBadLedgerAge        = errBadLedgerAge
+	ErrNoBudget            = errNoBudget
+	ErrBadBudgetLimits     = errBadBudgetLimits
+	ErrWalletInsufficient  = errWalletInsufficient
+	ErrWalletBadAddress    = errWalletBadAddress
 )
@@ -0,0 +1,146 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debugapi
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/accounting"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/penguin"
+)
+
+var (
+	errCantLedger      = "cannot get ledger entries"
+	errCantPruneLedger = "cannot prune ledger"
+	errBadLedgerFilter = "invalid ledger filter"
+	errBadLedgerFormat = "invalid ledger format"
+	errBadLedgerAge    = "invalid ledger age"
+)
+
+type ledgerResponse struct {
+	Entries []accounting.LedgerEntry `json:"entries"`
+}
+
+type ledgerPruneResponse struct {
+	Pruned int `json:"pruned"`
+}
+
+var ledgerCSVHeader = []string{"timestamp", "peer", "action", "protocol", "chunk", "client", "amount"}
+
+// ledgerHandler returns the accounting ledger entries selected by the peer,
+// protocol, client, from and to query parameters, as JSON or, with format=csv, as CSV.
+func (s *Service) ledgerHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLedgerFilter(r)
+	if err != nil {
+		s.logger.Debugf("debug api: ledger: %v", err)
+		jsonhttp.BadRequest(w, errBadLedgerFilter)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		jsonhttp.BadRequest(w, errBadLedgerFormat)
+		return
+	}
+
+	entries, err := s.ledger.Entries(filter)
+	if err != nil {
+		s.logger.Debugf("debug api: ledger: %v", err)
+		s.logger.Error("debug api: can not get ledger entries")
+		jsonhttp.InternalServerError(w, errCantLedger)
+		return
+	}
+
+	if format != "csv" {
+		if entries == nil {
+			entries = []accounting.LedgerEntry{}
+		}
+		jsonhttp.OK(w, ledgerResponse{Entries: entries})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="ledger.csv"`)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(ledgerCSVHeader); err != nil {
+		s.logger.Debugf("debug api: ledger: write csv: %v", err)
+		return
+	}
+	for _, e := range entries {
+		record := []string{
+			e.Timestamp.Format(time.RFC3339Nano),
+			e.Peer.String(),
+			e.Action,
+			e.Protocol,
+			e.Chunk.String(),
+			e.Client,
+			e.Amount.String(),
+		}
+		if err := cw.Write(record); err != nil {
+			s.logger.Debugf("debug api: ledger: write csv: %v", err)
+			return
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		s.logger.Debugf("debug api: ledger: write csv: %v", err)
+	}
+}
+
+// ledgerPruneHandler removes the ledger entries older than the duration in
+// the olderThan query parameter.
+func (s *Service) ledgerPruneHandler(w http.ResponseWriter, r *http.Request) {
+	age, err := time.ParseDuration(r.URL.Query().Get("olderThan"))
+	if err != nil || age < 0 {
+		s.logger.Debugf("debug api: ledger prune: invalid age: %v", err)
+		jsonhttp.BadRequest(w, errBadLedgerAge)
+		return
+	}
+
+	pruned, err := s.ledger.Prune(time.Now().Add(-age))
+	if err != nil {
+		s.logger.Debugf("debug api: ledger prune: %v", err)
+		s.logger.Error("debug api: can not prune ledger")
+		jsonhttp.InternalServerError(w, errCantPruneLedger)
+		return
+	}
+
+	jsonhttp.OK(w, ledgerPruneResponse{Pruned: pruned})
+}
+
+// parseLedgerFilter parses the ledger filter from the query parameters. The
+// time range is given in unix seconds.
+func parseLedgerFilter(r *http.Request) (filter accounting.LedgerFilter, err error) {
+	query := r.URL.Query()
+
+	if peer := query.Get("peer"); peer != "" {
+		filter.Peer, err = penguin.ParseHexAddress(peer)
+		if err != nil {
+			return filter, err
+		}
+	}
+	filter.Protocol = query.Get("protocol")
+	filter.Client = query.Get("client")
+
+	if from := query.Get("from"); from != "" {
+		ts, err := strconv.ParseInt(from, 10, 64)
+		if err != nil {
+			return filter, err
+		}
+		filter.From = time.Unix(ts, 0)
+	}
+	if to := query.Get("to"); to != "" {
+		ts, err := strconv.ParseInt(to, 10, 64)
+		if err != nil {
+			return filter, err
+		}
+		filter.To = time.Unix(ts, 0)
+	}
+	return filter, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debugapi_test
+
+import (
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/accounting"
+	"github.com/penguintop/penguin/pkg/debugapi"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/jsonhttp/jsonhttptest"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/statestore/mock"
+)
+
+func TestLedger(t *testing.T) {
+	store := mock.NewStateStore()
+	ledger := accounting.NewLedger(store, logging.New(ioutil.Discard, 0))
+
+	peer := penguin.MustParseHexAddress("aa")
+	chunk := penguin.MustParseHexAddress("bb")
+	ledger.Record(peer, accounting.LedgerActionCredit, accounting.Provenance{Protocol: accounting.ProtocolRetrieval, Chunk: chunk, Client: "key"}, big.NewInt(10))
+	ledger.Record(peer, accounting.LedgerActionDebit, accounting.Provenance{Protocol: accounting.ProtocolPushSync, Chunk: chunk}, big.NewInt(20))
+
+	testServer := newTestServer(t, testServerOptions{
+		Ledger: ledger,
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var got debugapi.LedgerResponse
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/accounting/ledger?protocol=pushsync&peer=aa", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&got),
+		)
+		if len(got.Entries) != 1 {
+			t.Fatalf("got %d entries, want 1", len(got.Entries))
+		}
+		e := got.Entries[0]
+		if !e.Peer.Equal(peer) || !e.Chunk.Equal(chunk) || e.Action != accounting.LedgerActionDebit || e.Amount.Cmp(big.NewInt(20)) != 0 {
+			t.Fatalf("got entry %+v", e)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		entries, err := ledger.Entries(accounting.LedgerFilter{Protocol: accounting.ProtocolRetrieval})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "timestamp,peer,action,protocol,chunk,client,amount\n" +
+			entries[0].Timestamp.Format("2006-01-02T15:04:05.999999999Z07:00") + ",aa,credit,retrieval,bb,key,10\n"
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/accounting/ledger?client=key&format=csv", http.StatusOK,
+			jsonhttptest.WithExpectedResponse([]byte(want)),
+		)
+	})
+
+	t.Run("bad filter", func(t *testing.T) {
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/accounting/ledger?from=yesterday", http.StatusBadRequest,
+			jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
+				Message: debugapi.ErrBadLedgerFilter,
+				Code:    http.StatusBadRequest,
+			}),
+		)
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		jsonhttptest.Request(t, testServer.Client, http.MethodDelete, "/accounting/ledger?olderThan=1h", http.StatusOK,
+			jsonhttptest.WithExpectedJSONResponse(debugapi.LedgerPruneResponse{Pruned: 0}),
+		)
+		jsonhttptest.Request(t, testServer.Client, http.MethodDelete, "/accounting/ledger?olderThan=0s", http.StatusOK,
+			jsonhttptest.WithExpectedJSONResponse(debugapi.LedgerPruneResponse{Pruned: 2}),
+		)
+		jsonhttptest.Request(t, testServer.Client, http.MethodDelete, "/accounting/ledger", http.StatusBadRequest,
+			jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
+				Message: debugapi.ErrBadLedgerAge,
+				Code:    http.StatusBadRequest,
+			}),
+		)
+	})
+}
@@ -129,10 +129,38 @@ func (s *Service) newRouter() *mux.Router {
 		"GET": http.HandlerFunc(s.peerBalanceHandler),
 	})
 
+	if s.ledger != nil {
+		router.Handle("/accounting/ledger", jsonhttp.MethodHandler{
+			"GET":    http.HandlerFunc(s.ledgerHandler),
+			"DELETE": http.HandlerFunc(s.ledgerPruneHandler),
+		})
+	}
+
+	if s.budgets != nil {
+		router.Handle("/budgets", jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.budgetsHandler),
+			"PUT": http.HandlerFunc(s.budgetsGlobalSetHandler),
+		})
+		router.Handle("/budgets/{key}", jsonhttp.MethodHandler{
+			"GET":    http.HandlerFunc(s.budgetHandler),
+			"PUT":    http.HandlerFunc(s.budgetSetHandler),
+			"DELETE": http.HandlerFunc(s.budgetRemoveHandler),
+		})
+	}
+
 	router.Handle("/timesettlements", jsonhttp.MethodHandler{
 		"GET": http.HandlerFunc(s.settlementsHandlerPseudosettle),
 	})
 
+	if s.timesettlements != nil {
+		router.Handle("/timesettlements/{peer}", jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.timeSettlementPeerHandler),
+		})
+		router.Handle("/timesettlements/{peer}/history", jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.timeSettlementHistoryHandler),
+		})
+	}
+
 	if s.chequebookEnabled {
 		router.Handle("/settlements", jsonhttp.MethodHandler{
 			"GET": http.HandlerFunc(s.settlementsHandler),
@@ -169,6 +197,44 @@ func (s *Service) newRouter() *mux.Router {
 			"GET":  http.HandlerFunc(s.swapCashoutStatusHandler),
 			"POST": http.HandlerFunc(s.swapCashoutHandler),
 		})
+
+		router.Handle("/chequebook/solvency", jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.chequebookSolvencyHandler),
+		})
+
+		router.Handle("/chequebook/solvency/{peer}", jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.chequebookSolvencyPeerHandler),
+		})
+	}
+
+	if s.wallet != nil {
+		router.Handle("/wallet", jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.walletHandler),
+		})
+		router.Handle("/wallet/fee/{asset}", jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.walletFeeHandler),
+		})
+		router.Handle("/wallet/transfer/{asset}", jsonhttp.MethodHandler{
+			"POST": http.HandlerFunc(s.walletTransferHandler),
+		})
+		router.Handle("/wallet/history", jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.walletHistoryHandler),
+		})
+	}
+
+	if s.scrubber != nil {
+		router.Handle("/scrubber", jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.scrubberStatusHandler),
+		})
+		router.Handle("/scrubber/quarantine", jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.scrubberQuarantineHandler),
+		})
+	}
+
+	if s.localStore != nil {
+		router.Handle("/storage/batches", jsonhttp.MethodHandler{
+			"GET": http.HandlerFunc(s.storageBatchesHandler),
+		})
 	}
 
 	router.Handle("/tags/{id}", jsonhttp.MethodHandler{
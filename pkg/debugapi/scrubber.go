@@ -0,0 +1,90 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debugapi
+
+import (
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/penguin"
+)
+
+var errCantQuarantined = "cannot get quarantined chunks"
+
+type scrubberStatusResponse struct {
+	Running       bool      `json:"running"`
+	Passes        uint64    `json:"passes"`
+	PassStarted   time.Time `json:"passStarted"`
+	PassFinished  time.Time `json:"passFinished"`
+	Checked       uint64    `json:"checked"`
+	Unreadable    uint64    `json:"unreadable"`
+	InvalidChunks uint64    `json:"invalidChunks"`
+	InvalidStamps uint64    `json:"invalidStamps"`
+	UnknownBatch  uint64    `json:"unknownBatch"`
+	Refetched     uint64    `json:"refetched"`
+	RefetchFailed uint64    `json:"refetchFailed"`
+}
+
+type quarantinedChunkResponse struct {
+	Address     penguin.Address `json:"address"`
+	BatchID     string          `json:"batchID"`
+	Reason      string          `json:"reason"`
+	PinCounter  uint64          `json:"pinCounter"`
+	Quarantined time.Time       `json:"quarantined"`
+	Restored    bool            `json:"restored"`
+}
+
+type quarantinedChunksResponse struct {
+	Chunks []quarantinedChunkResponse `json:"chunks"`
+}
+
+// scrubberStatusHandler returns the progress and findings
+// of the localstore scrubber.
+func (s *Service) scrubberStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status := s.scrubber.Status()
+	jsonhttp.OK(w, scrubberStatusResponse{
+		Running:       status.Running,
+		Passes:        status.Passes,
+		PassStarted:   status.PassStarted,
+		PassFinished:  status.PassFinished,
+		Checked:       status.Checked,
+		Unreadable:    status.Unreadable,
+		InvalidChunks: status.InvalidChunks,
+		InvalidStamps: status.InvalidStamps,
+		UnknownBatch:  status.UnknownBatch,
+		Refetched:     status.Refetched,
+		RefetchFailed: status.RefetchFailed,
+	})
+}
+
+// scrubberQuarantineHandler returns the chunks removed
+// by the localstore scrubber.
+func (s *Service) scrubberQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	chunks, err := s.scrubber.Quarantined()
+	if err != nil {
+		jsonhttp.InternalServerError(w, errCantQuarantined)
+		s.logger.Debugf("debug api: scrubber quarantine: %v", err)
+		s.logger.Error("debug api: cannot get quarantined chunks")
+		return
+	}
+
+	resp := quarantinedChunksResponse{
+		Chunks: make([]quarantinedChunkResponse, 0, len(chunks)),
+	}
+	for _, c := range chunks {
+		resp.Chunks = append(resp.Chunks, quarantinedChunkResponse{
+			Address:     c.Address,
+			BatchID:     hex.EncodeToString(c.BatchID),
+			Reason:      c.Reason,
+			PinCounter:  c.PinCounter,
+			Quarantined: c.Quarantined,
+			Restored:    c.Restored,
+		})
+	}
+
+	jsonhttp.OK(w, resp)
+}
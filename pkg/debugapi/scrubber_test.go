@@ -0,0 +1,58 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debugapi_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/debugapi"
+	"github.com/penguintop/penguin/pkg/jsonhttp/jsonhttptest"
+	"github.com/penguintop/penguin/pkg/localstore"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/storage"
+	testingc "github.com/penguintop/penguin/pkg/storage/testing"
+)
+
+func TestScrubber(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+	db, err := localstore.New("", make([]byte, 32), nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Put(context.Background(), storage.ModePutUpload, testingc.GenerateTestRandomChunk()); err != nil {
+		t.Fatal(err)
+	}
+	scrubber := localstore.NewScrubber(db, nil, nil, localstore.ScrubberOptions{Rate: 1000}, logger)
+	if err := scrubber.Scrub(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	testServer := newTestServer(t, testServerOptions{
+		Scrubber: scrubber,
+	})
+
+	t.Run("status", func(t *testing.T) {
+		var got debugapi.ScrubberStatusResponse
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/scrubber", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&got),
+		)
+		if got.Running || got.Passes != 1 || got.Checked != 1 || got.InvalidChunks != 0 {
+			t.Fatalf("got status %+v, want one pass checking one intact chunk", got)
+		}
+	})
+
+	t.Run("quarantine", func(t *testing.T) {
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/scrubber/quarantine", http.StatusOK,
+			jsonhttptest.WithExpectedJSONResponse(debugapi.QuarantinedChunksResponse{
+				Chunks: []debugapi.QuarantinedChunkResponse{},
+			}),
+		)
+	})
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debugapi
+
+import (
+	"encoding/hex"
+	"net/http"
+	"sort"
+
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+)
+
+var errCantStorageUsage = "cannot get storage usage"
+
+type batchStorageResponse struct {
+	BatchID string `json:"batchID"`
+	Owner   string `json:"owner"`
+	Chunks  uint64 `json:"chunks"`
+	Size    uint64 `json:"size"`
+	Pinned  uint64 `json:"pinned"`
+	Reserve uint64 `json:"reserve"`
+}
+
+type ownerStorageResponse struct {
+	Owner   string `json:"owner"`
+	Batches int    `json:"batches"`
+	Chunks  uint64 `json:"chunks"`
+	Size    uint64 `json:"size"`
+	Pinned  uint64 `json:"pinned"`
+	Reserve uint64 `json:"reserve"`
+}
+
+type storageBatchesResponse struct {
+	Batches []batchStorageResponse `json:"batches"`
+	Owners  []ownerStorageResponse `json:"owners"`
+}
+
+// storageBatchesHandler returns the local storage used by every postage
+// batch with stored chunks and the totals of their owners. The owner of
+// a batch which is not in the batch store is reported as empty.
+func (s *Service) storageBatchesHandler(w http.ResponseWriter, r *http.Request) {
+	usage, err := s.localStore.BatchesUsage()
+	if err != nil {
+		jsonhttp.InternalServerError(w, errCantStorageUsage)
+		s.logger.Debugf("debug api: storage batches: %v", err)
+		s.logger.Error("debug api: cannot get storage usage")
+		return
+	}
+
+	resp := storageBatchesResponse{
+		Batches: make([]batchStorageResponse, 0, len(usage)),
+		Owners:  make([]ownerStorageResponse, 0),
+	}
+	owners := make(map[string]*ownerStorageResponse)
+	for _, u := range usage {
+		var owner string
+		if s.batchStore != nil {
+			b, err := s.batchStore.Get(u.BatchID)
+			if err != nil {
+				s.logger.Debugf("debug api: storage batches: batch %x: %v", u.BatchID, err)
+			} else {
+				owner = hex.EncodeToString(b.Owner)
+			}
+		}
+		resp.Batches = append(resp.Batches, batchStorageResponse{
+			BatchID: hex.EncodeToString(u.BatchID),
+			Owner:   owner,
+			Chunks:  u.Chunks,
+			Size:    u.Size,
+			Pinned:  u.Pinned,
+			Reserve: u.Reserve,
+		})
+
+		o, ok := owners[owner]
+		if !ok {
+			o = &ownerStorageResponse{Owner: owner}
+			owners[owner] = o
+		}
+		o.Batches++
+		o.Chunks += u.Chunks
+		o.Size += u.Size
+		o.Pinned += u.Pinned
+		o.Reserve += u.Reserve
+	}
+	for _, o := range owners {
+		resp.Owners = append(resp.Owners, *o)
+	}
+	// the owners using the most storage first
+	sort.Slice(resp.Owners, func(i, j int) bool {
+		if resp.Owners[i].Size != resp.Owners[j].Size {
+			return resp.Owners[i].Size > resp.Owners[j].Size
+		}
+		return resp.Owners[i].Owner < resp.Owners[j].Owner
+	})
+
+	jsonhttp.OK(w, resp)
+}
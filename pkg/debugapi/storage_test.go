@@ -0,0 +1,103 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debugapi_test
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/debugapi"
+	"github.com/penguintop/penguin/pkg/jsonhttp/jsonhttptest"
+	"github.com/penguintop/penguin/pkg/localstore"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/postage"
+	"github.com/penguintop/penguin/pkg/postage/batchstore/mock"
+	postagetesting "github.com/penguintop/penguin/pkg/postage/testing"
+	"github.com/penguintop/penguin/pkg/storage"
+	testingc "github.com/penguintop/penguin/pkg/storage/testing"
+)
+
+func TestStorageBatches(t *testing.T) {
+	db, err := localstore.New("", make([]byte, 32), nil, logging.New(ioutil.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	batch := postagetesting.MustNewBatch()
+	batchStore := mock.New()
+	if err := batchStore.Put(batch, batch.Value, batch.Depth); err != nil {
+		t.Fatal(err)
+	}
+	unknownID := postagetesting.MustNewID()
+
+	put := func(id []byte, count int) (size uint64) {
+		t.Helper()
+		for i := 0; i < count; i++ {
+			ch := testingc.GenerateTestRandomChunk().WithStamp(postage.NewStamp(id, postagetesting.MustNewSignature()))
+			if _, err := db.Put(context.Background(), storage.ModePutUpload, ch); err != nil {
+				t.Fatal(err)
+			}
+			size += uint64(len(ch.Data()))
+		}
+		return size
+	}
+	batchSize := put(batch.ID, 3)
+	unknownSize := put(unknownID, 1)
+
+	want := []debugapi.BatchStorageResponse{
+		{BatchID: hex.EncodeToString(batch.ID), Owner: hex.EncodeToString(batch.Owner), Chunks: 3, Size: batchSize},
+		{BatchID: hex.EncodeToString(unknownID), Chunks: 1, Size: unknownSize},
+	}
+	if hex.EncodeToString(unknownID) < hex.EncodeToString(batch.ID) {
+		want[0], want[1] = want[1], want[0]
+	}
+	owners := []debugapi.OwnerStorageResponse{
+		{Owner: hex.EncodeToString(batch.Owner), Batches: 1, Chunks: 3, Size: batchSize},
+		{Owner: "", Batches: 1, Chunks: 1, Size: unknownSize},
+	}
+
+	testServer := newTestServer(t, testServerOptions{
+		BatchStore: batchStore,
+		LocalStore: db,
+	})
+
+	jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/storage/batches", http.StatusOK,
+		jsonhttptest.WithExpectedJSONResponse(debugapi.StorageBatchesResponse{
+			Batches: want,
+			Owners:  owners,
+		}),
+	)
+
+	t.Run("pinned", func(t *testing.T) {
+		ch := testingc.GenerateTestRandomChunk().WithStamp(postage.NewStamp(unknownID, postagetesting.MustNewSignature()))
+		if _, err := db.Put(context.Background(), storage.ModePutUploadPin, ch); err != nil {
+			t.Fatal(err)
+		}
+
+		var got debugapi.StorageBatchesResponse
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/storage/batches", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&got),
+		)
+		for _, b := range got.Batches {
+			if b.BatchID != hex.EncodeToString(unknownID) {
+				continue
+			}
+			if b.Chunks != 2 || b.Pinned != 1 || b.Reserve != 0 {
+				t.Fatalf("got usage %+v, want 2 chunks with 1 pinned", b)
+			}
+			return
+		}
+		t.Fatalf("batch %x not found", unknownID)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		testServer := newTestServer(t, testServerOptions{})
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/storage/batches", http.StatusNotFound)
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debugapi
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/settlement"
+	"github.com/penguintop/penguin/pkg/settlement/pseudosettle"
+)
+
+var (
+	errCantTimeSettlementPeer    = "can not get time settlement for peer"
+	errCantTimeSettlementHistory = "can not get time settlement history for peer"
+)
+
+type timeSettlementPeerResponse struct {
+	Peer            string   `json:"peer"`
+	FullNode        bool     `json:"fullNode"`
+	RefreshRate     *big.Int `json:"refreshRate"`
+	Allowance       *big.Int `json:"allowance"`
+	LastReceived    int64    `json:"lastReceived"`
+	LastSent        int64    `json:"lastSent"`
+	RefusedReceived uint64   `json:"refusedReceived"`
+	RefusedSent     uint64   `json:"refusedSent"`
+}
+
+type timeSettlementHistoryResponse struct {
+	Peer         string                     `json:"peer"`
+	Refreshments []pseudosettle.Refreshment `json:"refreshments"`
+}
+
+// timeSettlements returns the time based settlement if it supports the
+// introspection of single peers.
+func timeSettlements(s settlement.Interface) pseudosettle.Interface {
+	ts, _ := s.(pseudosettle.Interface)
+	return ts
+}
+
+// timeSettlementPeerHandler returns the time based allowance of a connected
+// peer.
+func (s *Service) timeSettlementPeerHandler(w http.ResponseWriter, r *http.Request) {
+	addr := mux.Vars(r)["peer"]
+	peer, err := penguin.ParseHexAddress(addr)
+	if err != nil {
+		s.logger.Debugf("debug api: time settlement peer: invalid peer address %s: %v", addr, err)
+		s.logger.Errorf("debug api: time settlement peer: invalid peer address %s", addr)
+		jsonhttp.NotFound(w, errInvalidAddress)
+		return
+	}
+
+	allowance, err := s.timesettlements.PeerAllowance(peer)
+	if err != nil {
+		if errors.Is(err, pseudosettle.ErrNoPseudoSettlePeer) {
+			jsonhttp.NotFound(w, pseudosettle.ErrNoPseudoSettlePeer)
+			return
+		}
+		s.logger.Debugf("debug api: time settlement peer: get peer %s allowance: %v", peer.String(), err)
+		s.logger.Errorf("debug api: time settlement peer: can't get peer %s allowance", peer.String())
+		jsonhttp.InternalServerError(w, errCantTimeSettlementPeer)
+		return
+	}
+
+	jsonhttp.OK(w, timeSettlementPeerResponse{
+		Peer:            peer.String(),
+		FullNode:        allowance.FullNode,
+		RefreshRate:     allowance.RefreshRate,
+		Allowance:       allowance.Allowance,
+		LastReceived:    allowance.LastReceived,
+		LastSent:        allowance.LastSent,
+		RefusedReceived: allowance.RefusedReceived,
+		RefusedSent:     allowance.RefusedSent,
+	})
+}
+
+// timeSettlementHistoryHandler returns the most recent refreshments with a
+// peer, newest first.
+func (s *Service) timeSettlementHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	addr := mux.Vars(r)["peer"]
+	peer, err := penguin.ParseHexAddress(addr)
+	if err != nil {
+		s.logger.Debugf("debug api: time settlement history: invalid peer address %s: %v", addr, err)
+		s.logger.Errorf("debug api: time settlement history: invalid peer address %s", addr)
+		jsonhttp.NotFound(w, errInvalidAddress)
+		return
+	}
+
+	history, err := s.timesettlements.History(peer)
+	if err != nil {
+		s.logger.Debugf("debug api: time settlement history: get peer %s history: %v", peer.String(), err)
+		s.logger.Errorf("debug api: time settlement history: can't get peer %s history", peer.String())
+		jsonhttp.InternalServerError(w, errCantTimeSettlementHistory)
+		return
+	}
+
+	jsonhttp.OK(w, timeSettlementHistoryResponse{
+		Peer:         peer.String(),
+		Refreshments: history,
+	})
+}
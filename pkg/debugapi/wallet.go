@@ -0,0 +1,198 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debugapi
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/wallet"
+	"github.com/penguintop/penguin/pkg/xwcfmt"
+)
+
+var (
+	errCantWalletBalance  = "cannot get wallet balance"
+	errCantWalletTransfer = "cannot transfer"
+	errCantWalletHistory  = "cannot get wallet history"
+	errWalletUnknownAsset = "unknown asset"
+	errWalletNoToken      = "pen token not available"
+	errWalletBadAddress   = "invalid address"
+	errWalletBadAmount    = "invalid amount"
+	errWalletInsufficient = "insufficient funds"
+)
+
+type walletResponse struct {
+	Address string   `json:"address"`
+	XWC     *big.Int `json:"xwc"`
+	PEN     *big.Int `json:"pen,omitempty"`
+}
+
+type walletFeeResponse struct {
+	Asset    string   `json:"asset"`
+	Fee      *big.Int `json:"fee"`
+	GasPrice *big.Int `json:"gasPrice"`
+	GasLimit uint64   `json:"gasLimit"`
+	Total    *big.Int `json:"total"`
+}
+
+type walletTransferResponse struct {
+	TransactionHash string    `json:"transactionHash,omitempty"`
+	Asset           string    `json:"asset"`
+	From            string    `json:"from"`
+	To              string    `json:"to"`
+	Amount          *big.Int  `json:"amount"`
+	Incoming        bool      `json:"incoming"`
+	Fee             *big.Int  `json:"fee"`
+	Status          string    `json:"status"`
+	BlockNumber     uint64    `json:"blockNumber,omitempty"`
+	Created         time.Time `json:"created"`
+}
+
+type walletHistoryResponse struct {
+	Transfers []walletTransferResponse `json:"transfers"`
+}
+
+func newWalletFeeResponse(fee wallet.Fee) walletFeeResponse {
+	return walletFeeResponse{
+		Asset:    string(fee.Asset),
+		Fee:      fee.Fee,
+		GasPrice: fee.GasPrice,
+		GasLimit: fee.GasLimit,
+		Total:    fee.Total,
+	}
+}
+
+func newWalletTransferResponse(t wallet.Transfer) walletTransferResponse {
+	from, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(t.From[:]))
+	to, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(t.To[:]))
+	resp := walletTransferResponse{
+		Asset:       string(t.Asset),
+		From:        from,
+		To:          to,
+		Amount:      t.Amount,
+		Incoming:    t.Incoming,
+		Fee:         t.Fee,
+		Status:      string(t.Status),
+		BlockNumber: t.BlockNumber,
+		Created:     t.Created,
+	}
+	// token transfers not sent through the wallet are known by their event
+	if t.TxHash != (common.Hash{}) {
+		resp.TransactionHash = t.TxHash.String()
+	}
+	return resp
+}
+
+// walletHandler returns the XWC and PEN balances of the node account.
+func (s *Service) walletHandler(w http.ResponseWriter, r *http.Request) {
+	balances, err := s.wallet.Balances(r.Context())
+	if err != nil {
+		jsonhttp.InternalServerError(w, errCantWalletBalance)
+		s.logger.Debugf("debug api: wallet balance: %v", err)
+		s.logger.Error("debug api: cannot get wallet balance")
+		return
+	}
+
+	address := s.wallet.Address()
+	xwcAddr, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(address[:]))
+	jsonhttp.OK(w, walletResponse{
+		Address: xwcAddr,
+		XWC:     balances.XWC,
+		PEN:     balances.PEN,
+	})
+}
+
+// walletFeeHandler previews the cost in XWC of transferring the asset.
+func (s *Service) walletFeeHandler(w http.ResponseWriter, r *http.Request) {
+	asset, err := wallet.ParseAsset(mux.Vars(r)["asset"])
+	if err != nil {
+		jsonhttp.BadRequest(w, errWalletUnknownAsset)
+		return
+	}
+
+	fee, err := s.wallet.Fee(asset)
+	if err != nil {
+		s.walletError(w, err)
+		return
+	}
+
+	jsonhttp.OK(w, newWalletFeeResponse(fee))
+}
+
+// walletTransferHandler sends the amount of the asset from the node account
+// to the address in the query.
+func (s *Service) walletTransferHandler(w http.ResponseWriter, r *http.Request) {
+	asset, err := wallet.ParseAsset(mux.Vars(r)["asset"])
+	if err != nil {
+		jsonhttp.BadRequest(w, errWalletUnknownAsset)
+		return
+	}
+
+	addrHex, err := xwcfmt.XwcAddrToHexAddr(r.URL.Query().Get("address"))
+	if err != nil {
+		jsonhttp.BadRequest(w, errWalletBadAddress)
+		s.logger.Debugf("debug api: wallet transfer: parse address: %v", err)
+		return
+	}
+	to := common.HexToAddress(addrHex)
+
+	amount, ok := big.NewInt(0).SetString(r.URL.Query().Get("amount"), 10)
+	if !ok {
+		jsonhttp.BadRequest(w, errWalletBadAmount)
+		return
+	}
+
+	transfer, err := s.wallet.Transfer(r.Context(), asset, to, amount)
+	if err != nil {
+		s.walletError(w, err)
+		return
+	}
+
+	jsonhttp.OK(w, newWalletTransferResponse(transfer))
+}
+
+// walletHistoryHandler returns the transfers into and out of the node
+// account, newest first.
+func (s *Service) walletHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	transfers, err := s.wallet.History(r.Context())
+	if err != nil {
+		jsonhttp.InternalServerError(w, errCantWalletHistory)
+		s.logger.Debugf("debug api: wallet history: %v", err)
+		s.logger.Error("debug api: cannot get wallet history")
+		return
+	}
+
+	resp := walletHistoryResponse{
+		Transfers: make([]walletTransferResponse, 0, len(transfers)),
+	}
+	for _, t := range transfers {
+		resp.Transfers = append(resp.Transfers, newWalletTransferResponse(t))
+	}
+
+	jsonhttp.OK(w, resp)
+}
+
+func (s *Service) walletError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, wallet.ErrUnknownAsset):
+		jsonhttp.BadRequest(w, errWalletUnknownAsset)
+	case errors.Is(err, wallet.ErrNoToken):
+		jsonhttp.NotFound(w, errWalletNoToken)
+	case errors.Is(err, wallet.ErrInvalidAmount):
+		jsonhttp.BadRequest(w, errWalletBadAmount)
+	case errors.Is(err, wallet.ErrInsufficientFunds):
+		jsonhttp.BadRequest(w, errWalletInsufficient)
+	default:
+		jsonhttp.InternalServerError(w, errCantWalletTransfer)
+		s.logger.Debugf("debug api: wallet transfer: %v", err)
+		s.logger.Error("debug api: cannot transfer")
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debugapi_test
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/debugapi"
+	"github.com/penguintop/penguin/pkg/jsonhttp"
+	"github.com/penguintop/penguin/pkg/jsonhttp/jsonhttptest"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/settlement/swap/erc20"
+	erc20mock "github.com/penguintop/penguin/pkg/settlement/swap/erc20/mock"
+	"github.com/penguintop/penguin/pkg/statestore/mock"
+	"github.com/penguintop/penguin/pkg/transaction"
+	"github.com/penguintop/penguin/pkg/transaction/backendmock"
+	transactionmock "github.com/penguintop/penguin/pkg/transaction/mock"
+	"github.com/penguintop/penguin/pkg/wallet"
+	"github.com/penguintop/penguin/pkg/xwcfmt"
+	"github.com/penguintop/penguin/pkg/xwctypes"
+)
+
+func TestWallet(t *testing.T) {
+	nodeAddress := common.HexToAddress("0xab")
+	recipient := common.HexToAddress("0xcd")
+	recipientXwc, err := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(recipient[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	txHash := common.HexToHash("0x01")
+
+	backend := backendmock.New(
+		backendmock.WithBalanceAtFunc(func(ctx context.Context, address common.Address, block *big.Int) (*big.Int, error) {
+			return big.NewInt(5000000), nil
+		}),
+	)
+	token := erc20mock.New(
+		erc20mock.WithBalanceOfFunc(func(ctx context.Context, address common.Address) (*big.Int, error) {
+			return big.NewInt(700), nil
+		}),
+	)
+	transactionService := transactionmock.New(
+		transactionmock.WithSendFunc(func(ctx context.Context, request *transaction.TxRequest) (common.Hash, error) {
+			return txHash, nil
+		}),
+	)
+	tokenFunc := func(ctx context.Context) (erc20.Service, common.Address, error) {
+		return token, common.HexToAddress("0xef"), nil
+	}
+	w := wallet.New(walletBackend{backend}, transactionService, tokenFunc, nodeAddress, mock.NewStateStore(), logging.New(ioutil.Discard, 0))
+
+	testServer := newTestServer(t, testServerOptions{
+		Wallet: w,
+	})
+
+	t.Run("balance", func(t *testing.T) {
+		var got debugapi.WalletResponse
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/wallet", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&got),
+		)
+		if got.XWC.Int64() != 5000000 || got.PEN.Int64() != 700 {
+			t.Fatalf("got wallet %+v", got)
+		}
+	})
+
+	t.Run("fee", func(t *testing.T) {
+		var got debugapi.WalletFeeResponse
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/wallet/fee/xwc", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&got),
+		)
+		if got.Total.Int64() != transaction.Fee {
+			t.Fatalf("got fee %d, want %d", got.Total, transaction.Fee)
+		}
+	})
+
+	t.Run("transfer", func(t *testing.T) {
+		jsonhttptest.Request(t, testServer.Client, http.MethodPost, "/wallet/transfer/xwc?address=0xcd&amount=10", http.StatusBadRequest,
+			jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
+				Message: debugapi.ErrWalletBadAddress,
+				Code:    http.StatusBadRequest,
+			}),
+		)
+		jsonhttptest.Request(t, testServer.Client, http.MethodPost, "/wallet/transfer/xwc?address="+recipientXwc+"&amount=4000000", http.StatusBadRequest,
+			jsonhttptest.WithExpectedJSONResponse(jsonhttp.StatusResponse{
+				Message: debugapi.ErrWalletInsufficient,
+				Code:    http.StatusBadRequest,
+			}),
+		)
+
+		var got debugapi.WalletTransferResponse
+		jsonhttptest.Request(t, testServer.Client, http.MethodPost, "/wallet/transfer/xwc?address="+recipientXwc+"&amount=10", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&got),
+		)
+		if got.TransactionHash != txHash.String() || got.To != recipientXwc || got.Incoming || got.Status != string(wallet.StatusPending) {
+			t.Fatalf("got transfer %+v", got)
+		}
+
+		var history debugapi.WalletHistoryResponse
+		jsonhttptest.Request(t, testServer.Client, http.MethodGet, "/wallet/history", http.StatusOK,
+			jsonhttptest.WithUnmarshalJSONResponse(&history),
+		)
+		if len(history.Transfers) != 1 || history.Transfers[0].TransactionHash != txHash.String() {
+			t.Fatalf("got history %+v", history)
+		}
+	})
+}
+
+// walletBackend is a backend without contract events.
+type walletBackend struct {
+	transaction.Backend
+}
+
+func (walletBackend) GetContractEventsInRange(ctx context.Context, account common.Address, start, to uint64) ([]xwctypes.RpcEventJson, error) {
+	return nil, nil
+}
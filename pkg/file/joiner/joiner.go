@@ -57,7 +57,7 @@ func New(ctx context.Context, getter storage.Getter, address penguin.Address) (f
 }
 
 // Read is called by the consumer to retrieve the joined data.
-// It must be called with a buffer equal to the maximum chunk size.
+// At most len(b) bytes are read.
 func (j *joiner) Read(b []byte) (n int, err error) {
 	read, err := j.ReadAt(b, j.off)
 	if err != nil && err != io.EOF {
@@ -68,13 +68,20 @@ func (j *joiner) Read(b []byte) (n int, err error) {
 	return read, err
 }
 
+// ReadAt reads len(b) bytes of the joined data starting at the offset off.
+// Only the intermediate chunks on the path to the requested data range are
+// retrieved, which makes random access reads proportional to the read size
+// and not to the offset.
 func (j *joiner) ReadAt(b []byte, off int64) (read int, err error) {
 	// since offset is int64 and penguin spans are uint64 it means we cannot seek beyond int64 max value
 	if off >= j.span {
 		return 0, io.EOF
 	}
+	if off < 0 {
+		return 0, errOffset
+	}
 
-	readLen := int64(cap(b))
+	readLen := int64(len(b))
 	if readLen > j.span-off {
 		readLen = j.span - off
 	}
@@ -184,18 +191,15 @@ func subtrieSection(data []byte, startIdx, refLen int, subtrieSize int64) int64
 var errWhence = errors.New("seek: invalid whence")
 var errOffset = errors.New("seek: invalid offset")
 
+// Seek sets the offset for the next Read. It does not retrieve any chunks,
+// they are fetched lazily by the following Read.
 func (j *joiner) Seek(offset int64, whence int) (int64, error) {
 	switch whence {
-	case 0:
-		offset += 0
-	case 1:
+	case io.SeekStart:
+	case io.SeekCurrent:
 		offset += j.off
-	case 2:
-
-		offset = j.span - offset
-		if offset < 0 {
-			return 0, io.EOF
-		}
+	case io.SeekEnd:
+		offset += j.span
 	default:
 		return 0, errWhence
 	}
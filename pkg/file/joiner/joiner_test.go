@@ -346,7 +346,7 @@ func TestSeek(t *testing.T) {
 				if exp == 0 {
 					exp = 1
 				}
-				n, err := j.Seek(exp, io.SeekEnd)
+				n, err := j.Seek(-exp, io.SeekEnd)
 				if err != nil {
 					t.Fatalf("seek from end, exp %d size %d error: %v", exp, tc.size, err)
 				}
@@ -830,3 +830,101 @@ func TestJoinerIterateChunkAddresses(t *testing.T) {
 		checkAddressFound(t, foundAddresses, createdAddress)
 	}
 }
+
+// TestJoinerReadAtFetchesPath tests that a read at an offset retrieves only
+// the intermediate chunks on the path to the requested data and the data
+// chunks that hold it.
+func TestJoinerReadAtFetchesPath(t *testing.T) {
+	store := mock.NewStorer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// two levels of intermediate chunks, root referencing two of them
+	size := int64(200 * penguin.ChunkSize)
+	data, err := ioutil.ReadAll(io.LimitReader(mrand.New(mrand.NewSource(time.Now().UnixNano())), size))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := splitter.NewSimpleSplitter(store, storage.ModePutUpload)
+	addr, err := s.Split(ctx, ioutil.NopCloser(bytes.NewReader(data)), size, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter := &countingGetter{Getter: store}
+	j, _, err := joiner.New(ctx, getter, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getter.reset()
+
+	off := int64(150*penguin.ChunkSize + 10)
+	if _, err := j.Seek(off, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if got := getter.count(); got != 0 {
+		t.Fatalf("seek fetched %d chunks, want 0", got)
+	}
+
+	b := make([]byte, 100)
+	n, err := j.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(b) {
+		t.Fatalf("got %d bytes, want %d", n, len(b))
+	}
+	if !bytes.Equal(b, data[off:off+int64(n)]) {
+		t.Fatal("data mismatch")
+	}
+
+	// one intermediate chunk and one data chunk
+	if got := getter.count(); got != 2 {
+		t.Fatalf("read fetched %d chunks, want 2", got)
+	}
+
+	// negative offset from the end
+	n64, err := j.Seek(-100, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n64 != size-100 {
+		t.Fatalf("seek from end got %d, want %d", n64, size-100)
+	}
+
+	// beyond the end
+	if _, err := j.Seek(1, io.SeekEnd); err != io.EOF {
+		t.Fatalf("seek past the end got error %v, want %v", err, io.EOF)
+	}
+	// before the start
+	if _, err := j.Seek(-size-1, io.SeekEnd); err == nil {
+		t.Fatal("seek before the start succeeded")
+	}
+}
+
+type countingGetter struct {
+	storage.Getter
+	mu sync.Mutex
+	n  int
+}
+
+func (g *countingGetter) Get(ctx context.Context, mode storage.ModeGet, addr penguin.Address) (penguin.Chunk, error) {
+	g.mu.Lock()
+	g.n++
+	g.mu.Unlock()
+	return g.Getter.Get(ctx, mode, addr)
+}
+
+func (g *countingGetter) count() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.n
+}
+
+func (g *countingGetter) reset() {
+	g.mu.Lock()
+	g.n = 0
+	g.mu.Unlock()
+}
@@ -0,0 +1,345 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/sharky"
+	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// consistencyReport describes the index drift repaired
+// by the consistency check.
+type consistencyReport struct {
+	// entries removed from the indexes as their
+	// chunks are not in the retrieval data index
+	pullOrphans    int
+	pushOrphans    int
+	gcOrphans      int
+	accessOrphans  int
+	postageOrphans int
+	// gc index entries removed as their access timestamp
+	// is not the one of the retrieval access index
+	gcStale int
+	// stored chunks which were neither in the gc, pin nor push
+	// index and could never be removed, added to the gc index
+	uncollectable int
+	// pinned chunks which are not stored, their pins are kept
+	// as pins set before storing for the chunks to be repaired
+	pinsMissing int
+	// gcSize before and after the check
+	gcSizeFrom uint64
+	gcSizeTo   uint64
+	// bins with the latest bin id raised to the
+	// largest bin id of their stored chunks
+	binIDs map[uint8]uint64
+	// batches with usage counters rebuilt from the stored chunks
+	batchUsage int
+	// sizes of the reserve and pins storage tiers
+	reserveSize int
+	pinSize     int
+}
+
+// repairs returns the number of repaired inconsistencies.
+func (r *consistencyReport) repairs() int {
+	n := r.pullOrphans + r.pushOrphans + r.gcOrphans + r.accessOrphans + r.postageOrphans +
+		r.gcStale + r.uncollectable + len(r.binIDs) + r.batchUsage
+	if r.gcSizeFrom != r.gcSizeTo {
+		n++
+	}
+	return n
+}
+
+// checkConsistency validates the invariants between the indexes which may
+// drift after an unclean shutdown and repairs them. Every pull, push, gc,
+// retrieval access and postage chunks index entry must have retrieval data
+// and every gc index entry the access timestamp of its chunk. Every stored
+// chunk must be in the gc, pin or push index, so that it is collectable,
+// pinned or still to be synced. gcSize must be the number of gc index
+// entries, the latest bin id of every bin must be at least the largest bin
+// id of the chunks stored in it and the batch usage counters must match the
+// stored chunks of the batches. Pins of chunks which are not stored are kept
+// as pins set before storing, they are counted for the report together with
+// the recomputed tier sizes. The payload slots of the chunks without
+// retrieval data are freed when the payload store is opened. It must not
+// run concurrently with other database operations.
+func (db *DB) checkConsistency() (r *consistencyReport, err error) {
+	r = &consistencyReport{
+		binIDs: make(map[uint8]uint64),
+	}
+	batch := new(leveldb.Batch)
+
+	orphans := func(index shed.Index, count *int) error {
+		return index.Iterate(func(item shed.Item) (stop bool, err error) {
+			has, err := db.retrievalDataIndex.Has(item)
+			if err != nil {
+				return true, err
+			}
+			if !has {
+				if err := index.DeleteInBatch(batch, item); err != nil {
+					return true, err
+				}
+				*count++
+			}
+			return false, nil
+		}, nil)
+	}
+	if err := orphans(db.pullIndex, &r.pullOrphans); err != nil {
+		return nil, fmt.Errorf("pull index: %w", err)
+	}
+	if err := orphans(db.pushIndex, &r.pushOrphans); err != nil {
+		return nil, fmt.Errorf("push index: %w", err)
+	}
+	if err := orphans(db.retrievalAccessIndex, &r.accessOrphans); err != nil {
+		return nil, fmt.Errorf("retrieval access index: %w", err)
+	}
+	if err := orphans(db.postageChunksIndex, &r.postageOrphans); err != nil {
+		return nil, fmt.Errorf("postage chunks index: %w", err)
+	}
+	var gcCount uint64
+	err = db.gcIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		has, err := db.retrievalDataIndex.Has(item)
+		if err != nil {
+			return true, err
+		}
+		if !has {
+			if err := db.gcIndex.DeleteInBatch(batch, item); err != nil {
+				return true, err
+			}
+			r.gcOrphans++
+			return false, nil
+		}
+		i, err := db.retrievalAccessIndex.Get(item)
+		if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+			return true, err
+		}
+		if err != nil || i.AccessTimestamp != item.AccessTimestamp {
+			if err := db.gcIndex.DeleteInBatch(batch, item); err != nil {
+				return true, err
+			}
+			r.gcStale++
+			return false, nil
+		}
+		gcCount++
+		return false, nil
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("gc index: %w", err)
+	}
+	err = db.pinIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		has, err := db.retrievalDataIndex.Has(item)
+		if err != nil {
+			return true, err
+		}
+		if !has {
+			r.pinsMissing++
+		}
+		return false, nil
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("pin index: %w", err)
+	}
+
+	var maxBinIDs [penguin.MaxBins]uint64
+	usage := make(map[string]*BatchUsage)
+	err = db.retrievalDataIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		po := db.po(penguin.NewAddress(item.Address))
+		if item.BinID > maxBinIDs[po] {
+			maxBinIDs[po] = item.BinID
+		}
+
+		pinned, err := db.pinIndex.Has(item)
+		if err != nil {
+			return true, err
+		}
+		if !pinned {
+			collectable, err := db.collectable(batch, item)
+			if err != nil {
+				return true, err
+			}
+			if !collectable {
+				r.uncollectable++
+				gcCount++
+			}
+		}
+
+		var t tier
+		if pinned {
+			t, err = db.pinnedTier(item)
+			if err != nil {
+				return true, err
+			}
+			if t == tierReserve {
+				r.reserveSize++
+			} else {
+				r.pinSize++
+			}
+		}
+
+		if len(item.BatchID) == 0 {
+			return false, nil
+		}
+		loc, err := sharky.LocationFromBinary(item.Location)
+		if err != nil {
+			return true, fmt.Errorf("chunk %x: %w", item.Address, err)
+		}
+		u, ok := usage[string(item.BatchID)]
+		if !ok {
+			// the iterator reuses the key buffer
+			u = &BatchUsage{BatchID: append([]byte(nil), item.BatchID...)}
+			usage[string(item.BatchID)] = u
+		}
+		u.Chunks++
+		u.Size += uint64(loc.Length)
+		if pinned {
+			u.Pinned++
+			if t == tierReserve {
+				u.Reserve++
+			}
+		}
+		return false, nil
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("retrieval data index: %w", err)
+	}
+	for po, maxBinID := range maxBinIDs {
+		id, err := db.binIDs.Get(uint64(po))
+		if err != nil {
+			return nil, err
+		}
+		if id < maxBinID {
+			db.binIDs.PutInBatch(batch, uint64(po), maxBinID)
+			r.binIDs[uint8(po)] = maxBinID
+		}
+	}
+
+	r.gcSizeFrom, err = db.gcSize.Get()
+	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+		return nil, err
+	}
+	r.gcSizeTo = gcCount
+	if r.gcSizeFrom != r.gcSizeTo {
+		db.gcSize.PutInBatch(batch, r.gcSizeTo)
+	}
+
+	r.batchUsage, err = db.rebuildBatchUsage(batch, usage)
+	if err != nil {
+		return nil, fmt.Errorf("batch usage index: %w", err)
+	}
+
+	if err := db.shed.WriteBatch(batch); err != nil {
+		return nil, err
+	}
+	db.metrics.GCSize.Set(float64(r.gcSizeTo))
+	db.metrics.ConsistencyRepairs.Add(float64(r.repairs()))
+	return r, nil
+}
+
+// collectable reports whether the stored chunk which is not pinned is in
+// the gc index or in the push index, from where it gets to the gc index
+// once synced. Otherwise the chunk is added to the gc index in the batch
+// and false is returned.
+func (db *DB) collectable(batch *leveldb.Batch, item shed.Item) (bool, error) {
+	queued, err := db.pushIndex.Has(item)
+	if err != nil || queued {
+		return queued, err
+	}
+	i, err := db.retrievalAccessIndex.Get(item)
+	switch {
+	case err == nil:
+		item.AccessTimestamp = i.AccessTimestamp
+		has, err := db.gcIndex.Has(item)
+		if err != nil || has {
+			return has, err
+		}
+	case errors.Is(err, leveldb.ErrNotFound):
+		item.AccessTimestamp = now()
+		if err := db.retrievalAccessIndex.PutInBatch(batch, item); err != nil {
+			return false, err
+		}
+	default:
+		return false, err
+	}
+	return false, db.gcIndex.PutInBatch(batch, item)
+}
+
+// rebuildBatchUsage replaces the batch usage counters which differ from
+// the usage of the stored chunks and returns the number of replaced ones.
+func (db *DB) rebuildBatchUsage(batch *leveldb.Batch, usage map[string]*BatchUsage) (n int, err error) {
+	err = db.batchUsageIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		u, ok := usage[string(item.BatchID)]
+		if !ok {
+			if err := db.batchUsageIndex.DeleteInBatch(batch, item); err != nil {
+				return true, err
+			}
+			n++
+			return false, nil
+		}
+		delete(usage, string(item.BatchID))
+		if stored := decodeBatchUsage(item); stored.Chunks == u.Chunks && stored.Size == u.Size &&
+			stored.Pinned == u.Pinned && stored.Reserve == u.Reserve {
+			return false, nil
+		}
+		if err := db.batchUsageIndex.PutInBatch(batch, shed.Item{BatchID: u.BatchID, Data: encodeBatchUsage(*u)}); err != nil {
+			return true, err
+		}
+		n++
+		return false, nil
+	}, nil)
+	if err != nil {
+		return 0, err
+	}
+	for _, u := range usage {
+		if err := db.batchUsageIndex.PutInBatch(batch, shed.Item{BatchID: u.BatchID, Data: encodeBatchUsage(*u)}); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// recoverConsistency checks the consistency of the indexes
+// and reports the repaired inconsistencies.
+func (db *DB) recoverConsistency() error {
+	db.logger.Info("localstore: database was not closed cleanly, checking index consistency")
+
+	r, err := db.checkConsistency()
+	if err != nil {
+		return fmt.Errorf("check consistency: %w", err)
+	}
+	if r.pinsMissing > 0 {
+		db.logger.Warningf("localstore: %d pinned chunks are not stored, repair the pins to retrieve them", r.pinsMissing)
+	}
+	db.logger.Infof("localstore: storage tiers: cache %d, reserve %d, pins %d chunks", r.gcSizeTo, r.reserveSize, r.pinSize)
+	if r.repairs() == 0 {
+		db.logger.Info("localstore: indexes are consistent")
+		return nil
+	}
+	if n := r.pullOrphans + r.pushOrphans + r.gcOrphans + r.accessOrphans + r.postageOrphans; n > 0 {
+		db.logger.Warningf("localstore: removed index entries of missing chunks: pull %d, push %d, gc %d, access %d, postage %d",
+			r.pullOrphans, r.pushOrphans, r.gcOrphans, r.accessOrphans, r.postageOrphans)
+	}
+	if r.gcStale > 0 {
+		db.logger.Warningf("localstore: removed %d gc index entries with a stale access timestamp", r.gcStale)
+	}
+	if r.uncollectable > 0 {
+		db.logger.Warningf("localstore: added %d chunks neither collectable nor pinned to the gc index", r.uncollectable)
+	}
+	if r.gcSizeFrom != r.gcSizeTo {
+		db.logger.Warningf("localstore: corrected gc size from %d to %d", r.gcSizeFrom, r.gcSizeTo)
+	}
+	for po, id := range r.binIDs {
+		db.logger.Warningf("localstore: raised latest bin id of bin %d to %d", po, id)
+	}
+	if r.batchUsage > 0 {
+		db.logger.Warningf("localstore: rebuilt the usage of %d postage batches", r.batchUsage)
+	}
+	db.logger.Infof("localstore: repaired %d index inconsistencies", r.repairs())
+	return nil
+}
@@ -0,0 +1,278 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/sharky"
+	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/penguintop/penguin/pkg/storage"
+)
+
+// TestCheckConsistency checks that the index drift is repaired.
+func TestCheckConsistency(t *testing.T) {
+	t.Cleanup(setWithinRadiusFunc(func(_ *DB, _ shed.Item) bool { return false }))
+	db := newTestDB(t, nil)
+	ctx := context.Background()
+
+	uploaded := generateTestRandomChunks(5)
+	if _, err := db.Put(ctx, storage.ModePutUpload, uploaded...); err != nil {
+		t.Fatal(err)
+	}
+	requested := generateTestRandomChunks(5)
+	if _, err := db.Put(ctx, storage.ModePutRequest, requested...); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set(ctx, storage.ModeSetPin, requested[0].Address(), requested[4].Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := db.checkConsistency()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := r.repairs(); n != 0 {
+		t.Fatalf("got %d repairs of a consistent database, want none", n)
+	}
+
+	// lose the retrieval data of an uploaded, a pinned and a requested chunk
+	for _, ch := range []penguin.Chunk{uploaded[0], requested[0], requested[1]} {
+		if err := db.retrievalDataIndex.Delete(addressToItem(ch.Address())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// lose the gc index entry of a requested chunk and
+	// change the access timestamp of the entry of another
+	for i, ch := range requested[2:4] {
+		item, err := db.retrievalDataIndex.Get(addressToItem(ch.Address()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		access, err := db.retrievalAccessIndex.Get(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item.AccessTimestamp = access.AccessTimestamp
+		if err := db.gcIndex.Delete(item); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			item.AccessTimestamp++
+			if err := db.gcIndex.Put(item); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// lose the gc size, the latest bin id of a bin and the usage of a batch
+	if err := db.gcSize.Put(42); err != nil {
+		t.Fatal(err)
+	}
+	po := db.po(uploaded[1].Address())
+	item, err := db.retrievalDataIndex.Get(addressToItem(uploaded[1].Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.binIDs.Put(uint64(po), item.BinID-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.batchUsageIndex.Put(shed.Item{
+		BatchID: requested[4].Stamp().BatchID(),
+		Data:    encodeBatchUsage(BatchUsage{Chunks: 5}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = db.checkConsistency()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.pullOrphans != 3 || r.pushOrphans != 1 || r.gcOrphans != 1 {
+		t.Fatalf("got removed pull %d, push %d, gc %d entries, want 3, 1, 1", r.pullOrphans, r.pushOrphans, r.gcOrphans)
+	}
+	if r.accessOrphans != 2 || r.postageOrphans != 3 {
+		t.Fatalf("got removed access %d, postage %d entries, want 2, 3", r.accessOrphans, r.postageOrphans)
+	}
+	if r.gcStale != 1 || r.uncollectable != 2 {
+		t.Fatalf("got %d stale gc entries and %d uncollectable chunks, want 1 and 2", r.gcStale, r.uncollectable)
+	}
+	if r.pinsMissing != 1 {
+		t.Fatalf("got %d pinned chunks missing, want 1", r.pinsMissing)
+	}
+	if r.gcSizeFrom != 42 || r.gcSizeTo != 2 {
+		t.Fatalf("got gc size corrected from %d to %d, want from 42 to 2", r.gcSizeFrom, r.gcSizeTo)
+	}
+	if got, ok := r.binIDs[po]; !ok || got < item.BinID {
+		t.Fatalf("got bin %d latest bin id %d, want at least %d", po, got, item.BinID)
+	}
+	// the usage of the three lost chunks and the changed one
+	if r.batchUsage != 4 {
+		t.Fatalf("got %d rebuilt batch usages, want 4", r.batchUsage)
+	}
+	if r.reserveSize != 0 || r.pinSize != 1 {
+		t.Fatalf("got reserve size %d and pin size %d, want 0 and 1", r.reserveSize, r.pinSize)
+	}
+
+	t.Run("pull index count", newItemsCountTest(db.pullIndex, 7))
+	t.Run("push index count", newItemsCountTest(db.pushIndex, 4))
+	t.Run("gc index count", newItemsCountTest(db.gcIndex, 2))
+	t.Run("retrieval access index count", newItemsCountTest(db.retrievalAccessIndex, 3))
+	t.Run("postage chunks index count", newItemsCountTest(db.postageChunksIndex, 7))
+	t.Run("pin index count", newItemsCountTest(db.pinIndex, 2))
+	t.Run("gc size", newIndexGCSizeTest(db))
+
+	for _, ch := range requested[2:4] {
+		item, err := db.retrievalDataIndex.Get(addressToItem(ch.Address()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		access, err := db.retrievalAccessIndex.Get(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item.AccessTimestamp = access.AccessTimestamp
+		if has, err := db.gcIndex.Has(item); err != nil || !has {
+			t.Fatalf("chunk %s not in the gc index with its access timestamp: %v", ch.Address(), err)
+		}
+	}
+
+	usage, err := db.BatchesUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks, pinned uint64
+	for _, u := range usage {
+		chunks += u.Chunks
+		pinned += u.Pinned
+		if want := uint64(len(requested[4].Data())); u.Size != want {
+			t.Fatalf("got batch %x size %d, want %d", u.BatchID, u.Size, want)
+		}
+	}
+	if len(usage) != 7 || chunks != 7 || pinned != 1 {
+		t.Fatalf("got %d batches with %d chunks, %d pinned, want 7 with 7, 1 pinned", len(usage), chunks, pinned)
+	}
+
+	id, err := db.binIDs.Get(uint64(po))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id < item.BinID {
+		t.Fatalf("got bin %d latest bin id %d, want at least %d", po, id, item.BinID)
+	}
+
+	r, err = db.checkConsistency()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := r.repairs(); n != 0 {
+		t.Fatalf("got %d repairs of a repaired database, want none", n)
+	}
+}
+
+// TestUncleanShutdownRecovery checks that the consistency
+// check runs only on startup after an unclean shutdown.
+func TestUncleanShutdownRecovery(t *testing.T) {
+	t.Cleanup(setWithinRadiusFunc(func(_ *DB, _ shed.Item) bool { return false }))
+	dir := testDir(t)
+	baseKey := make([]byte, 32)
+
+	db := newTestDBAt(t, dir, baseKey)
+	if _, err := db.Put(context.Background(), storage.ModePutRequest, generateTestRandomChunks(3)...); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// tamper the database as if it drifted
+	// and mark it not closed cleanly
+	tamper := func(dirty uint64) {
+		t.Helper()
+		s, err := shed.NewDB(dir, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		f, err := s.NewUint64Field("gc-size")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Put(42); err != nil {
+			t.Fatal(err)
+		}
+		f, err = s.NewUint64Field("dirty")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Put(dirty); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gcSize := func() uint64 {
+		t.Helper()
+		db := newTestDBAt(t, dir, baseKey)
+		defer db.Close()
+		size, err := db.gcSize.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return size
+	}
+
+	tamper(0)
+	if got := gcSize(); got != 42 {
+		t.Fatalf("got gc size %d after a clean shutdown, want it unchecked 42", got)
+	}
+	tamper(1)
+	if got := gcSize(); got != 3 {
+		t.Fatalf("got gc size %d after an unclean shutdown, want 3", got)
+	}
+}
+
+// TestUncleanShutdownFreesPayloads checks that the payload slots of the
+// chunks lost from the retrieval data index are freed on startup after
+// an unclean shutdown, also if the payload store was closed cleanly.
+func TestUncleanShutdownFreesPayloads(t *testing.T) {
+	dir := testDir(t)
+	baseKey := make([]byte, 32)
+
+	db := newTestDBAt(t, dir, baseKey)
+	ch := generateTestRandomChunk()
+	if _, err := db.Put(context.Background(), storage.ModePutRequest, ch); err != nil {
+		t.Fatal(err)
+	}
+	item, err := db.retrievalDataIndex.Get(addressToItem(ch.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost, err := sharky.LocationFromBinary(item.Location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.retrievalDataIndex.Delete(item); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.dirty.Put(1); err != nil {
+		t.Fatal(err)
+	}
+	// close the payload store and leveldb without marking
+	// the database as closed cleanly
+	if err := db.closePayloads(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.shed.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = newTestDBAt(t, dir, baseKey)
+	defer db.Close()
+
+	if err := db.payloads.Release(context.Background(), lost); !errors.Is(err, sharky.ErrInvalidLocation) {
+		t.Fatalf("lost payload at %+v: got error %v, want %v", lost, err, sharky.ErrInvalidLocation)
+	}
+}
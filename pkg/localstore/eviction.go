@@ -0,0 +1,186 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/penguin"
+)
+
+// Names of the eviction policies accepted by NewEvictionPolicy.
+const (
+	EvictionLRU       = "lru"
+	EvictionFrequency = "lfu"
+	EvictionProximity = "proximity"
+)
+
+// DefaultProximityWeight is the time a chunk is kept longer in the cache
+// for every proximity order it shares with the node address.
+const DefaultProximityWeight = time.Hour
+
+// EvictionPolicy decides which cached chunks garbage collection removes.
+// Garbage collection takes a window of the least recently used chunks and
+// evicts the candidates with the lowest scores. Candidates spared in favour
+// of more recently used ones keep their place in the cache and are
+// considered again by the next garbage collection run.
+type EvictionPolicy interface {
+	// Name identifies the policy in logs and metrics.
+	Name() string
+	// Accessed is called when a chunk is requested or stored on request.
+	Accessed(addr penguin.Address)
+	// Score returns the retention score of a garbage collection candidate,
+	// candidates with lower scores are evicted first.
+	Score(c EvictionCandidate) float64
+}
+
+// EvictionCandidate is a cached chunk considered for eviction.
+type EvictionCandidate struct {
+	Address         penguin.Address
+	AccessTimestamp int64 // unix time in nanoseconds
+	Proximity       uint8 // proximity order to the node address
+}
+
+// NewEvictionPolicy returns the eviction policy with the given name for a
+// cache of capacity chunks.
+func NewEvictionPolicy(name string, capacity uint64) (EvictionPolicy, error) {
+	switch name {
+	case EvictionLRU, "":
+		return NewLRUPolicy(), nil
+	case EvictionFrequency:
+		return NewFrequencyPolicy(capacity), nil
+	case EvictionProximity:
+		return NewProximityPolicy(DefaultProximityWeight), nil
+	}
+	return nil, fmt.Errorf("unknown eviction policy %q", name)
+}
+
+type lruPolicy struct{}
+
+// NewLRUPolicy returns the policy evicting the least recently used chunks.
+func NewLRUPolicy() EvictionPolicy {
+	return lruPolicy{}
+}
+
+func (lruPolicy) Name() string {
+	return EvictionLRU
+}
+
+func (lruPolicy) Accessed(penguin.Address) {}
+
+func (lruPolicy) Score(c EvictionCandidate) float64 {
+	return float64(c.AccessTimestamp)
+}
+
+type proximityPolicy struct {
+	weight time.Duration
+}
+
+// NewProximityPolicy returns a least recently used policy which treats
+// chunks as accessed weight later for every proximity order they share
+// with the node address, preferring to keep the chunks the node is
+// closest to.
+func NewProximityPolicy(weight time.Duration) EvictionPolicy {
+	return proximityPolicy{weight: weight}
+}
+
+func (proximityPolicy) Name() string {
+	return EvictionProximity
+}
+
+func (proximityPolicy) Accessed(penguin.Address) {}
+
+func (p proximityPolicy) Score(c EvictionCandidate) float64 {
+	return float64(c.AccessTimestamp) + float64(c.Proximity)*float64(p.weight)
+}
+
+// sketchDepth is the number of counter rows of the frequency sketch.
+const sketchDepth = 4
+
+// frequencyPolicy keeps the most frequently accessed chunks, recency
+// only breaks ties. Access frequencies are estimated with a count-min
+// sketch whose counters are halved after every sample of accesses so
+// that past popularity fades, similar to TinyLFU. The estimates are not
+// persisted and start over when the node restarts.
+type frequencyPolicy struct {
+	mu       sync.Mutex
+	counters [sketchDepth][]uint8
+	mask     uint64
+	accesses uint64
+	sample   uint64
+}
+
+// NewFrequencyPolicy returns the policy evicting the least frequently
+// used chunks of a cache of capacity chunks.
+func NewFrequencyPolicy(capacity uint64) EvictionPolicy {
+	width := uint64(1024)
+	for width < capacity && width < 1<<24 {
+		width <<= 1
+	}
+	p := &frequencyPolicy{
+		mask:   width - 1,
+		sample: 10 * width,
+	}
+	for i := range p.counters {
+		p.counters[i] = make([]uint8, width)
+	}
+	return p
+}
+
+func (*frequencyPolicy) Name() string {
+	return EvictionFrequency
+}
+
+func (p *frequencyPolicy) Accessed(addr penguin.Address) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.counters {
+		c := &p.counters[i][p.index(addr, i)]
+		if *c < 255 {
+			*c++
+		}
+	}
+	p.accesses++
+	if p.accesses >= p.sample {
+		p.accesses = 0
+		for i := range p.counters {
+			for j := range p.counters[i] {
+				p.counters[i][j] >>= 1
+			}
+		}
+	}
+}
+
+func (p *frequencyPolicy) Score(c EvictionCandidate) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return float64(p.estimate(c.Address))
+}
+
+// estimate returns the smallest counter of the address.
+func (p *frequencyPolicy) estimate(addr penguin.Address) uint8 {
+	min := uint8(255)
+	for i := range p.counters {
+		if c := p.counters[i][p.index(addr, i)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// index returns the counter of the address in row i. Chunk addresses
+// are hashes, so distinct parts of them serve as independent hashes.
+func (p *frequencyPolicy) index(addr penguin.Address, i int) uint64 {
+	b := addr.Bytes()
+	if len(b) < 8*sketchDepth {
+		b = append(make([]byte, 8*sketchDepth-len(b)), b...)
+	}
+	return binary.BigEndian.Uint64(b[8*i:]) & p.mask
+}
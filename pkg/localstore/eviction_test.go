@@ -0,0 +1,246 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFrequencyPolicy(t *testing.T) {
+	p := NewFrequencyPolicy(0).(*frequencyPolicy)
+	hot := generateTestRandomChunk().Address()
+	cold := generateTestRandomChunk().Address()
+
+	for i := 0; i < 3; i++ {
+		p.Accessed(hot)
+	}
+	if got := p.Score(EvictionCandidate{Address: hot}); got != 3 {
+		t.Fatalf("got hot score %v, want 3", got)
+	}
+	if got := p.Score(EvictionCandidate{Address: cold}); got != 0 {
+		t.Fatalf("got cold score %v, want 0", got)
+	}
+
+	// counters are halved after a sample of accesses
+	for p.accesses != 0 {
+		p.Accessed(cold)
+	}
+	if got := p.Score(EvictionCandidate{Address: hot}); got != 1 {
+		t.Fatalf("got aged hot score %v, want 1", got)
+	}
+}
+
+func TestSelectEvicted(t *testing.T) {
+	near := penguin.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000001")
+	far := penguin.MustParseHexAddress("ff00000000000000000000000000000000000000000000000000000000000000")
+	far2 := penguin.MustParseHexAddress("ff00000000000000000000000000000000000000000000000000000000000002")
+	candidates := []shed.Item{
+		{Address: near.Bytes(), AccessTimestamp: 1},
+		{Address: far.Bytes(), AccessTimestamp: 2},
+		{Address: far2.Bytes(), AccessTimestamp: 3},
+	}
+
+	for _, tc := range []struct {
+		policy  EvictionPolicy
+		evicted penguin.Address
+		spared  []penguin.Address
+	}{
+		{policy: NewLRUPolicy(), evicted: near},
+		{policy: NewProximityPolicy(time.Hour), evicted: far, spared: []penguin.Address{near}},
+	} {
+		t.Run(tc.policy.Name(), func(t *testing.T) {
+			db := newTestDB(t, &Options{EvictionPolicy: tc.policy})
+			db.baseKey = make([]byte, 32)
+
+			evicted, spared := db.selectEvicted(candidates, 1)
+			if len(evicted) != 1 || !tc.evicted.Equal(penguin.NewAddress(evicted[0].Address)) {
+				t.Fatalf("got evicted %v, want %s", evicted, tc.evicted)
+			}
+			if len(spared) != len(tc.spared) {
+				t.Fatalf("got %d spared, want %d", len(spared), len(tc.spared))
+			}
+			for i, addr := range tc.spared {
+				if !addr.Equal(penguin.NewAddress(spared[i].Address)) {
+					t.Fatalf("got spared %x, want %s", spared[i].Address, addr)
+				}
+			}
+		})
+	}
+}
+
+// TestGCEvictionPolicy checks that a scan of chunks requested once evicts
+// the frequently requested chunks with the least recently used policy only.
+func TestGCEvictionPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy EvictionPolicy
+		kept   bool
+	}{
+		{policy: NewLRUPolicy(), kept: false},
+		{policy: NewFrequencyPolicy(100), kept: true},
+	} {
+		t.Run(tc.policy.Name(), func(t *testing.T) {
+			db := newTestDB(t, &Options{Capacity: 100, EvictionPolicy: tc.policy})
+			ctx := context.Background()
+
+			hot := make([]penguin.Chunk, 10)
+			for i := range hot {
+				hot[i] = generateTestRandomChunk()
+			}
+			if _, err := db.Put(ctx, storage.ModePutRequestCache, hot...); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				for _, ch := range hot {
+					if _, err := db.Get(ctx, storage.ModeGetRequest, ch.Address()); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			db.updateGCWG.Wait()
+
+			for i := 0; i < 150; i++ {
+				if _, err := db.Put(ctx, storage.ModePutRequestCache, generateTestRandomChunk()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				gcSize, err := db.gcSize.Get()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if gcSize < db.cacheCapacity {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("gc size %d not below capacity", gcSize)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			for _, ch := range hot {
+				has, err := db.Has(ctx, ch.Address())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if has != tc.kept {
+					t.Fatalf("chunk %s: got has %v, want %v", ch.Address(), has, tc.kept)
+				}
+			}
+		})
+	}
+}
+
+// TestGCSparedKeepAccessTimestamp checks that the candidates spared by
+// garbage collection keep their access timestamps.
+func TestGCSparedKeepAccessTimestamp(t *testing.T) {
+	db := newTestDB(t, &Options{Capacity: 100, EvictionPolicy: NewProximityPolicy(time.Hour)})
+	ctx := context.Background()
+
+	chunks := make([]penguin.Chunk, 3)
+	for i := range chunks {
+		chunks[i] = generateTestRandomChunk()
+		ts := int64(i + 1)
+		reset := setNow(func() int64 { return ts })
+		_, err := db.Put(ctx, storage.ModePutRequestCache, chunks[i])
+		reset()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the least recently used chunk is the closest one
+	db.baseKey = chunks[0].Address().Bytes()
+	db.cacheCapacity = 3
+
+	if _, _, err := db.collectGarbage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// one of the more recently used distant chunks is evicted
+	var kept int
+	for _, ch := range chunks[1:] {
+		has, err := db.Has(ctx, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has {
+			kept++
+		}
+	}
+	if kept != 1 {
+		t.Fatalf("got %d distant chunks kept, want 1", kept)
+	}
+	item, err := db.retrievalAccessIndex.Get(addressToItem(chunks[0].Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.AccessTimestamp != 1 {
+		t.Fatalf("got access timestamp %d, want 1", item.AccessTimestamp)
+	}
+	item, err = db.retrievalDataIndex.Get(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.AccessTimestamp = 1
+	if has, err := db.gcIndex.Has(item); err != nil || !has {
+		t.Fatalf("spared chunk not in gc index at its access timestamp: %v", err)
+	}
+}
+
+func TestCacheRequestCount(t *testing.T) {
+	db := newTestDB(t, nil)
+	ctx := context.Background()
+	policy := db.eviction.Name()
+
+	stored := []penguin.Chunk{generateTestRandomChunk(), generateTestRandomChunk()}
+	if _, err := db.Put(ctx, storage.ModePutRequest, stored...); err != nil {
+		t.Fatal(err)
+	}
+	missing := []penguin.Address{generateTestRandomChunk().Address(), generateTestRandomChunk().Address()}
+
+	check := func(t *testing.T, hits, misses float64) {
+		t.Helper()
+		if got := testutil.ToFloat64(db.metrics.CacheHits.WithLabelValues(policy)); got != hits {
+			t.Fatalf("got %v cache hits, want %v", got, hits)
+		}
+		if got := testutil.ToFloat64(db.metrics.CacheMisses.WithLabelValues(policy)); got != misses {
+			t.Fatalf("got %v cache misses, want %v", got, misses)
+		}
+	}
+
+	if _, err := db.Get(ctx, storage.ModeGetRequest, stored[0].Address()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(ctx, storage.ModeGetRequest, missing[0]); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+	check(t, 1, 1)
+
+	if _, err := db.GetMulti(ctx, storage.ModeGetRequest, stored[0].Address(), stored[1].Address()); err != nil {
+		t.Fatal(err)
+	}
+	check(t, 3, 1)
+
+	// the chunks of a failed multi-get are counted per address
+	_, err := db.GetMulti(ctx, storage.ModeGetRequest, stored[0].Address(), missing[0], stored[1].Address(), missing[1])
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+	check(t, 5, 3)
+
+	// other modes are not counted
+	if _, err := db.GetMulti(ctx, storage.ModeGetLookup, missing...); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+	check(t, 5, 3)
+}
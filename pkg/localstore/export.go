@@ -18,46 +18,201 @@ package localstore
 
 import (
 	"archive/tar"
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
-	"sync"
+	"time"
 
+	"github.com/penguintop/penguin/pkg/cac"
+	"github.com/penguintop/penguin/pkg/crypto"
+	"github.com/penguintop/penguin/pkg/penguin"
 	"github.com/penguintop/penguin/pkg/postage"
 	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/penguintop/penguin/pkg/soc"
 	"github.com/penguintop/penguin/pkg/storage"
-    "github.com/penguintop/penguin/pkg/penguin"
 )
 
 const (
 	// filename in tar archive that holds the information
 	// about exported data format version
 	exportVersionFilename = ".penguin-export-version"
+	// filename in tar archive that holds the overlay address of
+	// the exporting node, which the proximity order bins of the
+	// manifest are relative to
+	exportOverlayFilename = ".penguin-export-overlay"
+	// filename in tar archive that holds the export manifest,
+	// written after all chunks
+	exportManifestFilename = ".penguin-export-manifest"
+	// filename in tar archive that holds the signature
+	// of the export manifest
+	exportSignatureFilename = ".penguin-export-manifest.sig"
 	// current export format version
 	currentExportVersion = "2"
+
+	// importBatchSize is the number of chunks
+	// stored with a single put on import.
+	importBatchSize = 100
+)
+
+var (
+	// ErrExportManifestMismatch is returned by Import if the imported
+	// chunks do not match the manifest of the export.
+	ErrExportManifestMismatch = errors.New("chunks do not match export manifest")
+	// ErrExportSignature is returned by Import if the export manifest
+	// is not signed by the expected key.
+	ErrExportSignature = errors.New("invalid export manifest signature")
 )
 
-// Export writes a tar structured data to the writer of
-// all chunks in the retrieval data index. It returns the
-// number of chunks exported.
-func (db *DB) Export(w io.Writer) (count int64, err error) {
+// ExportCheckpoint holds the highest bin ID of every proximity order bin
+// at the time of an export. An export from a checkpoint only contains the
+// chunks stored after it. Removals are not part of exports.
+type ExportCheckpoint map[uint8]uint64
+
+// ExportOptions selects the chunks to export. Chunks have to match
+// all set filters.
+type ExportOptions struct {
+	Pinned  bool             // only pinned chunks
+	BatchID []byte           // only chunks stamped by this postage batch
+	Bins    []uint8          // only chunks in these proximity order bins
+	Since   time.Time        // only chunks stored at or after this time
+	Until   time.Time        // only chunks stored before this time
+	From    ExportCheckpoint // only chunks stored after this checkpoint
+	// Signer signs the export manifest, the manifest is not signed without it.
+	Signer crypto.Signer
+}
+
+// ExportManifest describes the chunks in an export.
+type ExportManifest struct {
+	Version string    `json:"version"`
+	Created time.Time `json:"created"`
+	// Overlay is the base key of the exporting node, the
+	// proximity order bins are relative to it.
+	Overlay penguin.Address `json:"overlay"`
+	Count   int64           `json:"count"`
+	Bins    map[uint8]int64 `json:"bins"`
+	// Addresses is the SHA-256 hash of all chunk
+	// addresses in the order of the archive.
+	Addresses  string           `json:"addresses"`
+	From       ExportCheckpoint `json:"from,omitempty"`
+	Checkpoint ExportCheckpoint `json:"checkpoint"`
+	// PublicKey is the compressed public key of the manifest signer.
+	PublicKey string `json:"publicKey,omitempty"`
+}
+
+// exportDigest accumulates the counts and the address
+// hash of an export, on both export and import.
+type exportDigest struct {
+	baseKey []byte
+	count   int64
+	bins    map[uint8]int64
+	hash    hash.Hash
+}
+
+func newExportDigest(baseKey []byte) *exportDigest {
+	return &exportDigest{
+		baseKey: baseKey,
+		bins:    make(map[uint8]int64),
+		hash:    sha256.New(),
+	}
+}
+
+func (d *exportDigest) add(addr []byte) {
+	d.count++
+	d.bins[penguin.Proximity(d.baseKey, addr)]++
+	_, _ = d.hash.Write(addr)
+}
+
+func (d *exportDigest) sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// matches reports whether the export has the chunks
+// described by the manifest.
+func (d *exportDigest) matches(m *ExportManifest) error {
+	if d.count != m.Count {
+		return fmt.Errorf("%w: got %d chunks, want %d", ErrExportManifestMismatch, d.count, m.Count)
+	}
+	for po := uint8(0); po <= penguin.MaxPO; po++ {
+		if d.bins[po] != m.Bins[po] {
+			return fmt.Errorf("%w: got %d chunks in bin %d, want %d", ErrExportManifestMismatch, d.bins[po], po, m.Bins[po])
+		}
+	}
+	if got := d.sum(); got != m.Addresses {
+		return fmt.Errorf("%w: got addresses hash %s, want %s", ErrExportManifestMismatch, got, m.Addresses)
+	}
+	return nil
+}
+
+// Export writes a tar structured data to the writer of the chunks in the
+// retrieval data index selected by the options, followed by the manifest
+// of the export. It returns the manifest.
+func (db *DB) Export(w io.Writer, o ExportOptions) (m *ExportManifest, err error) {
+	checkpoint := make(ExportCheckpoint)
+	for po := uint8(0); po <= penguin.MaxPO; po++ {
+		id, err := db.binIDs.Get(uint64(po))
+		if err != nil {
+			return nil, err
+		}
+		checkpoint[po] = id
+	}
+
+	var bins map[uint8]bool
+	if len(o.Bins) > 0 {
+		bins = make(map[uint8]bool, len(o.Bins))
+		for _, po := range o.Bins {
+			bins[po] = true
+		}
+	}
+
 	tw := tar.NewWriter(w)
 	defer tw.Close()
 
-	if err := tw.WriteHeader(&tar.Header{
-		Name: exportVersionFilename,
-		Mode: 0644,
-		Size: int64(len(currentExportVersion)),
-	}); err != nil {
-		return 0, err
+	if err := writeTarFile(tw, exportVersionFilename, []byte(currentExportVersion)); err != nil {
+		return nil, err
 	}
-	if _, err := tw.Write([]byte(currentExportVersion)); err != nil {
-		return 0, err
+	if err := writeTarFile(tw, exportOverlayFilename, []byte(hex.EncodeToString(db.baseKey))); err != nil {
+		return nil, err
 	}
 
+	digest := newExportDigest(db.baseKey)
 	err = db.retrievalDataIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		po := db.po(penguin.NewAddress(item.Address))
+		switch {
+		case item.BinID > checkpoint[po]:
+			// stored after the export started
+			return false, nil
+		case o.From != nil && item.BinID <= o.From[po]:
+			return false, nil
+		case bins != nil && !bins[po]:
+			return false, nil
+		case o.BatchID != nil && !bytes.Equal(item.BatchID, o.BatchID):
+			return false, nil
+		case !o.Since.IsZero() && item.StoreTimestamp < o.Since.UnixNano():
+			return false, nil
+		case !o.Until.IsZero() && item.StoreTimestamp >= o.Until.UnixNano():
+			return false, nil
+		}
+		if o.Pinned {
+			pinned, err := db.pinIndex.Has(item)
+			if err != nil {
+				return true, err
+			}
+			if !pinned {
+				return false, nil
+			}
+		}
+
+		if err := db.readData(context.Background(), &item); err != nil {
+			return true, err
+		}
 
 		hdr := &tar.Header{
 			Name: hex.EncodeToString(item.Address),
@@ -66,148 +221,305 @@ func (db *DB) Export(w io.Writer) (count int64, err error) {
 		}
 
 		if err := tw.WriteHeader(hdr); err != nil {
-			return false, err
+			return true, err
 		}
 		if _, err := tw.Write(item.BatchID); err != nil {
-			return false, err
+			return true, err
 		}
 		if _, err := tw.Write(item.Sig); err != nil {
-			return false, err
+			return true, err
 		}
 		if _, err := tw.Write(item.Data); err != nil {
-			return false, err
+			return true, err
 		}
-		count++
+		digest.add(item.Address)
 		return false, nil
 	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	m = &ExportManifest{
+		Version:    currentExportVersion,
+		Created:    time.Now().UTC(),
+		Overlay:    penguin.NewAddress(db.baseKey),
+		Count:      digest.count,
+		Bins:       digest.bins,
+		Addresses:  digest.sum(),
+		From:       o.From,
+		Checkpoint: checkpoint,
+	}
+	if o.Signer != nil {
+		publicKey, err := o.Signer.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		m.PublicKey = hex.EncodeToString(crypto.EncodeSecp256k1PublicKey(publicKey))
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeTarFile(tw, exportManifestFilename, data); err != nil {
+		return nil, err
+	}
+	if o.Signer != nil {
+		signature, err := o.Signer.Sign(data)
+		if err != nil {
+			return nil, fmt.Errorf("sign export manifest: %w", err)
+		}
+		if err := writeTarFile(tw, exportSignatureFilename, signature); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: int64(len(data)),
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
 
-	return count, err
+// ImportOptions configures the import of an export.
+type ImportOptions struct {
+	// VerifyOnly checks the export against its manifest
+	// without storing any chunks.
+	VerifyOnly bool
+	// Signer is the public key expected to sign the export manifest.
+	// Any valid signature is accepted without it.
+	Signer *ecdsa.PublicKey
+	// Progress is called after every batch of chunks.
+	Progress func(ImportProgress)
 }
 
-// Import reads a tar structured data from the reader and
-// stores chunks in the database. It returns the number of
-// chunks imported.
-func (db *DB) Import(ctx context.Context, r io.Reader) (count int64, err error) {
+// ImportProgress counts the chunks processed by an import.
+type ImportProgress struct {
+	Read     int64 // chunks read from the export
+	Imported int64 // chunks stored
+	Skipped  int64 // chunks already in the localstore
+	Invalid  int64 // chunks not matching their address
+}
+
+// ImportResult reports the outcome of an import.
+type ImportResult struct {
+	ImportProgress
+	// Manifest is nil for exports without a manifest,
+	// which can not be verified.
+	Manifest *ExportManifest
+	// Signer is the key which signed the manifest,
+	// nil for unsigned manifests.
+	Signer *ecdsa.PublicKey
+}
+
+// Import reads a tar structured data from the reader and stores the
+// chunks in the database, skipping the ones it already has. The export is
+// read twice: if it has a manifest, the chunks and the manifest signature
+// are verified against it before any chunk is stored. Chunks are verified
+// individually as well, invalid ones are never stored.
+func (db *DB) Import(ctx context.Context, r io.ReadSeeker, o ImportOptions) (res *ImportResult, err error) {
+	res, err = db.readExport(ctx, r, o, false)
+	if err != nil || o.VerifyOnly {
+		return res, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return res, err
+	}
+	verified := res
+	if res, err = db.readExport(ctx, r, o, true); err != nil {
+		return res, err
+	}
+	res.Manifest, res.Signer = verified.Manifest, verified.Signer
+	return res, nil
+}
+
+// readExport reads the export and verifies it against its manifest,
+// storing the chunks if store is true.
+func (db *DB) readExport(ctx context.Context, r io.Reader, o ImportOptions, store bool) (res *ImportResult, err error) {
 	tr := tar.NewReader(r)
+	res = new(ImportResult)
+
+	var (
+		// if exportVersionFilename file is not present
+		// assume current version
+		version   = currentExportVersion
+		manifest  []byte
+		signature []byte
+		digest    *exportDigest
+		chunks    []penguin.Chunk
+	)
+
+	flush := func() error {
+		if len(chunks) == 0 {
+			return nil
+		}
+		defer func() { chunks = chunks[:0] }()
 
-	errC := make(chan error)
-	doneC := make(chan struct{})
-	tokenPool := make(chan struct{}, 100)
-	var wg sync.WaitGroup
-	go func() {
-		var (
-			firstFile = true
-
-			// if exportVersionFilename file is not present
-			// assume current version
-			version = currentExportVersion
-		)
-		for {
-			hdr, err := tr.Next()
+		switch {
+		case store:
+			exist, err := db.Put(ctx, storage.ModePutUpload, chunks...)
 			if err != nil {
-				if err == io.EOF {
-					break
-				}
-				select {
-				case errC <- err:
-				case <-ctx.Done():
+				return err
+			}
+			for _, e := range exist {
+				if e {
+					res.Skipped++
+				} else {
+					res.Imported++
 				}
 			}
-			if firstFile {
-				firstFile = false
-				if hdr.Name == exportVersionFilename {
-					data, err := ioutil.ReadAll(tr)
-					if err != nil {
-						select {
-						case errC <- err:
-						case <-ctx.Done():
-						}
-					}
-					version = string(data)
-					continue
+		case o.VerifyOnly:
+			for _, ch := range chunks {
+				has, err := db.Has(ctx, ch.Address())
+				if err != nil {
+					return err
+				}
+				if has {
+					res.Skipped++
 				}
 			}
+		}
+		if o.Progress != nil {
+			o.Progress(res.ImportProgress)
+		}
+		return nil
+	}
 
-			if len(hdr.Name) != 64 {
-				db.logger.Warningf("localstore export: ignoring non-chunk file: %s", hdr.Name)
-				continue
-			}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
 
-			keybytes, err := hex.DecodeString(hdr.Name)
+		switch hdr.Name {
+		case exportVersionFilename:
+			data, err := ioutil.ReadAll(tr)
 			if err != nil {
-				db.logger.Warningf("localstore export: ignoring invalid chunk file %s: %v", hdr.Name, err)
-				continue
+				return res, err
 			}
-
-			rawdata, err := ioutil.ReadAll(tr)
+			version = string(data)
+			if version != currentExportVersion {
+				return res, fmt.Errorf("unsupported export data version %q", version)
+			}
+			continue
+		case exportOverlayFilename:
+			data, err := ioutil.ReadAll(tr)
 			if err != nil {
-				select {
-				case errC <- err:
-				case <-ctx.Done():
-				}
+				return res, err
 			}
-			stamp := new(postage.Stamp)
-			err = stamp.UnmarshalBinary(rawdata[:postage.StampSize])
+			overlay, err := hex.DecodeString(string(data))
 			if err != nil {
-				select {
-				case errC <- err:
-				case <-ctx.Done():
-				}
+				return res, fmt.Errorf("decode export overlay: %w", err)
 			}
-			data := rawdata[postage.StampSize:]
-			key := penguin.NewAddress(keybytes)
-
-			var ch penguin.Chunk
-			switch version {
-			case currentExportVersion:
-				ch = penguin.NewChunk(key, data).WithStamp(stamp)
-			default:
-				select {
-				case errC <- fmt.Errorf("unsupported export data version %q", version):
-				case <-ctx.Done():
-				}
+			digest = newExportDigest(overlay)
+			continue
+		case exportManifestFilename:
+			if manifest, err = ioutil.ReadAll(tr); err != nil {
+				return res, err
 			}
-			tokenPool <- struct{}{}
-			wg.Add(1)
-
-			go func() {
-				_, err := db.Put(ctx, storage.ModePutUpload, ch)
-				select {
-				case errC <- err:
-				case <-ctx.Done():
-					wg.Done()
-					<-tokenPool
-				default:
-					_, err := db.Put(ctx, storage.ModePutUpload, ch)
-					if err != nil {
-						errC <- err
-					}
-					wg.Done()
-					<-tokenPool
-				}
-			}()
+			continue
+		case exportSignatureFilename:
+			if signature, err = ioutil.ReadAll(tr); err != nil {
+				return res, err
+			}
+			continue
+		}
 
-			count++
+		if len(hdr.Name) != 64 {
+			if !store {
+				db.logger.Warningf("localstore import: ignoring non-chunk file: %s", hdr.Name)
+			}
+			continue
+		}
+		keybytes, err := hex.DecodeString(hdr.Name)
+		if err != nil {
+			if !store {
+				db.logger.Warningf("localstore import: ignoring invalid chunk file %s: %v", hdr.Name, err)
+			}
+			continue
+		}
+		if manifest != nil {
+			return res, fmt.Errorf("%w: chunk %s after manifest", ErrExportManifestMismatch, hdr.Name)
 		}
-		wg.Wait()
-		close(doneC)
-	}()
 
-	// wait for all chunks to be stored
-	for {
-		select {
-		case err := <-errC:
-			if err != nil {
-				return count, err
+		rawdata, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return res, err
+		}
+		if len(rawdata) < postage.StampSize {
+			return res, fmt.Errorf("chunk %s: short data", hdr.Name)
+		}
+		stamp := new(postage.Stamp)
+		if err := stamp.UnmarshalBinary(rawdata[:postage.StampSize]); err != nil {
+			return res, fmt.Errorf("chunk %s: %w", hdr.Name, err)
+		}
+
+		res.Read++
+		if digest != nil {
+			digest.add(keybytes)
+		}
+
+		ch := penguin.NewChunk(penguin.NewAddress(keybytes), rawdata[postage.StampSize:]).WithStamp(stamp)
+		if !cac.Valid(ch) && !soc.Valid(ch) {
+			res.Invalid++
+			if !store {
+				db.logger.Warningf("localstore import: ignoring invalid chunk %s", hdr.Name)
 			}
-		case <-ctx.Done():
-			return count, ctx.Err()
-		default:
-			select {
-			case <-doneC:
-				return count, nil
-			default:
+			continue
+		}
+		chunks = append(chunks, ch)
+		if len(chunks) == importBatchSize {
+			if err := flush(); err != nil {
+				return res, err
 			}
 		}
 	}
+	if err := flush(); err != nil {
+		return res, err
+	}
+
+	if manifest == nil {
+		if o.Signer != nil {
+			return res, fmt.Errorf("%w: export has no manifest", ErrExportSignature)
+		}
+		return res, nil
+	}
+
+	m := new(ExportManifest)
+	if err := json.Unmarshal(manifest, m); err != nil {
+		return res, fmt.Errorf("decode export manifest: %w", err)
+	}
+	res.Manifest = m
+
+	if signature != nil {
+		signer, err := crypto.Recover(signature, manifest)
+		if err != nil {
+			return res, fmt.Errorf("%w: %v", ErrExportSignature, err)
+		}
+		if hex.EncodeToString(crypto.EncodeSecp256k1PublicKey(signer)) != m.PublicKey {
+			return res, fmt.Errorf("%w: not signed by %s", ErrExportSignature, m.PublicKey)
+		}
+		res.Signer = signer
+	}
+	if o.Signer != nil && (res.Signer == nil || !res.Signer.Equal(o.Signer)) {
+		return res, fmt.Errorf("%w: not signed by the expected key", ErrExportSignature)
+	}
+
+	if digest == nil || !bytes.Equal(digest.baseKey, m.Overlay.Bytes()) {
+		return res, fmt.Errorf("%w: overlay", ErrExportManifestMismatch)
+	}
+	return res, digest.matches(m)
 }
@@ -17,10 +17,15 @@
 package localstore
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"testing"
+	"time"
 
+	"github.com/penguintop/penguin/pkg/crypto"
 	"github.com/penguintop/penguin/pkg/storage"
     "github.com/penguintop/penguin/pkg/penguin"
 )
@@ -50,23 +55,23 @@ func TestExportImport(t *testing.T) {
 
 	var buf bytes.Buffer
 
-	c, err := db1.Export(&buf)
+	m, err := db1.Export(&buf, ExportOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
 	wantChunksCount := int64(len(chunks))
-	if c != wantChunksCount {
-		t.Errorf("got export count %v, want %v", c, wantChunksCount)
+	if m.Count != wantChunksCount {
+		t.Errorf("got export count %v, want %v", m.Count, wantChunksCount)
 	}
 
 	db2 := newTestDB(t, nil)
 
-	c, err = db2.Import(context.Background(), &buf)
+	res, err := db2.Import(context.Background(), bytes.NewReader(buf.Bytes()), ImportOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if c != wantChunksCount {
-		t.Errorf("got import count %v, want %v", c, wantChunksCount)
+	if res.Imported != wantChunksCount {
+		t.Errorf("got import count %v, want %v", res.Imported, wantChunksCount)
 	}
 
 	for a, want := range chunks {
@@ -85,3 +90,233 @@ func TestExportImport(t *testing.T) {
 		}
 	}
 }
+
+// exportAddresses exports the chunks selected by the options
+// and returns the exported addresses.
+func exportAddresses(t *testing.T, db *DB, o ExportOptions) (map[string]bool, *ExportManifest) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	m, err := db.Export(&buf, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs := make(map[string]bool)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hdr.Name) == 64 {
+			addrs[hdr.Name] = true
+		}
+	}
+	if int64(len(addrs)) != m.Count {
+		t.Fatalf("got %d chunks in export, manifest count %d", len(addrs), m.Count)
+	}
+	return addrs, m
+}
+
+func TestExportFilter(t *testing.T) {
+	db := newTestDB(t, nil)
+	ctx := context.Background()
+
+	chunks := make([]penguin.Chunk, 6)
+	for i := range chunks {
+		chunks[i] = generateTestRandomChunk()
+	}
+	stored := time.Now()
+	defer setNow(func() int64 { return stored.UnixNano() })()
+	if _, err := db.Put(ctx, storage.ModePutUpload, chunks[:3]...); err != nil {
+		t.Fatal(err)
+	}
+	later := stored.Add(time.Hour)
+	defer setNow(func() int64 { return later.UnixNano() })()
+	if _, err := db.Put(ctx, storage.ModePutUpload, chunks[3:]...); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set(ctx, storage.ModeSetPin, chunks[1].Address(), chunks[4].Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	// chunks sharing the bin of the last chunk
+	bin := db.po(chunks[5].Address())
+	var inBin []penguin.Chunk
+	for _, ch := range chunks {
+		if db.po(ch.Address()) == bin {
+			inBin = append(inBin, ch)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		o    ExportOptions
+		want []penguin.Chunk
+	}{
+		{name: "all", want: chunks},
+		{name: "pinned", o: ExportOptions{Pinned: true}, want: []penguin.Chunk{chunks[1], chunks[4]}},
+		{name: "batch", o: ExportOptions{BatchID: chunks[2].Stamp().BatchID()}, want: []penguin.Chunk{chunks[2]}},
+		{name: "bin", o: ExportOptions{Bins: []uint8{bin}}, want: inBin},
+		{name: "since", o: ExportOptions{Since: later}, want: chunks[3:]},
+		{name: "until", o: ExportOptions{Until: later}, want: chunks[:3]},
+		{name: "pinned until", o: ExportOptions{Pinned: true, Until: later}, want: []penguin.Chunk{chunks[1]}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, _ := exportAddresses(t, db, tc.o)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %d chunks, want %d", len(got), len(tc.want))
+			}
+			for _, ch := range tc.want {
+				if !got[ch.Address().String()] {
+					t.Fatalf("chunk %s not exported", ch.Address())
+				}
+			}
+		})
+	}
+}
+
+func TestExportIncremental(t *testing.T) {
+	db := newTestDB(t, nil)
+	ctx := context.Background()
+
+	first := []penguin.Chunk{generateTestRandomChunk(), generateTestRandomChunk()}
+	if _, err := db.Put(ctx, storage.ModePutUpload, first...); err != nil {
+		t.Fatal(err)
+	}
+	_, m := exportAddresses(t, db, ExportOptions{})
+
+	second := []penguin.Chunk{generateTestRandomChunk(), generateTestRandomChunk()}
+	if _, err := db.Put(ctx, storage.ModePutUpload, second...); err != nil {
+		t.Fatal(err)
+	}
+	got, m := exportAddresses(t, db, ExportOptions{From: m.Checkpoint})
+	if len(got) != len(second) {
+		t.Fatalf("got %d chunks, want %d", len(got), len(second))
+	}
+	for _, ch := range second {
+		if !got[ch.Address().String()] {
+			t.Fatalf("chunk %s not exported", ch.Address())
+		}
+	}
+
+	got, _ = exportAddresses(t, db, ExportOptions{From: m.Checkpoint})
+	if len(got) != 0 {
+		t.Fatalf("got %d chunks, want none", len(got))
+	}
+}
+
+func TestImportVerify(t *testing.T) {
+	db1 := newTestDB(t, nil)
+	ctx := context.Background()
+
+	chunks := make([]penguin.Chunk, 5)
+	for i := range chunks {
+		chunks[i] = generateTestRandomChunk()
+	}
+	if _, err := db1.Put(ctx, storage.ModePutUpload, chunks...); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := db1.Export(&buf, ExportOptions{Signer: crypto.NewDefaultSigner(key)}); err != nil {
+		t.Fatal(err)
+	}
+	export := buf.Bytes()
+
+	t.Run("verify only", func(t *testing.T) {
+		db2 := newTestDB(t, nil)
+		res, err := db2.Import(ctx, bytes.NewReader(export), ImportOptions{VerifyOnly: true, Signer: &key.PublicKey})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Read != 5 || res.Imported != 0 {
+			t.Fatalf("got progress %+v, want 5 read and none imported", res.ImportProgress)
+		}
+		if res.Signer == nil || !res.Signer.Equal(&key.PublicKey) {
+			t.Fatal("signer not reported")
+		}
+		newItemsCountTest(db2.retrievalDataIndex, 0)(t)
+	})
+
+	t.Run("duplicates", func(t *testing.T) {
+		db2 := newTestDB(t, nil)
+		if _, err := db2.Put(ctx, storage.ModePutUpload, chunks[:2]...); err != nil {
+			t.Fatal(err)
+		}
+		var progress []ImportProgress
+		res, err := db2.Import(ctx, bytes.NewReader(export), ImportOptions{
+			Progress: func(p ImportProgress) { progress = append(progress, p) },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Imported != 3 || res.Skipped != 2 {
+			t.Fatalf("got progress %+v, want 3 imported and 2 skipped", res.ImportProgress)
+		}
+		if len(progress) == 0 || progress[len(progress)-1] != res.ImportProgress {
+			t.Fatalf("got progress reports %+v", progress)
+		}
+		newItemsCountTest(db2.retrievalDataIndex, 5)(t)
+	})
+
+	t.Run("wrong signer", func(t *testing.T) {
+		other, err := crypto.GenerateSecp256k1Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		db2 := newTestDB(t, nil)
+		_, err = db2.Import(ctx, bytes.NewReader(export), ImportOptions{Signer: &other.PublicKey})
+		if !errors.Is(err, ErrExportSignature) {
+			t.Fatalf("got error %v, want %v", err, ErrExportSignature)
+		}
+		newItemsCountTest(db2.retrievalDataIndex, 0)(t)
+	})
+
+	t.Run("missing chunk", func(t *testing.T) {
+		// drop the first chunk from the archive
+		var truncated bytes.Buffer
+		tw := tar.NewWriter(&truncated)
+		tr := tar.NewReader(bytes.NewReader(export))
+		var dropped bool
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hdr.Name) == 64 && !dropped {
+				dropped = true
+				continue
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		db2 := newTestDB(t, nil)
+		res, err := db2.Import(ctx, bytes.NewReader(truncated.Bytes()), ImportOptions{})
+		if !errors.Is(err, ErrExportManifestMismatch) {
+			t.Fatalf("got error %v, want %v", err, ErrExportManifestMismatch)
+		}
+		if res.Imported != 0 {
+			t.Fatalf("got %d imported, want none", res.Imported)
+		}
+		newItemsCountTest(db2.retrievalDataIndex, 0)(t)
+	})
+}
@@ -17,9 +17,12 @@
 package localstore
 
 import (
+	"context"
 	"errors"
+	"sort"
 	"time"
 
+	"github.com/penguintop/penguin/pkg/sharky"
 	"github.com/penguintop/penguin/pkg/shed"
     "github.com/penguintop/penguin/pkg/penguin"
 	"github.com/syndtr/goleveldb/leveldb"
@@ -38,6 +41,10 @@ var (
 	// gcBatchSize limits the number of chunks in a single
 	// transaction on garbage collection.
 	gcBatchSize uint64 = 2000
+	// gcScanFactor is the number of least recently used
+	// candidates for every chunk to be removed that the
+	// eviction policy chooses from.
+	gcScanFactor uint64 = 4
 )
 
 // collectGarbageWorker is a long running function that waits for
@@ -106,6 +113,14 @@ func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
 	}
 	db.metrics.GCSize.Set(float64(gcSize))
 
+	// collect a window of the least recently used candidates
+	// for the eviction policy to choose from
+	want := gcBatchSize
+	if gcSize <= target {
+		want = 0
+	} else if gcSize-target < want {
+		want = gcSize - target
+	}
 	done = true
 	first := true
 	start := time.Now()
@@ -115,24 +130,17 @@ func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
 			totalTimeMetric(db.metrics.TotalTimeGCFirstItem, start)
 			first = false
 		}
-		if gcSize-collectedCount <= target {
+		if uint64(len(candidates)) >= want*gcScanFactor {
 			return true, nil
 		}
-
 		candidates = append(candidates, item)
-
-		collectedCount++
-		if collectedCount >= gcBatchSize {
-			// batch size limit reached, however we don't
-			// know whether another gc run is needed until
-			// we weed out the dirty entries below
-			return true, nil
-		}
 		return false, nil
 	}, nil)
 	if err != nil {
 		return 0, false, err
 	}
+	evicted, spared := db.selectEvicted(candidates, want)
+	collectedCount = uint64(len(evicted))
 	db.metrics.GCCollectedCounter.Add(float64(collectedCount))
 	if testHookGCIteratorDone != nil {
 		testHookGCIteratorDone()
@@ -151,7 +159,9 @@ func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
 	}
 
 	// get rid of dirty entries
-	for _, item := range candidates {
+	var released []sharky.Location
+	usage := make(usageChanges)
+	for _, item := range evicted {
 		if penguin.NewAddress(item.Address).MemberOf(db.dirtyAddresses) {
 			collectedCount--
 			continue
@@ -160,6 +170,24 @@ func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
 		db.metrics.GCStoreTimeStamps.Set(float64(item.StoreTimestamp))
 		db.metrics.GCStoreAccessTimeStamps.Set(float64(item.AccessTimestamp))
 
+		// the payload is released once the batch is written
+		stored, err := db.retrievalDataIndex.Get(item)
+		switch {
+		case err == nil:
+			loc, err := sharky.LocationFromBinary(stored.Location)
+			if err != nil {
+				return 0, false, err
+			}
+			released = append(released, loc)
+			// chunks in the gc index are not pinned
+			if err := db.usageRemoved(usage, stored, false); err != nil {
+				return 0, false, err
+			}
+		case errors.Is(err, leveldb.ErrNotFound):
+		default:
+			return 0, false, err
+		}
+
 		// delete from retrieve, pull, gc
 		err = db.retrievalDataIndex.DeleteInBatch(batch, item)
 		if err != nil {
@@ -182,21 +210,73 @@ func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
 			return 0, false, err
 		}
 	}
+
+	// the spared candidates keep their access timestamps
+	// and are considered again by the next run
+	db.metrics.GCSpared.WithLabelValues(db.eviction.Name()).Add(float64(len(spared)))
 	if gcSize-collectedCount > target {
 		done = false
 	}
 
 	db.metrics.GCCommittedCounter.Add(float64(collectedCount))
 	db.gcSize.PutInBatch(batch, gcSize-collectedCount)
+	err = db.incBatchUsageInBatch(batch, usage)
+	if err != nil {
+		return 0, false, err
+	}
 
 	err = db.shed.WriteBatch(batch)
 	if err != nil {
 		db.metrics.GCErrorCounter.Inc()
 		return 0, false, err
 	}
+	db.releaseLocations(context.Background(), released)
 	return collectedCount, done, nil
 }
 
+// selectEvicted splits the candidates, ordered from the least recently
+// used, into the want candidates with the lowest eviction policy scores
+// and the spared candidates which are less recently used than some of
+// the evicted ones.
+func (db *DB) selectEvicted(candidates []shed.Item, want uint64) (evicted, spared []shed.Item) {
+	if uint64(len(candidates)) <= want {
+		return candidates, nil
+	}
+	scores := make([]float64, len(candidates))
+	order := make([]int, len(candidates))
+	for i, item := range candidates {
+		addr := penguin.NewAddress(item.Address)
+		scores[i] = db.eviction.Score(EvictionCandidate{
+			Address:         addr,
+			AccessTimestamp: item.AccessTimestamp,
+			Proximity:       db.po(addr),
+		})
+		order[i] = i
+	}
+	// a stable sort keeps the least recently used order for equal scores
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] < scores[order[b]]
+	})
+
+	evict := make([]bool, len(candidates))
+	var last int
+	for _, i := range order[:want] {
+		evict[i] = true
+		if i > last {
+			last = i
+		}
+	}
+	for i, item := range candidates {
+		switch {
+		case evict[i]:
+			evicted = append(evicted, item)
+		case i < last:
+			spared = append(spared, item)
+		}
+	}
+	return evicted, spared
+}
+
 // gcTrigger retruns the absolute value for garbage collection
 // target value, calculated from db.capacity and gcTargetRatio.
 func (db *DB) gcTarget() (target uint64) {
@@ -17,8 +17,10 @@
 package localstore
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"os"
 	"runtime/pprof"
 	"sync"
@@ -65,6 +67,16 @@ type DB struct {
 	// schema name of loaded data
 	schemaName shed.StringField
 
+	// chunk payloads referenced by the retrieval data index
+	payloads PayloadStore
+	// payload stores of the storage tiers, nil if the payload
+	// store is provided in the options
+	tiered *tieredStore
+	// directories of the tier payload stores
+	payloadDirs shed.StringField
+	// mark the payload stores as not cleanly closed
+	sharkyDirtyFiles []string
+
 	// retrieval indexes
 	retrievalDataIndex   shed.Index
 	retrievalAccessIndex shed.Index
@@ -96,6 +108,16 @@ type DB struct {
 	// postage chunks index
 	postageRadiusIndex shed.Index
 
+	// chunks found corrupt by the scrubber
+	quarantineIndex shed.Index
+	// quarantined chunks ordered by the time they were quarantined
+	quarantineTimeIndex shed.Index
+	// number of items in the quarantine index
+	quarantineSize shed.Uint64Field
+
+	// local storage used by every postage batch
+	batchUsageIndex shed.Index
+
 	// field that stores number of intems in gc index
 	gcSize shed.Uint64Field
 
@@ -103,9 +125,25 @@ type DB struct {
 	// the cacheCapacity value
 	cacheCapacity uint64
 
+	// chooses the chunks removed by garbage collection
+	eviction EvictionPolicy
+
+	// number of chunks in the reserve, it is kept
+	// by the batchstore evicting batches
+	reserveCapacity uint64
+
+	// field that is set while the database is open, finding it set
+	// on startup means that the database was not closed cleanly
+	dirty shed.Uint64Field
+	// the dirty field was set on startup
+	uncleanShutdown bool
+
 	// triggers garbage collection event loop
 	collectGarbageTrigger chan struct{}
 
+	// triggers storage tier balancing event loop
+	balanceTiersTrigger chan struct{}
+
 	// a buffered channel acting as a semaphore
 	// to limit the maximal number of goroutines
 	// created by Getters to call updateGC function
@@ -137,6 +175,9 @@ type DB struct {
 	// are done
 	collectGarbageWorkerDone chan struct{}
 
+	// closed when the storage tier balancing worker is done
+	balanceTiersWorkerDone chan struct{}
+
 	// wait for all subscriptions to finish before closing
 	// underlaying leveldb to prevent possible panics from
 	// iterators
@@ -149,9 +190,22 @@ type DB struct {
 
 // Options struct holds optional parameters for configuring DB.
 type Options struct {
-	// Capacity is a limit that triggers garbage collection when
-	// number of items in gcIndex equals or exceeds it.
+	// Capacity is the capacity of the cache tier, a limit that triggers
+	// garbage collection when number of items in gcIndex equals or exceeds it.
 	Capacity uint64
+	// ReserveCapacity is the capacity of the reserve tier, the chunks
+	// pinned within the radius of their batch. The batchstore keeps the
+	// reserve within it by evicting batches, here it is only reported.
+	ReserveCapacity uint64
+	// EvictionPolicy chooses the cached chunks removed by garbage
+	// collection. If not set, the least recently used chunks are removed.
+	EvictionPolicy EvictionPolicy
+	// CacheDir, ReserveDir and PinDir are the directories of the payload
+	// stores of the tiers. Tiers without a directory keep their payloads
+	// in the localstore directory.
+	CacheDir   string
+	ReserveDir string
+	PinDir     string
 	// OpenFilesLimit defines the upper bound of open files that the
 	// the localstore should maintain at any point of time. It is
 	// passed on to the shed constructor.
@@ -164,6 +218,9 @@ type Options struct {
 	// DisableSeeksCompaction toggles the seek driven compactions feature on leveldb
 	// and is passed on to shed.
 	DisableSeeksCompaction bool
+	// PayloadStore stores the chunk payloads. If not set, a sharded
+	// file store is used in the localstore and tier directories.
+	PayloadStore PayloadStore
 
 	// MetricsPrefix defines a prefix for metrics names.
 	MetricsPrefix string
@@ -182,30 +239,42 @@ func New(path string, baseKey []byte, o *Options, logger logging.Logger) (db *DB
 	}
 
 	db = &DB{
-		cacheCapacity: o.Capacity,
-		baseKey:       baseKey,
-		tags:          o.Tags,
-		// channel collectGarbageTrigger
-		// needs to be buffered with the size of 1
+		cacheCapacity:   o.Capacity,
+		reserveCapacity: o.ReserveCapacity,
+		eviction:        o.EvictionPolicy,
+		baseKey:         baseKey,
+		tags:            o.Tags,
+		// channels collectGarbageTrigger and balanceTiersTrigger
+		// need to be buffered with the size of 1
 		// to signal another event if it
 		// is triggered during already running function
 		collectGarbageTrigger:    make(chan struct{}, 1),
+		balanceTiersTrigger:      make(chan struct{}, 1),
 		close:                    make(chan struct{}),
 		collectGarbageWorkerDone: make(chan struct{}),
+		balanceTiersWorkerDone:   make(chan struct{}),
 		metrics:                  newMetrics(),
 		logger:                   logger,
 	}
 	if db.cacheCapacity == 0 {
 		db.cacheCapacity = defaultCacheCapacity
 	}
+	if db.reserveCapacity == 0 {
+		db.reserveCapacity = uint64(batchstore.Capacity)
+	}
+	if db.eviction == nil {
+		db.eviction = NewLRUPolicy()
+	}
 
-	capacityMB := float64((db.cacheCapacity+uint64(batchstore.Capacity))*penguin.ChunkSize) * 9.5367431640625e-7
+	capacityMB := float64((db.cacheCapacity+db.reserveCapacity)*penguin.ChunkSize) * 9.5367431640625e-7
 
 	if capacityMB <= 1000 {
 		db.logger.Infof("database capacity: %d chunks (approximately %fMB)", db.cacheCapacity, capacityMB)
 	} else {
 		db.logger.Infof("database capacity: %d chunks (approximately %0.1fGB)", db.cacheCapacity, capacityMB/1000)
 	}
+	db.logger.Infof("database tiers: cache %d, reserve %d chunks", db.cacheCapacity, db.reserveCapacity)
+	db.logger.Infof("database cache eviction policy: %s", db.eviction.Name())
 
 	if maxParallelUpdateGC > 0 {
 		db.updateGCSem = make(chan struct{}, maxParallelUpdateGC)
@@ -236,19 +305,6 @@ func New(path string, baseKey []byte, o *Options, logger logging.Logger) (db *DB
 	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
 		return nil, err
 	}
-	if schemaName == "" {
-		// initial new localstore run
-		err := db.schemaName.Put(DbSchemaCurrent)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		// execute possible migrations
-		err = db.migrate(schemaName)
-		if err != nil {
-			return nil, err
-		}
-	}
 
 	// Persist gc size.
 	db.gcSize, err = db.shed.NewUint64Field("gc-size")
@@ -256,9 +312,28 @@ func New(path string, baseKey []byte, o *Options, logger logging.Logger) (db *DB
 		return nil, err
 	}
 
-	// Index storing actual chunk address, data and bin id.
+	// Persist the number of chunks quarantined by the scrubber.
+	db.quarantineSize, err = db.shed.NewUint64Field("quarantine-size")
+	if err != nil {
+		return nil, err
+	}
+
+	// Mark the database as open until it is closed cleanly.
+	db.dirty, err = db.shed.NewUint64Field("dirty")
+	if err != nil {
+		return nil, err
+	}
+
+	// Persist the tier payload directories.
+	db.payloadDirs, err = db.shed.NewStringField("payload-dirs")
+	if err != nil {
+		return nil, err
+	}
+
+	// Index storing actual chunk address, bin id and the location
+	// of the chunk data in the payload store.
 	headerSize := 16 + postage.StampSize
-	db.retrievalDataIndex, err = db.shed.NewIndex("Address->StoreTimestamp|BinID|BatchID|Sig|Data", shed.IndexFuncs{
+	db.retrievalDataIndex, err = db.shed.NewIndex("Address->StoreTimestamp|BinID|BatchID|Sig|Location", shed.IndexFuncs{
 		EncodeKey: func(fields shed.Item) (key []byte, err error) {
 			return fields.Address, nil
 		},
@@ -275,7 +350,7 @@ func New(path string, baseKey []byte, o *Options, logger logging.Logger) (db *DB
 				return nil, err
 			}
 			copy(b[16:], stamp)
-			value = append(b, fields.Data...)
+			value = append(b, fields.Location...)
 			return value, nil
 		},
 		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
@@ -287,7 +362,7 @@ func New(path string, baseKey []byte, o *Options, logger logging.Logger) (db *DB
 			}
 			e.BatchID = stamp.BatchID()
 			e.Sig = stamp.Sig()
-			e.Data = value[headerSize:]
+			e.Location = value[headerSize:]
 			return e, nil
 		},
 	})
@@ -481,8 +556,133 @@ func New(path string, baseKey []byte, o *Options, logger logging.Logger) (db *DB
 		return nil, err
 	}
 
+	// Index of the chunks removed by the scrubber, with the time of the
+	// removal, their pin counter, batch and the reason they were removed.
+	db.quarantineIndex, err = db.shed.NewIndex("Address->QuarantineTimestamp|PinCounter|BatchID|Reason", shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			return fields.Address, nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.Address = key
+			return e, nil
+		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			b := make([]byte, 48)
+			binary.BigEndian.PutUint64(b[:8], uint64(fields.AccessTimestamp))
+			binary.BigEndian.PutUint64(b[8:16], fields.PinCounter)
+			copy(b[16:48], fields.BatchID)
+			return append(b, fields.Data...), nil
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			e.AccessTimestamp = int64(binary.BigEndian.Uint64(value[:8]))
+			e.PinCounter = binary.BigEndian.Uint64(value[8:16])
+			e.BatchID = value[16:48]
+			e.Data = value[48:]
+			return e, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Index of the quarantined chunks by the time of their removal,
+	// the oldest are dropped first when the quarantine is full.
+	db.quarantineTimeIndex, err = db.shed.NewIndex("QuarantineTimestamp|Address->nil", shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			b := make([]byte, 8, 8+len(fields.Address))
+			binary.BigEndian.PutUint64(b, uint64(fields.AccessTimestamp))
+			return append(b, fields.Address...), nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.AccessTimestamp = int64(binary.BigEndian.Uint64(key[:8]))
+			e.Address = key[8:]
+			return e, nil
+		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			return nil, nil
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			return keyItem, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Index of the local storage used by postage batches, kept up to date
+	// with the chunks stored, removed, pinned and reserved for a batch.
+	db.batchUsageIndex, err = db.shed.NewIndex("BatchID->Chunks|Size|Pinned|Reserve", shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			key = make([]byte, 32)
+			copy(key, fields.BatchID)
+			return key, nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.BatchID = key[:32]
+			return e, nil
+		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			return fields.Data, nil
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			e.Data = value
+			return e, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// repair the index drift of an unclean shutdown
+	dirty, err := db.dirty.Get()
+	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+		_ = db.shed.Close()
+		return nil, err
+	}
+	db.uncleanShutdown = dirty != 0
+
+	db.payloads, err = db.openPayloads(path, o)
+	if err != nil {
+		_ = db.shed.Close()
+		return nil, fmt.Errorf("open payload store: %w", err)
+	}
+
+	if schemaName == "" {
+		// initial new localstore run
+		err := db.schemaName.Put(DbSchemaCurrent)
+		if err != nil {
+			_ = db.closePayloads()
+			return nil, err
+		}
+	} else {
+		// execute possible migrations
+		err = db.migrate(schemaName)
+		if err != nil {
+			_ = db.closePayloads()
+			return nil, err
+		}
+	}
+
+	if db.uncleanShutdown {
+		if err := db.recoverConsistency(); err != nil {
+			_ = db.closePayloads()
+			return nil, err
+		}
+	}
+	if err := db.dirty.Put(1); err != nil {
+		_ = db.closePayloads()
+		return nil, err
+	}
+
 	// start garbage collection worker
 	go db.collectGarbageWorker()
+	// start storage tier balancing worker
+	if db.tiered != nil && db.tiered.separate() {
+		go db.balanceTiersWorker()
+		db.triggerBalanceTiers()
+	} else {
+		close(db.balanceTiersWorkerDone)
+	}
 	return db, nil
 }
 
@@ -492,18 +692,21 @@ func (db *DB) Close() (err error) {
 
 	// wait for all handlers to finish
 	done := make(chan struct{})
+	clean := true
 	go func() {
 		db.updateGCWG.Wait()
 		db.subscritionsWG.Wait()
 		// wait for gc worker to
 		// return before closing the shed
 		<-db.collectGarbageWorkerDone
+		<-db.balanceTiersWorkerDone
 		close(done)
 	}()
 	select {
 	case <-done:
 	case <-time.After(5 * time.Second):
 		db.logger.Errorf("localstore closed with still active goroutines")
+		clean = false
 		// Print a full goroutine dump to debug blocking.
 		// TODO: use a logger to write a goroutine profile
 		prof := pprof.Lookup("goroutine")
@@ -512,6 +715,14 @@ func (db *DB) Close() (err error) {
 			return err
 		}
 	}
+	if err := db.closePayloads(); err != nil {
+		db.logger.Errorf("localstore: close payload store: %v", err)
+	}
+	if clean {
+		if err := db.dirty.Put(0); err != nil {
+			db.logger.Errorf("localstore: mark database closed: %v", err)
+		}
+	}
 	return db.shed.Close()
 }
 
@@ -534,7 +745,14 @@ func (db *DB) GetRetrievalData(addr []byte) (shed.Item, error) {
 	if len(addr) != 32 {
 		return shed.Item{}, errors.New("invalid address length")
 	}
-	return db.retrievalDataIndex.Get(shed.Item{Address: addr})
+	item, err := db.retrievalDataIndex.Get(shed.Item{Address: addr})
+	if err != nil {
+		return shed.Item{}, err
+	}
+	if err := db.readData(context.Background(), &item); err != nil {
+		return shed.Item{}, err
+	}
+	return item, nil
 }
 
 // po computes the proximity order between the address
@@ -544,7 +762,8 @@ func (db *DB) po(addr penguin.Address) (bin uint8) {
 }
 
 // DebugIndices returns the index sizes for all indexes in localstore
-// the returned map keys are the index name, values are the number of elements in the index
+// the returned map keys are the index name, values are the number of elements in the index.
+// The usage and capacity of the storage tiers are reported as well.
 func (db *DB) DebugIndices() (indexInfo map[string]int, err error) {
 	indexInfo = make(map[string]int)
 	for k, v := range map[string]shed.Index{
@@ -556,6 +775,9 @@ func (db *DB) DebugIndices() (indexInfo map[string]int, err error) {
 		"pinIndex":             db.pinIndex,
 		"postageChunksIndex":   db.postageChunksIndex,
 		"postageRadiusIndex":   db.postageRadiusIndex,
+		"quarantineIndex":      db.quarantineIndex,
+		"quarantineTimeIndex":  db.quarantineTimeIndex,
+		"batchUsageIndex":      db.batchUsageIndex,
 	} {
 		indexSize, err := v.Count()
 		if err != nil {
@@ -569,7 +791,18 @@ func (db *DB) DebugIndices() (indexInfo map[string]int, err error) {
 	}
 	indexInfo["gcSize"] = int(val)
 
-	return indexInfo, err
+	// usage and capacity of the storage tiers
+	indexInfo["cacheSize"] = int(val)
+	indexInfo["cacheCapacity"] = int(db.cacheCapacity)
+	reserveSize, pinSize, err := db.pinnedTierSizes()
+	if err != nil {
+		return indexInfo, err
+	}
+	indexInfo["reserveSize"] = reserveSize
+	indexInfo["reserveCapacity"] = int(db.reserveCapacity)
+	indexInfo["pinSize"] = pinSize
+
+	return indexInfo, nil
 }
 
 // chunkToItem creates new Item with data provided by the Chunk.
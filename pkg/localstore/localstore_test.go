@@ -253,6 +253,9 @@ func newRetrieveIndexesTest(db *DB, chunk penguin.Chunk, storeTimestamp, accessT
 		if err != nil {
 			t.Fatal(err)
 		}
+		if err := db.readData(context.Background(), &item); err != nil {
+			t.Fatal(err)
+		}
 		validateItem(t, item, chunk.Address().Bytes(), chunk.Data(), storeTimestamp, 0, chunk.Stamp())
 
 		// access index should not be set
@@ -274,6 +277,9 @@ func newRetrieveIndexesTestWithAccess(db *DB, ch penguin.Chunk, storeTimestamp,
 		if err != nil {
 			t.Fatal(err)
 		}
+		if err := db.readData(context.Background(), &item); err != nil {
+			t.Fatal(err)
+		}
 
 		if accessTimestamp > 0 {
 			item, err = db.retrievalAccessIndex.Get(item)
@@ -59,6 +59,21 @@ type metrics struct {
 	GCSize                  prometheus.Gauge
 	GCStoreTimeStamps       prometheus.Gauge
 	GCStoreAccessTimeStamps prometheus.Gauge
+
+	ScrubChecked       prometheus.Counter
+	ScrubCorrupt       prometheus.Counter
+	ScrubRefetched     prometheus.Counter
+	ScrubRefetchFailed prometheus.Counter
+	ScrubPasses        prometheus.Counter
+
+	ConsistencyRepairs prometheus.Counter
+
+	TierMoved      prometheus.Counter
+	TierMoveErrors prometheus.Counter
+
+	CacheHits   *prometheus.CounterVec
+	CacheMisses *prometheus.CounterVec
+	GCSpared    *prometheus.CounterVec
 }
 
 func newMetrics() metrics {
@@ -343,6 +358,74 @@ func newMetrics() metrics {
 			Name:      "gc_access_time_stamp",
 			Help:      "Access timestamp in Garbage collection iteration.",
 		}),
+		ScrubChecked: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "scrub_checked_count",
+			Help:      "Number of chunks checked by the scrubber.",
+		}),
+		ScrubCorrupt: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "scrub_corrupt_count",
+			Help:      "Number of corrupt chunks quarantined by the scrubber.",
+		}),
+		ScrubRefetched: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "scrub_refetched_count",
+			Help:      "Number of corrupt pinned chunks fetched again from the network.",
+		}),
+		ScrubRefetchFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "scrub_refetch_failed_count",
+			Help:      "Number of corrupt pinned chunks that could not be fetched again.",
+		}),
+		ScrubPasses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "scrub_passes_count",
+			Help:      "Number of completed scrubber passes over the localstore.",
+		}),
+		ConsistencyRepairs: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "consistency_repairs_count",
+			Help:      "Number of index inconsistencies repaired after an unclean shutdown.",
+		}),
+
+		TierMoved: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "tier_moved_count",
+			Help:      "Number of chunk payloads moved to the payload store of their storage tier.",
+		}),
+		TierMoveErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "tier_move_error_count",
+			Help:      "Number of storage tier balancing runs that failed.",
+		}),
+
+		CacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "cache_hit_count",
+			Help:      "Number of requested chunks found in the localstore, by eviction policy.",
+		}, []string{"policy"}),
+		CacheMisses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "cache_miss_count",
+			Help:      "Number of requested chunks not found in the localstore, by eviction policy.",
+		}, []string{"policy"}),
+		GCSpared: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "gc_spared_count",
+			Help:      "Number of garbage collection candidates kept by the eviction policy.",
+		}, []string{"policy"}),
 	}
 }
 
@@ -17,11 +17,14 @@
 package localstore
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/penguintop/penguin/pkg/postage"
+	"github.com/penguintop/penguin/pkg/sharky"
 	"github.com/penguintop/penguin/pkg/shed"
     "github.com/penguintop/penguin/pkg/penguin"
 	"github.com/syndtr/goleveldb/leveldb"
@@ -40,6 +43,8 @@ type migration struct {
 var schemaMigrations = []migration{
 	{name: DbSchemaCode, fn: func(_ *DB) error { return nil }},
 	{name: DbSchemaYuj, fn: migrateYuj},
+	{name: DbSchemaSharky, fn: migrateSharky},
+	{name: DbSchemaUsage, fn: migrateUsage},
 }
 
 func (db *DB) migrate(schemaName string) error {
@@ -369,3 +374,176 @@ func migrateYuj(db *DB) error {
 	db.logger.Debugf("done truncating indexes. took %s", time.Since(start))
 	return nil
 }
+
+// migrateSharky moves the chunk payloads out of the retrieval data index
+// into the payload store, leaving only their location in the index.
+// Chunks are moved in batches, each removing them from the old index,
+// so an interrupted migration continues where it stopped. Payloads
+// written for a batch that did not make it to the database are
+// recovered as free slots on the next start.
+func migrateSharky(db *DB) error {
+	headerSize := 16 + postage.StampSize
+	oldRetrievalDataIndex, err := db.shed.NewIndex("Address->StoreTimestamp|BinID|BatchID|Sig|Data", shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			return fields.Address, nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.Address = key
+			return e, nil
+		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			b := make([]byte, headerSize)
+			binary.BigEndian.PutUint64(b[:8], fields.BinID)
+			binary.BigEndian.PutUint64(b[8:16], uint64(fields.StoreTimestamp))
+			stamp, err := postage.NewStamp(fields.BatchID, fields.Sig).MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			copy(b[16:], stamp)
+			value = append(b, fields.Data...)
+			return value, nil
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			e.StoreTimestamp = int64(binary.BigEndian.Uint64(value[8:16]))
+			e.BinID = binary.BigEndian.Uint64(value[:8])
+			stamp := new(postage.Stamp)
+			if err = stamp.UnmarshalBinary(value[16:headerSize]); err != nil {
+				return e, err
+			}
+			e.BatchID = stamp.BatchID()
+			e.Sig = stamp.Sig()
+			e.Data = value[headerSize:]
+			return e, nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var lim = 10000
+	count := 0
+	start := time.Now()
+	db.logger.Debug("moving chunk payloads to the payload store")
+
+	batch := new(leveldb.Batch)
+	payloads := db.newPayloadBatch(context.Background())
+	writeBatch := func() error {
+		if err := payloads.sync(); err != nil {
+			return err
+		}
+		if err := db.shed.WriteBatch(batch); err != nil {
+			return err
+		}
+		batch = new(leveldb.Batch)
+		payloads = db.newPayloadBatch(context.Background())
+		return nil
+	}
+
+	err = oldRetrievalDataIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		// payloads of other tiers are moved by the tier balancing
+		if err := payloads.write(&item, tierCache); err != nil {
+			return true, err
+		}
+		if err := db.retrievalDataIndex.PutInBatch(batch, item); err != nil {
+			return true, err
+		}
+		if err := oldRetrievalDataIndex.DeleteInBatch(batch, item); err != nil {
+			return true, err
+		}
+		count++
+		if count%lim == 0 {
+			db.logger.Debugf("moving chunk payloads writing batch. processed %d", count)
+			if err := writeBatch(); err != nil {
+				return true, err
+			}
+		}
+		return false, nil
+	}, nil)
+	if err != nil {
+		payloads.rollback()
+		return fmt.Errorf("move chunk payloads: %w", err)
+	}
+	if err := writeBatch(); err != nil {
+		payloads.rollback()
+		return fmt.Errorf("move chunk payloads: %w", err)
+	}
+
+	db.logger.Debugf("done moving %d chunk payloads. took %s", count, time.Since(start))
+	return nil
+}
+
+// migrateUsage fills the batch usage index from the chunks
+// already stored for every postage batch.
+func migrateUsage(db *DB) error {
+	start := time.Now()
+	usage := make(map[string]*BatchUsage)
+	radius := make(map[string]*shed.Item)
+	err := db.postageChunksIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		stored, err := db.retrievalDataIndex.Get(item)
+		if err != nil {
+			if errors.Is(err, leveldb.ErrNotFound) {
+				return false, nil
+			}
+			return true, err
+		}
+		loc, err := sharky.LocationFromBinary(stored.Location)
+		if err != nil {
+			return true, err
+		}
+		id := string(item.BatchID)
+		u, ok := usage[id]
+		if !ok {
+			u = &BatchUsage{BatchID: []byte(id)}
+			usage[id] = u
+		}
+		u.Chunks++
+		u.Size += uint64(loc.Length)
+
+		pinned, err := db.pinIndex.Has(item)
+		if err != nil {
+			return true, err
+		}
+		if !pinned {
+			return false, nil
+		}
+		u.Pinned++
+		r, ok := radius[id]
+		if !ok {
+			i, err := db.postageRadiusIndex.Get(shed.Item{BatchID: u.BatchID})
+			switch {
+			case err == nil:
+				r = &i
+			case errors.Is(err, leveldb.ErrNotFound):
+			default:
+				return true, err
+			}
+			radius[id] = r
+		}
+		if r != nil {
+			item.Radius = r.Radius
+			if withinRadiusFn(db, item) {
+				u.Reserve++
+			}
+		}
+		return false, nil
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("postage chunks index: %w", err)
+	}
+
+	batch := new(leveldb.Batch)
+	for _, u := range usage {
+		err := db.batchUsageIndex.PutInBatch(batch, shed.Item{
+			BatchID: u.BatchID,
+			Data:    encodeBatchUsage(*u),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := db.shed.WriteBatch(batch); err != nil {
+		return err
+	}
+	db.logger.Debugf("localstore migration: batch usage of %d batches indexed in %s", len(usage), time.Since(start))
+	return nil
+}
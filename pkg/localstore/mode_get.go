@@ -43,7 +43,10 @@ func (db *DB) Get(ctx context.Context, mode storage.ModeGet, addr penguin.Addres
 		}
 	}()
 
-	out, err := db.get(mode, addr)
+	out, err := db.get(ctx, mode, addr)
+	if mode == storage.ModeGetRequest {
+		db.countCacheRequest(err, addr)
+	}
 	if err != nil {
 		if errors.Is(err, leveldb.ErrNotFound) {
 			return nil, storage.ErrNotFound
@@ -56,13 +59,17 @@ func (db *DB) Get(ctx context.Context, mode storage.ModeGet, addr penguin.Addres
 
 // get returns Item from the retrieval index
 // and updates other indexes.
-func (db *DB) get(mode storage.ModeGet, addr penguin.Address) (out shed.Item, err error) {
+func (db *DB) get(ctx context.Context, mode storage.ModeGet, addr penguin.Address) (out shed.Item, err error) {
 	item := addressToItem(addr)
 
 	out, err = db.retrievalDataIndex.Get(item)
 	if err != nil {
 		return out, err
 	}
+	err = db.readData(ctx, &out)
+	if err != nil {
+		return out, err
+	}
 	switch mode {
 	// update the access timestamp and gc index
 	case storage.ModeGetRequest:
@@ -106,6 +113,7 @@ func (db *DB) updateGCItems(items ...shed.Item) {
 		defer totalTimeMetric(db.metrics.TotalTimeUpdateGC, time.Now())
 
 		for _, item := range items {
+			db.eviction.Accessed(penguin.NewAddress(item.Address))
 			err := db.updateGC(item)
 			if err != nil {
 				db.metrics.GCUpdateError.Inc()
@@ -179,6 +187,33 @@ func (db *DB) updateGC(item shed.Item) (err error) {
 	return db.shed.WriteBatch(batch)
 }
 
+// countCacheRequest counts the requested chunks in the cache hit or miss
+// metrics depending on the error of the lookup. If some of several chunks
+// are not found, the stored ones are counted as hits and the others as
+// misses.
+func (db *DB) countCacheRequest(err error, addrs ...penguin.Address) {
+	policy := db.eviction.Name()
+	switch {
+	case err == nil:
+		db.metrics.CacheHits.WithLabelValues(policy).Add(float64(len(addrs)))
+	case errors.Is(err, leveldb.ErrNotFound) && len(addrs) == 1:
+		db.metrics.CacheMisses.WithLabelValues(policy).Inc()
+	case errors.Is(err, leveldb.ErrNotFound):
+		have, err := db.retrievalDataIndex.HasMulti(addressesToItems(addrs...)...)
+		if err != nil {
+			db.logger.Debugf("localstore: count cache request: %v", err)
+			return
+		}
+		for _, h := range have {
+			if h {
+				db.metrics.CacheHits.WithLabelValues(policy).Inc()
+			} else {
+				db.metrics.CacheMisses.WithLabelValues(policy).Inc()
+			}
+		}
+	}
+}
+
 // testHookUpdateGC is a hook that can provide
 // information when a garbage collection index is updated.
 var testHookUpdateGC func()
@@ -42,7 +42,10 @@ func (db *DB) GetMulti(ctx context.Context, mode storage.ModeGet, addrs ...pengu
 		}
 	}()
 
-	out, err := db.getMulti(mode, addrs...)
+	out, err := db.getMulti(ctx, mode, addrs...)
+	if mode == storage.ModeGetRequest {
+		db.countCacheRequest(err, addrs...)
+	}
 	if err != nil {
 		if errors.Is(err, leveldb.ErrNotFound) {
 			return nil, storage.ErrNotFound
@@ -59,7 +62,7 @@ func (db *DB) GetMulti(ctx context.Context, mode storage.ModeGet, addrs ...pengu
 
 // getMulti returns Items from the retrieval index
 // and updates other indexes.
-func (db *DB) getMulti(mode storage.ModeGet, addrs ...penguin.Address) (out []shed.Item, err error) {
+func (db *DB) getMulti(ctx context.Context, mode storage.ModeGet, addrs ...penguin.Address) (out []shed.Item, err error) {
 	out = make([]shed.Item, len(addrs))
 	for i, addr := range addrs {
 		out[i].Address = addr.Bytes()
@@ -69,6 +72,12 @@ func (db *DB) getMulti(mode storage.ModeGet, addrs ...penguin.Address) (out []sh
 	if err != nil {
 		return nil, err
 	}
+	for i := range out {
+		err = db.readData(ctx, &out[i])
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	switch mode {
 	// update the access timestamp and gc index
@@ -36,7 +36,7 @@ func (db *DB) Put(ctx context.Context, mode storage.ModePut, chs ...penguin.Chun
 	db.metrics.ModePut.Inc()
 	defer totalTimeMetric(db.metrics.TotalTimePut, time.Now())
 
-	exist, err = db.put(mode, chs...)
+	exist, err = db.put(ctx, mode, chs...)
 	if err != nil {
 		db.metrics.ModePutFailure.Inc()
 	}
@@ -51,7 +51,7 @@ func (db *DB) Put(ctx context.Context, mode storage.ModePut, chs ...penguin.Chun
 // and following ones will have exist set to true for their index in exist
 // slice. This is the same behaviour as if the same chunks are passed one by one
 // in multiple put method calls.
-func (db *DB) put(mode storage.ModePut, chs ...penguin.Chunk) (exist []bool, err error) {
+func (db *DB) put(ctx context.Context, mode storage.ModePut, chs ...penguin.Chunk) (exist []bool, err error) {
 	// this is an optimization that tries to optimize on already existing chunks
 	// not needing to acquire batchMu. This is in order to reduce lock contention
 	// when chunks are retried across the network for whatever reason.
@@ -75,12 +75,20 @@ func (db *DB) put(mode storage.ModePut, chs ...penguin.Chunk) (exist []bool, err
 	}
 
 	batch := new(leveldb.Batch)
+	// payloads of new chunks are freed again if the batch is not written
+	payloads := db.newPayloadBatch(ctx)
+	defer func() {
+		if err != nil {
+			payloads.rollback()
+		}
+	}()
 
 	// variables that provide information for operations
 	// to be done after write batch function successfully executes
 	var gcSizeChange int64                      // number to add or subtract from gcSize
 	var triggerPushFeed bool                    // signal push feed subscriptions to iterate
 	triggerPullFeed := make(map[uint8]struct{}) // signal pull feed subscriptions to iterate
+	usage := make(usageChanges)                 // changes to the storage used by batches
 
 	exist = make([]bool, len(chs))
 
@@ -100,12 +108,15 @@ func (db *DB) put(mode storage.ModePut, chs ...penguin.Chunk) (exist []bool, err
 			item := chunkToItem(ch)
 			pin := mode == storage.ModePutRequestPin     // force pin in this mode
 			cache := mode == storage.ModePutRequestCache // force cache
-			exists, c, err := db.putRequest(batch, binIDs, item, pin, cache)
+			exists, c, err := db.putRequest(batch, payloads, binIDs, usage, item, pin, cache)
 			if err != nil {
 				return nil, err
 			}
 			exist[i] = exists
 			gcSizeChange += c
+			if !exists {
+				db.eviction.Accessed(ch.Address())
+			}
 		}
 
 	case storage.ModePutUpload, storage.ModePutUploadPin:
@@ -115,7 +126,11 @@ func (db *DB) put(mode storage.ModePut, chs ...penguin.Chunk) (exist []bool, err
 				continue
 			}
 			item := chunkToItem(ch)
-			exists, c, err := db.putUpload(batch, binIDs, item)
+			t := tierCache
+			if mode == storage.ModePutUploadPin {
+				t = tierPins
+			}
+			exists, c, err := db.putUpload(batch, payloads, binIDs, usage, item, t)
 			if err != nil {
 				return nil, err
 			}
@@ -128,7 +143,7 @@ func (db *DB) put(mode storage.ModePut, chs ...penguin.Chunk) (exist []bool, err
 			}
 			gcSizeChange += c
 			if mode == storage.ModePutUploadPin {
-				c, err = db.setPin(batch, item)
+				c, err = db.setPin(batch, item, usage)
 				if err != nil {
 					return nil, err
 				}
@@ -142,7 +157,7 @@ func (db *DB) put(mode storage.ModePut, chs ...penguin.Chunk) (exist []bool, err
 				exist[i] = true
 				continue
 			}
-			exists, c, err := db.putSync(batch, binIDs, chunkToItem(ch))
+			exists, c, err := db.putSync(batch, payloads, binIDs, usage, chunkToItem(ch))
 			if err != nil {
 				return nil, err
 			}
@@ -168,6 +183,15 @@ func (db *DB) put(mode storage.ModePut, chs ...penguin.Chunk) (exist []bool, err
 		return nil, err
 	}
 
+	err = db.incBatchUsageInBatch(batch, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	err = payloads.sync()
+	if err != nil {
+		return nil, err
+	}
 	err = db.shed.WriteBatch(batch)
 	if err != nil {
 		return nil, err
@@ -186,8 +210,8 @@ func (db *DB) put(mode storage.ModePut, chs ...penguin.Chunk) (exist []bool, err
 //  - put to indexes: retrieve, gc
 //  - it does not enter the syncpool
 // The batch can be written to the database.
-// Provided batch and binID map are updated.
-func (db *DB) putRequest(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed.Item, forcePin, forceCache bool) (exists bool, gcSizeChange int64, err error) {
+// Provided batch, payload batch, binID map and usage changes are updated.
+func (db *DB) putRequest(batch *leveldb.Batch, payloads *payloadBatch, binIDs map[uint8]uint64, usage usageChanges, item shed.Item, forcePin, forceCache bool) (exists bool, gcSizeChange int64, err error) {
 	exists, err = db.retrievalDataIndex.Has(item)
 	if err != nil {
 		return false, 0, err
@@ -201,6 +225,14 @@ func (db *DB) putRequest(batch *leveldb.Batch, binIDs map[uint8]uint64, item she
 	if err != nil {
 		return false, 0, err
 	}
+	t, err := db.putTier(item, forcePin, forceCache)
+	if err != nil {
+		return false, 0, err
+	}
+	err = payloads.write(&item, t)
+	if err != nil {
+		return false, 0, err
+	}
 	err = db.retrievalDataIndex.PutInBatch(batch, item)
 	if err != nil {
 		return false, 0, err
@@ -216,7 +248,12 @@ func (db *DB) putRequest(batch *leveldb.Batch, binIDs map[uint8]uint64, item she
 		return false, 0, err
 	}
 
-	gcSizeChange, err = db.preserveOrCache(batch, item, forcePin, forceCache)
+	err = db.usageStored(usage, item)
+	if err != nil {
+		return false, 0, err
+	}
+
+	gcSizeChange, err = db.preserveOrCache(batch, item, forcePin, forceCache, usage)
 	if err != nil {
 		return false, 0, err
 	}
@@ -236,8 +273,9 @@ func (db *DB) putRequest(batch *leveldb.Batch, binIDs map[uint8]uint64, item she
 // putUpload adds an Item to the batch by updating required indexes:
 //  - put to indexes: retrieve, push, pull
 // The batch can be written to the database.
-// Provided batch and binID map are updated.
-func (db *DB) putUpload(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed.Item) (exists bool, gcSizeChange int64, err error) {
+// Provided batch, payload batch, binID map and usage changes are updated,
+// the payload is stored in the tier t.
+func (db *DB) putUpload(batch *leveldb.Batch, payloads *payloadBatch, binIDs map[uint8]uint64, usage usageChanges, item shed.Item, t tier) (exists bool, gcSizeChange int64, err error) {
 	exists, err = db.retrievalDataIndex.Has(item)
 	if err != nil {
 		return false, 0, err
@@ -251,6 +289,10 @@ func (db *DB) putUpload(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed
 	if err != nil {
 		return false, 0, err
 	}
+	err = payloads.write(&item, t)
+	if err != nil {
+		return false, 0, err
+	}
 	err = db.retrievalDataIndex.PutInBatch(batch, item)
 	if err != nil {
 		return false, 0, err
@@ -268,14 +310,18 @@ func (db *DB) putUpload(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed
 	if err != nil {
 		return false, 0, err
 	}
+	err = db.usageStored(usage, item)
+	if err != nil {
+		return false, 0, err
+	}
 	return false, 0, nil
 }
 
 // putSync adds an Item to the batch by updating required indexes:
 //  - put to indexes: retrieve, pull, gc
 // The batch can be written to the database.
-// Provided batch and binID map are updated.
-func (db *DB) putSync(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed.Item) (exists bool, gcSizeChange int64, err error) {
+// Provided batch, payload batch, binID map and usage changes are updated.
+func (db *DB) putSync(batch *leveldb.Batch, payloads *payloadBatch, binIDs map[uint8]uint64, usage usageChanges, item shed.Item) (exists bool, gcSizeChange int64, err error) {
 	exists, err = db.retrievalDataIndex.Has(item)
 	if err != nil {
 		return false, 0, err
@@ -289,6 +335,14 @@ func (db *DB) putSync(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed.I
 	if err != nil {
 		return false, 0, err
 	}
+	t, err := db.putTier(item, false, false)
+	if err != nil {
+		return false, 0, err
+	}
+	err = payloads.write(&item, t)
+	if err != nil {
+		return false, 0, err
+	}
 	err = db.retrievalDataIndex.PutInBatch(batch, item)
 	if err != nil {
 		return false, 0, err
@@ -308,7 +362,12 @@ func (db *DB) putSync(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed.I
 		return false, 0, err
 	}
 
-	gcSizeChange, err = db.preserveOrCache(batch, item, false, false)
+	err = db.usageStored(usage, item)
+	if err != nil {
+		return false, 0, err
+	}
+
+	gcSizeChange, err = db.preserveOrCache(batch, item, false, false, usage)
 	if err != nil {
 		return false, 0, err
 	}
@@ -318,7 +377,7 @@ func (db *DB) putSync(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed.I
 
 // preserveOrCache is a helper function used to add chunks to either a pinned reserve or gc cache
 // (the retrieval access index and the gc index)
-func (db *DB) preserveOrCache(batch *leveldb.Batch, item shed.Item, forcePin, forceCache bool) (gcSizeChange int64, err error) {
+func (db *DB) preserveOrCache(batch *leveldb.Batch, item shed.Item, forcePin, forceCache bool, usage usageChanges) (gcSizeChange int64, err error) {
 	// item needs to be populated with Radius
 	item2, err := db.postageRadiusIndex.Get(item)
 	if err != nil {
@@ -329,7 +388,12 @@ func (db *DB) preserveOrCache(batch *leveldb.Batch, item shed.Item, forcePin, fo
 	}
 
 	if !forceCache && (withinRadiusFn(db, item) || forcePin) {
-		return db.setPin(batch, item)
+		if withinRadiusFn(db, item) {
+			if c := usage.batch(item.BatchID); c != nil {
+				c.reserve++
+			}
+		}
+		return db.setPin(batch, item, usage)
 	}
 
 	// add new entry to gc index ONLY if it is not present in pinIndex
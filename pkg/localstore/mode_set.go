@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/penguintop/penguin/pkg/sharky"
 	"github.com/penguintop/penguin/pkg/shed"
 	"github.com/penguintop/penguin/pkg/storage"
     "github.com/penguintop/penguin/pkg/penguin"
@@ -36,7 +37,7 @@ import (
 func (db *DB) Set(ctx context.Context, mode storage.ModeSet, addrs ...penguin.Address) (err error) {
 	db.metrics.ModeSet.Inc()
 	defer totalTimeMetric(db.metrics.TotalTimeSet, time.Now())
-	err = db.set(mode, addrs...)
+	err = db.set(ctx, mode, addrs...)
 	if err != nil {
 		db.metrics.ModeSetFailure.Inc()
 	}
@@ -45,7 +46,7 @@ func (db *DB) Set(ctx context.Context, mode storage.ModeSet, addrs ...penguin.Ad
 
 // set updates database indexes for
 // chunks represented by provided addresses.
-func (db *DB) set(mode storage.ModeSet, addrs ...penguin.Address) (err error) {
+func (db *DB) set(ctx context.Context, mode storage.ModeSet, addrs ...penguin.Address) (err error) {
 	// protect parallel updates
 	db.batchMu.Lock()
 	defer db.batchMu.Unlock()
@@ -58,13 +59,16 @@ func (db *DB) set(mode storage.ModeSet, addrs ...penguin.Address) (err error) {
 	// variables that provide information for operations
 	// to be done after write batch function successfully executes
 	var gcSizeChange int64                      // number to add or subtract from gcSize
+	var released []sharky.Location              // payloads of removed chunks
 	triggerPullFeed := make(map[uint8]struct{}) // signal pull feed subscriptions to iterate
+	var triggerBalance bool                     // signal storage tier balancing to run
+	usage := make(usageChanges)                 // changes to the storage used by batches
 
 	switch mode {
 
 	case storage.ModeSetSync:
 		for _, addr := range addrs {
-			c, err := db.setSync(batch, addr)
+			c, err := db.setSync(batch, addr, usage)
 			if err != nil {
 				return err
 			}
@@ -73,31 +77,41 @@ func (db *DB) set(mode storage.ModeSet, addrs ...penguin.Address) (err error) {
 
 	case storage.ModeSetRemove:
 		for _, addr := range addrs {
-			item := addressToItem(addr)
-			c, err := db.setRemove(batch, item, true)
+			item, err := db.retrievalDataIndex.Get(addressToItem(addr))
+			if err != nil {
+				return err
+			}
+			c, err := db.setRemove(batch, item, true, usage)
 			if err != nil {
 				return err
 			}
 			gcSizeChange += c
+			loc, err := sharky.LocationFromBinary(item.Location)
+			if err != nil {
+				return err
+			}
+			released = append(released, loc)
 		}
 
 	case storage.ModeSetPin:
 		for _, addr := range addrs {
 			item := addressToItem(addr)
-			c, err := db.setPin(batch, item)
+			c, err := db.setPin(batch, item, usage)
 			if err != nil {
 				return err
 			}
 			gcSizeChange += c
 		}
+		triggerBalance = true
 	case storage.ModeSetUnpin:
 		for _, addr := range addrs {
-			c, err := db.setUnpin(batch, addr)
+			c, err := db.setUnpin(batch, addr, usage)
 			if err != nil {
 				return err
 			}
 			gcSizeChange += c
 		}
+		triggerBalance = true
 	default:
 		return ErrInvalidMode
 	}
@@ -107,13 +121,22 @@ func (db *DB) set(mode storage.ModeSet, addrs ...penguin.Address) (err error) {
 		return err
 	}
 
+	err = db.incBatchUsageInBatch(batch, usage)
+	if err != nil {
+		return err
+	}
+
 	err = db.shed.WriteBatch(batch)
 	if err != nil {
 		return err
 	}
+	db.releaseLocations(ctx, released)
 	for po := range triggerPullFeed {
 		db.triggerPullSubscriptions(po)
 	}
+	if triggerBalance {
+		db.triggerBalanceTiers()
+	}
 	return nil
 }
 
@@ -121,8 +144,8 @@ func (db *DB) set(mode storage.ModeSet, addrs ...penguin.Address) (err error) {
 // - ModeSetSync - the corresponding tag is incremented, then item is removed
 //   from push sync index
 // - update to gc index happens given item does not exist in pin index
-// Provided batch is updated.
-func (db *DB) setSync(batch *leveldb.Batch, addr penguin.Address) (gcSizeChange int64, err error) {
+// Provided batch and usage changes are updated.
+func (db *DB) setSync(batch *leveldb.Batch, addr penguin.Address, usage usageChanges) (gcSizeChange int64, err error) {
 	item := addressToItem(addr)
 
 	// need to get access timestamp here as it is not
@@ -197,13 +220,13 @@ func (db *DB) setSync(batch *leveldb.Batch, addr penguin.Address) (gcSizeChange
 		return 0, fmt.Errorf("postage chunks index: %w", err)
 	}
 	item.Radius = item2.Radius
-	return db.preserveOrCache(batch, item, false, false)
+	return db.preserveOrCache(batch, item, false, false, usage)
 }
 
 // setRemove removes the chunk by updating indexes:
 //  - delete from retrieve, pull, gc
-// Provided batch is updated.
-func (db *DB) setRemove(batch *leveldb.Batch, item shed.Item, check bool) (gcSizeChange int64, err error) {
+// Provided batch and usage changes are updated.
+func (db *DB) setRemove(batch *leveldb.Batch, item shed.Item, check bool, usage usageChanges) (gcSizeChange int64, err error) {
 	if item.AccessTimestamp == 0 {
 		i, err := db.retrievalAccessIndex.Get(item)
 		switch {
@@ -224,6 +247,15 @@ func (db *DB) setRemove(batch *leveldb.Batch, item shed.Item, check bool) (gcSiz
 	db.metrics.GCStoreTimeStamps.Set(float64(item.StoreTimestamp))
 	db.metrics.GCStoreAccessTimeStamps.Set(float64(item.AccessTimestamp))
 
+	pinned, err := db.pinIndex.Has(item)
+	if err != nil {
+		return 0, err
+	}
+	err = db.usageRemoved(usage, item, pinned)
+	if err != nil {
+		return 0, err
+	}
+
 	err = db.retrievalDataIndex.DeleteInBatch(batch, item)
 	if err != nil {
 		return 0, err
@@ -261,8 +293,8 @@ func (db *DB) setRemove(batch *leveldb.Batch, item shed.Item, check bool) (gcSiz
 
 // setPin increments pin counter for the chunk by updating
 // pin index and sets the chunk to be excluded from garbage collection.
-// Provided batch is updated.
-func (db *DB) setPin(batch *leveldb.Batch, item shed.Item) (gcSizeChange int64, err error) {
+// Provided batch and usage changes are updated.
+func (db *DB) setPin(batch *leveldb.Batch, item shed.Item, usage usageChanges) (gcSizeChange int64, err error) {
 	// Get the existing pin counter of the chunk
 	i, err := db.pinIndex.Get(item)
 	item.PinCounter = i.PinCounter
@@ -270,6 +302,10 @@ func (db *DB) setPin(batch *leveldb.Batch, item shed.Item) (gcSizeChange int64,
 		if !errors.Is(err, leveldb.ErrNotFound) {
 			return 0, err
 		}
+		err = db.usagePinned(usage, item, 1)
+		if err != nil {
+			return 0, err
+		}
 		// if this Address is not pinned yet, then
 		i, err := db.retrievalAccessIndex.Get(item)
 		if err != nil {
@@ -304,8 +340,8 @@ func (db *DB) setPin(batch *leveldb.Batch, item shed.Item) (gcSizeChange int64,
 }
 
 // setUnpin decrements pin counter for the chunk by updating pin index.
-// Provided batch is updated.
-func (db *DB) setUnpin(batch *leveldb.Batch, addr penguin.Address) (gcSizeChange int64, err error) {
+// Provided batch and usage changes are updated.
+func (db *DB) setUnpin(batch *leveldb.Batch, addr penguin.Address, usage usageChanges) (gcSizeChange int64, err error) {
 	item := addressToItem(addr)
 
 	// Get the existing pin counter of the chunk
@@ -334,6 +370,9 @@ func (db *DB) setUnpin(batch *leveldb.Batch, addr penguin.Address) (gcSizeChange
 	item.StoreTimestamp = i.StoreTimestamp
 	item.BinID = i.BinID
 	item.BatchID = i.BatchID
+	if c := usage.batch(item.BatchID); c != nil {
+		c.pinned--
+	}
 	i, err = db.pushIndex.Get(item)
 	if !errors.Is(err, leveldb.ErrNotFound) {
 		// err is either nil or not leveldb.ErrNotFound
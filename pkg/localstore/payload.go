@@ -0,0 +1,220 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/sharky"
+	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/penguintop/penguin/pkg/soc"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	// sharkyDir is the directory of the default payload store
+	// inside the localstore directory.
+	sharkyDir = "sharky"
+	// sharkyShardCount is the number of shards of every payload store.
+	sharkyShardCount = 32
+	// sharkyDirtyFile marks a payload store as in use. It is
+	// removed on a clean close, so finding it on startup means that the
+	// free slots have to be recovered from the retrieval data index.
+	sharkyDirtyFile = ".DIRTY"
+)
+
+// maxChunkDataSize is the size of the largest chunk payload, which is
+// a single owner chunk wrapping a full content addressed chunk.
+const maxChunkDataSize = soc.IdSize + soc.SignatureSize + penguin.ChunkWithSpanSize
+
+// PayloadStore keeps chunk payloads outside of leveldb, the retrieval
+// data index only stores their location.
+type PayloadStore interface {
+	Write(ctx context.Context, data []byte) (sharky.Location, error)
+	Read(ctx context.Context, loc sharky.Location, buf []byte) error
+	Release(ctx context.Context, loc sharky.Location) error
+	// Sync flushes the written payloads to disk.
+	Sync(ctx context.Context) error
+	io.Closer
+}
+
+// openSharky opens the payload store in dir as the store with the given
+// index of the tiered store, recovering its free slots if it or the
+// database was not closed cleanly. The slots of the chunks lost from the
+// retrieval data index by an unclean shutdown are freed that way, their
+// locations are not known otherwise.
+func (db *DB) openSharky(dir string, index int) (PayloadStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	dirtyFile := filepath.Join(dir, sharkyDirtyFile)
+	_, err := os.Stat(dirtyFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil || db.uncleanShutdown {
+		if err := db.recoverSharky(dir, index); err != nil {
+			return nil, fmt.Errorf("recover payload store: %w", err)
+		}
+	}
+
+	s, err := sharky.New(dir, sharkyShardCount, maxChunkDataSize)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(dirtyFile)
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	db.sharkyDirtyFiles = append(db.sharkyDirtyFiles, dirtyFile)
+	return s, nil
+}
+
+// recoverSharky frees all slots of the payload store in dir which are not
+// referenced by the retrieval data index.
+func (db *DB) recoverSharky(dir string, index int) error {
+	db.logger.Infof("localstore: payload store %s was not closed cleanly, recovering free slots", dir)
+
+	r, err := sharky.NewRecovery(dir, sharkyShardCount, maxChunkDataSize)
+	if err != nil {
+		return err
+	}
+	var count int
+	err = db.retrievalDataIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		loc, err := sharky.LocationFromBinary(item.Location)
+		if err != nil {
+			return true, fmt.Errorf("chunk %x: %w", item.Address, err)
+		}
+		if int(loc.Shard)/sharkyShardCount != index {
+			return false, nil
+		}
+		loc.Shard %= sharkyShardCount
+		if err := r.Add(loc); err != nil {
+			return true, fmt.Errorf("chunk %x: %w", item.Address, err)
+		}
+		count++
+		return false, nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if err := r.Save(); err != nil {
+		return err
+	}
+
+	db.logger.Infof("localstore: recovered payload store %s with %d chunks", dir, count)
+	return nil
+}
+
+// closePayloads closes the payload store and marks it as cleanly closed.
+func (db *DB) closePayloads() error {
+	if err := db.payloads.Close(); err != nil {
+		return err
+	}
+	for _, f := range db.sharkyDirtyFiles {
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readData reads the chunk payload referenced by the item location
+// into the item data. The chunk may have been removed and its slot
+// released since the location was looked up. The payload store holds off
+// reusing slots while they are read, so the payload read belongs to the
+// chunk if the chunk still references the location afterwards, otherwise
+// the chunk is not found.
+func (db *DB) readData(ctx context.Context, item *shed.Item) error {
+	loc, err := sharky.LocationFromBinary(item.Location)
+	if err != nil {
+		return fmt.Errorf("chunk %x: %w", item.Address, err)
+	}
+	item.Data = make([]byte, loc.Length)
+	readErr := db.payloads.Read(ctx, loc, item.Data)
+	if readErr != nil && ctx.Err() != nil {
+		return readErr
+	}
+
+	current, err := db.retrievalDataIndex.Get(shed.Item{Address: item.Address})
+	switch {
+	case errors.Is(err, leveldb.ErrNotFound):
+		return storage.ErrNotFound
+	case err != nil:
+		return err
+	case !bytes.Equal(current.Location, item.Location):
+		return storage.ErrNotFound
+	case readErr != nil:
+		return fmt.Errorf("read chunk %x payload: %w", item.Address, readErr)
+	}
+	return nil
+}
+
+// releaseLocations frees the payloads of chunks which are no longer
+// referenced. It must only be called after the batch removing the
+// references is written, errors are logged as they leave the payload
+// store with unused slots at worst.
+func (db *DB) releaseLocations(ctx context.Context, locations []sharky.Location) {
+	for _, loc := range locations {
+		if err := db.payloads.Release(ctx, loc); err != nil {
+			db.logger.Warningf("localstore: release payload at %+v: %v", loc, err)
+		}
+	}
+}
+
+// payloadBatch tracks the payloads written alongside a leveldb batch.
+// The payloads must be synced before the batch referencing them is
+// written.
+type payloadBatch struct {
+	db        *DB
+	ctx       context.Context
+	locations []sharky.Location
+}
+
+func (db *DB) newPayloadBatch(ctx context.Context) *payloadBatch {
+	return &payloadBatch{db: db, ctx: ctx}
+}
+
+// write stores the item data in the payload store of the tier
+// and sets the item location.
+func (b *payloadBatch) write(item *shed.Item, t tier) error {
+	loc, err := b.db.writePayload(b.ctx, t, item.Data)
+	if err != nil {
+		return fmt.Errorf("write chunk %x payload: %w", item.Address, err)
+	}
+	b.locations = append(b.locations, loc)
+	item.Location, err = loc.MarshalBinary()
+	return err
+}
+
+// sync flushes the written payloads to disk.
+func (b *payloadBatch) sync() error {
+	if len(b.locations) == 0 {
+		return nil
+	}
+	if err := b.db.payloads.Sync(b.ctx); err != nil {
+		return fmt.Errorf("sync payloads: %w", err)
+	}
+	return nil
+}
+
+// rollback releases the written payloads when the batch
+// referencing them is not written.
+func (b *payloadBatch) rollback() {
+	b.db.releaseLocations(context.Background(), b.locations)
+}
@@ -0,0 +1,222 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/postage"
+	"github.com/penguintop/penguin/pkg/sharky"
+	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/penguintop/penguin/pkg/storage"
+)
+
+func newTestDBAt(t *testing.T, dir string, baseKey []byte) *DB {
+	t.Helper()
+
+	db, err := New(dir, baseKey, nil, logging.New(ioutil.Discard, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "localstore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// TestPayloadStoreRecovery checks that payloads leaked by an unclean
+// shutdown are freed on the next start.
+func TestPayloadStoreRecovery(t *testing.T) {
+	dir := testDir(t)
+	baseKey := make([]byte, 32)
+
+	db := newTestDBAt(t, dir, baseKey)
+	chunks := generateTestRandomChunks(10)
+	if _, err := db.Put(context.Background(), storage.ModePutUpload, chunks...); err != nil {
+		t.Fatal(err)
+	}
+
+	// drop the references to half of the chunks without
+	// releasing their payloads, as a crash would
+	var leaked []sharky.Location
+	for _, ch := range chunks[:5] {
+		item, err := db.retrievalDataIndex.Get(addressToItem(ch.Address()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		loc, err := sharky.LocationFromBinary(item.Location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaked = append(leaked, loc)
+		if err := db.retrievalDataIndex.Delete(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dirtyFile := filepath.Join(dir, sharkyDir, sharkyDirtyFile)
+	if _, err := os.Stat(dirtyFile); !os.IsNotExist(err) {
+		t.Fatalf("dirty file after clean close: %v", err)
+	}
+	if err := ioutil.WriteFile(dirtyFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db = newTestDBAt(t, dir, baseKey)
+	defer db.Close()
+
+	for _, loc := range leaked {
+		if err := db.payloads.Release(context.Background(), loc); !errors.Is(err, sharky.ErrInvalidLocation) {
+			t.Fatalf("leaked payload at %+v: got error %v, want %v", loc, err, sharky.ErrInvalidLocation)
+		}
+	}
+	for _, ch := range chunks[5:] {
+		got, err := db.Get(context.Background(), storage.ModeGetLookup, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Data(), ch.Data()) {
+			t.Fatalf("got chunk data %x, want %x", got.Data(), ch.Data())
+		}
+	}
+}
+
+// TestPayloadStoreRelease checks that the payloads of removed
+// chunks are released.
+func TestPayloadStoreRelease(t *testing.T) {
+	db := newTestDB(t, nil)
+
+	ch := generateTestRandomChunk()
+	if _, err := db.Put(context.Background(), storage.ModePutUpload, ch); err != nil {
+		t.Fatal(err)
+	}
+	item, err := db.retrievalDataIndex.Get(addressToItem(ch.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, err := sharky.LocationFromBinary(item.Location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Set(context.Background(), storage.ModeSetRemove, ch.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.payloads.Release(context.Background(), loc); !errors.Is(err, sharky.ErrInvalidLocation) {
+		t.Fatalf("got error %v, want %v", err, sharky.ErrInvalidLocation)
+	}
+}
+
+// TestMigrateSharky checks that the chunk payloads of the previous schema
+// are moved to the payload store.
+func TestMigrateSharky(t *testing.T) {
+	dir := testDir(t)
+	baseKey := make([]byte, 32)
+
+	db := newTestDBAt(t, dir, baseKey)
+	chunks := generateTestRandomChunks(10)
+	if _, err := db.Put(context.Background(), storage.ModePutUpload, chunks...); err != nil {
+		t.Fatal(err)
+	}
+
+	// move the chunks back to the index of the previous schema
+	headerSize := 16 + postage.StampSize
+	oldIndexFuncs := shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			return fields.Address, nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.Address = key
+			return e, nil
+		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			b := make([]byte, headerSize)
+			binary.BigEndian.PutUint64(b[:8], fields.BinID)
+			binary.BigEndian.PutUint64(b[8:16], uint64(fields.StoreTimestamp))
+			stamp, err := postage.NewStamp(fields.BatchID, fields.Sig).MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			copy(b[16:], stamp)
+			return append(b, fields.Data...), nil
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			return e, nil
+		},
+	}
+	oldIndex, err := db.shed.NewIndex("Address->StoreTimestamp|BinID|BatchID|Sig|Data", oldIndexFuncs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range chunks {
+		item, err := db.retrievalDataIndex.Get(addressToItem(ch.Address()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.readData(context.Background(), &item); err != nil {
+			t.Fatal(err)
+		}
+		if err := oldIndex.Put(item); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.retrievalDataIndex.Delete(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.schemaName.Put(DbSchemaYuj); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = newTestDBAt(t, dir, baseKey)
+	defer db.Close()
+
+	schemaName, err := db.schemaName.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schemaName != DbSchemaCurrent {
+		t.Fatalf("got schema %q, want %q", schemaName, DbSchemaCurrent)
+	}
+	oldIndex, err = db.shed.NewIndex("Address->StoreTimestamp|BinID|BatchID|Sig|Data", oldIndexFuncs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newItemsCountTest(oldIndex, 0)(t)
+	newItemsCountTest(db.retrievalDataIndex, len(chunks))(t)
+
+	for _, ch := range chunks {
+		got, err := db.Get(context.Background(), storage.ModeGetLookup, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Data(), ch.Data()) {
+			t.Fatalf("got chunk data %x, want %x", got.Data(), ch.Data())
+		}
+		if !bytes.Equal(got.Stamp().BatchID(), ch.Stamp().BatchID()) {
+			t.Fatalf("got batch id %x, want %x", got.Stamp().BatchID(), ch.Stamp().BatchID())
+		}
+	}
+}
@@ -38,10 +38,11 @@ func (db *DB) UnreserveBatch(id []byte, radius uint8) error {
 		return db.shed.WriteBatch(batch)
 	}
 	oldRadius := i.Radius
-	var gcSizeChange int64 // number to add or subtract from gcSize
+	var gcSizeChange int64      // number to add or subtract from gcSize
+	usage := make(usageChanges) // chunks leaving the reserve
 	unpin := func(item shed.Item) (stop bool, err error) {
 		addr := penguin.NewAddress(item.Address)
-		c, err := db.setUnpin(batch, addr)
+		c, err := db.setUnpin(batch, addr, usage)
 		if err != nil {
 			if !errors.Is(err, leveldb.ErrNotFound) {
 				return false, fmt.Errorf("unpin: %w", err)
@@ -50,6 +51,8 @@ func (db *DB) UnreserveBatch(id []byte, radius uint8) error {
 				// a dirty shutdown
 				db.logger.Tracef("unreserve set unpin chunk %s: %v", addr.String(), err)
 			}
+		} else if c := usage.batch(id); c != nil {
+			c.reserve--
 		}
 
 		gcSizeChange += c
@@ -66,6 +69,9 @@ func (db *DB) UnreserveBatch(id []byte, radius uint8) error {
 		if err := db.incGCSizeInBatch(batch, gcSizeChange); err != nil {
 			return err
 		}
+		if err := db.incBatchUsageInBatch(batch, usage); err != nil {
+			return err
+		}
 		item.Radius = bin
 		if err := db.postageRadiusIndex.PutInBatch(batch, item); err != nil {
 			return err
@@ -80,6 +86,7 @@ func (db *DB) UnreserveBatch(id []byte, radius uint8) error {
 		}
 		batch = new(leveldb.Batch)
 		gcSizeChange = 0
+		usage = make(usageChanges)
 	}
 
 	gcSize, err := db.gcSize.Get()
@@ -90,6 +97,8 @@ func (db *DB) UnreserveBatch(id []byte, radius uint8) error {
 	if gcSize >= db.cacheCapacity {
 		db.triggerGarbageCollection()
 	}
+	// unreserved chunks move from the reserve tier
+	db.triggerBalanceTiers()
 
 	return nil
 }
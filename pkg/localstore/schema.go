@@ -18,7 +18,7 @@ package localstore
 
 // The DB schema we want to use. The actual/current DB schema might differ
 // until migrations are run.
-var DbSchemaCurrent = DbSchemaYuj
+var DbSchemaCurrent = DbSchemaUsage
 
 // There was a time when we had no schema at all.
 const DbSchemaNone = ""
@@ -29,3 +29,11 @@ const DbSchemaCode = "code"
 // DbSchemaYuj is the pen schema indentifier for storage incentives
 // initial iteration.
 const DbSchemaYuj = "yuj"
+
+// DbSchemaSharky is the pen schema identifier for chunk payloads
+// stored outside of leveldb.
+const DbSchemaSharky = "sharky"
+
+// DbSchemaUsage is the pen schema identifier for the index
+// of the local storage used by postage batches.
+const DbSchemaUsage = "usage"
@@ -0,0 +1,551 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/cac"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/postage"
+	"github.com/penguintop/penguin/pkg/sharky"
+	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/penguintop/penguin/pkg/soc"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/syndtr/goleveldb/leveldb"
+	"golang.org/x/time/rate"
+)
+
+// Reasons for the scrubber to quarantine a chunk.
+const (
+	ScrubReasonUnreadable   = "unreadable payload"
+	ScrubReasonInvalidChunk = "content does not match address"
+	ScrubReasonInvalidStamp = "invalid postage stamp"
+)
+
+const (
+	// DefaultScrubRate is the default number of chunks
+	// checked by the scrubber per second.
+	DefaultScrubRate = 100
+	// DefaultScrubInterval is the default pause between
+	// two passes of the scrubber.
+	DefaultScrubInterval = 24 * time.Hour
+	// DefaultQuarantineCapacity is the default number of quarantined
+	// chunks remembered by the scrubber.
+	DefaultQuarantineCapacity = 10000
+
+	// scrubBatchSize is the number of chunks read from the
+	// retrieval data index with a single iterator.
+	scrubBatchSize = 100
+)
+
+// errScrubChanged is returned when a chunk changed between
+// being checked and being quarantined.
+var errScrubChanged = errors.New("chunk changed while scrubbing")
+
+// Retriever retrieves chunks from the network.
+type Retriever interface {
+	RetrieveChunk(ctx context.Context, addr penguin.Address) (penguin.Chunk, error)
+}
+
+// ScrubberOptions configures the scrubber.
+type ScrubberOptions struct {
+	// Rate is the number of chunks checked per second.
+	Rate float64
+	// Interval is the pause between two passes over the localstore.
+	Interval time.Duration
+	// QuarantineCapacity is the number of quarantined chunks remembered,
+	// the oldest are forgotten first.
+	QuarantineCapacity uint64
+}
+
+// ScrubStatus reports the progress and findings of the scrubber.
+type ScrubStatus struct {
+	Running      bool      // a pass is in progress
+	Passes       uint64    // completed passes
+	PassStarted  time.Time // start of the current or last pass
+	PassFinished time.Time // end of the last completed pass
+	Checked      uint64    // chunks checked in the current or last pass
+
+	// totals since the scrubber was started
+	Unreadable    uint64 // chunks with payloads that could not be read
+	InvalidChunks uint64 // chunks not matching their address
+	InvalidStamps uint64 // chunks with invalid postage stamps
+	UnknownBatch  uint64 // chunks with stamps of unknown batches, not verified
+	Refetched     uint64 // corrupt pinned chunks fetched again from the network
+	RefetchFailed uint64 // corrupt pinned chunks that could not be fetched again
+}
+
+// QuarantinedChunk is a chunk removed by the scrubber.
+type QuarantinedChunk struct {
+	Address     penguin.Address
+	BatchID     []byte
+	Reason      string
+	PinCounter  uint64
+	Quarantined time.Time
+	// Restored is true if the chunk is stored again.
+	Restored bool
+}
+
+// Scrubber checks in the background that the stored chunks still match
+// their addresses and postage stamps. Corrupt chunks are quarantined and
+// pinned ones are fetched again from the network.
+type Scrubber struct {
+	db         *DB
+	validStamp func(penguin.Chunk, []byte) (penguin.Chunk, error)
+	retriever  Retriever
+	limiter    *rate.Limiter
+	interval   time.Duration
+	capacity   uint64
+	logger     logging.Logger
+
+	mu     sync.Mutex
+	status ScrubStatus
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewScrubber creates a scrubber of the localstore. Stamps are not verified
+// without validStamp and corrupt pinned chunks are not fetched again
+// without retriever.
+func NewScrubber(db *DB, validStamp func(penguin.Chunk, []byte) (penguin.Chunk, error), retriever Retriever, o ScrubberOptions, logger logging.Logger) *Scrubber {
+	if o.Rate <= 0 {
+		o.Rate = DefaultScrubRate
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultScrubInterval
+	}
+	if o.QuarantineCapacity == 0 {
+		o.QuarantineCapacity = DefaultQuarantineCapacity
+	}
+	return &Scrubber{
+		db:         db,
+		validStamp: validStamp,
+		retriever:  retriever,
+		limiter:    rate.NewLimiter(rate.Limit(o.Rate), 1),
+		interval:   o.Interval,
+		capacity:   o.QuarantineCapacity,
+		logger:     logger,
+		quit:       make(chan struct{}),
+	}
+}
+
+// Start runs a pass right away and then after every interval.
+func (s *Scrubber) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-s.quit:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		for {
+			if err := s.Scrub(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				s.logger.Errorf("localstore scrubber: %v", err)
+			}
+			select {
+			case <-s.quit:
+				return
+			case <-time.After(s.interval):
+			}
+		}
+	}()
+}
+
+// Status returns the progress and findings of the scrubber.
+func (s *Scrubber) Status() ScrubStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Scrub checks all chunks in the localstore once.
+func (s *Scrubber) Scrub(ctx context.Context) error {
+	s.mu.Lock()
+	s.status.Running = true
+	s.status.PassStarted = time.Now()
+	s.status.Checked = 0
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.status.Running = false
+		s.mu.Unlock()
+	}()
+
+	var cursor *shed.Item
+	for {
+		items := make([]shed.Item, 0, scrubBatchSize)
+		err := s.db.retrievalDataIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+			items = append(items, item)
+			return len(items) == scrubBatchSize, nil
+		}, &shed.IterateOptions{
+			StartFrom:         cursor,
+			SkipStartFromItem: true,
+		})
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			break
+		}
+
+		for _, item := range items {
+			if err := s.limiter.Wait(ctx); err != nil {
+				return err
+			}
+			if err := s.check(ctx, item); err != nil {
+				return err
+			}
+		}
+		cursor = &items[len(items)-1]
+	}
+
+	s.db.metrics.ScrubPasses.Inc()
+	s.mu.Lock()
+	s.status.Passes++
+	s.status.PassFinished = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// check verifies a single chunk and quarantines it if it is corrupt.
+func (s *Scrubber) check(ctx context.Context, item shed.Item) error {
+	s.db.metrics.ScrubChecked.Inc()
+
+	reason, unknownBatch, err := s.verify(ctx, item)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.status.Checked++
+	switch {
+	case unknownBatch:
+		s.status.UnknownBatch++
+	case reason == ScrubReasonUnreadable:
+		s.status.Unreadable++
+	case reason == ScrubReasonInvalidChunk:
+		s.status.InvalidChunks++
+	case reason == ScrubReasonInvalidStamp:
+		s.status.InvalidStamps++
+	}
+	s.mu.Unlock()
+
+	if reason == "" {
+		return nil
+	}
+
+	addr := penguin.NewAddress(item.Address)
+	pinCounter, err := s.db.quarantine(item, reason, s.capacity)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) || errors.Is(err, errScrubChanged) {
+			return nil
+		}
+		return err
+	}
+	s.db.metrics.ScrubCorrupt.Inc()
+	s.logger.Warningf("localstore scrubber: quarantined chunk %s: %s", addr, reason)
+
+	if pinCounter > 0 && s.retriever != nil {
+		s.refetch(ctx, addr, pinCounter)
+	}
+	return nil
+}
+
+// verify returns the reason for quarantining the chunk, or an empty
+// reason if it is intact.
+func (s *Scrubber) verify(ctx context.Context, item shed.Item) (reason string, unknownBatch bool, err error) {
+	if err := s.db.readData(ctx, &item); err != nil {
+		switch {
+		case ctx.Err() != nil:
+			return "", false, ctx.Err()
+		case errors.Is(err, storage.ErrNotFound):
+			// removed since it was listed
+			return "", false, nil
+		}
+		return ScrubReasonUnreadable, false, nil
+	}
+
+	ch := penguin.NewChunk(penguin.NewAddress(item.Address), item.Data)
+	if !cac.Valid(ch) && !soc.Valid(ch) {
+		return ScrubReasonInvalidChunk, false, nil
+	}
+
+	if s.validStamp == nil {
+		return "", false, nil
+	}
+	stamp, err := postage.NewStamp(item.BatchID, item.Sig).MarshalBinary()
+	if err != nil {
+		return "", false, err
+	}
+	_, err = s.validStamp(ch, stamp)
+	switch {
+	case err == nil:
+		return "", false, nil
+	case errors.Is(err, postage.ErrNotFound):
+		return "", true, nil
+	}
+	// chunks retrieved with invalid stamps are kept in the cache
+	// on purpose, only the chunks accepted for syncing are corrupt
+	synced, err := s.db.pullIndex.Has(item)
+	if err != nil {
+		return "", false, err
+	}
+	if synced {
+		return ScrubReasonInvalidStamp, false, nil
+	}
+	return "", false, nil
+}
+
+// refetch retrieves a quarantined pinned chunk from the network
+// and stores it again with its pin counter.
+func (s *Scrubber) refetch(ctx context.Context, addr penguin.Address, pinCounter uint64) {
+	err := func() error {
+		ch, err := s.retriever.RetrieveChunk(ctx, addr)
+		if err != nil {
+			return err
+		}
+		if !cac.Valid(ch) && !soc.Valid(ch) {
+			return penguin.ErrInvalidChunk
+		}
+
+		mode := storage.ModePutRequestCache
+		if s.validStamp != nil && ch.Stamp() != nil {
+			if stamp, err := ch.Stamp().MarshalBinary(); err == nil {
+				if cch, err := s.validStamp(ch, stamp); err == nil {
+					ch, mode = cch, storage.ModePutRequest
+				}
+			}
+		}
+		if _, err := s.db.Put(ctx, mode, ch); err != nil {
+			return err
+		}
+		return s.db.restorePin(addr, pinCounter)
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.status.RefetchFailed++
+		s.db.metrics.ScrubRefetchFailed.Inc()
+		s.logger.Errorf("localstore scrubber: refetch pinned chunk %s: %v", addr, err)
+		return
+	}
+	s.status.Refetched++
+	s.db.metrics.ScrubRefetched.Inc()
+	s.logger.Infof("localstore scrubber: restored pinned chunk %s", addr)
+}
+
+// Quarantined returns the chunks removed by the scrubber.
+func (s *Scrubber) Quarantined() ([]QuarantinedChunk, error) {
+	return s.db.Quarantined()
+}
+
+// Close stops the scrubber.
+func (s *Scrubber) Close() error {
+	close(s.quit)
+	s.wg.Wait()
+	return nil
+}
+
+// quarantine removes a corrupt chunk from all indexes and records it in the
+// quarantine index, dropping the oldest records above capacity. It returns
+// the pin counter the chunk had.
+func (db *DB) quarantine(item shed.Item, reason string, capacity uint64) (pinCounter uint64, err error) {
+	db.batchMu.Lock()
+	defer db.batchMu.Unlock()
+	if db.gcRunning {
+		db.dirtyAddresses = append(db.dirtyAddresses, penguin.NewAddress(item.Address))
+	}
+
+	stored, err := db.retrievalDataIndex.Get(addressToItem(penguin.NewAddress(item.Address)))
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(stored.Location, item.Location) || stored.BinID != item.BinID {
+		return 0, errScrubChanged
+	}
+	pinned, err := db.pinIndex.Get(stored)
+	switch {
+	case err == nil:
+		pinCounter = pinned.PinCounter
+	case errors.Is(err, leveldb.ErrNotFound):
+	default:
+		return 0, err
+	}
+
+	batch := new(leveldb.Batch)
+	usage := make(usageChanges)
+	gcSizeChange, err := db.setRemove(batch, stored, true, usage)
+	if err != nil {
+		return 0, err
+	}
+	// setRemove does not touch the push index, the
+	// chunk must not be offered for push syncing
+	err = db.pushIndex.DeleteInBatch(batch, stored)
+	if err != nil {
+		return 0, err
+	}
+	err = db.putQuarantineInBatch(batch, shed.Item{
+		Address:         stored.Address,
+		AccessTimestamp: now(),
+		PinCounter:      pinCounter,
+		BatchID:         stored.BatchID,
+		Data:            []byte(reason),
+	}, capacity)
+	if err != nil {
+		return 0, err
+	}
+	err = db.incGCSizeInBatch(batch, gcSizeChange)
+	if err != nil {
+		return 0, err
+	}
+	err = db.incBatchUsageInBatch(batch, usage)
+	if err != nil {
+		return 0, err
+	}
+	err = db.shed.WriteBatch(batch)
+	if err != nil {
+		return 0, err
+	}
+
+	if loc, err := sharky.LocationFromBinary(stored.Location); err == nil {
+		db.releaseLocations(context.Background(), []sharky.Location{loc})
+	}
+	return pinCounter, nil
+}
+
+// putQuarantineInBatch records a quarantined chunk and drops the oldest
+// records while the quarantine holds more than capacity chunks.
+func (db *DB) putQuarantineInBatch(batch *leveldb.Batch, item shed.Item, capacity uint64) error {
+	size, err := db.quarantineSize.Get()
+	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+		return err
+	}
+
+	prev, err := db.quarantineIndex.Get(item)
+	switch {
+	case err == nil:
+		// quarantined again, only the latest record is kept
+		err = db.quarantineTimeIndex.DeleteInBatch(batch, prev)
+		if err != nil {
+			return err
+		}
+	case errors.Is(err, leveldb.ErrNotFound):
+		size++
+	default:
+		return err
+	}
+	err = db.quarantineIndex.PutInBatch(batch, item)
+	if err != nil {
+		return err
+	}
+	err = db.quarantineTimeIndex.PutInBatch(batch, item)
+	if err != nil {
+		return err
+	}
+
+	if size > capacity {
+		var evict []shed.Item
+		err = db.quarantineTimeIndex.Iterate(func(i shed.Item) (stop bool, err error) {
+			if bytes.Equal(i.Address, item.Address) {
+				return false, nil
+			}
+			evict = append(evict, i)
+			return uint64(len(evict)) == size-capacity, nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+		for _, i := range evict {
+			err = db.quarantineIndex.DeleteInBatch(batch, i)
+			if err != nil {
+				return err
+			}
+			err = db.quarantineTimeIndex.DeleteInBatch(batch, i)
+			if err != nil {
+				return err
+			}
+		}
+		size -= uint64(len(evict))
+	}
+	db.quarantineSize.PutInBatch(batch, size)
+	return nil
+}
+
+// restorePin sets the pin counter of a stored chunk back to the
+// counter it had before it was quarantined.
+func (db *DB) restorePin(addr penguin.Address, pinCounter uint64) error {
+	db.batchMu.Lock()
+	defer db.batchMu.Unlock()
+	if db.gcRunning {
+		db.dirtyAddresses = append(db.dirtyAddresses, addr)
+	}
+
+	item := addressToItem(addr)
+	i, err := db.pinIndex.Get(item)
+	switch {
+	case err == nil:
+		if i.PinCounter >= pinCounter {
+			return nil
+		}
+	case !errors.Is(err, leveldb.ErrNotFound):
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	usage := make(usageChanges)
+	// setPin takes the chunk out of the gc index if it was not pinned
+	gcSizeChange, err := db.setPin(batch, item, usage)
+	if err != nil {
+		return err
+	}
+	item.PinCounter = pinCounter
+	err = db.pinIndex.PutInBatch(batch, item)
+	if err != nil {
+		return err
+	}
+	err = db.incGCSizeInBatch(batch, gcSizeChange)
+	if err != nil {
+		return err
+	}
+	err = db.incBatchUsageInBatch(batch, usage)
+	if err != nil {
+		return err
+	}
+	return db.shed.WriteBatch(batch)
+}
+
+// Quarantined returns the chunks removed by the scrubber.
+func (db *DB) Quarantined() (chunks []QuarantinedChunk, err error) {
+	err = db.quarantineIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		restored, err := db.retrievalDataIndex.Has(item)
+		if err != nil {
+			return true, err
+		}
+		chunks = append(chunks, QuarantinedChunk{
+			Address:     penguin.NewAddress(item.Address),
+			BatchID:     item.BatchID,
+			Reason:      string(item.Data),
+			PinCounter:  item.PinCounter,
+			Quarantined: time.Unix(0, item.AccessTimestamp),
+			Restored:    restored,
+		})
+		return false, nil
+	}, nil)
+	return chunks, err
+}
@@ -0,0 +1,261 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/postage"
+	"github.com/penguintop/penguin/pkg/storage"
+)
+
+type retrieverFunc func(ctx context.Context, addr penguin.Address) (penguin.Chunk, error)
+
+func (f retrieverFunc) RetrieveChunk(ctx context.Context, addr penguin.Address) (penguin.Chunk, error) {
+	return f(ctx, addr)
+}
+
+func newTestScrubber(db *DB, validStamp func(penguin.Chunk, []byte) (penguin.Chunk, error), retriever Retriever) *Scrubber {
+	return NewScrubber(db, validStamp, retriever, ScrubberOptions{Rate: 1e6}, logging.New(ioutil.Discard, 0))
+}
+
+// corruptPayload replaces the stored payload of the chunk with garbage.
+func corruptPayload(t *testing.T, db *DB, addr penguin.Address) {
+	t.Helper()
+
+	item, err := db.retrievalDataIndex.Get(addressToItem(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, err := db.payloads.Write(context.Background(), []byte("garbage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.Location, err = loc.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.retrievalDataIndex.Put(item); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScrubber(t *testing.T) {
+	db := newTestDB(t, nil)
+	ctx := context.Background()
+
+	// generateTestRandomChunks does not produce valid chunks
+	chunks := make([]penguin.Chunk, 10)
+	for i := range chunks {
+		chunks[i] = generateTestRandomChunk()
+	}
+	if _, err := db.Put(ctx, storage.ModePutUpload, chunks...); err != nil {
+		t.Fatal(err)
+	}
+	corruptPayload(t, db, chunks[0].Address())
+	corruptPayload(t, db, chunks[1].Address())
+
+	s := newTestScrubber(db, nil, nil)
+	if err := s.Scrub(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	status := s.Status()
+	if status.Passes != 1 || status.Checked != 10 || status.InvalidChunks != 2 {
+		t.Fatalf("got status %+v, want 1 pass, 10 checked and 2 invalid chunks", status)
+	}
+	for i, ch := range chunks {
+		has, err := db.Has(ctx, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != (i >= 2) {
+			t.Fatalf("chunk %d: got has %v, want %v", i, has, i >= 2)
+		}
+	}
+	newItemsCountTest(db.pushIndex, 8)(t)
+	newItemsCountTest(db.pullIndex, 8)(t)
+
+	quarantined, err := db.Quarantined()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 2 {
+		t.Fatalf("got %d quarantined chunks, want 2", len(quarantined))
+	}
+	for _, q := range quarantined {
+		if !q.Address.Equal(chunks[0].Address()) && !q.Address.Equal(chunks[1].Address()) {
+			t.Fatalf("unexpected quarantined chunk %s", q.Address)
+		}
+		if q.Reason != ScrubReasonInvalidChunk {
+			t.Fatalf("got reason %q, want %q", q.Reason, ScrubReasonInvalidChunk)
+		}
+		if q.Restored {
+			t.Fatal("quarantined chunk restored")
+		}
+	}
+}
+
+func TestScrubberStamps(t *testing.T) {
+	db := newTestDB(t, nil)
+	ctx := context.Background()
+
+	synced := generateTestRandomChunk()
+	cached := generateTestRandomChunk()
+	unknown := generateTestRandomChunk()
+	if _, err := db.Put(ctx, storage.ModePutUpload, synced, unknown); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put(ctx, storage.ModePutRequestCache, cached); err != nil {
+		t.Fatal(err)
+	}
+
+	validStamp := func(ch penguin.Chunk, _ []byte) (penguin.Chunk, error) {
+		if ch.Address().Equal(unknown.Address()) {
+			return nil, fmt.Errorf("batch: %w", postage.ErrNotFound)
+		}
+		return nil, errors.New("invalid signature")
+	}
+	s := newTestScrubber(db, validStamp, nil)
+	if err := s.Scrub(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	status := s.Status()
+	if status.InvalidStamps != 1 || status.UnknownBatch != 1 {
+		t.Fatalf("got status %+v, want 1 invalid stamp and 1 unknown batch", status)
+	}
+	for _, tc := range []struct {
+		ch   penguin.Chunk
+		want bool
+	}{
+		{ch: synced, want: false},
+		{ch: cached, want: true},
+		{ch: unknown, want: true},
+	} {
+		has, err := db.Has(ctx, tc.ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != tc.want {
+			t.Fatalf("chunk %s: got has %v, want %v", tc.ch.Address(), has, tc.want)
+		}
+	}
+}
+
+func TestScrubberRefetchPinned(t *testing.T) {
+	db := newTestDB(t, nil)
+	ctx := context.Background()
+
+	ch := generateTestRandomChunk()
+	if _, err := db.Put(ctx, storage.ModePutUpload, ch); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := db.Set(ctx, storage.ModeSetPin, ch.Address()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	corruptPayload(t, db, ch.Address())
+
+	var retrieved int
+	retriever := retrieverFunc(func(_ context.Context, addr penguin.Address) (penguin.Chunk, error) {
+		retrieved++
+		if !addr.Equal(ch.Address()) {
+			return nil, storage.ErrNotFound
+		}
+		return ch, nil
+	})
+	s := newTestScrubber(db, nil, retriever)
+	if err := s.Scrub(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if retrieved != 1 {
+		t.Fatalf("got %d retrievals, want 1", retrieved)
+	}
+	if status := s.Status(); status.Refetched != 1 || status.RefetchFailed != 0 {
+		t.Fatalf("got status %+v, want 1 refetched", status)
+	}
+	got, err := db.Get(ctx, storage.ModeGetLookup, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(ch) {
+		t.Fatalf("got chunk %s, want %s", got.Address(), ch.Address())
+	}
+	pinCounter, err := db.pinCounter(ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinCounter != 2 {
+		t.Fatalf("got pin counter %d, want 2", pinCounter)
+	}
+	newIndexGCSizeTest(db)(t)
+
+	quarantined, err := db.Quarantined()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 1 || !quarantined[0].Restored || quarantined[0].PinCounter != 2 {
+		t.Fatalf("got quarantined chunks %+v, want one restored with pin counter 2", quarantined)
+	}
+}
+
+func TestScrubberQuarantineCapacity(t *testing.T) {
+	db := newTestDB(t, nil)
+	ctx := context.Background()
+
+	chunks := make([]penguin.Chunk, 5)
+	for i := range chunks {
+		chunks[i] = generateTestRandomChunk()
+	}
+	if _, err := db.Put(ctx, storage.ModePutUpload, chunks...); err != nil {
+		t.Fatal(err)
+	}
+
+	defer setNow(func() int64 { return 0 })()
+	s := NewScrubber(db, nil, nil, ScrubberOptions{Rate: 1e6, QuarantineCapacity: 3}, logging.New(ioutil.Discard, 0))
+	for i, ch := range chunks {
+		i := int64(i)
+		defer setNow(func() int64 { return i + 1 })()
+
+		corruptPayload(t, db, ch.Address())
+		item, err := db.retrievalDataIndex.Get(addressToItem(ch.Address()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.check(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	quarantined, err := db.Quarantined()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 3 {
+		t.Fatalf("got %d quarantined chunks, want 3", len(quarantined))
+	}
+	for _, q := range quarantined {
+		if q.Address.Equal(chunks[0].Address()) || q.Address.Equal(chunks[1].Address()) {
+			t.Fatalf("oldest quarantined chunk %s kept", q.Address)
+		}
+	}
+	newItemsCountTest(db.quarantineTimeIndex, 3)(t)
+	size, err := db.quarantineSize.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 3 {
+		t.Fatalf("got quarantine size %d, want 3", size)
+	}
+}
@@ -75,6 +75,10 @@ func (db *DB) SubscribePush(ctx context.Context) (c <-chan penguin.Chunk, stop f
 					if err != nil {
 						return true, err
 					}
+					err = db.readData(ctx, &dataItem)
+					if err != nil {
+						return true, err
+					}
 
 					stamp := postage.NewStamp(dataItem.BatchID, dataItem.Sig)
 					select {
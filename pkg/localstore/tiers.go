@@ -0,0 +1,445 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/sharky"
+	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+var (
+	// balanceInterval is the time between two runs moving payloads
+	// to the payload store of their storage tier.
+	balanceInterval = 10 * time.Minute
+	// balanceBatchSize limits the number of payloads moved
+	// in a single run.
+	balanceBatchSize = 1000
+)
+
+// tier is a storage tier of the localstore. Every tier has its own
+// capacity and may keep its payloads in a directory of its own.
+type tier int
+
+const (
+	tierCache   tier = iota // chunks in the gc index
+	tierReserve             // pinned chunks within the radius of their batch
+	tierPins                // chunks pinned by users
+	tierCount
+)
+
+var tierNames = [tierCount]string{"cache", "reserve", "pins"}
+
+func (t tier) String() string {
+	return tierNames[t]
+}
+
+// tieredStore keeps the payloads of every storage tier in the payload
+// store of the tier. Store 0 is the default payload store in the
+// localstore directory which is shared by all tiers without a directory
+// of their own. The store of a payload is encoded in the shard of its
+// location, store i holds the shards starting at i*sharkyShardCount.
+type tieredStore struct {
+	stores [tierCount + 1]PayloadStore
+	tiers  [tierCount]int // store index of every tier
+}
+
+// Write stores the payload in the store of the cache tier.
+func (s *tieredStore) Write(ctx context.Context, data []byte) (sharky.Location, error) {
+	return s.write(ctx, tierCache, data)
+}
+
+func (s *tieredStore) write(ctx context.Context, t tier, data []byte) (sharky.Location, error) {
+	i := s.tiers[t]
+	loc, err := s.stores[i].Write(ctx, data)
+	if err != nil {
+		return sharky.Location{}, err
+	}
+	loc.Shard += uint8(i * sharkyShardCount)
+	return loc, nil
+}
+
+func (s *tieredStore) Read(ctx context.Context, loc sharky.Location, buf []byte) error {
+	store, loc, err := s.store(loc)
+	if err != nil {
+		return err
+	}
+	return store.Read(ctx, loc, buf)
+}
+
+func (s *tieredStore) Release(ctx context.Context, loc sharky.Location) error {
+	store, loc, err := s.store(loc)
+	if err != nil {
+		return err
+	}
+	return store.Release(ctx, loc)
+}
+
+func (s *tieredStore) Sync(ctx context.Context) error {
+	for _, store := range s.stores {
+		if store == nil {
+			continue
+		}
+		if err := store.Sync(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *tieredStore) Close() (err error) {
+	for _, store := range s.stores {
+		if store == nil {
+			continue
+		}
+		if e := store.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// store returns the payload store holding the location and the
+// location within that store.
+func (s *tieredStore) store(loc sharky.Location) (PayloadStore, sharky.Location, error) {
+	i := int(loc.Shard) / sharkyShardCount
+	if i >= len(s.stores) || s.stores[i] == nil {
+		return nil, loc, fmt.Errorf("%w: %+v", sharky.ErrInvalidLocation, loc)
+	}
+	loc.Shard %= sharkyShardCount
+	return s.stores[i], loc, nil
+}
+
+// inTier reports whether the location is in the payload store of the tier.
+func (s *tieredStore) inTier(loc sharky.Location, t tier) bool {
+	return int(loc.Shard)/sharkyShardCount == s.tiers[t]
+}
+
+// separate reports whether more than one payload store is in use.
+func (s *tieredStore) separate() bool {
+	for _, store := range s.stores[1:] {
+		if store != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// openPayloads opens the payload store configured in the options. Unless
+// a payload store is provided, every tier with a directory gets a payload
+// store of its own. The directories are recorded in the database, a tier
+// directory dropped from the options is still opened so that its payloads
+// can be moved to the default store.
+func (db *DB) openPayloads(path string, o *Options) (PayloadStore, error) {
+	if o.PayloadStore != nil {
+		return o.PayloadStore, nil
+	}
+	if path == "" {
+		return sharky.New("", sharkyShardCount, maxChunkDataSize)
+	}
+
+	var recorded [tierCount]string
+	v, err := db.payloadDirs.Get()
+	switch {
+	case err == nil && v != "":
+		if err := json.Unmarshal([]byte(v), &recorded); err != nil {
+			return nil, fmt.Errorf("payload directories: %w", err)
+		}
+	case err != nil && !errors.Is(err, leveldb.ErrNotFound):
+		return nil, err
+	}
+
+	dirs := [tierCount]string{o.CacheDir, o.ReserveDir, o.PinDir}
+	seen := map[string]tier{filepath.Clean(filepath.Join(path, sharkyDir)): -1}
+	for t := tier(0); t < tierCount; t++ {
+		if dirs[t] == "" {
+			continue
+		}
+		dirs[t] = filepath.Clean(dirs[t])
+		if recorded[t] != "" && recorded[t] != dirs[t] {
+			return nil, fmt.Errorf("%s payload directory changed from %s to %s", t, recorded[t], dirs[t])
+		}
+		if _, ok := seen[dirs[t]]; ok {
+			return nil, fmt.Errorf("%s payload directory %s is already in use", t, dirs[t])
+		}
+		seen[dirs[t]] = t
+	}
+
+	s := new(tieredStore)
+	s.stores[0], err = db.openSharky(filepath.Join(path, sharkyDir), 0)
+	if err != nil {
+		return nil, err
+	}
+	for t := tier(0); t < tierCount; t++ {
+		dir := dirs[t]
+		if dir == "" {
+			if recorded[t] == "" {
+				continue
+			}
+			db.logger.Infof("localstore: %s payload directory %s is no longer configured, moving its payloads", t, recorded[t])
+			dir = recorded[t]
+		} else {
+			s.tiers[t] = int(t) + 1
+		}
+		s.stores[t+1], err = db.openSharky(dir, int(t)+1)
+		if err != nil {
+			_ = s.Close()
+			return nil, fmt.Errorf("%s payload store: %w", t, err)
+		}
+		recorded[t] = dir
+	}
+
+	b, err := json.Marshal(recorded)
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	if err := db.payloadDirs.Put(string(b)); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	db.tiered = s
+	return s, nil
+}
+
+// writePayload stores the payload in the payload store of the tier.
+func (db *DB) writePayload(ctx context.Context, t tier, data []byte) (sharky.Location, error) {
+	if db.tiered != nil {
+		return db.tiered.write(ctx, t, data)
+	}
+	return db.payloads.Write(ctx, data)
+}
+
+// putTier returns the tier of a new chunk, following the decision
+// of preserveOrCache.
+func (db *DB) putTier(item shed.Item, forcePin, forceCache bool) (tier, error) {
+	if forceCache {
+		return tierCache, nil
+	}
+	t, err := db.pinnedTier(item)
+	if err != nil {
+		return 0, err
+	}
+	if t == tierReserve || forcePin {
+		return t, nil
+	}
+	return tierCache, nil
+}
+
+// pinnedTier returns the tier of a pinned chunk: the reserve if it is
+// within the radius of its batch and the pins otherwise.
+func (db *DB) pinnedTier(item shed.Item) (tier, error) {
+	r, err := db.postageRadiusIndex.Get(item)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return tierPins, nil
+		}
+		return 0, err
+	}
+	item.Radius = r.Radius
+	if withinRadiusFn(db, item) {
+		return tierReserve, nil
+	}
+	return tierPins, nil
+}
+
+// pinnedTierSizes returns the number of pinned chunks within the radius
+// of their batch and the number of the other pinned chunks.
+func (db *DB) pinnedTierSizes() (reserve, pins int, err error) {
+	err = db.pinIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		stored, err := db.retrievalDataIndex.Get(item)
+		if err != nil {
+			if errors.Is(err, leveldb.ErrNotFound) {
+				return false, nil
+			}
+			return true, err
+		}
+		t, err := db.pinnedTier(stored)
+		if err != nil {
+			return true, err
+		}
+		if t == tierReserve {
+			reserve++
+		} else {
+			pins++
+		}
+		return false, nil
+	}, nil)
+	return reserve, pins, err
+}
+
+// balanceTiersWorker is a long running function that moves payloads to
+// the payload store of their tier, periodically and when signalled on
+// the balanceTiersTrigger channel.
+func (db *DB) balanceTiersWorker() {
+	defer close(db.balanceTiersWorkerDone)
+
+	ticker := time.NewTicker(balanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.balanceTiersTrigger:
+		case <-ticker.C:
+		case <-db.close:
+			return
+		}
+		moved, done, err := db.balanceTiers()
+		if err != nil {
+			db.metrics.TierMoveErrors.Inc()
+			db.logger.Errorf("localstore: balance storage tiers: %v", err)
+		}
+		if !done {
+			db.triggerBalanceTiers()
+		}
+		if testHookBalanceTiers != nil {
+			testHookBalanceTiers(moved)
+		}
+	}
+}
+
+// triggerBalanceTiers signals balanceTiersWorker to run.
+func (db *DB) triggerBalanceTiers() {
+	select {
+	case db.balanceTiersTrigger <- struct{}{}:
+	case <-db.close:
+	default:
+	}
+}
+
+// tierMove is a payload found outside of the store of its tier.
+type tierMove struct {
+	address  []byte
+	location []byte
+	target   tier
+}
+
+// balanceTiers moves up to balanceBatchSize payloads of pinned and
+// cached chunks to the payload store of their tier. If done is false,
+// another run is needed to move the rest.
+func (db *DB) balanceTiers() (moved int, done bool, err error) {
+	var moves []tierMove
+	done = true
+	check := func(item shed.Item, pinned bool) (stop bool, err error) {
+		stored, err := db.retrievalDataIndex.Get(item)
+		if err != nil {
+			if errors.Is(err, leveldb.ErrNotFound) {
+				return false, nil
+			}
+			return true, err
+		}
+		t := tierCache
+		if pinned {
+			t, err = db.pinnedTier(stored)
+			if err != nil {
+				return true, err
+			}
+		}
+		loc, err := sharky.LocationFromBinary(stored.Location)
+		if err != nil {
+			return true, fmt.Errorf("chunk %x: %w", stored.Address, err)
+		}
+		if db.tiered.inTier(loc, t) {
+			return false, nil
+		}
+		moves = append(moves, tierMove{address: stored.Address, location: stored.Location, target: t})
+		if len(moves) >= balanceBatchSize {
+			done = false
+			return true, nil
+		}
+		return false, nil
+	}
+
+	err = db.pinIndex.Iterate(func(item shed.Item) (bool, error) {
+		return check(item, true)
+	}, nil)
+	if err == nil && done {
+		err = db.gcIndex.Iterate(func(item shed.Item) (bool, error) {
+			return check(item, false)
+		}, nil)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if len(moves) == 0 {
+		return 0, done, nil
+	}
+	moved, err = db.moveTiers(moves)
+	if err != nil {
+		return 0, false, err
+	}
+	return moved, done, nil
+}
+
+// moveTiers copies the payloads to the store of their target tier and
+// releases the old ones. Chunks removed or moved since they were found
+// are skipped.
+func (db *DB) moveTiers(moves []tierMove) (moved int, err error) {
+	ctx := context.Background()
+
+	db.batchMu.Lock()
+	defer db.batchMu.Unlock()
+
+	batch := new(leveldb.Batch)
+	payloads := db.newPayloadBatch(ctx)
+	defer func() {
+		if err != nil {
+			payloads.rollback()
+		}
+	}()
+
+	var released []sharky.Location
+	for _, m := range moves {
+		item, err := db.retrievalDataIndex.Get(shed.Item{Address: m.address})
+		if err != nil {
+			if errors.Is(err, leveldb.ErrNotFound) {
+				continue
+			}
+			return 0, err
+		}
+		if !bytes.Equal(item.Location, m.location) {
+			continue
+		}
+		loc, err := sharky.LocationFromBinary(item.Location)
+		if err != nil {
+			return 0, err
+		}
+		if err := db.readData(ctx, &item); err != nil {
+			// unreadable payloads are left to the scrubber
+			db.logger.Debugf("localstore: move to %s tier: %v", m.target, err)
+			continue
+		}
+		if err := payloads.write(&item, m.target); err != nil {
+			return 0, err
+		}
+		if err := db.retrievalDataIndex.PutInBatch(batch, item); err != nil {
+			return 0, err
+		}
+		released = append(released, loc)
+	}
+
+	if err := payloads.sync(); err != nil {
+		return 0, err
+	}
+	if err := db.shed.WriteBatch(batch); err != nil {
+		return 0, err
+	}
+	db.releaseLocations(ctx, released)
+	db.metrics.TierMoved.Add(float64(len(released)))
+	return len(released), nil
+}
+
+// testHookBalanceTiers is a hook that can provide information
+// when a storage tier balancing run is done and how many
+// payloads it moved.
+var testHookBalanceTiers func(moved int)
@@ -0,0 +1,187 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/sharky"
+	"github.com/penguintop/penguin/pkg/storage"
+)
+
+// checkTier fails the test if the payload of the chunk is not
+// in the payload store of the tier.
+func checkTier(t *testing.T, db *DB, addr penguin.Address, want tier) {
+	t.Helper()
+
+	item, err := db.retrievalDataIndex.Get(addressToItem(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, err := sharky.LocationFromBinary(item.Location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.tiered.inTier(loc, want) {
+		t.Fatalf("chunk %s: got payload store %d, want the %s store", addr, loc.Shard/sharkyShardCount, want)
+	}
+}
+
+func TestTierPayloadStores(t *testing.T) {
+	dir := testDir(t)
+	path := filepath.Join(dir, "localstore")
+	baseKey := make([]byte, 32)
+	logger := logging.New(ioutil.Discard, 0)
+	ctx := context.Background()
+
+	db, err := New(path, baseKey, &Options{
+		CacheDir:   filepath.Join(dir, "cache"),
+		ReserveDir: filepath.Join(dir, "reserve"),
+		PinDir:     filepath.Join(dir, "pins"),
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reserved := generateTestRandomChunk()
+	// radius 0 puts all chunks of the batch within the reserve
+	if err := db.UnreserveBatch(reserved.Stamp().BatchID(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put(ctx, storage.ModePutSync, reserved); err != nil {
+		t.Fatal(err)
+	}
+	pinned := generateTestRandomChunk()
+	if _, err := db.Put(ctx, storage.ModePutUploadPin, pinned); err != nil {
+		t.Fatal(err)
+	}
+	cached := generateTestRandomChunk()
+	if _, err := db.Put(ctx, storage.ModePutRequestCache, cached); err != nil {
+		t.Fatal(err)
+	}
+	checkTier(t, db, reserved.Address(), tierReserve)
+	checkTier(t, db, pinned.Address(), tierPins)
+	checkTier(t, db, cached.Address(), tierCache)
+
+	// unreserved and unpinned chunks move to the cache
+	if err := db.UnreserveBatch(reserved.Stamp().BatchID(), penguin.MaxPO+1); err != nil {
+		t.Fatal(err)
+	}
+	// syncing needs the radius of the batch, the chunk is outside of it
+	if err := db.UnreserveBatch(pinned.Stamp().BatchID(), penguin.MaxPO); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set(ctx, storage.ModeSetSync, pinned.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set(ctx, storage.ModeSetUnpin, pinned.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if _, done, err := db.balanceTiers(); err != nil || !done {
+		t.Fatalf("balance tiers: done %v, error %v", done, err)
+	}
+	for _, ch := range []penguin.Chunk{reserved, pinned, cached} {
+		checkTier(t, db, ch.Address(), tierCache)
+		got, err := db.Get(ctx, storage.ModeGetLookup, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(ch) {
+			t.Fatalf("got chunk %s, want %s", got.Address(), ch.Address())
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a tier directory can not be moved
+	if _, err := New(path, baseKey, &Options{CacheDir: filepath.Join(dir, "other")}, logger); err == nil {
+		t.Fatal("expected error opening with a changed cache directory")
+	}
+
+	// dropped tier directories are still read
+	db, err = New(path, baseKey, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Get(ctx, storage.ModeGetLookup, cached.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.balanceTiers(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(ctx, storage.ModeGetLookup, cached.Address()); err != nil {
+		t.Fatal(err)
+	}
+	checkTier(t, db, cached.Address(), tierCache)
+}
+
+func TestPinTierSize(t *testing.T) {
+	db := newTestDB(t, nil)
+	ctx := context.Background()
+
+	chunks := make([]penguin.Chunk, 3)
+	for i := range chunks {
+		chunks[i] = generateTestRandomChunk()
+	}
+	if _, err := db.Put(ctx, storage.ModePutUpload, chunks...); err != nil {
+		t.Fatal(err)
+	}
+	// chunks pinned more than once are counted once
+	for i := 0; i < 2; i++ {
+		if err := db.Set(ctx, storage.ModeSetPin, chunks[0].Address(), chunks[1].Address()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Set(ctx, storage.ModeSetUnpin, chunks[0].Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	indices, err := db.DebugIndices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indices["pinSize"] != 2 {
+		t.Fatalf("got pin size %d, want 2", indices["pinSize"])
+	}
+}
+
+func TestDebugIndicesTiers(t *testing.T) {
+	db := newTestDB(t, &Options{Capacity: 100, ReserveCapacity: 10})
+	ctx := context.Background()
+
+	reserved := generateTestRandomChunk()
+	if err := db.UnreserveBatch(reserved.Stamp().BatchID(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put(ctx, storage.ModePutSync, reserved); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put(ctx, storage.ModePutRequestCache, generateTestRandomChunk()); err != nil {
+		t.Fatal(err)
+	}
+
+	indices, err := db.DebugIndices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]int{
+		"cacheSize":       1,
+		"cacheCapacity":   100,
+		"reserveSize":     1,
+		"reserveCapacity": 10,
+		"pinSize":         0,
+	} {
+		if got := indices[k]; got != want {
+			t.Errorf("got %s %d, want %d", k, got, want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/penguintop/penguin/pkg/sharky"
+	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// BatchUsage is the local storage used by the chunks
+// stamped with a postage batch.
+type BatchUsage struct {
+	BatchID []byte
+	// Chunks is the number of stored chunks.
+	Chunks uint64
+	// Size is the number of bytes of the stored chunk data.
+	Size uint64
+	// Pinned is the number of stored chunks with a pin counter,
+	// which are not garbage collected. It includes the chunks
+	// pinned by the reserve.
+	Pinned uint64
+	// Reserve is the number of stored chunks held by the reserve,
+	// which are released when the batch radius grows or the
+	// batch expires.
+	Reserve uint64
+}
+
+const batchUsageSize = 32
+
+func encodeBatchUsage(u BatchUsage) []byte {
+	b := make([]byte, batchUsageSize)
+	binary.BigEndian.PutUint64(b[:8], u.Chunks)
+	binary.BigEndian.PutUint64(b[8:16], u.Size)
+	binary.BigEndian.PutUint64(b[16:24], u.Pinned)
+	binary.BigEndian.PutUint64(b[24:32], u.Reserve)
+	return b
+}
+
+func decodeBatchUsage(item shed.Item) BatchUsage {
+	u := BatchUsage{BatchID: item.BatchID}
+	if len(item.Data) < batchUsageSize {
+		return u
+	}
+	u.Chunks = binary.BigEndian.Uint64(item.Data[:8])
+	u.Size = binary.BigEndian.Uint64(item.Data[8:16])
+	u.Pinned = binary.BigEndian.Uint64(item.Data[16:24])
+	u.Reserve = binary.BigEndian.Uint64(item.Data[24:32])
+	return u
+}
+
+// BatchesUsage returns the local storage used by
+// every postage batch with stored chunks.
+func (db *DB) BatchesUsage() (usage []BatchUsage, err error) {
+	err = db.batchUsageIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		u := decodeBatchUsage(item)
+		// the iterator reuses the key buffer
+		u.BatchID = append([]byte(nil), item.BatchID...)
+		usage = append(usage, u)
+		return false, nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// usageChange is the change of the usage counters of a batch.
+type usageChange struct {
+	chunks, size, pinned, reserve int64
+}
+
+// usageChanges collects the usage changes made to batches while
+// the indexes are updated in a single leveldb batch, keyed by batch ID.
+type usageChanges map[string]*usageChange
+
+// batch returns the change of the batch with the provided ID,
+// or nil for chunks without a known batch.
+func (u usageChanges) batch(id []byte) *usageChange {
+	if len(id) == 0 {
+		return nil
+	}
+	c, ok := u[string(id)]
+	if !ok {
+		c = new(usageChange)
+		u[string(id)] = c
+	}
+	return c
+}
+
+// usageStored records a new chunk stored with the provided item.
+// Pins set before the chunk was stored are counted too.
+func (db *DB) usageStored(usage usageChanges, item shed.Item) error {
+	c := usage.batch(item.BatchID)
+	if c == nil {
+		return nil
+	}
+	c.chunks++
+	c.size += int64(len(item.Data))
+	pinned, err := db.pinIndex.Has(item)
+	if err != nil {
+		return err
+	}
+	if pinned {
+		c.pinned++
+	}
+	return nil
+}
+
+// usageRemoved records the removal of the stored chunk item,
+// pinned tells if the chunk had a pin counter.
+func (db *DB) usageRemoved(usage usageChanges, item shed.Item, pinned bool) error {
+	c := usage.batch(item.BatchID)
+	if c == nil {
+		return nil
+	}
+	loc, err := sharky.LocationFromBinary(item.Location)
+	if err != nil {
+		return err
+	}
+	c.chunks--
+	c.size -= int64(loc.Length)
+	if !pinned {
+		return nil
+	}
+	c.pinned--
+	i, err := db.postageRadiusIndex.Get(item)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	item.Radius = i.Radius
+	if withinRadiusFn(db, item) {
+		c.reserve--
+	}
+	return nil
+}
+
+// usagePinned records the change of the pinned counter of the
+// chunk item when its pin counter is set or removed. The batch
+// of a stored chunk is preferred to the one of the item.
+func (db *DB) usagePinned(usage usageChanges, item shed.Item, change int64) error {
+	i, err := db.retrievalDataIndex.Get(item)
+	switch {
+	case err == nil:
+		item.BatchID = i.BatchID
+	case errors.Is(err, leveldb.ErrNotFound):
+		// only count a chunk which is stored in the same batch
+		if len(item.Data) == 0 {
+			return nil
+		}
+	default:
+		return err
+	}
+	if c := usage.batch(item.BatchID); c != nil {
+		c.pinned += change
+	}
+	return nil
+}
+
+// incBatchUsageInBatch adds the collected usage changes to the
+// batch usage index. Counters do not drop below zero and batches
+// without stored chunks are removed from the index.
+func (db *DB) incBatchUsageInBatch(batch *leveldb.Batch, usage usageChanges) error {
+	for id, c := range usage {
+		item := shed.Item{BatchID: []byte(id)}
+		i, err := db.batchUsageIndex.Get(item)
+		if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+			return err
+		}
+		u := decodeBatchUsage(i)
+		u.Chunks = addUsage(u.Chunks, c.chunks)
+		u.Size = addUsage(u.Size, c.size)
+		u.Pinned = addUsage(u.Pinned, c.pinned)
+		u.Reserve = addUsage(u.Reserve, c.reserve)
+		if u.Chunks == 0 {
+			if err := db.batchUsageIndex.DeleteInBatch(batch, item); err != nil {
+				return err
+			}
+			continue
+		}
+		item.Data = encodeBatchUsage(u)
+		if err := db.batchUsageIndex.PutInBatch(batch, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addUsage(v uint64, change int64) uint64 {
+	if change >= 0 {
+		return v + uint64(change)
+	}
+	if c := uint64(-change); c < v {
+		return v - c
+	}
+	return 0
+}
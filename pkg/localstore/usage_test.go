@@ -0,0 +1,211 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/postage"
+	postagetesting "github.com/penguintop/penguin/pkg/postage/testing"
+	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/penguintop/penguin/pkg/storage"
+)
+
+// newTestBatchChunks returns count random chunks stamped with the same batch.
+func newTestBatchChunks(id []byte, count int) (chunks []penguin.Chunk, size uint64) {
+	for i := 0; i < count; i++ {
+		ch := generateTestRandomChunk().WithStamp(postage.NewStamp(id, postagetesting.MustNewSignature()))
+		chunks = append(chunks, ch)
+		size += uint64(len(ch.Data()))
+	}
+	return chunks, size
+}
+
+func checkBatchUsage(t *testing.T, db *DB, want ...BatchUsage) {
+	t.Helper()
+
+	got, err := db.BatchesUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got usage of %d batches, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i].BatchID, want[i].BatchID) {
+			t.Fatalf("got batch %x, want %x", got[i].BatchID, want[i].BatchID)
+		}
+		if got[i].Chunks != want[i].Chunks || got[i].Size != want[i].Size || got[i].Pinned != want[i].Pinned || got[i].Reserve != want[i].Reserve {
+			t.Fatalf("got usage %+v, want %+v", got[i], want[i])
+		}
+	}
+}
+
+func TestBatchUsage(t *testing.T) {
+	db := newTestDB(t, nil)
+	ctx := context.Background()
+
+	id := postagetesting.MustNewID()
+	if err := db.UnreserveBatch(id, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	reserved, reservedSize := newTestBatchChunks(id, 3)
+	if _, err := db.Put(ctx, storage.ModePutSync, reserved...); err != nil {
+		t.Fatal(err)
+	}
+	cached, cachedSize := newTestBatchChunks(id, 2)
+	if _, err := db.Put(ctx, storage.ModePutRequestCache, cached...); err != nil {
+		t.Fatal(err)
+	}
+	checkBatchUsage(t, db, BatchUsage{BatchID: id, Chunks: 5, Size: reservedSize + cachedSize, Pinned: 3, Reserve: 3})
+
+	uploaded, uploadedSize := newTestBatchChunks(id, 1)
+	if _, err := db.Put(ctx, storage.ModePutUpload, uploaded...); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set(ctx, storage.ModeSetPin, uploaded[0].Address()); err != nil {
+		t.Fatal(err)
+	}
+	size := reservedSize + cachedSize + uploadedSize
+	checkBatchUsage(t, db, BatchUsage{BatchID: id, Chunks: 6, Size: size, Pinned: 4, Reserve: 3})
+
+	if err := db.Set(ctx, storage.ModeSetUnpin, uploaded[0].Address()); err != nil {
+		t.Fatal(err)
+	}
+	checkBatchUsage(t, db, BatchUsage{BatchID: id, Chunks: 6, Size: size, Pinned: 3, Reserve: 3})
+
+	// the batch expires
+	if err := db.UnreserveBatch(id, penguin.MaxPO+1); err != nil {
+		t.Fatal(err)
+	}
+	checkBatchUsage(t, db, BatchUsage{BatchID: id, Chunks: 6, Size: size, Pinned: 0, Reserve: 0})
+
+	if err := db.Set(ctx, storage.ModeSetRemove, uploaded[0].Address()); err != nil {
+		t.Fatal(err)
+	}
+	checkBatchUsage(t, db, BatchUsage{BatchID: id, Chunks: 5, Size: reservedSize + cachedSize})
+
+	for _, ch := range append(reserved, cached...) {
+		if err := db.Set(ctx, storage.ModeSetRemove, ch.Address()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkBatchUsage(t, db)
+}
+
+func TestBatchUsageRemovePinned(t *testing.T) {
+	db := newTestDB(t, nil)
+	ctx := context.Background()
+
+	id := postagetesting.MustNewID()
+	if err := db.UnreserveBatch(id, 0); err != nil {
+		t.Fatal(err)
+	}
+	chunks, size := newTestBatchChunks(id, 2)
+	if _, err := db.Put(ctx, storage.ModePutUploadPin, chunks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put(ctx, storage.ModePutSync, chunks[1]); err != nil {
+		t.Fatal(err)
+	}
+	checkBatchUsage(t, db, BatchUsage{BatchID: id, Chunks: 2, Size: size, Pinned: 2, Reserve: 1})
+
+	if err := db.Set(ctx, storage.ModeSetRemove, chunks[1].Address()); err != nil {
+		t.Fatal(err)
+	}
+	checkBatchUsage(t, db, BatchUsage{BatchID: id, Chunks: 1, Size: uint64(len(chunks[0].Data())), Pinned: 1})
+}
+
+func TestBatchUsageGC(t *testing.T) {
+	db := newTestDB(t, &Options{Capacity: 10})
+	ctx := context.Background()
+
+	id := postagetesting.MustNewID()
+	chunks, _ := newTestBatchChunks(id, 20)
+	if _, err := db.Put(ctx, storage.ModePutRequestCache, chunks...); err != nil {
+		t.Fatal(err)
+	}
+
+	target := db.gcTarget()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		gcSize, err := db.gcSize.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gcSize <= target {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got gc size %d, want at most %d", gcSize, target)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var size uint64
+	for _, ch := range chunks {
+		has, err := db.Has(ctx, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has {
+			size += uint64(len(ch.Data()))
+		}
+	}
+	gcSize, err := db.gcSize.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBatchUsage(t, db, BatchUsage{BatchID: id, Chunks: gcSize, Size: size})
+}
+
+func TestBatchUsageMigration(t *testing.T) {
+	dir := testDir(t)
+	baseKey := make([]byte, 32)
+	db := newTestDBAt(t, dir, baseKey)
+	ctx := context.Background()
+
+	id := postagetesting.MustNewID()
+	if err := db.UnreserveBatch(id, 0); err != nil {
+		t.Fatal(err)
+	}
+	reserved, reservedSize := newTestBatchChunks(id, 3)
+	if _, err := db.Put(ctx, storage.ModePutSync, reserved...); err != nil {
+		t.Fatal(err)
+	}
+	cached, cachedSize := newTestBatchChunks(id, 2)
+	if _, err := db.Put(ctx, storage.ModePutRequestCache, cached...); err != nil {
+		t.Fatal(err)
+	}
+	want := BatchUsage{BatchID: id, Chunks: 5, Size: reservedSize + cachedSize, Pinned: 3, Reserve: 3}
+	checkBatchUsage(t, db, want)
+
+	// drop the index as a database of the previous schema
+	usage, err := db.BatchesUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range usage {
+		if err := db.batchUsageIndex.Delete(shed.Item{BatchID: u.BatchID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.schemaName.Put(DbSchemaSharky); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = newTestDBAt(t, dir, baseKey)
+	defer db.Close()
+
+	checkBatchUsage(t, db, want)
+}
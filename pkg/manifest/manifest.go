@@ -9,6 +9,8 @@ package manifest
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/penguintop/penguin/pkg/file"
     "github.com/penguintop/penguin/pkg/penguin"
@@ -22,6 +24,7 @@ const (
 	WebsiteErrorDocumentPathKey   = "website-error-document"
 	EntryMetadataContentTypeKey   = "Content-Type"
 	EntryMetadataFilenameKey      = "Filename"
+	EntryMetadataSizeKey          = "Size"
 )
 
 var (
@@ -41,6 +44,15 @@ var (
 // the Store function.
 type StoreSizeFunc func(int64) error
 
+// EntryIterFunc is a callback on every entry of the manifest that references
+// content, together with the path it is stored on.
+type EntryIterFunc func(path string, entry Entry) error
+
+// DirectoryIterFunc is a callback on every immediate child of a directory,
+// together with its name relative to the directory. Subdirectories have
+// names ending with the separator and a nil entry.
+type DirectoryIterFunc func(name string, entry Entry) error
+
 // Interface for operations with manifest.
 type Interface interface {
 	// Type returns manifest implementation type information
@@ -58,6 +70,13 @@ type Interface interface {
 	// IterateAddresses is used to iterate over chunks addresses for
 	// the manifest.
 	IterateAddresses(context.Context, penguin.AddressIterFunc) error
+	// IterateEntries is used to iterate over the entries of the manifest
+	// below the path prefix that reference content, in path order. Only
+	// the part of the manifest below the prefix is loaded.
+	IterateEntries(ctx context.Context, prefix string, fn EntryIterFunc) error
+	// IterateDirectory is used to iterate over the immediate children of
+	// the directory path, in name order. Subdirectories are not loaded.
+	IterateDirectory(ctx context.Context, dir string, fn DirectoryIterFunc) error
 }
 
 // Entry represents a single manifest entry.
@@ -68,6 +87,89 @@ type Entry interface {
 	Metadata() map[string]string
 }
 
+// Copy adds the entry on the source path to the destination path. If the
+// source path ends with a path separator, all entries below it are copied
+// below the destination path.
+func Copy(ctx context.Context, m Interface, src, dst string) error {
+	_, err := copyEntries(ctx, m, src, dst)
+	return err
+}
+
+// Move moves the entry on the source path to the destination path. If the
+// source path ends with a path separator, all entries below it are moved
+// below the destination path.
+func Move(ctx context.Context, m Interface, src, dst string) error {
+	if src == dst {
+		return nil
+	}
+	copied, err := copyEntries(ctx, m, src, dst)
+	if err != nil {
+		return err
+	}
+	destinations := make(map[string]struct{}, len(copied))
+	for _, p := range copied {
+		destinations[p] = struct{}{}
+	}
+	for p := range copied {
+		if _, ok := destinations[p]; ok {
+			// the source path was overwritten by another copied entry
+			continue
+		}
+		if err := m.Remove(ctx, p); err != nil {
+			return fmt.Errorf("remove %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// copyEntries copies the entries from the source to the destination path
+// and returns the mapping of all copied source paths to their destinations.
+func copyEntries(ctx context.Context, m Interface, src, dst string) (map[string]string, error) {
+	if src == "" || dst == "" {
+		return nil, ErrNotFound
+	}
+
+	if !strings.HasSuffix(src, "/") {
+		e, err := m.Lookup(ctx, src)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Add(ctx, dst, e); err != nil {
+			return nil, fmt.Errorf("add %q: %w", dst, err)
+		}
+		return map[string]string{src: dst}, nil
+	}
+
+	if !strings.HasSuffix(dst, "/") {
+		dst += "/"
+	}
+	type pathEntry struct {
+		path  string
+		entry Entry
+	}
+	var entries []pathEntry
+	err := m.IterateEntries(ctx, src, func(path string, entry Entry) error {
+		entries = append(entries, pathEntry{path: path, entry: entry})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+
+	copied := make(map[string]string, len(entries))
+	for _, e := range entries {
+		p := dst + strings.TrimPrefix(e.path, src)
+		if err := m.Add(ctx, p, e.entry); err != nil {
+			return nil, fmt.Errorf("add %q: %w", p, err)
+		}
+		copied[e.path] = p
+	}
+	return copied, nil
+}
+
 // NewDefaultManifest creates a new manifest with default type.
 func NewDefaultManifest(
 	ls file.LoadSaver,
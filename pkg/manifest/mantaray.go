@@ -5,6 +5,7 @@
 package manifest
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -179,6 +180,58 @@ func (m *mantarayManifest) IterateAddresses(ctx context.Context, fn penguin.Addr
 	return nil
 }
 
+func (m *mantarayManifest) IterateEntries(ctx context.Context, prefix string, fn EntryIterFunc) error {
+	walker := func(path []byte, node *mantaray.Node, err error) error {
+		if err != nil {
+			if errors.Is(err, mantaray.ErrNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if node == nil || !node.IsValueType() || len(node.Entry()) == 0 {
+			return nil
+		}
+
+		// entries without content, like the root metadata, are skipped
+		if bytes.Equal(node.Entry(), make([]byte, len(node.Entry()))) {
+			return nil
+		}
+
+		return fn(string(path), NewEntry(penguin.NewAddress(node.Entry()), node.Metadata()))
+	}
+
+	err := m.trie.WalkPrefix(ctx, []byte(prefix), m.ls, walker)
+	if err != nil {
+		return fmt.Errorf("manifest iterate entries: %w", err)
+	}
+
+	return nil
+}
+
+func (m *mantarayManifest) IterateDirectory(ctx context.Context, dir string, fn DirectoryIterFunc) error {
+	err := m.trie.List(ctx, []byte(dir), m.ls, func(name []byte, node *mantaray.Node) error {
+		if node == nil {
+			return fn(string(name), nil)
+		}
+
+		// entries without content, like the root metadata, are skipped
+		if len(node.Entry()) == 0 || bytes.Equal(node.Entry(), make([]byte, len(node.Entry()))) {
+			return nil
+		}
+
+		return fn(string(name), NewEntry(penguin.NewAddress(node.Entry()), node.Metadata()))
+	})
+	if err != nil {
+		if errors.Is(err, mantaray.ErrNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("manifest iterate directory: %w", err)
+	}
+
+	return nil
+}
+
 type mantarayLoadSaver struct {
 	ls          file.LoadSaver
 	storeSizeFn []StoreSizeFunc
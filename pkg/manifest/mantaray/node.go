@@ -9,6 +9,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 )
 
 const (
@@ -109,8 +110,7 @@ func (n *Node) makeWithMetadata() {
 	n.nodeType = n.nodeType | nodeTypeWithMetadata
 }
 
-//nolint,unused
-func (n *Node) makeNotValue() { // skipcq: SCC-U1000
+func (n *Node) makeNotValue() {
 	n.nodeType = (nodeTypeMask ^ nodeTypeValue) & n.nodeType
 }
 
@@ -123,8 +123,7 @@ func (n *Node) makeNotWithPathSeparator() {
 	n.nodeType = (nodeTypeMask ^ nodeTypeWithPathSeparator) & n.nodeType
 }
 
-//nolint,unused
-func (n *Node) makeNotWithMetadata() { // skipcq: SCC-U1000
+func (n *Node) makeNotWithMetadata() {
 	n.nodeType = (nodeTypeMask ^ nodeTypeWithMetadata) & n.nodeType
 }
 
@@ -175,6 +174,55 @@ func (n *Node) LookupNode(ctx context.Context, path []byte, l Loader) (*Node, er
 	return nil, notFound(path)
 }
 
+// lookupPrefix finds the node with the shortest path that starts with the
+// prefix and returns it with its path, or returns error if not found.
+func (n *Node) lookupPrefix(ctx context.Context, prefix []byte, l Loader) (*Node, []byte, error) {
+	var path []byte
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		default:
+		}
+		if n.forks == nil {
+			if err := n.load(ctx, l); err != nil {
+				return nil, nil, err
+			}
+		}
+		if len(prefix) == 0 {
+			return n, path, nil
+		}
+		f := n.forks[prefix[0]]
+		if f == nil {
+			return nil, nil, notFound(prefix)
+		}
+		c := common(f.prefix, prefix)
+		switch {
+		case len(c) == len(f.prefix):
+			prefix = prefix[len(c):]
+		case len(c) == len(prefix):
+			// the prefix ends inside of the fork
+			prefix = nil
+		default:
+			return nil, nil, notFound(prefix)
+		}
+		path = append(path, f.prefix...)
+		n = f.Node
+	}
+}
+
+// forkKeys returns the first bytes of the fork prefixes in ascending order.
+func (n *Node) forkKeys() []byte {
+	keys := make([]byte, 0, len(n.forks))
+	for k := range n.forks {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
 // Lookup finds the entry for a path or returns error if not found
 func (n *Node) Lookup(ctx context.Context, path []byte, l Loader) ([]byte, error) {
 	node, err := n.LookupNode(ctx, path, l)
@@ -191,6 +239,11 @@ func (n *Node) Add(ctx context.Context, path, entry []byte, metadata map[string]
 		return ctx.Err()
 	default:
 	}
+	if n.forks == nil {
+		if err := n.load(ctx, ls); err != nil {
+			return err
+		}
+	}
 	if n.refBytesSize == 0 {
 		if len(entry) > 256 {
 			return fmt.Errorf("node entry size > 256: %d", len(entry))
@@ -212,12 +265,8 @@ func (n *Node) Add(ctx context.Context, path, entry []byte, metadata map[string]
 		n.ref = nil
 		return nil
 	}
-	if n.forks == nil {
-		if err := n.load(ctx, ls); err != nil {
-			return err
-		}
-		n.ref = nil
-	}
+	// the node changes, it has to be persisted again
+	n.ref = nil
 	f := n.forks[path[0]]
 	if f == nil {
 		nn := New()
@@ -313,10 +362,34 @@ func (n *Node) Remove(ctx context.Context, path []byte, ls LoadSaver) error {
 	rest := path[len(f.prefix):]
 	if len(rest) == 0 {
 		// full path matched
-		delete(n.forks, path[0])
+		if f.Node.forks == nil {
+			if err := f.Node.load(ctx, ls); err != nil {
+				return err
+			}
+		}
+		if len(f.Node.forks) > 0 {
+			// keep the entries that share the removed path as a prefix
+			f.Node.entry = nil
+			f.Node.metadata = nil
+			f.Node.makeNotValue()
+			f.Node.makeNotWithMetadata()
+			f.Node.ref = nil
+		} else {
+			delete(n.forks, path[0])
+		}
+		n.ref = nil
 		return nil
 	}
-	return f.Node.Remove(ctx, rest, ls)
+	if err := f.Node.Remove(ctx, rest, ls); err != nil {
+		return err
+	}
+	if len(f.Node.forks) == 0 && !f.Node.IsValueType() {
+		// prune the branch left without entries
+		delete(n.forks, path[0])
+	}
+	// the node changes, it has to be persisted again
+	n.ref = nil
+	return nil
 }
 
 func common(a, b []byte) (c []byte) {
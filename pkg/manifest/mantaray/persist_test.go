@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"errors"
 	"sync"
 	"testing"
 
@@ -60,6 +61,104 @@ func TestPersistIdempotence(t *testing.T) {
 	}
 }
 
+// TestPersistUpdate tests that changes to a loaded trie persist only the
+// nodes on the changed paths and result in a new root reference.
+func TestPersistUpdate(t *testing.T) {
+	ctx := context.Background()
+	ls := newMockLoadSaver()
+
+	n := mantaray.New()
+	for _, p := range []string{"index.html", "img/1.png", "img/2.png", "img/2.png.bak", "css/style.css"} {
+		var v [32]byte
+		copy(v[:], p)
+		if err := n.Add(ctx, []byte(p), v[:], nil, ls); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := n.Save(ctx, ls); err != nil {
+		t.Fatal(err)
+	}
+	root := n.Reference()
+
+	for _, tc := range []struct {
+		name   string
+		update func(n *mantaray.Node) error
+		found  []string
+		gone   []string
+	}{
+		{
+			name: "add",
+			update: func(n *mantaray.Node) error {
+				var v [32]byte
+				copy(v[:], "img/3.png")
+				return n.Add(ctx, []byte("img/3.png"), v[:], nil, ls)
+			},
+			found: []string{"index.html", "img/1.png", "img/2.png", "img/3.png", "css/style.css"},
+		},
+		{
+			name: "remove",
+			update: func(n *mantaray.Node) error {
+				return n.Remove(ctx, []byte("index.html"), ls)
+			},
+			found: []string{"img/1.png", "img/2.png", "css/style.css"},
+			gone:  []string{"index.html"},
+		},
+		{
+			name: "remove prefix of other path",
+			update: func(n *mantaray.Node) error {
+				return n.Remove(ctx, []byte("img/2.png"), ls)
+			},
+			found: []string{"img/1.png", "img/2.png.bak"},
+			gone:  []string{"img/2.png"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n := mantaray.NewNodeRef(root)
+			// load the trie before the update
+			if _, err := n.Lookup(ctx, []byte("img/1.png"), ls); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.update(n); err != nil {
+				t.Fatal(err)
+			}
+
+			before := len(ls.store)
+			if err := n.Save(ctx, ls); err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(n.Reference(), root) {
+				t.Fatal("root reference not changed")
+			}
+			// only the nodes on the changed path are stored, not the whole trie
+			if saved := len(ls.store) - before; saved > 4 {
+				t.Fatalf("got %d new nodes, want at most 4", saved)
+			}
+
+			n = mantaray.NewNodeRef(n.Reference())
+			for _, p := range tc.found {
+				var v [32]byte
+				copy(v[:], p)
+				m, err := n.Lookup(ctx, []byte(p), ls)
+				if err != nil {
+					t.Fatalf("lookup %q: %v", p, err)
+				}
+				if !bytes.Equal(m, v[:]) {
+					t.Fatalf("lookup %q: got %x, want %x", p, m, v[:])
+				}
+			}
+			for _, p := range tc.gone {
+				node, err := n.LookupNode(ctx, []byte(p), ls)
+				if err == nil && node.IsValueType() {
+					t.Fatalf("lookup %q: found removed entry", p)
+				}
+				if err != nil && !errors.Is(err, mantaray.ErrNotFound) {
+					t.Fatalf("lookup %q: got error %v, want %v", p, err, mantaray.ErrNotFound)
+				}
+			}
+		})
+	}
+}
+
 type addr [32]byte
 type mockLoadSaver struct {
 	mtx   sync.Mutex
@@ -4,7 +4,10 @@
 
 package mantaray
 
-import "context"
+import (
+	"bytes"
+	"context"
+)
 
 // WalkNodeFunc is the type of the function called for each node visited
 // by WalkNode.
@@ -115,3 +118,99 @@ func (n *Node) Walk(ctx context.Context, root []byte, l Loader, walkFn WalkFunc)
 	}
 	return walk(ctx, root, []byte{}, l, node, walkFn)
 }
+
+// walkNodeSorted recursively descends path like walkNode,
+// visiting the forks in the order of their prefixes.
+func walkNodeSorted(ctx context.Context, path []byte, l Loader, n *Node, walkFn WalkNodeFunc) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	if n.forks == nil {
+		if err := n.load(ctx, l); err != nil {
+			return err
+		}
+	}
+
+	err := walkNodeFnCopyBytes(ctx, path, n, nil, walkFn)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range n.forkKeys() {
+		v := n.forks[k]
+		nextPath := append(path[:0:0], path...)
+		nextPath = append(nextPath, v.prefix...)
+
+		err := walkNodeSorted(ctx, nextPath, l, v.Node, walkFn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WalkPrefix walks the nodes with paths starting with prefix in the
+// lexicographic order of their paths, calling walkFn for each of them.
+// Unlike WalkNode, the prefix does not have to end on a node and only the
+// nodes on the way to the prefix and below it are loaded. All errors that
+// arise visiting nodes are filtered by walkFn.
+func (n *Node) WalkPrefix(ctx context.Context, prefix []byte, l Loader, walkFn WalkNodeFunc) error {
+	node, path, err := n.lookupPrefix(ctx, prefix, l)
+	if err != nil {
+		return walkFn(prefix, nil, err)
+	}
+	return walkNodeSorted(ctx, path, l, node, walkFn)
+}
+
+// ListFunc is the type of the function called for each child listed by List.
+// The node is nil for directories, they are listed only by name.
+type ListFunc func(name []byte, node *Node) error
+
+// List calls listFn for the immediate children of the directory path dir,
+// which has to be empty or end with the separator, in the lexicographic
+// order of their names. Value nodes are listed as files and names that
+// continue below a separator as directories, with the separator included.
+// Directories are not descended into, so their nodes are not loaded.
+func (n *Node) List(ctx context.Context, dir []byte, l Loader, listFn ListFunc) error {
+	node, path, err := n.lookupPrefix(ctx, dir, l)
+	if err != nil {
+		return err
+	}
+	return list(ctx, path[len(dir):], l, node, listFn)
+}
+
+func list(ctx context.Context, name []byte, l Loader, n *Node, listFn ListFunc) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if i := bytes.IndexByte(name, PathSeparator); i >= 0 {
+		return listFn(name[:i+1], nil)
+	}
+	if n.forks == nil {
+		if err := n.load(ctx, l); err != nil {
+			return err
+		}
+	}
+	if len(name) > 0 && n.IsValueType() {
+		if err := listFn(name, n); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range n.forkKeys() {
+		v := n.forks[k]
+		nextName := append(name[:0:0], name...)
+		nextName = append(nextName, v.prefix...)
+
+		if err := list(ctx, nextName, l, v.Node, listFn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
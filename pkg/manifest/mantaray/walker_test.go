@@ -7,6 +7,7 @@ package mantaray
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -157,3 +158,138 @@ func TestWalk(t *testing.T) {
 		})
 	}
 }
+
+func TestWalkPrefix(t *testing.T) {
+	ctx := context.Background()
+	n := New()
+	for _, c := range []string{
+		"robots.txt",
+		"index.html",
+		"img/2.png",
+		"img/1.png",
+		"img.png",
+		"docs/nested/file.txt",
+	} {
+		e := append(make([]byte, 32-len(c)), c...)
+		if err := n.Add(ctx, []byte(c), e, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		prefix string
+		want   []string
+	}{
+		{
+			prefix: "",
+			want:   []string{"docs/nested/file.txt", "img.png", "img/1.png", "img/2.png", "index.html", "robots.txt"},
+		},
+		{
+			prefix: "img/",
+			want:   []string{"img/1.png", "img/2.png"},
+		},
+		{
+			// ends inside of a fork prefix
+			prefix: "docs/",
+			want:   []string{"docs/nested/file.txt"},
+		},
+		{
+			prefix: "i",
+			want:   []string{"img.png", "img/1.png", "img/2.png", "index.html"},
+		},
+	} {
+		t.Run(tc.prefix, func(t *testing.T) {
+			var got []string
+			err := n.WalkPrefix(ctx, []byte(tc.prefix), nil, func(path []byte, node *Node, err error) error {
+				if err != nil {
+					return err
+				}
+				if node.IsValueType() {
+					got = append(got, string(path))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("got paths %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	err := n.WalkPrefix(ctx, []byte("missing/"), nil, func(path []byte, node *Node, err error) error {
+		return err
+	})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	n := New()
+	for _, c := range []string{
+		"robots.txt",
+		"index.html",
+		"img/2.png",
+		"img/1.png",
+		"img.png",
+		"docs/nested/file.txt",
+		"docs/readme.md",
+	} {
+		e := append(make([]byte, 32-len(c)), c...)
+		if err := n.Add(ctx, []byte(c), e, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		dir  string
+		want []string
+	}{
+		{
+			dir:  "",
+			want: []string{"docs/", "img.png", "img/", "index.html", "robots.txt"},
+		},
+		{
+			dir:  "img/",
+			want: []string{"1.png", "2.png"},
+		},
+		{
+			dir:  "docs/",
+			want: []string{"nested/", "readme.md"},
+		},
+		{
+			// ends inside of a fork prefix
+			dir:  "docs/nested/",
+			want: []string{"file.txt"},
+		},
+	} {
+		t.Run(tc.dir, func(t *testing.T) {
+			var got []string
+			err := n.List(ctx, []byte(tc.dir), nil, func(name []byte, node *Node) error {
+				if (node == nil) != bytes.HasSuffix(name, []byte{PathSeparator}) {
+					t.Errorf("got node %v for %q", node, name)
+				}
+				got = append(got, string(name))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("got names %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		err := n.List(ctx, []byte("missing/"), nil, func([]byte, *Node) error {
+			return nil
+		})
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got error %v, want %v", err, ErrNotFound)
+		}
+	})
+}
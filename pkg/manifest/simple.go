@@ -8,6 +8,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/penguintop/penguin/pkg/file"
 	"github.com/penguintop/penguin/pkg/manifest/simple"
@@ -144,6 +146,92 @@ func (m *simpleManifest) IterateAddresses(ctx context.Context, fn penguin.Addres
 	return nil
 }
 
+func (m *simpleManifest) IterateEntries(ctx context.Context, prefix string, fn EntryIterFunc) error {
+	type pathEntry struct {
+		path  string
+		entry Entry
+	}
+	var entries []pathEntry
+	walker := func(path string, entry simple.Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(path, prefix) {
+			return nil
+		}
+
+		ref, err := penguin.ParseHexAddress(entry.Reference())
+		if err != nil {
+			return err
+		}
+		if ref.IsZero() {
+			return nil
+		}
+
+		entries = append(entries, pathEntry{path: path, entry: NewEntry(ref, entry.Metadata())})
+		return nil
+	}
+
+	err := m.manifest.WalkEntry("", walker)
+	if err != nil {
+		return fmt.Errorf("manifest iterate entries: %w", err)
+	}
+	if len(entries) == 0 && prefix != "" {
+		return ErrNotFound
+	}
+
+	// the entries are all in memory, they are only sorted
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].path < entries[j].path
+	})
+	for _, e := range entries {
+		if err := fn(e.path, e.entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *simpleManifest) IterateDirectory(ctx context.Context, dir string, fn DirectoryIterFunc) error {
+	type dirEntry struct {
+		name  string
+		entry Entry
+	}
+	var (
+		entries []dirEntry
+		dirs    = make(map[string]struct{})
+	)
+	err := m.IterateEntries(ctx, dir, func(p string, e Entry) error {
+		name := p[len(dir):]
+		if name == "" {
+			return nil
+		}
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[:i+1]
+			if _, ok := dirs[name]; ok {
+				return nil
+			}
+			dirs[name] = struct{}{}
+			e = nil
+		}
+		entries = append(entries, dirEntry{name: name, entry: e})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	for _, e := range entries {
+		if err := fn(e.name, e.entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *simpleManifest) load(ctx context.Context, reference penguin.Address) error {
 	buf, err := m.ls.Load(ctx, reference.Bytes())
 	if err != nil {
@@ -46,6 +46,10 @@ func (s *store) Get(ctx context.Context, mode storage.ModeGet, addr penguin.Addr
 	ch, err = s.Storer.Get(ctx, mode, addr)
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
+			if sctx.GetCacheOnly(ctx) {
+				// the request is restricted to the local store
+				return nil, err
+			}
 			// request from network
 			ch, err = s.retrieval.RetrieveChunk(ctx, addr)
 			if err != nil {
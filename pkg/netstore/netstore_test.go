@@ -72,6 +72,21 @@ func TestNetstoreRetrieval(t *testing.T) {
 
 }
 
+// TestNetstoreCacheOnly verifies that a chunk is not requested from the network
+// if the request is restricted to the local store.
+func TestNetstoreCacheOnly(t *testing.T) {
+	retrieve, _, nstore := newRetrievingNetstore(nil, noopValidStamp)
+	addr := penguin.MustParseHexAddress("000001")
+	ctx := sctx.SetCacheOnly(context.Background())
+	_, err := nstore.Get(ctx, storage.ModeGetRequest, addr)
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+	if retrieve.called {
+		t.Fatal("retrieve request issued")
+	}
+}
+
 // TestNetstoreNoRetrieval verifies that a chunk is not requested from the network
 // whenever it is found locally.
 func TestNetstoreNoRetrieval(t *testing.T) {
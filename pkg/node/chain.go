@@ -25,6 +25,7 @@ import (
 	"github.com/penguintop/penguin/pkg/settlement"
 	"github.com/penguintop/penguin/pkg/settlement/swap"
 	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
+	"github.com/penguintop/penguin/pkg/settlement/swap/priceoracle"
 	"github.com/penguintop/penguin/pkg/settlement/swap/swapprotocol"
 	"github.com/penguintop/penguin/pkg/storage"
 	"github.com/penguintop/penguin/pkg/transaction"
@@ -167,8 +168,9 @@ func InitChequebookService(
 	chequebookFactory chequebook.Factory,
 	initialDeposit string,
 	deployGasPrice string,
+	delegatedChequebook string,
 ) (chequebook.Service, error) {
-	chequeSigner := chequebook.NewChequeSigner(signer, chainID)
+	chequeSigner := chequebook.NewChequeSigner(signer, property.Domain())
 
 	deposit, ok := new(big.Int).SetString(initialDeposit, 10)
 	if !ok {
@@ -189,6 +191,30 @@ func InitChequebookService(
 		return nil, fmt.Errorf("chequebook insure offline caller exist: %w", err)
 	}
 
+	// issue delegated cheques of a multi-issuer chequebook instead of
+	// deploying a chequebook of our own
+	if delegatedChequebook != "" {
+		chequebookHex, err := xwcfmt.XwcConAddrToHexAddr(delegatedChequebook)
+		if err != nil {
+			return nil, fmt.Errorf("delegated chequebook \"%s\" cannot be parsed: %w", delegatedChequebook, err)
+		}
+		chequebookService, err := chequebook.InitDelegated(
+			ctx,
+			chequebookFactory,
+			stateStore,
+			logger,
+			transactionService,
+			backend,
+			common.HexToAddress(chequebookHex),
+			overlayXwcAddress,
+			chequeSigner,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("delegated chequebook init: %w", err)
+		}
+		return chequebookService, nil
+	}
+
 	// modify to transfer to factory address
 	chequebookService, err := chequebook.Init(
 		ctx,
@@ -213,17 +239,15 @@ func initChequeStoreCashout(
 	stateStore storage.StateStorer,
 	swapBackend transaction.Backend,
 	chequebookFactory chequebook.Factory,
-	chainID int64,
 	overlayEthAddress common.Address,
 	transactionService transaction.Service,
 ) (chequebook.ChequeStore, chequebook.CashoutService) {
 	chequeStore := chequebook.NewChequeStore(
 		stateStore,
 		chequebookFactory,
-		chainID,
+		property.Domain(),
 		overlayEthAddress,
 		transactionService,
-		//TODO
 		chequebook.RecoverCheque,
 	)
 
@@ -237,6 +261,23 @@ func initChequeStoreCashout(
 	return chequeStore, cashout
 }
 
+// InitPriceOracle will initialize the price oracle of the exchange rate and
+// deduction negotiated in the swap handshake. Without an oracle contract the
+// rate is 1 and there is no deduction, which are also the rates used until
+// the oracle contract answers.
+func InitPriceOracle(logger logging.Logger, swapBackend transaction.Backend, priceOracleAddress string) (priceoracle.Service, error) {
+	if priceOracleAddress == "" {
+		return priceoracle.NewStatic(big.NewInt(1), big.NewInt(0)), nil
+	}
+
+	addrHex, err := xwcfmt.XwcConAddrToHexAddr(priceOracleAddress)
+	if err != nil {
+		return nil, fmt.Errorf("price oracle address: %w", err)
+	}
+
+	return priceoracle.New(logger, swapBackend, common.HexToAddress(addrHex), priceOracleUpdateInterval, big.NewInt(1), big.NewInt(0)), nil
+}
+
 // InitSwap will initialize and register the swap service.
 func InitSwap(
 	p2ps *libp2p.Service,
@@ -248,8 +289,9 @@ func InitSwap(
 	chequeStore chequebook.ChequeStore,
 	cashoutService chequebook.CashoutService,
 	accounting settlement.Accounting,
+	priceOracle priceoracle.Service,
 ) (*swap.Service, error) {
-	swapProtocol := swapprotocol.New(p2ps, logger, overlayEthAddress)
+	swapProtocol := swapprotocol.New(p2ps, logger, overlayEthAddress, priceOracle)
 	swapAddressBook := swap.NewAddressbook(stateStore)
 
 	swapService := swap.New(
@@ -266,6 +308,7 @@ func InitSwap(
 	)
 
 	swapProtocol.SetSwap(swapService)
+	priceOracle.SetRatesChangedFunc(swapProtocol.Renegotiate)
 
 	err := p2ps.AddProtocol(swapProtocol.Protocol())
 	if err != nil {
@@ -31,9 +31,11 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/penguintop/penguin/pkg/accesscontrol"
 	"github.com/penguintop/penguin/pkg/accounting"
 	"github.com/penguintop/penguin/pkg/addressbook"
 	"github.com/penguintop/penguin/pkg/api"
+	"github.com/penguintop/penguin/pkg/budget"
 	"github.com/penguintop/penguin/pkg/crypto"
 	"github.com/penguintop/penguin/pkg/debugapi"
 	"github.com/penguintop/penguin/pkg/feeds/factory"
@@ -46,6 +48,7 @@ import (
 	"github.com/penguintop/penguin/pkg/p2p/libp2p"
 	"github.com/penguintop/penguin/pkg/pingpong"
 	"github.com/penguintop/penguin/pkg/pinning"
+	"github.com/penguintop/penguin/pkg/pinning/remote"
 	"github.com/penguintop/penguin/pkg/postage"
 	"github.com/penguintop/penguin/pkg/postage/batchservice"
 	"github.com/penguintop/penguin/pkg/postage/batchstore"
@@ -65,7 +68,9 @@ import (
 	"github.com/penguintop/penguin/pkg/settlement/pseudosettle"
 	"github.com/penguintop/penguin/pkg/settlement/swap"
 	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
+	"github.com/penguintop/penguin/pkg/settlement/swap/erc20"
 	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/penguintop/penguin/pkg/statestore"
 	"github.com/penguintop/penguin/pkg/steward"
 	"github.com/penguintop/penguin/pkg/storage"
     "github.com/penguintop/penguin/pkg/penguin"
@@ -76,6 +81,7 @@ import (
 	"github.com/penguintop/penguin/pkg/tracing"
 	"github.com/penguintop/penguin/pkg/transaction"
 	"github.com/penguintop/penguin/pkg/traversal"
+	"github.com/penguintop/penguin/pkg/wallet"
 	"github.com/hashicorp/go-multierror"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/sirupsen/logrus"
@@ -94,6 +100,7 @@ type Pen struct {
 	tracerCloser             io.Closer
 	tagsCloser               io.Closer
 	stateStoreCloser         io.Closer
+	metricsDBCloser          io.Closer
 	localstoreCloser         io.Closer
 	topologyCloser           io.Closer
 	topologyHalter           topology.Halter
@@ -106,15 +113,33 @@ type Pen struct {
 	recoveryHandleCleanup    func()
 	listenerCloser           io.Closer
 	postageServiceCloser     io.Closer
+	autoCashoutCloser        io.Closer
+	solvencyMonitorCloser    io.Closer
+	pricerCloser             io.Closer
+	ledgerCloser             io.Closer
+	priceOracleCloser        io.Closer
+	scrubberCloser           io.Closer
+	remotePinningCloser      io.Closer
+	walletCloser             io.Closer
 }
 
 type Options struct {
 	DataDir                    string
+	StateStoreBackend          string
 	CacheCapacity              uint64
+	CacheEviction              string
+	ReserveCapacity            uint64
+	PinQuota                   uint64
+	CacheDir                   string
+	ReserveDir                 string
+	PinDir                     string
 	DBOpenFilesLimit           uint64
 	DBWriteBufferSize          uint64
 	DBBlockCacheCapacity       uint64
 	DBDisableSeeksCompaction   bool
+	DBScrubRate                float64
+	DBScrubInterval            time.Duration
+	DBQuarantineCapacity       uint64
 	APIAddr                    string
 	DebugAPIAddr               string
 	Addr                       string
@@ -130,9 +155,16 @@ type Options struct {
 	TracingEndpoint            string
 	TracingServiceName         string
 	GlobalPinningEnabled       bool
+	RemotePinningEnabled       bool
+	RemotePinningOwners        []string
+	RemotePinningQuota         int
+	RemotePinningEndpoints     []string
 	PaymentThreshold           string
 	PaymentTolerance           string
 	PaymentEarly               string
+	RefreshRate                string
+	LightRefreshRate           string
+	TimeSettlementLimit        string
 	ResolverConnectionCfgs     []multiresolver.ConnectionConfig
 	GatewayMode                bool
 	BootnodeMode               bool
@@ -140,7 +172,20 @@ type Options struct {
 	SwapFactoryAddress         string
 	SwapLegacyFactoryAddresses []string
 	SwapInitialDeposit         string
+	SwapDelegatedChequebook    string
+	SwapPriceOracleAddress     string
 	SwapEnable                 bool
+	SwapAutoCashoutThreshold   string
+	SwapAutoCashoutFee         string
+	SwapSolvencyThreshold      string
+	SwapSolvencyDisconnect     bool
+	DynamicPricing             bool
+	AccountingLedger           bool
+	AccountingLedgerRetention  time.Duration
+	BudgetWindow               time.Duration
+	BudgetSoftLimit            string
+	BudgetHardLimit            string
+	BudgetRequireKey           bool
 	FullNodeMode               bool
 	Transaction                string
 	PostageContractAddress     string
@@ -154,8 +199,20 @@ type Options struct {
 }
 
 const (
-	refreshRate = int64(1000000000000)
-	basePrice   = 10
+	basePrice = 10
+
+	solvencyInterval = 10 * time.Minute
+
+	dynamicPricingInterval       = time.Minute
+	dynamicPricingCapacity       = 100
+	dynamicPricingDemandCapacity = 6000
+	// smaller than the price tolerance, so that the peers agree on the
+	// prices between the announcements
+	dynamicPricingAnnounceChange = 0.05
+
+	ledgerPruneInterval = time.Hour
+
+	priceOracleUpdateInterval = 5 * time.Minute
 )
 
 func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicKey, signer crypto.Signer, networkID uint64, logger logging.Logger, libp2pPrivateKey, pssPrivateKey *ecdsa.PrivateKey, o Options) (b *Pen, err error) {
@@ -217,7 +274,7 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 		b.debugAPIServer = debugAPIServer
 	}
 
-	stateStore, err := InitStateStore(logger, o.DataDir)
+	stateStore, err := InitStateStore(logger, o.DataDir, o.StateStoreBackend)
 	if err != nil {
 		return nil, err
 	}
@@ -287,6 +344,7 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 			chequebookFactory,
 			o.SwapInitialDeposit,
 			o.DeployGasPrice,
+			o.SwapDelegatedChequebook,
 		)
 		if err != nil {
 			return nil, err
@@ -296,12 +354,29 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 			stateStore,
 			swapBackend,
 			chequebookFactory,
-			chainID,
 			overlayXwcAddress,
 			transactionService,
 		)
 	}
 
+	var walletService *wallet.Service
+	if !o.Standalone {
+		// the pen token is looked up from the chequebook factory on first use
+		var tokenFunc wallet.TokenFunc
+		if chequebookFactory != nil {
+			tokenFunc = func(ctx context.Context) (erc20.Service, common.Address, error) {
+				erc20Address, err := chequebookFactory.ERC20Address(ctx)
+				if err != nil {
+					return nil, common.Address{}, fmt.Errorf("erc20 address: %w", err)
+				}
+				return erc20.New(swapBackend, transactionService, erc20Address), erc20Address, nil
+			}
+		}
+		walletService = wallet.New(swapBackend, transactionService, tokenFunc, overlayXwcAddress, stateStore, logger)
+		walletService.Start(wallet.DefaultSyncInterval)
+		b.walletCloser = walletService
+	}
+
 	lightNodes := lightnode.NewContainer(penguinAddress)
 
 	txHash, err := getTxHash(stateStore, logger, o)
@@ -334,8 +409,17 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 		logger.Infof("using datadir in: '%s'", o.DataDir)
 		path = filepath.Join(o.DataDir, "localstore")
 	}
+	eviction, err := localstore.NewEvictionPolicy(o.CacheEviction, o.CacheCapacity)
+	if err != nil {
+		return nil, fmt.Errorf("localstore: %w", err)
+	}
 	lo := &localstore.Options{
 		Capacity:               o.CacheCapacity,
+		EvictionPolicy:         eviction,
+		ReserveCapacity:        o.ReserveCapacity,
+		CacheDir:               o.CacheDir,
+		ReserveDir:             o.ReserveDir,
+		PinDir:                 o.PinDir,
 		OpenFilesLimit:         o.DBOpenFilesLimit,
 		BlockCacheCapacity:     o.DBBlockCacheCapacity,
 		WriteBufferSize:        o.DBWriteBufferSize,
@@ -348,7 +432,7 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 	}
 	b.localstoreCloser = storer
 
-	batchStore, err := batchstore.New(stateStore, storer.UnreserveBatch)
+	batchStore, err := batchstore.New(stateStore, storer.UnreserveBatch, int64(o.ReserveCapacity))
 	if err != nil {
 		return nil, fmt.Errorf("batchstore: %w", err)
 	}
@@ -516,7 +600,20 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 
 	var swapService *swap.Service
 
-	metricsDB, err := shed.NewDBWrap(stateStore.DB())
+	var metricsDB *shed.DB
+	if ldb := stateStore.DB(); ldb != nil {
+		metricsDB, err = shed.NewDBWrap(ldb)
+	} else {
+		// the statestore backend is not leveldb, keep the metrics separately
+		var path string
+		if o.DataDir != "" {
+			path = statestore.MetricsPath(o.DataDir)
+		}
+		metricsDB, err = shed.NewDB(path, nil)
+		if err == nil {
+			b.metricsDBCloser = metricsDB
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("unable to create metrics storage for kademlia: %w", err)
 	}
@@ -548,9 +645,9 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 		return nil, fmt.Errorf("invalid payment threshold: %s", paymentThreshold)
 	}
 
-	pricer := pricer.NewFixedPricer(penguinAddress, basePrice)
+	fixedPricer := pricer.NewFixedPricer(penguinAddress, basePrice)
 
-	minThreshold := pricer.MostExpensive()
+	minThreshold := fixedPricer.MostExpensive()
 
 	pricing := pricing.New(p2ps, logger, paymentThreshold, minThreshold)
 
@@ -558,6 +655,27 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 		return nil, fmt.Errorf("pricing service: %w", err)
 	}
 
+	var chunkPricer interface {
+		pricer.Interface
+		PriceTable() []uint64
+		NotifyPriceTable(peer penguin.Address, priceTable []uint64) error
+	} = fixedPricer
+	if o.DynamicPricing {
+		dynamicPricer := pricer.NewDynamicPricer(penguinAddress, basePrice, logger, pricing, pricer.DynamicOptions{
+			Interval:       dynamicPricingInterval,
+			Tolerance:      pricer.DefaultTolerance,
+			MaxFactor:      pricer.DefaultMaxFactor,
+			Capacity:       dynamicPricingCapacity,
+			DemandCapacity: dynamicPricingDemandCapacity,
+			AnnounceChange: dynamicPricingAnnounceChange,
+		})
+		dynamicPricer.Start()
+		b.pricerCloser = dynamicPricer
+		chunkPricer = dynamicPricer
+	}
+	pricing.SetPriceTableSource(chunkPricer)
+	pricing.SetPriceTableObserver(chunkPricer)
+
 	addrs, err := p2ps.Addresses()
 	if err != nil {
 		return nil, fmt.Errorf("get server addresses: %w", err)
@@ -576,6 +694,24 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 		return nil, fmt.Errorf("invalid payment early: %s", paymentEarly)
 	}
 
+	refreshRate, ok := new(big.Int).SetString(o.RefreshRate, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid refresh rate: %s", o.RefreshRate)
+	}
+	lightRefreshRate, ok := new(big.Int).SetString(o.LightRefreshRate, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid light refresh rate: %s", o.LightRefreshRate)
+	}
+	timeSettlementLimit, ok := new(big.Int).SetString(o.TimeSettlementLimit, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid time settlement limit: %s", o.TimeSettlementLimit)
+	}
+	// our peers grant us the refresh rate of our node mode
+	ownRefreshRate := refreshRate
+	if !o.FullNodeMode {
+		ownRefreshRate = lightRefreshRate
+	}
+
 	acc, err := accounting.NewAccounting(
 		paymentThreshold,
 		paymentTolerance,
@@ -583,13 +719,39 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 		logger,
 		stateStore,
 		pricing,
-		big.NewInt(refreshRate),
+		ownRefreshRate,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("accounting: %w", err)
 	}
+	if err := acc.SetTimeSettlementLimit(timeSettlementLimit); err != nil {
+		return nil, fmt.Errorf("time settlement limit: %w", err)
+	}
+
+	var ledger *accounting.Ledger
+	if o.AccountingLedger {
+		ledger = accounting.NewLedger(stateStore, logger)
+		acc.SetLedger(ledger)
+		ledger.Start(ledgerPruneInterval, o.AccountingLedgerRetention)
+		b.ledgerCloser = ledger
+	}
 
-	pseudosettleService := pseudosettle.New(p2ps, logger, stateStore, acc, big.NewInt(refreshRate), p2ps)
+	budgetSoftLimit, ok := new(big.Int).SetString(o.BudgetSoftLimit, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid budget soft limit: %s", o.BudgetSoftLimit)
+	}
+	budgetHardLimit, ok := new(big.Int).SetString(o.BudgetHardLimit, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid budget hard limit: %s", o.BudgetHardLimit)
+	}
+	budgets, err := budget.New(stateStore, logger, o.BudgetWindow, budget.Limits{Soft: budgetSoftLimit, Hard: budgetHardLimit}, o.BudgetRequireKey)
+	if err != nil {
+		return nil, fmt.Errorf("budget: %w", err)
+	}
+	// the chunks retrieved and pushed are paid from the spending budgets
+	budgetAcc := budgets.Accounting(acc)
+
+	pseudosettleService := pseudosettle.New(p2ps, logger, stateStore, acc, refreshRate, lightRefreshRate, o.FullNodeMode, p2ps)
 	if err = p2ps.AddProtocol(pseudosettleService.Protocol()); err != nil {
 		return nil, fmt.Errorf("pseudosettle service: %w", err)
 	}
@@ -597,6 +759,13 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 	acc.SetRefreshFunc(pseudosettleService.Pay)
 
 	if o.SwapEnable {
+		priceOracle, err := InitPriceOracle(logger, swapBackend, o.SwapPriceOracleAddress)
+		if err != nil {
+			return nil, err
+		}
+		priceOracle.Start()
+		b.priceOracleCloser = priceOracle
+
 		swapService, err = InitSwap(
 			p2ps,
 			logger,
@@ -607,19 +776,72 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 			chequeStore,
 			cashoutService,
 			acc,
+			priceOracle,
 		)
 		if err != nil {
 			return nil, err
 		}
 		acc.SetPayFunc(swapService.Pay)
+
+		autoCashoutThreshold, ok := new(big.Int).SetString(o.SwapAutoCashoutThreshold, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid auto cashout threshold: %s", o.SwapAutoCashoutThreshold)
+		}
+		autoCashoutFee, ok := new(big.Int).SetString(o.SwapAutoCashoutFee, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid auto cashout fee: %s", o.SwapAutoCashoutFee)
+		}
+		if autoCashoutThreshold.Sign() > 0 {
+			autoCashout := chequebook.NewAutoCashout(logger, stateStore, chequeStore, cashoutService, transactionService, chequebookService.Address(), chequebook.AutoCashoutOptions{
+				Interval:       chequebook.DefaultAutoCashoutInterval,
+				Threshold:      autoCashoutThreshold,
+				TransactionFee: autoCashoutFee,
+				FeeMultiplier:  chequebook.DefaultAutoCashoutFeeMultiplier,
+				MaxCashouts:    chequebook.DefaultAutoCashoutMaxCashouts,
+				RetryBackoff:   chequebook.DefaultAutoCashoutRetryBackoff,
+			})
+			autoCashout.Start()
+			b.autoCashoutCloser = autoCashout
+		}
+
+		swapService.SetSolvencyChecker(chequebook.NewSolvencyChecker(chequeStore, transactionService, overlayXwcAddress))
+
+		solvencyThreshold, ok := new(big.Int).SetString(o.SwapSolvencyThreshold, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid solvency payment threshold: %s", o.SwapSolvencyThreshold)
+		}
+		if solvencyThreshold.Sign() > 0 || o.SwapSolvencyDisconnect {
+			solvencyOptions := swap.SolvencyOptions{
+				Interval:         solvencyInterval,
+				PaymentThreshold: paymentThreshold,
+				Disconnect:       o.SwapSolvencyDisconnect,
+			}
+			if solvencyThreshold.Sign() > 0 {
+				solvencyOptions.InsolventPaymentThreshold = solvencyThreshold
+			}
+			solvencyMonitor := swap.NewSolvencyMonitor(logger, swapService, pricing, acc, p2ps, solvencyOptions)
+			solvencyMonitor.Start()
+			b.solvencyMonitorCloser = solvencyMonitor
+		}
 	}
 
 	pricing.SetPaymentThresholdObserver(acc)
 
-	retrieve := retrieval.New(penguinAddress, storer, p2ps, kad, logger, acc, pricer, tracer)
+	retrieve := retrieval.New(penguinAddress, storer, p2ps, kad, logger, budgetAcc, chunkPricer, tracer)
 	tagService := tags.NewTags(stateStore, logger)
 	b.tagsCloser = tagService
 
+	var scrubber *localstore.Scrubber
+	if o.DBScrubRate > 0 {
+		scrubber = localstore.NewScrubber(storer, validStamp, retrieve, localstore.ScrubberOptions{
+			Rate:               o.DBScrubRate,
+			Interval:           o.DBScrubInterval,
+			QuarantineCapacity: o.DBQuarantineCapacity,
+		}, logger)
+		scrubber.Start()
+		b.scrubberCloser = scrubber
+	}
+
 	pssService := pss.New(pssPrivateKey, logger)
 	b.pssCloser = pssService
 
@@ -634,9 +856,9 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 
 	traversalService := traversal.New(ns)
 
-	pinningService := pinning.NewService(storer, stateStore, traversalService)
+	pinningService := pinning.NewService(storer, stateStore, traversalService, ns, o.PinQuota)
 
-	pushSyncProtocol := pushsync.New(penguinAddress, p2ps, storer, kad, tagService, o.FullNodeMode, pssService.TryUnwrap, validStamp, logger, acc, pricer, signer, tracer)
+	pushSyncProtocol := pushsync.New(penguinAddress, p2ps, storer, kad, tagService, o.FullNodeMode, pssService.TryUnwrap, validStamp, logger, budgetAcc, chunkPricer, signer, tracer)
 
 	// set the pushSyncer in the PSS
 	pssService.SetPushSyncer(pushSyncProtocol)
@@ -647,6 +869,37 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 		b.recoveryHandleCleanup = pssService.Register(recovery.Topic, chunkRepairHandler)
 	}
 
+	var remotePinning *remote.Service
+	if o.RemotePinningEnabled {
+		owners := make([]common.Address, 0, len(o.RemotePinningOwners))
+		for _, owner := range o.RemotePinningOwners {
+			if !common.IsHexAddress(owner) {
+				return nil, fmt.Errorf("invalid remote pinning owner %q", owner)
+			}
+			owners = append(owners, common.HexToAddress(owner))
+		}
+		remotePinning, err = remote.New(pinningService, stateStore, logger, remote.Options{
+			Overlay: penguinAddress,
+			Owners:  owners,
+			Quota:   o.RemotePinningQuota,
+			Delegates: func() []string {
+				addrs, err := p2ps.Addresses()
+				if err != nil {
+					return nil
+				}
+				delegates := make([]string, 0, len(addrs))
+				for _, addr := range addrs {
+					delegates = append(delegates, addr.String())
+				}
+				return delegates
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("remote pinning: %w", err)
+		}
+		b.remotePinningCloser = remotePinning
+	}
+
 	pusherService := pusher.New(networkID, storer, kad, pushSyncProtocol, tagService, logger, tracer)
 	b.pusherCloser = pusherService
 
@@ -695,10 +948,13 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 		// API server
 		feedFactory := factory.New(ns)
 		steward := steward.New(storer, traversalService, pushSyncProtocol)
-		apiService = api.New(tagService, ns, multiResolver, pssService, traversalService, pinningService, feedFactory, post, postageContractService, steward, signer, logger, tracer, api.Options{
+		accessControl := accesscontrol.New(pssPrivateKey)
+		apiService = api.New(tagService, ns, multiResolver, pssService, traversalService, pinningService, feedFactory, post, postageContractService, steward, accessControl, budgets, remotePinning, signer, logger, tracer, api.Options{
 			CORSAllowedOrigins: o.CORSAllowedOrigins,
 			GatewayMode:        o.GatewayMode,
 			WsPingPeriod:       60 * time.Second,
+
+			RemotePinningEndpoints: o.RemotePinningEndpoints,
 		})
 		apiListener, err := net.Listen("tcp", o.APIAddr)
 		if err != nil {
@@ -770,7 +1026,7 @@ func NewPen(addr string, penguinAddress penguin.Address, publicKey ecdsa.PublicK
 		}
 
 		// inject dependencies and configure full debug api http path routes
-		debugAPIService.Configure(p2ps, pingPong, kad, lightNodes, storer, tagService, acc, pseudosettleService, o.SwapEnable, swapService, chequebookService, batchStore)
+		debugAPIService.Configure(p2ps, pingPong, kad, lightNodes, storer, tagService, acc, ledger, budgets, pseudosettleService, o.SwapEnable, swapService, chequebookService, walletService, batchStore, scrubber, storer)
 	}
 
 	if err := kad.Start(p2pCtx); err != nil {
@@ -854,6 +1110,14 @@ func (b *Pen) Shutdown(ctx context.Context) error {
 	wg.Wait()
 
 	tryClose(b.p2pService, "p2p server")
+	tryClose(b.autoCashoutCloser, "auto cashout")
+	tryClose(b.pricerCloser, "pricer")
+	tryClose(b.solvencyMonitorCloser, "solvency monitor")
+	tryClose(b.ledgerCloser, "accounting ledger")
+	tryClose(b.priceOracleCloser, "price oracle")
+	tryClose(b.scrubberCloser, "localstore scrubber")
+	tryClose(b.remotePinningCloser, "remote pinning")
+	tryClose(b.walletCloser, "wallet")
 
 	wg.Add(3)
 	go func() {
@@ -878,6 +1142,7 @@ func (b *Pen) Shutdown(ctx context.Context) error {
 	tryClose(b.tracerCloser, "tracer")
 	tryClose(b.tagsCloser, "tag persistence")
 	tryClose(b.topologyCloser, "topology driver")
+	tryClose(b.metricsDBCloser, "kademlia metrics")
 	tryClose(b.stateStoreCloser, "statestore")
 	tryClose(b.localstoreCloser, "localstore")
 	tryClose(b.errorLogWriter, "error log writer")
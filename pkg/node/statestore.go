@@ -7,25 +7,24 @@ package node
 import (
 	"errors"
 	"fmt"
-	"path/filepath"
 
 	"github.com/penguintop/penguin/pkg/logging"
-	"github.com/penguintop/penguin/pkg/statestore/leveldb"
+	"github.com/penguintop/penguin/pkg/statestore"
 	"github.com/penguintop/penguin/pkg/statestore/mock"
 	"github.com/penguintop/penguin/pkg/storage"
     "github.com/penguintop/penguin/pkg/penguin"
 )
 
-// InitStateStore will initialize the stateStore with the given path to the
+// InitStateStore will initialize the stateStore of the given backend in the
 // data directory. When given an empty directory path, the function will instead
 // initialize an in-memory state store that will not be persisted.
-func InitStateStore(log logging.Logger, dataDir string) (ret storage.StateStorer, err error) {
+func InitStateStore(log logging.Logger, dataDir, backend string) (ret storage.StateStorer, err error) {
 	if dataDir == "" {
 		ret = mock.NewStateStore()
 		log.Warning("using in-mem state store, no node state will be persisted")
 		return ret, nil
 	}
-	return leveldb.NewStateStore(filepath.Join(dataDir, "statestore"), log)
+	return statestore.Open(dataDir, backend, log)
 }
 
 const overlayKey = "overlay"
@@ -128,8 +128,10 @@ func (r *Recorder) NewStream(ctx context.Context, addr penguin.Address, h p2p.He
 	for i := len(r.middlewares) - 1; i >= 0; i-- {
 		handler = r.middlewares[i](handler)
 	}
+	streamIn.headers = h
 	if headler != nil {
-		streamOut.headers = headler(h, addr)
+		streamOut.headers = headler(h, r.base)
+		streamIn.responseHeaders = streamOut.headers
 	}
 	record := &Record{in: recordIn, out: recordOut, done: make(chan struct{})}
 	go func() {
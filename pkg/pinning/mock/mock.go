@@ -6,9 +6,11 @@ package mock
 
 import (
 	"context"
+	"time"
 
+	"github.com/penguintop/penguin/pkg/penguin"
 	"github.com/penguintop/penguin/pkg/pinning"
-    "github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/storage"
 )
 
 var _ pinning.Interface = (*ServiceMock)(nil)
@@ -21,8 +23,8 @@ func NewServiceMock() *ServiceMock {
 // ServiceMock represents a simple mock of pinning.Interface.
 // The implementation is not goroutine-safe.
 type ServiceMock struct {
-	index      map[string]int
-	references []penguin.Address
+	index map[string]int
+	pins  []pinning.Pin
 }
 
 // CreatePin implements pinning.Interface CreatePin method.
@@ -30,8 +32,8 @@ func (sm *ServiceMock) CreatePin(_ context.Context, ref penguin.Address, _ bool)
 	if _, ok := sm.index[ref.String()]; ok {
 		return nil
 	}
-	sm.index[ref.String()] = len(sm.references)
-	sm.references = append(sm.references, ref)
+	sm.index[ref.String()] = len(sm.pins)
+	sm.pins = append(sm.pins, pinning.Pin{Reference: ref, Created: time.Now().UTC()})
 	return nil
 }
 
@@ -42,7 +44,10 @@ func (sm *ServiceMock) DeletePin(_ context.Context, ref penguin.Address) error {
 		return nil
 	}
 	delete(sm.index, ref.String())
-	sm.references = append(sm.references[:i], sm.references[i+1:]...)
+	sm.pins = append(sm.pins[:i], sm.pins[i+1:]...)
+	for j := i; j < len(sm.pins); j++ {
+		sm.index[sm.pins[j].Reference.String()] = j
+	}
 	return nil
 }
 
@@ -54,5 +59,48 @@ func (sm *ServiceMock) HasPin(ref penguin.Address) (bool, error) {
 
 // Pins implements pinning.Interface Pins method.
 func (sm *ServiceMock) Pins() ([]penguin.Address, error) {
-	return append([]penguin.Address(nil), sm.references...), nil
+	refs := make([]penguin.Address, 0, len(sm.pins))
+	for _, pin := range sm.pins {
+		refs = append(refs, pin.Reference)
+	}
+	return refs, nil
+}
+
+// GetPin implements pinning.Interface GetPin method.
+func (sm *ServiceMock) GetPin(ref penguin.Address) (*pinning.Pin, error) {
+	i, ok := sm.index[ref.String()]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	pin := sm.pins[i]
+	return &pin, nil
+}
+
+// ListPins implements pinning.Interface ListPins method.
+func (sm *ServiceMock) ListPins() ([]pinning.Pin, error) {
+	return append([]pinning.Pin(nil), sm.pins...), nil
+}
+
+// SetPinName implements pinning.Interface SetPinName method.
+func (sm *ServiceMock) SetPinName(ref penguin.Address, name string) error {
+	i, ok := sm.index[ref.String()]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	sm.pins[i].Name = name
+	return nil
+}
+
+// VerifyPin implements pinning.Interface VerifyPin method.
+// The pins of the mock are always complete.
+func (sm *ServiceMock) VerifyPin(_ context.Context, ref penguin.Address) (*pinning.Verification, error) {
+	if _, ok := sm.index[ref.String()]; !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &pinning.Verification{Reference: ref, Complete: true}, nil
+}
+
+// RepairPin implements pinning.Interface RepairPin method.
+func (sm *ServiceMock) RepairPin(ctx context.Context, ref penguin.Address) (*pinning.Verification, error) {
+	return sm.VerifyPin(ctx, ref)
 }
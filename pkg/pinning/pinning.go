@@ -5,15 +5,18 @@
 package pinning
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
+	"github.com/penguintop/penguin/pkg/penguin"
 	"github.com/penguintop/penguin/pkg/storage"
-    "github.com/penguintop/penguin/pkg/penguin"
 	"github.com/penguintop/penguin/pkg/traversal"
-	"github.com/hashicorp/go-multierror"
 )
 
 // ErrTraversal signals that errors occurred during nodes traversal.
@@ -34,24 +37,94 @@ type Interface interface {
 	HasPin(penguin.Address) (bool, error)
 	// Pins return all pinned references.
 	Pins() ([]penguin.Address, error)
+	// GetPin returns the pin of the given reference or
+	// storage.ErrNotFound if the reference is not pinned.
+	GetPin(penguin.Address) (*Pin, error)
+	// ListPins returns all the pins.
+	ListPins() ([]Pin, error)
+	// SetPinName sets the name of an existing pin.
+	SetPinName(penguin.Address, string) error
+	// VerifyPin traverses the tree of a pinned reference
+	// in the local store and reports the missing chunks.
+	VerifyPin(context.Context, penguin.Address) (*Verification, error)
+	// RepairPin retrieves the missing chunks of a pinned
+	// reference from the network and verifies it again.
+	RepairPin(context.Context, penguin.Address) (*Verification, error)
+}
+
+// Pin holds the details of a pinned reference.
+type Pin struct {
+	Reference penguin.Address `json:"reference"`
+	Name      string          `json:"name,omitempty"`
+	Created   time.Time       `json:"created"`
+	Chunks    uint64          `json:"chunks"`
+	Size      uint64          `json:"size"` // in bytes, including the chunk spans
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+// Pins stored before the pin details were introduced hold
+// only the reference and are decoded as pins without details.
+func (p *Pin) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte(`"`)) {
+		*p = Pin{}
+		return json.Unmarshal(b, &p.Reference)
+	}
+	type pin Pin
+	return json.Unmarshal(b, (*pin)(p))
 }
 
-const storePrefix = "root-pin"
+// Verification is the result of the verification of a pin.
+type Verification struct {
+	Reference penguin.Address
+	// Chunks is the number of distinct chunks of the tree found
+	// in the local store, it is complete only if the traversal is.
+	Chunks uint64
+	// Size is the sum of the sizes of the found chunks.
+	Size uint64
+	// Missing are the chunks of the tree not found in the local store.
+	Missing []penguin.Address
+	// Complete is false if a missing chunk prevented the
+	// traversal of the chunks referenced by it.
+	Complete bool
+}
+
+const (
+	storePrefix = "root-pin"
+	// pinnedChunkPrefix prefixes the number of pins of every pinned chunk.
+	pinnedChunkPrefix = "pinned-chunk"
+	// pinnedChunksKey holds the number of distinct pinned chunks.
+	pinnedChunksKey = "pinned-chunks"
+)
 
 func rootPinKey(ref penguin.Address) string {
 	return fmt.Sprintf("%s-%s", storePrefix, ref)
 }
 
-// NewService is a convenient constructor for Service.
+func pinnedChunkKey(addr penguin.Address) string {
+	return fmt.Sprintf("%s-%s", pinnedChunkPrefix, addr)
+}
+
+// NewService is a convenient constructor for Service. The fetcher retrieves
+// the chunks missing from the pin storage and is expected to store the
+// chunks it retrieves with storage.ModeGetRequestPin as pinned, as the
+// netstore does. The quota limits the number of distinct chunks of all
+// pins, zero means no limit. Chunks of pins created before the chunks
+// were counted are not part of the quota.
 func NewService(
 	pinStorage storage.Storer,
 	rhStorage storage.StateStorer,
 	traverser traversal.Traverser,
+	fetcher storage.Getter,
+	quota uint64,
 ) *Service {
 	return &Service{
 		pinStorage: pinStorage,
 		rhStorage:  rhStorage,
 		traverser:  traverser,
+		local:      traversal.New(&lookupStore{Storer: pinStorage}),
+		fetcher:    fetcher,
+		quota:      quota,
+		pending:    make(map[string]struct{}),
 	}
 }
 
@@ -60,15 +133,56 @@ type Service struct {
 	pinStorage storage.Storer
 	rhStorage  storage.StateStorer
 	traverser  traversal.Traverser
+	local      traversal.Traverser // traverses the local store only
+	fetcher    storage.Getter
+	quota      uint64
+	mu         sync.Mutex          // serializes the updates of the pin records
+	pending    map[string]struct{} // pins being created
 }
 
-// CreatePin implements Interface.CreatePin method.
-func (s *Service) CreatePin(ctx context.Context, ref penguin.Address, traverse bool) error {
+// CreatePin implements Interface.CreatePin method. The chunks of a new pin
+// are counted against the quota before any of them is pinned.
+func (s *Service) CreatePin(ctx context.Context, ref penguin.Address, traverse bool) (err error) {
+	has, err := s.HasPin(ref)
+	if err != nil {
+		return err
+	}
+
+	if !has {
+		addrs := []penguin.Address{ref}
+		if traverse {
+			if addrs, err = s.chunks(ctx, ref); err != nil {
+				return err
+			}
+		}
+		var reserved bool
+		if reserved, err = s.reserve(ref, addrs); err != nil {
+			return err
+		}
+		if !reserved {
+			// created in the meanwhile
+			has = true
+		} else {
+			defer func() {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+
+				delete(s.pending, ref.ByteString())
+				if err != nil {
+					if rerr := s.release(addrs); rerr != nil {
+						err = multierror.Append(err, rerr)
+					}
+				}
+			}()
+		}
+	}
+
 	// iterFn is a pinning iterator function over the leaves of the root.
 	iterFn := func(leaf penguin.Address) error {
 		switch err := s.pinStorage.Set(ctx, storage.ModeSetPin, leaf); {
 		case errors.Is(err, storage.ErrNotFound):
-			ch, err := s.pinStorage.Get(ctx, storage.ModeGetRequestPin, leaf)
+			// retrieve the chunks missing from the local store
+			ch, err := s.fetcher.Get(ctx, storage.ModeGetRequestPin, leaf)
 			if err != nil {
 				return fmt.Errorf("unable to get pin for leaf %q of root %q: %w", leaf, ref, err)
 			}
@@ -87,22 +201,185 @@ func (s *Service) CreatePin(ctx context.Context, ref penguin.Address, traverse b
 			return fmt.Errorf("traversal of %q failed: %w", ref, err)
 		}
 	}
+	if has {
+		return nil
+	}
 
-	key := rootPinKey(ref)
-	switch err := s.rhStorage.Get(key, new(penguin.Address)); {
-	case errors.Is(err, storage.ErrNotFound):
-		return s.rhStorage.Put(key, ref)
-	case err != nil:
+	pin := Pin{Reference: ref, Created: time.Now().UTC()}
+	v, err := s.verify(ctx, ref)
+	if err == nil && v.Complete {
+		pin.Chunks, pin.Size = v.Chunks, v.Size
+	} else if ch, err := s.pinStorage.Get(ctx, storage.ModeGetLookup, ref); err == nil {
+		// the reference is not the root of a complete chunk tree
+		pin.Chunks, pin.Size = 1, uint64(len(ch.Data()))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rhStorage.Put(rootPinKey(ref), pin); err != nil {
 		return fmt.Errorf("unable to pin %q: %w", ref, err)
 	}
 	return nil
 }
 
+// chunks returns the distinct chunks of the tree of the reference.
+func (s *Service) chunks(ctx context.Context, ref penguin.Address) ([]penguin.Address, error) {
+	var (
+		mu    sync.Mutex
+		seen  = make(map[string]struct{})
+		addrs []penguin.Address
+	)
+	err := s.traverser.Traverse(ctx, ref, func(addr penguin.Address) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if _, ok := seen[addr.ByteString()]; !ok {
+			seen[addr.ByteString()] = struct{}{}
+			addrs = append(addrs, addr)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("traversal of %q failed: %w", ref, err)
+	}
+	return addrs, nil
+}
+
+// reserve counts the chunks of a new pin of the reference, failing with
+// storage.ErrPinQuotaExceeded if the chunks not pinned yet do not fit in
+// the quota. It returns false if the reference is pinned or being pinned.
+func (s *Service) reserve(ref penguin.Address, addrs []penguin.Address) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pending[ref.ByteString()]; ok {
+		return false, nil
+	}
+	switch err := s.rhStorage.Get(rootPinKey(ref), new(Pin)); {
+	case err == nil:
+		return false, nil
+	case !errors.Is(err, storage.ErrNotFound):
+		return false, fmt.Errorf("unable to get pin %q: %w", ref, err)
+	}
+
+	used, err := s.pinnedChunks()
+	if err != nil {
+		return false, err
+	}
+	counts := make([]uint64, len(addrs))
+	var added uint64
+	for i, addr := range addrs {
+		switch err := s.rhStorage.Get(pinnedChunkKey(addr), &counts[i]); {
+		case errors.Is(err, storage.ErrNotFound):
+			added++
+		case err != nil:
+			return false, fmt.Errorf("unable to get pinned chunk %q: %w", addr, err)
+		}
+	}
+	if s.quota > 0 && used+added > s.quota {
+		return false, fmt.Errorf("pin of %d new chunks with %d of %d chunks pinned: %w", added, used, s.quota, storage.ErrPinQuotaExceeded)
+	}
+
+	for i, addr := range addrs {
+		if err := s.rhStorage.Put(pinnedChunkKey(addr), counts[i]+1); err != nil {
+			return false, fmt.Errorf("unable to count pinned chunk %q: %w", addr, err)
+		}
+	}
+	if err := s.rhStorage.Put(pinnedChunksKey, used+added); err != nil {
+		return false, fmt.Errorf("unable to count pinned chunks: %w", err)
+	}
+	s.pending[ref.ByteString()] = struct{}{}
+	return true, nil
+}
+
+// release uncounts the chunks of a pin. It must be called under the lock.
+func (s *Service) release(addrs []penguin.Address) error {
+	used, err := s.pinnedChunks()
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		var count uint64
+		switch err := s.rhStorage.Get(pinnedChunkKey(addr), &count); {
+		case errors.Is(err, storage.ErrNotFound):
+			// pinned before the chunks were counted
+			continue
+		case err != nil:
+			return fmt.Errorf("unable to get pinned chunk %q: %w", addr, err)
+		}
+		if count > 1 {
+			err = s.rhStorage.Put(pinnedChunkKey(addr), count-1)
+		} else {
+			err = s.rhStorage.Delete(pinnedChunkKey(addr))
+			if used > 0 {
+				used--
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("unable to uncount pinned chunk %q: %w", addr, err)
+		}
+	}
+	if err := s.rhStorage.Put(pinnedChunksKey, used); err != nil {
+		return fmt.Errorf("unable to count pinned chunks: %w", err)
+	}
+	return nil
+}
+
+// pinnedChunks returns the number of distinct pinned chunks.
+// It must be called under the lock.
+func (s *Service) pinnedChunks() (uint64, error) {
+	var used uint64
+	if err := s.rhStorage.Get(pinnedChunksKey, &used); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return 0, fmt.Errorf("unable to get pinned chunks: %w", err)
+	}
+	return used, nil
+}
+
 // DeletePin implements Interface.DeletePin method.
 func (s *Service) DeletePin(ctx context.Context, ref penguin.Address) error {
-	var iterErr error
+	has, err := s.HasPin(ref)
+	if err != nil {
+		return err
+	}
+	addrs, err := s.unpin(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if has {
+		if err := s.release(addrs); err != nil {
+			return err
+		}
+	}
+	key := rootPinKey(ref)
+	if err := s.rhStorage.Delete(key); err != nil {
+		return fmt.Errorf("unable to delete pin for key %q: %w", key, err)
+	}
+	return nil
+}
+
+// unpin traverses the tree of the reference and un-pins its chunks.
+// It returns the distinct chunks of the tree.
+func (s *Service) unpin(ctx context.Context, ref penguin.Address) ([]penguin.Address, error) {
+	var (
+		mu      sync.Mutex
+		seen    = make(map[string]struct{})
+		addrs   []penguin.Address
+		iterErr error
+	)
 	// iterFn is a unpinning iterator function over the leaves of the root.
 	iterFn := func(leaf penguin.Address) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if _, ok := seen[leaf.ByteString()]; !ok {
+			seen[leaf.ByteString()] = struct{}{}
+			addrs = append(addrs, leaf)
+		}
 		err := s.pinStorage.Set(ctx, storage.ModeSetUnpin, leaf)
 		if err != nil {
 			iterErr = multierror.Append(err, fmt.Errorf("unable to unpin the chunk for leaf %q of root %q: %w", leaf, ref, err))
@@ -112,44 +389,215 @@ func (s *Service) DeletePin(ctx context.Context, ref penguin.Address) error {
 	}
 
 	if err := s.traverser.Traverse(ctx, ref, iterFn); err != nil {
-		return fmt.Errorf("traversal of %q failed: %w", ref, multierror.Append(err, iterErr))
+		return nil, fmt.Errorf("traversal of %q failed: %w", ref, multierror.Append(err, iterErr))
 	}
 	if iterErr != nil {
-		return multierror.Append(ErrTraversal, iterErr)
-	}
-
-	key := rootPinKey(ref)
-	if err := s.rhStorage.Delete(key); err != nil {
-		return fmt.Errorf("unable to delete pin for key %q: %w", key, err)
+		return nil, multierror.Append(ErrTraversal, iterErr)
 	}
-	return nil
+	return addrs, nil
 }
 
 // HasPin implements Interface.HasPin method.
 func (s *Service) HasPin(ref penguin.Address) (bool, error) {
-	key, val := rootPinKey(ref), penguin.NewAddress(nil)
-	switch err := s.rhStorage.Get(key, &val); {
+	switch pin, err := s.GetPin(ref); {
 	case errors.Is(err, storage.ErrNotFound):
 		return false, nil
 	case err != nil:
-		return false, fmt.Errorf("unable to get pin for key %q: %w", key, err)
+		return false, err
+	default:
+		return pin.Reference.Equal(ref), nil
+	}
+}
+
+// GetPin implements Interface.GetPin method.
+func (s *Service) GetPin(ref penguin.Address) (*Pin, error) {
+	key, pin := rootPinKey(ref), new(Pin)
+	switch err := s.rhStorage.Get(key, pin); {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, err
+	case err != nil:
+		return nil, fmt.Errorf("unable to get pin for key %q: %w", key, err)
 	}
-	return val.Equal(ref), nil
+	return pin, nil
 }
 
 // Pins implements Interface.Pins method.
 func (s *Service) Pins() ([]penguin.Address, error) {
-	var refs []penguin.Address
+	pins, err := s.ListPins()
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]penguin.Address, 0, len(pins))
+	for _, pin := range pins {
+		refs = append(refs, pin.Reference)
+	}
+	return refs, nil
+}
+
+// ListPins implements Interface.ListPins method.
+func (s *Service) ListPins() ([]Pin, error) {
+	var pins []Pin
 	err := s.rhStorage.Iterate(storePrefix, func(key, val []byte) (stop bool, err error) {
-		var ref penguin.Address
-		if err := json.Unmarshal(val, &ref); err != nil {
-			return true, fmt.Errorf("invalid reference value %q: %w", string(val), err)
+		var pin Pin
+		if err := json.Unmarshal(val, &pin); err != nil {
+			return true, fmt.Errorf("invalid pin value %q: %w", string(val), err)
 		}
-		refs = append(refs, ref)
+		pins = append(pins, pin)
 		return false, nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf("iteration failed: %w", err)
 	}
-	return refs, nil
+	return pins, nil
+}
+
+// SetPinName implements Interface.SetPinName method.
+func (s *Service) SetPinName(ref penguin.Address, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pin, err := s.GetPin(ref)
+	if err != nil {
+		return err
+	}
+	pin.Name = name
+	return s.rhStorage.Put(rootPinKey(ref), pin)
+}
+
+// VerifyPin implements Interface.VerifyPin method.
+func (s *Service) VerifyPin(ctx context.Context, ref penguin.Address) (*Verification, error) {
+	if _, err := s.GetPin(ref); err != nil {
+		return nil, err
+	}
+	return s.verify(ctx, ref)
+}
+
+// RepairPin implements Interface.RepairPin method. Every retrieved
+// intermediate chunk may reveal further missing chunks, so the tree is
+// verified and repaired until no chunk is left to retrieve. A chunk is
+// retrieved at most once. The chunk count and size of the pin are updated
+// if the final verification is complete.
+func (s *Service) RepairPin(ctx context.Context, ref penguin.Address) (*Verification, error) {
+	if _, err := s.GetPin(ref); err != nil {
+		return nil, err
+	}
+
+	var (
+		v     *Verification
+		err   error
+		tried = make(map[string]struct{})
+	)
+	for retrieved := 1; retrieved > 0; {
+		v, err = s.verify(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		retrieved = 0
+		for _, addr := range v.Missing {
+			if _, ok := tried[addr.ByteString()]; ok {
+				continue
+			}
+			tried[addr.ByteString()] = struct{}{}
+
+			switch _, err := s.fetcher.Get(ctx, storage.ModeGetRequestPin, addr); {
+			case ctx.Err() != nil:
+				return nil, ctx.Err()
+			case err == nil:
+				retrieved++
+			}
+			// Continue with the chunks that can be retrieved.
+		}
+	}
+	if !v.Complete {
+		return v, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pin, err := s.GetPin(ref)
+	if err != nil {
+		return nil, err
+	}
+	pin.Chunks, pin.Size = v.Chunks, v.Size
+	if err := s.rhStorage.Put(rootPinKey(ref), pin); err != nil {
+		return nil, fmt.Errorf("unable to update pin %q: %w", ref, err)
+	}
+	return v, nil
+}
+
+// verify traverses the tree of the reference in the local store.
+func (s *Service) verify(ctx context.Context, ref penguin.Address) (*Verification, error) {
+	var (
+		mu      sync.Mutex
+		seen    = make(map[string]struct{})
+		missing = make(map[string]struct{})
+		v       = &Verification{Reference: ref}
+	)
+	addMissing := func(addr penguin.Address) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if _, ok := missing[addr.ByteString()]; !ok {
+			missing[addr.ByteString()] = struct{}{}
+			v.Missing = append(v.Missing, addr)
+		}
+	}
+
+	// iterFn is a verifying iterator function over the chunks of the root.
+	iterFn := func(addr penguin.Address) error {
+		ch, err := s.pinStorage.Get(ctx, storage.ModeGetLookup, addr)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			addMissing(addr)
+			return nil
+		case err != nil:
+			return fmt.Errorf("unable to get chunk %q of root %q: %w", addr, ref, err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if _, ok := seen[addr.ByteString()]; !ok {
+			seen[addr.ByteString()] = struct{}{}
+			v.Chunks++
+			v.Size += uint64(len(ch.Data()))
+		}
+		return nil
+	}
+
+	ctx = withMissingHook(ctx, addMissing)
+	err := s.local.Traverse(ctx, ref, iterFn)
+	switch {
+	case err == nil:
+		v.Complete = true
+	case len(v.Missing) == 0:
+		return nil, fmt.Errorf("traversal of %q failed: %w", ref, err)
+	}
+	return v, nil
+}
+
+type missingHookKey struct{}
+
+func withMissingHook(ctx context.Context, hook func(penguin.Address)) context.Context {
+	return context.WithValue(ctx, missingHookKey{}, hook)
+}
+
+// lookupStore gets chunks from the local store without updating their
+// access and reports the chunks it can not find to the hook in the context.
+// It reveals missing intermediate chunks, which the traversal gets before
+// iterating over the chunks they reference.
+type lookupStore struct {
+	storage.Storer
+}
+
+func (l *lookupStore) Get(ctx context.Context, _ storage.ModeGet, addr penguin.Address) (penguin.Chunk, error) {
+	ch, err := l.Storer.Get(ctx, storage.ModeGetLookup, addr)
+	if errors.Is(err, storage.ErrNotFound) {
+		if hook, ok := ctx.Value(missingHookKey{}).(func(penguin.Address)); ok {
+			hook(addr)
+		}
+	}
+	return ch, err
 }
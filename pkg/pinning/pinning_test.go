@@ -5,11 +5,16 @@
 package pinning_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"errors"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/penguintop/penguin/pkg/file/pipeline/builder"
+	"github.com/penguintop/penguin/pkg/penguin"
 	"github.com/penguintop/penguin/pkg/pinning"
 	statestorem "github.com/penguintop/penguin/pkg/statestore/mock"
 	"github.com/penguintop/penguin/pkg/storage"
@@ -27,6 +32,8 @@ func TestPinningService(t *testing.T) {
 			storerMock,
 			statestorem.NewStateStore(),
 			traversal.New(storerMock),
+			storerMock,
+			0,
 		)
 	)
 
@@ -96,3 +103,225 @@ func TestPinningService(t *testing.T) {
 		}
 	})
 }
+
+// fetcher retrieves chunks from a remote store and stores them
+// pinned in the local store, as the netstore does.
+type fetcher struct {
+	local, remote storage.Storer
+}
+
+func (f *fetcher) Get(ctx context.Context, mode storage.ModeGet, addr penguin.Address) (penguin.Chunk, error) {
+	ch, err := f.remote.Get(ctx, mode, addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.local.Put(ctx, storage.ModePutRequestPin, ch); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// uploadTree uploads random content with intermediate chunks to the stores
+// and returns its reference and the addresses of its chunks.
+func uploadTree(t *testing.T, stores ...storage.Storer) (penguin.Address, []penguin.Address) {
+	t.Helper()
+
+	ctx := context.Background()
+	content := make([]byte, 130*penguin.ChunkSize)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	var ref penguin.Address
+	for _, store := range stores {
+		pipe := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false)
+		r, err := builder.FeedPipeline(ctx, pipe, bytes.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref = r
+	}
+
+	var (
+		mu    sync.Mutex
+		addrs []penguin.Address
+	)
+	err := traversal.New(stores[0]).Traverse(ctx, ref, func(addr penguin.Address) error {
+		mu.Lock()
+		defer mu.Unlock()
+		addrs = append(addrs, addr)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref, addrs
+}
+
+func TestPinVerifyAndRepair(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		local   = storagem.NewStorer()
+		remote  = storagem.NewStorer()
+		service = pinning.NewService(
+			local,
+			statestorem.NewStateStore(),
+			traversal.New(local),
+			&fetcher{local: local, remote: remote},
+			0,
+		)
+	)
+	ref, addrs := uploadTree(t, local, remote)
+
+	if err := service.CreatePin(ctx, ref, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetPinName(ref, "random"); err != nil {
+		t.Fatal(err)
+	}
+	pin, err := service.GetPin(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the tree has 130 data chunks, two intermediate chunks and the root
+	if pin.Name != "random" || pin.Created.IsZero() || pin.Chunks != 133 || pin.Size <= 130*penguin.ChunkSize {
+		t.Fatalf("got pin %+v, want 133 chunks named random", pin)
+	}
+
+	v, err := service.VerifyPin(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Complete || len(v.Missing) != 0 || v.Chunks != pin.Chunks || v.Size != pin.Size {
+		t.Fatalf("got verification %+v, want complete with %d chunks", v, pin.Chunks)
+	}
+
+	// the first intermediate chunk hides the chunks it references
+	intermediate, leaf := addrs[1], addrs[len(addrs)-1]
+	if err := local.Set(ctx, storage.ModeSetRemove, intermediate, leaf); err != nil {
+		t.Fatal(err)
+	}
+	v, err = service.VerifyPin(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Complete || len(v.Missing) == 0 || !v.Missing[0].Equal(intermediate) {
+		t.Fatalf("got verification %+v, want incomplete missing %s", v, intermediate)
+	}
+
+	v, err = service.RepairPin(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Complete || len(v.Missing) != 0 || v.Chunks != pin.Chunks {
+		t.Fatalf("got verification %+v, want complete with %d chunks", v, pin.Chunks)
+	}
+
+	// chunks which can not be retrieved remain missing
+	if err := local.Set(ctx, storage.ModeSetRemove, leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Set(ctx, storage.ModeSetRemove, leaf); err != nil {
+		t.Fatal(err)
+	}
+	v, err = service.RepairPin(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Complete || len(v.Missing) != 1 || !v.Missing[0].Equal(leaf) {
+		t.Fatalf("got verification %+v, want missing %s", v, leaf)
+	}
+	if got, err := service.GetPin(ref); err != nil || got.Chunks != pin.Chunks {
+		t.Fatalf("got pin %+v, error %v, want %d chunks", got, err, pin.Chunks)
+	}
+
+	if _, err := service.VerifyPin(ctx, penguin.MustParseHexAddress("01")); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+func TestPinQuota(t *testing.T) {
+	var (
+		ctx          = context.Background()
+		store        = storagem.NewStorer()
+		small, addrs = uploadTree(t, store)
+		large, other = uploadTree(t, store)
+		service      = pinning.NewService(
+			store,
+			statestorem.NewStateStore(),
+			traversal.New(store),
+			store,
+			uint64(len(addrs)+1),
+		)
+	)
+
+	if err := service.CreatePin(ctx, small, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CreatePin(ctx, large, true); !errors.Is(err, storage.ErrPinQuotaExceeded) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrPinQuotaExceeded)
+	}
+	if has, err := service.HasPin(large); err != nil || has {
+		t.Fatalf("got has %v, error %v, want not pinned", has, err)
+	}
+	for _, addr := range other {
+		if mode := store.GetModeSet(addr); mode == storage.ModeSetPin {
+			t.Fatalf("chunk %s over quota pinned", addr)
+		}
+	}
+
+	// chunks already pinned are counted once
+	if err := service.CreatePin(ctx, addrs[len(addrs)-1], false); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CreatePin(ctx, other[len(other)-1], false); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CreatePin(ctx, other[len(other)-2], false); !errors.Is(err, storage.ErrPinQuotaExceeded) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrPinQuotaExceeded)
+	}
+
+	// the chunks shared with other pins stay counted
+	if err := service.DeletePin(ctx, small); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CreatePin(ctx, large, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CreatePin(ctx, small, true); !errors.Is(err, storage.ErrPinQuotaExceeded) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrPinQuotaExceeded)
+	}
+}
+
+func TestLegacyPins(t *testing.T) {
+	var (
+		stateStore = statestorem.NewStateStore()
+		store      = storagem.NewStorer()
+		service    = pinning.NewService(store, stateStore, traversal.New(store), store, 0)
+		ref        = penguin.MustParseHexAddress("838d0a193ecd1152d1bb1432d5ecc02398533b2494889e23b8bd5ace30ac2aeb")
+	)
+	// pins used to hold only the reference
+	if err := stateStore.Put("root-pin-"+ref.String(), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	pin, err := service.GetPin(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pin.Reference.Equal(ref) || pin.Chunks != 0 {
+		t.Fatalf("got pin %+v, want pin of %s without details", pin, ref)
+	}
+	refs, err := service.Pins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || !refs[0].Equal(ref) {
+		t.Fatalf("got pins %v, want %s", refs, ref)
+	}
+	if err := service.SetPinName(ref, "legacy"); err != nil {
+		t.Fatal(err)
+	}
+	if pin, err = service.GetPin(ref); err != nil || pin.Name != "legacy" {
+		t.Fatalf("got pin %+v, error %v, want named legacy", pin, err)
+	}
+}
@@ -0,0 +1,735 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package remote provides a remote pinning service through which other
+// parties ask the node to retrieve and pin their content. The requests are
+// modelled on the IPFS Pinning Services API: a pin request is accepted and
+// queued, the content is then retrieved and pinned in the background and the
+// status of the request reports the progress.
+//
+// Owners authenticate every request with a single use bearer token signed
+// with their key for the node, the pin requests of an owner are visible to
+// that owner only.
+package remote
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/crypto"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/pinning"
+	"github.com/penguintop/penguin/pkg/storage"
+)
+
+const (
+	requestPrefix = "remote_pin_request_"
+	// pinnedPrefix marks the references pinned by the service, which
+	// are unpinned again once no request refers to them.
+	pinnedPrefix = "remote_pin_pinned_"
+	// noncePrefix marks the nonces of the accepted tokens,
+	// kept until the tokens expire to reject their replays.
+	noncePrefix = "remote_pin_nonce_"
+
+	tokenSignaturePrefix = "penguin-remote-pinning:"
+	tokenExpirySize      = 8
+	tokenNonceSize       = 16
+	tokenSignatureSize   = 65
+
+	// MaxTokenLifetime is the longest validity of the tokens accepted by the service.
+	MaxTokenLifetime = 10 * time.Minute
+	// DefaultQuota is the default number of pin requests of an owner.
+	DefaultQuota = 1000
+
+	// DefaultListLimit is the number of pin requests listed if no limit is given.
+	DefaultListLimit = 10
+	// MaxListLimit is the maximal number of pin requests listed at once.
+	MaxListLimit = 1000
+)
+
+var (
+	// ErrNotFound is returned if the owner has no pin request with the id.
+	ErrNotFound = errors.New("pin request not found")
+	// ErrUnauthorized is returned for invalid or expired tokens and for
+	// owners not allowed to use the service.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrInvalidPin is returned for pins without a reference.
+	ErrInvalidPin = errors.New("invalid pin")
+	// ErrQuotaExceeded is returned if the owner has the maximal number of pin requests.
+	ErrQuotaExceeded = errors.New("pin request quota exceeded")
+)
+
+// Status is the status of a pin request.
+type Status string
+
+// Statuses of the pin requests.
+const (
+	StatusQueued  Status = "queued"
+	StatusPinning Status = "pinning"
+	StatusPinned  Status = "pinned"
+	StatusFailed  Status = "failed"
+)
+
+// ParseStatus parses the status name.
+func ParseStatus(s string) (Status, error) {
+	switch st := Status(s); st {
+	case StatusQueued, StatusPinning, StatusPinned, StatusFailed:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown pin status %q", s)
+}
+
+// Pin is the content an owner asks to pin.
+type Pin struct {
+	Reference penguin.Address   `json:"cid"`
+	Name      string            `json:"name,omitempty"`
+	Origins   []string          `json:"origins,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty"`
+}
+
+// PinStatus is the status of a pin request.
+type PinStatus struct {
+	RequestID string            `json:"requestid"`
+	Status    Status            `json:"status"`
+	Created   time.Time         `json:"created"`
+	Pin       Pin               `json:"pin"`
+	Delegates []string          `json:"delegates"`
+	Info      map[string]string `json:"info,omitempty"`
+}
+
+// PinResults are the listed pin requests together with
+// the number of the pin requests matching the filter.
+type PinResults struct {
+	Count   int         `json:"count"`
+	Results []PinStatus `json:"results"`
+}
+
+// Filter selects the listed pin requests. Zero values do not filter.
+type Filter struct {
+	References []penguin.Address
+	Name       string
+	// Statuses defaults to the pinned status.
+	Statuses []Status
+	Before   time.Time
+	After    time.Time
+	Limit    int
+}
+
+func (f Filter) match(st PinStatus) bool {
+	if len(f.References) > 0 {
+		var found bool
+		for _, ref := range f.References {
+			if ref.Equal(st.Pin.Reference) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Name != "" && f.Name != st.Pin.Name {
+		return false
+	}
+	statuses := f.Statuses
+	if len(statuses) == 0 {
+		statuses = []Status{StatusPinned}
+	}
+	var found bool
+	for _, s := range statuses {
+		if s == st.Status {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+	if !f.Before.IsZero() && !st.Created.Before(f.Before) {
+		return false
+	}
+	if !f.After.IsZero() && !st.Created.After(f.After) {
+		return false
+	}
+	return true
+}
+
+// NewToken returns a single use token authenticating the owner of the signer
+// at the node with the overlay address until the expiry. The token of a
+// request adding a pin is bound to the reference of the pin, the tokens of
+// the other requests to the zero address.
+func NewToken(signer crypto.Signer, overlay, ref penguin.Address, expiry time.Time) (string, error) {
+	b := make([]byte, tokenExpirySize+tokenNonceSize)
+	binary.BigEndian.PutUint64(b, uint64(expiry.Unix()))
+	if _, err := rand.Read(b[tokenExpirySize:]); err != nil {
+		return "", err
+	}
+	sig, err := signer.Sign(tokenData(overlay, b, ref))
+	if err != nil {
+		return "", err
+	}
+	b = append(b, sig...)
+	return hex.EncodeToString(append(b, ref.Bytes()...)), nil
+}
+
+// Token is a parsed authentication token.
+type Token struct {
+	Owner     common.Address
+	Reference penguin.Address
+	Nonce     string
+	Expiry    time.Time
+}
+
+// ParseToken returns the token if it is signed for the node with the overlay
+// address and valid at the time, which is to expire within MaxTokenLifetime.
+// Replays of the token are not detected.
+func ParseToken(token string, overlay penguin.Address, now time.Time) (*Token, error) {
+	b, err := hex.DecodeString(token)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	const size = tokenExpirySize + tokenNonceSize + tokenSignatureSize
+	switch len(b) - size {
+	case 0, penguin.HashSize, 2 * penguin.HashSize:
+	default:
+		return nil, ErrUnauthorized
+	}
+	expiry := time.Unix(int64(binary.BigEndian.Uint64(b[:tokenExpirySize])), 0)
+	if !expiry.After(now) || expiry.After(now.Add(MaxTokenLifetime)) {
+		return nil, ErrUnauthorized
+	}
+	ref := penguin.ZeroAddress
+	if len(b) > size {
+		ref = penguin.NewAddress(b[size:])
+	}
+	pub, err := crypto.Recover(b[size-tokenSignatureSize:size], tokenData(overlay, b[:size-tokenSignatureSize], ref))
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	addr, err := crypto.NewEthereumAddress(*pub)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	return &Token{
+		Owner:     common.BytesToAddress(addr),
+		Reference: ref,
+		Nonce:     hex.EncodeToString(b[tokenExpirySize : tokenExpirySize+tokenNonceSize]),
+		Expiry:    expiry,
+	}, nil
+}
+
+// tokenData returns the signed data of the token with
+// the expiry and the nonce bytes for the overlay and the reference.
+func tokenData(overlay penguin.Address, expiryNonce []byte, ref penguin.Address) []byte {
+	data := append([]byte(tokenSignaturePrefix), overlay.Bytes()...)
+	data = append(data, expiryNonce...)
+	return append(data, ref.Bytes()...)
+}
+
+// Options are the options of the service.
+type Options struct {
+	// Overlay is the overlay address of the node the tokens are signed for.
+	Overlay penguin.Address
+	// Owners are the owners allowed to use the service, no owner is
+	// allowed if empty.
+	Owners []common.Address
+	// Quota is the maximal number of pin requests of an owner,
+	// zero means no limit.
+	Quota int
+	// Delegates returns the addresses of the node reported with
+	// the pin requests.
+	Delegates func() []string
+}
+
+// record is a pin request as it is stored.
+type record struct {
+	Owner  common.Address `json:"owner"`
+	Status PinStatus      `json:"status"`
+}
+
+// Service serves the pin requests of the owners. The content of the requests
+// is pinned one request at a time, in the order of the requests.
+type Service struct {
+	pinning pinning.Interface
+	store   storage.StateStorer
+	logger  logging.Logger
+	owners  map[common.Address]struct{}
+	options Options
+	timeNow func() time.Time
+
+	mu     sync.Mutex             // serializes the updates of the records
+	refs   map[string]int         // number of the pin requests of a reference
+	counts map[common.Address]int // number of the pin requests of an owner
+	queue  []string               // keys of the pending pin requests in their order
+	nonces map[string]time.Time   // expiries of the nonces of the accepted tokens
+	pruned time.Time              // last pruning of the expired nonces
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates the service and resumes pinning the content of the pending
+// requests.
+func New(pinning pinning.Interface, store storage.StateStorer, logger logging.Logger, o Options) (*Service, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Service{
+		pinning: pinning,
+		store:   store,
+		logger:  logger,
+		owners:  make(map[common.Address]struct{}),
+		options: o,
+		timeNow: time.Now,
+		refs:    make(map[string]int),
+		counts:  make(map[common.Address]int),
+		nonces:  make(map[string]time.Time),
+		wake:    make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	for _, owner := range o.Owners {
+		s.owners[owner] = struct{}{}
+	}
+	if err := s.load(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.worker()
+	s.trigger()
+	return s, nil
+}
+
+// load indexes the stored pin requests and nonces.
+func (s *Service) load() error {
+	var pending []record
+	err := s.store.Iterate(requestPrefix, func(_, val []byte) (bool, error) {
+		var r record
+		if err := json.Unmarshal(val, &r); err != nil {
+			return true, fmt.Errorf("invalid pin request %q: %w", string(val), err)
+		}
+		s.index(r)
+		if r.Status.Status == StatusQueued || r.Status.Status == StatusPinning {
+			pending = append(pending, r)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("iterate pin requests: %w", err)
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Status.Created.Before(pending[j].Status.Created)
+	})
+	for _, r := range pending {
+		s.queue = append(s.queue, requestKey(r.Owner, r.Status.RequestID))
+	}
+
+	err = s.store.Iterate(noncePrefix, func(key, val []byte) (bool, error) {
+		var expiry int64
+		if err := json.Unmarshal(val, &expiry); err != nil {
+			return true, fmt.Errorf("invalid nonce expiry %q: %w", string(val), err)
+		}
+		s.nonces[strings.TrimPrefix(string(key), noncePrefix)] = time.Unix(expiry, 0)
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("iterate nonces: %w", err)
+	}
+	return nil
+}
+
+// index counts the pin request. It must be called with the lock held.
+func (s *Service) index(r record) {
+	s.refs[r.Status.Pin.Reference.ByteString()]++
+	s.counts[r.Owner]++
+}
+
+// unindex uncounts the pin request. It must be called with the lock held.
+func (s *Service) unindex(r record) {
+	ref := r.Status.Pin.Reference.ByteString()
+	if s.refs[ref]--; s.refs[ref] <= 0 {
+		delete(s.refs, ref)
+	}
+	if s.counts[r.Owner]--; s.counts[r.Owner] <= 0 {
+		delete(s.counts, r.Owner)
+	}
+}
+
+// Authenticate returns the owner authenticated by the token if the owner is
+// allowed to use the service. The token must be bound to the reference of
+// the added pin, or to the zero address, and is accepted once only.
+func (s *Service) Authenticate(token string, ref penguin.Address) (common.Address, error) {
+	now := s.timeNow()
+	t, err := ParseToken(token, s.options.Overlay, now)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if !t.Reference.Equal(ref) {
+		return common.Address{}, ErrUnauthorized
+	}
+	if _, ok := s.owners[t.Owner]; !ok {
+		return common.Address{}, ErrUnauthorized
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.pruned) >= time.Minute {
+		for nonce, expiry := range s.nonces {
+			if !expiry.After(now) {
+				if err := s.store.Delete(nonceKey(nonce)); err != nil {
+					return common.Address{}, fmt.Errorf("delete nonce: %w", err)
+				}
+				delete(s.nonces, nonce)
+			}
+		}
+		s.pruned = now
+	}
+	if _, ok := s.nonces[t.Nonce]; ok {
+		return common.Address{}, ErrUnauthorized
+	}
+	if err := s.store.Put(nonceKey(t.Nonce), t.Expiry.Unix()); err != nil {
+		return common.Address{}, fmt.Errorf("put nonce: %w", err)
+	}
+	s.nonces[t.Nonce] = t.Expiry
+	return t.Owner, nil
+}
+
+// Add queues a new pin request of the owner.
+func (s *Service) Add(owner common.Address, pin Pin) (*PinStatus, error) {
+	s.mu.Lock()
+	r, err := s.add(owner, pin, 0)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.trigger()
+	return s.withDelegates(r.Status), nil
+}
+
+// add stores a new pin request of the owner, the replaced requests are not
+// counted against the quota. It must be called with the lock held.
+func (s *Service) add(owner common.Address, pin Pin, replaced int) (record, error) {
+	if pin.Reference.IsZero() {
+		return record{}, ErrInvalidPin
+	}
+	if s.options.Quota > 0 && s.counts[owner]-replaced >= s.options.Quota {
+		return record{}, ErrQuotaExceeded
+	}
+	id, err := newRequestID()
+	if err != nil {
+		return record{}, err
+	}
+
+	r := record{
+		Owner: owner,
+		Status: PinStatus{
+			RequestID: id,
+			Status:    StatusQueued,
+			Created:   s.timeNow().UTC(),
+			Pin:       pin,
+		},
+	}
+	key := requestKey(owner, id)
+	if err := s.store.Put(key, r); err != nil {
+		return record{}, fmt.Errorf("put pin request: %w", err)
+	}
+	s.index(r)
+	s.queue = append(s.queue, key)
+	return r, nil
+}
+
+// Get returns the pin request of the owner with the id.
+func (s *Service) Get(owner common.Address, id string) (*PinStatus, error) {
+	r, err := s.get(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.withDelegates(r.Status), nil
+}
+
+// List returns the number of the pin requests of the owner matching
+// the filter and the most recent of them up to the limit of the filter.
+func (s *Service) List(owner common.Address, f Filter) (int, []PinStatus, error) {
+	var matched []PinStatus
+	err := s.store.Iterate(requestKey(owner, ""), func(_, val []byte) (bool, error) {
+		var r record
+		if err := json.Unmarshal(val, &r); err != nil {
+			return true, fmt.Errorf("invalid pin request %q: %w", string(val), err)
+		}
+		if f.match(r.Status) {
+			matched = append(matched, r.Status)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("iterate pin requests: %w", err)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Created.After(matched[j].Created)
+	})
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+	results := matched
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	for i := range results {
+		results[i] = *s.withDelegates(results[i])
+	}
+	return len(matched), results, nil
+}
+
+// Replace replaces the pin request of the owner with a new one.
+func (s *Service) Replace(ctx context.Context, owner common.Address, id string, pin Pin) (*PinStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, err := s.get(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.add(owner, pin, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.remove(ctx, old); err != nil {
+		return nil, err
+	}
+
+	s.trigger()
+	return s.withDelegates(r.Status), nil
+}
+
+// Remove removes the pin request of the owner and unpins its content
+// if the service pinned it and no other request refers to it.
+func (s *Service) Remove(ctx context.Context, owner common.Address, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.get(owner, id)
+	if err != nil {
+		return err
+	}
+	return s.remove(ctx, r)
+}
+
+// get returns the stored pin request of the owner with the id.
+func (s *Service) get(owner common.Address, id string) (record, error) {
+	var r record
+	switch err := s.store.Get(requestKey(owner, id), &r); {
+	case errors.Is(err, storage.ErrNotFound):
+		return record{}, ErrNotFound
+	case err != nil:
+		return record{}, fmt.Errorf("get pin request: %w", err)
+	}
+	return r, nil
+}
+
+// remove deletes the pin request and releases its reference.
+// It must be called with the lock held.
+func (s *Service) remove(ctx context.Context, r record) error {
+	if err := s.store.Delete(requestKey(r.Owner, r.Status.RequestID)); err != nil {
+		return fmt.Errorf("delete pin request: %w", err)
+	}
+	s.unindex(r)
+	return s.release(ctx, r.Status.Pin.Reference)
+}
+
+// release unpins the reference if the service pinned it and
+// no request refers to it. It must be called with the lock held.
+func (s *Service) release(ctx context.Context, ref penguin.Address) error {
+	if s.refs[ref.ByteString()] > 0 {
+		return nil
+	}
+	if err := s.store.Get(pinnedKey(ref), new(bool)); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("get pinned reference: %w", err)
+	}
+
+	if err := s.pinning.DeletePin(ctx, ref); err != nil {
+		return fmt.Errorf("unpin %s: %w", ref, err)
+	}
+	if err := s.store.Delete(pinnedKey(ref)); err != nil {
+		return fmt.Errorf("delete pinned reference: %w", err)
+	}
+	return nil
+}
+
+// Close stops pinning, the interrupted request is resumed on restart.
+func (s *Service) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Service) trigger() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Service) worker() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.wake:
+		case <-s.ctx.Done():
+			return
+		}
+
+		for {
+			key, r, err := s.next()
+			if err != nil {
+				s.logger.Errorf("remote pinning: next pin request: %v", err)
+				break
+			}
+			if key == "" {
+				break
+			}
+			s.pin(key, r)
+			if s.ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// next returns the oldest pending pin request or an empty key if there is none.
+func (s *Service) next() (string, record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.queue) > 0 {
+		key := s.queue[0]
+		var r record
+		switch err := s.store.Get(key, &r); {
+		case errors.Is(err, storage.ErrNotFound):
+			// removed while queued
+		case err != nil:
+			return "", record{}, fmt.Errorf("get pin request: %w", err)
+		}
+		s.queue = s.queue[1:]
+		if r.Status.Status == StatusQueued || r.Status.Status == StatusPinning {
+			return key, r, nil
+		}
+	}
+	return "", record{}, nil
+}
+
+// pin retrieves and pins the content of the pin request.
+func (s *Service) pin(key string, r record) {
+	ref := r.Status.Pin.Reference
+	if !s.update(key, func(st *PinStatus) { st.Status = StatusPinning }) {
+		return
+	}
+
+	had, err := s.pinning.HasPin(ref)
+	if err == nil {
+		err = s.pinning.CreatePin(s.ctx, ref, true)
+	}
+	if s.ctx.Err() != nil {
+		// resumed on restart
+		return
+	}
+	if err == nil && !had {
+		s.mu.Lock()
+		err = s.store.Put(pinnedKey(ref), true)
+		s.mu.Unlock()
+		if err == nil && r.Status.Pin.Name != "" {
+			err = s.pinning.SetPinName(ref, r.Status.Pin.Name)
+		}
+	}
+	if err != nil {
+		s.logger.Debugf("remote pinning: pin %s of request %s: %v", ref, r.Status.RequestID, err)
+		s.update(key, func(st *PinStatus) {
+			st.Status = StatusFailed
+			st.Info = map[string]string{"error": err.Error()}
+		})
+		return
+	}
+
+	if !s.update(key, func(st *PinStatus) { st.Status = StatusPinned }) {
+		// the request was removed while pinning
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.release(s.ctx, ref); err != nil {
+			s.logger.Errorf("remote pinning: release %s: %v", ref, err)
+		}
+	}
+}
+
+// update updates the status of the stored pin request and reports
+// whether the request still exists.
+func (s *Service) update(key string, f func(*PinStatus)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var r record
+	if err := s.store.Get(key, &r); err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Errorf("remote pinning: get pin request: %v", err)
+		}
+		return false
+	}
+	f(&r.Status)
+	if err := s.store.Put(key, r); err != nil {
+		s.logger.Errorf("remote pinning: put pin request: %v", err)
+	}
+	return true
+}
+
+func (s *Service) withDelegates(st PinStatus) *PinStatus {
+	st.Delegates = nil
+	if s.options.Delegates != nil {
+		st.Delegates = s.options.Delegates()
+	}
+	if st.Delegates == nil {
+		st.Delegates = []string{}
+	}
+	return &st
+}
+
+func requestKey(owner common.Address, id string) string {
+	return requestPrefix + strings.ToLower(owner.Hex()) + "_" + id
+}
+
+func pinnedKey(ref penguin.Address) string {
+	return pinnedPrefix + ref.String()
+}
+
+func nonceKey(nonce string) string {
+	return noncePrefix + nonce
+}
+
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,396 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/crypto"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/pinning"
+	pinningmock "github.com/penguintop/penguin/pkg/pinning/mock"
+	"github.com/penguintop/penguin/pkg/pinning/remote"
+	statestore "github.com/penguintop/penguin/pkg/statestore/mock"
+	"github.com/penguintop/penguin/pkg/storage"
+)
+
+var (
+	ref      = penguin.MustParseHexAddress("838d0a193ecd1152d1bb1432d5ecc02398533b2494889e23b8bd5ace30ac2aeb")
+	ownerA   = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	ownerB   = common.HexToAddress("0x2222222222222222222222222222222222222222")
+	statuses = []remote.Status{remote.StatusQueued, remote.StatusPinning, remote.StatusPinned, remote.StatusFailed}
+)
+
+func newSigner(t *testing.T) crypto.Signer {
+	t.Helper()
+
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crypto.NewDefaultSigner(key)
+}
+
+// waitStatus waits for the pin request to reach the status.
+func waitStatus(t *testing.T, s *remote.Service, owner common.Address, id string, want remote.Status) *remote.PinStatus {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, err := s.Get(owner, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Status == want {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got status %q, want %q", st.Status, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newService(t *testing.T, p pinning.Interface, store storage.StateStorer, o remote.Options) *remote.Service {
+	t.Helper()
+
+	s, err := remote.New(p, store, logging.New(ioutil.Discard, 0), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestToken(t *testing.T) {
+	signer := newSigner(t)
+	owner, err := signer.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		now     = time.Now()
+		overlay = penguin.MustParseHexAddress("ca1e9f3938cc1425c6061b96ad9eb93e134dfe8734ad490164ef20af9d1cf59c")
+		other   = penguin.MustParseHexAddress("0c1e9f3938cc1425c6061b96ad9eb93e134dfe8734ad490164ef20af9d1cf59c")
+	)
+
+	token, err := remote.NewToken(signer, overlay, ref, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := remote.ParseToken(token, overlay, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Owner != owner || !got.Reference.Equal(ref) {
+		t.Fatalf("got token %+v, want owner %s and reference %s", got, owner, ref)
+	}
+
+	if _, err := remote.ParseToken(token, overlay, now.Add(2*time.Minute)); !errors.Is(err, remote.ErrUnauthorized) {
+		t.Fatalf("got error %v for an expired token, want %v", err, remote.ErrUnauthorized)
+	}
+	longer, err := remote.NewToken(signer, overlay, ref, now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the expiry is covered by the signature
+	if got, _ := remote.ParseToken(longer[:16]+token[16:], overlay, now); got != nil && got.Owner == owner {
+		t.Fatal("token with a changed expiry authenticates the owner")
+	}
+	// the reference is covered by the signature
+	if got, _ := remote.ParseToken(token[:len(token)-2]+"00", overlay, now); got != nil && got.Owner == owner {
+		t.Fatal("token with a changed reference authenticates the owner")
+	}
+	// the token is signed for the node
+	if got, _ := remote.ParseToken(token, other, now); got != nil && got.Owner == owner {
+		t.Fatal("token authenticates the owner at another node")
+	}
+	lasting, err := remote.NewToken(signer, overlay, ref, now.Add(remote.MaxTokenLifetime+time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.ParseToken(lasting, overlay, now); !errors.Is(err, remote.ErrUnauthorized) {
+		t.Fatalf("got error %v for a token exceeding the lifetime, want %v", err, remote.ErrUnauthorized)
+	}
+	if _, err := remote.ParseToken("invalid", overlay, now); !errors.Is(err, remote.ErrUnauthorized) {
+		t.Fatalf("got error %v for an invalid token, want %v", err, remote.ErrUnauthorized)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	signer := newSigner(t)
+	owner, err := signer.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		now     = time.Now()
+		overlay = penguin.MustParseHexAddress("ca1e9f3938cc1425c6061b96ad9eb93e134dfe8734ad490164ef20af9d1cf59c")
+		store   = statestore.NewStateStore()
+	)
+	newToken := func(ref penguin.Address) string {
+		t.Helper()
+
+		token, err := remote.NewToken(signer, overlay, ref, now.Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	// no owner is allowed by default
+	s := newService(t, pinningmock.NewServiceMock(), store, remote.Options{Overlay: overlay})
+	s.SetTimeNow(func() time.Time { return now })
+	if _, err := s.Authenticate(newToken(penguin.ZeroAddress), penguin.ZeroAddress); !errors.Is(err, remote.ErrUnauthorized) {
+		t.Fatalf("got error %v without allowed owners, want %v", err, remote.ErrUnauthorized)
+	}
+
+	s = newService(t, pinningmock.NewServiceMock(), store, remote.Options{Overlay: overlay, Owners: []common.Address{ownerA}})
+	s.SetTimeNow(func() time.Time { return now })
+	if _, err := s.Authenticate(newToken(penguin.ZeroAddress), penguin.ZeroAddress); !errors.Is(err, remote.ErrUnauthorized) {
+		t.Fatalf("got error %v for an owner not allowed, want %v", err, remote.ErrUnauthorized)
+	}
+
+	s = newService(t, pinningmock.NewServiceMock(), store, remote.Options{Overlay: overlay, Owners: []common.Address{owner}})
+	s.SetTimeNow(func() time.Time { return now })
+	token := newToken(ref)
+	if _, err := s.Authenticate(token, penguin.ZeroAddress); !errors.Is(err, remote.ErrUnauthorized) {
+		t.Fatalf("got error %v for a token of another reference, want %v", err, remote.ErrUnauthorized)
+	}
+	got, err := s.Authenticate(token, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != owner {
+		t.Fatalf("got owner %s, want %s", got, owner)
+	}
+	if _, err := s.Authenticate(token, ref); !errors.Is(err, remote.ErrUnauthorized) {
+		t.Fatalf("got error %v for a replayed token, want %v", err, remote.ErrUnauthorized)
+	}
+
+	// the nonces are kept on restart until the tokens expire
+	s = newService(t, pinningmock.NewServiceMock(), store, remote.Options{Overlay: overlay, Owners: []common.Address{owner}})
+	s.SetTimeNow(func() time.Time { return now })
+	if _, err := s.Authenticate(token, ref); !errors.Is(err, remote.ErrUnauthorized) {
+		t.Fatalf("got error %v for a token replayed after restart, want %v", err, remote.ErrUnauthorized)
+	}
+}
+
+func TestService(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		pinning = pinningmock.NewServiceMock()
+		s       = newService(t, pinning, statestore.NewStateStore(), remote.Options{
+			Delegates: func() []string { return []string{"/ip4/127.0.0.1/tcp/1634"} },
+		})
+	)
+
+	if _, err := s.Add(ownerA, remote.Pin{}); !errors.Is(err, remote.ErrInvalidPin) {
+		t.Fatalf("got error %v, want %v", err, remote.ErrInvalidPin)
+	}
+
+	st, err := s.Add(ownerA, remote.Pin{Reference: ref, Name: "site"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.RequestID == "" || st.Created.IsZero() || len(st.Delegates) != 1 {
+		t.Fatalf("got pin status %+v", st)
+	}
+	waitStatus(t, s, ownerA, st.RequestID, remote.StatusPinned)
+
+	pin, err := pinning.GetPin(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Name != "site" {
+		t.Fatalf("got pin name %q, want site", pin.Name)
+	}
+
+	// the requests of an owner are not visible to the others
+	if _, err := s.Get(ownerB, st.RequestID); !errors.Is(err, remote.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, remote.ErrNotFound)
+	}
+	if count, _, err := s.List(ownerB, remote.Filter{Statuses: statuses}); err != nil || count != 0 {
+		t.Fatalf("got %d pins of other owner, error %v", count, err)
+	}
+
+	count, results, err := s.List(ownerA, remote.Filter{References: []penguin.Address{ref}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || len(results) != 1 || results[0].RequestID != st.RequestID {
+		t.Fatalf("got %d pins %+v, want the request %s", count, results, st.RequestID)
+	}
+	if count, _, err := s.List(ownerA, remote.Filter{Statuses: []remote.Status{remote.StatusQueued}}); err != nil || count != 0 {
+		t.Fatalf("got %d queued pins, error %v", count, err)
+	}
+
+	if err := s.Remove(ctx, ownerB, st.RequestID); !errors.Is(err, remote.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, remote.ErrNotFound)
+	}
+	if err := s.Remove(ctx, ownerA, st.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := pinning.HasPin(ref); has {
+		t.Fatal("reference pinned after the removal of the request")
+	}
+}
+
+func TestServiceSharedPins(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		pinning = pinningmock.NewServiceMock()
+		s       = newService(t, pinning, statestore.NewStateStore(), remote.Options{})
+		local   = penguin.MustParseHexAddress("01")
+	)
+
+	a, err := s.Add(ownerA, remote.Pin{Reference: ref})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.Add(ownerB, remote.Pin{Reference: ref})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, s, ownerA, a.RequestID, remote.StatusPinned)
+	waitStatus(t, s, ownerB, b.RequestID, remote.StatusPinned)
+
+	if err := s.Remove(ctx, ownerA, a.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := pinning.HasPin(ref); !has {
+		t.Fatal("reference unpinned while requested by another owner")
+	}
+	if err := s.Remove(ctx, ownerB, b.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := pinning.HasPin(ref); has {
+		t.Fatal("reference pinned after the removal of all requests")
+	}
+
+	// pins of the node are kept
+	if err := pinning.CreatePin(ctx, local, false); err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.Add(ownerA, remote.Pin{Reference: local})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, s, ownerA, c.RequestID, remote.StatusPinned)
+	if err := s.Remove(ctx, ownerA, c.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := pinning.HasPin(local); !has {
+		t.Fatal("pin of the node removed with the request")
+	}
+}
+
+// failingPinning fails to pin any reference.
+type failingPinning struct {
+	*pinningmock.ServiceMock
+}
+
+func (failingPinning) CreatePin(context.Context, penguin.Address, bool) error {
+	return storage.ErrNotFound
+}
+
+func TestServiceFailedPin(t *testing.T) {
+	s := newService(t, failingPinning{pinningmock.NewServiceMock()}, statestore.NewStateStore(), remote.Options{})
+
+	st, err := s.Add(ownerA, remote.Pin{Reference: ref})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st = waitStatus(t, s, ownerA, st.RequestID, remote.StatusFailed)
+	if st.Info["error"] == "" {
+		t.Fatal("failed pin status without the error")
+	}
+
+	replaced, err := s.Replace(context.Background(), ownerA, st.RequestID, remote.Pin{Reference: ref, Name: "retry"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced.RequestID == st.RequestID || replaced.Pin.Name != "retry" {
+		t.Fatalf("got replaced pin status %+v", replaced)
+	}
+	if _, err := s.Get(ownerA, st.RequestID); !errors.Is(err, remote.ErrNotFound) {
+		t.Fatalf("got error %v for the replaced request, want %v", err, remote.ErrNotFound)
+	}
+}
+
+func TestServiceQuota(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		other = penguin.MustParseHexAddress("01")
+		s     = newService(t, pinningmock.NewServiceMock(), statestore.NewStateStore(), remote.Options{Quota: 1})
+	)
+
+	a, err := s.Add(ownerA, remote.Pin{Reference: ref})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(ownerA, remote.Pin{Reference: other}); !errors.Is(err, remote.ErrQuotaExceeded) {
+		t.Fatalf("got error %v, want %v", err, remote.ErrQuotaExceeded)
+	}
+	// the quota is per owner
+	if _, err := s.Add(ownerB, remote.Pin{Reference: other}); err != nil {
+		t.Fatal(err)
+	}
+	// the replaced request is not counted
+	b, err := s.Replace(ctx, ownerA, a.RequestID, remote.Pin{Reference: other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(ctx, ownerA, b.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(ownerA, remote.Pin{Reference: ref}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServiceResume(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		pinning = pinningmock.NewServiceMock()
+		store   = statestore.NewStateStore()
+		s       = newService(t, failingPinning{pinning}, store, remote.Options{})
+	)
+
+	a, err := s.Add(ownerA, remote.Pin{Reference: ref})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, s, ownerA, a.RequestID, remote.StatusFailed)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the restarted service indexes the stored requests
+	s = newService(t, pinning, store, remote.Options{})
+	b, err := s.Add(ownerB, remote.Pin{Reference: ref})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, s, ownerB, b.RequestID, remote.StatusPinned)
+	if err := s.Remove(ctx, ownerB, b.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := pinning.HasPin(ref); !has {
+		t.Fatal("reference unpinned while requested by another owner")
+	}
+	if err := s.Remove(ctx, ownerA, a.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := pinning.HasPin(ref); has {
+		t.Fatal("reference pinned after the removal of all requests")
+	}
+}
@@ -14,6 +14,9 @@ import (
 // ChainStateKey is the statestore key for the chain state.
 const StateKey = chainStateKey
 
+// ReserveStateKey is the statestore key for the reserve state.
+const ReserveStateKey = reserveStateKey
+
 // BatchKey returns the index key for the batch ID used in the by-ID batch index.
 var BatchKey = batchKey
 
@@ -42,7 +42,7 @@ var ErrBatchNotFound = errors.New("postage batch not found or expired")
 // DefaultDepth is the initial depth for the reserve
 var DefaultDepth = uint8(12) // 12 is the testnet depth at the time of merging to master
 
-// Capacity is the number of chunks in reserve. `2^22` (4194304) was chosen to remain
+// Capacity is the default number of chunks in reserve. `2^22` (4194304) was chosen to remain
 // relatively near the current 5M chunks ~25GB.
 var Capacity = exp2(22)
 
@@ -58,6 +58,8 @@ type reserveState struct {
 	Available int64    `json:"available"`
 	Outer     *big.Int `json:"outer"` // lower value limit for outer layer = the further half of chunks
 	Inner     *big.Int `json:"inner"` // lower value limit for inner layer = the closer half of chunks
+	// Capacity is the number of chunks the reserve was sized for.
+	Capacity int64 `json:"capacity,omitempty"`
 }
 
 // unreserve is called when the batchstore decides not to reserve a batch on a PO
@@ -257,6 +259,12 @@ func (s *store) update(b *postage.Batch, oldDepth uint8, oldValue *big.Int) erro
 	if err != nil {
 		return err
 	}
+	// persisted also without evictions for the
+	// reserve to be resized on a capacity change
+	err = s.store.Put(reserveStateKey, s.rs)
+	if err != nil {
+		return err
+	}
 
 	s.metrics.AvailableCapacity.Set(float64(s.rs.Available))
 	s.metrics.Radius.Set(float64(s.rs.Radius))
@@ -265,7 +273,8 @@ func (s *store) update(b *postage.Batch, oldDepth uint8, oldValue *big.Int) erro
 	return nil
 }
 
-// evictOuter is responsible for keeping capacity positive by unreserving lowest priority batches
+// evictOuter is responsible for keeping capacity positive by unreserving lowest priority batches.
+// last is the batch that caused the eviction, if any.
 func (s *store) evictOuter(last *postage.Batch) error {
 	// if capacity is positive nothing to evict
 	if s.rs.Available >= 0 {
@@ -274,7 +283,7 @@ func (s *store) evictOuter(last *postage.Batch) error {
 	err := s.store.Iterate(valueKeyPrefix, func(key, _ []byte) (bool, error) {
 		batchID := valueKeyToID(key)
 		b := last
-		if !bytes.Equal(b.ID, batchID) {
+		if b == nil || !bytes.Equal(b.ID, batchID) {
 			var err error
 			b, err = s.Get(batchID)
 			if err != nil {
@@ -19,6 +19,7 @@ import (
 	"github.com/penguintop/penguin/pkg/postage/batchstore"
 	postagetest "github.com/penguintop/penguin/pkg/postage/testing"
 	"github.com/penguintop/penguin/pkg/statestore/leveldb"
+	"github.com/penguintop/penguin/pkg/statestore/mock"
 	"github.com/penguintop/penguin/pkg/storage"
     "github.com/penguintop/penguin/pkg/penguin"
 )
@@ -214,7 +215,7 @@ func setupBatchStore(t *testing.T) (postage.Storer, map[string]uint8) {
 		unreserved[hex.EncodeToString(batchID)] = radius
 		return nil
 	}
-	bStore, _ := batchstore.New(stateStore, unreserveFunc)
+	bStore, _ := batchstore.New(stateStore, unreserveFunc, 0)
 	bStore.SetRadiusSetter(noopRadiusSetter{})
 
 	// initialise chainstate
@@ -845,6 +846,58 @@ func TestBatchStore_EvictExpired(t *testing.T) {
 	}
 }
 
+// TestBatchStore_ReserveCapacity tests that the configured reserve
+// capacity sets the radius, also when a node is restarted with a
+// different capacity.
+func TestBatchStore_ReserveCapacity(t *testing.T) {
+	defer func(d uint8) {
+		batchstore.DefaultDepth = d
+	}(batchstore.DefaultDepth)
+	batchstore.DefaultDepth = 5
+	initBatchDepth := uint8(8)
+
+	newStore := func(st storage.StateStorer, capacity int64) postage.Storer {
+		t.Helper()
+		s, err := batchstore.New(st, func([]byte, uint8) error { return nil }, capacity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.SetRadiusSetter(noopRadiusSetter{})
+		return s
+	}
+	radius := func(capacity int64) uint8 {
+		t.Helper()
+		s := newStore(mock.NewStateStore(), capacity)
+		addBatch(t, s,
+			depthValue(initBatchDepth, 2),
+			depthValue(initBatchDepth, 3),
+			depthValue(initBatchDepth, 4),
+			depthValue(initBatchDepth, 5),
+		)
+		return s.GetReserveState().Radius
+	}
+
+	small, large := radius(batchstore.Exp2(3)), radius(batchstore.Exp2(7))
+	if small <= large {
+		t.Fatalf("got radius %d with the smaller reserve, want more than %d", small, large)
+	}
+
+	st := mock.NewStateStore()
+	s := newStore(st, batchstore.Exp2(7))
+	addBatch(t, s,
+		depthValue(initBatchDepth, 2),
+		depthValue(initBatchDepth, 3),
+		depthValue(initBatchDepth, 4),
+		depthValue(initBatchDepth, 5),
+	)
+	if got := s.GetReserveState().Radius; got != large {
+		t.Fatalf("got radius %d, want %d", got, large)
+	}
+	if got := newStore(st, batchstore.Exp2(3)).GetReserveState().Radius; got != small {
+		t.Fatalf("got radius %d after shrinking the reserve, want %d", got, small)
+	}
+}
+
 type depthValueTuple struct {
 	depth uint8
 	value int
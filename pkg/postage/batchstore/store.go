@@ -30,14 +30,20 @@ type store struct {
 	cs            *postage.ChainState // the chain state
 	rs            *reserveState       // the reserve state
 	unreserveFunc unreserveFn         // unreserve function
+	capacity      int64               // number of chunks in the reserve
 	metrics       metrics             // metrics
 
 	radiusSetter postage.RadiusSetter // setter for radius notifications
 }
 
 // New constructs a new postage batch store.
-// It initialises both chain state and reserve state from the persistent state store
-func New(st storage.StateStorer, unreserveFunc unreserveFn) (postage.Storer, error) {
+// It initialises both chain state and reserve state from the persistent state store.
+// The reserve holds capacity chunks, if capacity is not positive the default
+// Capacity is used.
+func New(st storage.StateStorer, unreserveFunc unreserveFn, capacity int64) (postage.Storer, error) {
+	if capacity <= 0 {
+		capacity = Capacity
+	}
 	cs := &postage.ChainState{}
 	err := st.Get(chainStateKey, cs)
 	if err != nil {
@@ -60,7 +66,8 @@ func New(st storage.StateStorer, unreserveFunc unreserveFn) (postage.Storer, err
 			Radius:    DefaultDepth,
 			Inner:     big.NewInt(0),
 			Outer:     big.NewInt(0),
-			Available: Capacity,
+			Available: capacity,
+			Capacity:  capacity,
 		}
 	}
 	s := &store{
@@ -68,12 +75,36 @@ func New(st storage.StateStorer, unreserveFunc unreserveFn) (postage.Storer, err
 		cs:            cs,
 		rs:            rs,
 		unreserveFunc: unreserveFunc,
+		capacity:      capacity,
 		metrics:       newMetrics(),
 	}
+	if err := s.resize(); err != nil {
+		return nil, err
+	}
 
 	return s, nil
 }
 
+// resize adjusts the available capacity of a persisted reserve state to
+// the configured capacity. States persisted before the capacity was
+// recorded were sized with the default Capacity.
+func (s *store) resize() error {
+	old := s.rs.Capacity
+	if old == 0 {
+		old = Capacity
+	}
+	if old == s.capacity && s.rs.Capacity != 0 {
+		return nil
+	}
+	s.rs.Available += s.capacity - old
+	s.rs.Capacity = s.capacity
+	if s.rs.Available < 0 {
+		// shrinking the reserve unreserves the lowest priority batches
+		return s.evictOuter(nil)
+	}
+	return s.store.Put(reserveStateKey, s.rs)
+}
+
 func (s *store) GetReserveState() *postage.ReserveState {
 	return &postage.ReserveState{
 		Radius:    s.rs.Radius,
@@ -187,7 +218,8 @@ func (s *store) Reset() error {
 		Radius:    DefaultDepth,
 		Inner:     big.NewInt(0),
 		Outer:     big.NewInt(0),
-		Available: Capacity,
+		Available: s.capacity,
+		Capacity:  s.capacity,
 	}
 	return nil
 }
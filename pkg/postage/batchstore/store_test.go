@@ -7,6 +7,7 @@ package batchstore_test
 import (
 	"io/ioutil"
 	"math/big"
+	"os"
 	"testing"
 
 	"github.com/penguintop/penguin/pkg/logging"
@@ -24,7 +25,7 @@ func TestBatchStoreGet(t *testing.T) {
 	key := batchstore.BatchKey(testBatch.ID)
 
 	stateStore := mock.NewStateStore()
-	batchStore, _ := batchstore.New(stateStore, nil)
+	batchStore, _ := batchstore.New(stateStore, nil, 0)
 
 	stateStorePut(t, stateStore, key, testBatch)
 	got := batchStoreGetBatch(t, batchStore, testBatch.ID)
@@ -36,7 +37,7 @@ func TestBatchStorePut(t *testing.T) {
 	key := batchstore.BatchKey(testBatch.ID)
 
 	stateStore := mock.NewStateStore()
-	batchStore, _ := batchstore.New(stateStore, unreserve)
+	batchStore, _ := batchstore.New(stateStore, unreserve, 0)
 	batchStore.SetRadiusSetter(noopRadiusSetter{})
 	batchStorePutBatch(t, batchStore, testBatch)
 
@@ -49,7 +50,7 @@ func TestBatchStoreGetChainState(t *testing.T) {
 	testChainState := postagetest.NewChainState()
 
 	stateStore := mock.NewStateStore()
-	batchStore, _ := batchstore.New(stateStore, nil)
+	batchStore, _ := batchstore.New(stateStore, nil, 0)
 	batchStore.SetRadiusSetter(noopRadiusSetter{})
 
 	err := batchStore.PutChainState(testChainState)
@@ -64,7 +65,7 @@ func TestBatchStorePutChainState(t *testing.T) {
 	testChainState := postagetest.NewChainState()
 
 	stateStore := mock.NewStateStore()
-	batchStore, _ := batchstore.New(stateStore, nil)
+	batchStore, _ := batchstore.New(stateStore, nil, 0)
 	batchStore.SetRadiusSetter(noopRadiusSetter{})
 
 	batchStorePutChainState(t, batchStore, testChainState)
@@ -73,11 +74,52 @@ func TestBatchStorePutChainState(t *testing.T) {
 	postagetest.CompareChainState(t, testChainState, &got)
 }
 
+func TestBatchStoreCapacity(t *testing.T) {
+	stateStore := mock.NewStateStore()
+
+	batchStore, err := batchstore.New(stateStore, nil, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := batchStore.GetReserveState().Available; got != 1000 {
+		t.Fatalf("got available %d, want 1000", got)
+	}
+
+	// a reserve state persisted without capacity was sized with the default
+	stateStorePut(t, stateStore, batchstore.ReserveStateKey, map[string]interface{}{
+		"radius":    batchstore.DefaultDepth,
+		"available": batchstore.Capacity - 10,
+		"outer":     big.NewInt(0),
+		"inner":     big.NewInt(0),
+	})
+	for _, tc := range []struct {
+		capacity  int64
+		available int64
+	}{
+		{capacity: batchstore.Capacity + 100, available: batchstore.Capacity + 90},
+		{capacity: batchstore.Capacity + 100, available: batchstore.Capacity + 90},
+		{capacity: 50, available: 40},
+		{capacity: 0, available: batchstore.Capacity - 10},
+	} {
+		batchStore, err := batchstore.New(stateStore, nil, tc.capacity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := batchStore.GetReserveState().Available; got != tc.available {
+			t.Fatalf("capacity %d: got available %d, want %d", tc.capacity, got, tc.available)
+		}
+	}
+}
+
 func TestBatchStoreReset(t *testing.T) {
 	testChainState := postagetest.NewChainState()
 	testBatch := postagetest.MustNewBatch()
 
-	path := "./"
+	path, err := ioutil.TempDir("", "statestore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
 	logger := logging.New(ioutil.Discard, 0)
 
 	// we use the real statestore since the mock uses a mutex,
@@ -89,7 +131,7 @@ func TestBatchStoreReset(t *testing.T) {
 	}
 	defer stateStore.Close()
 
-	batchStore, _ := batchstore.New(stateStore, func([]byte, uint8) error { return nil })
+	batchStore, _ := batchstore.New(stateStore, func([]byte, uint8) error { return nil }, 0)
 	batchStore.SetRadiusSetter(noopRadiusSetter{})
 	err = batchStore.Put(testBatch, big.NewInt(15), 8)
 	if err != nil {
@@ -0,0 +1,226 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pricer
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+)
+
+// Weights of the load signals in the price factor of the DynamicPricer.
+const (
+	inFlightWeight  = 0.5
+	demandWeight    = 0.3
+	cacheMissWeight = 0.2
+)
+
+// PriceTableAnnouncer announces our price table to the connected peers. It
+// is implemented by the pricing service.
+type PriceTableAnnouncer interface {
+	AnnouncePriceTable(ctx context.Context, priceTable []uint64) error
+}
+
+// DynamicOptions configure the DynamicPricer.
+type DynamicOptions struct {
+	// Interval between the price adjustments.
+	Interval time.Duration
+	// Tolerance is the accepted deviation from the agreed price, in percent.
+	Tolerance uint64
+	// MaxFactor is the multiplier of the base price under full load.
+	MaxFactor float64
+	// Capacity is the number of requests served at the same time that is
+	// considered full load.
+	Capacity int64
+	// DemandCapacity is the number of requests from peers in an interval
+	// that is considered full demand.
+	DemandCapacity int64
+	// AnnounceChange is the relative price change since the last
+	// announcement above which the new prices are announced to the peers.
+	AnnounceChange float64
+}
+
+// DynamicPricer is a Pricer that adjusts the prices of the chunks to the
+// local load: the number of requests served at the same time, the demand of
+// the peers and the ratio of the retrieved chunks not found in the local
+// store. The base price applies to an idle node, and it is multiplied up to
+// MaxFactor under full load.
+type DynamicPricer struct {
+	// accessed atomically, kept first for the 64-bit alignment
+	inFlight int64 // requests being served
+	requests int64 // requests in the current interval
+	hits     int64 // retrievals served from the local store in the current interval
+	misses   int64 // retrievals forwarded in the current interval
+
+	*peerPrices
+	logger    logging.Logger
+	announcer PriceTableAnnouncer
+	options   DynamicOptions
+
+	mu              sync.RWMutex
+	factor          float64
+	announcedFactor float64
+	table           []uint64
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// NewDynamicPricer returns a new DynamicPricer with a given base price.
+func NewDynamicPricer(overlay penguin.Address, poPrice uint64, logger logging.Logger, announcer PriceTableAnnouncer, o DynamicOptions) *DynamicPricer {
+	if o.MaxFactor < 1 {
+		o.MaxFactor = 1
+	}
+	pricer := &DynamicPricer{
+		logger:          logger,
+		announcer:       announcer,
+		options:         o,
+		factor:          1,
+		announcedFactor: 1,
+		table:           priceTable(poPrice, 1),
+		quit:            make(chan struct{}),
+	}
+	pricer.peerPrices = newPeerPrices(overlay, poPrice, o.Tolerance, o.MaxFactor, pricer.Price)
+	return pricer
+}
+
+// Start starts the periodic price adjustments.
+func (pricer *DynamicPricer) Start() {
+	pricer.wg.Add(1)
+	go func() {
+		defer pricer.wg.Done()
+
+		ticker := time.NewTicker(pricer.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pricer.quit:
+				return
+			case <-ticker.C:
+			}
+			pricer.Adjust()
+		}
+	}()
+}
+
+// Adjust recomputes the prices from the load in the last interval and
+// announces them to the peers if they changed significantly.
+func (pricer *DynamicPricer) Adjust() {
+	requests := atomic.SwapInt64(&pricer.requests, 0)
+	hits := atomic.SwapInt64(&pricer.hits, 0)
+	misses := atomic.SwapInt64(&pricer.misses, 0)
+	inFlight := atomic.LoadInt64(&pricer.inFlight)
+
+	load := inFlightWeight*ratio(inFlight, pricer.options.Capacity) +
+		demandWeight*ratio(requests, pricer.options.DemandCapacity) +
+		cacheMissWeight*ratio(misses, hits+misses)
+	target := 1 + (pricer.options.MaxFactor-1)*load
+
+	pricer.mu.Lock()
+	// move halfway to the target to dampen short load peaks
+	pricer.factor = (pricer.factor + target) / 2
+	pricer.table = priceTable(pricer.poPrice, pricer.factor)
+	announce := math.Abs(pricer.factor-pricer.announcedFactor) > pricer.announcedFactor*pricer.options.AnnounceChange
+	if announce {
+		pricer.announcedFactor = pricer.factor
+	}
+	table := pricer.priceTable()
+	factor := pricer.factor
+	pricer.mu.Unlock()
+
+	if !announce || pricer.announcer == nil {
+		return
+	}
+	pricer.logger.Debugf("pricer: announcing prices with factor %.3f", factor)
+	if err := pricer.announcer.AnnouncePriceTable(context.Background(), table); err != nil {
+		pricer.logger.Debugf("pricer: announce price table: %v", err)
+	}
+}
+
+// Price implements Pricer.
+func (pricer *DynamicPricer) Price(chunk penguin.Address) uint64 {
+	po := penguin.Proximity(pricer.overlay.Bytes(), chunk.Bytes())
+
+	pricer.mu.RLock()
+	defer pricer.mu.RUnlock()
+	return pricer.table[po]
+}
+
+// PriceTable returns the prices we charge for each proximity order.
+func (pricer *DynamicPricer) PriceTable() []uint64 {
+	pricer.mu.RLock()
+	defer pricer.mu.RUnlock()
+	return pricer.priceTable()
+}
+
+func (pricer *DynamicPricer) priceTable() []uint64 {
+	table := make([]uint64, len(pricer.table))
+	copy(table, pricer.table)
+	return table
+}
+
+// Factor returns the current multiplier of the base price.
+func (pricer *DynamicPricer) Factor() float64 {
+	pricer.mu.RLock()
+	defer pricer.mu.RUnlock()
+	return pricer.factor
+}
+
+// NotifyRetrieval implements Pricer.
+func (pricer *DynamicPricer) NotifyRetrieval(peer penguin.Address, cached bool) func() {
+	if cached {
+		atomic.AddInt64(&pricer.hits, 1)
+	} else {
+		atomic.AddInt64(&pricer.misses, 1)
+	}
+	return pricer.request()
+}
+
+// NotifyPushSync implements Pricer.
+func (pricer *DynamicPricer) NotifyPushSync(peer penguin.Address) func() {
+	return pricer.request()
+}
+
+func (pricer *DynamicPricer) request() func() {
+	atomic.AddInt64(&pricer.requests, 1)
+	atomic.AddInt64(&pricer.inFlight, 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&pricer.inFlight, -1)
+		})
+	}
+}
+
+// MostExpensive returns the minimal payment threshold accepted from peers.
+// It is based on the base price, so that the payment thresholds accepted by
+// the nodes with fixed prices are accepted too.
+func (pricer *DynamicPricer) MostExpensive() *big.Int {
+	return mostExpensive(pricer.poPrice)
+}
+
+// Close stops the periodic price adjustments.
+func (pricer *DynamicPricer) Close() error {
+	close(pricer.quit)
+	pricer.wg.Wait()
+	return nil
+}
+
+// ratio returns n/capacity, limited to 1.
+func ratio(n, capacity int64) float64 {
+	if capacity <= 0 || n <= 0 {
+		return 0
+	}
+	if n >= capacity {
+		return 1
+	}
+	return float64(n) / float64(capacity)
+}
@@ -5,7 +5,8 @@
 package mock
 
 import (
-    "github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/p2p"
+	"github.com/penguintop/penguin/pkg/penguin"
 )
 
 type MockPricer struct {
@@ -27,3 +28,23 @@ func (pricer *MockPricer) PeerPrice(peer, chunk penguin.Address) uint64 {
 func (pricer *MockPricer) Price(chunk penguin.Address) uint64 {
 	return pricer.price
 }
+
+func (pricer *MockPricer) PriceHeadler(headers p2p.Headers, peer penguin.Address) p2p.Headers {
+	return nil
+}
+
+func (pricer *MockPricer) AgreedPeerPrice(peer, chunk penguin.Address, expectedPrice uint64, responseHeaders p2p.Headers) (uint64, error) {
+	return expectedPrice, nil
+}
+
+func (pricer *MockPricer) AgreedPrice(peer, chunk penguin.Address, headers, responseHeaders p2p.Headers) (uint64, error) {
+	return pricer.price, nil
+}
+
+func (pricer *MockPricer) NotifyRetrieval(peer penguin.Address, cached bool) func() {
+	return func() {}
+}
+
+func (pricer *MockPricer) NotifyPushSync(peer penguin.Address) func() {
+	return func() {}
+}
@@ -5,9 +5,38 @@
 package pricer
 
 import (
+	"errors"
 	"math/big"
+	"sync"
 
-    "github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/p2p"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/pricer/headerutils"
+)
+
+const (
+	// DefaultTolerance is the default deviation from the expected price, in
+	// percent, accepted when agreeing on a price with a peer.
+	DefaultTolerance = 10
+	// DefaultMaxFactor is the default multiplier of the base price under
+	// full load, and the highest multiplier of the base price accepted in
+	// the prices announced by the peers.
+	DefaultMaxFactor = 2
+)
+
+var (
+	// ErrPriceTooHigh is returned if the peer charges more than the expected
+	// price for a chunk.
+	ErrPriceTooHigh = errors.New("price too high")
+	// ErrPriceTooLow is returned if the peer offers less than our price for a
+	// chunk.
+	ErrPriceTooLow = errors.New("price too low")
+	// ErrWrongTarget is returned if the price headers are not for the
+	// requested chunk.
+	ErrWrongTarget = errors.New("wrong price target")
+	// ErrInvalidPriceTable is returned if the announced price table has more
+	// entries than the proximity orders or prices above the accepted maximum.
+	ErrInvalidPriceTable = errors.New("invalid price table")
 )
 
 // Pricer returns pricing information for chunk hashes.
@@ -16,34 +45,235 @@ type Interface interface {
 	PeerPrice(peer, chunk penguin.Address) uint64
 	// Price is the price we charge for a given chunk hash.
 	Price(chunk penguin.Address) uint64
+	// PriceHeadler responds to the price headers of a chunk request with the
+	// price we charge for the chunk.
+	PriceHeadler(headers p2p.Headers, peer penguin.Address) p2p.Headers
+	// AgreedPeerPrice returns the price the peer charges for the chunk as
+	// responded in the headers, if it does not exceed the expected price by
+	// more than the tolerance.
+	AgreedPeerPrice(peer, chunk penguin.Address, expectedPrice uint64, responseHeaders p2p.Headers) (uint64, error)
+	// AgreedPrice returns the price we charge the peer for the chunk, if the
+	// price offered in the request headers is not lower by more than the
+	// tolerance.
+	AgreedPrice(peer, chunk penguin.Address, headers, responseHeaders p2p.Headers) (uint64, error)
+	// NotifyRetrieval is called when the peer requests a chunk, cached is
+	// true if the chunk is served from the local store. The returned function
+	// is called when the request is served.
+	NotifyRetrieval(peer penguin.Address, cached bool) (done func())
+	// NotifyPushSync is called when the peer pushes a chunk. The returned
+	// function is called when the receipt is sent.
+	NotifyPushSync(peer penguin.Address) (done func())
 }
 
 // FixedPricer is a Pricer that has a fixed price for chunks.
 type FixedPricer struct {
-	overlay penguin.Address
-	poPrice uint64
+	*peerPrices
 }
 
 // NewFixedPricer returns a new FixedPricer with a given price.
 func NewFixedPricer(overlay penguin.Address, poPrice uint64) *FixedPricer {
-	return &FixedPricer{
-		overlay: overlay,
-		poPrice: poPrice,
-	}
-}
-
-// PeerPrice implements Pricer.
-func (pricer *FixedPricer) PeerPrice(peer, chunk penguin.Address) uint64 {
-	return uint64(penguin.MaxPO-penguin.Proximity(peer.Bytes(), chunk.Bytes())+1) * pricer.poPrice
+	pricer := &FixedPricer{}
+	pricer.peerPrices = newPeerPrices(overlay, poPrice, DefaultTolerance, DefaultMaxFactor, pricer.Price)
+	return pricer
 }
 
 // Price implements Pricer.
 func (pricer *FixedPricer) Price(chunk penguin.Address) uint64 {
-	return pricer.PeerPrice(pricer.overlay, chunk)
+	return poPrice(penguin.Proximity(pricer.overlay.Bytes(), chunk.Bytes()), pricer.poPrice)
+}
+
+// PriceTable returns the prices we charge for each proximity order.
+func (pricer *FixedPricer) PriceTable() []uint64 {
+	return priceTable(pricer.poPrice, 1)
+}
+
+// NotifyRetrieval implements Pricer.
+func (pricer *FixedPricer) NotifyRetrieval(peer penguin.Address, cached bool) func() {
+	return func() {}
+}
+
+// NotifyPushSync implements Pricer.
+func (pricer *FixedPricer) NotifyPushSync(peer penguin.Address) func() {
+	return func() {}
 }
 
 func (pricer *FixedPricer) MostExpensive() *big.Int {
-	poPrice := new(big.Int).SetUint64(pricer.poPrice)
+	return mostExpensive(pricer.poPrice)
+}
+
+// peerPrices keeps the prices announced by the peers and agrees on the
+// prices of the individual chunks through the stream headers.
+type peerPrices struct {
+	overlay   penguin.Address
+	poPrice   uint64
+	tolerance uint64
+	maxFactor float64 // highest accepted multiplier of the base price
+	price     func(chunk penguin.Address) uint64
+
+	mu     sync.RWMutex
+	tables map[string][]uint64
+}
+
+func newPeerPrices(overlay penguin.Address, poPrice, tolerance uint64, maxFactor float64, price func(chunk penguin.Address) uint64) *peerPrices {
+	return &peerPrices{
+		overlay:   overlay,
+		poPrice:   poPrice,
+		tolerance: tolerance,
+		maxFactor: maxFactor,
+		price:     price,
+		tables:    make(map[string][]uint64),
+	}
+}
+
+// PeerPrice implements Pricer. Peers that have not announced their prices
+// are expected to charge the base price.
+func (p *peerPrices) PeerPrice(peer, chunk penguin.Address) uint64 {
+	po := penguin.Proximity(peer.Bytes(), chunk.Bytes())
+
+	p.mu.RLock()
+	table := p.tables[peer.String()]
+	p.mu.RUnlock()
+
+	if int(po) < len(table) {
+		return table[po]
+	}
+	return poPrice(po, p.poPrice)
+}
+
+// maxPeerPrice returns the highest price accepted from the peers for chunks
+// at the proximity order.
+func (p *peerPrices) maxPeerPrice(po uint8) uint64 {
+	return uint64(float64(poPrice(po, p.poPrice)) * p.maxFactor)
+}
+
+// NotifyPriceTable sets the prices the peer charges for each proximity order.
+// Tables with prices above the accepted maximum are rejected.
+func (p *peerPrices) NotifyPriceTable(peer penguin.Address, priceTable []uint64) error {
+	if len(priceTable) > int(penguin.MaxPO)+1 {
+		return ErrInvalidPriceTable
+	}
+	for po, price := range priceTable {
+		if price > p.maxPeerPrice(uint8(po)) {
+			return ErrInvalidPriceTable
+		}
+	}
+	table := make([]uint64, len(priceTable))
+	copy(table, priceTable)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tables[peer.String()] = table
+	return nil
+}
+
+// NotifyPeerPrice sets the price the peer charges for chunks at the
+// proximity order index, if it does not exceed the accepted maximum.
+func (p *peerPrices) NotifyPeerPrice(peer penguin.Address, price uint64, index uint8) error {
+	if index > penguin.MaxPO {
+		return ErrInvalidPriceTable
+	}
+	if price > p.maxPeerPrice(index) {
+		return ErrPriceTooHigh
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	table := p.tables[peer.String()]
+	if int(index) >= len(table) {
+		extended := priceTable(p.poPrice, 1)
+		copy(extended, table)
+		table = extended
+		p.tables[peer.String()] = table
+	}
+	table[index] = price
+	return nil
+}
+
+// PriceHeadler implements Pricer.
+func (p *peerPrices) PriceHeadler(headers p2p.Headers, peer penguin.Address) p2p.Headers {
+	target, err := headerutils.ParseTargetHeader(headers)
+	if err != nil {
+		// the peer does not agree on prices
+		return nil
+	}
+	index := penguin.Proximity(p.overlay.Bytes(), target.Bytes())
+	responseHeaders, err := headerutils.MakePricingResponseHeaders(p.price(target), target, index)
+	if err != nil {
+		return nil
+	}
+	return responseHeaders
+}
+
+// AgreedPeerPrice implements Pricer. Peers not responding with the price
+// headers charge the expected price.
+func (p *peerPrices) AgreedPeerPrice(peer, chunk penguin.Address, expectedPrice uint64, responseHeaders p2p.Headers) (uint64, error) {
+	target, price, _, err := headerutils.ParsePricingResponseHeaders(responseHeaders)
+	if err != nil {
+		if missingHeader(err) {
+			return expectedPrice, nil
+		}
+		return 0, err
+	}
+	if !target.Equal(chunk) {
+		return 0, ErrWrongTarget
+	}
+	if price > expectedPrice+expectedPrice*p.tolerance/100 {
+		return 0, ErrPriceTooHigh
+	}
+	// the proximity order is not taken from the headers, so that
+	// the peer can not set the prices of other proximity orders
+	po := penguin.Proximity(peer.Bytes(), chunk.Bytes())
+	if err := p.NotifyPeerPrice(peer, price, po); err != nil {
+		return 0, err
+	}
+	return price, nil
+}
+
+// AgreedPrice implements Pricer. The price responded in the headers is
+// charged, so that a price change after the response does not affect the
+// agreed price.
+func (p *peerPrices) AgreedPrice(peer, chunk penguin.Address, headers, responseHeaders p2p.Headers) (uint64, error) {
+	price, err := headerutils.ParsePriceHeader(responseHeaders)
+	if err != nil {
+		price = p.price(chunk)
+	}
+	offered, err := headerutils.ParsePriceHeader(headers)
+	if err != nil {
+		if missingHeader(err) {
+			return price, nil
+		}
+		return 0, err
+	}
+	if offered < price-price*p.tolerance/100 {
+		return 0, ErrPriceTooLow
+	}
+	return price, nil
+}
+
+func missingHeader(err error) bool {
+	return errors.Is(err, headerutils.ErrNoTargetHeader) ||
+		errors.Is(err, headerutils.ErrNoPriceHeader) ||
+		errors.Is(err, headerutils.ErrNoIndexHeader)
+}
+
+// poPrice returns the price of a chunk at the proximity order.
+func poPrice(po uint8, price uint64) uint64 {
+	return uint64(penguin.MaxPO-po+1) * price
+}
+
+// priceTable returns the prices for each proximity order, multiplied by the
+// factor.
+func priceTable(price uint64, factor float64) []uint64 {
+	table := make([]uint64, penguin.MaxPO+1)
+	for po := range table {
+		table[po] = uint64(float64(poPrice(uint8(po), price)) * factor)
+	}
+	return table
+}
+
+func mostExpensive(price uint64) *big.Int {
+	poPrice := new(big.Int).SetUint64(price)
 	maxPO := new(big.Int).SetUint64(uint64(penguin.MaxPO))
 	tenTimesMaxPO := new(big.Int).Mul(big.NewInt(10), maxPO)
 	return new(big.Int).Mul(tenTimesMaxPO, poPrice)
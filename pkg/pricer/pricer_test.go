@@ -0,0 +1,215 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pricer_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/pricer"
+	"github.com/penguintop/penguin/pkg/pricer/headerutils"
+)
+
+func TestPriceAgreement(t *testing.T) {
+	var (
+		requesterAddr = penguin.MustParseHexAddress("1000000000000000000000000000000000000000000000000000000000000000")
+		responderAddr = penguin.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+		chunk         = penguin.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000001")
+		requester     = pricer.NewFixedPricer(requesterAddr, 10)
+		responder     = pricer.NewFixedPricer(responderAddr, 10)
+	)
+
+	expected := requester.PeerPrice(responderAddr, chunk)
+	if price := responder.Price(chunk); price != expected {
+		t.Fatalf("got price %d, want %d", price, expected)
+	}
+
+	t.Run("agreed", func(t *testing.T) {
+		headers, err := headerutils.MakePricingHeaders(expected, chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responseHeaders := responder.PriceHeadler(headers, requesterAddr)
+
+		price, err := requester.AgreedPeerPrice(responderAddr, chunk, expected, responseHeaders)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if price != expected {
+			t.Fatalf("got agreed peer price %d, want %d", price, expected)
+		}
+		price, err = responder.AgreedPrice(requesterAddr, chunk, headers, responseHeaders)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if price != expected {
+			t.Fatalf("got agreed price %d, want %d", price, expected)
+		}
+	})
+
+	t.Run("within tolerance", func(t *testing.T) {
+		higher := expected + expected*pricer.DefaultTolerance/100
+		responseHeaders, err := headerutils.MakePricingResponseHeaders(higher, chunk, penguin.Proximity(responderAddr.Bytes(), chunk.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		price, err := requester.AgreedPeerPrice(responderAddr, chunk, expected, responseHeaders)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if price != higher {
+			t.Fatalf("got agreed peer price %d, want %d", price, higher)
+		}
+		// the responded price is expected from now on
+		if price := requester.PeerPrice(responderAddr, chunk); price != higher {
+			t.Fatalf("got peer price %d, want %d", price, higher)
+		}
+		if err := requester.NotifyPriceTable(responderAddr, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("too high", func(t *testing.T) {
+		responseHeaders, err := headerutils.MakePricingResponseHeaders(2*expected, chunk, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := requester.AgreedPeerPrice(responderAddr, chunk, expected, responseHeaders); !errors.Is(err, pricer.ErrPriceTooHigh) {
+			t.Fatalf("got error %v, want %v", err, pricer.ErrPriceTooHigh)
+		}
+	})
+
+	t.Run("price table above maximum", func(t *testing.T) {
+		table := make([]uint64, penguin.MaxPO+1)
+		for i := range table {
+			table[i] = requester.PeerPrice(responderAddr, chunk)
+		}
+		po := penguin.Proximity(responderAddr.Bytes(), chunk.Bytes())
+		table[po] = expected*uint64(pricer.DefaultMaxFactor) + 1
+		if err := requester.NotifyPriceTable(responderAddr, table); !errors.Is(err, pricer.ErrInvalidPriceTable) {
+			t.Fatalf("got error %v, want %v", err, pricer.ErrInvalidPriceTable)
+		}
+		if price := requester.PeerPrice(responderAddr, chunk); price != expected {
+			t.Fatalf("got peer price %d, want %d", price, expected)
+		}
+	})
+
+	t.Run("too low", func(t *testing.T) {
+		headers, err := headerutils.MakePricingHeaders(expected/2, chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responseHeaders := responder.PriceHeadler(headers, requesterAddr)
+		if _, err := responder.AgreedPrice(requesterAddr, chunk, headers, responseHeaders); !errors.Is(err, pricer.ErrPriceTooLow) {
+			t.Fatalf("got error %v, want %v", err, pricer.ErrPriceTooLow)
+		}
+	})
+
+	t.Run("wrong target", func(t *testing.T) {
+		responseHeaders, err := headerutils.MakePricingResponseHeaders(expected, requesterAddr, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := requester.AgreedPeerPrice(responderAddr, chunk, expected, responseHeaders); !errors.Is(err, pricer.ErrWrongTarget) {
+			t.Fatalf("got error %v, want %v", err, pricer.ErrWrongTarget)
+		}
+	})
+
+	t.Run("no headers", func(t *testing.T) {
+		price, err := requester.AgreedPeerPrice(responderAddr, chunk, expected, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if price != expected {
+			t.Fatalf("got agreed peer price %d, want %d", price, expected)
+		}
+		if responder.PriceHeadler(nil, requesterAddr) != nil {
+			t.Fatal("got price headers for a request without price headers")
+		}
+	})
+}
+
+type announcerMock struct {
+	priceTables [][]uint64
+}
+
+func (a *announcerMock) AnnouncePriceTable(ctx context.Context, priceTable []uint64) error {
+	a.priceTables = append(a.priceTables, priceTable)
+	return nil
+}
+
+func TestDynamicPricer(t *testing.T) {
+	var (
+		overlay   = penguin.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+		chunk     = penguin.MustParseHexAddress("ff00000000000000000000000000000000000000000000000000000000000000")
+		announcer = &announcerMock{}
+		peer      = penguin.MustParseHexAddress("01")
+	)
+	p := pricer.NewDynamicPricer(overlay, 10, logging.New(ioutil.Discard, 0), announcer, pricer.DynamicOptions{
+		Tolerance:      10,
+		MaxFactor:      3,
+		Capacity:       2,
+		DemandCapacity: 4,
+		AnnounceChange: 0.1,
+	})
+
+	basePrice := p.Price(chunk)
+	if want := uint64(penguin.MaxPO+1) * 10; basePrice != want {
+		t.Fatalf("got base price %d, want %d", basePrice, want)
+	}
+
+	// no load keeps the base price
+	p.Adjust()
+	if p.Price(chunk) != basePrice || len(announcer.priceTables) != 0 {
+		t.Fatalf("got price %d and %d announcements, want base price %d", p.Price(chunk), len(announcer.priceTables), basePrice)
+	}
+
+	// full load: requests in flight over the capacity, demand over the
+	// capacity and all retrievals forwarded
+	var dones []func()
+	for i := 0; i < 4; i++ {
+		dones = append(dones, p.NotifyRetrieval(peer, false))
+	}
+	p.Adjust()
+	if got, want := p.Factor(), 2.0; got != want {
+		t.Fatalf("got factor %v, want %v", got, want)
+	}
+	if got, want := p.Price(chunk), 2*basePrice; got != want {
+		t.Fatalf("got price %d, want %d", got, want)
+	}
+	if len(announcer.priceTables) != 1 || announcer.priceTables[0][0] != 2*basePrice {
+		t.Fatalf("got announcements %v, want one with price %d", announcer.priceTables, 2*basePrice)
+	}
+	if table := p.PriceTable(); len(table) != int(penguin.MaxPO)+1 || table[0] != 2*basePrice {
+		t.Fatalf("got price table %v", table)
+	}
+
+	for _, done := range dones {
+		done()
+		done()
+	}
+
+	// the prices fall back towards the base price when idle
+	p.Adjust()
+	if got, want := p.Factor(), 1.5; got != want {
+		t.Fatalf("got factor %v, want %v", got, want)
+	}
+	if len(announcer.priceTables) != 2 {
+		t.Fatalf("got %d announcements, want 2", len(announcer.priceTables))
+	}
+	for i := 0; i < 10; i++ {
+		p.Adjust()
+	}
+	if got := p.Factor(); got > 1.001 {
+		t.Fatalf("got factor %v, want close to 1", got)
+	}
+	if p.Price(chunk) < basePrice {
+		t.Fatalf("got price %d below the base price %d", p.Price(chunk), basePrice)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/penguintop/penguin/pkg/logging"
@@ -46,12 +47,22 @@ type PaymentThresholdObserver interface {
 	NotifyPaymentThreshold(peer penguin.Address, paymentThreshold *big.Int) error
 }
 
+// PriceTableSource provides the price table announced to the peers
+type PriceTableSource interface {
+	PriceTable() []uint64
+}
+
 type Service struct {
 	streamer                 p2p.Streamer
 	logger                   logging.Logger
 	paymentThreshold         *big.Int
 	minPaymentThreshold      *big.Int
 	paymentThresholdObserver PaymentThresholdObserver
+	priceTableObserver       PriceTableObserver
+	priceTableSource         PriceTableSource
+
+	peersMu sync.Mutex
+	peers   map[string]*big.Int // payment thresholds announced to the connected peers
 }
 
 func New(streamer p2p.Streamer, logger logging.Logger, paymentThreshold *big.Int, minThreshold *big.Int) *Service {
@@ -60,6 +71,7 @@ func New(streamer p2p.Streamer, logger logging.Logger, paymentThreshold *big.Int
 		logger:              logger,
 		paymentThreshold:    paymentThreshold,
 		minPaymentThreshold: minThreshold,
+		peers:               make(map[string]*big.Int),
 	}
 }
 
@@ -73,8 +85,10 @@ func (s *Service) Protocol() p2p.ProtocolSpec {
 				Handler: s.handler,
 			},
 		},
-		ConnectIn:  s.init,
-		ConnectOut: s.init,
+		ConnectIn:     s.init,
+		ConnectOut:    s.init,
+		DisconnectIn:  s.disconnect,
+		DisconnectOut: s.disconnect,
 	}
 }
 
@@ -102,6 +116,13 @@ func (s *Service) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream) (e
 		return p2p.NewDisconnectError(ErrThresholdTooLow)
 	}
 
+	if len(req.PriceTable) > 0 && s.priceTableObserver != nil {
+		s.logger.Tracef("received price table announcement from peer %v", p.Address)
+		if err := s.priceTableObserver.NotifyPriceTable(p.Address, req.PriceTable); err != nil {
+			return fmt.Errorf("price table from peer %v: %w", p.Address, err)
+		}
+	}
+
 	if paymentThreshold.Cmp(big.NewInt(0)) == 0 {
 		return err
 	}
@@ -116,8 +137,56 @@ func (s *Service) init(ctx context.Context, p p2p.Peer) error {
 	return err
 }
 
-// AnnouncePaymentThreshold announces the payment threshold to per
+func (s *Service) disconnect(p p2p.Peer) error {
+	s.peersMu.Lock()
+	defer s.peersMu.Unlock()
+	delete(s.peers, p.Address.String())
+	return nil
+}
+
+// AnnouncePaymentThreshold announces the payment threshold to per, together
+// with our current price table
 func (s *Service) AnnouncePaymentThreshold(ctx context.Context, peer penguin.Address, paymentThreshold *big.Int) error {
+	s.peersMu.Lock()
+	s.peers[peer.String()] = paymentThreshold
+	s.peersMu.Unlock()
+
+	var priceTable []uint64
+	if s.priceTableSource != nil {
+		priceTable = s.priceTableSource.PriceTable()
+	}
+	return s.announce(ctx, peer, paymentThreshold, priceTable)
+}
+
+// AnnouncePriceTable announces the price table to all connected peers,
+// together with the payment threshold last announced to each of them
+func (s *Service) AnnouncePriceTable(ctx context.Context, priceTable []uint64) error {
+	s.peersMu.Lock()
+	peers := make(map[string]*big.Int, len(s.peers))
+	for peer, paymentThreshold := range s.peers {
+		peers[peer] = paymentThreshold
+	}
+	s.peersMu.Unlock()
+
+	var wg sync.WaitGroup
+	for peer, paymentThreshold := range peers {
+		addr, err := penguin.ParseHexAddress(peer)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func(peer penguin.Address, paymentThreshold *big.Int) {
+			defer wg.Done()
+			if err := s.announce(ctx, peer, paymentThreshold, priceTable); err != nil {
+				s.logger.Debugf("could not send price table announcement to peer %v: %v", peer, err)
+			}
+		}(addr, paymentThreshold)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (s *Service) announce(ctx context.Context, peer penguin.Address, paymentThreshold *big.Int, priceTable []uint64) (err error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
@@ -137,6 +206,7 @@ func (s *Service) AnnouncePaymentThreshold(ctx context.Context, peer penguin.Add
 	w := protobuf.NewWriter(stream)
 	err = w.WriteMsgWithContext(ctx, &pb.AnnouncePaymentThreshold{
 		PaymentThreshold: paymentThreshold.Bytes(),
+		PriceTable:       priceTable,
 	})
 
 	return err
@@ -146,3 +216,13 @@ func (s *Service) AnnouncePaymentThreshold(ctx context.Context, peer penguin.Add
 func (s *Service) SetPaymentThresholdObserver(observer PaymentThresholdObserver) {
 	s.paymentThresholdObserver = observer
 }
+
+// SetPriceTableObserver sets the PriceTableObserver to be used when receiving a new price table
+func (s *Service) SetPriceTableObserver(observer PriceTableObserver) {
+	s.priceTableObserver = observer
+}
+
+// SetPriceTableSource sets the PriceTableSource of the price table announced to the peers
+func (s *Service) SetPriceTableSource(source PriceTableSource) {
+	s.priceTableSource = source
+}
@@ -154,3 +154,89 @@ func TestAnnouncePaymentWithInsufficientThreshold(t *testing.T) {
 		t.Fatal("unexpected call to the observer")
 	}
 }
+
+type testPriceTableObserver struct {
+	peer       penguin.Address
+	priceTable []uint64
+}
+
+func (t *testPriceTableObserver) NotifyPriceTable(peerAddr penguin.Address, priceTable []uint64) error {
+	t.peer = peerAddr
+	t.priceTable = priceTable
+	return nil
+}
+
+type testPriceTableSource []uint64
+
+func (s testPriceTableSource) PriceTable() []uint64 {
+	return s
+}
+
+func TestAnnouncePriceTable(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+	testThreshold := big.NewInt(100000)
+	thresholdObserver := &testThresholdObserver{}
+	tableObserver := &testPriceTableObserver{}
+
+	recipient := pricing.New(nil, logger, testThreshold, big.NewInt(1000))
+	recipient.SetPaymentThresholdObserver(thresholdObserver)
+	recipient.SetPriceTableObserver(tableObserver)
+
+	peerID := penguin.MustParseHexAddress("9ee7add7")
+
+	recorder := streamtest.New(
+		streamtest.WithProtocols(recipient.Protocol()),
+		streamtest.WithBaseAddr(peerID),
+	)
+
+	payer := pricing.New(recorder, logger, testThreshold, big.NewInt(1000))
+	payer.SetPriceTableSource(testPriceTableSource{30, 20, 10})
+
+	// the price table is announced together with the payment threshold
+	err := payer.AnnouncePaymentThreshold(context.Background(), peerID, testThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.Records(peerID, "pricing", "1.0.0", "pricing"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{30, 20, 10}; !equalPriceTables(tableObserver.priceTable, want) {
+		t.Fatalf("got price table %v, want %v", tableObserver.priceTable, want)
+	}
+
+	// price updates are announced to the connected peers with the payment
+	// threshold announced to them before
+	err = payer.AnnouncePriceTable(context.Background(), []uint64{60, 40, 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := recorder.Records(peerID, "pricing", "1.0.0", "pricing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(records); l != 2 {
+		t.Fatalf("got %v records, want %v", l, 2)
+	}
+	if want := []uint64{60, 40, 20}; !equalPriceTables(tableObserver.priceTable, want) {
+		t.Fatalf("got price table %v, want %v", tableObserver.priceTable, want)
+	}
+	if !tableObserver.peer.Equal(peerID) {
+		t.Fatalf("observer called with wrong peer. got %v, want %v", tableObserver.peer, peerID)
+	}
+	if thresholdObserver.paymentThreshold.Cmp(testThreshold) != 0 {
+		t.Fatalf("got payment threshold %d, want %d", thresholdObserver.paymentThreshold, testThreshold)
+	}
+}
+
+func equalPriceTables(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
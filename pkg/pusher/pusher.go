@@ -16,6 +16,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/penguintop/penguin/pkg/accounting"
 	"github.com/penguintop/penguin/pkg/crypto"
 	"github.com/penguintop/penguin/pkg/logging"
 	"github.com/penguintop/penguin/pkg/pushsync"
@@ -159,6 +160,11 @@ LOOP:
 					<-sem
 				}()
 
+				// the chunk is pushed at the expense of the client that uploaded it
+				if t, _ = s.tag.Get(ch.TagID()); t != nil && t.Client != "" {
+					ctx = accounting.SetClient(ctx, t.Client)
+				}
+
 				// Later when we process receipt, get the receipt and process it
 				// for now ignoring the receipt and checking only for error
 				receipt, err := s.pushSyncer.PushChunkToClosest(ctx, ch)
@@ -194,8 +200,7 @@ LOOP:
 					return
 				}
 
-				t, err = s.tag.Get(ch.TagID())
-				if err == nil && t != nil {
+				if t != nil {
 					err = t.Inc(tags.StateSynced)
 					if err != nil {
 						err = fmt.Errorf("pusher: increment synced: %v", err)
@@ -20,6 +20,7 @@ import (
 	"github.com/penguintop/penguin/pkg/p2p"
 	"github.com/penguintop/penguin/pkg/p2p/protobuf"
 	"github.com/penguintop/penguin/pkg/pricer"
+	"github.com/penguintop/penguin/pkg/pricer/headerutils"
 	"github.com/penguintop/penguin/pkg/pushsync/pb"
 	"github.com/penguintop/penguin/pkg/soc"
 	"github.com/penguintop/penguin/pkg/storage"
@@ -107,6 +108,7 @@ func (s *PushSync) Protocol() p2p.ProtocolSpec {
 			{
 				Name:    streamName,
 				Handler: s.handler,
+				Headler: s.pricer.PriceHeadler,
 			},
 		},
 	}
@@ -145,7 +147,13 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 		return penguin.ErrInvalidChunk
 	}
 
-	price := ps.pricer.Price(chunk.Address())
+	// the price offered by the peer must be close to the price we responded with
+	price, err := ps.pricer.AgreedPrice(p.Address, chunk.Address(), stream.Headers(), stream.ResponseHeaders())
+	if err != nil {
+		return fmt.Errorf("pushsync price: %w", err)
+	}
+	done := ps.pricer.NotifyPushSync(p.Address)
+	defer done()
 
 	// if the peer is closer to the chunk, AND it's a full node, we were selected for replication. Return early.
 	if p.FullNode {
@@ -160,7 +168,7 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 					return fmt.Errorf("chunk store: %w", err)
 				}
 
-				debit := ps.accounting.PrepareDebit(p.Address, price)
+				debit := ps.accounting.PrepareDebit(p.Address, price, accounting.Provenance{Protocol: accounting.ProtocolPushSync, Chunk: chunk.Address()})
 				defer debit.Cleanup()
 
 				// return back receipt
@@ -237,14 +245,22 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 					ctx, cancel := context.WithTimeout(context.Background(), timeToWaitForPushsyncToNeighbor)
 					defer cancel()
 
-					err = ps.accounting.Reserve(ctx, peer, receiptPrice)
+					reserved := receiptPrice
+					err = ps.accounting.Reserve(ctx, peer, reserved)
 					if err != nil {
 						err = fmt.Errorf("reserve balance for peer %s: %w", peer.String(), err)
 						return
 					}
-					defer ps.accounting.Release(peer, receiptPrice)
+					defer func() {
+						ps.accounting.Release(peer, reserved)
+					}()
 
-					streamer, err := ps.streamer.NewStream(ctx, peer, nil, protocolName, protocolVersion, streamName)
+					headers, err := headerutils.MakePricingHeaders(receiptPrice, chunk.Address())
+					if err != nil {
+						return
+					}
+
+					streamer, err := ps.streamer.NewStream(ctx, peer, headers, protocolName, protocolVersion, streamName)
 					if err != nil {
 						err = fmt.Errorf("new stream for peer %s: %w", peer.String(), err)
 						return
@@ -259,6 +275,19 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 						}
 					}()
 
+					agreedPrice, err := ps.pricer.AgreedPeerPrice(peer, chunk.Address(), receiptPrice, streamer.Headers())
+					if err != nil {
+						err = fmt.Errorf("price for peer %s: %w", peer.String(), err)
+						return
+					}
+					if agreedPrice > reserved {
+						if err = ps.accounting.Reserve(ctx, peer, agreedPrice-reserved); err != nil {
+							err = fmt.Errorf("reserve balance for peer %s: %w", peer.String(), err)
+							return
+						}
+						reserved = agreedPrice
+					}
+
 					w, r := protobuf.NewWriterAndReader(streamer)
 					stamp, err := chunk.Stamp().MarshalBinary()
 					if err != nil {
@@ -283,7 +312,8 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 						return
 					}
 
-					err = ps.accounting.Credit(peer, receiptPrice)
+					// the replication is paid for by the peer that pushed the chunk
+					err = ps.accounting.Credit(peer, agreedPrice, accounting.Provenance{Protocol: accounting.ProtocolPushSync, Chunk: chunk.Address(), Forwarded: true})
 
 				}(peer)
 
@@ -299,7 +329,7 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 			}
 
 			// return back receipt
-			debit := ps.accounting.PrepareDebit(p.Address, price)
+			debit := ps.accounting.PrepareDebit(p.Address, price, accounting.Provenance{Protocol: accounting.ProtocolPushSync, Chunk: chunk.Address()})
 			defer debit.Cleanup()
 
 			receipt := pb.Receipt{Address: chunk.Address().Bytes(), Signature: signature}
@@ -313,7 +343,7 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 
 	}
 
-	debit := ps.accounting.PrepareDebit(p.Address, price)
+	debit := ps.accounting.PrepareDebit(p.Address, price, accounting.Provenance{Protocol: accounting.ProtocolPushSync, Chunk: chunk.Address()})
 	defer debit.Cleanup()
 
 	// pass back the receipt
@@ -348,9 +378,15 @@ func (ps *PushSync) pushToClosest(ctx context.Context, ch penguin.Chunk, retryAl
 		includeSelf    = ps.isFullNode
 	)
 
+	// the pushes of the originator are paid for by the client the chunk is
+	// pushed for, the forwarded pushes by the peer that pushed the chunk
+	provenance := accounting.Provenance{Protocol: accounting.ProtocolPushSync, Chunk: ch.Address()}
 	if retryAllowed {
 		// only originator retries
 		allowedRetries = maxPeers
+		provenance.Client = accounting.GetClient(ctx)
+	} else {
+		provenance.Forwarded = true
 	}
 
 	for i := maxAttempts; allowedRetries > 0 && i > 0; i-- {
@@ -374,7 +410,7 @@ func (ps *PushSync) pushToClosest(ctx context.Context, ch penguin.Chunk, retryAl
 			ctxd, canceld := context.WithTimeout(ctx, defaultTTL)
 			defer canceld()
 
-			r, attempted, err := ps.pushPeer(ctxd, peer, ch)
+			r, attempted, err := ps.pushPeer(ctxd, peer, ch, provenance)
 			// attempted is true if we get past accounting and actually attempt
 			// to send the request to the peer. If we dont get past accounting, we
 			// should not count the retry and try with a different peer again
@@ -415,28 +451,52 @@ func (ps *PushSync) pushToClosest(ctx context.Context, ch penguin.Chunk, retryAl
 	return nil, ErrNoPush
 }
 
-func (ps *PushSync) pushPeer(ctx context.Context, peer penguin.Address, ch penguin.Chunk) (*pb.Receipt, bool, error) {
+func (ps *PushSync) pushPeer(ctx context.Context, peer penguin.Address, ch penguin.Chunk, provenance accounting.Provenance) (*pb.Receipt, bool, error) {
 	// compute the price we pay for this receipt and reserve it for the rest of this function
 	receiptPrice := ps.pricer.PeerPrice(peer, ch.Address())
 
 	// Reserve to see whether we can make the request
-	err := ps.accounting.Reserve(ctx, peer, receiptPrice)
+	reserved := receiptPrice
+	err := ps.accounting.Reserve(ctx, peer, reserved)
 	if err != nil {
 		return nil, false, fmt.Errorf("reserve balance for peer %s: %w", peer, err)
 	}
-	defer ps.accounting.Release(peer, receiptPrice)
+	defer func() {
+		ps.accounting.Release(peer, reserved)
+	}()
 
 	stamp, err := ch.Stamp().MarshalBinary()
 	if err != nil {
 		return nil, false, err
 	}
 
-	streamer, err := ps.streamer.NewStream(ctx, peer, nil, protocolName, protocolVersion, streamName)
+	headers, err := headerutils.MakePricingHeaders(receiptPrice, ch.Address())
+	if err != nil {
+		return nil, false, err
+	}
+
+	streamer, err := ps.streamer.NewStream(ctx, peer, headers, protocolName, protocolVersion, streamName)
 	if err != nil {
 		return nil, true, fmt.Errorf("new stream for peer %s: %w", peer, err)
 	}
 	defer streamer.Close()
 
+	// the price the peer responded with must be close to the expected one
+	agreedPrice, err := ps.pricer.AgreedPeerPrice(peer, ch.Address(), receiptPrice, streamer.Headers())
+	if err != nil {
+		_ = streamer.Reset()
+		return nil, true, fmt.Errorf("price for peer %s: %w", peer, err)
+	}
+	// the agreed price is credited, so the part of it above
+	// the expected price has to be reserved as well
+	if agreedPrice > reserved {
+		if err := ps.accounting.Reserve(ctx, peer, agreedPrice-reserved); err != nil {
+			_ = streamer.Reset()
+			return nil, true, fmt.Errorf("reserve balance for peer %s: %w", peer, err)
+		}
+		reserved = agreedPrice
+	}
+
 	w, r := protobuf.NewWriterAndReader(streamer)
 	if err := w.WriteMsgWithContext(ctx, &pb.Delivery{
 		Address: ch.Address().Bytes(),
@@ -469,7 +529,7 @@ func (ps *PushSync) pushPeer(ctx context.Context, peer penguin.Address, ch pengu
 		return nil, true, fmt.Errorf("invalid receipt. chunk %s, peer %s", ch.Address(), peer)
 	}
 
-	err = ps.accounting.Credit(peer, receiptPrice)
+	err = ps.accounting.Credit(peer, agreedPrice, provenance)
 	if err != nil {
 		return nil, true, err
 	}
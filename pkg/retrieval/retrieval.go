@@ -22,6 +22,7 @@ import (
 	"github.com/penguintop/penguin/pkg/p2p/protobuf"
 	"github.com/penguintop/penguin/pkg/postage"
 	"github.com/penguintop/penguin/pkg/pricer"
+	"github.com/penguintop/penguin/pkg/pricer/headerutils"
 	pb "github.com/penguintop/penguin/pkg/retrieval/pb"
 	"github.com/penguintop/penguin/pkg/soc"
 	"github.com/penguintop/penguin/pkg/storage"
@@ -88,6 +89,7 @@ func (s *Service) Protocol() p2p.ProtocolSpec {
 			{
 				Name:    streamName,
 				Handler: s.handler,
+				Headler: s.pricer.PriceHeadler,
 			},
 		},
 	}
@@ -101,6 +103,8 @@ const (
 	maxRequestRounds              = 5
 	maxSelects                    = 8
 	originSuffix                  = "_origin"
+	forwardedSuffix               = "_forwarded"
+	clientSuffix                  = "_client_"
 )
 
 func (s *Service) RetrieveChunk(ctx context.Context, addr penguin.Address) (penguin.Chunk, error) {
@@ -108,6 +112,16 @@ func (s *Service) RetrieveChunk(ctx context.Context, addr penguin.Address) (peng
 
 	flightRoute := addr.String()
 
+	// the requests are shared only by the requests paid for by the same
+	// client, the forwarded requests are paid for by the requesting peers
+	source := ctx.Value(requestSourceContextKey{})
+	client := accounting.GetClient(ctx)
+	if source != nil {
+		flightRoute += forwardedSuffix
+	} else if client != "" {
+		flightRoute += clientSuffix + client
+	}
+
 	// topCtx is passing the tracing span to the first singleflight call
 	topCtx := ctx
 
@@ -134,8 +148,12 @@ func (s *Service) RetrieveChunk(ctx context.Context, addr penguin.Address) (peng
 			if peerAttempt < maxSelects {
 
 				// create a new context without cancelation but
-				// set the tracing span to the new context from the context of the first caller
+				// set the tracing span, the source of the request and the client to the new context from the context of the first caller
 				ctx := tracing.WithContext(context.Background(), tracing.FromContext(topCtx))
+				if source != nil {
+					ctx = context.WithValue(ctx, requestSourceContextKey{}, source)
+				}
+				ctx = accounting.SetClient(ctx, client)
 
 				// get the tracing span
 				span, _, ctx := s.tracer.StartSpanFromContext(ctx, "retrieve-chunk", s.logger, opentracing.Tag{Key: "address", Value: addr.String()})
@@ -267,18 +285,26 @@ func (s *Service) retrieveChunk(ctx context.Context, addr penguin.Address, sp *s
 	chunkPrice := s.pricer.PeerPrice(peer, addr)
 
 	// Reserve to see whether we can request the chunk
-	err = s.accounting.Reserve(ctx, peer, chunkPrice)
+	reserved := chunkPrice
+	err = s.accounting.Reserve(ctx, peer, reserved)
 	if err != nil {
 		sp.AddOverdraft(peer)
 		return nil, peer, false, err
 	}
-	defer s.accounting.Release(peer, chunkPrice)
+	defer func() {
+		s.accounting.Release(peer, reserved)
+	}()
 
 	sp.Add(peer)
 
 	s.logger.Tracef("retrieval: requesting chunk %s from peer %s", addr, peer)
 
-	stream, err := s.streamer.NewStream(ctx, peer, nil, protocolName, protocolVersion, streamName)
+	headers, err := headerutils.MakePricingHeaders(chunkPrice, addr)
+	if err != nil {
+		return nil, peer, false, err
+	}
+
+	stream, err := s.streamer.NewStream(ctx, peer, headers, protocolName, protocolVersion, streamName)
 	if err != nil {
 		s.metrics.TotalErrors.Inc()
 		return nil, peer, false, fmt.Errorf("new stream: %w", err)
@@ -292,6 +318,22 @@ func (s *Service) retrieveChunk(ctx context.Context, addr penguin.Address, sp *s
 		}
 	}()
 
+	// the price the peer responded with must be close to the expected one
+	agreedPrice, err := s.pricer.AgreedPeerPrice(peer, addr, chunkPrice, stream.Headers())
+	if err != nil {
+		s.metrics.TotalErrors.Inc()
+		return nil, peer, false, fmt.Errorf("price: %w peer %s", err, peer.String())
+	}
+	// the agreed price is credited, so the part of it above
+	// the expected price has to be reserved as well
+	if agreedPrice > reserved {
+		if err = s.accounting.Reserve(ctx, peer, agreedPrice-reserved); err != nil {
+			sp.AddOverdraft(peer)
+			return nil, peer, false, err
+		}
+		reserved = agreedPrice
+	}
+
 	w, r := protobuf.NewWriterAndReader(stream)
 	if err := w.WriteMsgWithContext(ctx, &pb.Request{
 		Addr: addr.Bytes(),
@@ -325,11 +367,11 @@ func (s *Service) retrieveChunk(ctx context.Context, addr penguin.Address, sp *s
 	}
 
 	// credit the peer after successful delivery
-	err = s.accounting.Credit(peer, chunkPrice)
+	err = s.accounting.Credit(peer, agreedPrice, accounting.Provenance{Protocol: accounting.ProtocolRetrieval, Chunk: addr, Client: accounting.GetClient(ctx), Forwarded: v != nil})
 	if err != nil {
 		return nil, peer, true, err
 	}
-	s.metrics.ChunkPrice.Observe(float64(chunkPrice))
+	s.metrics.ChunkPrice.Observe(float64(agreedPrice))
 	return chunk, peer, true, err
 }
 
@@ -408,7 +450,16 @@ func (s *Service) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream) (e
 
 	ctx = context.WithValue(ctx, requestSourceContextKey{}, p.Address.String())
 	addr := penguin.NewAddress(req.Addr)
+
+	// the price offered by the peer must be close to the price we responded with
+	chunkPrice, err := s.pricer.AgreedPrice(p.Address, addr, stream.Headers(), stream.ResponseHeaders())
+	if err != nil {
+		return fmt.Errorf("price: %w peer %s", err, p.Address.String())
+	}
+
 	chunk, err := s.storer.Get(ctx, storage.ModeGetRequest, addr)
+	done := s.pricer.NotifyRetrieval(p.Address, err == nil)
+	defer done()
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
 			// forward the request
@@ -426,8 +477,7 @@ func (s *Service) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream) (e
 		return fmt.Errorf("stamp marshal: %w", err)
 	}
 
-	chunkPrice := s.pricer.Price(chunk.Address())
-	debit := s.accounting.PrepareDebit(p.Address, chunkPrice)
+	debit := s.accounting.PrepareDebit(p.Address, chunkPrice, accounting.Provenance{Protocol: accounting.ProtocolRetrieval, Chunk: addr})
 
 	defer debit.Cleanup()
 
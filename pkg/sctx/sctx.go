@@ -29,6 +29,7 @@ type (
 	targetsContextKey struct{}
 	gasPriceKey       struct{}
 	gasLimitKey       struct{}
+	cacheOnlyKey      struct{}
 )
 
 // SetHost sets the http request host in the context
@@ -112,3 +113,15 @@ func GetGasPrice(ctx context.Context) *big.Int {
 	}
 	return nil
 }
+
+// SetCacheOnly restricts the request to the chunks in the local store
+func SetCacheOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheOnlyKey{}, true)
+}
+
+// GetCacheOnly returns true if the request is restricted to the chunks in the
+// local store
+func GetCacheOnly(ctx context.Context) bool {
+	v, _ := ctx.Value(cacheOnlyKey{}).(bool)
+	return v
+}
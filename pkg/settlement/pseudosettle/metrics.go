@@ -13,8 +13,10 @@ type metrics struct {
 	// all metrics fields must be exported
 	// to be able to return them by Metrics()
 	// using reflection
-	TotalReceivedPseudoSettlements prometheus.Counter
-	TotalSentPseudoSettlements     prometheus.Counter
+	TotalReceivedPseudoSettlements   prometheus.Counter
+	TotalSentPseudoSettlements       prometheus.Counter
+	RefusedReceivedPseudoSettlements prometheus.Counter
+	RefusedSentPseudoSettlements     prometheus.Counter
 }
 
 func newMetrics() metrics {
@@ -33,6 +35,18 @@ func newMetrics() metrics {
 			Name:      "total_sent_pseudosettlements",
 			Help:      "Amount of pseudotokens sent to peers (costs paid by the node)",
 		}),
+		RefusedReceivedPseudoSettlements: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "refused_received_pseudosettlements",
+			Help:      "Number of pseudosettlements from peers which were rejected",
+		}),
+		RefusedSentPseudoSettlements: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "refused_sent_pseudosettlements",
+			Help:      "Number of pseudosettlements to peers which were accepted below the allowance",
+		}),
 	}
 }
 
@@ -24,6 +24,7 @@ const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
 
 type Payment struct {
 	Amount []byte `protobuf:"bytes,1,opt,name=Amount,proto3" json:"Amount,omitempty"`
+	Rate   []byte `protobuf:"bytes,2,opt,name=Rate,proto3" json:"Rate,omitempty"`
 }
 
 func (m *Payment) Reset()         { *m = Payment{} }
@@ -66,9 +67,17 @@ func (m *Payment) GetAmount() []byte {
 	return nil
 }
 
+func (m *Payment) GetRate() []byte {
+	if m != nil {
+		return m.Rate
+	}
+	return nil
+}
+
 type PaymentAck struct {
 	Amount    []byte `protobuf:"bytes,1,opt,name=Amount,proto3" json:"Amount,omitempty"`
 	Timestamp int64  `protobuf:"varint,2,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"`
+	Rate      []byte `protobuf:"bytes,3,opt,name=Rate,proto3" json:"Rate,omitempty"`
 }
 
 func (m *PaymentAck) Reset()         { *m = PaymentAck{} }
@@ -118,6 +127,13 @@ func (m *PaymentAck) GetTimestamp() int64 {
 	return 0
 }
 
+func (m *PaymentAck) GetRate() []byte {
+	if m != nil {
+		return m.Rate
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Payment)(nil), "pseudosettle.Payment")
 	proto.RegisterType((*PaymentAck)(nil), "pseudosettle.PaymentAck")
@@ -126,17 +142,17 @@ func init() {
 func init() { proto.RegisterFile("pseudosettle.proto", fileDescriptor_3ff21bb6c9cf5e84) }
 
 var fileDescriptor_3ff21bb6c9cf5e84 = []byte{
-	// 148 bytes of a gzipped FileDescriptorProto
+	// 159 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x2a, 0x28, 0x4e, 0x2d,
 	0x4d, 0xc9, 0x2f, 0x4e, 0x2d, 0x29, 0xc9, 0x49, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2,
-	0x41, 0x16, 0x53, 0x52, 0xe4, 0x62, 0x0f, 0x48, 0xac, 0xcc, 0x4d, 0xcd, 0x2b, 0x11, 0x12, 0xe3,
+	0x41, 0x16, 0x53, 0x32, 0xe5, 0x62, 0x0f, 0x48, 0xac, 0xcc, 0x4d, 0xcd, 0x2b, 0x11, 0x12, 0xe3,
 	0x62, 0x73, 0xcc, 0xcd, 0x2f, 0xcd, 0x2b, 0x91, 0x60, 0x54, 0x60, 0xd4, 0xe0, 0x09, 0x82, 0xf2,
-	0x94, 0x9c, 0xb8, 0xb8, 0xa0, 0x4a, 0x1c, 0x93, 0xb3, 0x71, 0xa9, 0x12, 0x92, 0xe1, 0xe2, 0x0c,
-	0xc9, 0xcc, 0x4d, 0x2d, 0x2e, 0x49, 0xcc, 0x2d, 0x90, 0x60, 0x52, 0x60, 0xd4, 0x60, 0x0e, 0x42,
-	0x08, 0x38, 0xc9, 0x9c, 0x78, 0x24, 0xc7, 0x78, 0xe1, 0x91, 0x1c, 0xe3, 0x83, 0x47, 0x72, 0x8c,
-	0x13, 0x1e, 0xcb, 0x31, 0x5c, 0x78, 0x2c, 0xc7, 0x70, 0xe3, 0xb1, 0x1c, 0x43, 0x14, 0x53, 0x41,
-	0x52, 0x12, 0x1b, 0xd8, 0x65, 0xc6, 0x80, 0x00, 0x00, 0x00, 0xff, 0xff, 0x87, 0xcb, 0xb8, 0x18,
-	0xaf, 0x00, 0x00, 0x00,
+	0x84, 0x84, 0xb8, 0x58, 0x82, 0x12, 0x4b, 0x52, 0x25, 0x98, 0xc0, 0xa2, 0x60, 0xb6, 0x52, 0x18,
+	0x17, 0x17, 0x54, 0x9b, 0x63, 0x72, 0x36, 0x4e, 0x9d, 0x32, 0x5c, 0x9c, 0x21, 0x99, 0xb9, 0xa9,
+	0xc5, 0x25, 0x89, 0xb9, 0x05, 0x60, 0xed, 0xcc, 0x41, 0x08, 0x01, 0xb8, 0xb9, 0xcc, 0x08, 0x73,
+	0x9d, 0x64, 0x4e, 0x3c, 0x92, 0x63, 0xbc, 0xf0, 0x48, 0x8e, 0xf1, 0xc1, 0x23, 0x39, 0xc6, 0x09,
+	0x8f, 0xe5, 0x18, 0x2e, 0x3c, 0x96, 0x63, 0xb8, 0xf1, 0x58, 0x8e, 0x21, 0x8a, 0xa9, 0x20, 0x29,
+	0x89, 0x0d, 0xec, 0x03, 0x63, 0xc0, 0x00, 0x50, 0xe1, 0xa1, 0xb5, 0xd7, 0x00, 0x00, 0x00,
 }
 
 func (m *Payment) Marshal() (dAtA []byte, err error) {
@@ -159,6 +175,13 @@ func (m *Payment) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Rate) > 0 {
+		i -= len(m.Rate)
+		copy(dAtA[i:], m.Rate)
+		i = encodeVarintPseudosettle(dAtA, i, uint64(len(m.Rate)))
+		i--
+		dAtA[i] = 0x12
+	}
 	if len(m.Amount) > 0 {
 		i -= len(m.Amount)
 		copy(dAtA[i:], m.Amount)
@@ -189,6 +212,13 @@ func (m *PaymentAck) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Rate) > 0 {
+		i -= len(m.Rate)
+		copy(dAtA[i:], m.Rate)
+		i = encodeVarintPseudosettle(dAtA, i, uint64(len(m.Rate)))
+		i--
+		dAtA[i] = 0x1a
+	}
 	if m.Timestamp != 0 {
 		i = encodeVarintPseudosettle(dAtA, i, uint64(m.Timestamp))
 		i--
@@ -225,6 +255,10 @@ func (m *Payment) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovPseudosettle(uint64(l))
 	}
+	l = len(m.Rate)
+	if l > 0 {
+		n += 1 + l + sovPseudosettle(uint64(l))
+	}
 	return n
 }
 
@@ -241,6 +275,10 @@ func (m *PaymentAck) Size() (n int) {
 	if m.Timestamp != 0 {
 		n += 1 + sovPseudosettle(uint64(m.Timestamp))
 	}
+	l = len(m.Rate)
+	if l > 0 {
+		n += 1 + l + sovPseudosettle(uint64(l))
+	}
 	return n
 }
 
@@ -313,6 +351,40 @@ func (m *Payment) Unmarshal(dAtA []byte) error {
 				m.Amount = []byte{}
 			}
 			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Rate", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPseudosettle
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthPseudosettle
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthPseudosettle
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Rate = append(m.Rate[:0], dAtA[iNdEx:postIndex]...)
+			if m.Rate == nil {
+				m.Rate = []byte{}
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipPseudosettle(dAtA[iNdEx:])
@@ -419,6 +491,40 @@ func (m *PaymentAck) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Rate", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPseudosettle
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthPseudosettle
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthPseudosettle
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Rate = append(m.Rate[:0], dAtA[iNdEx:postIndex]...)
+			if m.Rate == nil {
+				m.Rate = []byte{}
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipPseudosettle(dAtA[iNdEx:])
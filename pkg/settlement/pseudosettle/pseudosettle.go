@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -31,6 +32,12 @@ const (
 var (
 	SettlementReceivedPrefix = "pseudosettle_total_received_"
 	SettlementSentPrefix     = "pseudosettle_total_sent_"
+	HistoryReceivedPrefix    = "pseudosettle_history_received_"
+	HistorySentPrefix        = "pseudosettle_history_sent_"
+
+	// historySize is the number of refreshments kept in the history of a
+	// peer in each direction.
+	historySize = uint64(64)
 
 	ErrSettlementTooSoon              = errors.New("settlement too soon")
 	ErrNoPseudoSettlePeer             = errors.New("settlement peer not found")
@@ -38,40 +45,91 @@ var (
 	ErrTimeOutOfSync                  = errors.New("settlement allowance timestamps differ beyond tolerance")
 )
 
+// Interface is the time based settlement with the introspection of the
+// allowances and the refreshments of single peers.
+type Interface interface {
+	settlement.Interface
+	// PeerAllowance returns the time based allowance of a connected peer.
+	PeerAllowance(peer penguin.Address) (*PeerAllowance, error)
+	// History returns the most recent refreshments with a peer, newest first.
+	History(peer penguin.Address) ([]Refreshment, error)
+}
+
+var _ Interface = (*Service)(nil)
+
 type Service struct {
-	streamer    p2p.Streamer
-	logger      logging.Logger
-	store       storage.StateStorer
-	accounting  settlement.Accounting
-	metrics     metrics
-	refreshRate *big.Int
-	p2pService  p2p.Service
-	timeNow     func() time.Time
-	peersMu     sync.Mutex
-	peers       map[string]*pseudoSettlePeer
+	streamer         p2p.Streamer
+	logger           logging.Logger
+	store            storage.StateStorer
+	accounting       settlement.Accounting
+	metrics          metrics
+	refreshRate      *big.Int
+	lightRefreshRate *big.Int
+	fullNode         bool
+	p2pService       p2p.Service
+	timeNow          func() time.Time
+	peersMu          sync.Mutex
+	peers            map[string]*pseudoSettlePeer
 }
 
 type pseudoSettlePeer struct {
-	lock sync.Mutex // lock to be held during receiving a payment from this peer
+	lock     sync.Mutex // lock to be held during receiving a payment from this peer
+	fullNode bool
 }
 
 type lastPayment struct {
 	Timestamp      int64
 	CheckTimestamp int64
 	Total          *big.Int
+	// Refused counts the refused refreshments.
+	Refused uint64
+	// Refreshments counts all refreshments, it locates the next history entry.
+	Refreshments uint64
+}
+
+// PeerAllowance describes the time based settlement with a peer.
+type PeerAllowance struct {
+	Peer     penguin.Address
+	FullNode bool
+	// RefreshRate is the rate at which the allowance of the peer grows.
+	RefreshRate *big.Int
+	// Allowance is the amount of the peer debt we would accept as a
+	// refreshment now.
+	Allowance *big.Int
+	// LastReceived is the timestamp of the last refreshment received from the
+	// peer, LastSent of the last refreshment sent to it.
+	LastReceived int64
+	LastSent     int64
+	// RefusedReceived counts the refreshments of the peer we rejected,
+	// RefusedSent the refreshments the peer accepted below its allowance.
+	RefusedReceived uint64
+	RefusedSent     uint64
+}
+
+// Refreshment is an entry in the refreshment history of a peer.
+type Refreshment struct {
+	Timestamp int64    `json:"timestamp"`
+	Sent      bool     `json:"sent"`
+	Attempted *big.Int `json:"attempted"`
+	Accepted  *big.Int `json:"accepted"`
 }
 
-func New(streamer p2p.Streamer, logger logging.Logger, store storage.StateStorer, accounting settlement.Accounting, refreshRate *big.Int, p2pService p2p.Service) *Service {
+// New creates the time based settlement. Peers are granted the refresh rate
+// if they are full nodes and the light refresh rate otherwise, fullNode tells
+// which of the rates our peers grant us.
+func New(streamer p2p.Streamer, logger logging.Logger, store storage.StateStorer, accounting settlement.Accounting, refreshRate, lightRefreshRate *big.Int, fullNode bool, p2pService p2p.Service) *Service {
 	return &Service{
-		streamer:    streamer,
-		logger:      logger,
-		metrics:     newMetrics(),
-		store:       store,
-		accounting:  accounting,
-		p2pService:  p2pService,
-		refreshRate: refreshRate,
-		timeNow:     time.Now,
-		peers:       make(map[string]*pseudoSettlePeer),
+		streamer:         streamer,
+		logger:           logger,
+		metrics:          newMetrics(),
+		store:            store,
+		accounting:       accounting,
+		p2pService:       p2pService,
+		refreshRate:      refreshRate,
+		lightRefreshRate: lightRefreshRate,
+		fullNode:         fullNode,
+		timeNow:          time.Now,
+		peers:            make(map[string]*pseudoSettlePeer),
 	}
 }
 
@@ -98,7 +156,7 @@ func (s *Service) init(ctx context.Context, p p2p.Peer) error {
 
 	_, ok := s.peers[p.Address.String()]
 	if !ok {
-		peerData := &pseudoSettlePeer{}
+		peerData := &pseudoSettlePeer{fullNode: p.FullNode}
 		s.peers[p.Address.String()] = peerData
 	}
 
@@ -127,9 +185,54 @@ func totalKeyPeer(key []byte, prefix string) (peer penguin.Address, err error) {
 	return penguin.ParseHexAddress(split[1])
 }
 
+func historyKey(peer penguin.Address, prefix string, n uint64) string {
+	return fmt.Sprintf("%v%v_%d", prefix, peer.String(), n%historySize)
+}
+
+// rate returns the refresh rate granted to full or light nodes.
+func (s *Service) rate(fullNode bool) *big.Int {
+	if fullNode {
+		return s.refreshRate
+	}
+	return s.lightRefreshRate
+}
+
+// grantedRate returns the refresh rate granted to a peer, the rate of its node
+// type capped by the rate the peer expects. Peers not telling the rate they
+// expect enforce the full refresh rate, so they are granted it.
+func (s *Service) grantedRate(fullNode bool, expected []byte) *big.Int {
+	if len(expected) == 0 {
+		return s.refreshRate
+	}
+	rate := s.rate(fullNode)
+	if expectedRate := new(big.Int).SetBytes(expected); expectedRate.Cmp(rate) < 0 {
+		return expectedRate
+	}
+	return rate
+}
+
+// record adds a refreshment to the history of the peer and counts it in the
+// last payment, which must be persisted by the caller.
+func (s *Service) record(peer penguin.Address, prefix string, last *lastPayment, r Refreshment, refused bool) error {
+	if refused {
+		last.Refused++
+		if r.Sent {
+			s.metrics.RefusedSentPseudoSettlements.Inc()
+		} else {
+			s.metrics.RefusedReceivedPseudoSettlements.Inc()
+		}
+	}
+	err := s.store.Put(historyKey(peer, prefix, last.Refreshments), r)
+	if err != nil {
+		return err
+	}
+	last.Refreshments++
+	return nil
+}
+
 // peerAllowance computes the maximum incoming payment value we accept
 // this is the time based allowance or the peers actual debt, whichever is less
-func (s *Service) peerAllowance(peer penguin.Address) (limit *big.Int, stamp int64, err error) {
+func (s *Service) peerAllowance(peer penguin.Address, rate *big.Int) (limit *big.Int, stamp int64, err error) {
 	var lastTime lastPayment
 	err = s.store.Get(totalKey(peer, SettlementReceivedPrefix), &lastTime)
 	if err != nil {
@@ -144,7 +247,7 @@ func (s *Service) peerAllowance(peer penguin.Address) (limit *big.Int, stamp int
 		return nil, 0, ErrSettlementTooSoon
 	}
 
-	maxAllowance := new(big.Int).Mul(big.NewInt(currentTime-lastTime.Timestamp), s.refreshRate)
+	maxAllowance := new(big.Int).Mul(big.NewInt(currentTime-lastTime.Timestamp), rate)
 
 	peerDebt, err := s.accounting.PeerDebt(peer)
 	if err != nil {
@@ -187,8 +290,14 @@ func (s *Service) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream) (e
 	pseudoSettlePeer.lock.Lock()
 	defer pseudoSettlePeer.lock.Unlock()
 
-	allowance, timestamp, err := s.peerAllowance(p.Address)
+	rate := s.grantedRate(pseudoSettlePeer.fullNode, req.Rate)
+	allowance, timestamp, err := s.peerAllowance(p.Address, rate)
 	if err != nil {
+		if errors.Is(err, ErrSettlementTooSoon) {
+			if err := s.refuse(p.Address, attemptedAmount); err != nil {
+				s.logger.Debugf("pseudosettle: record refused refreshment of peer %v: %v", p.Address, err)
+			}
+		}
 		return err
 	}
 
@@ -206,6 +315,7 @@ func (s *Service) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream) (e
 	err = w.WriteMsgWithContext(ctx, &pb.PaymentAck{
 		Amount:    paymentAmount.Bytes(),
 		Timestamp: timestamp,
+		Rate:      rate.Bytes(),
 	})
 	if err != nil {
 		return err
@@ -223,6 +333,15 @@ func (s *Service) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream) (e
 	lastTime.Total = lastTime.Total.Add(lastTime.Total, paymentAmount)
 	lastTime.Timestamp = timestamp
 
+	err = s.record(p.Address, HistoryReceivedPrefix, &lastTime, Refreshment{
+		Timestamp: timestamp,
+		Attempted: attemptedAmount,
+		Accepted:  paymentAmount,
+	}, paymentAmount.Sign() == 0)
+	if err != nil {
+		return err
+	}
+
 	err = s.store.Put(totalKey(p.Address, SettlementReceivedPrefix), lastTime)
 	if err != nil {
 		return err
@@ -233,6 +352,28 @@ func (s *Service) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream) (e
 	return s.accounting.NotifyRefreshmentReceived(p.Address, paymentAmount)
 }
 
+// refuse records a refreshment of the peer refused as it came too soon after
+// the last one.
+func (s *Service) refuse(peer penguin.Address, attemptedAmount *big.Int) error {
+	var lastTime lastPayment
+	err := s.store.Get(totalKey(peer, SettlementReceivedPrefix), &lastTime)
+	if err != nil {
+		// without a previous refreshment it can not come too soon
+		return err
+	}
+
+	err = s.record(peer, HistoryReceivedPrefix, &lastTime, Refreshment{
+		Timestamp: s.timeNow().Unix(),
+		Attempted: attemptedAmount,
+		Accepted:  big.NewInt(0),
+	}, true)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Put(totalKey(peer, SettlementReceivedPrefix), lastTime)
+}
+
 // Pay initiates a payment to the given peer
 func (s *Service) Pay(ctx context.Context, peer penguin.Address, amount *big.Int, checkAllowance *big.Int) (*big.Int, int64, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -276,6 +417,7 @@ func (s *Service) Pay(ctx context.Context, peer penguin.Address, amount *big.Int
 
 	err = w.WriteMsgWithContext(ctx, &pb.Payment{
 		Amount: amount.Bytes(),
+		Rate:   s.rate(s.fullNode).Bytes(),
 	})
 	if err != nil {
 		return nil, 0, err
@@ -313,14 +455,24 @@ func (s *Service) Pay(ctx context.Context, peer penguin.Address, amount *big.Int
 		return nil, 0, ErrTimeOutOfSync
 	}
 
-	// enforce allowance
-	// check if value is appropriate
-	expectedAllowance := new(big.Int).Mul(big.NewInt(allegedInterval), s.refreshRate)
+	// enforce allowance at the rate agreed with the peer, the lower of the
+	// rate we expect and the rate the peer granted
+	rate := s.rate(s.fullNode)
+	agreed := len(paymentAck.Rate) > 0
+	if agreed {
+		if grantedRate := new(big.Int).SetBytes(paymentAck.Rate); grantedRate.Cmp(rate) < 0 {
+			rate = grantedRate
+		}
+	}
+	expectedAllowance := new(big.Int).Mul(big.NewInt(allegedInterval), rate)
 	if expectedAllowance.Cmp(checkAllowance) > 0 {
 		expectedAllowance = new(big.Int).Set(checkAllowance)
 	}
 
-	if expectedAllowance.Cmp(acceptedAmount) > 0 {
+	refused := expectedAllowance.Cmp(acceptedAmount) > 0
+	// peers not telling the granted rate may grant another rate than we
+	// expect, their refused refreshments are only recorded
+	if refused && agreed {
 		// disconnect peer
 		err = s.p2pService.Blocklist(peer, 1*time.Hour)
 		if err != nil {
@@ -332,6 +484,16 @@ func (s *Service) Pay(ctx context.Context, peer penguin.Address, amount *big.Int
 	lastTime.Timestamp = paymentAck.Timestamp
 	lastTime.CheckTimestamp = checkTime
 
+	err = s.record(peer, HistorySentPrefix, &lastTime, Refreshment{
+		Timestamp: paymentAck.Timestamp,
+		Sent:      true,
+		Attempted: amount,
+		Accepted:  acceptedAmount,
+	}, refused)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	err = s.store.Put(totalKey(peer, SettlementSentPrefix), lastTime)
 	if err != nil {
 		return nil, 0, err
@@ -426,3 +588,84 @@ func (s *Service) SettlementsReceived() (map[string]*big.Int, error) {
 	}
 	return received, nil
 }
+
+// PeerAllowance returns the time based allowance of a connected peer.
+func (s *Service) PeerAllowance(peer penguin.Address) (*PeerAllowance, error) {
+	s.peersMu.Lock()
+	pseudoSettlePeer, ok := s.peers[peer.String()]
+	s.peersMu.Unlock()
+	if !ok {
+		return nil, ErrNoPseudoSettlePeer
+	}
+
+	pseudoSettlePeer.lock.Lock()
+	defer pseudoSettlePeer.lock.Unlock()
+
+	var received, sent lastPayment
+	err := s.store.Get(totalKey(peer, SettlementReceivedPrefix), &received)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	err = s.store.Get(totalKey(peer, SettlementSentPrefix), &sent)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	allowance, _, err := s.peerAllowance(peer, s.rate(pseudoSettlePeer.fullNode))
+	if err != nil {
+		if !errors.Is(err, ErrSettlementTooSoon) {
+			return nil, err
+		}
+		allowance = big.NewInt(0)
+	}
+	if allowance.Sign() < 0 {
+		allowance = big.NewInt(0)
+	}
+
+	return &PeerAllowance{
+		Peer:            peer,
+		FullNode:        pseudoSettlePeer.fullNode,
+		RefreshRate:     s.rate(pseudoSettlePeer.fullNode),
+		Allowance:       allowance,
+		LastReceived:    received.Timestamp,
+		LastSent:        sent.Timestamp,
+		RefusedReceived: received.Refused,
+		RefusedSent:     sent.Refused,
+	}, nil
+}
+
+// History returns the most recent refreshments with a peer, newest first.
+func (s *Service) History(peer penguin.Address) ([]Refreshment, error) {
+	history := make([]Refreshment, 0)
+	for _, prefixes := range [][2]string{
+		{SettlementReceivedPrefix, HistoryReceivedPrefix},
+		{SettlementSentPrefix, HistorySentPrefix},
+	} {
+		var lastTime lastPayment
+		err := s.store.Get(totalKey(peer, prefixes[0]), &lastTime)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		n := lastTime.Refreshments
+		if n > historySize {
+			n = historySize
+		}
+		for i := lastTime.Refreshments; i > lastTime.Refreshments-n; i-- {
+			var r Refreshment
+			err := s.store.Get(historyKey(peer, prefixes[1], i-1), &r)
+			if err != nil {
+				return nil, fmt.Errorf("get peer %s refreshment: %w", peer, err)
+			}
+			history = append(history, r)
+		}
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Timestamp > history[j].Timestamp
+	})
+	return history, nil
+}
@@ -88,7 +88,10 @@ func (t *testObserver) Reserve(ctx context.Context, peer penguin.Address, amount
 func (t *testObserver) Release(peer penguin.Address, amount uint64) {
 }
 
-var testRefreshRate = int64(10000)
+var (
+	testRefreshRate      = int64(10000)
+	testLightRefreshRate = int64(1000)
+)
 
 func TestPayment(t *testing.T) {
 	logger := logging.New(ioutil.Discard, 0)
@@ -97,12 +100,12 @@ func TestPayment(t *testing.T) {
 	defer storeRecipient.Close()
 
 	peerID := penguin.MustParseHexAddress("9ee7add7")
-	peer := p2p.Peer{Address: peerID}
+	peer := p2p.Peer{Address: peerID, FullNode: true}
 
 	debt := int64(10000)
 
 	observer := newTestObserver(map[string]*big.Int{peerID.String(): big.NewInt(debt)}, map[string]*big.Int{})
-	recipient := pseudosettle.New(nil, logger, storeRecipient, observer, big.NewInt(testRefreshRate), mockp2p.New())
+	recipient := pseudosettle.New(nil, logger, storeRecipient, observer, big.NewInt(testRefreshRate), big.NewInt(testLightRefreshRate), true, mockp2p.New())
 	recipient.SetAccounting(observer)
 	err := recipient.Init(context.Background(), peer)
 	if err != nil {
@@ -118,7 +121,7 @@ func TestPayment(t *testing.T) {
 	defer storePayer.Close()
 
 	observer2 := newTestObserver(map[string]*big.Int{}, map[string]*big.Int{peerID.String(): big.NewInt(debt)})
-	payer := pseudosettle.New(recorder, logger, storePayer, observer2, big.NewInt(testRefreshRate), mockp2p.New())
+	payer := pseudosettle.New(recorder, logger, storePayer, observer2, big.NewInt(testRefreshRate), big.NewInt(testLightRefreshRate), true, mockp2p.New())
 	payer.SetAccounting(observer2)
 
 	amount := big.NewInt(debt)
@@ -217,12 +220,12 @@ func TestTimeLimitedPayment(t *testing.T) {
 	defer storeRecipient.Close()
 
 	peerID := penguin.MustParseHexAddress("9ee7add7")
-	peer := p2p.Peer{Address: peerID}
+	peer := p2p.Peer{Address: peerID, FullNode: true}
 
 	debt := testRefreshRate
 
 	observer := newTestObserver(map[string]*big.Int{peerID.String(): big.NewInt(debt)}, map[string]*big.Int{})
-	recipient := pseudosettle.New(nil, logger, storeRecipient, observer, big.NewInt(testRefreshRate), mockp2p.New())
+	recipient := pseudosettle.New(nil, logger, storeRecipient, observer, big.NewInt(testRefreshRate), big.NewInt(testLightRefreshRate), true, mockp2p.New())
 	recipient.SetAccounting(observer)
 	err := recipient.Init(context.Background(), peer)
 	if err != nil {
@@ -238,7 +241,7 @@ func TestTimeLimitedPayment(t *testing.T) {
 	defer storePayer.Close()
 
 	observer2 := newTestObserver(map[string]*big.Int{}, map[string]*big.Int{peerID.String(): big.NewInt(debt)})
-	payer := pseudosettle.New(recorder, logger, storePayer, observer2, big.NewInt(testRefreshRate), mockp2p.New())
+	payer := pseudosettle.New(recorder, logger, storePayer, observer2, big.NewInt(testRefreshRate), big.NewInt(testLightRefreshRate), true, mockp2p.New())
 	payer.SetAccounting(observer2)
 
 	payer.SetTime(int64(10000))
@@ -778,3 +781,191 @@ func TestTimeLimitedPayment(t *testing.T) {
 		t.Fatalf("stored wrong totalReceived. got %d, want %d", totalReceived, sentSum)
 	}
 }
+
+func TestLightPeerAllowance(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+
+	storeRecipient := mock.NewStateStore()
+	defer storeRecipient.Close()
+
+	peerID := penguin.MustParseHexAddress("9ee7add7")
+	peer := p2p.Peer{Address: peerID, FullNode: false}
+
+	debt := 10 * testRefreshRate
+
+	observer := newTestObserver(map[string]*big.Int{peerID.String(): big.NewInt(debt)}, map[string]*big.Int{})
+	recipient := pseudosettle.New(nil, logger, storeRecipient, observer, big.NewInt(testRefreshRate), big.NewInt(testLightRefreshRate), true, mockp2p.New())
+	recipient.SetAccounting(observer)
+	err := recipient.Init(context.Background(), peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := streamtest.New(
+		streamtest.WithProtocols(recipient.Protocol()),
+		streamtest.WithBaseAddr(peerID),
+	)
+
+	storePayer := mock.NewStateStore()
+	defer storePayer.Close()
+
+	observer2 := newTestObserver(map[string]*big.Int{}, map[string]*big.Int{})
+	payer := pseudosettle.New(recorder, logger, storePayer, observer2, big.NewInt(testRefreshRate), big.NewInt(testLightRefreshRate), false, mockp2p.New())
+	payer.SetAccounting(observer2)
+
+	pay := func(now int64, want int64) {
+		t.Helper()
+		payer.SetTime(now)
+		recipient.SetTime(now)
+
+		amount := big.NewInt(debt)
+		acceptedAmount, _, err := payer.Pay(context.Background(), peerID, amount, amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if acceptedAmount.Cmp(big.NewInt(want)) != 0 {
+			t.Fatalf("wrong accepted amount. got %d, want %d", acceptedAmount, want)
+		}
+		<-observer.receivedCalled
+	}
+
+	pay(10000, debt)
+	// light peers are granted the light refresh rate
+	pay(10002, 2*testLightRefreshRate)
+
+	// the payer clock is ahead, the refreshment comes too soon for the recipient
+	payer.SetTime(10003)
+	if _, _, err := payer.Pay(context.Background(), peerID, big.NewInt(debt), big.NewInt(debt)); err == nil {
+		t.Fatal("expected refreshment to be refused")
+	}
+
+	recipient.SetTime(10005)
+	allowance, err := recipient.PeerAllowance(peerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowance.FullNode {
+		t.Fatal("light peer reported as full node")
+	}
+	if allowance.RefreshRate.Cmp(big.NewInt(testLightRefreshRate)) != 0 {
+		t.Fatalf("wrong refresh rate. got %d, want %d", allowance.RefreshRate, testLightRefreshRate)
+	}
+	if want := big.NewInt(3 * testLightRefreshRate); allowance.Allowance.Cmp(want) != 0 {
+		t.Fatalf("wrong allowance. got %d, want %d", allowance.Allowance, want)
+	}
+	if allowance.LastReceived != 10002 {
+		t.Fatalf("wrong last received timestamp. got %d, want %d", allowance.LastReceived, 10002)
+	}
+	if allowance.RefusedReceived != 1 {
+		t.Fatalf("wrong number of refused refreshments. got %d, want %d", allowance.RefusedReceived, 1)
+	}
+
+	history, err := recipient.History(peerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("got %d refreshments in history, want %d", len(history), 3)
+	}
+	if history[0].Accepted.Sign() != 0 || history[0].Sent {
+		t.Fatalf("newest refreshment is not the refused one: %+v", history[0])
+	}
+	if history[2].Accepted.Cmp(big.NewInt(debt)) != 0 {
+		t.Fatalf("wrong oldest refreshment: %+v", history[2])
+	}
+
+	history, err = payer.History(peerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || !history[0].Sent {
+		t.Fatalf("wrong payer history: %+v", history)
+	}
+
+	if _, err := payer.PeerAllowance(penguin.MustParseHexAddress("aa")); !errors.Is(err, pseudosettle.ErrNoPseudoSettlePeer) {
+		t.Fatalf("got error %v, want %v", err, pseudosettle.ErrNoPseudoSettlePeer)
+	}
+}
+
+func TestDifferentRefreshRates(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+
+	peerID := penguin.MustParseHexAddress("9ee7add7")
+	peer := p2p.Peer{Address: peerID, FullNode: false}
+
+	debt := 10 * testRefreshRate
+
+	newRecipient := func() (*pseudosettle.Service, *testObserver, *streamtest.Recorder) {
+		observer := newTestObserver(map[string]*big.Int{peerID.String(): big.NewInt(debt)}, map[string]*big.Int{})
+		recipient := pseudosettle.New(nil, logger, mock.NewStateStore(), observer, big.NewInt(testRefreshRate), big.NewInt(testLightRefreshRate), true, mockp2p.New())
+		recipient.SetAccounting(observer)
+		if err := recipient.Init(context.Background(), peer); err != nil {
+			t.Fatal(err)
+		}
+		recorder := streamtest.New(
+			streamtest.WithProtocols(recipient.Protocol()),
+			streamtest.WithBaseAddr(peerID),
+		)
+		return recipient, observer, recorder
+	}
+
+	t.Run("payer expects a higher rate", func(t *testing.T) {
+		recipient, observer, recorder := newRecipient()
+
+		blocklisted := false
+		observer2 := newTestObserver(map[string]*big.Int{}, map[string]*big.Int{})
+		payer := pseudosettle.New(recorder, logger, mock.NewStateStore(), observer2, big.NewInt(testRefreshRate), big.NewInt(2*testLightRefreshRate), false, mockp2p.New(
+			mockp2p.WithBlocklistFunc(func(penguin.Address, time.Duration) error {
+				blocklisted = true
+				return nil
+			}),
+		))
+		payer.SetAccounting(observer2)
+
+		for _, now := range []int64{10000, 10002} {
+			payer.SetTime(now)
+			recipient.SetTime(now)
+			if _, _, err := payer.Pay(context.Background(), peerID, big.NewInt(debt), big.NewInt(debt)); err != nil {
+				t.Fatal(err)
+			}
+			<-observer.receivedCalled
+		}
+
+		// the payer accepts the lower rate granted by the recipient
+		totalSent, err := payer.TotalSent(peerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := big.NewInt(debt + 2*testLightRefreshRate); totalSent.Cmp(want) != 0 {
+			t.Fatalf("got total sent %d, want %d", totalSent, want)
+		}
+		if blocklisted {
+			t.Fatal("peer blocklisted for granting its own rate")
+		}
+	})
+
+	t.Run("payer without rate", func(t *testing.T) {
+		recipient, _, recorder := newRecipient()
+		recipient.SetTime(10000)
+
+		stream, err := recorder.NewStream(context.Background(), peerID, nil, "pseudosettle", "1.0.0", "pseudosettle")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stream.Close()
+
+		w, r := protobuf.NewWriterAndReader(stream)
+		if err := w.WriteMsg(&pb.Payment{Amount: big.NewInt(debt).Bytes()}); err != nil {
+			t.Fatal(err)
+		}
+		var ack pb.PaymentAck
+		if err := r.ReadMsg(&ack); err != nil {
+			t.Fatal(err)
+		}
+
+		// payers not telling their rate enforce the full refresh rate
+		if rate := new(big.Int).SetBytes(ack.Rate); rate.Cmp(big.NewInt(testRefreshRate)) != 0 {
+			t.Fatalf("got granted rate %d, want %d", rate, testRefreshRate)
+		}
+	})
+}
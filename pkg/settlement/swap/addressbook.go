@@ -8,6 +8,7 @@ import (
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
 	"github.com/penguintop/penguin/pkg/storage"
     "github.com/penguintop/penguin/pkg/penguin"
 )
@@ -15,6 +16,7 @@ import (
 var (
 	peerPrefix            = "swap_chequebook_peer_"
 	peerChequebookPrefix  = "swap_peer_chequebook_"
+	peerIssuerPrefix      = "swap_issuer_peer_"
 	beneficiaryPeerPrefix = "swap_beneficiary_peer_"
 	peerBeneficiaryPrefix = "swap_peer_beneficiary_"
 )
@@ -23,16 +25,17 @@ var (
 type Addressbook interface {
 	// Beneficiary returns the beneficiary for the given peer.
 	Beneficiary(peer penguin.Address) (beneficiary common.Address, known bool, err error)
-	// Chequebook returns the chequebook for the given peer.
-	Chequebook(peer penguin.Address) (chequebookAddress common.Address, known bool, err error)
+	// Chequebook returns the chequebook for the given peer, with the issuer
+	// if the peer issues delegated cheques of a multi-issuer chequebook.
+	Chequebook(peer penguin.Address) (source chequebook.ChequeSource, known bool, err error)
 	// BeneficiaryPeer returns the peer for a beneficiary.
 	BeneficiaryPeer(beneficiary common.Address) (peer penguin.Address, known bool, err error)
-	// ChequebookPeer returns the peer for a beneficiary.
-	ChequebookPeer(chequebook common.Address) (peer penguin.Address, known bool, err error)
+	// ChequebookPeer returns the peer for a chequebook and issuer.
+	ChequebookPeer(source chequebook.ChequeSource) (peer penguin.Address, known bool, err error)
 	// PutBeneficiary stores the beneficiary for the given peer.
 	PutBeneficiary(peer penguin.Address, beneficiary common.Address) error
-	// PutChequebook stores the chequebook for the given peer.
-	PutChequebook(peer penguin.Address, chequebook common.Address) error
+	// PutChequebook stores the chequebook and issuer for the given peer.
+	PutChequebook(peer penguin.Address, source chequebook.ChequeSource) error
 }
 
 type addressbook struct {
@@ -70,21 +73,26 @@ func (a *addressbook) BeneficiaryPeer(beneficiary common.Address) (peer penguin.
 	return peer, true, nil
 }
 
-// Chequebook returns the chequebook for the given peer.
-func (a *addressbook) Chequebook(peer penguin.Address) (chequebookAddress common.Address, known bool, err error) {
-	err = a.store.Get(peerKey(peer), &chequebookAddress)
+// Chequebook returns the chequebook for the given peer, with the issuer if
+// the peer issues delegated cheques of a multi-issuer chequebook.
+func (a *addressbook) Chequebook(peer penguin.Address) (source chequebook.ChequeSource, known bool, err error) {
+	err = a.store.Get(peerKey(peer), &source.Chequebook)
 	if err != nil {
 		if err != storage.ErrNotFound {
-			return common.Address{}, false, err
+			return chequebook.ChequeSource{}, false, err
 		}
-		return common.Address{}, false, nil
+		return chequebook.ChequeSource{}, false, nil
 	}
-	return chequebookAddress, true, nil
+	err = a.store.Get(peerIssuerKey(peer), &source.Issuer)
+	if err != nil && err != storage.ErrNotFound {
+		return chequebook.ChequeSource{}, false, err
+	}
+	return source, true, nil
 }
 
-// ChequebookPeer returns the peer for a beneficiary.
-func (a *addressbook) ChequebookPeer(chequebook common.Address) (peer penguin.Address, known bool, err error) {
-	err = a.store.Get(chequebookPeerKey(chequebook), &peer)
+// ChequebookPeer returns the peer for a chequebook and issuer.
+func (a *addressbook) ChequebookPeer(source chequebook.ChequeSource) (peer penguin.Address, known bool, err error) {
+	err = a.store.Get(chequebookPeerKey(source), &peer)
 	if err != nil {
 		if err != storage.ErrNotFound {
 			return penguin.Address{}, false, err
@@ -103,13 +111,19 @@ func (a *addressbook) PutBeneficiary(peer penguin.Address, beneficiary common.Ad
 	return a.store.Put(beneficiaryPeerKey(beneficiary), peer)
 }
 
-// PutChequebook stores the chequebook for the given peer.
-func (a *addressbook) PutChequebook(peer penguin.Address, chequebook common.Address) error {
-	err := a.store.Put(peerKey(peer), chequebook)
+// PutChequebook stores the chequebook and issuer for the given peer.
+func (a *addressbook) PutChequebook(peer penguin.Address, source chequebook.ChequeSource) error {
+	err := a.store.Put(peerKey(peer), source.Chequebook)
 	if err != nil {
 		return err
 	}
-	return a.store.Put(chequebookPeerKey(chequebook), peer)
+	if source.Delegated() {
+		err = a.store.Put(peerIssuerKey(peer), source.Issuer)
+		if err != nil {
+			return err
+		}
+	}
+	return a.store.Put(chequebookPeerKey(source), peer)
 }
 
 // peerKey computes the key where to store the chequebook from a peer.
@@ -117,9 +131,18 @@ func peerKey(peer penguin.Address) string {
 	return fmt.Sprintf("%s%s", peerPrefix, peer)
 }
 
-// chequebookPeerKey computes the key where to store the peer for a chequebook.
-func chequebookPeerKey(chequebook common.Address) string {
-	return fmt.Sprintf("%s%s", peerChequebookPrefix, chequebook)
+// peerIssuerKey computes the key where to store the issuer of the delegated cheques from a peer.
+func peerIssuerKey(peer penguin.Address) string {
+	return fmt.Sprintf("%s%s", peerIssuerPrefix, peer)
+}
+
+// chequebookPeerKey computes the key where to store the peer for a chequebook
+// and, for delegated cheques, the issuer.
+func chequebookPeerKey(source chequebook.ChequeSource) string {
+	if source.Delegated() {
+		return fmt.Sprintf("%s%s_%s", peerChequebookPrefix, source.Chequebook, source.Issuer)
+	}
+	return fmt.Sprintf("%s%s", peerChequebookPrefix, source.Chequebook)
 }
 
 // peerBeneficiaryKey computes the key where to store the beneficiary for a peer.
@@ -0,0 +1,289 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chequebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/penguintop/penguin/pkg/transaction"
+)
+
+const (
+	// maxAutoCashoutBackoffShift limits the growth of the retry backoff.
+	maxAutoCashoutBackoffShift = 8
+
+	// DefaultAutoCashoutInterval is the default interval between the
+	// checks of the received cheques.
+	DefaultAutoCashoutInterval = 5 * time.Minute
+	// DefaultAutoCashoutFeeMultiplier is the default minimal ratio of
+	// the payout to the transaction fee.
+	DefaultAutoCashoutFeeMultiplier = 2
+	// DefaultAutoCashoutMaxCashouts is the default limit of the cashout
+	// transactions sent in a check.
+	DefaultAutoCashoutMaxCashouts = 10
+	// DefaultAutoCashoutRetryBackoff is the default time to wait after
+	// a failed cashout.
+	DefaultAutoCashoutRetryBackoff = 10 * time.Minute
+)
+
+// AutoCashoutOptions configure when the received cheques are cashed.
+type AutoCashoutOptions struct {
+	// Interval between the checks of the received cheques.
+	Interval time.Duration
+	// Threshold is the uncashed amount of a chequebook above which it is
+	// cashed out.
+	Threshold *big.Int
+	// TransactionFee is the expected cost of a cashout transaction.
+	TransactionFee *big.Int
+	// FeeMultiplier is the minimal ratio of the payout to the transaction fee.
+	// Chequebooks with smaller payouts are not cashed, even if the issuer is
+	// running out of funds.
+	FeeMultiplier int64
+	// MaxCashouts limits the number of cashout transactions sent in a check.
+	MaxCashouts int
+	// RetryBackoff is the time to wait after a failed cashout, doubled with
+	// every subsequent failure.
+	RetryBackoff time.Duration
+}
+
+// AutoCashout cashes the received cheques in the background, when the
+// uncashed amount of a chequebook exceeds the threshold or when the balance
+// of the chequebook is lower than the uncashed amount.
+type AutoCashout struct {
+	logger      logging.Logger
+	store       storage.StateStorer
+	chequeStore ChequeStore
+	cashout     CashoutService
+	recipient   common.Address
+	balance     func(ctx context.Context, chequebook common.Address) (*big.Int, error)
+	options     AutoCashoutOptions
+	timeNow     func() time.Time
+
+	wg     sync.WaitGroup
+	quit   chan struct{}
+	cancel context.CancelFunc
+}
+
+// autoCashoutState is the persisted state of the automatic cashouts of a
+// chequebook.
+type autoCashoutState struct {
+	Failures    uint
+	NextAttempt int64 // unix time before which the chequebook is not cashed
+	TxHash      common.Hash
+}
+
+// autoCashoutCandidate is a cheque source selected for a cashout.
+type autoCashoutCandidate struct {
+	source ChequeSource
+	payout *big.Int
+	atRisk bool
+}
+
+// NewAutoCashout creates the automatic cashout of the received cheques. The
+// funds are sent to the recipient, usually the own chequebook.
+func NewAutoCashout(
+	logger logging.Logger,
+	store storage.StateStorer,
+	chequeStore ChequeStore,
+	cashout CashoutService,
+	transactionService transaction.Service,
+	recipient common.Address,
+	o AutoCashoutOptions,
+) *AutoCashout {
+	return &AutoCashout{
+		logger:      logger,
+		store:       store,
+		chequeStore: chequeStore,
+		cashout:     cashout,
+		recipient:   recipient,
+		balance: func(ctx context.Context, chequebook common.Address) (*big.Int, error) {
+			return newChequebookContract(chequebook, transactionService).Balance(ctx)
+		},
+		options: o,
+		timeNow: time.Now,
+		quit:    make(chan struct{}),
+	}
+}
+
+// autoCashoutStateKey computes the store key for the automatic cashout state
+// of the cheque source.
+func autoCashoutStateKey(source ChequeSource) string {
+	if source.Delegated() {
+		return fmt.Sprintf("swap_autocashout_%x_%x", source.Chequebook, source.Issuer)
+	}
+	return fmt.Sprintf("swap_autocashout_%x", source.Chequebook)
+}
+
+// Start starts the periodic checks of the received cheques.
+func (a *AutoCashout) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(a.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.quit:
+				return
+			case <-ticker.C:
+			}
+			if err := a.Check(ctx); err != nil {
+				a.logger.Debugf("auto cashout: %v", err)
+				a.logger.Error("auto cashout: check failed")
+			}
+		}
+	}()
+}
+
+// Check cashes the chequebooks that need a cashout now, sending at most
+// MaxCashouts transactions. Chequebooks with issuers running out of funds
+// are cashed first, followed by the ones with the largest payout.
+func (a *AutoCashout) Check(ctx context.Context) error {
+	cheques, err := a.chequeStore.LastCheques()
+	if err != nil {
+		return fmt.Errorf("last cheques: %w", err)
+	}
+
+	now := a.timeNow().Unix()
+	minPayout := new(big.Int).Mul(a.options.TransactionFee, big.NewInt(a.options.FeeMultiplier))
+
+	var candidates []autoCashoutCandidate
+	for source := range cheques {
+		state, err := a.state(source)
+		if err != nil {
+			return err
+		}
+		if now < state.NextAttempt {
+			continue
+		}
+
+		candidate, ok, err := a.candidate(ctx, source, minPayout)
+		if err != nil {
+			a.logger.Debugf("auto cashout: chequebook %s: %v", source, err)
+			continue
+		}
+		if ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].atRisk != candidates[j].atRisk {
+			return candidates[i].atRisk
+		}
+		return candidates[i].payout.Cmp(candidates[j].payout) > 0
+	})
+	if a.options.MaxCashouts > 0 && len(candidates) > a.options.MaxCashouts {
+		candidates = candidates[:a.options.MaxCashouts]
+	}
+
+	for _, c := range candidates {
+		if err := a.cashCheque(ctx, c, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// candidate decides if the cheque source needs a cashout. Delegated cheques
+// are paid from the balance of the chequebook they were issued on as well.
+func (a *AutoCashout) candidate(ctx context.Context, source ChequeSource, minPayout *big.Int) (c autoCashoutCandidate, ok bool, err error) {
+	status, err := a.cashout.CashoutStatus(ctx, source)
+	if err != nil {
+		return c, false, fmt.Errorf("cashout status: %w", err)
+	}
+	// wait for the last cashout to be confirmed
+	if status.Last != nil && status.Last.Result == nil && !status.Last.Reverted {
+		return c, false, nil
+	}
+	uncashed := status.UncashedAmount
+	if uncashed.Sign() <= 0 {
+		return c, false, nil
+	}
+
+	balance, err := a.balance(ctx, source.Chequebook)
+	if err != nil {
+		return c, false, fmt.Errorf("chequebook balance: %w", err)
+	}
+
+	// the issuer can not pay out more than the balance of the chequebook
+	payout := uncashed
+	atRisk := balance.Cmp(uncashed) < 0
+	if atRisk {
+		payout = balance
+	}
+	if payout.Cmp(minPayout) < 0 {
+		return c, false, nil
+	}
+	if !atRisk && uncashed.Cmp(a.options.Threshold) < 0 {
+		return c, false, nil
+	}
+
+	return autoCashoutCandidate{
+		source: source,
+		payout: payout,
+		atRisk: atRisk,
+	}, true, nil
+}
+
+// cashCheque cashes the chequebook, persisting the outcome so that failing
+// chequebooks are retried with a backoff also after a restart.
+func (a *AutoCashout) cashCheque(ctx context.Context, c autoCashoutCandidate, now int64) error {
+	state, err := a.state(c.source)
+	if err != nil {
+		return err
+	}
+
+	txHash, err := a.cashout.CashCheque(ctx, c.source, a.recipient)
+	if err != nil {
+		a.logger.Debugf("auto cashout: cash chequebook %s: %v", c.source, err)
+		a.logger.Errorf("auto cashout: cashing chequebook %s failed", c.source)
+		shift := state.Failures
+		if shift > maxAutoCashoutBackoffShift {
+			shift = maxAutoCashoutBackoffShift
+		}
+		backoff := a.options.RetryBackoff << shift
+		state.Failures++
+		state.NextAttempt = now + int64(backoff/time.Second)
+	} else {
+		a.logger.Infof("auto cashout: cashing chequebook %s, payout %d, transaction %x", c.source, c.payout, txHash)
+		state.Failures = 0
+		state.NextAttempt = 0
+		state.TxHash = txHash
+	}
+
+	return a.store.Put(autoCashoutStateKey(c.source), state)
+}
+
+func (a *AutoCashout) state(source ChequeSource) (*autoCashoutState, error) {
+	state := new(autoCashoutState)
+	if err := a.store.Get(autoCashoutStateKey(source), state); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Close stops the periodic checks, waiting for the running one to finish.
+func (a *AutoCashout) Close() error {
+	close(a.quit)
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.wg.Wait()
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chequebook_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
+	chequestoremock "github.com/penguintop/penguin/pkg/settlement/swap/chequestore/mock"
+	storemock "github.com/penguintop/penguin/pkg/statestore/mock"
+	transactionmock "github.com/penguintop/penguin/pkg/transaction/mock"
+)
+
+type cashoutServiceMock struct {
+	cashCheque    func(ctx context.Context, source chequebook.ChequeSource, recipient common.Address) (common.Hash, error)
+	cashoutStatus func(ctx context.Context, source chequebook.ChequeSource) (*chequebook.CashoutStatus, error)
+}
+
+func (m *cashoutServiceMock) CashCheque(ctx context.Context, source chequebook.ChequeSource, recipient common.Address) (common.Hash, error) {
+	return m.cashCheque(ctx, source, recipient)
+}
+
+func (m *cashoutServiceMock) CashoutStatus(ctx context.Context, source chequebook.ChequeSource) (*chequebook.CashoutStatus, error) {
+	return m.cashoutStatus(ctx, source)
+}
+
+func TestAutoCashout(t *testing.T) {
+	type book struct {
+		uncashed int64
+		balance  int64
+		pending  bool
+		fail     bool
+	}
+	var (
+		overThreshold = common.HexToAddress("01")
+		atRisk        = common.HexToAddress("02")
+		underLimit    = common.HexToAddress("03")
+		tooSmall      = common.HexToAddress("04")
+		pending       = common.HexToAddress("05")
+		smallerPayout = common.HexToAddress("06")
+		failing       = common.HexToAddress("07")
+		recipient     = common.HexToAddress("ffff")
+	)
+	books := map[common.Address]book{
+		overThreshold: {uncashed: 1000, balance: 5000},
+		atRisk:        {uncashed: 100, balance: 50},
+		underLimit:    {uncashed: 100, balance: 1000},
+		tooSmall:      {uncashed: 1000, balance: 5},
+		pending:       {uncashed: 1000, balance: 5000, pending: true},
+		smallerPayout: {uncashed: 700, balance: 5000},
+		failing:       {uncashed: 900, balance: 5000, fail: true},
+	}
+
+	var cashed []common.Address
+	cashout := &cashoutServiceMock{
+		cashCheque: func(ctx context.Context, source chequebook.ChequeSource, r common.Address) (common.Hash, error) {
+			if r != recipient {
+				t.Fatalf("got recipient %x, want %x", r, recipient)
+			}
+			if books[source.Chequebook].fail {
+				return common.Hash{}, errors.New("cashout failed")
+			}
+			cashed = append(cashed, source.Chequebook)
+			return common.HexToHash("aa"), nil
+		},
+		cashoutStatus: func(ctx context.Context, source chequebook.ChequeSource) (*chequebook.CashoutStatus, error) {
+			status := &chequebook.CashoutStatus{UncashedAmount: big.NewInt(books[source.Chequebook].uncashed)}
+			if books[source.Chequebook].pending {
+				status.Last = &chequebook.LastCashout{}
+			}
+			return status, nil
+		},
+	}
+	chequeStore := chequestoremock.NewChequeStore(
+		chequestoremock.WithLastChequesFunc(func() (map[chequebook.ChequeSource]*chequebook.SignedCheque, error) {
+			cheques := make(map[chequebook.ChequeSource]*chequebook.SignedCheque)
+			for address := range books {
+				cheques[chequebook.ChequeSource{Chequebook: address}] = &chequebook.SignedCheque{}
+			}
+			return cheques, nil
+		}),
+	)
+	store := storemock.NewStateStore()
+
+	newAutoCashout := func(maxCashouts int, now int64) *chequebook.AutoCashout {
+		a := chequebook.NewAutoCashout(logging.New(ioutil.Discard, 0), store, chequeStore, cashout, transactionmock.New(), recipient, chequebook.AutoCashoutOptions{
+			Interval:       time.Minute,
+			Threshold:      big.NewInt(500),
+			TransactionFee: big.NewInt(10),
+			FeeMultiplier:  2,
+			MaxCashouts:    maxCashouts,
+			RetryBackoff:   time.Hour,
+		})
+		a.SetBalanceFunc(func(ctx context.Context, address common.Address) (*big.Int, error) {
+			return big.NewInt(books[address].balance), nil
+		})
+		a.SetTimeNow(func() time.Time { return time.Unix(now, 0) })
+		return a
+	}
+	expectCashed := func(t *testing.T, want ...common.Address) {
+		t.Helper()
+
+		if len(cashed) != len(want) {
+			t.Fatalf("got cashed %x, want %x", cashed, want)
+		}
+		for i := range want {
+			if cashed[i] != want[i] {
+				t.Fatalf("got cashed %x, want %x", cashed, want)
+			}
+		}
+		cashed = nil
+	}
+
+	// the chequebook at risk is cashed first, followed by the largest payouts
+	if err := newAutoCashout(3, 0).Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectCashed(t, atRisk, overThreshold)
+
+	// the failing chequebook is not retried before the backoff, also after a restart
+	books[atRisk] = book{uncashed: 100, balance: 50, pending: true}
+	books[overThreshold] = book{uncashed: 1000, balance: 5000, pending: true}
+	if err := newAutoCashout(1, 60).Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectCashed(t, smallerPayout)
+
+	books[failing] = book{uncashed: 900, balance: 5000}
+	if err := newAutoCashout(1, 3600).Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectCashed(t, failing)
+}
@@ -27,12 +27,12 @@ var (
 	ErrNoCashout = errors.New("no prior cashout")
 )
 
-// CashoutService is the service responsible for managing cashout actions
+// CashoutService is the service responsible for managing cashout actions.
 type CashoutService interface {
-	// CashCheque sends a cashing transaction for the last cheque of the chequebook
-	CashCheque(ctx context.Context, chequebook common.Address, recipient common.Address) (common.Hash, error)
-	// CashoutStatus gets the status of the latest cashout transaction for the chequebook
-	CashoutStatus(ctx context.Context, chequebookAddress common.Address) (*CashoutStatus, error)
+	// CashCheque sends a cashing transaction for the last cheque of the cheque source
+	CashCheque(ctx context.Context, source ChequeSource, recipient common.Address) (common.Hash, error)
+	// CashoutStatus gets the status of the latest cashout transaction for the cheque source
+	CashoutStatus(ctx context.Context, source ChequeSource) (*CashoutStatus, error)
 }
 
 type cashoutService struct {
@@ -105,12 +105,22 @@ func NewCashoutService(
 	}
 }
 
-// cashoutActionKey computes the store key for the last cashout action for the chequebook
-func cashoutActionKey(chequebook common.Address) string {
-	return fmt.Sprintf("swap_cashout_%x", chequebook)
+// cashoutActionKey computes the store key for the last cashout action for the cheque source
+func cashoutActionKey(source ChequeSource) string {
+	if source.Delegated() {
+		return fmt.Sprintf("swap_cashout_%x_%x", source.Chequebook, source.Issuer)
+	}
+	return fmt.Sprintf("swap_cashout_%x", source.Chequebook)
 }
 
-func (s *cashoutService) paidOut(ctx context.Context, chequebook, beneficiary common.Address) (*big.Int, error) {
+// paidOut returns the amount paid out to the beneficiary of the cheque, on the
+// cheques of its issuer for delegated cheques.
+func (s *cashoutService) paidOut(ctx context.Context, cheque *SignedCheque) (*big.Int, error) {
+	chequebook, beneficiary := cheque.Chequebook, cheque.Beneficiary
+	if cheque.Delegated() {
+		return newChequebookContract(chequebook, s.transactionService).DelegatedPaidOut(ctx, cheque.Issuer, beneficiary)
+	}
+
 	//callData, err := chequebookABI.Pack("paidOut", beneficiary)
 	//if err != nil {
 	//	return nil, err
@@ -173,12 +183,13 @@ func (s *cashoutService) paidOut(ctx context.Context, chequebook, beneficiary co
 	return paidOut, nil
 }
 
-// CashCheque sends a cashout transaction for the last cheque of the chequebook
-func (s *cashoutService) CashCheque(ctx context.Context, chequebook, recipient common.Address) (common.Hash, error) {
-	cheque, err := s.chequeStore.LastCheque(chequebook)
+// CashCheque sends a cashout transaction for the last cheque of the cheque source
+func (s *cashoutService) CashCheque(ctx context.Context, source ChequeSource, recipient common.Address) (common.Hash, error) {
+	cheque, err := s.chequeStore.LastCheque(source)
 	if err != nil {
 		return common.Hash{}, err
 	}
+	chequebook := cheque.Chequebook
 
 	//callData, err := chequebookABI.Pack("cashChequeBeneficiary", recipient, cheque.CumulativePayout, cheque.Signature)
 	//if err != nil {
@@ -200,6 +211,15 @@ func (s *cashoutService) CashCheque(ctx context.Context, chequebook, recipient c
 		// fix for out of gas errors
 		lim = 300000
 	}
+	invokeApi := "cashChequeBeneficiary"
+	invokeArgs := []string{recipientAddr, payOutStr, rHex, sHex, vHex}
+	if cheque.Delegated() {
+		// the multi-issuer chequebook verifies the issuer against the authorized issuers
+		issuerAddr, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(cheque.Issuer[:]))
+		invokeApi = "cashDelegatedChequeBeneficiary"
+		invokeArgs = append([]string{issuerAddr}, invokeArgs...)
+	}
+
 	request := &transaction.TxRequest{
 		To: &chequebook,
 		//Data:     callData,
@@ -208,8 +228,8 @@ func (s *cashoutService) CashCheque(ctx context.Context, chequebook, recipient c
 		Value:    big.NewInt(0),
 
 		TxType:     transaction.TxTypeInvokeContract,
-		InvokeApi:  "cashChequeBeneficiary",
-		InvokeArgs: fmt.Sprintf(strings.Join([]string{recipientAddr, payOutStr, rHex, sHex, vHex}, ",")),
+		InvokeApi:  invokeApi,
+		InvokeArgs: fmt.Sprintf(strings.Join(invokeArgs, ",")),
 	}
 
 	txHash, err := s.transactionService.Send(ctx, request)
@@ -217,7 +237,7 @@ func (s *cashoutService) CashCheque(ctx context.Context, chequebook, recipient c
 		return common.Hash{}, err
 	}
 
-	err = s.store.Put(cashoutActionKey(chequebook), &cashoutAction{
+	err = s.store.Put(cashoutActionKey(source), &cashoutAction{
 		TxHash: txHash,
 		Cheque: *cheque,
 	})
@@ -228,15 +248,16 @@ func (s *cashoutService) CashCheque(ctx context.Context, chequebook, recipient c
 	return txHash, nil
 }
 
-// CashoutStatus gets the status of the latest cashout transaction for the chequebook
-func (s *cashoutService) CashoutStatus(ctx context.Context, chequebookAddress common.Address) (*CashoutStatus, error) {
-	cheque, err := s.chequeStore.LastCheque(chequebookAddress)
+// CashoutStatus gets the status of the latest cashout transaction for the cheque source
+func (s *cashoutService) CashoutStatus(ctx context.Context, source ChequeSource) (*CashoutStatus, error) {
+	cheque, err := s.chequeStore.LastCheque(source)
 	if err != nil {
 		return nil, err
 	}
+	chequebookAddress := cheque.Chequebook
 
 	var action cashoutAction
-	err = s.store.Get(cashoutActionKey(chequebookAddress), &action)
+	err = s.store.Get(cashoutActionKey(source), &action)
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
 			return &CashoutStatus{
@@ -279,7 +300,7 @@ func (s *cashoutService) CashoutStatus(ctx context.Context, chequebookAddress co
 	if receipt.ExecSucceed == false {
 		// if a tx failed (should be almost impossible in practice) we no longer have the necessary information to compute uncashed locally
 		// assume there are no pending transactions and that the on-chain paidOut is the last cashout action
-		paidOut, err := s.paidOut(ctx, chequebookAddress, cheque.Beneficiary)
+		paidOut, err := s.paidOut(ctx, cheque)
 		if err != nil {
 			return nil, err
 		}
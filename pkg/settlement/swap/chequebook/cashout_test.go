@@ -79,8 +79,8 @@ func TestCashout(t *testing.T) {
 			transactionmock.WithABISend(&chequebookABI, txHash, chequebookAddress, big.NewInt(0), "cashChequeBeneficiary", recipientAddress, cheque.CumulativePayout, cheque.Signature),
 		),
 		chequestoremock.NewChequeStore(
-			chequestoremock.WithLastChequeFunc(func(c common.Address) (*chequebook.SignedCheque, error) {
-				if c != chequebookAddress {
+			chequestoremock.WithLastChequeFunc(func(c chequebook.ChequeSource) (*chequebook.SignedCheque, error) {
+				if c.Chequebook != chequebookAddress {
 					t.Fatalf("using wrong chequebook. wanted %v, got %v", chequebookAddress, c)
 				}
 				return cheque, nil
@@ -88,7 +88,7 @@ func TestCashout(t *testing.T) {
 		),
 	)
 
-	returnedTxHash, err := cashoutService.CashCheque(context.Background(), chequebookAddress, recipientAddress)
+	returnedTxHash, err := cashoutService.CashCheque(context.Background(), chequebook.ChequeSource{Chequebook: chequebookAddress}, recipientAddress)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -97,7 +97,7 @@ func TestCashout(t *testing.T) {
 		t.Fatalf("returned wrong transaction hash. wanted %v, got %v", txHash, returnedTxHash)
 	}
 
-	status, err := cashoutService.CashoutStatus(context.Background(), chequebookAddress)
+	status, err := cashoutService.CashoutStatus(context.Background(), chequebook.ChequeSource{Chequebook: chequebookAddress})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -177,8 +177,8 @@ func TestCashoutBounced(t *testing.T) {
 			transactionmock.WithABISend(&chequebookABI, txHash, chequebookAddress, big.NewInt(0), "cashChequeBeneficiary", recipientAddress, cheque.CumulativePayout, cheque.Signature),
 		),
 		chequestoremock.NewChequeStore(
-			chequestoremock.WithLastChequeFunc(func(c common.Address) (*chequebook.SignedCheque, error) {
-				if c != chequebookAddress {
+			chequestoremock.WithLastChequeFunc(func(c chequebook.ChequeSource) (*chequebook.SignedCheque, error) {
+				if c.Chequebook != chequebookAddress {
 					t.Fatalf("using wrong chequebook. wanted %v, got %v", chequebookAddress, c)
 				}
 				return cheque, nil
@@ -186,7 +186,7 @@ func TestCashoutBounced(t *testing.T) {
 		),
 	)
 
-	returnedTxHash, err := cashoutService.CashCheque(context.Background(), chequebookAddress, recipientAddress)
+	returnedTxHash, err := cashoutService.CashCheque(context.Background(), chequebook.ChequeSource{Chequebook: chequebookAddress}, recipientAddress)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -195,7 +195,7 @@ func TestCashoutBounced(t *testing.T) {
 		t.Fatalf("returned wrong transaction hash. wanted %v, got %v", txHash, returnedTxHash)
 	}
 
-	status, err := cashoutService.CashoutStatus(context.Background(), chequebookAddress)
+	status, err := cashoutService.CashoutStatus(context.Background(), chequebook.ChequeSource{Chequebook: chequebookAddress})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -260,8 +260,8 @@ func TestCashoutStatusReverted(t *testing.T) {
 			transactionmock.WithABICall(&chequebookABI, chequebookAddress, onChainPaidOut.Bytes(), "paidOut", beneficiary),
 		),
 		chequestoremock.NewChequeStore(
-			chequestoremock.WithLastChequeFunc(func(c common.Address) (*chequebook.SignedCheque, error) {
-				if c != chequebookAddress {
+			chequestoremock.WithLastChequeFunc(func(c chequebook.ChequeSource) (*chequebook.SignedCheque, error) {
+				if c.Chequebook != chequebookAddress {
 					t.Fatalf("using wrong chequebook. wanted %v, got %v", chequebookAddress, c)
 				}
 				return cheque, nil
@@ -269,7 +269,7 @@ func TestCashoutStatusReverted(t *testing.T) {
 		),
 	)
 
-	returnedTxHash, err := cashoutService.CashCheque(context.Background(), chequebookAddress, recipientAddress)
+	returnedTxHash, err := cashoutService.CashCheque(context.Background(), chequebook.ChequeSource{Chequebook: chequebookAddress}, recipientAddress)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -278,7 +278,7 @@ func TestCashoutStatusReverted(t *testing.T) {
 		t.Fatalf("returned wrong transaction hash. wanted %v, got %v", txHash, returnedTxHash)
 	}
 
-	status, err := cashoutService.CashoutStatus(context.Background(), chequebookAddress)
+	status, err := cashoutService.CashoutStatus(context.Background(), chequebook.ChequeSource{Chequebook: chequebookAddress})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -323,8 +323,8 @@ func TestCashoutStatusPending(t *testing.T) {
 			transactionmock.WithABISend(&chequebookABI, txHash, chequebookAddress, big.NewInt(0), "cashChequeBeneficiary", recipientAddress, cheque.CumulativePayout, cheque.Signature),
 		),
 		chequestoremock.NewChequeStore(
-			chequestoremock.WithLastChequeFunc(func(c common.Address) (*chequebook.SignedCheque, error) {
-				if c != chequebookAddress {
+			chequestoremock.WithLastChequeFunc(func(c chequebook.ChequeSource) (*chequebook.SignedCheque, error) {
+				if c.Chequebook != chequebookAddress {
 					t.Fatalf("using wrong chequebook. wanted %v, got %v", chequebookAddress, c)
 				}
 				return cheque, nil
@@ -332,7 +332,7 @@ func TestCashoutStatusPending(t *testing.T) {
 		),
 	)
 
-	returnedTxHash, err := cashoutService.CashCheque(context.Background(), chequebookAddress, recipientAddress)
+	returnedTxHash, err := cashoutService.CashCheque(context.Background(), chequebook.ChequeSource{Chequebook: chequebookAddress}, recipientAddress)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -341,7 +341,7 @@ func TestCashoutStatusPending(t *testing.T) {
 		t.Fatalf("returned wrong transaction hash. wanted %v, got %v", txHash, returnedTxHash)
 	}
 
-	status, err := cashoutService.CashoutStatus(context.Background(), chequebookAddress)
+	status, err := cashoutService.CashoutStatus(context.Background(), chequebook.ChequeSource{Chequebook: chequebookAddress})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -8,15 +8,12 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
-	"github.com/penguintop/penguin/pkg/property"
 	"github.com/penguintop/penguin/pkg/xwcfmt"
 	"math/big"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/penguintop/penguin/pkg/crypto"
-	"github.com/penguintop/penguin/pkg/crypto/eip712"
 )
 
 // Cheque represents a cheque for a SimpleSwap chequebook
@@ -24,6 +21,9 @@ type Cheque struct {
 	Chequebook       common.Address
 	Beneficiary      common.Address
 	CumulativePayout *big.Int
+	// Issuer is the authorized issuer of a delegated cheque of a multi-issuer
+	// chequebook. It is zero for cheques issued by the chequebook owner.
+	Issuer common.Address
 }
 
 // SignedCheque represents a cheque together with its signature
@@ -32,34 +32,6 @@ type SignedCheque struct {
 	Signature []byte
 }
 
-// chequebookDomain computes chainId-dependant EIP712 domain
-func chequebookDomain(chainID int64) eip712.TypedDataDomain {
-	return eip712.TypedDataDomain{
-		Name:    "Chequebook",
-		Version: "1.0",
-		ChainId: math.NewHexOrDecimal256(chainID),
-	}
-}
-
-// ChequeTypes are the needed type descriptions for cheque signing
-var ChequeTypes = eip712.Types{
-	"EIP712Domain": eip712.EIP712DomainType,
-	"Cheque": []eip712.Type{
-		{
-			Name: "chequebook",
-			Type: "address",
-		},
-		{
-			Name: "beneficiary",
-			Type: "address",
-		},
-		{
-			Name: "cumulativePayout",
-			Type: "uint256",
-		},
-	},
-}
-
 // ChequeSigner signs cheque
 type ChequeSigner interface {
 	// Sign signs a cheque
@@ -67,50 +39,102 @@ type ChequeSigner interface {
 }
 
 type chequeSigner struct {
-	signer  crypto.Signer // the underlying signer used
-	chainID int64         // the chainID used for EIP712
+	signer crypto.Signer // the underlying signer used
+	domain string        // the signing domain of the chequebook contracts
 }
 
-// NewChequeSigner creates a new cheque signer for the given chainID.
-func NewChequeSigner(signer crypto.Signer, chainID int64) ChequeSigner {
+// NewChequeSigner creates a new cheque signer for the given signing domain,
+// which is the XWC chain id followed by the domain of the chequebook
+// contracts (see property.Domain).
+func NewChequeSigner(signer crypto.Signer, domain string) ChequeSigner {
 	return &chequeSigner{
-		signer:  signer,
-		chainID: chainID,
+		signer: signer,
+		domain: domain,
 	}
 }
 
-// eip712DataForCheque converts a cheque into the correct TypedData structure.
-func eip712DataForCheque(cheque *Cheque, chainID int64) *eip712.TypedData {
-	return &eip712.TypedData{
-		Domain: chequebookDomain(chainID),
-		Types:  ChequeTypes,
-		Message: eip712.TypedDataMessage{
-			"chequebook":       cheque.Chequebook.Hex(),
-			"beneficiary":      cheque.Beneficiary.Hex(),
-			"cumulativePayout": cheque.CumulativePayout.String(),
-		},
-		PrimaryType: "Cheque",
+// chequeSigningData returns the message of a cheque signed in the signing
+// domain. It is the message the chequebook contract recomputes in chequeHash,
+// so the signature is bound to the chain and to the chequebook contract.
+func chequeSigningData(cheque *Cheque, domain string) []byte {
+	chequebookAddr, _ := xwcfmt.HexAddrToXwcConAddr(hex.EncodeToString(cheque.Chequebook[:]))
+	beneficiaryAddr, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(cheque.Beneficiary[:]))
+	cumulativePayout := cheque.CumulativePayout.String()
+
+	if cheque.Delegated() {
+		funcSig := "DelegatedCheque(address chequebook,address issuer,address beneficiary,uint256 cumulativePayout)"
+		issuerAddr, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(cheque.Issuer[:]))
+
+		return []byte(strings.Join([]string{
+			domain, funcSig, chequebookAddr, issuerAddr, beneficiaryAddr, cumulativePayout,
+		}, ","))
 	}
+
+	funcSig := "Cheque(address chequebook,address beneficiary,uint256 cumulativePayout)"
+
+	return []byte(strings.Join([]string{
+		domain, funcSig, chequebookAddr, beneficiaryAddr, cumulativePayout,
+	}, ","))
 }
 
-// Sign signs a cheque.
+// Sign signs a cheque. The signature is in the r, s, v order the chequebook
+// contract expects, with v the recovery id of a compressed key (31 to 34).
 func (s *chequeSigner) Sign(cheque *Cheque) ([]byte, error) {
-	//return s.signer.SignTypedData(eip712DataForCheque(cheque, 0))
+	// the signer hashes the signing data with sha256 as the contract does
+	sig, err := s.signer.SignXwcData(chequeSigningData(cheque, s.domain))
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != 65 {
+		return nil, crypto.ErrInvalidLength
+	}
 
-	domainID := property.Domain()
-	funcSig := "Cheque(address chequebook,address beneficiary,uint256 cumulativePayout)"
-	chequebookAddr, _ := xwcfmt.HexAddrToXwcConAddr(hex.EncodeToString(cheque.Chequebook[:]))
-	beneficiaryAddr, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(cheque.Beneficiary[:]))
-	cumulativePayout := cheque.CumulativePayout.String()
+	// the signer puts v first
+	signature := make([]byte, 65)
+	copy(signature, sig[1:])
+	signature[64] = sig[0]
+	return signature, nil
+}
+
+// Delegated returns true if the cheque was issued by an authorized issuer of
+// a multi-issuer chequebook.
+func (cheque *Cheque) Delegated() bool {
+	return cheque.Issuer != (common.Address{})
+}
+
+// ChequeSource identifies the sequence of cumulative payouts a cheque belongs
+// to. Every issuer of a multi-issuer chequebook pays out cumulatively on its
+// own, so delegated cheques are told apart by the issuer, which is zero for
+// the cheques of the chequebook owner.
+type ChequeSource struct {
+	Chequebook common.Address
+	Issuer     common.Address
+}
 
-	dataStr := strings.Join([]string{
-		domainID, funcSig, chequebookAddr, beneficiaryAddr, cumulativePayout,
-	}, ",")
+// Source returns the source of the cheque.
+func (cheque *Cheque) Source() ChequeSource {
+	return ChequeSource{
+		Chequebook: cheque.Chequebook,
+		Issuer:     cheque.Issuer,
+	}
+}
+
+// Delegated returns true if the source issues delegated cheques.
+func (s ChequeSource) Delegated() bool {
+	return s.Issuer != (common.Address{})
+}
 
-	return []byte(dataStr), nil
+func (s ChequeSource) String() string {
+	if s.Delegated() {
+		return fmt.Sprintf("%x issuer %x", s.Chequebook, s.Issuer)
+	}
+	return fmt.Sprintf("%x", s.Chequebook)
 }
 
 func (cheque *Cheque) String() string {
+	if cheque.Delegated() {
+		return fmt.Sprintf("Contract: %x Issuer: %x Beneficiary: %x CumulativePayout: %v", cheque.Chequebook, cheque.Issuer, cheque.Beneficiary, cheque.CumulativePayout)
+	}
 	return fmt.Sprintf("Contract: %x Beneficiary: %x CumulativePayout: %v", cheque.Chequebook, cheque.Beneficiary, cheque.CumulativePayout)
 }
 
@@ -121,6 +145,9 @@ func (cheque *Cheque) Equal(other *Cheque) bool {
 	if cheque.CumulativePayout.Cmp(other.CumulativePayout) != 0 {
 		return false
 	}
+	if cheque.Issuer != other.Issuer {
+		return false
+	}
 	return cheque.Chequebook == other.Chequebook
 }
 
@@ -6,58 +6,153 @@ package chequebook_test
 
 import (
 	"bytes"
-
+	"crypto/sha256"
 	"encoding/hex"
 	"math/big"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/penguintop/penguin/pkg/crypto"
-	"github.com/penguintop/penguin/pkg/crypto/eip712"
 	signermock "github.com/penguintop/penguin/pkg/crypto/mock"
 	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
+	"github.com/penguintop/penguin/pkg/xwcfmt"
 )
 
+// testDomain is the signing domain of the test network, its chain id with an
+// empty domain.
+const testDomain = "a3c762d4c7bcbbfa59327c35c2a6e98558f6ca90d9fd71dfc59a15d09c8c52e4"
+
 func TestSignCheque(t *testing.T) {
 	chequebookAddress := common.HexToAddress("0x8d3766440f0d7b949a5e32995d09619a7f86e632")
 	beneficiaryAddress := common.HexToAddress("0xb8d424e9662fe0837fb1d728f1ac97cebb1085fe")
-	signature := common.Hex2Bytes("abcd")
 	cumulativePayout := big.NewInt(10)
-	chainId := int64(1)
 	cheque := &chequebook.Cheque{
 		Chequebook:       chequebookAddress,
 		Beneficiary:      beneficiaryAddress,
 		CumulativePayout: cumulativePayout,
 	}
 
-	signer := signermock.New(
-		signermock.WithSignTypedDataFunc(func(data *eip712.TypedData) ([]byte, error) {
-
-			if data.Message["beneficiary"].(string) != beneficiaryAddress.Hex() {
-				t.Fatal("signing cheque with wrong beneficiary")
-			}
-
-			if data.Message["chequebook"].(string) != chequebookAddress.Hex() {
-				t.Fatal("signing cheque for wrong chequebook")
-			}
+	// the signer returns v first
+	signature := make([]byte, 65)
+	signature[0] = 31
+	for i := 1; i < 65; i++ {
+		signature[i] = byte(i)
+	}
 
-			if data.Message["cumulativePayout"].(string) != cumulativePayout.String() {
-				t.Fatal("signing cheque with wrong cumulativePayout")
+	signer := signermock.New(
+		signermock.WithSignXwcDataFunc(func(data []byte) ([]byte, error) {
+			if !bytes.Equal(data, chequebook.ChequeSigningData(cheque, testDomain)) {
+				t.Fatalf("signing wrong data %s", data)
 			}
-
 			return signature, nil
 		}),
 	)
 
-	chequeSigner := chequebook.NewChequeSigner(signer, chainId)
+	chequeSigner := chequebook.NewChequeSigner(signer, testDomain)
 
 	result, err := chequeSigner.Sign(cheque)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if !bytes.Equal(result, signature) {
-		t.Fatalf("returned wrong signature. wanted %x, got %x", signature, result)
+	// the cheque signature is in the r, s, v order of the contract
+	expected := append(append([]byte{}, signature[1:]...), signature[0])
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("returned wrong signature. wanted %x, got %x", expected, result)
+	}
+}
+
+// TestChequeContractVectors checks cheques against vectors of the chequebook
+// contracts: the messages of chequeHash and delegatedChequeHash, their
+// sha256_hex(strToHex(message)) digests and the xwc address ecrecover returns
+// for r, s, v signatures of the test key, computed apart from this package.
+func TestChequeContractVectors(t *testing.T) {
+	data, err := hex.DecodeString("634fb5a872396d9693e5c9f9d7233cfa93f395c093371017ff44aa9ae6564cdd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey, err := crypto.DecodeSecp256k1PrivateKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+	issuer, err := signer.XwcAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chequeSigner := chequebook.NewChequeSigner(signer, testDomain)
+
+	const signerAddress = "XWCNYhC3MQqZDZVN25K3onZYW1eKwUZP7qcvs"
+
+	for _, tc := range []struct {
+		name      string
+		cheque    chequebook.Cheque
+		message   string
+		digest    string
+		signature string
+	}{
+		{
+			name: "cheque",
+			cheque: chequebook.Cheque{
+				Chequebook:       common.HexToAddress("0xfa02D396842E6e1D319E8E3D4D870338F791AA25"),
+				Beneficiary:      common.HexToAddress("0x98E6C644aFeB94BBfB9FF60EB26fc9D83BBEcA79"),
+				CumulativePayout: big.NewInt(500),
+			},
+			message: testDomain + ",Cheque(address chequebook,address beneficiary,uint256 cumulativePayout)," +
+				"XWCCfFptPVXJKSbaTfKLq7zNJMo6T8c7YWq58,XWCNZrSMQXqhSWkYAuVXDfPZLMDVudyLxDRZ6,500",
+			digest:    "211db4237b8e38d9dbc10ee94d329fd026d832515213b812b77bc0c817310676",
+			signature: "23c95f70df125de960a9d9e5d3ff005a97bf6951df8789274c841f361afdee285a3469857ed9b5796a52bc7537085a992cf4cad2b232d8a0fb71e44223e0a0a120",
+		},
+		{
+			name: "delegated cheque",
+			cheque: chequebook.Cheque{
+				Chequebook:       common.HexToAddress("0xfa02D396842E6e1D319E8E3D4D870338F791AA25"),
+				Beneficiary:      common.HexToAddress("0x98E6C644aFeB94BBfB9FF60EB26fc9D83BBEcA79"),
+				CumulativePayout: big.NewInt(500),
+				Issuer:           common.HexToAddress("0x8d3766440f0d7b949a5e32995d09619a7f86e632"),
+			},
+			message: testDomain + ",DelegatedCheque(address chequebook,address issuer,address beneficiary,uint256 cumulativePayout)," +
+				"XWCCfFptPVXJKSbaTfKLq7zNJMo6T8c7YWq58,XWCNYneq2XTjES3Sa6tHfS57opBnkxGyvyWPM,XWCNZrSMQXqhSWkYAuVXDfPZLMDVudyLxDRZ6,500",
+			digest:    "613e89ef4e82e7787e44ac1973b70d6527da27765ccb94e8eba34c3175f4d78e",
+			signature: "668acdf8391963bb8ab52f3d96f6e8aa1cf45e74600c7f2b8111e07afc37dc1d76a204ad5fbe328479a41803ee46635f6f5a4e45a26aecd3e1cfa7a798222c711f",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			message := chequebook.ChequeSigningData(&tc.cheque, testDomain)
+			if string(message) != tc.message {
+				t.Fatalf("wrong signing data. wanted %s, got %s", tc.message, message)
+			}
+			if digest := sha256.Sum256(message); hex.EncodeToString(digest[:]) != tc.digest {
+				t.Fatalf("wrong digest. wanted %s, got %x", tc.digest, digest)
+			}
+
+			signature, err := hex.DecodeString(tc.signature)
+			if err != nil {
+				t.Fatal(err)
+			}
+			recovered, err := chequebook.RecoverCheque(&chequebook.SignedCheque{
+				Cheque:    tc.cheque,
+				Signature: signature,
+			}, testDomain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if address, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(recovered[:])); address != signerAddress {
+				t.Fatalf("recovered wrong issuer. wanted %s, got %s", signerAddress, address)
+			}
+
+			// the signatures of the signer verify as the vector does
+			signature, err = chequeSigner.Sign(&tc.cheque)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if recovered, err := chequebook.RecoverCheque(&chequebook.SignedCheque{
+				Cheque:    tc.cheque,
+				Signature: signature,
+			}, testDomain); err != nil || recovered != issuer {
+				t.Fatalf("recovered wrong issuer. wanted %x, got %x, %v", issuer, recovered, err)
+			}
+		})
 	}
 }
 
@@ -65,7 +160,6 @@ func TestSignChequeIntegration(t *testing.T) {
 	chequebookAddress := common.HexToAddress("0xfa02D396842E6e1D319E8E3D4D870338F791AA25")
 	beneficiaryAddress := common.HexToAddress("0x98E6C644aFeB94BBfB9FF60EB26fc9D83BBEcA79")
 	cumulativePayout := big.NewInt(500)
-	chainId := int64(1)
 
 	data, err := hex.DecodeString("634fb5a872396d9693e5c9f9d7233cfa93f395c093371017ff44aa9ae6564cdd")
 	if err != nil {
@@ -78,6 +172,10 @@ func TestSignChequeIntegration(t *testing.T) {
 	}
 
 	signer := crypto.NewDefaultSigner(privKey)
+	issuer, err := signer.XwcAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	cheque := &chequebook.Cheque{
 		Chequebook:       chequebookAddress,
@@ -85,20 +183,78 @@ func TestSignChequeIntegration(t *testing.T) {
 		CumulativePayout: cumulativePayout,
 	}
 
-	chequeSigner := chequebook.NewChequeSigner(signer, chainId)
+	chequeSigner := chequebook.NewChequeSigner(signer, testDomain)
 
-	result, err := chequeSigner.Sign(cheque)
+	signature, err := chequeSigner.Sign(cheque)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if v := signature[64]; v < 31 || v > 34 {
+		t.Fatalf("signature has v %d of an uncompressed key", v)
+	}
+
+	signedCheque := &chequebook.SignedCheque{
+		Cheque:    *cheque,
+		Signature: signature,
+	}
 
-	// computed using ganache
-	expectedSignature, err := hex.DecodeString("171b63fc598ae2c7987f4a756959dadddd84ccd2071e7b5c3aa3437357be47286125edc370c344a163ba7f4183dfd3611996274a13e4b3496610fc00c0e2fc421c")
+	recovered, err := chequebook.RecoverCheque(signedCheque, testDomain)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if recovered != issuer {
+		t.Fatalf("recovered wrong issuer. wanted %x, got %x", issuer, recovered)
+	}
+
+	// the signature is bound to the network
+	recovered, err = chequebook.RecoverCheque(signedCheque, "00"+testDomain[2:])
+	if err == nil && recovered == issuer {
+		t.Fatal("recovered issuer from cheque of another network")
+	}
+
+	// and to the chequebook
+	otherCheque := *signedCheque
+	otherCheque.Chequebook = common.HexToAddress("0xffff")
+	recovered, err = chequebook.RecoverCheque(&otherCheque, testDomain)
+	if err == nil && recovered == issuer {
+		t.Fatal("recovered issuer from cheque of another chequebook")
+	}
+}
+
+func TestChequeSource(t *testing.T) {
+	chequebookAddress := common.HexToAddress("0x8d3766440f0d7b949a5e32995d09619a7f86e632")
+	issuer := common.HexToAddress("0xb8d424e9662fe0837fb1d728f1ac97cebb1085fe")
+
+	cheque := &chequebook.Cheque{
+		Chequebook:       chequebookAddress,
+		Beneficiary:      common.HexToAddress("0xfff5e26e7e66c3ef3a4b1a16e8dbda6d0b5fc2d6"),
+		CumulativePayout: big.NewInt(500),
+	}
+	if cheque.Delegated() {
+		t.Fatal("cheque of the owner is delegated")
+	}
+	if source := cheque.Source(); source != (chequebook.ChequeSource{Chequebook: chequebookAddress}) {
+		t.Fatalf("wrong source. wanted %x, got %v", chequebookAddress, source)
+	}
+
+	delegated := *cheque
+	delegated.Issuer = issuer
+	if !delegated.Delegated() {
+		t.Fatal("delegated cheque is not delegated")
+	}
+	if source := delegated.Source(); source.Chequebook != chequebookAddress || source.Issuer != issuer {
+		t.Fatalf("wrong source. wanted %x issuer %x, got %v", chequebookAddress, issuer, source)
+	}
+	if delegated.Source() == cheque.Source() {
+		t.Fatal("delegated cheque shares the source of the chequebook")
+	}
+	if cheque.Equal(&delegated) {
+		t.Fatal("delegated cheque equals cheque of the owner")
+	}
 
-	if !bytes.Equal(result, expectedSignature) {
-		t.Fatalf("returned wrong signature. wanted %x, got %x", expectedSignature, result)
+	other := delegated
+	other.Issuer = common.HexToAddress("0xffff")
+	if other.Source() == delegated.Source() {
+		t.Fatal("issuers share the same source")
 	}
 }
@@ -32,6 +32,8 @@ var (
 	ErrOutOfFunds = errors.New("chequebook out of funds")
 	// ErrInsufficientFunds is the error when the chequebook has not enough free funds for a user action
 	ErrInsufficientFunds = errors.New("insufficient token balance")
+	// ErrNotOwner is the error when an issuer of a multi-issuer chequebook attempts an action reserved to the owner
+	ErrNotOwner = errors.New("not the chequebook owner")
 
 	chequebookABI          = transaction.ParseABIUnchecked(sw3abi.ERC20SimpleSwapABIv0_3_1)
 	chequeCashedEventType  = chequebookABI.Events["ChequeCashed"]
@@ -70,6 +72,9 @@ type service struct {
 	address      common.Address
 	contract     *chequebookContract
 	ownerAddress common.Address
+	// issuer is the address the delegated cheques of a multi-issuer
+	// chequebook are issued with, zero if the node owns the chequebook
+	issuer common.Address
 
 	erc20Service erc20.Service
 
@@ -92,6 +97,28 @@ func New(transactionService transaction.Service, address, ownerAddress common.Ad
 	}, nil
 }
 
+// NewDelegated creates a new chequebook service issuing delegated cheques of a
+// multi-issuer chequebook with the key of the issuer. The issuer must be
+// authorized by the chequebook owner.
+func NewDelegated(transactionService transaction.Service, address, issuerAddress common.Address, store storage.StateStorer, chequeSigner ChequeSigner, erc20Service erc20.Service) (Service, error) {
+	return &service{
+		transactionService:  transactionService,
+		address:             address,
+		contract:            newChequebookContract(address, transactionService),
+		ownerAddress:        issuerAddress,
+		issuer:              issuerAddress,
+		erc20Service:        erc20Service,
+		store:               store,
+		chequeSigner:        chequeSigner,
+		totalIssuedReserved: big.NewInt(0),
+	}, nil
+}
+
+// delegated returns true if the service issues delegated cheques.
+func (s *service) delegated() bool {
+	return s.issuer != (common.Address{})
+}
+
 // Address returns the address of the used chequebook contract.
 func (s *service) Address() common.Address {
 	return s.address
@@ -129,6 +156,10 @@ func (s *service) AvailableBalance(ctx context.Context) (*big.Int, error) {
 		return nil, err
 	}
 
+	if s.delegated() {
+		return s.availableAllowance(ctx, balance, totalIssued)
+	}
+
 	totalPaidOut, err := s.contract.TotalPaidOut(ctx)
 	if err != nil {
 		return nil, err
@@ -141,6 +172,29 @@ func (s *service) AvailableBalance(ctx context.Context) (*big.Int, error) {
 	return availableBalance, nil
 }
 
+// availableAllowance returns the part of the allowance of the issuer which is
+// not yet used for uncashed cheques, limited by the balance the chequebook
+// shares with the other issuers.
+func (s *service) availableAllowance(ctx context.Context, balance, totalIssued *big.Int) (*big.Int, error) {
+	allowance, err := s.contract.IssuerAllowance(ctx, s.issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	issuerPaidOut, err := s.contract.IssuerPaidOut(ctx, s.issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	// the cheques of the issuer can not pay out more than the allowance nor
+	// more than what is paid out already plus the current balance
+	limit := big.NewInt(0).Add(balance, issuerPaidOut)
+	if allowance.Cmp(limit) < 0 {
+		limit = allowance
+	}
+	return limit.Sub(limit, totalIssued), nil
+}
+
 // WaitForDeposit waits for the deposit transaction to confirm and verifies the result.
 func (s *service) WaitForDeposit(ctx context.Context, txHash common.Hash) error {
 	//receipt, err := s.transactionService.WaitForReceipt(ctx, txHash)
@@ -211,6 +265,7 @@ func (s *service) Issue(ctx context.Context, beneficiary common.Address, amount
 		Chequebook:       s.address,
 		CumulativePayout: cumulativePayout,
 		Beneficiary:      beneficiary,
+		Issuer:           s.issuer,
 	}
 
 	// TODO
@@ -218,6 +273,7 @@ func (s *service) Issue(ctx context.Context, beneficiary common.Address, amount
 		Chequebook:       s.address,
 		CumulativePayout: cumulativePayout,
 		Beneficiary:      beneficiary,
+		Issuer:           s.issuer,
 	})
 	if err != nil {
 		return nil, err
@@ -310,6 +366,11 @@ func (s *service) LastCheques() (map[common.Address]*SignedCheque, error) {
 }
 
 func (s *service) Withdraw(ctx context.Context, amount *big.Int) (hash common.Hash, err error) {
+	// the funds of a multi-issuer chequebook are managed by its owner
+	if s.delegated() {
+		return common.Hash{}, ErrNotOwner
+	}
+
 	availableBalance, err := s.AvailableBalance(ctx)
 	if err != nil {
 		return common.Hash{}, err
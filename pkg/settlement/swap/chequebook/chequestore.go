@@ -6,10 +6,11 @@ package chequebook
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
-	"strings"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -28,59 +29,73 @@ var (
 	// ErrWrongBeneficiary is the error returned if the cheque has the wrong beneficiary.
 	ErrWrongBeneficiary = errors.New("wrong beneficiary")
 	// ErrBouncingCheque is the error returned if the chequebook is demonstrably illiquid.
-	ErrBouncingCheque        = errors.New("bouncing cheque")
+	ErrBouncingCheque = errors.New("bouncing cheque")
+	// ErrIssuerNotAuthorized is the error returned if the issuer of a delegated cheque is not authorized by the chequebook.
+	ErrIssuerNotAuthorized = errors.New("cheque issuer not authorized")
+	// ErrAllowanceExceeded is the error returned if a delegated cheque pays out more than the allowance of the issuer.
+	ErrAllowanceExceeded = errors.New("cheque exceeds issuer allowance")
+	// ErrChequeValueTooLow is the error returned if the cheque does not pay more than the deduction.
+	ErrChequeValueTooLow = errors.New("cheque value lower than acceptable")
+	// ErrChequeRateMismatch is the error returned if the cheque value is not a multiple of the exchange rate.
+	ErrChequeRateMismatch = errors.New("cheque value does not match exchange rate")
+
 	lastReceivedChequePrefix = "swap_chequebook_last_received_cheque_"
 )
 
 // ChequeStore handles the verification and storage of received cheques
 type ChequeStore interface {
-	// ReceiveCheque verifies and stores a cheque. It returns the total amount earned.
-	ReceiveCheque(ctx context.Context, cheque *SignedCheque) (*big.Int, error)
-	// LastCheque returns the last cheque we received from a specific chequebook.
-	LastCheque(chequebook common.Address) (*SignedCheque, error)
-	// LastCheques returns the last received cheques from every known chequebook.
-	LastCheques() (map[common.Address]*SignedCheque, error)
+	// ReceiveCheque verifies and stores a cheque paid at the exchange rate.
+	// The first cheque from a cheque source also pays the deduction. It
+	// returns the amount earned, less the deduction.
+	ReceiveCheque(ctx context.Context, cheque *SignedCheque, exchangeRate, deduction *big.Int) (*big.Int, error)
+	// LastCheque returns the last cheque we received from a specific cheque source.
+	LastCheque(source ChequeSource) (*SignedCheque, error)
+	// LastCheques returns the last received cheques from every known cheque source.
+	LastCheques() (map[ChequeSource]*SignedCheque, error)
 }
 
 type chequeStore struct {
 	lock               sync.Mutex
 	store              storage.StateStorer
 	factory            Factory
-	chaindID           int64
+	domain             string // the signing domain of the chequebook contracts
 	transactionService transaction.Service
 	beneficiary        common.Address // the beneficiary we expect in cheques sent to us
 	recoverChequeFunc  RecoverChequeFunc
 }
 
-type RecoverChequeFunc func(cheque *SignedCheque, chainID int64) (common.Address, error)
+type RecoverChequeFunc func(cheque *SignedCheque, domain string) (common.Address, error)
 
 // NewChequeStore creates new ChequeStore
 func NewChequeStore(
 	store storage.StateStorer,
 	factory Factory,
-	chainID int64,
+	domain string,
 	beneficiary common.Address,
 	transactionService transaction.Service,
 	recoverChequeFunc RecoverChequeFunc) ChequeStore {
 	return &chequeStore{
 		store:              store,
 		factory:            factory,
-		chaindID:           chainID,
+		domain:             domain,
 		transactionService: transactionService,
 		beneficiary:        beneficiary,
 		recoverChequeFunc:  recoverChequeFunc,
 	}
 }
 
-// lastReceivedChequeKey computes the key where to store the last cheque received from a chequebook.
-func lastReceivedChequeKey(chequebook common.Address) string {
-	return fmt.Sprintf("%s_%x", lastReceivedChequePrefix, chequebook)
+// lastReceivedChequeKey computes the key where to store the last cheque received from a cheque source.
+func lastReceivedChequeKey(source ChequeSource) string {
+	if source.Delegated() {
+		return fmt.Sprintf("%s_%x_%x", lastReceivedChequePrefix, source.Chequebook, source.Issuer)
+	}
+	return fmt.Sprintf("%s_%x", lastReceivedChequePrefix, source.Chequebook)
 }
 
-// LastCheque returns the last cheque we received from a specific chequebook.
-func (s *chequeStore) LastCheque(chequebook common.Address) (*SignedCheque, error) {
+// LastCheque returns the last cheque we received from a specific cheque source.
+func (s *chequeStore) LastCheque(source ChequeSource) (*SignedCheque, error) {
 	var cheque *SignedCheque
-	err := s.store.Get(lastReceivedChequeKey(chequebook), &cheque)
+	err := s.store.Get(lastReceivedChequeKey(source), &cheque)
 	if err != nil {
 		if err != storage.ErrNotFound {
 			return nil, err
@@ -91,8 +106,10 @@ func (s *chequeStore) LastCheque(chequebook common.Address) (*SignedCheque, erro
 	return cheque, nil
 }
 
-// ReceiveCheque verifies and stores a cheque. It returns the totam amount earned.
-func (s *chequeStore) ReceiveCheque(ctx context.Context, cheque *SignedCheque) (*big.Int, error) {
+// ReceiveCheque verifies and stores a cheque paid at the exchange rate. The
+// first cheque from a cheque source also pays the deduction. It returns the
+// amount earned, less the deduction.
+func (s *chequeStore) ReceiveCheque(ctx context.Context, cheque *SignedCheque, exchangeRate, deduction *big.Int) (*big.Int, error) {
 	// verify we are the beneficiary
 	if cheque.Beneficiary != s.beneficiary {
 		return nil, ErrWrongBeneficiary
@@ -103,10 +120,11 @@ func (s *chequeStore) ReceiveCheque(ctx context.Context, cheque *SignedCheque) (
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	// load the lastCumulativePayout for the cheques chequebook
+	// load the lastCumulativePayout for the cheques chequebook, or for the
+	// issuer of delegated cheques
 	var lastCumulativePayout *big.Int
 	var lastReceivedCheque *SignedCheque
-	err := s.store.Get(lastReceivedChequeKey(cheque.Chequebook), &lastReceivedCheque)
+	err := s.store.Get(lastReceivedChequeKey(cheque.Source()), &lastReceivedCheque)
 	if err != nil {
 		if err != storage.ErrNotFound {
 			return nil, err
@@ -130,23 +148,71 @@ func (s *chequeStore) ReceiveCheque(ctx context.Context, cheque *SignedCheque) (
 		return nil, ErrChequeNotIncreasing
 	}
 
+	// only the first cheque pays the deduction, the rest of the amount must
+	// be worth whole accounting units at the exchange rate
+	if lastReceivedCheque == nil {
+		amount.Sub(amount, deduction)
+	}
+	if amount.Cmp(exchangeRate) < 0 {
+		return nil, ErrChequeValueTooLow
+	}
+	if new(big.Int).Mod(amount, exchangeRate).Sign() != 0 {
+		return nil, ErrChequeRateMismatch
+	}
+
 	// blockchain calls below
 	contract := newChequebookContract(cheque.Chequebook, s.transactionService)
 
-	// this does not change for the same chequebook
-	expectedIssuer, err := contract.Issuer(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	// verify the cheque signature
-	issuer, err := s.recoverChequeFunc(cheque, s.chaindID)
+	issuer, err := s.recoverChequeFunc(cheque, s.domain)
 	if err != nil {
 		return nil, err
 	}
 
-	if issuer != expectedIssuer {
-		return nil, ErrChequeInvalid
+	var alreadyPaidOut *big.Int
+	if cheque.Delegated() {
+		// the issuer of a delegated cheque must be authorized by the chequebook
+		if issuer != cheque.Issuer {
+			return nil, ErrChequeInvalid
+		}
+
+		allowance, err := contract.IssuerAllowance(ctx, cheque.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		if allowance.Sign() <= 0 {
+			return nil, ErrIssuerNotAuthorized
+		}
+		issuerPaidOut, err := contract.IssuerPaidOut(ctx, cheque.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		alreadyPaidOut, err = contract.DelegatedPaidOut(ctx, cheque.Issuer, s.beneficiary)
+		if err != nil {
+			return nil, err
+		}
+
+		// the allowance is shared by all beneficiaries of the issuer, what
+		// is left of it must cover the part of the cheque not yet paid out
+		allowanceLeft := big.NewInt(0).Sub(allowance, issuerPaidOut)
+		if big.NewInt(0).Sub(cheque.CumulativePayout, alreadyPaidOut).Cmp(allowanceLeft) > 0 {
+			return nil, ErrAllowanceExceeded
+		}
+	} else {
+		// this does not change for the same chequebook
+		expectedIssuer, err := contract.Issuer(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if issuer != expectedIssuer {
+			return nil, ErrChequeInvalid
+		}
+
+		alreadyPaidOut, err = contract.PaidOut(ctx, s.beneficiary)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// basic liquidity check
@@ -156,17 +222,12 @@ func (s *chequeStore) ReceiveCheque(ctx context.Context, cheque *SignedCheque) (
 		return nil, err
 	}
 
-	alreadyPaidOut, err := contract.PaidOut(ctx, s.beneficiary)
-	if err != nil {
-		return nil, err
-	}
-
 	if balance.Cmp(big.NewInt(0).Sub(cheque.CumulativePayout, alreadyPaidOut)) < 0 {
 		return nil, ErrBouncingCheque
 	}
 
 	// store the accepted cheque
-	err = s.store.Put(lastReceivedChequeKey(cheque.Chequebook), cheque)
+	err = s.store.Put(lastReceivedChequeKey(cheque.Source()), cheque)
 	if err != nil {
 		return nil, err
 	}
@@ -174,55 +235,40 @@ func (s *chequeStore) ReceiveCheque(ctx context.Context, cheque *SignedCheque) (
 	return amount, nil
 }
 
-// RecoverCheque recovers the issuer ethereum address from a signed cheque
-func RecoverCheque(cheque *SignedCheque, chaindID int64) (common.Address, error) {
-	eip712Data := eip712DataForCheque(&cheque.Cheque, chaindID)
-
-	pubkey, err := crypto.RecoverEIP712(cheque.Signature, eip712Data)
+// RecoverCheque recovers the issuer xwc address from a cheque signed in the
+// given signing domain, as the chequebook contract does when cashing it.
+func RecoverCheque(cheque *SignedCheque, domain string) (common.Address, error) {
+	pubkey, err := crypto.RecoverXwc(cheque.Signature, chequeSigningData(&cheque.Cheque, domain))
 	if err != nil {
 		return common.Address{}, err
 	}
 
-	ethAddr, err := crypto.NewEthereumAddress(*pubkey)
+	return xwcAddress(pubkey)
+}
+
+// xwcAddress returns the xwc address of a key, which the chequebook contract
+// compares to the address its ecrecover returns.
+func xwcAddress(pubkey *ecdsa.PublicKey) (common.Address, error) {
+	xwcAddr, err := crypto.NewXwcAddress(*pubkey)
 	if err != nil {
 		return common.Address{}, err
 	}
 
 	var issuer common.Address
-	copy(issuer[:], ethAddr)
+	copy(issuer[:], xwcAddr)
 	return issuer, nil
 }
 
-// keyChequebook computes the chequebook a store entry is for.
-func keyChequebook(key []byte, prefix string) (chequebook common.Address, err error) {
-	k := string(key)
-
-	split := strings.SplitAfter(k, prefix)
-	if len(split) != 2 {
-		return common.Address{}, errors.New("no peer in key")
-	}
-	return common.HexToAddress(split[1]), nil
-}
-
-// LastCheques returns the last received cheques from every known chequebook.
-func (s *chequeStore) LastCheques() (map[common.Address]*SignedCheque, error) {
-	result := make(map[common.Address]*SignedCheque)
+// LastCheques returns the last received cheques from every known cheque source.
+func (s *chequeStore) LastCheques() (map[ChequeSource]*SignedCheque, error) {
+	result := make(map[ChequeSource]*SignedCheque)
 	err := s.store.Iterate(lastReceivedChequePrefix, func(key, val []byte) (stop bool, err error) {
-		addr, err := keyChequebook(key, lastReceivedChequePrefix+"_")
-		if err != nil {
-			return false, fmt.Errorf("parse address from key: %s: %w", string(key), err)
+		var cheque SignedCheque
+		if err := json.Unmarshal(val, &cheque); err != nil {
+			return false, fmt.Errorf("parse cheque from key: %s: %w", string(key), err)
 		}
 
-		if _, ok := result[addr]; !ok {
-			lastCheque, err := s.LastCheque(addr)
-			if err != nil && err != ErrNoCheque {
-				return false, err
-			} else if err == ErrNoCheque {
-				return false, nil
-			}
-
-			result[addr] = lastCheque
-		}
+		result[cheque.Source()] = &cheque
 		return false, nil
 	})
 	if err != nil {
@@ -16,6 +16,11 @@ import (
 	transactionmock "github.com/penguintop/penguin/pkg/transaction/mock"
 )
 
+var (
+	exchangeRate = big.NewInt(1)
+	deduction    = big.NewInt(0)
+)
+
 func TestReceiveCheque(t *testing.T) {
 	store := storemock.NewStateStore()
 	beneficiary := common.HexToAddress("0xffff")
@@ -24,7 +29,6 @@ func TestReceiveCheque(t *testing.T) {
 	cumulativePayout2 := big.NewInt(20)
 	chequebookAddress := common.HexToAddress("0xeeee")
 	sig := make([]byte, 65)
-	chainID := int64(1)
 
 	cheque := &chequebook.SignedCheque{
 		Cheque: chequebook.Cheque{
@@ -49,7 +53,7 @@ func TestReceiveCheque(t *testing.T) {
 	chequestore := chequebook.NewChequeStore(
 		store,
 		factory,
-		chainID,
+		testDomain,
 		beneficiary,
 		transactionmock.New(
 			transactionmock.WithABICallSequence(
@@ -61,9 +65,9 @@ func TestReceiveCheque(t *testing.T) {
 				transactionmock.ABICall(&chequebookABI, chequebookAddress, big.NewInt(0).Bytes(), "paidOut", beneficiary),
 			),
 		),
-		func(c *chequebook.SignedCheque, cid int64) (common.Address, error) {
-			if cid != chainID {
-				t.Fatalf("recovery with wrong chain id. wanted %d, got %d", chainID, cid)
+		func(c *chequebook.SignedCheque, domain string) (common.Address, error) {
+			if domain != testDomain {
+				t.Fatalf("recovery with wrong domain. wanted %s, got %s", testDomain, domain)
 			}
 			if !cheque.Equal(c) {
 				t.Fatalf("recovery with wrong cheque. wanted %v, got %v", cheque, c)
@@ -71,7 +75,7 @@ func TestReceiveCheque(t *testing.T) {
 			return issuer, nil
 		})
 
-	received, err := chequestore.ReceiveCheque(context.Background(), cheque)
+	received, err := chequestore.ReceiveCheque(context.Background(), cheque, exchangeRate, deduction)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -84,7 +88,7 @@ func TestReceiveCheque(t *testing.T) {
 		t.Fatalf("calculated wrong received cumulativePayout. wanted %d, got %d", cumulativePayout, received)
 	}
 
-	lastCheque, err := chequestore.LastCheque(chequebookAddress)
+	lastCheque, err := chequestore.LastCheque(chequebook.ChequeSource{Chequebook: chequebookAddress})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -103,7 +107,7 @@ func TestReceiveCheque(t *testing.T) {
 	}
 
 	verifiedWithFactory = false
-	received, err = chequestore.ReceiveCheque(context.Background(), cheque)
+	received, err = chequestore.ReceiveCheque(context.Background(), cheque, exchangeRate, deduction)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -125,7 +129,6 @@ func TestReceiveChequeInvalidBeneficiary(t *testing.T) {
 	cumulativePayout := big.NewInt(10)
 	chequebookAddress := common.HexToAddress("0xeeee")
 	sig := make([]byte, 65)
-	chainID := int64(1)
 
 	cheque := &chequebook.SignedCheque{
 		Cheque: chequebook.Cheque{
@@ -139,13 +142,13 @@ func TestReceiveChequeInvalidBeneficiary(t *testing.T) {
 	chequestore := chequebook.NewChequeStore(
 		store,
 		&factoryMock{},
-		chainID,
+		testDomain,
 		beneficiary,
 		transactionmock.New(),
 		nil,
 	)
 
-	_, err := chequestore.ReceiveCheque(context.Background(), cheque)
+	_, err := chequestore.ReceiveCheque(context.Background(), cheque, exchangeRate, deduction)
 	if err == nil {
 		t.Fatal("accepted cheque with wrong beneficiary")
 	}
@@ -162,7 +165,6 @@ func TestReceiveChequeInvalidAmount(t *testing.T) {
 	cumulativePayoutLower := big.NewInt(5)
 	chequebookAddress := common.HexToAddress("0xeeee")
 	sig := make([]byte, 65)
-	chainID := int64(1)
 
 	chequestore := chequebook.NewChequeStore(
 		store,
@@ -171,7 +173,7 @@ func TestReceiveChequeInvalidAmount(t *testing.T) {
 				return nil
 			},
 		},
-		chainID,
+		testDomain,
 		beneficiary,
 		transactionmock.New(
 			transactionmock.WithABICallSequence(
@@ -180,7 +182,7 @@ func TestReceiveChequeInvalidAmount(t *testing.T) {
 				transactionmock.ABICall(&chequebookABI, chequebookAddress, big.NewInt(0).Bytes(), "paidOut", beneficiary),
 			),
 		),
-		func(c *chequebook.SignedCheque, cid int64) (common.Address, error) {
+		func(c *chequebook.SignedCheque, domain string) (common.Address, error) {
 			return issuer, nil
 		})
 
@@ -191,7 +193,7 @@ func TestReceiveChequeInvalidAmount(t *testing.T) {
 			Chequebook:       chequebookAddress,
 		},
 		Signature: sig,
-	})
+	}, exchangeRate, deduction)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -203,7 +205,7 @@ func TestReceiveChequeInvalidAmount(t *testing.T) {
 			Chequebook:       chequebookAddress,
 		},
 		Signature: sig,
-	})
+	}, exchangeRate, deduction)
 	if err == nil {
 		t.Fatal("accepted lower amount cheque")
 	}
@@ -219,7 +221,6 @@ func TestReceiveChequeInvalidChequebook(t *testing.T) {
 	cumulativePayout := big.NewInt(10)
 	chequebookAddress := common.HexToAddress("0xeeee")
 	sig := make([]byte, 65)
-	chainID := int64(1)
 
 	chequestore := chequebook.NewChequeStore(
 		store,
@@ -228,7 +229,7 @@ func TestReceiveChequeInvalidChequebook(t *testing.T) {
 				return chequebook.ErrNotDeployedByFactory
 			},
 		},
-		chainID,
+		testDomain,
 		beneficiary,
 		transactionmock.New(
 			transactionmock.WithABICallSequence(
@@ -236,7 +237,7 @@ func TestReceiveChequeInvalidChequebook(t *testing.T) {
 				transactionmock.ABICall(&chequebookABI, chequebookAddress, cumulativePayout.Bytes(), "balance"),
 			),
 		),
-		func(c *chequebook.SignedCheque, cid int64) (common.Address, error) {
+		func(c *chequebook.SignedCheque, domain string) (common.Address, error) {
 			return issuer, nil
 		})
 
@@ -247,7 +248,7 @@ func TestReceiveChequeInvalidChequebook(t *testing.T) {
 			Chequebook:       chequebookAddress,
 		},
 		Signature: sig,
-	})
+	}, exchangeRate, deduction)
 	if !errors.Is(err, chequebook.ErrNotDeployedByFactory) {
 		t.Fatalf("wrong error. wanted %v, got %v", chequebook.ErrNotDeployedByFactory, err)
 	}
@@ -260,7 +261,6 @@ func TestReceiveChequeInvalidSignature(t *testing.T) {
 	cumulativePayout := big.NewInt(10)
 	chequebookAddress := common.HexToAddress("0xeeee")
 	sig := make([]byte, 65)
-	chainID := int64(1)
 
 	chequestore := chequebook.NewChequeStore(
 		store,
@@ -269,14 +269,14 @@ func TestReceiveChequeInvalidSignature(t *testing.T) {
 				return nil
 			},
 		},
-		chainID,
+		testDomain,
 		beneficiary,
 		transactionmock.New(
 			transactionmock.WithABICallSequence(
 				transactionmock.ABICall(&chequebookABI, chequebookAddress, issuer.Hash().Bytes(), "issuer"),
 			),
 		),
-		func(c *chequebook.SignedCheque, cid int64) (common.Address, error) {
+		func(c *chequebook.SignedCheque, domain string) (common.Address, error) {
 			return common.Address{}, nil
 		})
 
@@ -287,7 +287,7 @@ func TestReceiveChequeInvalidSignature(t *testing.T) {
 			Chequebook:       chequebookAddress,
 		},
 		Signature: sig,
-	})
+	}, exchangeRate, deduction)
 	if !errors.Is(err, chequebook.ErrChequeInvalid) {
 		t.Fatalf("wrong error. wanted %v, got %v", chequebook.ErrChequeInvalid, err)
 	}
@@ -300,7 +300,6 @@ func TestReceiveChequeInsufficientBalance(t *testing.T) {
 	cumulativePayout := big.NewInt(10)
 	chequebookAddress := common.HexToAddress("0xeeee")
 	sig := make([]byte, 65)
-	chainID := int64(1)
 
 	chequestore := chequebook.NewChequeStore(
 		store,
@@ -309,7 +308,7 @@ func TestReceiveChequeInsufficientBalance(t *testing.T) {
 				return nil
 			},
 		},
-		chainID,
+		testDomain,
 		beneficiary,
 		transactionmock.New(
 			transactionmock.WithABICallSequence(
@@ -318,7 +317,7 @@ func TestReceiveChequeInsufficientBalance(t *testing.T) {
 				transactionmock.ABICall(&chequebookABI, chequebookAddress, big.NewInt(0).Bytes(), "paidOut", beneficiary),
 			),
 		),
-		func(c *chequebook.SignedCheque, cid int64) (common.Address, error) {
+		func(c *chequebook.SignedCheque, domain string) (common.Address, error) {
 			return issuer, nil
 		})
 
@@ -329,7 +328,7 @@ func TestReceiveChequeInsufficientBalance(t *testing.T) {
 			Chequebook:       chequebookAddress,
 		},
 		Signature: sig,
-	})
+	}, exchangeRate, deduction)
 	if !errors.Is(err, chequebook.ErrBouncingCheque) {
 		t.Fatalf("wrong error. wanted %v, got %v", chequebook.ErrBouncingCheque, err)
 	}
@@ -342,7 +341,6 @@ func TestReceiveChequeSufficientBalancePaidOut(t *testing.T) {
 	cumulativePayout := big.NewInt(10)
 	chequebookAddress := common.HexToAddress("0xeeee")
 	sig := make([]byte, 65)
-	chainID := int64(1)
 
 	chequestore := chequebook.NewChequeStore(
 		store,
@@ -351,7 +349,7 @@ func TestReceiveChequeSufficientBalancePaidOut(t *testing.T) {
 				return nil
 			},
 		},
-		chainID,
+		testDomain,
 		beneficiary,
 		transactionmock.New(
 			transactionmock.WithABICallSequence(
@@ -360,7 +358,7 @@ func TestReceiveChequeSufficientBalancePaidOut(t *testing.T) {
 				transactionmock.ABICall(&chequebookABI, chequebookAddress, big.NewInt(0).Bytes(), "paidOut", beneficiary),
 			),
 		),
-		func(c *chequebook.SignedCheque, cid int64) (common.Address, error) {
+		func(c *chequebook.SignedCheque, domain string) (common.Address, error) {
 			return issuer, nil
 		})
 
@@ -371,8 +369,49 @@ func TestReceiveChequeSufficientBalancePaidOut(t *testing.T) {
 			Chequebook:       chequebookAddress,
 		},
 		Signature: sig,
-	})
+	}, exchangeRate, deduction)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
+
+func TestReceiveChequeDeduction(t *testing.T) {
+	beneficiary := common.HexToAddress("0xffff")
+	chequebookAddress := common.HexToAddress("0xeeee")
+	exchangeRate := big.NewInt(10)
+	deduction := big.NewInt(100)
+
+	chequestore := chequebook.NewChequeStore(
+		storemock.NewStateStore(),
+		&factoryMock{
+			verifyChequebook: func(ctx context.Context, address common.Address) error {
+				return nil
+			},
+		},
+		testDomain,
+		beneficiary,
+		transactionmock.New(),
+		nil,
+	)
+
+	for _, tc := range []struct {
+		payout int64
+		err    error
+	}{
+		// the first cheque must pay the deduction and at least one unit
+		{payout: 105, err: chequebook.ErrChequeValueTooLow},
+		{payout: 115, err: chequebook.ErrChequeRateMismatch},
+	} {
+		_, err := chequestore.ReceiveCheque(context.Background(), &chequebook.SignedCheque{
+			Cheque: chequebook.Cheque{
+				Beneficiary:      beneficiary,
+				CumulativePayout: big.NewInt(tc.payout),
+				Chequebook:       chequebookAddress,
+			},
+			Signature: make([]byte, 65),
+		}, exchangeRate, deduction)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("payout %d: got error %v, want %v", tc.payout, err, tc.err)
+		}
+	}
+}
@@ -54,3 +54,15 @@ func (m *factoryMock) VerifyBytecode(ctx context.Context) error {
 func (m *factoryMock) VerifyChequebook(ctx context.Context, chequebook common.Address) error {
 	return m.verifyChequebook(ctx, chequebook)
 }
+
+func (m *factoryMock) InsureOfflineCallerExist(ctx context.Context) error {
+	return nil
+}
+
+func (m *factoryMock) QueryUserChequeBook(ctx context.Context, userAddr common.Address) (*common.Address, error) {
+	panic("implement me")
+}
+
+func (m *factoryMock) VerifyChequebookOwner(ctx context.Context, chequebook common.Address, chequebookOwner common.Address) error {
+	panic("implement me")
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/penguintop/penguin/pkg/xwcfmt"
 	"math/big"
 
@@ -173,3 +174,62 @@ func (c *chequebookContract) TotalPaidOut(ctx context.Context) (*big.Int, error)
 
 	return totalPaidOut, nil
 }
+
+// The multi-issuer chequebook contract variant (XRC20MultiIssuerSimpleSwap)
+// authorizes issuers other than the owner to sign cheques of the chequebook,
+// each up to an allowance. The cumulative payouts of the delegated cheques are
+// tracked per issuer and beneficiary, the allowance caps the total paid out on
+// the cheques of an issuer to all beneficiaries.
+
+// IssuerAllowance returns the total amount the issuer may pay out with
+// delegated cheques, zero if the issuer is not authorized.
+func (c *chequebookContract) IssuerAllowance(ctx context.Context, issuer common.Address) (*big.Int, error) {
+	issuerAddr, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(issuer[:]))
+	return c.callBigInt(ctx, "issuerAllowance", issuerAddr)
+}
+
+// IssuerPaidOut returns the amount paid out on the delegated cheques of the
+// issuer to all beneficiaries.
+func (c *chequebookContract) IssuerPaidOut(ctx context.Context, issuer common.Address) (*big.Int, error) {
+	issuerAddr, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(issuer[:]))
+	return c.callBigInt(ctx, "issuerPaidOut", issuerAddr)
+}
+
+// DelegatedPaidOut returns the amount paid out on the delegated cheques of the
+// issuer to the beneficiary.
+func (c *chequebookContract) DelegatedPaidOut(ctx context.Context, issuer, beneficiary common.Address) (*big.Int, error) {
+	issuerAddr, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(issuer[:]))
+	beneficiaryAddr, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(beneficiary[:]))
+	return c.callBigInt(ctx, "delegatedPaidOut", issuerAddr+","+beneficiaryAddr)
+}
+
+// callBigInt calls the contract api returning an integer.
+func (c *chequebookContract) callBigInt(ctx context.Context, api, args string) (*big.Int, error) {
+	type CallData struct {
+		CallApi  string `json:"CallApi"`
+		CallArgs string `json:"CallArgs"`
+	}
+
+	callDataBytes, err := json.Marshal(CallData{
+		CallApi:  api,
+		CallArgs: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := c.transactionService.Call(ctx, &transaction.TxRequest{
+		To:   &c.address,
+		Data: callDataBytes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := big.NewInt(0).SetString(string(output), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid %s value", api)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,303 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chequebook_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
+	chequestoremock "github.com/penguintop/penguin/pkg/settlement/swap/chequestore/mock"
+	storemock "github.com/penguintop/penguin/pkg/statestore/mock"
+	"github.com/penguintop/penguin/pkg/transaction"
+	"github.com/penguintop/penguin/pkg/transaction/backendmock"
+	transactionmock "github.com/penguintop/penguin/pkg/transaction/mock"
+	"github.com/penguintop/penguin/pkg/xwcfmt"
+	"github.com/penguintop/penguin/pkg/xwctypes"
+)
+
+// multiIssuerContract is the state of a multi-issuer chequebook answering the
+// calls of the contract api.
+type multiIssuerContract struct {
+	balance          int64
+	allowance        map[common.Address]int64
+	issuerPaidOut    map[common.Address]int64
+	delegatedPaidOut map[common.Address]int64 // by issuer, for the beneficiary
+}
+
+func (c *multiIssuerContract) call(t *testing.T) func(ctx context.Context, request *transaction.TxRequest) ([]byte, error) {
+	issuers := make(map[string]common.Address)
+	for issuer := range c.allowance {
+		issuers[xwcAddress(issuer)] = issuer
+	}
+
+	return func(ctx context.Context, request *transaction.TxRequest) ([]byte, error) {
+		var callData struct {
+			CallApi  string `json:"CallApi"`
+			CallArgs string `json:"CallArgs"`
+		}
+		if err := json.Unmarshal(request.Data, &callData); err != nil {
+			t.Fatal(err)
+		}
+		issuer := issuers[strings.Split(callData.CallArgs, ",")[0]]
+
+		var value int64
+		switch callData.CallApi {
+		case "balance":
+			value = c.balance
+		case "issuerAllowance":
+			value = c.allowance[issuer]
+		case "issuerPaidOut":
+			value = c.issuerPaidOut[issuer]
+		case "delegatedPaidOut":
+			value = c.delegatedPaidOut[issuer]
+		default:
+			t.Fatalf("unexpected call %s", callData.CallApi)
+		}
+		return []byte(big.NewInt(value).String()), nil
+	}
+}
+
+func xwcAddress(address common.Address) string {
+	addr, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(address[:]))
+	return addr
+}
+
+func TestReceiveDelegatedCheque(t *testing.T) {
+	var (
+		beneficiary       = common.HexToAddress("0xffff")
+		issuer            = common.HexToAddress("0xbeee")
+		otherIssuer       = common.HexToAddress("0xbeef")
+		chequebookAddress = common.HexToAddress("0xeeee")
+		rate              = big.NewInt(1)
+		noDeduction       = big.NewInt(0)
+	)
+
+	newCheque := func(issuer common.Address, cumulativePayout int64) *chequebook.SignedCheque {
+		return &chequebook.SignedCheque{
+			Cheque: chequebook.Cheque{
+				Beneficiary:      beneficiary,
+				CumulativePayout: big.NewInt(cumulativePayout),
+				Chequebook:       chequebookAddress,
+				Issuer:           issuer,
+			},
+			Signature: make([]byte, 65),
+		}
+	}
+
+	newChequeStore := func(contract *multiIssuerContract) chequebook.ChequeStore {
+		return chequebook.NewChequeStore(
+			storemock.NewStateStore(),
+			&factoryMock{
+				verifyChequebook: func(ctx context.Context, address common.Address) error {
+					if address != chequebookAddress {
+						t.Fatal("verifying wrong chequebook")
+					}
+					return nil
+				},
+			},
+			testDomain,
+			beneficiary,
+			transactionmock.New(transactionmock.WithCallFunc(contract.call(t))),
+			func(c *chequebook.SignedCheque, domain string) (common.Address, error) {
+				return c.Issuer, nil
+			})
+	}
+
+	t.Run("separate sequences per issuer", func(t *testing.T) {
+		chequestore := newChequeStore(&multiIssuerContract{
+			balance:   10000,
+			allowance: map[common.Address]int64{issuer: 1000, otherIssuer: 1000},
+		})
+
+		cheque := newCheque(issuer, 300)
+		if _, err := chequestore.ReceiveCheque(context.Background(), cheque, rate, noDeduction); err != nil {
+			t.Fatal(err)
+		}
+		// the cheques of another issuer of the same chequebook start from zero
+		otherCheque := newCheque(otherIssuer, 100)
+		received, err := chequestore.ReceiveCheque(context.Background(), otherCheque, rate, noDeduction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if received.Cmp(big.NewInt(100)) != 0 {
+			t.Fatalf("got received %d, want 100", received)
+		}
+
+		lastCheque, err := chequestore.LastCheque(chequebook.ChequeSource{Chequebook: chequebookAddress, Issuer: issuer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cheque.Equal(lastCheque) {
+			t.Fatalf("stored wrong cheque. wanted %v, got %v", cheque, lastCheque)
+		}
+		if _, err := chequestore.LastCheque(chequebook.ChequeSource{Chequebook: chequebookAddress}); !errors.Is(err, chequebook.ErrNoCheque) {
+			t.Fatalf("got error %v, want %v", err, chequebook.ErrNoCheque)
+		}
+
+		lastCheques, err := chequestore.LastCheques()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lastCheques) != 2 {
+			t.Fatalf("got %d last cheques, want 2", len(lastCheques))
+		}
+		for _, c := range []*chequebook.SignedCheque{cheque, otherCheque} {
+			if !c.Equal(lastCheques[c.Source()]) {
+				t.Fatalf("got last cheque %v for %v, want %v", lastCheques[c.Source()], c.Source(), c)
+			}
+		}
+	})
+
+	t.Run("allowance shared with other beneficiaries", func(t *testing.T) {
+		// the issuer paid out 800 of its allowance, 100 of it to us
+		contract := &multiIssuerContract{
+			balance:          10000,
+			allowance:        map[common.Address]int64{issuer: 1000},
+			issuerPaidOut:    map[common.Address]int64{issuer: 800},
+			delegatedPaidOut: map[common.Address]int64{issuer: 100},
+		}
+		chequestore := newChequeStore(contract)
+
+		if _, err := chequestore.ReceiveCheque(context.Background(), newCheque(issuer, 400), rate, noDeduction); !errors.Is(err, chequebook.ErrAllowanceExceeded) {
+			t.Fatalf("got error %v, want %v", err, chequebook.ErrAllowanceExceeded)
+		}
+		if _, err := chequestore.ReceiveCheque(context.Background(), newCheque(issuer, 300), rate, noDeduction); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("issuer not authorized", func(t *testing.T) {
+		chequestore := newChequeStore(&multiIssuerContract{
+			balance:   10000,
+			allowance: map[common.Address]int64{issuer: 0},
+		})
+
+		if _, err := chequestore.ReceiveCheque(context.Background(), newCheque(issuer, 100), rate, noDeduction); !errors.Is(err, chequebook.ErrIssuerNotAuthorized) {
+			t.Fatalf("got error %v, want %v", err, chequebook.ErrIssuerNotAuthorized)
+		}
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		chequestore := chequebook.NewChequeStore(
+			storemock.NewStateStore(),
+			&factoryMock{
+				verifyChequebook: func(ctx context.Context, address common.Address) error {
+					return nil
+				},
+			},
+			testDomain,
+			beneficiary,
+			transactionmock.New(),
+			func(c *chequebook.SignedCheque, domain string) (common.Address, error) {
+				return otherIssuer, nil
+			})
+
+		if _, err := chequestore.ReceiveCheque(context.Background(), newCheque(issuer, 100), rate, noDeduction); !errors.Is(err, chequebook.ErrChequeInvalid) {
+			t.Fatalf("got error %v, want %v", err, chequebook.ErrChequeInvalid)
+		}
+	})
+}
+
+func TestCashDelegatedCheque(t *testing.T) {
+	var (
+		chequebookAddress = common.HexToAddress("0xcfec")
+		issuer            = common.HexToAddress("0xbeee")
+		recipient         = common.HexToAddress("0xcfea")
+		txHash            = common.HexToHash("0xaaaa")
+		source            = chequebook.ChequeSource{Chequebook: chequebookAddress, Issuer: issuer}
+	)
+
+	signature := make([]byte, 65)
+	for i := range signature {
+		signature[i] = byte(i)
+	}
+	cheque := &chequebook.SignedCheque{
+		Cheque: chequebook.Cheque{
+			Beneficiary:      common.HexToAddress("0xcfee"),
+			CumulativePayout: big.NewInt(500),
+			Chequebook:       chequebookAddress,
+			Issuer:           issuer,
+		},
+		Signature: signature,
+	}
+
+	cashoutService := chequebook.NewCashoutService(
+		storemock.NewStateStore(),
+		backendmock.New(
+			backendmock.WithTransactionByHashFunc(func(ctx context.Context, hash common.Hash) (*xwctypes.RpcTransaction, bool, error) {
+				if hash != txHash {
+					t.Fatalf("fetching wrong transaction. wanted %x, got %x", txHash, hash)
+				}
+				return nil, true, nil
+			}),
+		),
+		transactionmock.New(
+			transactionmock.WithSendFunc(func(ctx context.Context, request *transaction.TxRequest) (common.Hash, error) {
+				if *request.To != chequebookAddress {
+					t.Fatalf("sending to wrong contract. wanted %x, got %x", chequebookAddress, request.To)
+				}
+				if request.InvokeApi != "cashDelegatedChequeBeneficiary" {
+					t.Fatalf("invoking wrong api. wanted cashDelegatedChequeBeneficiary, got %s", request.InvokeApi)
+				}
+				wantArgs := strings.Join([]string{
+					xwcAddress(issuer),
+					xwcAddress(recipient),
+					"500",
+					hex.EncodeToString(signature[0:32]),
+					hex.EncodeToString(signature[32:64]),
+					hex.EncodeToString(signature[64:65]),
+				}, ",")
+				if request.InvokeArgs != wantArgs {
+					t.Fatalf("invoking with wrong args. wanted %s, got %s", wantArgs, request.InvokeArgs)
+				}
+				return txHash, nil
+			}),
+		),
+		chequestoremock.NewChequeStore(
+			chequestoremock.WithLastChequeFunc(func(s chequebook.ChequeSource) (*chequebook.SignedCheque, error) {
+				if s != source {
+					return nil, chequebook.ErrNoCheque
+				}
+				return cheque, nil
+			}),
+		),
+	)
+
+	// the cheques of the chequebook owner are cashed separately
+	if _, err := cashoutService.CashCheque(context.Background(), chequebook.ChequeSource{Chequebook: chequebookAddress}, recipient); !errors.Is(err, chequebook.ErrNoCheque) {
+		t.Fatalf("got error %v, want %v", err, chequebook.ErrNoCheque)
+	}
+
+	returnedTxHash, err := cashoutService.CashCheque(context.Background(), source, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if returnedTxHash != txHash {
+		t.Fatalf("returned wrong transaction hash. wanted %x, got %x", txHash, returnedTxHash)
+	}
+
+	status, err := cashoutService.CashoutStatus(context.Background(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Last == nil || !status.Last.Cheque.Equal(cheque) {
+		t.Fatalf("got last cashout %v, want cheque %v", status.Last, cheque)
+	}
+	if status.UncashedAmount.Sign() != 0 {
+		t.Fatalf("got uncashed amount %d, want 0", status.UncashedAmount)
+	}
+
+	// the cashout of the delegated cheques is not the cashout of the owner cheques
+	if _, err := cashoutService.CashoutStatus(context.Background(), chequebook.ChequeSource{Chequebook: chequebookAddress}); !errors.Is(err, chequebook.ErrNoCheque) {
+		t.Fatalf("got error %v, want %v", err, chequebook.ErrNoCheque)
+	}
+}
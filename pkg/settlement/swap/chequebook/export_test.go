@@ -0,0 +1,23 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chequebook
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func (a *AutoCashout) SetTimeNow(f func() time.Time) {
+	a.timeNow = f
+}
+
+func (a *AutoCashout) SetBalanceFunc(f func(ctx context.Context, chequebook common.Address) (*big.Int, error)) {
+	a.balance = f
+}
+
+var ChequeSigningData = chequeSigningData
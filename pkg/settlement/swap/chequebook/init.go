@@ -309,3 +309,53 @@ func Init(
 
 	return chequebookService, nil
 }
+
+// InitDelegated initialises the chequebook service issuing delegated cheques
+// of the multi-issuer chequebook with the key of the node. The chequebook must
+// be deployed by the factory and the node must be authorized as its issuer.
+func InitDelegated(
+	ctx context.Context,
+	chequebookFactory Factory,
+	stateStore storage.StateStorer,
+	logger logging.Logger,
+	transactionService transaction.Service,
+	swapBackend transaction.Backend,
+	chequebookAddress common.Address,
+	overlayXwcAddress common.Address,
+	chequeSigner ChequeSigner,
+) (chequebookService Service, err error) {
+	err = chequebookFactory.VerifyBytecode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = chequebookFactory.VerifyChequebook(ctx, chequebookAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	allowance, err := newChequebookContract(chequebookAddress, transactionService).IssuerAllowance(ctx, overlayXwcAddress)
+	if err != nil {
+		return nil, err
+	}
+	if allowance.Sign() <= 0 {
+		return nil, ErrIssuerNotAuthorized
+	}
+
+	erc20Address, err := chequebookFactory.ERC20Address(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	erc20Service := erc20.New(swapBackend, transactionService, erc20Address)
+
+	chequebookService, err = NewDelegated(transactionService, chequebookAddress, overlayXwcAddress, stateStore, chequeSigner, erc20Service)
+	if err != nil {
+		return nil, err
+	}
+
+	chequebookXwcAddr, _ := xwcfmt.HexAddrToXwcConAddr(hex.EncodeToString(chequebookAddress[:]))
+	logger.Infof("issuing delegated cheques of chequebook %s with allowance %d", chequebookXwcAddr, allowance)
+
+	return chequebookService, nil
+}
@@ -21,6 +21,7 @@ type Service struct {
 	chequebookIssueFunc            func(ctx context.Context, beneficiary common.Address, amount *big.Int, sendChequeFunc chequebook.SendChequeFunc) (*big.Int, error)
 	chequebookWithdrawFunc         func(ctx context.Context, amount *big.Int) (hash common.Hash, err error)
 	chequebookDepositFunc          func(ctx context.Context, amount *big.Int) (hash common.Hash, err error)
+	lastChequeFunc                 func(beneficiary common.Address) (*chequebook.SignedCheque, error)
 }
 
 // WithChequebook*Functions set the mock chequebook functions
@@ -54,6 +55,12 @@ func WithChequebookIssueFunc(f func(ctx context.Context, beneficiary common.Addr
 	})
 }
 
+func WithLastChequeFunc(f func(beneficiary common.Address) (*chequebook.SignedCheque, error)) Option {
+	return optionFunc(func(s *Service) {
+		s.lastChequeFunc = f
+	})
+}
+
 func WithChequebookWithdrawFunc(f func(ctx context.Context, amount *big.Int) (hash common.Hash, err error)) Option {
 	return optionFunc(func(s *Service) {
 		s.chequebookWithdrawFunc = f
@@ -113,6 +120,9 @@ func (s *Service) Issue(ctx context.Context, beneficiary common.Address, amount
 }
 
 func (s *Service) LastCheque(beneficiary common.Address) (*chequebook.SignedCheque, error) {
+	if s.lastChequeFunc != nil {
+		return s.lastChequeFunc(beneficiary)
+	}
 	return nil, errors.New("Error")
 }
 
@@ -0,0 +1,171 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chequebook
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/transaction"
+)
+
+// Solvency describes whether a chequebook holds enough funds to cover the
+// cheques we received from it.
+type Solvency struct {
+	Chequebook common.Address
+	// Issuer is the issuer of the delegated cheques of a multi-issuer
+	// chequebook, zero for the cheques of the chequebook owner.
+	Issuer common.Address
+	// Balance is the on-chain balance of the chequebook.
+	Balance *big.Int
+	// TotalPaidOut is the amount paid out by the chequebook to all beneficiaries.
+	TotalPaidOut *big.Int
+	// PaidOut is the amount paid out by the chequebook to us.
+	PaidOut *big.Int
+	// CumulativePayout is the cumulative payout of the last received cheque.
+	CumulativePayout *big.Int
+	// Uncashed is the part of the cumulative payout not yet paid out to us.
+	Uncashed *big.Int
+	// SharedUncashed is the estimated uncashed amount of the cheques of the
+	// other beneficiaries, which the balance has to cover as well.
+	SharedUncashed *big.Int
+	// Risk is the fraction of the uncashed amount not covered by our share
+	// of the balance, ranging from 0, when all cheques can be cashed, to 1,
+	// when none can.
+	Risk float64
+	// Insolvent is true if the balance does not cover the uncashed amount.
+	Insolvent bool
+}
+
+// SolvencyChecker checks the solvency of the chequebooks we received cheques from.
+type SolvencyChecker interface {
+	// Solvency returns the solvency of the chequebook with respect to the last
+	// cheque received from the cheque source.
+	Solvency(ctx context.Context, source ChequeSource) (*Solvency, error)
+}
+
+type solvencyChecker struct {
+	chequeStore        ChequeStore
+	transactionService transaction.Service
+	beneficiary        common.Address
+}
+
+// NewSolvencyChecker creates a SolvencyChecker for the cheques received by
+// the beneficiary.
+func NewSolvencyChecker(chequeStore ChequeStore, transactionService transaction.Service, beneficiary common.Address) SolvencyChecker {
+	return &solvencyChecker{
+		chequeStore:        chequeStore,
+		transactionService: transactionService,
+		beneficiary:        beneficiary,
+	}
+}
+
+// Solvency returns the solvency of the chequebook.
+func (s *solvencyChecker) Solvency(ctx context.Context, source ChequeSource) (*Solvency, error) {
+	cheque, err := s.chequeStore.LastCheque(source)
+	if err != nil {
+		return nil, err
+	}
+
+	chequebook := cheque.Chequebook
+	contract := newChequebookContract(chequebook, s.transactionService)
+
+	balance, err := contract.Balance(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("balance: %w", err)
+	}
+	totalPaidOut, err := contract.TotalPaidOut(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("total paid out: %w", err)
+	}
+
+	if cheque.Delegated() {
+		return s.delegatedSolvency(ctx, contract, cheque, balance, totalPaidOut)
+	}
+
+	paidOut, err := contract.PaidOut(ctx, s.beneficiary)
+	if err != nil {
+		return nil, fmt.Errorf("paid out: %w", err)
+	}
+
+	return NewSolvency(chequebook, balance, totalPaidOut, paidOut, cheque.CumulativePayout), nil
+}
+
+// delegatedSolvency returns the solvency of the issuer of delegated cheques,
+// who can not pay out more than the rest of its allowance.
+func (s *solvencyChecker) delegatedSolvency(ctx context.Context, contract *chequebookContract, cheque *SignedCheque, balance, totalPaidOut *big.Int) (*Solvency, error) {
+	allowance, err := contract.IssuerAllowance(ctx, cheque.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("issuer allowance: %w", err)
+	}
+	issuerPaidOut, err := contract.IssuerPaidOut(ctx, cheque.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("issuer paid out: %w", err)
+	}
+	paidOut, err := contract.DelegatedPaidOut(ctx, cheque.Issuer, s.beneficiary)
+	if err != nil {
+		return nil, fmt.Errorf("paid out: %w", err)
+	}
+
+	allowanceLeft := new(big.Int).Sub(allowance, issuerPaidOut)
+	if allowanceLeft.Cmp(balance) < 0 {
+		balance = allowanceLeft
+	}
+	if balance.Sign() < 0 {
+		balance = big.NewInt(0)
+	}
+
+	solvency := NewSolvency(cheque.Chequebook, balance, totalPaidOut, paidOut, cheque.CumulativePayout)
+	solvency.Issuer = cheque.Issuer
+	return solvency, nil
+}
+
+// NewSolvency computes the solvency of a chequebook from its on-chain state
+// and the cumulative payout of the last received cheque.
+//
+// The balance is shared with the other beneficiaries of the chequebook. Their
+// uncashed amount is not known, it is estimated from what was paid out to
+// them, assuming that they are as far behind with cashing their cheques as
+// we are. The balance covers our uncashed amount in proportion to the
+// estimated uncashed amount of all the beneficiaries.
+func NewSolvency(chequebook common.Address, balance, totalPaidOut, paidOut, cumulativePayout *big.Int) *Solvency {
+	uncashed := new(big.Int).Sub(cumulativePayout, paidOut)
+	if uncashed.Sign() < 0 {
+		uncashed.SetInt64(0)
+	}
+
+	sharedUncashed := new(big.Int)
+	if othersPaidOut := new(big.Int).Sub(totalPaidOut, paidOut); othersPaidOut.Sign() > 0 && paidOut.Sign() > 0 {
+		sharedUncashed.Mul(othersPaidOut, uncashed)
+		sharedUncashed.Div(sharedUncashed, paidOut)
+	}
+
+	var risk float64
+	total := new(big.Int).Add(uncashed, sharedUncashed)
+	insolvent := uncashed.Sign() > 0 && balance.Cmp(total) < 0
+	if insolvent {
+		covered := new(big.Int).Mul(balance, uncashed)
+		covered.Div(covered, total)
+		if covered.Sign() < 0 {
+			covered.SetInt64(0)
+		}
+		uncovered := new(big.Int).Sub(uncashed, covered)
+		risk, _ = new(big.Rat).SetFrac(uncovered, uncashed).Float64()
+	}
+
+	return &Solvency{
+		Chequebook:       chequebook,
+		Balance:          balance,
+		TotalPaidOut:     totalPaidOut,
+		PaidOut:          paidOut,
+		CumulativePayout: cumulativePayout,
+		Uncashed:         uncashed,
+		SharedUncashed:   sharedUncashed,
+		Risk:             risk,
+		Insolvent:        insolvent,
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chequebook_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
+)
+
+func TestSolvency(t *testing.T) {
+	chequebookAddress := common.HexToAddress("0xcd")
+
+	for _, tc := range []struct {
+		name             string
+		balance          int64
+		totalPaidOut     int64
+		paidOut          int64
+		cumulativePayout int64
+		uncashed         int64
+		sharedUncashed   int64
+		risk             float64
+		insolvent        bool
+	}{
+		{name: "covered", balance: 100, totalPaidOut: 20, paidOut: 20, cumulativePayout: 100, uncashed: 80},
+		{name: "exactly covered", balance: 80, totalPaidOut: 20, paidOut: 20, cumulativePayout: 100, uncashed: 80},
+		{name: "partially covered", balance: 20, totalPaidOut: 20, paidOut: 20, cumulativePayout: 100, uncashed: 80, risk: 0.75, insolvent: true},
+		{name: "empty", balance: 0, totalPaidOut: 0, paidOut: 0, cumulativePayout: 100, uncashed: 100, risk: 1, insolvent: true},
+		{name: "cashed", balance: 0, totalPaidOut: 100, paidOut: 100, cumulativePayout: 100, uncashed: 0},
+		{name: "shared and covered", balance: 160, totalPaidOut: 40, paidOut: 20, cumulativePayout: 100, uncashed: 80, sharedUncashed: 80},
+		{name: "shared", balance: 80, totalPaidOut: 40, paidOut: 20, cumulativePayout: 100, uncashed: 80, sharedUncashed: 80, risk: 0.5, insolvent: true},
+		{name: "others not estimated", balance: 100, totalPaidOut: 500, paidOut: 0, cumulativePayout: 100, uncashed: 100},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := chequebook.NewSolvency(chequebookAddress, big.NewInt(tc.balance), big.NewInt(tc.totalPaidOut), big.NewInt(tc.paidOut), big.NewInt(tc.cumulativePayout))
+			if s.Uncashed.Cmp(big.NewInt(tc.uncashed)) != 0 {
+				t.Fatalf("got uncashed %d, want %d", s.Uncashed, tc.uncashed)
+			}
+			if s.SharedUncashed.Cmp(big.NewInt(tc.sharedUncashed)) != 0 {
+				t.Fatalf("got shared uncashed %d, want %d", s.SharedUncashed, tc.sharedUncashed)
+			}
+			if s.Risk != tc.risk {
+				t.Fatalf("got risk %v, want %v", s.Risk, tc.risk)
+			}
+			if s.Insolvent != tc.insolvent {
+				t.Fatalf("got insolvent %v, want %v", s.Insolvent, tc.insolvent)
+			}
+		})
+	}
+}
@@ -8,30 +8,29 @@ import (
 	"context"
 	"math/big"
 
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
 )
 
 // Service is the mock chequeStore service.
 type Service struct {
-	receiveCheque func(ctx context.Context, cheque *chequebook.SignedCheque) (*big.Int, error)
-	lastCheque    func(chequebook common.Address) (*chequebook.SignedCheque, error)
-	lastCheques   func() (map[common.Address]*chequebook.SignedCheque, error)
+	receiveCheque func(ctx context.Context, cheque *chequebook.SignedCheque, exchangeRate, deduction *big.Int) (*big.Int, error)
+	lastCheque    func(source chequebook.ChequeSource) (*chequebook.SignedCheque, error)
+	lastCheques   func() (map[chequebook.ChequeSource]*chequebook.SignedCheque, error)
 }
 
-func WithRetrieveChequeFunc(f func(ctx context.Context, cheque *chequebook.SignedCheque) (*big.Int, error)) Option {
+func WithRetrieveChequeFunc(f func(ctx context.Context, cheque *chequebook.SignedCheque, exchangeRate, deduction *big.Int) (*big.Int, error)) Option {
 	return optionFunc(func(s *Service) {
 		s.receiveCheque = f
 	})
 }
 
-func WithLastChequeFunc(f func(chequebook common.Address) (*chequebook.SignedCheque, error)) Option {
+func WithLastChequeFunc(f func(source chequebook.ChequeSource) (*chequebook.SignedCheque, error)) Option {
 	return optionFunc(func(s *Service) {
 		s.lastCheque = f
 	})
 }
 
-func WithLastChequesFunc(f func() (map[common.Address]*chequebook.SignedCheque, error)) Option {
+func WithLastChequesFunc(f func() (map[chequebook.ChequeSource]*chequebook.SignedCheque, error)) Option {
 	return optionFunc(func(s *Service) {
 		s.lastCheques = f
 	})
@@ -46,15 +45,15 @@ func NewChequeStore(opts ...Option) chequebook.ChequeStore {
 	return mock
 }
 
-func (s *Service) ReceiveCheque(ctx context.Context, cheque *chequebook.SignedCheque) (*big.Int, error) {
-	return s.receiveCheque(ctx, cheque)
+func (s *Service) ReceiveCheque(ctx context.Context, cheque *chequebook.SignedCheque, exchangeRate, deduction *big.Int) (*big.Int, error) {
+	return s.receiveCheque(ctx, cheque, exchangeRate, deduction)
 }
 
-func (s *Service) LastCheque(chequebook common.Address) (*chequebook.SignedCheque, error) {
-	return s.lastCheque(chequebook)
+func (s *Service) LastCheque(source chequebook.ChequeSource) (*chequebook.SignedCheque, error) {
+	return s.lastCheque(source)
 }
 
-func (s *Service) LastCheques() (map[common.Address]*chequebook.SignedCheque, error) {
+func (s *Service) LastCheques() (map[chequebook.ChequeSource]*chequebook.SignedCheque, error) {
 	return s.lastCheques()
 }
 
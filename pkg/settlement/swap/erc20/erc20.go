@@ -17,6 +17,13 @@ import (
 	"github.com/ethersphere/go-sw3-abi/sw3abi"
 )
 
+const (
+	// TransferGasPrice is the gas price of token transfers.
+	TransferGasPrice = 10
+	// TransferGasLimit is the gas limit of token transfers.
+	TransferGasLimit = 100000
+)
+
 var (
 	erc20ABI     = transaction.ParseABIUnchecked(sw3abi.ERC20ABIv0_3_1)
 	errDecodeABI = errors.New("could not decode abi data")
@@ -112,12 +119,12 @@ func (c *erc20Service) Transfer(ctx context.Context, address common.Address, val
 	erc20To, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(address[:]))
 
 	conApi := "transfer"
-	conArg := fmt.Sprintf("%s,%d", erc20To, value.Uint64())
+	conArg := fmt.Sprintf("%s,%s", erc20To, value.String())
 
 	request := &transaction.TxRequest{
 		To:       &c.address,
-		GasPrice: big.NewInt(10),
-		GasLimit: 100000,
+		GasPrice: big.NewInt(TransferGasPrice),
+		GasLimit: TransferGasLimit,
 
 		TxType:     transaction.TxTypeInvokeContract,
 		InvokeApi:  conApi,
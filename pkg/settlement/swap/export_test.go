@@ -0,0 +1,21 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swap
+
+import (
+	"math/big"
+
+	"github.com/penguintop/penguin/pkg/penguin"
+)
+
+// AgreeRates sets the rates agreed with the peer as the handshake does.
+func (s *Service) AgreeRates(peer penguin.Address, exchangeRate, deduction *big.Int) {
+	if err := s.agreeRates(peer, rates{
+		ExchangeRate: exchangeRate,
+		Deduction:    deduction,
+	}); err != nil {
+		panic(err)
+	}
+}
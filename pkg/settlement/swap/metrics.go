@@ -16,6 +16,8 @@ type metrics struct {
 	ChequesSent      prometheus.Counter
 	ChequesRejected  prometheus.Counter
 	AvailableBalance prometheus.Gauge
+
+	InsolventChequebooks prometheus.Counter
 }
 
 func newMetrics() metrics {
@@ -58,6 +60,12 @@ func newMetrics() metrics {
 			Name:      "available_balance",
 			Help:      "Currently availeble chequebook balance.",
 		}),
+		InsolventChequebooks: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "insolvent_chequebooks",
+			Help:      "Number of times a peer chequebook was found insolvent",
+		}),
 	}
 }
 
@@ -27,7 +27,8 @@ type Service struct {
 
 	receiveChequeFunc   func(context.Context, penguin.Address, *chequebook.SignedCheque) error
 	payFunc             func(context.Context, penguin.Address, *big.Int)
-	handshakeFunc       func(penguin.Address, common.Address) error
+	handshakeFunc       func(penguin.Address, common.Address, *big.Int, *big.Int) error
+	disconnectedFunc    func(penguin.Address)
 	lastSentChequeFunc  func(penguin.Address) (*chequebook.SignedCheque, error)
 	lastSentChequesFunc func() (map[string]*chequebook.SignedCheque, error)
 
@@ -36,6 +37,9 @@ type Service struct {
 
 	cashChequeFunc    func(ctx context.Context, peer penguin.Address) (common.Hash, error)
 	cashoutStatusFunc func(ctx context.Context, peer penguin.Address) (*chequebook.CashoutStatus, error)
+
+	peerSolvencyFunc   func(ctx context.Context, peer penguin.Address) (*chequebook.Solvency, error)
+	peerSolvenciesFunc func(ctx context.Context) (map[string]*chequebook.Solvency, error)
 }
 
 // WithsettlementFunc sets the mock settlement function
@@ -76,12 +80,18 @@ func WithPayFunc(f func(context.Context, penguin.Address, *big.Int)) Option {
 	})
 }
 
-func WithHandshakeFunc(f func(penguin.Address, common.Address) error) Option {
+func WithHandshakeFunc(f func(penguin.Address, common.Address, *big.Int, *big.Int) error) Option {
 	return optionFunc(func(s *Service) {
 		s.handshakeFunc = f
 	})
 }
 
+func WithDisconnectedFunc(f func(penguin.Address)) Option {
+	return optionFunc(func(s *Service) {
+		s.disconnectedFunc = f
+	})
+}
+
 func WithLastSentChequeFunc(f func(penguin.Address) (*chequebook.SignedCheque, error)) Option {
 	return optionFunc(func(s *Service) {
 		s.lastSentChequeFunc = f
@@ -118,6 +128,18 @@ func WithCashoutStatusFunc(f func(ctx context.Context, peer penguin.Address) (*c
 	})
 }
 
+func WithPeerSolvencyFunc(f func(ctx context.Context, peer penguin.Address) (*chequebook.Solvency, error)) Option {
+	return optionFunc(func(s *Service) {
+		s.peerSolvencyFunc = f
+	})
+}
+
+func WithPeerSolvenciesFunc(f func(ctx context.Context) (map[string]*chequebook.Solvency, error)) Option {
+	return optionFunc(func(s *Service) {
+		s.peerSolvenciesFunc = f
+	})
+}
+
 // New creates the mock swap implementation
 func New(opts ...Option) swap.Interface {
 	mock := new(Service)
@@ -189,13 +211,19 @@ func (s *Service) SettlementsReceived() (map[string]*big.Int, error) {
 }
 
 // Handshake is called by the swap protocol when a handshake is received.
-func (s *Service) Handshake(peer penguin.Address, beneficiary common.Address) error {
+func (s *Service) Handshake(peer penguin.Address, beneficiary common.Address, exchangeRate, deduction *big.Int) error {
 	if s.handshakeFunc != nil {
-		return s.handshakeFunc(peer, beneficiary)
+		return s.handshakeFunc(peer, beneficiary, exchangeRate, deduction)
 	}
 	return nil
 }
 
+func (s *Service) Disconnected(peer penguin.Address) {
+	if s.disconnectedFunc != nil {
+		s.disconnectedFunc(peer)
+	}
+}
+
 func (s *Service) LastSentCheque(address penguin.Address) (*chequebook.SignedCheque, error) {
 	if s.lastSentChequeFunc != nil {
 		return s.lastSentChequeFunc(address)
@@ -238,6 +266,20 @@ func (s *Service) CashoutStatus(ctx context.Context, peer penguin.Address) (*che
 	return nil, nil
 }
 
+func (s *Service) PeerSolvency(ctx context.Context, peer penguin.Address) (*chequebook.Solvency, error) {
+	if s.peerSolvencyFunc != nil {
+		return s.peerSolvencyFunc(ctx, peer)
+	}
+	return nil, nil
+}
+
+func (s *Service) PeerSolvencies(ctx context.Context) (map[string]*chequebook.Solvency, error) {
+	if s.peerSolvenciesFunc != nil {
+		return s.peerSolvenciesFunc(ctx)
+	}
+	return nil, nil
+}
+
 // Option is the option passed to the mock settlement service
 type Option interface {
 	apply(*Service)
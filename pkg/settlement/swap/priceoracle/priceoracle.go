@@ -0,0 +1,210 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package priceoracle provides the exchange rate between accounting units
+// and PEN and the deduction applied to the first cheque sent to a peer, as
+// published by the price oracle contract on XWC.
+package priceoracle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/transaction"
+)
+
+// firstFetchTimeout is how long Start waits for the first query of the
+// oracle contract.
+const firstFetchTimeout = 30 * time.Second
+
+var (
+	// ErrInvalidPrice is returned for prices the oracle contract should not
+	// publish.
+	ErrInvalidPrice = errors.New("invalid price")
+)
+
+// Service provides the current exchange rate and deduction.
+type Service interface {
+	io.Closer
+	// CurrentRates returns the last known exchange rate and deduction.
+	CurrentRates() (exchangeRate, deduction *big.Int, err error)
+	// GetPrice queries the oracle for the current exchange rate and deduction.
+	GetPrice(ctx context.Context) (exchangeRate, deduction *big.Int, err error)
+	// SetRatesChangedFunc sets the function called when the rates change.
+	SetRatesChangedFunc(f func(ctx context.Context))
+	// Start keeps the rates up to date until the service is closed.
+	Start()
+}
+
+type service struct {
+	logger        logging.Logger
+	backend       transaction.Backend
+	oracleAddress common.Address
+	interval      time.Duration
+
+	mu           sync.Mutex
+	exchangeRate *big.Int
+	deduction    *big.Int
+	ratesChanged func(ctx context.Context)
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a price oracle polling the oracle contract at the given
+// interval. Until the oracle answers, the rates are the fallback rates.
+func New(logger logging.Logger, backend transaction.Backend, oracleAddress common.Address, interval time.Duration, fallbackRate, fallbackDeduction *big.Int) Service {
+	return &service{
+		logger:        logger,
+		backend:       backend,
+		oracleAddress: oracleAddress,
+		interval:      interval,
+		exchangeRate:  fallbackRate,
+		deduction:     fallbackDeduction,
+		quit:          make(chan struct{}),
+	}
+}
+
+// GetPrice invokes getPrice on the oracle contract, which returns the
+// exchange rate and the deduction as comma separated decimals.
+func (s *service) GetPrice(ctx context.Context) (exchangeRate, deduction *big.Int, err error) {
+	result, err := s.backend.InvokeContractOffline(ctx, s.oracleAddress, "getPrice", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return parsePrice(result)
+}
+
+func parsePrice(s string) (exchangeRate, deduction *big.Int, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("%w: %q", ErrInvalidPrice, s)
+	}
+	exchangeRate, ok := new(big.Int).SetString(strings.TrimSpace(parts[0]), 10)
+	if !ok || exchangeRate.Sign() <= 0 {
+		return nil, nil, fmt.Errorf("%w: exchange rate %q", ErrInvalidPrice, parts[0])
+	}
+	deduction, ok = new(big.Int).SetString(strings.TrimSpace(parts[1]), 10)
+	if !ok || deduction.Sign() < 0 {
+		return nil, nil, fmt.Errorf("%w: deduction %q", ErrInvalidPrice, parts[1])
+	}
+	return exchangeRate, deduction, nil
+}
+
+// CurrentRates returns the rates of the last successful query, or the
+// fallback rates if the oracle has not answered yet.
+func (s *service) CurrentRates() (exchangeRate, deduction *big.Int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return new(big.Int).Set(s.exchangeRate), new(big.Int).Set(s.deduction), nil
+}
+
+func (s *service) SetRatesChangedFunc(f func(ctx context.Context)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ratesChanged = f
+}
+
+// update queries the oracle and stores the rates, calling the rates changed
+// function if they changed.
+func (s *service) update(ctx context.Context) error {
+	exchangeRate, deduction, err := s.GetPrice(ctx)
+	if err != nil {
+		return err
+	}
+	s.logger.Tracef("price oracle: exchange rate %d, deduction %d", exchangeRate, deduction)
+
+	s.mu.Lock()
+	changed := s.exchangeRate.Cmp(exchangeRate) != 0 || s.deduction.Cmp(deduction) != 0
+	s.exchangeRate = exchangeRate
+	s.deduction = deduction
+	ratesChanged := s.ratesChanged
+	s.mu.Unlock()
+
+	if changed && ratesChanged != nil {
+		ratesChanged(ctx)
+	}
+	return nil
+}
+
+// Start queries the oracle before it returns, so that the first handshakes
+// announce the rates of the oracle, and then at every interval. If the first
+// query fails, the fallback rates are kept until a query succeeds.
+func (s *service) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	firstCtx, firstCancel := context.WithTimeout(ctx, firstFetchTimeout)
+	if err := s.update(firstCtx); err != nil {
+		s.logger.Errorf("price oracle: could not get price, using the fallback rates: %v", err)
+	}
+	firstCancel()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+
+		for {
+			select {
+			case <-s.quit:
+				return
+			case <-time.After(s.interval):
+			}
+
+			if err := s.update(ctx); err != nil {
+				s.logger.Errorf("price oracle: could not get price: %v", err)
+			}
+		}
+	}()
+	go func() {
+		<-s.quit
+		cancel()
+	}()
+}
+
+func (s *service) Close() error {
+	close(s.quit)
+	s.wg.Wait()
+	return nil
+}
+
+type staticService struct {
+	exchangeRate *big.Int
+	deduction    *big.Int
+}
+
+// NewStatic creates a price oracle with fixed rates, for networks without an
+// oracle contract.
+func NewStatic(exchangeRate, deduction *big.Int) Service {
+	return &staticService{
+		exchangeRate: exchangeRate,
+		deduction:    deduction,
+	}
+}
+
+func (s *staticService) CurrentRates() (exchangeRate, deduction *big.Int, err error) {
+	return new(big.Int).Set(s.exchangeRate), new(big.Int).Set(s.deduction), nil
+}
+
+func (s *staticService) GetPrice(ctx context.Context) (exchangeRate, deduction *big.Int, err error) {
+	return s.CurrentRates()
+}
+
+func (s *staticService) SetRatesChangedFunc(f func(ctx context.Context)) {}
+
+func (s *staticService) Start() {}
+
+func (s *staticService) Close() error {
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package priceoracle_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/settlement/swap/priceoracle"
+	"github.com/penguintop/penguin/pkg/transaction/backendmock"
+)
+
+func TestGetPrice(t *testing.T) {
+	oracleAddress := common.HexToAddress("0xabcd")
+
+	for _, tc := range []struct {
+		name         string
+		result       string
+		exchangeRate int64
+		deduction    int64
+		err          error
+	}{
+		{name: "valid", result: "100,5000", exchangeRate: 100, deduction: 5000},
+		{name: "spaces", result: "100, 0", exchangeRate: 100},
+		{name: "zero rate", result: "0,5000", err: priceoracle.ErrInvalidPrice},
+		{name: "negative deduction", result: "100,-1", err: priceoracle.ErrInvalidPrice},
+		{name: "malformed", result: "100", err: priceoracle.ErrInvalidPrice},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			backend := backendmock.New(
+				backendmock.WithInvokeContractOfflineFunc(func(ctx context.Context, contract common.Address, api string, arg string) (string, error) {
+					if contract != oracleAddress || api != "getPrice" {
+						return "", errors.New("unexpected call")
+					}
+					return tc.result, nil
+				}),
+			)
+			oracle := priceoracle.New(logging.New(ioutil.Discard, 0), backend, oracleAddress, time.Minute, big.NewInt(1), big.NewInt(0))
+
+			exchangeRate, deduction, err := oracle.GetPrice(context.Background())
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if tc.err != nil {
+				return
+			}
+			if exchangeRate.Int64() != tc.exchangeRate || deduction.Int64() != tc.deduction {
+				t.Fatalf("got rates %d %d, want %d %d", exchangeRate, deduction, tc.exchangeRate, tc.deduction)
+			}
+		})
+	}
+}
+
+func TestCurrentRates(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		result = "7,3"
+	)
+	backend := backendmock.New(
+		backendmock.WithInvokeContractOfflineFunc(func(ctx context.Context, contract common.Address, api string, arg string) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return result, nil
+		}),
+	)
+	oracle := priceoracle.New(logging.New(ioutil.Discard, 0), backend, common.Address{}, 10*time.Millisecond, big.NewInt(1), big.NewInt(0))
+
+	// the fallback rates until the oracle is queried
+	exchangeRate, deduction, err := oracle.CurrentRates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exchangeRate.Int64() != 1 || deduction.Int64() != 0 {
+		t.Fatalf("got rates %d %d, want the fallback rates 1 0", exchangeRate, deduction)
+	}
+
+	changed := make(chan struct{}, 1)
+	oracle.SetRatesChangedFunc(func(ctx context.Context) {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	// the first query is done when started
+	oracle.Start()
+	defer oracle.Close()
+
+	exchangeRate, deduction, err = oracle.CurrentRates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exchangeRate.Int64() != 7 || deduction.Int64() != 3 {
+		t.Fatalf("got rates %d %d, want 7 3", exchangeRate, deduction)
+	}
+	<-changed
+
+	mu.Lock()
+	result = "8,3"
+	mu.Unlock()
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("rates change not notified")
+	}
+	if exchangeRate, _, _ := oracle.CurrentRates(); exchangeRate.Int64() != 8 {
+		t.Fatalf("got exchange rate %d, want 8", exchangeRate)
+	}
+}
+
+func TestFallbackRates(t *testing.T) {
+	backend := backendmock.New(
+		backendmock.WithInvokeContractOfflineFunc(func(ctx context.Context, contract common.Address, api string, arg string) (string, error) {
+			return "", errors.New("oracle not reachable")
+		}),
+	)
+	oracle := priceoracle.New(logging.New(ioutil.Discard, 0), backend, common.Address{}, time.Hour, big.NewInt(1), big.NewInt(0))
+	oracle.Start()
+	defer oracle.Close()
+
+	exchangeRate, deduction, err := oracle.CurrentRates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exchangeRate.Int64() != 1 || deduction.Int64() != 0 {
+		t.Fatalf("got rates %d %d, want the fallback rates 1 0", exchangeRate, deduction)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swap
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/p2p"
+	"github.com/penguintop/penguin/pkg/penguin"
+	"github.com/penguintop/penguin/pkg/settlement"
+	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
+)
+
+// ErrNoSolvencyChecker is the error if the solvency of peer chequebooks is
+// not checked.
+var ErrNoSolvencyChecker = errors.New("no solvency checker")
+
+// PaymentThresholdAnnouncer announces the payment threshold we expect a peer
+// to respect. It is implemented by the pricing service.
+type PaymentThresholdAnnouncer interface {
+	AnnouncePaymentThreshold(ctx context.Context, peer penguin.Address, paymentThreshold *big.Int) error
+}
+
+// PaymentThresholdEnforcer enforces the payment threshold announced to a peer
+// locally. It is implemented by the accounting.
+type PaymentThresholdEnforcer interface {
+	EnforcePaymentThreshold(peer penguin.Address, paymentThreshold *big.Int)
+}
+
+// SetSolvencyChecker sets the checker of the peer chequebooks solvency.
+func (s *Service) SetSolvencyChecker(checker chequebook.SolvencyChecker) {
+	s.solvency = checker
+}
+
+// PeerSolvency returns the solvency of the chequebook of the peer with
+// respect to the cheques received from it.
+func (s *Service) PeerSolvency(ctx context.Context, peer penguin.Address) (*chequebook.Solvency, error) {
+	if s.solvency == nil {
+		return nil, ErrNoSolvencyChecker
+	}
+	source, known, err := s.addressbook.Chequebook(peer)
+	if err != nil {
+		return nil, err
+	}
+	if !known {
+		return nil, settlement.ErrPeerNoSettlements
+	}
+	return s.solvency.Solvency(ctx, source)
+}
+
+// PeerSolvencies returns the solvency of the chequebooks of all known peers
+// we received cheques from.
+func (s *Service) PeerSolvencies(ctx context.Context) (map[string]*chequebook.Solvency, error) {
+	if s.solvency == nil {
+		return nil, ErrNoSolvencyChecker
+	}
+	cheques, err := s.chequeStore.LastCheques()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*chequebook.Solvency, len(cheques))
+	for source := range cheques {
+		peer, known, err := s.addressbook.ChequebookPeer(source)
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			continue
+		}
+		solvency, err := s.solvency.Solvency(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		result[peer.String()] = solvency
+	}
+	return result, nil
+}
+
+// SolvencyOptions configure how the peers with insolvent chequebooks are
+// treated.
+type SolvencyOptions struct {
+	// Interval between the checks of the peer chequebooks.
+	Interval time.Duration
+	// PaymentThreshold is the payment threshold announced to the peers whose
+	// chequebooks are solvent again.
+	PaymentThreshold *big.Int
+	// InsolventPaymentThreshold, if set, is announced to the peers with
+	// insolvent chequebooks, so that they settle their debt earlier, and
+	// enforced by disconnecting them when they exceed it.
+	InsolventPaymentThreshold *big.Int
+	// Disconnect disconnects the peers with insolvent chequebooks.
+	Disconnect bool
+}
+
+// SolvencyMonitor periodically checks the chequebooks of the peers we
+// received cheques from, lowering the payment threshold of or disconnecting
+// the peers whose chequebooks do not cover their uncashed cheques anymore.
+type SolvencyMonitor struct {
+	logger       logging.Logger
+	swap         *Service
+	announcer    PaymentThresholdAnnouncer
+	enforcer     PaymentThresholdEnforcer
+	disconnecter p2p.Disconnecter
+	options      SolvencyOptions
+
+	mu        sync.Mutex
+	insolvent map[string]struct{} // peers treated as insolvent
+	checking  map[string]struct{} // peers with a recheck in progress
+
+	wg     sync.WaitGroup
+	ctx    context.Context
+	quit   chan struct{}
+	cancel context.CancelFunc
+}
+
+// NewSolvencyMonitor creates the monitor of the peer chequebooks solvency.
+// The swap service rechecks the peers treated as insolvent in the background
+// whenever it accepts a cheque from them.
+func NewSolvencyMonitor(logger logging.Logger, swap *Service, announcer PaymentThresholdAnnouncer, enforcer PaymentThresholdEnforcer, disconnecter p2p.Disconnecter, o SolvencyOptions) *SolvencyMonitor {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &SolvencyMonitor{
+		logger:       logger,
+		swap:         swap,
+		announcer:    announcer,
+		enforcer:     enforcer,
+		disconnecter: disconnecter,
+		options:      o,
+		insolvent:    make(map[string]struct{}),
+		checking:     make(map[string]struct{}),
+		ctx:          ctx,
+		quit:         make(chan struct{}),
+		cancel:       cancel,
+	}
+	swap.solvencyMonitor = m
+	return m
+}
+
+// Start starts the periodic checks of the peer chequebooks.
+func (m *SolvencyMonitor) Start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.quit:
+				return
+			case <-ticker.C:
+			}
+			if err := m.Check(m.ctx); err != nil {
+				m.logger.Debugf("solvency monitor: %v", err)
+				m.logger.Error("solvency monitor: check failed")
+			}
+		}
+	}()
+}
+
+// Check checks the chequebooks of all known peers and applies the configured
+// measures to the insolvent ones.
+func (m *SolvencyMonitor) Check(ctx context.Context) error {
+	cheques, err := m.swap.chequeStore.LastCheques()
+	if err != nil {
+		return err
+	}
+
+	for source := range cheques {
+		peer, known, err := m.swap.addressbook.ChequebookPeer(source)
+		if err != nil {
+			return err
+		}
+		if !known {
+			continue
+		}
+		if _, err := m.CheckPeer(ctx, peer); err != nil {
+			m.logger.Debugf("solvency monitor: peer %s: %v", peer, err)
+		}
+	}
+	return nil
+}
+
+// CheckPeer checks the chequebook of the peer and applies the configured
+// measures if it is insolvent. Peers whose chequebooks became solvent again
+// get the regular payment threshold announced.
+func (m *SolvencyMonitor) CheckPeer(ctx context.Context, peer penguin.Address) (*chequebook.Solvency, error) {
+	solvency, err := m.swap.PeerSolvency(ctx, peer)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	_, wasInsolvent := m.insolvent[peer.String()]
+	if solvency.Insolvent {
+		m.insolvent[peer.String()] = struct{}{}
+	} else {
+		delete(m.insolvent, peer.String())
+	}
+	m.mu.Unlock()
+
+	switch {
+	case solvency.Insolvent:
+		if !wasInsolvent {
+			m.swap.metrics.InsolventChequebooks.Inc()
+			m.logger.Warningf("solvency monitor: chequebook %x of peer %s is insolvent, balance %d, uncashed %d", solvency.Chequebook, peer, solvency.Balance, solvency.Uncashed)
+		}
+		if m.options.InsolventPaymentThreshold != nil {
+			m.enforcer.EnforcePaymentThreshold(peer, m.options.InsolventPaymentThreshold)
+			if err := m.announcer.AnnouncePaymentThreshold(ctx, peer, m.options.InsolventPaymentThreshold); err != nil {
+				m.logger.Debugf("solvency monitor: announce payment threshold to peer %s: %v", peer, err)
+			}
+		}
+		if m.options.Disconnect {
+			if err := m.disconnecter.Disconnect(peer); err != nil && !errors.Is(err, p2p.ErrPeerNotFound) {
+				return solvency, err
+			}
+		}
+	case wasInsolvent:
+		m.logger.Infof("solvency monitor: chequebook %x of peer %s is solvent again", solvency.Chequebook, peer)
+		if m.options.InsolventPaymentThreshold != nil {
+			m.enforcer.EnforcePaymentThreshold(peer, nil)
+		}
+		if m.options.InsolventPaymentThreshold != nil && m.options.PaymentThreshold != nil {
+			if err := m.announcer.AnnouncePaymentThreshold(ctx, peer, m.options.PaymentThreshold); err != nil {
+				m.logger.Debugf("solvency monitor: announce payment threshold to peer %s: %v", peer, err)
+			}
+		}
+	}
+	return solvency, nil
+}
+
+// recheck checks the peer treated as insolvent in the background, as the
+// check makes several chain calls. Only one recheck of a peer runs at a time.
+func (m *SolvencyMonitor) recheck(peer penguin.Address) {
+	m.mu.Lock()
+	_, insolvent := m.insolvent[peer.String()]
+	_, checking := m.checking[peer.String()]
+	if !insolvent || checking {
+		m.mu.Unlock()
+		return
+	}
+	select {
+	case <-m.quit:
+		m.mu.Unlock()
+		return
+	default:
+	}
+	m.checking[peer.String()] = struct{}{}
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	go func() {
+		defer m.wg.Done()
+		defer func() {
+			m.mu.Lock()
+			delete(m.checking, peer.String())
+			m.mu.Unlock()
+		}()
+
+		if _, err := m.CheckPeer(m.ctx, peer); err != nil {
+			m.logger.Debugf("solvency monitor: recheck peer %s: %v", peer, err)
+		}
+	}()
+}
+
+// Insolvent reports whether the peer is treated as insolvent.
+func (m *SolvencyMonitor) Insolvent(peer penguin.Address) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.insolvent[peer.String()]
+	return ok
+}
+
+// Close stops the periodic checks, waiting for the running one to finish.
+func (m *SolvencyMonitor) Close() error {
+	m.mu.Lock()
+	close(m.quit)
+	m.mu.Unlock()
+	m.cancel()
+	m.wg.Wait()
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/penguintop/penguin/pkg/crypto"
@@ -28,8 +29,13 @@ var (
 	ErrWrongBeneficiary = errors.New("wrong beneficiary")
 	// ErrUnknownBeneficary is the error if a peer has never announced a beneficiary.
 	ErrUnknownBeneficary = errors.New("unknown beneficiary for peer")
+	// ErrNoExchangeRate is the error if no exchange rate was agreed with a peer.
+	ErrNoExchangeRate = errors.New("no exchange rate agreed with peer")
 )
 
+// peerRatesPrefix is the prefix of the rates last agreed with a peer.
+const peerRatesPrefix = "swap_peer_rates_"
+
 type Interface interface {
 	settlement.Interface
 	// LastSentCheque returns the last sent cheque for the peer
@@ -44,6 +50,10 @@ type Interface interface {
 	CashCheque(ctx context.Context, peer penguin.Address) (common.Hash, error)
 	// CashoutStatus gets the status of the latest cashout transaction for the peers chequebook
 	CashoutStatus(ctx context.Context, peer penguin.Address) (*chequebook.CashoutStatus, error)
+	// PeerSolvency returns the solvency of the chequebook of the peer
+	PeerSolvency(ctx context.Context, peer penguin.Address) (*chequebook.Solvency, error)
+	// PeerSolvencies returns the solvency of the chequebooks of all known peers
+	PeerSolvencies(ctx context.Context) (map[string]*chequebook.Solvency, error)
 }
 
 // Service is the implementation of the swap settlement layer.
@@ -59,6 +69,19 @@ type Service struct {
 	p2pService  p2p.Service
 	addressbook Addressbook
 	networkID   uint64
+
+	solvency        chequebook.SolvencyChecker
+	solvencyMonitor *SolvencyMonitor
+
+	ratesMu sync.Mutex
+	rates   map[string]rates // rates agreed in the handshake by connected peer
+}
+
+// rates are the exchange rate between accounting units and tokens and the
+// deduction paid with the first cheque.
+type rates struct {
+	ExchangeRate *big.Int `json:"exchangeRate"`
+	Deduction    *big.Int `json:"deduction"`
 }
 
 // New creates a new swap Service.
@@ -75,41 +98,92 @@ func New(proto swapprotocol.Interface, logger logging.Logger, store storage.Stat
 		cashout:     cashout,
 		p2pService:  p2pService,
 		accounting:  accounting,
+		rates:       make(map[string]rates),
+	}
+}
+
+// peerRates returns the rates agreed with the peer in the handshake of the
+// current connection, or else the rates last agreed with it.
+func (s *Service) peerRates(peer penguin.Address) (rates, error) {
+	s.ratesMu.Lock()
+	defer s.ratesMu.Unlock()
+
+	if r, ok := s.rates[peer.String()]; ok {
+		return r, nil
+	}
+	var r rates
+	if err := s.store.Get(peerRatesKey(peer), &r); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return rates{}, ErrNoExchangeRate
+		}
+		return rates{}, err
 	}
+	return r, nil
+}
+
+// agreeRates records the rates agreed with the peer.
+func (s *Service) agreeRates(peer penguin.Address, r rates) error {
+	s.ratesMu.Lock()
+	defer s.ratesMu.Unlock()
+
+	if err := s.store.Put(peerRatesKey(peer), r); err != nil {
+		return err
+	}
+	s.rates[peer.String()] = r
+	return nil
+}
+
+func peerRatesKey(peer penguin.Address) string {
+	return fmt.Sprintf("%s%s", peerRatesPrefix, peer)
 }
 
 // ReceiveCheque is called by the swap protocol if a cheque is received.
 func (s *Service) ReceiveCheque(ctx context.Context, peer penguin.Address, cheque *chequebook.SignedCheque) (err error) {
-	// check this is the same chequebook for this peer as previously
-	expectedChequebook, known, err := s.addressbook.Chequebook(peer)
+	// check this is the same chequebook and, for delegated cheques, the
+	// same issuer for this peer as previously
+	expectedSource, known, err := s.addressbook.Chequebook(peer)
 	if err != nil {
 		return err
 	}
-	if known && expectedChequebook != cheque.Chequebook {
+	if known && expectedSource != cheque.Source() {
 		return ErrWrongChequebook
 	}
 
-	amount, err := s.chequeStore.ReceiveCheque(ctx, cheque)
+	r, err := s.peerRates(peer)
 	if err != nil {
 		s.metrics.ChequesRejected.Inc()
 		return fmt.Errorf("rejecting cheque: %w", err)
 	}
 
+	received, err := s.chequeStore.ReceiveCheque(ctx, cheque, r.ExchangeRate, r.Deduction)
+	if err != nil {
+		s.metrics.ChequesRejected.Inc()
+		return fmt.Errorf("rejecting cheque: %w", err)
+	}
+	amount := new(big.Int).Div(received, r.ExchangeRate)
+
 	if !known {
-		err = s.addressbook.PutChequebook(peer, cheque.Chequebook)
+		err = s.addressbook.PutChequebook(peer, cheque.Source())
 		if err != nil {
 			return err
 		}
 	}
 
-	tot, _ := big.NewFloat(0).SetInt(amount).Float64()
+	tot, _ := big.NewFloat(0).SetInt(received).Float64()
 	s.metrics.TotalReceived.Add(tot)
 	s.metrics.ChequesReceived.Inc()
 
+	// the peer may have topped up its chequebook
+	if s.solvencyMonitor != nil {
+		s.solvencyMonitor.recheck(peer)
+	}
+
 	return s.accounting.NotifyPaymentReceived(peer, amount)
 }
 
-// Pay initiates a payment to the given peer
+// Pay initiates a payment to the given peer. The amount in accounting units
+// is converted into tokens at the exchange rate agreed with the peer, the
+// first cheque to the peer also pays the deduction.
 func (s *Service) Pay(ctx context.Context, peer penguin.Address, amount *big.Int) {
 	var err error
 	defer func() {
@@ -130,7 +204,19 @@ func (s *Service) Pay(ctx context.Context, peer penguin.Address, amount *big.Int
 		err = ErrUnknownBeneficary
 		return
 	}
-	balance, err := s.chequebook.Issue(ctx, beneficiary, amount, func(signedCheque *chequebook.SignedCheque) error {
+	r, err := s.peerRates(peer)
+	if err != nil {
+		return
+	}
+	payment := new(big.Int).Mul(amount, r.ExchangeRate)
+	_, err = s.chequebook.LastCheque(beneficiary)
+	if errors.Is(err, chequebook.ErrNoCheque) {
+		payment.Add(payment, r.Deduction)
+	} else if err != nil {
+		return
+	}
+
+	balance, err := s.chequebook.Issue(ctx, beneficiary, payment, func(signedCheque *chequebook.SignedCheque) error {
 		return s.proto.EmitCheque(ctx, peer, signedCheque)
 	})
 	if err != nil {
@@ -139,7 +225,7 @@ func (s *Service) Pay(ctx context.Context, peer penguin.Address, amount *big.Int
 	bal, _ := big.NewFloat(0).SetInt(balance).Float64()
 	s.metrics.AvailableBalance.Set(bal)
 	s.accounting.NotifyPaymentSent(peer, amount, nil)
-	amountFloat, _ := big.NewFloat(0).SetInt(amount).Float64()
+	amountFloat, _ := big.NewFloat(0).SetInt(payment).Float64()
 	s.metrics.TotalSent.Add(amountFloat)
 	s.metrics.ChequesSent.Inc()
 }
@@ -169,7 +255,7 @@ func (s *Service) TotalSent(peer penguin.Address) (totalSent *big.Int, err error
 
 // TotalReceived returns the total amount received from a peer
 func (s *Service) TotalReceived(peer penguin.Address) (totalReceived *big.Int, err error) {
-	chequebookAddress, known, err := s.addressbook.Chequebook(peer)
+	source, known, err := s.addressbook.Chequebook(peer)
 	if err != nil {
 		return nil, err
 	}
@@ -177,7 +263,7 @@ func (s *Service) TotalReceived(peer penguin.Address) (totalReceived *big.Int, e
 		return nil, settlement.ErrPeerNoSettlements
 	}
 
-	cheque, err := s.chequeStore.LastCheque(chequebookAddress)
+	cheque, err := s.chequeStore.LastCheque(source)
 	if err != nil {
 		if err == chequebook.ErrNoCheque {
 			return nil, settlement.ErrPeerNoSettlements
@@ -217,8 +303,8 @@ func (s *Service) SettlementsReceived() (map[string]*big.Int, error) {
 		return nil, err
 	}
 
-	for chequebook, cheque := range cheques {
-		peer, known, err := s.addressbook.ChequebookPeer(chequebook)
+	for source, cheque := range cheques {
+		peer, known, err := s.addressbook.ChequebookPeer(source)
 		if err != nil {
 			return nil, err
 		}
@@ -230,8 +316,9 @@ func (s *Service) SettlementsReceived() (map[string]*big.Int, error) {
 	return result, err
 }
 
-// Handshake is called by the swap protocol when a handshake is received.
-func (s *Service) Handshake(peer penguin.Address, beneficiary common.Address) error {
+// Handshake is called by the swap protocol when a handshake is received,
+// with the exchange rate and the deduction agreed with the peer.
+func (s *Service) Handshake(peer penguin.Address, beneficiary common.Address, exchangeRate, deduction *big.Int) error {
 	// check that the overlay address was derived from the beneficiary (implying they have the same private key)
 	// while this is not strictly necessary for correct functionality we need to ensure no two peers use the same beneficiary
 	// as long as we enforce this we might not need the handshake message if the p2p layer exposed the overlay public key
@@ -248,12 +335,26 @@ func (s *Service) Handshake(peer penguin.Address, beneficiary common.Address) er
 	}
 	if !known {
 		s.logger.Tracef("initial swap handshake peer: %v beneficiary: %x", peer, beneficiary)
-		return s.addressbook.PutBeneficiary(peer, beneficiary)
-	}
-	if storedBeneficiary != beneficiary {
+		if err := s.addressbook.PutBeneficiary(peer, beneficiary); err != nil {
+			return err
+		}
+	} else if storedBeneficiary != beneficiary {
 		return ErrWrongBeneficiary
 	}
-	return nil
+
+	return s.agreeRates(peer, rates{
+		ExchangeRate: exchangeRate,
+		Deduction:    deduction,
+	})
+}
+
+// Disconnected is called by the swap protocol when a peer disconnects. The
+// rates agreed with it are kept only in the state store.
+func (s *Service) Disconnected(peer penguin.Address) {
+	s.ratesMu.Lock()
+	defer s.ratesMu.Unlock()
+
+	delete(s.rates, peer.String())
 }
 
 // LastSentCheque returns the last sent cheque for the peer
@@ -275,7 +376,7 @@ func (s *Service) LastSentCheque(peer penguin.Address) (*chequebook.SignedCheque
 // LastReceivedCheque returns the last received cheque for the peer
 func (s *Service) LastReceivedCheque(peer penguin.Address) (*chequebook.SignedCheque, error) {
 
-	common, known, err := s.addressbook.Chequebook(peer)
+	source, known, err := s.addressbook.Chequebook(peer)
 
 	if err != nil {
 		return nil, err
@@ -285,7 +386,7 @@ func (s *Service) LastReceivedCheque(peer penguin.Address) (*chequebook.SignedCh
 		return nil, chequebook.ErrNoCheque
 	}
 
-	return s.chequeStore.LastCheque(common)
+	return s.chequeStore.LastCheque(source)
 }
 
 // LastSentCheques returns the list of last sent cheques for all peers
@@ -328,24 +429,24 @@ func (s *Service) LastReceivedCheques() (map[string]*chequebook.SignedCheque, er
 
 // CashCheque sends a cashing transaction for the last cheque of the peer
 func (s *Service) CashCheque(ctx context.Context, peer penguin.Address) (common.Hash, error) {
-	chequebookAddress, known, err := s.addressbook.Chequebook(peer)
+	source, known, err := s.addressbook.Chequebook(peer)
 	if err != nil {
 		return common.Hash{}, err
 	}
 	if !known {
 		return common.Hash{}, chequebook.ErrNoCheque
 	}
-	return s.cashout.CashCheque(ctx, chequebookAddress, s.chequebook.Address())
+	return s.cashout.CashCheque(ctx, source, s.chequebook.Address())
 }
 
 // CashoutStatus gets the status of the latest cashout transaction for the peers chequebook
 func (s *Service) CashoutStatus(ctx context.Context, peer penguin.Address) (*chequebook.CashoutStatus, error) {
-	chequebookAddress, known, err := s.addressbook.Chequebook(peer)
+	source, known, err := s.addressbook.Chequebook(peer)
 	if err != nil {
 		return nil, err
 	}
 	if !known {
 		return nil, chequebook.ErrNoCheque
 	}
-	return s.cashout.CashoutStatus(ctx, chequebookAddress)
+	return s.cashout.CashoutStatus(ctx, source)
 }
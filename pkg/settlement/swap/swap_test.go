@@ -9,6 +9,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"math/big"
+	"sync"
 	"testing"
 	"time"
 
@@ -84,42 +85,42 @@ func (t *testObserver) NotifyPaymentSent(peer penguin.Address, amount *big.Int,
 
 type addressbookMock struct {
 	beneficiary     func(peer penguin.Address) (beneficiary common.Address, known bool, err error)
-	chequebook      func(peer penguin.Address) (chequebookAddress common.Address, known bool, err error)
+	chequebook      func(peer penguin.Address) (source chequebook.ChequeSource, known bool, err error)
 	beneficiaryPeer func(beneficiary common.Address) (peer penguin.Address, known bool, err error)
-	chequebookPeer  func(chequebook common.Address) (peer penguin.Address, known bool, err error)
+	chequebookPeer  func(source chequebook.ChequeSource) (peer penguin.Address, known bool, err error)
 	putBeneficiary  func(peer penguin.Address, beneficiary common.Address) error
-	putChequebook   func(peer penguin.Address, chequebook common.Address) error
+	putChequebook   func(peer penguin.Address, source chequebook.ChequeSource) error
 }
 
 func (m *addressbookMock) Beneficiary(peer penguin.Address) (beneficiary common.Address, known bool, err error) {
 	return m.beneficiary(peer)
 }
-func (m *addressbookMock) Chequebook(peer penguin.Address) (chequebookAddress common.Address, known bool, err error) {
+func (m *addressbookMock) Chequebook(peer penguin.Address) (source chequebook.ChequeSource, known bool, err error) {
 	return m.chequebook(peer)
 }
 func (m *addressbookMock) BeneficiaryPeer(beneficiary common.Address) (peer penguin.Address, known bool, err error) {
 	return m.beneficiaryPeer(beneficiary)
 }
-func (m *addressbookMock) ChequebookPeer(chequebook common.Address) (peer penguin.Address, known bool, err error) {
-	return m.chequebookPeer(chequebook)
+func (m *addressbookMock) ChequebookPeer(source chequebook.ChequeSource) (peer penguin.Address, known bool, err error) {
+	return m.chequebookPeer(source)
 }
 func (m *addressbookMock) PutBeneficiary(peer penguin.Address, beneficiary common.Address) error {
 	return m.putBeneficiary(peer, beneficiary)
 }
-func (m *addressbookMock) PutChequebook(peer penguin.Address, chequebook common.Address) error {
-	return m.putChequebook(peer, chequebook)
+func (m *addressbookMock) PutChequebook(peer penguin.Address, source chequebook.ChequeSource) error {
+	return m.putChequebook(peer, source)
 }
 
 type cashoutMock struct {
-	cashCheque    func(ctx context.Context, chequebook common.Address, recipient common.Address) (common.Hash, error)
-	cashoutStatus func(ctx context.Context, chequebookAddress common.Address) (*chequebook.CashoutStatus, error)
+	cashCheque    func(ctx context.Context, source chequebook.ChequeSource, recipient common.Address) (common.Hash, error)
+	cashoutStatus func(ctx context.Context, source chequebook.ChequeSource) (*chequebook.CashoutStatus, error)
 }
 
-func (m *cashoutMock) CashCheque(ctx context.Context, chequebook, recipient common.Address) (common.Hash, error) {
-	return m.cashCheque(ctx, chequebook, recipient)
+func (m *cashoutMock) CashCheque(ctx context.Context, source chequebook.ChequeSource, recipient common.Address) (common.Hash, error) {
+	return m.cashCheque(ctx, source, recipient)
 }
-func (m *cashoutMock) CashoutStatus(ctx context.Context, chequebookAddress common.Address) (*chequebook.CashoutStatus, error) {
-	return m.cashoutStatus(ctx, chequebookAddress)
+func (m *cashoutMock) CashoutStatus(ctx context.Context, source chequebook.ChequeSource) (*chequebook.CashoutStatus, error) {
+	return m.cashoutStatus(ctx, source)
 }
 
 func TestReceiveCheque(t *testing.T) {
@@ -127,6 +128,8 @@ func TestReceiveCheque(t *testing.T) {
 	store := mockstore.NewStateStore()
 	chequebookService := mockchequebook.NewChequebook()
 	amount := big.NewInt(50)
+	exchangeRate := big.NewInt(10)
+	deduction := big.NewInt(3)
 	chequebookAddress := common.HexToAddress("0xcd")
 
 	peer := penguin.MustParseHexAddress("abcd")
@@ -140,26 +143,29 @@ func TestReceiveCheque(t *testing.T) {
 	}
 
 	chequeStore := mockchequestore.NewChequeStore(
-		mockchequestore.WithRetrieveChequeFunc(func(ctx context.Context, c *chequebook.SignedCheque) (*big.Int, error) {
+		mockchequestore.WithRetrieveChequeFunc(func(ctx context.Context, c *chequebook.SignedCheque, r, d *big.Int) (*big.Int, error) {
 			if !cheque.Equal(c) {
 				t.Fatalf("passed wrong cheque to store. wanted %v, got %v", cheque, c)
 			}
-			return amount, nil
+			if r.Cmp(exchangeRate) != 0 || d.Cmp(deduction) != 0 {
+				t.Fatalf("passed wrong rates to store. wanted %d %d, got %d %d", exchangeRate, deduction, r, d)
+			}
+			return new(big.Int).Mul(amount, exchangeRate), nil
 		}),
 	)
 	networkID := uint64(1)
 	addressbook := &addressbookMock{
-		chequebook: func(p penguin.Address) (common.Address, bool, error) {
+		chequebook: func(p penguin.Address) (chequebook.ChequeSource, bool, error) {
 			if !peer.Equal(p) {
 				t.Fatal("querying chequebook for wrong peer")
 			}
-			return chequebookAddress, true, nil
+			return chequebook.ChequeSource{Chequebook: chequebookAddress}, true, nil
 		},
-		putChequebook: func(p penguin.Address, chequebook common.Address) (err error) {
+		putChequebook: func(p penguin.Address, source chequebook.ChequeSource) (err error) {
 			if !peer.Equal(p) {
 				t.Fatal("storing chequebook for wrong peer")
 			}
-			if chequebook != chequebookAddress {
+			if source.Chequebook != chequebookAddress {
 				t.Fatal("storing wrong chequebook")
 			}
 			return nil
@@ -168,7 +174,7 @@ func TestReceiveCheque(t *testing.T) {
 
 	observer := newTestObserver()
 
-	swap := swap.New(
+	swapService := swap.New(
 		&swapProtocolMock{},
 		logger,
 		store,
@@ -181,7 +187,13 @@ func TestReceiveCheque(t *testing.T) {
 		observer,
 	)
 
-	err := swap.ReceiveCheque(context.Background(), peer, cheque)
+	err := swapService.ReceiveCheque(context.Background(), peer, cheque)
+	if !errors.Is(err, swap.ErrNoExchangeRate) {
+		t.Fatalf("wrong error. wanted %v, got %v", swap.ErrNoExchangeRate, err)
+	}
+
+	swapService.AgreeRates(peer, exchangeRate, deduction)
+	err = swapService.ReceiveCheque(context.Background(), peer, cheque)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -221,14 +233,14 @@ func TestReceiveChequeReject(t *testing.T) {
 	var errReject = errors.New("reject")
 
 	chequeStore := mockchequestore.NewChequeStore(
-		mockchequestore.WithRetrieveChequeFunc(func(ctx context.Context, c *chequebook.SignedCheque) (*big.Int, error) {
+		mockchequestore.WithRetrieveChequeFunc(func(ctx context.Context, c *chequebook.SignedCheque, exchangeRate, deduction *big.Int) (*big.Int, error) {
 			return nil, errReject
 		}),
 	)
 	networkID := uint64(1)
 	addressbook := &addressbookMock{
-		chequebook: func(p penguin.Address) (common.Address, bool, error) {
-			return chequebookAddress, true, nil
+		chequebook: func(p penguin.Address) (chequebook.ChequeSource, bool, error) {
+			return chequebook.ChequeSource{Chequebook: chequebookAddress}, true, nil
 		},
 	}
 
@@ -247,6 +259,7 @@ func TestReceiveChequeReject(t *testing.T) {
 		observer,
 	)
 
+	swap.AgreeRates(peer, big.NewInt(1), big.NewInt(0))
 	err := swap.ReceiveCheque(context.Background(), peer, cheque)
 	if err == nil {
 		t.Fatal("accepted invalid cheque")
@@ -282,8 +295,8 @@ func TestReceiveChequeWrongChequebook(t *testing.T) {
 	chequeStore := mockchequestore.NewChequeStore()
 	networkID := uint64(1)
 	addressbook := &addressbookMock{
-		chequebook: func(p penguin.Address) (common.Address, bool, error) {
-			return common.HexToAddress("0xcfff"), true, nil
+		chequebook: func(p penguin.Address) (chequebook.ChequeSource, bool, error) {
+			return chequebook.ChequeSource{Chequebook: common.HexToAddress("0xcfff")}, true, nil
 		},
 	}
 
@@ -322,6 +335,10 @@ func TestPay(t *testing.T) {
 	store := mockstore.NewStateStore()
 
 	amount := big.NewInt(50)
+	exchangeRate := big.NewInt(10)
+	deduction := big.NewInt(3)
+	// the first cheque also pays the deduction
+	payment := big.NewInt(503)
 	beneficiary := common.HexToAddress("0xcd")
 	var cheque chequebook.SignedCheque
 
@@ -332,12 +349,15 @@ func TestPay(t *testing.T) {
 			if b != beneficiary {
 				t.Fatalf("issuing cheque for wrong beneficiary. wanted %v, got %v", beneficiary, b)
 			}
-			if a.Cmp(amount) != 0 {
-				t.Fatalf("issuing cheque with wrong amount. wanted %d, got %d", amount, a)
+			if a.Cmp(payment) != 0 {
+				t.Fatalf("issuing cheque with wrong amount. wanted %d, got %d", payment, a)
 			}
 			chequebookCalled = true
 			return big.NewInt(0), sendChequeFunc(&cheque)
 		}),
+		mockchequebook.WithLastChequeFunc(func(b common.Address) (*chequebook.SignedCheque, error) {
+			return nil, chequebook.ErrNoCheque
+		}),
 	)
 
 	networkID := uint64(1)
@@ -377,8 +397,21 @@ func TestPay(t *testing.T) {
 		observer,
 	)
 
+	swap.AgreeRates(peer, exchangeRate, deduction)
 	swap.Pay(context.Background(), peer, amount)
 
+	select {
+	case call := <-observer.sentCalled:
+		if call.err != nil {
+			t.Fatal(call.err)
+		}
+		if call.amount.Cmp(amount) != 0 {
+			t.Fatalf("observer called with wrong amount. got %d, want %d", call.amount, amount)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected observer to be called")
+	}
+
 	if !chequebookCalled {
 		t.Fatal("chequebook was not called")
 	}
@@ -401,6 +434,9 @@ func TestPayIssueError(t *testing.T) {
 		mockchequebook.WithChequebookIssueFunc(func(ctx context.Context, b common.Address, a *big.Int, sendChequeFunc chequebook.SendChequeFunc) (*big.Int, error) {
 			return big.NewInt(0), errReject
 		}),
+		mockchequebook.WithLastChequeFunc(func(b common.Address) (*chequebook.SignedCheque, error) {
+			return nil, chequebook.ErrNoCheque
+		}),
 	)
 
 	networkID := uint64(1)
@@ -429,6 +465,7 @@ func TestPayIssueError(t *testing.T) {
 	observer := newTestObserver()
 	swap.SetAccounting(observer)
 
+	swap.AgreeRates(peer, big.NewInt(1), big.NewInt(0))
 	swap.Pay(context.Background(), peer, amount)
 	select {
 	case call := <-observer.sentCalled:
@@ -537,7 +574,7 @@ func TestHandshake(t *testing.T) {
 		nil,
 	)
 
-	err := swapService.Handshake(peer, beneficiary)
+	err := swapService.Handshake(peer, beneficiary, big.NewInt(1), big.NewInt(0))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -547,6 +584,63 @@ func TestHandshake(t *testing.T) {
 	}
 }
 
+func TestHandshakeRatesPersisted(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+	store := mockstore.NewStateStore()
+
+	beneficiary := common.HexToAddress("0xcd")
+	chequebookAddress := common.HexToAddress("0xcdaa")
+	networkID := uint64(1)
+	peer := crypto.NewOverlayFromEthereumAddress(beneficiary[:], networkID)
+	cheque := &chequebook.SignedCheque{
+		Cheque: chequebook.Cheque{
+			Beneficiary:      common.HexToAddress("0xab"),
+			CumulativePayout: big.NewInt(50),
+			Chequebook:       chequebookAddress,
+		},
+	}
+
+	newService := func() *swap.Service {
+		return swap.New(
+			&swapProtocolMock{},
+			logger,
+			store,
+			mockchequebook.NewChequebook(),
+			mockchequestore.NewChequeStore(
+				mockchequestore.WithRetrieveChequeFunc(func(ctx context.Context, c *chequebook.SignedCheque, r, d *big.Int) (*big.Int, error) {
+					if r.Cmp(big.NewInt(5)) != 0 || d.Cmp(big.NewInt(2)) != 0 {
+						t.Fatalf("passed wrong rates to store. wanted 5 2, got %d %d", r, d)
+					}
+					return big.NewInt(50), nil
+				}),
+			),
+			&addressbookMock{
+				beneficiary: func(p penguin.Address) (common.Address, bool, error) {
+					return beneficiary, true, nil
+				},
+				chequebook: func(p penguin.Address) (chequebook.ChequeSource, bool, error) {
+					return chequebook.ChequeSource{Chequebook: chequebookAddress}, true, nil
+				},
+			},
+			networkID,
+			&cashoutMock{},
+			mockp2p.New(),
+			newTestObserver(),
+		)
+	}
+
+	swapService := newService()
+	if err := swapService.Handshake(peer, beneficiary, big.NewInt(5), big.NewInt(2)); err != nil {
+		t.Fatal(err)
+	}
+	swapService.Disconnected(peer)
+
+	// the rates last agreed with the peer are kept across restarts
+	if err := newService().ReceiveCheque(context.Background(), peer, cheque); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestHandshakeNewPeer(t *testing.T) {
 	logger := logging.New(ioutil.Discard, 0)
 	store := mockstore.NewStateStore()
@@ -577,7 +671,7 @@ func TestHandshakeNewPeer(t *testing.T) {
 		nil,
 	)
 
-	err := swapService.Handshake(peer, beneficiary)
+	err := swapService.Handshake(peer, beneficiary, big.NewInt(1), big.NewInt(0))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -608,7 +702,7 @@ func TestHandshakeWrongBeneficiary(t *testing.T) {
 		nil,
 	)
 
-	err := swapService.Handshake(peer, beneficiary)
+	err := swapService.Handshake(peer, beneficiary, big.NewInt(1), big.NewInt(0))
 	if !errors.Is(err, swap.ErrWrongBeneficiary) {
 		t.Fatalf("wrong error. wanted %v, got %v", swap.ErrWrongBeneficiary, err)
 	}
@@ -623,11 +717,11 @@ func TestCashout(t *testing.T) {
 	peer := penguin.MustParseHexAddress("abcd")
 	txHash := common.HexToHash("eeee")
 	addressbook := &addressbookMock{
-		chequebook: func(p penguin.Address) (common.Address, bool, error) {
+		chequebook: func(p penguin.Address) (chequebook.ChequeSource, bool, error) {
 			if !peer.Equal(p) {
 				t.Fatal("querying chequebook for wrong peer")
 			}
-			return theirChequebookAddress, true, nil
+			return chequebook.ChequeSource{Chequebook: theirChequebookAddress}, true, nil
 		},
 	}
 
@@ -644,8 +738,8 @@ func TestCashout(t *testing.T) {
 		addressbook,
 		uint64(1),
 		&cashoutMock{
-			cashCheque: func(ctx context.Context, c common.Address, r common.Address) (common.Hash, error) {
-				if c != theirChequebookAddress {
+			cashCheque: func(ctx context.Context, c chequebook.ChequeSource, r common.Address) (common.Hash, error) {
+				if c.Chequebook != theirChequebookAddress {
 					t.Fatalf("not cashing with the right chequebook. wanted %v, got %v", theirChequebookAddress, c)
 				}
 				if r != ourChequebookAddress {
@@ -675,11 +769,11 @@ func TestCashoutStatus(t *testing.T) {
 	theirChequebookAddress := common.HexToAddress("ffff")
 	peer := penguin.MustParseHexAddress("abcd")
 	addressbook := &addressbookMock{
-		chequebook: func(p penguin.Address) (common.Address, bool, error) {
+		chequebook: func(p penguin.Address) (chequebook.ChequeSource, bool, error) {
 			if !peer.Equal(p) {
 				t.Fatal("querying chequebook for wrong peer")
 			}
-			return theirChequebookAddress, true, nil
+			return chequebook.ChequeSource{Chequebook: theirChequebookAddress}, true, nil
 		},
 	}
 
@@ -694,8 +788,8 @@ func TestCashoutStatus(t *testing.T) {
 		addressbook,
 		uint64(1),
 		&cashoutMock{
-			cashoutStatus: func(ctx context.Context, c common.Address) (*chequebook.CashoutStatus, error) {
-				if c != theirChequebookAddress {
+			cashoutStatus: func(ctx context.Context, c chequebook.ChequeSource) (*chequebook.CashoutStatus, error) {
+				if c.Chequebook != theirChequebookAddress {
 					t.Fatalf("getting status for wrong chequebook. wanted %v, got %v", theirChequebookAddress, c)
 				}
 				return expectedStatus, nil
@@ -714,3 +808,160 @@ func TestCashoutStatus(t *testing.T) {
 		t.Fatalf("go wrong status. wanted %v, got %v", expectedStatus, returnedStatus)
 	}
 }
+
+type solvencyCheckerMock struct {
+	balance *big.Int
+}
+
+func (m *solvencyCheckerMock) Solvency(ctx context.Context, source chequebook.ChequeSource) (*chequebook.Solvency, error) {
+	return chequebook.NewSolvency(source.Chequebook, m.balance, big.NewInt(10), big.NewInt(10), big.NewInt(60)), nil
+}
+
+type thresholdAnnouncerMock struct {
+	announced []*big.Int
+}
+
+func (m *thresholdAnnouncerMock) AnnouncePaymentThreshold(ctx context.Context, peer penguin.Address, paymentThreshold *big.Int) error {
+	m.announced = append(m.announced, paymentThreshold)
+	return nil
+}
+
+type thresholdEnforcerMock struct {
+	mu       sync.Mutex
+	enforced map[string]*big.Int
+}
+
+func (m *thresholdEnforcerMock) EnforcePaymentThreshold(peer penguin.Address, paymentThreshold *big.Int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if paymentThreshold == nil {
+		delete(m.enforced, peer.String())
+		return
+	}
+	m.enforced[peer.String()] = paymentThreshold
+}
+
+func (m *thresholdEnforcerMock) threshold(peer penguin.Address) *big.Int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.enforced[peer.String()]
+}
+
+func TestSolvencyMonitor(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+	chequebookAddress := common.HexToAddress("0xcd")
+	peer := penguin.MustParseHexAddress("abcd")
+	cheque := &chequebook.SignedCheque{
+		Cheque: chequebook.Cheque{
+			Beneficiary:      common.HexToAddress("0xab"),
+			CumulativePayout: big.NewInt(60),
+			Chequebook:       chequebookAddress,
+		},
+	}
+
+	chequeStore := mockchequestore.NewChequeStore(
+		mockchequestore.WithRetrieveChequeFunc(func(ctx context.Context, c *chequebook.SignedCheque, exchangeRate, deduction *big.Int) (*big.Int, error) {
+			return big.NewInt(10), nil
+		}),
+		mockchequestore.WithLastChequesFunc(func() (map[chequebook.ChequeSource]*chequebook.SignedCheque, error) {
+			return map[chequebook.ChequeSource]*chequebook.SignedCheque{cheque.Source(): cheque}, nil
+		}),
+	)
+	addressbook := &addressbookMock{
+		chequebook: func(p penguin.Address) (chequebook.ChequeSource, bool, error) {
+			return chequebook.ChequeSource{Chequebook: chequebookAddress}, true, nil
+		},
+		chequebookPeer: func(c chequebook.ChequeSource) (penguin.Address, bool, error) {
+			return peer, true, nil
+		},
+	}
+
+	var disconnected []penguin.Address
+	p2pService := mockp2p.New(mockp2p.WithDisconnectFunc(func(overlay penguin.Address) error {
+		disconnected = append(disconnected, overlay)
+		return nil
+	}))
+
+	swapService := swap.New(
+		&swapProtocolMock{},
+		logger,
+		mockstore.NewStateStore(),
+		mockchequebook.NewChequebook(),
+		chequeStore,
+		addressbook,
+		1,
+		&cashoutMock{},
+		p2pService,
+		newTestObserver(),
+	)
+
+	if _, err := swapService.PeerSolvency(context.Background(), peer); !errors.Is(err, swap.ErrNoSolvencyChecker) {
+		t.Fatalf("got error %v, want %v", err, swap.ErrNoSolvencyChecker)
+	}
+
+	// the uncashed amount is 50
+	checker := &solvencyCheckerMock{balance: big.NewInt(20)}
+	swapService.SetSolvencyChecker(checker)
+
+	announcer := &thresholdAnnouncerMock{}
+	paymentThreshold := big.NewInt(1000)
+	insolventPaymentThreshold := big.NewInt(100)
+	enforcer := &thresholdEnforcerMock{enforced: make(map[string]*big.Int)}
+	monitor := swap.NewSolvencyMonitor(logger, swapService, announcer, enforcer, p2pService, swap.SolvencyOptions{
+		Interval:                  time.Minute,
+		PaymentThreshold:          paymentThreshold,
+		InsolventPaymentThreshold: insolventPaymentThreshold,
+		Disconnect:                true,
+	})
+
+	solvencies, err := swapService.PeerSolvencies(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	solvency := solvencies[peer.String()]
+	if solvency == nil || !solvency.Insolvent || solvency.Risk != 0.6 {
+		t.Fatalf("got solvency %+v, want insolvent with risk 0.6", solvency)
+	}
+
+	if err := monitor.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !monitor.Insolvent(peer) {
+		t.Fatal("peer not treated as insolvent")
+	}
+	if len(announcer.announced) != 1 || announcer.announced[0].Cmp(insolventPaymentThreshold) != 0 {
+		t.Fatalf("got announced thresholds %v, want %d", announcer.announced, insolventPaymentThreshold)
+	}
+	if got := enforcer.threshold(peer); got == nil || got.Cmp(insolventPaymentThreshold) != 0 {
+		t.Fatalf("got enforced threshold %v, want %d", got, insolventPaymentThreshold)
+	}
+	if len(disconnected) != 1 || !disconnected[0].Equal(peer) {
+		t.Fatalf("got disconnected peers %v, want %s", disconnected, peer)
+	}
+
+	// the peer topped up its chequebook and pays with a new cheque
+	checker.balance = big.NewInt(50)
+	swapService.AgreeRates(peer, big.NewInt(1), big.NewInt(0))
+	if err := swapService.ReceiveCheque(context.Background(), peer, cheque); err != nil {
+		t.Fatal(err)
+	}
+	// the recheck runs in the background
+	for deadline := time.Now().Add(5 * time.Second); monitor.Insolvent(peer); {
+		if time.Now().After(deadline) {
+			t.Fatal("peer still treated as insolvent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := monitor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := enforcer.threshold(peer); got != nil {
+		t.Fatalf("got enforced threshold %d, want it restored", got)
+	}
+	if len(announcer.announced) != 2 || announcer.announced[1].Cmp(paymentThreshold) != 0 {
+		t.Fatalf("got announced thresholds %v, want regular threshold %d", announcer.announced, paymentThreshold)
+	}
+	if len(disconnected) != 1 {
+		t.Fatalf("got disconnected peers %v, want only one", disconnected)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -16,6 +18,7 @@ import (
 	"github.com/penguintop/penguin/pkg/p2p"
 	"github.com/penguintop/penguin/pkg/p2p/protobuf"
 	"github.com/penguintop/penguin/pkg/settlement/swap/chequebook"
+	"github.com/penguintop/penguin/pkg/settlement/swap/priceoracle"
 	"github.com/penguintop/penguin/pkg/settlement/swap/swapprotocol/pb"
     "github.com/penguintop/penguin/pkg/penguin"
 )
@@ -25,6 +28,25 @@ const (
 	protocolVersion = "1.0.0"
 	streamName      = "swap" // stream for cheques
 	initStreamName  = "init" // stream for handshake
+
+	// rateTolerance is the difference in percent up to which the rates
+	// announced by a peer are agreed on, as the price oracle may be polled
+	// at slightly different times.
+	rateTolerance = 5
+)
+
+var (
+	// legacyExchangeRate and legacyDeduction are agreed with peers which do
+	// not announce rates in the handshake.
+	legacyExchangeRate = big.NewInt(1)
+	legacyDeduction    = big.NewInt(0)
+)
+
+var (
+	// ErrNegotiateRate is returned if the peer announces a different exchange rate.
+	ErrNegotiateRate = errors.New("exchange rates mismatch")
+	// ErrNegotiateDeduction is returned if the peer announces a different deduction.
+	ErrNegotiateDeduction = errors.New("deduction values mismatch")
 )
 
 // Interface is the main interface to send messages over swap protocol.
@@ -37,8 +59,11 @@ type Interface interface {
 type Swap interface {
 	// ReceiveCheque is called by the swap protocol if a cheque is received.
 	ReceiveCheque(ctx context.Context, peer penguin.Address, cheque *chequebook.SignedCheque) error
-	// Handshake is called by the swap protocol when a handshake is received.
-	Handshake(peer penguin.Address, beneficiary common.Address) error
+	// Handshake is called by the swap protocol when a handshake is received,
+	// with the exchange rate and the deduction agreed with the peer.
+	Handshake(peer penguin.Address, beneficiary common.Address, exchangeRate, deduction *big.Int) error
+	// Disconnected is called by the swap protocol when a peer disconnects.
+	Disconnected(peer penguin.Address)
 }
 
 // Service is the main implementation of the swap protocol.
@@ -47,14 +72,21 @@ type Service struct {
 	logger      logging.Logger
 	swap        Swap
 	beneficiary common.Address
+	priceOracle priceoracle.Service
+
+	peersMu sync.Mutex
+	peers   map[string]penguin.Address // connected peers rates were agreed with
 }
 
-// New creates a new swap protocol Service.
-func New(streamer p2p.Streamer, logger logging.Logger, beneficiary common.Address) *Service {
+// New creates a new swap protocol Service. The handshake announces the rates
+// of the price oracle, which the peers must agree on.
+func New(streamer p2p.Streamer, logger logging.Logger, beneficiary common.Address, priceOracle priceoracle.Service) *Service {
 	return &Service{
 		streamer:    streamer,
 		logger:      logger,
 		beneficiary: beneficiary,
+		priceOracle: priceOracle,
+		peers:       make(map[string]penguin.Address),
 	}
 }
 
@@ -77,7 +109,9 @@ func (s *Service) Protocol() p2p.ProtocolSpec {
 				Handler: s.initHandler,
 			},
 		},
-		ConnectOut: s.init,
+		ConnectOut:    s.init,
+		DisconnectIn:  s.disconnect,
+		DisconnectOut: s.disconnect,
 	}
 }
 
@@ -99,23 +133,62 @@ func (s *Service) initHandler(ctx context.Context, p p2p.Peer, stream p2p.Stream
 		return errors.New("malformed beneficiary address")
 	}
 
-	err = w.WriteMsgWithContext(ctx, &pb.Handshake{
-		Beneficiary: s.beneficiary.Bytes(),
-	})
+	handshake, err := s.handshake()
 	if err != nil {
 		return err
 	}
 
-	beneficiary := common.BytesToAddress(req.Beneficiary)
-	return s.swap.Handshake(p.Address, beneficiary)
+	err = w.WriteMsgWithContext(ctx, handshake)
+	if err != nil {
+		return err
+	}
+
+	return s.negotiate(p.Address, handshake, &req)
 }
 
 // init is called on outgoing connections and triggers handshake exchange
 func (s *Service) init(ctx context.Context, p p2p.Peer) error {
+	return s.handshakePeer(ctx, p.Address)
+}
+
+func (s *Service) disconnect(p p2p.Peer) error {
+	s.peersMu.Lock()
+	delete(s.peers, p.Address.String())
+	s.peersMu.Unlock()
+
+	s.swap.Disconnected(p.Address)
+	return nil
+}
+
+// Renegotiate repeats the handshake with all connected peers to agree on the
+// changed rates of the price oracle.
+func (s *Service) Renegotiate(ctx context.Context) {
+	s.peersMu.Lock()
+	peers := make([]penguin.Address, 0, len(s.peers))
+	for _, peer := range s.peers {
+		peers = append(peers, peer)
+	}
+	s.peersMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer penguin.Address) {
+			defer wg.Done()
+			if err := s.handshakePeer(ctx, peer); err != nil {
+				s.logger.Debugf("swap: renegotiate rates with peer %v: %v", peer, err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+}
+
+// handshakePeer exchanges the handshake with the peer.
+func (s *Service) handshakePeer(ctx context.Context, peer penguin.Address) (err error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	stream, err := s.streamer.NewStream(ctx, p.Address, nil, protocolName, protocolVersion, initStreamName)
+	stream, err := s.streamer.NewStream(ctx, peer, nil, protocolName, protocolVersion, initStreamName)
 	if err != nil {
 		return err
 	}
@@ -127,17 +200,20 @@ func (s *Service) init(ctx context.Context, p p2p.Peer) error {
 		}
 	}()
 
+	handshake, err := s.handshake()
+	if err != nil {
+		return err
+	}
+
 	w, r := protobuf.NewWriterAndReader(stream)
-	err = w.WriteMsgWithContext(ctx, &pb.Handshake{
-		Beneficiary: s.beneficiary.Bytes(),
-	})
+	err = w.WriteMsgWithContext(ctx, handshake)
 	if err != nil {
 		return err
 	}
 
 	var req pb.Handshake
 	if err := r.ReadMsgWithContext(ctx, &req); err != nil {
-		return fmt.Errorf("read request from peer %v: %w", p.Address, err)
+		return fmt.Errorf("read request from peer %v: %w", peer, err)
 	}
 
 	// any 20-byte byte-sequence is a valid eth address
@@ -145,9 +221,70 @@ func (s *Service) init(ctx context.Context, p p2p.Peer) error {
 		return errors.New("malformed beneficiary address")
 	}
 
+	return s.negotiate(peer, handshake, &req)
+}
+
+// handshake returns the handshake announcing the beneficiary and the current
+// rates of the price oracle.
+func (s *Service) handshake() (*pb.Handshake, error) {
+	exchangeRate, deduction, err := s.priceOracle.CurrentRates()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Handshake{
+		Beneficiary:  s.beneficiary.Bytes(),
+		ExchangeRate: exchangeRate.Bytes(),
+		Deduction:    deduction.Bytes(),
+	}, nil
+}
+
+// negotiate agrees on the rates announced by the peer and passes the agreed
+// rates on to swap. Rates within the tolerance of ours are agreed on at the
+// higher of both, which both sides pick. Peers not announcing rates predate
+// the price oracle and are settled at the legacy rates.
+func (s *Service) negotiate(peer penguin.Address, own, req *pb.Handshake) error {
+	exchangeRate, deduction := legacyExchangeRate, legacyDeduction
+	if len(req.ExchangeRate) != 0 {
+		ownRate, peerRate := new(big.Int).SetBytes(own.ExchangeRate), new(big.Int).SetBytes(req.ExchangeRate)
+		if !withinTolerance(ownRate, peerRate) {
+			s.logger.Debugf("swap: peer %v exchange rate %d, ours %d", peer, peerRate, ownRate)
+			return ErrNegotiateRate
+		}
+		ownDeduction, peerDeduction := new(big.Int).SetBytes(own.Deduction), new(big.Int).SetBytes(req.Deduction)
+		if !withinTolerance(ownDeduction, peerDeduction) {
+			s.logger.Debugf("swap: peer %v deduction %d, ours %d", peer, peerDeduction, ownDeduction)
+			return ErrNegotiateDeduction
+		}
+		exchangeRate, deduction = maxInt(ownRate, peerRate), maxInt(ownDeduction, peerDeduction)
+	} else {
+		s.logger.Debugf("swap: peer %v does not announce rates, using the legacy rates", peer)
+	}
+
 	beneficiary := common.BytesToAddress(req.Beneficiary)
+	if err := s.swap.Handshake(peer, beneficiary, exchangeRate, deduction); err != nil {
+		return err
+	}
 
-	return s.swap.Handshake(p.Address, beneficiary)
+	s.peersMu.Lock()
+	s.peers[peer.String()] = peer
+	s.peersMu.Unlock()
+	return nil
+}
+
+// withinTolerance reports whether a and b differ by at most the rate
+// tolerance of the larger one.
+func withinTolerance(a, b *big.Int) bool {
+	diff := new(big.Int).Sub(a, b)
+	diff.Abs(diff).Mul(diff, big.NewInt(100))
+	return diff.Cmp(new(big.Int).Mul(maxInt(a, b), big.NewInt(rateTolerance))) <= 0
+}
+
+func maxInt(a, b *big.Int) *big.Int {
+	if a.Cmp(b) >= 0 {
+		return new(big.Int).Set(a)
+	}
+	return new(big.Int).Set(b)
 }
 
 func (s *Service) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream) (err error) {
@@ -0,0 +1,256 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swapprotocol_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/p2p"
+	"github.com/penguintop/penguin/pkg/p2p/protobuf"
+	"github.com/penguintop/penguin/pkg/p2p/streamtest"
+	"github.com/penguintop/penguin/pkg/penguin"
+	swapmock "github.com/penguintop/penguin/pkg/settlement/swap/mock"
+	"github.com/penguintop/penguin/pkg/settlement/swap/priceoracle"
+	"github.com/penguintop/penguin/pkg/settlement/swap/swapprotocol"
+	"github.com/penguintop/penguin/pkg/settlement/swap/swapprotocol/pb"
+)
+
+type handshake struct {
+	peer         penguin.Address
+	beneficiary  common.Address
+	exchangeRate *big.Int
+	deduction    *big.Int
+}
+
+func newSwap(handshakes chan<- handshake) swapprotocol.Swap {
+	return swapmock.New(
+		swapmock.WithHandshakeFunc(func(peer penguin.Address, beneficiary common.Address, exchangeRate, deduction *big.Int) error {
+			handshakes <- handshake{peer, beneficiary, exchangeRate, deduction}
+			return nil
+		}),
+	).(swapprotocol.Swap)
+}
+
+func TestHandshake(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+	senderPeer := penguin.MustParseHexAddress("1000")
+	recipientPeer := penguin.MustParseHexAddress("2000")
+	senderBeneficiary := common.HexToAddress("0xaa")
+	recipientBeneficiary := common.HexToAddress("0xbb")
+
+	recipientHandshakes := make(chan handshake, 1)
+	recipient := swapprotocol.New(nil, logger, recipientBeneficiary, priceoracle.NewStatic(big.NewInt(10), big.NewInt(3)))
+	recipient.SetSwap(newSwap(recipientHandshakes))
+
+	recorder := streamtest.New(
+		streamtest.WithProtocols(recipient.Protocol()),
+		streamtest.WithBaseAddr(senderPeer),
+	)
+
+	senderHandshakes := make(chan handshake, 1)
+	sender := swapprotocol.New(recorder, logger, senderBeneficiary, priceoracle.NewStatic(big.NewInt(10), big.NewInt(3)))
+	sender.SetSwap(newSwap(senderHandshakes))
+
+	if err := sender.Protocol().ConnectOut(context.Background(), p2p.Peer{Address: recipientPeer}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		got         handshake
+		peer        penguin.Address
+		beneficiary common.Address
+	}{
+		{name: "sender", got: <-senderHandshakes, peer: recipientPeer, beneficiary: recipientBeneficiary},
+		{name: "recipient", got: <-recipientHandshakes, peer: senderPeer, beneficiary: senderBeneficiary},
+	} {
+		if !tc.got.peer.Equal(tc.peer) || tc.got.beneficiary != tc.beneficiary {
+			t.Fatalf("%s: got handshake of peer %s beneficiary %x, want %s %x", tc.name, tc.got.peer, tc.got.beneficiary, tc.peer, tc.beneficiary)
+		}
+		if tc.got.exchangeRate.Cmp(big.NewInt(10)) != 0 || tc.got.deduction.Cmp(big.NewInt(3)) != 0 {
+			t.Fatalf("%s: got rates %d %d, want 10 3", tc.name, tc.got.exchangeRate, tc.got.deduction)
+		}
+	}
+}
+
+func TestHandshakeMismatch(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+
+	for _, tc := range []struct {
+		name                    string
+		exchangeRate, deduction int64
+		err                     error
+	}{
+		{name: "exchange rate", exchangeRate: 11, deduction: 3, err: swapprotocol.ErrNegotiateRate},
+		{name: "deduction", exchangeRate: 10, deduction: 0, err: swapprotocol.ErrNegotiateDeduction},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recipient := swapprotocol.New(nil, logger, common.HexToAddress("0xbb"), priceoracle.NewStatic(big.NewInt(tc.exchangeRate), big.NewInt(tc.deduction)))
+			recipient.SetSwap(newSwap(make(chan handshake, 1)))
+
+			recorder := streamtest.New(
+				streamtest.WithProtocols(recipient.Protocol()),
+				streamtest.WithBaseAddr(penguin.MustParseHexAddress("1000")),
+			)
+
+			handshakes := make(chan handshake, 1)
+			sender := swapprotocol.New(recorder, logger, common.HexToAddress("0xaa"), priceoracle.NewStatic(big.NewInt(10), big.NewInt(3)))
+			sender.SetSwap(newSwap(handshakes))
+
+			err := sender.Protocol().ConnectOut(context.Background(), p2p.Peer{Address: penguin.MustParseHexAddress("2000")})
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			select {
+			case <-handshakes:
+				t.Fatal("handshake accepted with mismatching rates")
+			default:
+			}
+		})
+	}
+}
+
+func TestHandshakeTolerance(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+
+	recipientHandshakes := make(chan handshake, 1)
+	recipient := swapprotocol.New(nil, logger, common.HexToAddress("0xbb"), priceoracle.NewStatic(big.NewInt(102), big.NewInt(1000)))
+	recipient.SetSwap(newSwap(recipientHandshakes))
+
+	recorder := streamtest.New(
+		streamtest.WithProtocols(recipient.Protocol()),
+		streamtest.WithBaseAddr(penguin.MustParseHexAddress("1000")),
+	)
+
+	senderHandshakes := make(chan handshake, 1)
+	sender := swapprotocol.New(recorder, logger, common.HexToAddress("0xaa"), priceoracle.NewStatic(big.NewInt(100), big.NewInt(990)))
+	sender.SetSwap(newSwap(senderHandshakes))
+
+	if err := sender.Protocol().ConnectOut(context.Background(), p2p.Peer{Address: penguin.MustParseHexAddress("2000")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// both agree on the higher rates
+	for _, got := range []handshake{<-senderHandshakes, <-recipientHandshakes} {
+		if got.exchangeRate.Cmp(big.NewInt(102)) != 0 || got.deduction.Cmp(big.NewInt(1000)) != 0 {
+			t.Fatalf("got rates %d %d, want 102 1000", got.exchangeRate, got.deduction)
+		}
+	}
+}
+
+func TestHandshakeLegacyPeer(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+
+	// a peer from before the price oracle answers without rates
+	legacy := p2p.ProtocolSpec{
+		Name:    "swap",
+		Version: "1.0.0",
+		StreamSpecs: []p2p.StreamSpec{
+			{
+				Name: "init",
+				Handler: func(ctx context.Context, p p2p.Peer, stream p2p.Stream) error {
+					defer stream.FullClose()
+					w, r := protobuf.NewWriterAndReader(stream)
+					var req pb.Handshake
+					if err := r.ReadMsgWithContext(ctx, &req); err != nil {
+						return err
+					}
+					return w.WriteMsgWithContext(ctx, &pb.Handshake{Beneficiary: common.HexToAddress("0xbb").Bytes()})
+				},
+			},
+		},
+	}
+	recorder := streamtest.New(
+		streamtest.WithProtocols(legacy),
+		streamtest.WithBaseAddr(penguin.MustParseHexAddress("1000")),
+	)
+
+	handshakes := make(chan handshake, 1)
+	sender := swapprotocol.New(recorder, logger, common.HexToAddress("0xaa"), priceoracle.NewStatic(big.NewInt(10), big.NewInt(3)))
+	sender.SetSwap(newSwap(handshakes))
+
+	if err := sender.Protocol().ConnectOut(context.Background(), p2p.Peer{Address: penguin.MustParseHexAddress("2000")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-handshakes; got.exchangeRate.Cmp(big.NewInt(1)) != 0 || got.deduction.Sign() != 0 {
+		t.Fatalf("got rates %d %d, want the legacy rates 1 0", got.exchangeRate, got.deduction)
+	}
+}
+
+// oracle is a price oracle with rates set by the test.
+type oracle struct {
+	priceoracle.Service
+	exchangeRate, deduction *big.Int
+}
+
+func (o *oracle) CurrentRates() (*big.Int, *big.Int, error) {
+	return o.exchangeRate, o.deduction, nil
+}
+
+func TestRenegotiate(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+	peer := penguin.MustParseHexAddress("2000")
+
+	recipientOracle := &oracle{exchangeRate: big.NewInt(10), deduction: big.NewInt(3)}
+	recipient := swapprotocol.New(nil, logger, common.HexToAddress("0xbb"), recipientOracle)
+	recipient.SetSwap(newSwap(make(chan handshake, 10)))
+
+	recorder := streamtest.New(
+		streamtest.WithProtocols(recipient.Protocol()),
+		streamtest.WithBaseAddr(penguin.MustParseHexAddress("1000")),
+	)
+
+	handshakes := make(chan handshake, 10)
+	disconnected := make(chan penguin.Address, 1)
+	senderOracle := &oracle{exchangeRate: big.NewInt(10), deduction: big.NewInt(3)}
+	sender := swapprotocol.New(recorder, logger, common.HexToAddress("0xaa"), senderOracle)
+	sender.SetSwap(swapmock.New(
+		swapmock.WithHandshakeFunc(func(peer penguin.Address, beneficiary common.Address, exchangeRate, deduction *big.Int) error {
+			handshakes <- handshake{peer, beneficiary, exchangeRate, deduction}
+			return nil
+		}),
+		swapmock.WithDisconnectedFunc(func(peer penguin.Address) {
+			disconnected <- peer
+		}),
+	).(swapprotocol.Swap))
+
+	if err := sender.Protocol().ConnectOut(context.Background(), p2p.Peer{Address: peer}); err != nil {
+		t.Fatal(err)
+	}
+	<-handshakes
+
+	// the oracle of both changed
+	senderOracle.exchangeRate, recipientOracle.exchangeRate = big.NewInt(20), big.NewInt(20)
+	sender.Renegotiate(context.Background())
+	select {
+	case got := <-handshakes:
+		if got.exchangeRate.Cmp(big.NewInt(20)) != 0 {
+			t.Fatalf("got renegotiated exchange rate %d, want 20", got.exchangeRate)
+		}
+	default:
+		t.Fatal("rates not renegotiated")
+	}
+
+	if err := sender.Protocol().DisconnectOut(p2p.Peer{Address: peer}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-disconnected; !got.Equal(peer) {
+		t.Fatalf("got disconnected peer %s, want %s", got, peer)
+	}
+
+	// disconnected peers are not renegotiated with
+	sender.Renegotiate(context.Background())
+	select {
+	case <-handshakes:
+		t.Fatal("renegotiated with a disconnected peer")
+	default:
+	}
+}
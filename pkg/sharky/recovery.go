@@ -0,0 +1,71 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sharky
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Recovery rebuilds the free slots of a store that was not closed cleanly.
+// Every location still referenced must be added before saving, all other
+// slots are freed. The store must not be open while recovering.
+type Recovery struct {
+	basedir string
+	shards  []*slots
+}
+
+// NewRecovery starts the recovery of the store in basedir.
+func NewRecovery(basedir string, shardCnt, maxDataSize int) (*Recovery, error) {
+	if err := validate(shardCnt, maxDataSize); err != nil {
+		return nil, err
+	}
+
+	r := &Recovery{
+		basedir: basedir,
+		shards:  make([]*slots, shardCnt),
+	}
+	for i := range r.shards {
+		var limit uint32
+		info, err := os.Stat(shardPath(basedir, uint8(i)))
+		switch {
+		case err == nil:
+			limit = slotCount(info.Size(), maxDataSize)
+		case os.IsNotExist(err):
+		default:
+			return nil, err
+		}
+		sl := newSlots(limit, nil)
+		for slot := uint32(0); slot < limit; slot++ {
+			sl.free(slot)
+		}
+		r.shards[i] = sl
+	}
+	return r, nil
+}
+
+// Add marks the slot at the location as used.
+func (r *Recovery) Add(loc Location) error {
+	if int(loc.Shard) >= len(r.shards) {
+		return fmt.Errorf("%w: %+v", ErrInvalidLocation, loc)
+	}
+	sl := r.shards[loc.Shard]
+	if loc.Slot >= sl.limit {
+		return fmt.Errorf("%w: %+v beyond end of shard", ErrInvalidLocation, loc)
+	}
+	sl.use(loc.Slot)
+	return nil
+}
+
+// Save persists the rebuilt free slots to be picked up by the next New.
+func (r *Recovery) Save() error {
+	for i, sl := range r.shards {
+		if err := ioutil.WriteFile(freePath(r.basedir, uint8(i)), sl.bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sharky
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// file is the storage of a shard.
+type file interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+	Sync() error
+}
+
+// shard is a file of fixed size slots.
+type shard struct {
+	index       uint8
+	maxDataSize int
+	file        file
+	freePath    string // where free slots are persisted, empty in memory
+
+	mu       sync.Mutex
+	slots    *slots
+	dirty    bool                // written since the last sync
+	readers  map[uint32]int      // number of reads in progress by slot
+	released map[uint32]struct{} // slots released while read
+}
+
+func openShard(basedir string, index uint8, maxDataSize int) (*shard, error) {
+	sh := &shard{
+		index:       index,
+		maxDataSize: maxDataSize,
+		readers:     make(map[uint32]int),
+		released:    make(map[uint32]struct{}),
+	}
+	if basedir == "" {
+		sh.file = new(memFile)
+		sh.slots = newSlots(0, nil)
+		return sh, nil
+	}
+
+	f, err := os.OpenFile(shardPath(basedir, index), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	sh.file = f
+	sh.freePath = freePath(basedir, index)
+
+	free, err := ioutil.ReadFile(sh.freePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		_ = f.Close()
+		return nil, err
+	}
+	// the free slots are only valid until the next write, drop them so that
+	// an unclean shutdown can never hand out a slot that is still referenced
+	if err == nil {
+		if err := os.Remove(sh.freePath); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	sh.slots = newSlots(slotCount(info.Size(), maxDataSize), free)
+	return sh, nil
+}
+
+// slotCount returns the number of slots in a shard file of the size.
+func slotCount(size int64, maxDataSize int) uint32 {
+	return uint32((size + int64(maxDataSize) - 1) / int64(maxDataSize))
+}
+
+func (sh *shard) offset(slot uint32) int64 {
+	return int64(slot) * int64(sh.maxDataSize)
+}
+
+func (sh *shard) write(data []byte) (Location, error) {
+	sh.mu.Lock()
+	slot := sh.slots.next()
+	sh.slots.use(slot)
+	sh.dirty = true
+	sh.mu.Unlock()
+
+	if _, err := sh.file.WriteAt(data, sh.offset(slot)); err != nil {
+		sh.mu.Lock()
+		sh.slots.free(slot)
+		sh.mu.Unlock()
+		return Location{}, err
+	}
+	return Location{
+		Shard:  sh.index,
+		Slot:   slot,
+		Length: uint16(len(data)),
+	}, nil
+}
+
+// read reads the blob at the location. The slot is not reused until the
+// read is done, even if it is released meanwhile.
+func (sh *shard) read(loc Location, buf []byte) error {
+	sh.mu.Lock()
+	if !sh.inUse(loc.Slot) {
+		sh.mu.Unlock()
+		return fmt.Errorf("%w: shard %d slot %d not in use", ErrInvalidLocation, sh.index, loc.Slot)
+	}
+	sh.readers[loc.Slot]++
+	sh.mu.Unlock()
+
+	_, err := sh.file.ReadAt(buf[:loc.Length], sh.offset(loc.Slot))
+
+	sh.mu.Lock()
+	if sh.readers[loc.Slot]--; sh.readers[loc.Slot] == 0 {
+		delete(sh.readers, loc.Slot)
+		if _, ok := sh.released[loc.Slot]; ok {
+			delete(sh.released, loc.Slot)
+			sh.slots.free(loc.Slot)
+		}
+	}
+	sh.mu.Unlock()
+	return err
+}
+
+// inUse reports whether the slot holds a blob that was not released.
+func (sh *shard) inUse(slot uint32) bool {
+	if slot >= sh.slots.limit || sh.slots.isFree(slot) {
+		return false
+	}
+	_, released := sh.released[slot]
+	return !released
+}
+
+// sync flushes the writes since the last sync to disk.
+func (sh *shard) sync() error {
+	sh.mu.Lock()
+	dirty := sh.dirty
+	sh.dirty = false
+	sh.mu.Unlock()
+	if !dirty {
+		return nil
+	}
+
+	if err := sh.file.Sync(); err != nil {
+		sh.mu.Lock()
+		sh.dirty = true
+		sh.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (sh *shard) release(slot uint32) error {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if !sh.inUse(slot) {
+		return fmt.Errorf("%w: shard %d slot %d not in use", ErrInvalidLocation, sh.index, slot)
+	}
+	if sh.readers[slot] > 0 {
+		// freed by the last reader
+		sh.released[slot] = struct{}{}
+		return nil
+	}
+	sh.slots.free(slot)
+	return nil
+}
+
+func (sh *shard) close() error {
+	if sh.freePath != "" {
+		sh.mu.Lock()
+		for slot := range sh.released {
+			sh.slots.free(slot)
+		}
+		free := sh.slots.bytes()
+		sh.mu.Unlock()
+		if err := ioutil.WriteFile(sh.freePath, free, 0644); err != nil {
+			_ = sh.file.Close()
+			return err
+		}
+	}
+	return sh.file.Close()
+}
+
+// slots keeps track of the free slots of a shard in a bitmap where a set bit
+// marks a free slot.
+type slots struct {
+	bitmap []byte
+	limit  uint32 // number of slots in the shard file
+	head   uint32 // no slot below head is free
+}
+
+// newSlots creates the slots of a shard with limit slots from a persisted
+// bitmap. Slots not covered by the bitmap are in use.
+func newSlots(limit uint32, bitmap []byte) *slots {
+	sl := &slots{
+		bitmap: make([]byte, (limit+7)/8),
+		limit:  limit,
+	}
+	copy(sl.bitmap, bitmap)
+	// bits past the limit are meaningless
+	for i := limit; i < uint32(len(sl.bitmap))*8; i++ {
+		sl.bitmap[i/8] &^= 1 << (i % 8)
+	}
+	return sl
+}
+
+func (sl *slots) isFree(slot uint32) bool {
+	return slot < sl.limit && sl.bitmap[slot/8]&(1<<(slot%8)) != 0
+}
+
+// next returns the lowest free slot, or the slot appended to the shard if
+// none is free.
+func (sl *slots) next() uint32 {
+	for i := sl.head; i < sl.limit; i++ {
+		if sl.isFree(i) {
+			sl.head = i
+			return i
+		}
+	}
+	sl.head = sl.limit
+	return sl.limit
+}
+
+func (sl *slots) use(slot uint32) {
+	for slot >= sl.limit {
+		if sl.limit%8 == 0 {
+			sl.bitmap = append(sl.bitmap, 0)
+		}
+		sl.limit++
+	}
+	sl.bitmap[slot/8] &^= 1 << (slot % 8)
+	if slot == sl.head {
+		sl.head++
+	}
+}
+
+func (sl *slots) free(slot uint32) {
+	sl.bitmap[slot/8] |= 1 << (slot % 8)
+	if slot < sl.head {
+		sl.head = slot
+	}
+}
+
+func (sl *slots) bytes() []byte {
+	b := make([]byte, len(sl.bitmap))
+	copy(b, sl.bitmap)
+	return b
+}
+
+// memFile is an in memory file.
+type memFile struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if end := off + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	return copy(f.data[off:], p), nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sharky
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// blockingFile blocks reads until unblocked.
+type blockingFile struct {
+	memFile
+	reading chan struct{}
+	unblock chan struct{}
+	syncs   int
+}
+
+func (f *blockingFile) ReadAt(p []byte, off int64) (int, error) {
+	f.reading <- struct{}{}
+	<-f.unblock
+	return f.memFile.ReadAt(p, off)
+}
+
+func (f *blockingFile) Sync() error {
+	f.syncs++
+	return nil
+}
+
+func TestReleaseWhileReading(t *testing.T) {
+	f := &blockingFile{
+		reading: make(chan struct{}),
+		unblock: make(chan struct{}),
+	}
+	sh, err := openShard("", 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh.file = f
+
+	loc, err := sh.write([]byte("aaaa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, loc.Length)
+	done := make(chan error)
+	go func() {
+		done <- sh.read(loc, buf)
+	}()
+	<-f.reading
+
+	if err := sh.release(loc.Slot); err != nil {
+		t.Fatal(err)
+	}
+	// released slots can not be read or released again
+	if err := sh.release(loc.Slot); !errors.Is(err, ErrInvalidLocation) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidLocation)
+	}
+	if err := sh.read(loc, buf); !errors.Is(err, ErrInvalidLocation) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidLocation)
+	}
+
+	// the slot is not reused while it is read
+	other, err := sh.write([]byte("bbbb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Slot == loc.Slot {
+		t.Fatal("slot reused while read")
+	}
+
+	close(f.unblock)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, []byte("aaaa")) {
+		t.Fatalf("read %q, want %q", buf, "aaaa")
+	}
+
+	// freed by the reader
+	next, err := sh.write([]byte("cccc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Slot != loc.Slot {
+		t.Fatalf("got slot %d, want the released slot %d", next.Slot, loc.Slot)
+	}
+}
+
+func TestSync(t *testing.T) {
+	f := &blockingFile{}
+	sh, err := openShard("", 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh.file = f
+
+	if err := sh.sync(); err != nil {
+		t.Fatal(err)
+	}
+	if f.syncs != 0 {
+		t.Fatalf("synced %d times without writes", f.syncs)
+	}
+
+	if _, err := sh.write([]byte("aaaa")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := sh.sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.syncs != 1 {
+		t.Fatalf("synced %d times, want 1", f.syncs)
+	}
+}
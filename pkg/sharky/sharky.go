@@ -0,0 +1,235 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sharky provides a sharded, append-only blob store for chunk
+// payloads. Every shard is a file of fixed size slots, slots of released
+// blobs are reused by later writes. The store only hands out locations, the
+// caller is responsible for keeping track of them.
+//
+// Free slots are persisted when the store is closed and are dropped when it
+// is opened, so a store that was not closed cleanly considers all of its
+// slots in use until the free slots are rebuilt with a Recovery from the
+// locations the caller still references.
+package sharky
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// LocationSize is the size of a binary encoded Location.
+const LocationSize = 7
+
+var (
+	// ErrTooLong is returned when the data does not fit in a slot.
+	ErrTooLong = errors.New("data too long")
+	// ErrInvalidLocation is returned for locations not referencing a used
+	// slot of the store.
+	ErrInvalidLocation = errors.New("invalid location")
+	// ErrClosed is returned when the store is used after it was closed.
+	ErrClosed = errors.New("store closed")
+)
+
+// Location addresses a blob in the store.
+type Location struct {
+	Shard  uint8
+	Slot   uint32
+	Length uint16
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (l Location) MarshalBinary() ([]byte, error) {
+	b := make([]byte, LocationSize)
+	b[0] = l.Shard
+	binary.BigEndian.PutUint32(b[1:5], l.Slot)
+	binary.BigEndian.PutUint16(b[5:7], l.Length)
+	return b, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (l *Location) UnmarshalBinary(b []byte) error {
+	if len(b) != LocationSize {
+		return fmt.Errorf("%w: length %d", ErrInvalidLocation, len(b))
+	}
+	l.Shard = b[0]
+	l.Slot = binary.BigEndian.Uint32(b[1:5])
+	l.Length = binary.BigEndian.Uint16(b[5:7])
+	return nil
+}
+
+// LocationFromBinary decodes a binary encoded Location.
+func LocationFromBinary(b []byte) (Location, error) {
+	var l Location
+	err := l.UnmarshalBinary(b)
+	return l, err
+}
+
+// Store is a sharded blob store.
+type Store struct {
+	maxDataSize int
+	shards      []*shard
+	next        uint32 // round robin shard selection
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New opens the store in basedir with shardCnt shards holding blobs of at
+// most maxDataSize bytes. With an empty basedir the store is kept in memory.
+// The shard count and data size must not change for an existing store.
+func New(basedir string, shardCnt, maxDataSize int) (*Store, error) {
+	if err := validate(shardCnt, maxDataSize); err != nil {
+		return nil, err
+	}
+	if basedir != "" {
+		if err := os.MkdirAll(basedir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Store{
+		maxDataSize: maxDataSize,
+		shards:      make([]*shard, shardCnt),
+	}
+	for i := range s.shards {
+		sh, err := openShard(basedir, uint8(i), maxDataSize)
+		if err != nil {
+			for _, sh := range s.shards[:i] {
+				_ = sh.close()
+			}
+			return nil, fmt.Errorf("open shard %d: %w", i, err)
+		}
+		s.shards[i] = sh
+	}
+	return s, nil
+}
+
+func validate(shardCnt, maxDataSize int) error {
+	if shardCnt <= 0 || shardCnt > 256 {
+		return fmt.Errorf("invalid shard count %d", shardCnt)
+	}
+	if maxDataSize <= 0 || maxDataSize > 1<<16-1 {
+		return fmt.Errorf("invalid data size %d", maxDataSize)
+	}
+	return nil
+}
+
+// Write stores the data in a free slot of the next shard and returns its
+// location.
+func (s *Store) Write(ctx context.Context, data []byte) (Location, error) {
+	if len(data) > s.maxDataSize {
+		return Location{}, ErrTooLong
+	}
+	if err := ctx.Err(); err != nil {
+		return Location{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return Location{}, ErrClosed
+	}
+
+	sh := s.shards[atomic.AddUint32(&s.next, 1)%uint32(len(s.shards))]
+	return sh.write(data)
+}
+
+// Read reads the blob at the location into buf, which must be at least as
+// long as the blob. A slot released while it is read is not reused before
+// the read finishes, but the location may no longer belong to the blob the
+// caller expects, so callers must recheck their index after the read.
+func (s *Store) Read(ctx context.Context, loc Location, buf []byte) error {
+	if len(buf) < int(loc.Length) {
+		return fmt.Errorf("buffer of %d bytes too short for %d", len(buf), loc.Length)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	sh, err := s.shard(loc)
+	if err != nil {
+		return err
+	}
+	return sh.read(loc, buf)
+}
+
+// Sync flushes the writes of all shards to disk. Locations must only be
+// referenced durably after the writes returning them are synced.
+func (s *Store) Sync(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	for _, sh := range s.shards {
+		if err := sh.sync(); err != nil {
+			return fmt.Errorf("sync shard %d: %w", sh.index, err)
+		}
+	}
+	return nil
+}
+
+// Release frees the slot at the location for later writes.
+func (s *Store) Release(ctx context.Context, loc Location) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	sh, err := s.shard(loc)
+	if err != nil {
+		return err
+	}
+	return sh.release(loc.Slot)
+}
+
+func (s *Store) shard(loc Location) (*shard, error) {
+	if int(loc.Shard) >= len(s.shards) || int(loc.Length) > s.maxDataSize {
+		return nil, fmt.Errorf("%w: %+v", ErrInvalidLocation, loc)
+	}
+	return s.shards[loc.Shard], nil
+}
+
+// Close persists the free slots and closes the shards.
+func (s *Store) Close() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	for _, sh := range s.shards {
+		if e := sh.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func shardPath(basedir string, index uint8) string {
+	return filepath.Join(basedir, fmt.Sprintf("shard_%03d", index))
+}
+
+func freePath(basedir string, index uint8) string {
+	return filepath.Join(basedir, fmt.Sprintf("free_%03d", index))
+}
@@ -0,0 +1,212 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sharky_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/sharky"
+)
+
+const (
+	shardCnt    = 4
+	maxDataSize = 16
+)
+
+func newStore(t *testing.T, dir string) *sharky.Store {
+	t.Helper()
+
+	s, err := sharky.New(dir, shardCnt, maxDataSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "sharky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func write(t *testing.T, s *sharky.Store, data []byte) sharky.Location {
+	t.Helper()
+
+	loc, err := s.Write(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func read(t *testing.T, s *sharky.Store, loc sharky.Location, want []byte) {
+	t.Helper()
+
+	buf := make([]byte, loc.Length)
+	if err := s.Read(context.Background(), loc, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, want) {
+		t.Fatalf("got %q at %+v, want %q", buf, loc, want)
+	}
+}
+
+func TestLocation(t *testing.T) {
+	loc := sharky.Location{Shard: 3, Slot: 1 << 20, Length: 4104}
+	b, err := loc.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != sharky.LocationSize {
+		t.Fatalf("got %d bytes, want %d", len(b), sharky.LocationSize)
+	}
+	got, err := sharky.LocationFromBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != loc {
+		t.Fatalf("got %+v, want %+v", got, loc)
+	}
+	if _, err := sharky.LocationFromBinary(b[1:]); !errors.Is(err, sharky.ErrInvalidLocation) {
+		t.Fatalf("got error %v, want %v", err, sharky.ErrInvalidLocation)
+	}
+}
+
+func TestStore(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		dir  func(t *testing.T) string
+	}{
+		{name: "memory", dir: func(*testing.T) string { return "" }},
+		{name: "disk", dir: tempDir},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newStore(t, tc.dir(t))
+			defer s.Close()
+
+			if _, err := s.Write(context.Background(), make([]byte, maxDataSize+1)); !errors.Is(err, sharky.ErrTooLong) {
+				t.Fatalf("got error %v, want %v", err, sharky.ErrTooLong)
+			}
+
+			data := [][]byte{[]byte("first"), []byte("second"), bytes.Repeat([]byte{1}, maxDataSize)}
+			locs := make([]sharky.Location, len(data))
+			for i, d := range data {
+				locs[i] = write(t, s, d)
+			}
+			for i, d := range data {
+				read(t, s, locs[i], d)
+			}
+
+			if err := s.Release(context.Background(), locs[0]); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Release(context.Background(), locs[0]); !errors.Is(err, sharky.ErrInvalidLocation) {
+				t.Fatalf("got error %v, want %v", err, sharky.ErrInvalidLocation)
+			}
+
+			// writes go round robin, the released slot is reused by the
+			// next write to its shard
+			var reused bool
+			for i := 0; i < shardCnt; i++ {
+				loc := write(t, s, []byte("third"))
+				if loc.Shard == locs[0].Shard {
+					reused = loc.Slot == locs[0].Slot
+				}
+				read(t, s, loc, []byte("third"))
+			}
+			if !reused {
+				t.Fatal("released slot not reused")
+			}
+			read(t, s, locs[1], data[1])
+		})
+	}
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := tempDir(t)
+
+	s := newStore(t, dir)
+	locs := make([]sharky.Location, shardCnt)
+	for i := range locs {
+		locs[i] = write(t, s, []byte{byte(i)})
+	}
+	if err := s.Release(context.Background(), locs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newStore(t, dir)
+	for i, loc := range locs[1:] {
+		read(t, s, loc, []byte{byte(i + 1)})
+	}
+	// the slot released before closing is free after reopening
+	if err := s.Release(context.Background(), locs[0]); !errors.Is(err, sharky.ErrInvalidLocation) {
+		t.Fatalf("got error %v, want %v", err, sharky.ErrInvalidLocation)
+	}
+	// the other slots are still used
+	if err := s.Release(context.Background(), locs[1]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	dir := tempDir(t)
+
+	s := newStore(t, dir)
+	var locs []sharky.Location
+	for i := 0; i < 2*shardCnt; i++ {
+		locs = append(locs, write(t, s, []byte{byte(i)}))
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening drops the free slots, the store is then not closed cleanly
+	s = newStore(t, dir)
+	if err := s.Release(context.Background(), locs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := sharky.NewRecovery(dir, shardCnt, maxDataSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the second half is still referenced
+	for _, loc := range locs[shardCnt:] {
+		if err := r.Add(loc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Add(sharky.Location{Shard: 0, Slot: 100}); !errors.Is(err, sharky.ErrInvalidLocation) {
+		t.Fatalf("got error %v, want %v", err, sharky.ErrInvalidLocation)
+	}
+	if err := r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newStore(t, dir)
+	defer s.Close()
+	for i, loc := range locs {
+		err := s.Release(context.Background(), loc)
+		if i < shardCnt && !errors.Is(err, sharky.ErrInvalidLocation) {
+			t.Fatalf("location %d: got error %v, want %v", i, err, sharky.ErrInvalidLocation)
+		}
+		if i >= shardCnt && err != nil {
+			t.Fatalf("location %d: %v", i, err)
+		}
+	}
+}
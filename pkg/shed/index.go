@@ -49,6 +49,7 @@ type Item struct {
 	Sig             []byte // postage stamp
 	Depth           uint8  // postage batch depth
 	Radius          uint8  // postage batch reserve radius, po upto and excluding which chunks are unpinned
+	Location        []byte // location of the chunk data outside of the index
 }
 
 // Merge is a helper method to construct a new
@@ -88,6 +89,9 @@ func (i Item) Merge(i2 Item) Item {
 	if i.Radius == 0 {
 		i.Radius = i2.Radius
 	}
+	if len(i.Location) == 0 {
+		i.Location = i2.Location
+	}
 	return i
 }
 
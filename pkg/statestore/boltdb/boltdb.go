@@ -0,0 +1,220 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package boltdb provides a persistent statestore
+// which keeps all state in a single BoltDB file.
+package boltdb
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/syndtr/goleveldb/leveldb"
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ storage.StateStorer = (*store)(nil)
+
+var bucketName = []byte("statestore")
+
+const (
+	schemaKey  = "statestore_schema"
+	schemaName = "bolt"
+)
+
+// iterateBatchSize is the number of entries read in a single
+// read transaction while iterating, the iteration function is
+// called outside of the transaction so that it can modify the store.
+const iterateBatchSize = 1000
+
+// store uses BoltDB to store values.
+type store struct {
+	db     *bolt.DB
+	path   string
+	logger logging.Logger
+}
+
+// NewStateStore creates a new persistent state storage in the file at path.
+func NewStateStore(path string, l logging.Logger) (storage.StateStorer, error) {
+	db, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &store{
+		db:     db,
+		path:   path,
+		logger: l,
+	}
+
+	var name string
+	if err := s.Get(schemaKey, &name); err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			_ = s.Close()
+			return nil, fmt.Errorf("get schema name: %w", err)
+		}
+		// new statestore - put schema key with current name
+		if err := s.Put(schemaKey, schemaName); err != nil {
+			_ = s.Close()
+			return nil, fmt.Errorf("put schema name: %w", err)
+		}
+	} else if name != schemaName {
+		_ = s.Close()
+		return nil, fmt.Errorf("unknown schema %q", name)
+	}
+
+	return s, nil
+}
+
+func open(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Get retrieves a value of the requested key. If no results are found,
+// storage.ErrNotFound will be returned.
+func (s *store) Get(key string, i interface{}) error {
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketName).Get([]byte(key))
+		if v == nil {
+			return storage.ErrNotFound
+		}
+		// the value is only valid during the transaction
+		data = append([]byte(nil), v...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if unmarshaler, ok := i.(encoding.BinaryUnmarshaler); ok {
+		return unmarshaler.UnmarshalBinary(data)
+	}
+
+	return json.Unmarshal(data, i)
+}
+
+// Put stores a value for an arbitrary key. BinaryMarshaler
+// interface method will be called on the provided value
+// with fallback to JSON serialization.
+func (s *store) Put(key string, i interface{}) (err error) {
+	var data []byte
+	if marshaler, ok := i.(encoding.BinaryMarshaler); ok {
+		if data, err = marshaler.MarshalBinary(); err != nil {
+			return err
+		}
+	} else if data, err = json.Marshal(i); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Put([]byte(key), data)
+	})
+}
+
+// Delete removes entries stored under a specific key.
+func (s *store) Delete(key string) (err error) {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Delete([]byte(key))
+	})
+}
+
+// Iterate entries that match the supplied prefix.
+func (s *store) Iterate(prefix string, iterFunc storage.StateIterFunc) (err error) {
+	p := []byte(prefix)
+	start := p
+	for {
+		var keys, values [][]byte
+		err := s.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(bucketName).Cursor()
+			for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+				if len(keys) == iterateBatchSize {
+					break
+				}
+				keys = append(keys, append([]byte(nil), k...))
+				values = append(values, append([]byte(nil), v...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := range keys {
+			stop, err := iterFunc(keys[i], values[i])
+			if err != nil {
+				return err
+			}
+			if stop {
+				return nil
+			}
+		}
+		if len(keys) < iterateBatchSize {
+			return nil
+		}
+		// continue after the last key
+		start = append(keys[len(keys)-1], 0)
+	}
+}
+
+// DB implements StateStorer.DB method. There is no
+// underlying leveldb database so nil is returned.
+func (s *store) DB() *leveldb.DB {
+	return nil
+}
+
+// Compact rewrites the database file without the free pages.
+func (s *store) Compact() (err error) {
+	tmp := s.path + ".compact"
+	dst, err := bolt.Open(tmp, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+	if err := bolt.Compact(dst, s.db, 64<<20); err != nil {
+		_ = dst.Close()
+		return fmt.Errorf("compact: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	if renameErr := os.Rename(tmp, s.path); renameErr != nil {
+		// keep using the uncompacted file
+		if s.db, err = open(s.path); err != nil {
+			return err
+		}
+		return fmt.Errorf("replace database file: %w", renameErr)
+	}
+	s.db, err = open(s.path)
+	return err
+}
+
+// Close releases the resources used by the store.
+func (s *store) Close() error {
+	return s.db.Close()
+}
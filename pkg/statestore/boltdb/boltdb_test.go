@@ -0,0 +1,117 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boltdb_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/statestore/boltdb"
+	"github.com/penguintop/penguin/pkg/statestore/test"
+	"github.com/penguintop/penguin/pkg/storage"
+)
+
+func newTestStore(t *testing.T) storage.StateStorer {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "statestore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	store, err := boltdb.NewStateStore(filepath.Join(dir, "statestore.bolt"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return store
+}
+
+func TestPersistentStateStore(t *testing.T) {
+	test.Run(t, newTestStore)
+
+	test.RunPersist(t, func(t *testing.T, dir string) storage.StateStorer {
+		store, err := boltdb.NewStateStore(filepath.Join(dir, "statestore.bolt"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return store
+	})
+}
+
+// TestIterateModify checks that the store can be modified
+// while it is iterated over more than a single read batch.
+func TestIterateModify(t *testing.T) {
+	store := newTestStore(t)
+
+	const count = 1200
+	for i := 0; i < count; i++ {
+		if err := store.Put(fmt.Sprintf("prefix_%05d", i), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Put("other", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	err := store.Iterate("prefix_", func(key, value []byte) (bool, error) {
+		if want := fmt.Sprintf("prefix_%05d", n); string(key) != want {
+			return true, fmt.Errorf("got key %s, want %s", key, want)
+		}
+		n++
+		return false, store.Delete(string(key))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != count {
+		t.Fatalf("iterated %d entries, want %d", n, count)
+	}
+
+	err = store.Iterate("prefix_", func(key, value []byte) (bool, error) {
+		return true, fmt.Errorf("got key %s after deleting the prefix", key)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	if err := store.Get("other", &v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	store := newTestStore(t)
+
+	for i := 0; i < 100; i++ {
+		if err := store.Put(fmt.Sprintf("key_%d", i), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.(interface{ Compact() error }).Compact(); err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	if err := store.Get("key_42", &v); err != nil {
+		t.Fatal(err)
+	}
+	if v != 42 {
+		t.Fatalf("got value %d after compaction, want 42", v)
+	}
+}
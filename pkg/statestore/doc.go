@@ -2,6 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package statestore provides statestore implementation
-// and mock. It uses leveldb under the hood.
+// Package statestore provides statestore implementations
+// and mock. Persistent state is kept by leveldb or by BoltDB,
+// the backend is selected when the statestore is opened.
 package statestore
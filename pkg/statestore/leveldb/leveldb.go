@@ -143,6 +143,11 @@ func (s *store) DB() *leveldb.DB {
 	return s.db
 }
 
+// Compact compacts the whole underlying database.
+func (s *store) Compact() error {
+	return s.db.CompactRange(util.Range{})
+}
+
 // Close releases the resources used by the store.
 func (s *store) Close() error {
 	return s.db.Close()
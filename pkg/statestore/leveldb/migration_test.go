@@ -19,6 +19,7 @@ package leveldb
 import (
 	"errors"
 	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/penguintop/penguin/pkg/logging"
@@ -47,7 +48,11 @@ func TestOneMigration(t *testing.T) {
 		}},
 	}
 
-	dir := "./"
+	dir, err := ioutil.TempDir("", "statestore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 	logger := logging.New(ioutil.Discard, 0)
 
 	// start the fresh statestore with the sanctuary schema name
@@ -130,7 +135,11 @@ func TestManyMigrations(t *testing.T) {
 		}},
 	}
 
-	dir := "./"
+	dir, err := ioutil.TempDir("", "statestore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 	logger := logging.New(ioutil.Discard, 0)
 
 	// start the fresh statestore with the sanctuary schema name
@@ -205,7 +214,11 @@ func TestMigrationErrorFrom(t *testing.T) {
 			return nil
 		}},
 	}
-	dir := "./"
+	dir, err := ioutil.TempDir("", "statestore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 	logger := logging.New(ioutil.Discard, 0)
 
 	// start the fresh statestore with the sanctuary schema name
@@ -256,7 +269,11 @@ func TestMigrationErrorTo(t *testing.T) {
 			return nil
 		}},
 	}
-	dir := "./"
+	dir, err := ioutil.TempDir("", "statestore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 	logger := logging.New(ioutil.Discard, 0)
 
 	// start the fresh statestore with the sanctuary schema name
@@ -0,0 +1,215 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package statestore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/statestore/boltdb"
+	leveldbstore "github.com/penguintop/penguin/pkg/statestore/leveldb"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Persistent statestore backends.
+const (
+	BackendLevelDB = "leveldb"
+	BackendBoltDB  = "boltdb"
+)
+
+// Backends are the names of the persistent statestore backends.
+var Backends = []string{BackendLevelDB, BackendBoltDB}
+
+// schemaKey is the key of the schema name which every backend keeps
+// for itself, it is not copied between stores.
+const schemaKey = "statestore_schema"
+
+var (
+	// ErrUnknownBackend is returned for a backend name which is not supported.
+	ErrUnknownBackend = errors.New("unknown statestore backend")
+	// ErrOtherBackend is returned when the data directory holds a
+	// statestore of another backend than the requested one.
+	ErrOtherBackend = errors.New("statestore of another backend found")
+)
+
+// Path returns the location of the statestore
+// of the backend in the data directory.
+func Path(dataDir, backend string) (string, error) {
+	switch backend {
+	case BackendLevelDB:
+		return filepath.Join(dataDir, "statestore"), nil
+	case BackendBoltDB:
+		return filepath.Join(dataDir, "statestore.bolt"), nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownBackend, backend)
+}
+
+// Exists returns true if the data directory holds
+// a statestore of the backend.
+func Exists(dataDir, backend string) (bool, error) {
+	path, err := Path(dataDir, backend)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	}
+	return false, err
+}
+
+// Open opens the statestore of the backend in the data directory. A new
+// statestore is not created when the data directory holds the statestore of
+// another backend, its state has to be migrated first.
+func Open(dataDir, backend string, logger logging.Logger) (storage.StateStorer, error) {
+	exists, err := Exists(dataDir, backend)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		for _, other := range Backends {
+			if other == backend {
+				continue
+			}
+			found, err := Exists(dataDir, other)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				return nil, fmt.Errorf("%w: %s, migrate it to %s", ErrOtherBackend, other, backend)
+			}
+		}
+	}
+	return OpenPath(dataDir, backend, logger)
+}
+
+// OpenPath opens or creates the statestore of the backend
+// in the data directory, regardless of the other backends.
+func OpenPath(dataDir, backend string, logger logging.Logger) (storage.StateStorer, error) {
+	path, err := Path(dataDir, backend)
+	if err != nil {
+		return nil, err
+	}
+	switch backend {
+	case BackendBoltDB:
+		return boltdb.NewStateStore(path, logger)
+	default:
+		return leveldbstore.NewStateStore(path, logger)
+	}
+}
+
+// Compact compacts the statestore if its backend supports it.
+func Compact(s storage.StateStorer) error {
+	c, ok := s.(interface{ Compact() error })
+	if !ok {
+		return errors.New("statestore compaction not supported")
+	}
+	return c.Compact()
+}
+
+// RawValue is a statestore value which is stored and
+// loaded as it is, without any serialization.
+type RawValue []byte
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (v RawValue) MarshalBinary() ([]byte, error) {
+	return v, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (v *RawValue) UnmarshalBinary(data []byte) error {
+	*v = append((*v)[:0], data...)
+	return nil
+}
+
+// Copy copies the entries with the key prefix from the src to the dst
+// statestore and returns the number of copied entries. The schema
+// name of the stores and the entries of the shed databases sharing
+// the leveldb statestore are not copied, see MigrateMetrics.
+func Copy(dst, src storage.StateStorer, prefix string) (n int, err error) {
+	err = src.Iterate(prefix, func(key, value []byte) (bool, error) {
+		if string(key) == schemaKey || isShedKey(key) {
+			return false, nil
+		}
+		if err := dst.Put(string(key), RawValue(value)); err != nil {
+			return true, fmt.Errorf("put %s: %w", key, err)
+		}
+		n++
+		return false, nil
+	})
+	return n, err
+}
+
+// MetricsPath returns the location of the database of the kademlia metrics
+// in the data directory, used by the backends other than leveldb. The
+// leveldb statestore keeps the metrics itself.
+func MetricsPath(dataDir string) string {
+	return filepath.Join(dataDir, "kademlia-metrics")
+}
+
+// MigrateMetrics moves the entries of the shed databases sharing the leveldb
+// statestore, like the kademlia metrics, along with the statestore copied
+// from the src to the dst backend: into the metrics database if only the src
+// is a leveldb statestore, from it if only the dst is one. It returns the
+// number of copied entries.
+func MigrateMetrics(dataDir string, dst, src storage.StateStorer) (n int, err error) {
+	path := MetricsPath(dataDir)
+	switch {
+	case src.DB() != nil && dst.DB() == nil:
+		db, err := leveldb.OpenFile(path, nil)
+		if err != nil {
+			return 0, fmt.Errorf("open metrics database: %w", err)
+		}
+		defer db.Close()
+		return copyShed(db, src.DB())
+	case src.DB() == nil && dst.DB() != nil:
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return 0, nil
+		}
+		db, err := leveldb.OpenFile(path, nil)
+		if err != nil {
+			return 0, fmt.Errorf("open metrics database: %w", err)
+		}
+		defer db.Close()
+		return copyShed(dst.DB(), db)
+	}
+	return 0, nil
+}
+
+// copyShed copies the entries of the shed databases
+// from the src to the dst leveldb database.
+func copyShed(dst, src *leveldb.DB) (n int, err error) {
+	batch := new(leveldb.Batch)
+	iter := src.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if !isShedKey(iter.Key()) {
+			continue
+		}
+		batch.Put(iter.Key(), iter.Value())
+		n++
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	if err := dst.Write(batch, nil); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// isShedKey reports whether the key is of a shed database sharing the leveldb
+// statestore. The shed schema and field keys start with the bytes 0 and 1,
+// while the statestore keys are printable.
+func isShedKey(key []byte) bool {
+	return len(key) > 0 && key[0] < ' '
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package statestore_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/shed"
+	"github.com/penguintop/penguin/pkg/statestore"
+	"github.com/penguintop/penguin/pkg/storage"
+)
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statestore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	logger := logging.New(ioutil.Discard, 0)
+
+	if _, err := statestore.Open(dir, "pebble", logger); !errors.Is(err, statestore.ErrUnknownBackend) {
+		t.Fatalf("got error %v, want %v", err, statestore.ErrUnknownBackend)
+	}
+
+	src, err := statestore.Open(dir, statestore.BackendLevelDB, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := src.Put(fmt.Sprintf("a_%d", i), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.Put("b", "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := statestore.Open(dir, statestore.BackendBoltDB, logger); !errors.Is(err, statestore.ErrOtherBackend) {
+		t.Fatalf("got error %v, want %v", err, statestore.ErrOtherBackend)
+	}
+
+	dst, err := statestore.OpenPath(dir, statestore.BackendBoltDB, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := statestore.Copy(dst, src, "a_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Fatalf("copied %d entries, want 10", n)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// both statestores exist now
+	dst, err = statestore.Open(dir, statestore.BackendBoltDB, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	var v int
+	if err := dst.Get("a_7", &v); err != nil {
+		t.Fatal(err)
+	}
+	if v != 7 {
+		t.Fatalf("got value %d, want 7", v)
+	}
+	if err := dst.Get("b", new(string)); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v for a key outside of the prefix, want %v", err, storage.ErrNotFound)
+	}
+	if err := statestore.Compact(dst); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statestore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	logger := logging.New(ioutil.Discard, 0)
+
+	src, err := statestore.Open(dir, statestore.BackendLevelDB, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Put("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	// the kademlia metrics share the leveldb statestore
+	metrics, err := shed.NewDBWrap(src.DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	field, err := metrics.NewUint64Field("metric")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := field.Put(42); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := statestore.OpenPath(dir, statestore.BackendBoltDB, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := statestore.Copy(dst, src, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("copied %d entries, want only the statestore entry", n)
+	}
+	var keys []string
+	if err := dst.Iterate("", func(key, _ []byte) (bool, error) {
+		keys = append(keys, string(key))
+		return false, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "a" {
+		t.Fatalf("got keys %q, want the copied entry and the schema name", keys)
+	}
+
+	// the metrics are moved to their database for the bolt statestore
+	n, err = statestore.MigrateMetrics(dir, dst, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("migrated %d metrics entries, want the schema and the field", n)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err = shed.NewDB(statestore.MetricsPath(dir), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer metrics.Close()
+	field, err = metrics.NewUint64Field("metric")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := field.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 42 {
+		t.Fatalf("got metric %d, want 42", v)
+	}
+}
@@ -17,9 +17,10 @@ import (
 )
 
 var (
-	ErrNotFound        = errors.New("storage: not found")
-	ErrInvalidChunk    = errors.New("storage: invalid chunk")
-	ErrReferenceLength = errors.New("invalid reference length")
+	ErrNotFound         = errors.New("storage: not found")
+	ErrInvalidChunk     = errors.New("storage: invalid chunk")
+	ErrReferenceLength  = errors.New("invalid reference length")
+	ErrPinQuotaExceeded = errors.New("storage: pin quota exceeded")
 )
 
 // ModeGet enumerates different Getter modes.
@@ -62,6 +62,7 @@ type Tag struct {
 	Uid       uint32          // a unique identifier for this tag
 	Address   penguin.Address // the associated penguin hash for this tag
 	StartedAt time.Time       // tag started to calculate ETA
+	Client    string          // api key identifier of the client that uploads the chunks
 
 	// end-to-end tag tracing
 	ctx        context.Context     // tracing context
@@ -258,6 +259,10 @@ func (tag *Tag) MarshalBinary() (data []byte, err error) {
 	buffer = append(buffer, intBuffer[:n]...)
 	buffer = append(buffer, tag.Address.Bytes()...)
 
+	n = binary.PutVarint(intBuffer, int64(len(tag.Client)))
+	buffer = append(buffer, intBuffer[:n]...)
+	buffer = append(buffer, tag.Client...)
+
 	return buffer, nil
 }
 
@@ -284,6 +289,16 @@ func (tag *Tag) UnmarshalBinary(buffer []byte) error {
 	buffer = buffer[n:]
 	if t > 0 {
 		tag.Address = penguin.NewAddress(buffer[:t])
+		buffer = buffer[t:]
+	}
+
+	// the client is missing in the tags stored by older versions
+	if len(buffer) > 0 {
+		t, n = binary.Varint(buffer)
+		buffer = buffer[n:]
+		if t > 0 {
+			tag.Client = string(buffer[:t])
+		}
 	}
 
 	return nil
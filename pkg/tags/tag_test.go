@@ -224,6 +224,7 @@ func TestMarshallingWithAddr(t *testing.T) {
 	logger := logging.New(ioutil.Discard, 0)
 	tg := NewTag(context.Background(), 111, 10, nil, mockStatestore, logger)
 	tg.Address = penguin.NewAddress([]byte{0, 1, 2, 3, 4, 5, 6})
+	tg.Client = "0123456789abcdef"
 
 	for _, f := range allStates {
 		err := tg.Inc(f)
@@ -265,6 +266,10 @@ func TestMarshallingWithAddr(t *testing.T) {
 	if !unmarshalledTag.Address.Equal(tg.Address) {
 		t.Fatalf("expected tag address to be %v got %v", unmarshalledTag.Address, tg.Address)
 	}
+
+	if unmarshalledTag.Client != tg.Client {
+		t.Fatalf("tag clients not equal. want %q got %q", tg.Client, unmarshalledTag.Client)
+	}
 }
 
 // TestMarshallingNoAddress tests that marshalling and unmarshalling is done correctly
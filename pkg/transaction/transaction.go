@@ -38,6 +38,10 @@ const (
 	TxTypeInvokeContract     = 102
 )
 
+// Fee is the fee paid for every transaction sent by the service, on top of
+// the gas of contract transactions.
+const Fee = 2000000
+
 var (
 	// ErrTransactionReverted denotes that the sent transaction has been
 	// reverted.
@@ -129,7 +133,7 @@ func (t *transactionService) Send(ctx context.Context, request *TxRequest) (txHa
 	xwcFrom, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(from[:]))
 	gasPrice := uint64(request.GasPrice.Int64())
 	gasLimit := uint64(request.GasLimit)
-	fee := uint64(2000000)
+	fee := uint64(Fee)
 
 	var tx *xwcfmt.Transaction
 
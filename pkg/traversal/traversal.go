@@ -25,6 +25,9 @@ import (
 type Traverser interface {
 	// Traverse iterates through each address related to the supplied one, if possible.
 	Traverse(context.Context, penguin.Address, penguin.AddressIterFunc) error
+	// TraverseEntries iterates through the entries of the manifest with
+	// the supplied address in path order, as they are loaded.
+	TraverseEntries(context.Context, penguin.Address, manifest.EntryIterFunc) error
 }
 
 // New constructs for a new Traverser.
@@ -76,3 +79,16 @@ func (s *service) Traverse(ctx context.Context, addr penguin.Address, iterFn pen
 	}
 	return nil
 }
+
+// TraverseEntries implements Traverser.TraverseEntries method.
+func (s *service) TraverseEntries(ctx context.Context, addr penguin.Address, iterFn manifest.EntryIterFunc) error {
+	ls := loadsave.New(s.store, storage.ModePutRequest, false)
+	mf, err := manifest.NewDefaultManifestReference(addr, ls)
+	if err != nil {
+		return fmt.Errorf("traversal: unable to create manifest reference for %q: %w", addr, err)
+	}
+	if err := mf.IterateEntries(ctx, "", iterFn); err != nil {
+		return fmt.Errorf("traversal: unable to iterate entries for %q: %w", addr, err)
+	}
+	return nil
+}
@@ -0,0 +1,695 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package wallet gives access to the funds of the node account: the XWC
+// balance used to pay the transaction fees and the PEN token balance.
+//
+// The transfer history is synced from the chain in the background: the XWC
+// transfer operations and the Transfer events of the PEN token into and out
+// of the node account. Transfers sent through the wallet are journaled when
+// sent and merged with their operation or event once it is on the chain.
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/property"
+	"github.com/penguintop/penguin/pkg/settlement/swap/erc20"
+	"github.com/penguintop/penguin/pkg/storage"
+	"github.com/penguintop/penguin/pkg/transaction"
+	"github.com/penguintop/penguin/pkg/xwcfmt"
+	"github.com/penguintop/penguin/pkg/xwctypes"
+)
+
+const (
+	transferPrefix = "wallet_transfer_"
+	syncedBlockKey = "wallet_synced_block"
+
+	// DefaultSyncInterval is the interval at which the transfers are synced
+	// from the chain.
+	DefaultSyncInterval = 30 * time.Second
+
+	// syncBatch is the number of blocks scanned at once.
+	syncBatch = 100
+
+	// transferOperation is the type of the XWC transfer operation.
+	transferOperation = 0
+	// tokenTransferEvent is the event of PEN token transfers.
+	tokenTransferEvent = "Transfer"
+)
+
+var (
+	// ErrUnknownAsset is returned for assets other than XWC and PEN.
+	ErrUnknownAsset = errors.New("unknown asset")
+	// ErrNoToken is returned for PEN operations if the token is not known,
+	// which is the case if swap is disabled.
+	ErrNoToken = errors.New("pen token not available")
+	// ErrInvalidAmount is returned for amounts that are not positive or do
+	// not fit into a transaction.
+	ErrInvalidAmount = errors.New("invalid amount")
+	// ErrInsufficientFunds is returned if the balance does not cover the
+	// amount and the fee of a transfer.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+// Asset is a currency held by the node account.
+type Asset string
+
+const (
+	// AssetXWC is the native currency of the chain.
+	AssetXWC Asset = "xwc"
+	// AssetPEN is the PEN token.
+	AssetPEN Asset = "pen"
+)
+
+// ParseAsset returns the asset with the given name.
+func ParseAsset(s string) (Asset, error) {
+	switch a := Asset(strings.ToLower(s)); a {
+	case AssetXWC, AssetPEN:
+		return a, nil
+	}
+	return "", ErrUnknownAsset
+}
+
+// Status is the state of a transfer on the chain.
+type Status string
+
+const (
+	// StatusPending is the status of transfers without a receipt yet.
+	StatusPending Status = "pending"
+	// StatusConfirmed is the status of transfers executed on the chain.
+	StatusConfirmed Status = "confirmed"
+	// StatusFailed is the status of transfers whose execution failed.
+	StatusFailed Status = "failed"
+)
+
+// Balances are the funds of the node account. PEN is nil if the token is not
+// known.
+type Balances struct {
+	XWC *big.Int
+	PEN *big.Int
+}
+
+// Fee is the cost of a transfer in XWC.
+type Fee struct {
+	Asset    Asset
+	Fee      *big.Int
+	GasPrice *big.Int
+	GasLimit uint64
+	// Total is the most a transfer can cost, the fee and all of the gas.
+	Total *big.Int
+}
+
+// Transfer is an entry of the transfer history.
+type Transfer struct {
+	// TxHash is zero for token transfers seen only as events.
+	TxHash common.Hash    `json:"txHash"`
+	Asset  Asset          `json:"asset"`
+	From   common.Address `json:"from"`
+	To     common.Address `json:"to"`
+	Amount *big.Int       `json:"amount"`
+	// Incoming is true for transfers into the node account.
+	Incoming bool `json:"incoming"`
+	// Fee is the fee paid by the node account, the estimated fee until a
+	// sent transfer is confirmed. It is nil for incoming transfers.
+	Fee         *big.Int `json:"fee"`
+	Status      Status   `json:"status"`
+	BlockNumber uint64   `json:"blockNumber"`
+	// Created is the time a transfer was sent through the wallet, or the
+	// time of its block.
+	Created time.Time `json:"created"`
+	// OnChain is true once the operation or event of the transfer was synced.
+	OnChain bool `json:"onChain"`
+}
+
+// Backend is the access to the chain the wallet needs.
+type Backend interface {
+	transaction.Backend
+	GetContractEventsInRange(ctx context.Context, account common.Address, start uint64, to uint64) ([]xwctypes.RpcEventJson, error)
+}
+
+// TokenFunc returns the PEN token and the address of its contract. It is
+// called when the token is first used, so that looking it up on the chain
+// does not hold up the start of the node.
+type TokenFunc func(ctx context.Context) (token erc20.Service, address common.Address, err error)
+
+// Service is the wallet of the node account.
+type Service struct {
+	backend            Backend
+	transactionService transaction.Service
+	tokenFunc          TokenFunc
+	address            common.Address
+	xwcAddress         string
+	store              storage.StateStorer
+	logger             logging.Logger
+	timeNow            func() time.Time
+
+	tokenMu      sync.Mutex
+	token        erc20.Service
+	tokenAddress common.Address
+
+	// mu serializes transfers so that the balance checks hold when sent,
+	// and the journal updates of transfers and syncs.
+	mu sync.Mutex
+
+	wg     sync.WaitGroup
+	quit   chan struct{}
+	cancel context.CancelFunc
+}
+
+// New creates the wallet of the account with the given address. The token
+// func may be nil, in which case only XWC is available.
+func New(backend Backend, transactionService transaction.Service, tokenFunc TokenFunc, address common.Address, store storage.StateStorer, logger logging.Logger) *Service {
+	xwcAddress, _ := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(address[:]))
+	return &Service{
+		backend:            backend,
+		transactionService: transactionService,
+		tokenFunc:          tokenFunc,
+		address:            address,
+		xwcAddress:         xwcAddress,
+		store:              store,
+		logger:             logger,
+		timeNow:            time.Now,
+		quit:               make(chan struct{}),
+	}
+}
+
+// Address returns the address of the node account.
+func (s *Service) Address() common.Address {
+	return s.address
+}
+
+// getToken returns the PEN token, looking it up on first use.
+func (s *Service) getToken(ctx context.Context) (erc20.Service, common.Address, error) {
+	if s.tokenFunc == nil {
+		return nil, common.Address{}, ErrNoToken
+	}
+
+	s.tokenMu.Lock()
+	defer s.tokenMu.Unlock()
+
+	if s.token == nil {
+		token, address, err := s.tokenFunc(ctx)
+		if err != nil {
+			return nil, common.Address{}, fmt.Errorf("pen token: %w", err)
+		}
+		s.token, s.tokenAddress = token, address
+	}
+	return s.token, s.tokenAddress, nil
+}
+
+// Balances returns the XWC and PEN balances of the node account.
+func (s *Service) Balances(ctx context.Context) (Balances, error) {
+	xwc, err := s.backend.BalanceAt(ctx, s.address, nil)
+	if err != nil {
+		return Balances{}, fmt.Errorf("xwc balance: %w", err)
+	}
+
+	b := Balances{XWC: xwc}
+	if s.tokenFunc != nil {
+		token, _, err := s.getToken(ctx)
+		if err != nil {
+			return Balances{}, err
+		}
+		b.PEN, err = token.BalanceOf(ctx, s.address)
+		if err != nil {
+			return Balances{}, fmt.Errorf("pen balance: %w", err)
+		}
+	}
+	return b, nil
+}
+
+// Fee returns the cost of transferring the asset.
+func (s *Service) Fee(asset Asset) (Fee, error) {
+	f := Fee{
+		Asset:    asset,
+		Fee:      big.NewInt(transaction.Fee),
+		GasPrice: big.NewInt(0),
+	}
+	switch asset {
+	case AssetXWC:
+	case AssetPEN:
+		if s.tokenFunc == nil {
+			return Fee{}, ErrNoToken
+		}
+		f.GasPrice = big.NewInt(erc20.TransferGasPrice)
+		f.GasLimit = erc20.TransferGasLimit
+	default:
+		return Fee{}, ErrUnknownAsset
+	}
+
+	gas := new(big.Int).Mul(f.GasPrice, new(big.Int).SetUint64(f.GasLimit))
+	f.Total = gas.Add(gas, f.Fee)
+	return f, nil
+}
+
+// Transfer sends the amount of the asset from the node account to the given
+// address and records the transfer in the journal. XWC amounts are limited
+// to the int64 amounts of the chain, PEN amounts are not.
+func (s *Service) Transfer(ctx context.Context, asset Asset, to common.Address, amount *big.Int) (Transfer, error) {
+	if amount == nil || amount.Sign() <= 0 || (asset == AssetXWC && !amount.IsInt64()) {
+		return Transfer{}, ErrInvalidAmount
+	}
+	fee, err := s.Fee(asset)
+	if err != nil {
+		return Transfer{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balances, err := s.Balances(ctx)
+	if err != nil {
+		return Transfer{}, err
+	}
+
+	var txHash common.Hash
+	switch asset {
+	case AssetXWC:
+		if new(big.Int).Add(amount, fee.Total).Cmp(balances.XWC) > 0 {
+			return Transfer{}, ErrInsufficientFunds
+		}
+		txHash, err = s.transactionService.Send(ctx, &transaction.TxRequest{
+			To:       &to,
+			GasPrice: big.NewInt(0),
+			Value:    amount,
+			TxType:   transaction.TxTypeTransfer,
+		})
+	case AssetPEN:
+		if amount.Cmp(balances.PEN) > 0 || fee.Total.Cmp(balances.XWC) > 0 {
+			return Transfer{}, ErrInsufficientFunds
+		}
+		var token erc20.Service
+		token, _, err = s.getToken(ctx)
+		if err != nil {
+			return Transfer{}, err
+		}
+		txHash, err = token.Transfer(ctx, to, amount)
+	}
+	if err != nil {
+		return Transfer{}, err
+	}
+
+	t := Transfer{
+		TxHash:  txHash,
+		Asset:   asset,
+		From:    s.address,
+		To:      to,
+		Amount:  amount,
+		Fee:     fee.Total,
+		Status:  StatusPending,
+		Created: s.timeNow(),
+	}
+	if err := s.store.Put(journalKey(txHash), t); err != nil {
+		// the transfer is sent regardless, only the journal misses it
+		s.logger.Errorf("wallet: record transfer %x: %v", txHash, err)
+	}
+	return t, nil
+}
+
+// History returns the transfers into and out of the node account, newest
+// first. The status of pending transfers is updated from the receipts on the
+// chain. Transfers on the chain before the wallet first synced are not
+// listed, unless sent through the wallet.
+func (s *Service) History(ctx context.Context) ([]Transfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transfers, err := s.transfers()
+	if err != nil {
+		return nil, err
+	}
+
+	for key, t := range transfers {
+		if t.Status != StatusPending {
+			continue
+		}
+		if err := s.resolve(ctx, key, &t); err != nil {
+			return nil, err
+		}
+		transfers[key] = t
+	}
+
+	history := make([]Transfer, 0, len(transfers))
+	for _, t := range transfers {
+		history = append(history, t)
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Created.After(history[j].Created)
+	})
+	return history, nil
+}
+
+// transfers returns the transfers of the history by their key.
+func (s *Service) transfers() (map[string]Transfer, error) {
+	transfers := make(map[string]Transfer)
+	err := s.store.Iterate(transferPrefix, func(key, value []byte) (bool, error) {
+		if !strings.HasPrefix(string(key), transferPrefix) {
+			return true, nil
+		}
+		var t Transfer
+		if err := json.Unmarshal(value, &t); err != nil {
+			return true, fmt.Errorf("decode transfer %s: %w", key, err)
+		}
+		transfers[string(key)] = t
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+// resolve updates the status of a pending transfer from its receipt.
+func (s *Service) resolve(ctx context.Context, key string, t *Transfer) error {
+	receipt, err := s.backend.TransactionReceipt(ctx, t.TxHash)
+	if err != nil || receipt == nil {
+		// no receipt yet, the transfer stays pending
+		s.logger.Debugf("wallet: receipt of transfer %x: %v", t.TxHash, err)
+		return nil
+	}
+	t.Status = StatusFailed
+	if receipt.ExecSucceed {
+		t.Status = StatusConfirmed
+	}
+	t.BlockNumber = receipt.BlockNum
+	t.Fee = new(big.Int).SetUint64(receipt.AcctualFee)
+	return s.store.Put(key, *t)
+}
+
+// Start starts syncing the transfers from the chain at the interval.
+func (s *Service) Start(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.Sync(ctx); err != nil {
+				s.logger.Debugf("wallet: sync: %v", err)
+				s.logger.Error("wallet: sync failed")
+			}
+			select {
+			case <-s.quit:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Sync adds the transfers into and out of the node account of the blocks
+// since the last sync to the history. The first sync starts at the current
+// block.
+func (s *Service) Sync(ctx context.Context) error {
+	head, err := s.backend.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("block number: %w", err)
+	}
+
+	var synced uint64
+	if err := s.store.Get(syncedBlockKey, &synced); err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		return s.store.Put(syncedBlockKey, head)
+	}
+
+	for synced < head {
+		to := synced + syncBatch
+		if to > head {
+			to = head
+		}
+		if err := s.syncBlocks(ctx, synced+1, to); err != nil {
+			return err
+		}
+		synced = to
+		if err := s.store.Put(syncedBlockKey, synced); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncBlocks adds the transfers of the blocks in the range to the history.
+func (s *Service) syncBlocks(ctx context.Context, from, to uint64) error {
+	// the token events of the range, by block
+	events := make(map[uint64][]xwctypes.RpcEventJson)
+	if s.tokenFunc != nil {
+		_, tokenAddress, err := s.getToken(ctx)
+		if err != nil {
+			return err
+		}
+		rangeEvents, err := s.backend.GetContractEventsInRange(ctx, tokenAddress, from, to)
+		if err != nil {
+			return fmt.Errorf("token events: %w", err)
+		}
+		for _, e := range rangeEvents {
+			if e.EventName == tokenTransferEvent {
+				events[e.BlockNum] = append(events[e.BlockNum], e)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	journal, err := s.transfers()
+	if err != nil {
+		return err
+	}
+
+	for n := from; n <= to; n++ {
+		block, err := s.backend.BlockByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil {
+			return fmt.Errorf("block %d: %w", n, err)
+		}
+		blockTime := time.Unix(int64(block.Timestamp), 0)
+
+		for i, tx := range block.Transactions {
+			if i >= len(block.TransactionIds) {
+				break
+			}
+			txHash := common.BytesToHash(block.TransactionIds[i][:])
+
+			transfers, err := s.xwcTransfers(tx)
+			if err != nil {
+				s.logger.Debugf("wallet: decode transaction %x: %v", txHash, err)
+				continue
+			}
+			for op, t := range transfers {
+				t.TxHash = txHash
+				t.BlockNumber = n
+				t.Created = blockTime
+				key := operationKey(txHash, op)
+				if sent, ok := journal[journalKey(txHash)]; ok && op == 0 {
+					// sent through the wallet
+					key = journalKey(txHash)
+					t.Created = sent.Created
+				}
+				if err := s.store.Put(key, t); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, e := range events[n] {
+			t, ok, err := s.tokenTransfer(e)
+			if err != nil {
+				s.logger.Debugf("wallet: decode token transfer in block %d: %v", n, err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			t.Created = blockTime
+			key := eventKey(n, e.OpNum)
+			if !t.Incoming {
+				if sentKey, sent, ok := matchSent(journal, t); ok {
+					key = sentKey
+					t.TxHash = sent.TxHash
+					t.Created = sent.Created
+					t.Fee = sent.Fee
+					delete(journal, sentKey)
+				}
+			}
+			if err := s.store.Put(key, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// xwcTransfers returns the transfers of a transaction into and out of the
+// node account, by the index of their operation.
+func (s *Service) xwcTransfers(tx interface{}) (map[int]Transfer, error) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+	var decoded struct {
+		Operations [][]json.RawMessage `json:"operations"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+
+	transfers := make(map[int]Transfer)
+	for i, op := range decoded.Operations {
+		if len(op) != 2 {
+			continue
+		}
+		var opType int
+		if err := json.Unmarshal(op[0], &opType); err != nil || opType != transferOperation {
+			continue
+		}
+		var transfer struct {
+			Fee      xwcAmount `json:"fee"`
+			FromAddr string    `json:"from_addr"`
+			ToAddr   string    `json:"to_addr"`
+			Amount   xwcAmount `json:"amount"`
+		}
+		if err := json.Unmarshal(op[1], &transfer); err != nil {
+			return nil, err
+		}
+		if transfer.Amount.AssetID != property.XWC_ASSET_ID {
+			continue
+		}
+
+		incoming := transfer.ToAddr == s.xwcAddress
+		if !incoming && transfer.FromAddr != s.xwcAddress {
+			continue
+		}
+		t, err := newTransfer(AssetXWC, transfer.FromAddr, transfer.ToAddr, transfer.Amount.Amount, incoming)
+		if err != nil {
+			return nil, err
+		}
+		if !incoming {
+			t.Fee, _ = new(big.Int).SetString(string(transfer.Fee.Amount), 10)
+		}
+		transfers[i] = t
+	}
+	return transfers, nil
+}
+
+// tokenTransfer returns the transfer of a token Transfer event, if it is into
+// or out of the node account.
+func (s *Service) tokenTransfer(e xwctypes.RpcEventJson) (t Transfer, ok bool, err error) {
+	var transfer struct {
+		From   string      `json:"from"`
+		To     string      `json:"to"`
+		Amount json.Number `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(e.EventArg), &transfer); err != nil {
+		return Transfer{}, false, err
+	}
+
+	incoming := transfer.To == s.xwcAddress
+	if !incoming && transfer.From != s.xwcAddress {
+		return Transfer{}, false, nil
+	}
+	t, err = newTransfer(AssetPEN, transfer.From, transfer.To, transfer.Amount, incoming)
+	if err != nil {
+		return Transfer{}, false, err
+	}
+	t.BlockNumber = e.BlockNum
+	return t, true, nil
+}
+
+// xwcAmount is an amount of an asset in an operation.
+type xwcAmount struct {
+	Amount  json.Number `json:"amount"`
+	AssetID string      `json:"asset_id"`
+}
+
+// newTransfer returns a confirmed transfer between the xwc addresses.
+func newTransfer(asset Asset, from, to string, amount json.Number, incoming bool) (Transfer, error) {
+	value, ok := new(big.Int).SetString(string(amount), 10)
+	if !ok {
+		return Transfer{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	fromAddress, err := parseXwcAddress(from)
+	if err != nil {
+		return Transfer{}, err
+	}
+	toAddress, err := parseXwcAddress(to)
+	if err != nil {
+		return Transfer{}, err
+	}
+	return Transfer{
+		Asset:    asset,
+		From:     fromAddress,
+		To:       toAddress,
+		Amount:   value,
+		Incoming: incoming,
+		Status:   StatusConfirmed,
+		OnChain:  true,
+	}, nil
+}
+
+// parseXwcAddress parses an account or a contract address.
+func parseXwcAddress(addr string) (common.Address, error) {
+	addrHex, err := xwcfmt.XwcAddrToHexAddr(addr)
+	if err != nil {
+		if addrHex, err = xwcfmt.XwcConAddrToHexAddr(addr); err != nil {
+			return common.Address{}, err
+		}
+	}
+	return common.HexToAddress(addrHex), nil
+}
+
+// matchSent returns the journaled token transfer sent through the wallet that
+// the synced outgoing transfer is the event of.
+func matchSent(journal map[string]Transfer, t Transfer) (string, Transfer, bool) {
+	for key, sent := range journal {
+		if sent.Asset != AssetPEN || sent.OnChain || sent.Incoming || sent.Status == StatusFailed {
+			continue
+		}
+		if sent.BlockNumber != 0 && sent.BlockNumber != t.BlockNumber {
+			continue
+		}
+		if sent.To == t.To && sent.Amount.Cmp(t.Amount) == 0 {
+			return key, sent, true
+		}
+	}
+	return "", Transfer{}, false
+}
+
+// Close stops syncing the transfers, waiting for the running sync to finish.
+func (s *Service) Close() error {
+	close(s.quit)
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+func journalKey(txHash common.Hash) string {
+	return fmt.Sprintf("%s%x", transferPrefix, txHash)
+}
+
+func operationKey(txHash common.Hash, op int) string {
+	return fmt.Sprintf("%s%x_%d", transferPrefix, txHash, op)
+}
+
+func eventKey(block, op uint64) string {
+	return fmt.Sprintf("%sevent_%d_%d", transferPrefix, block, op)
+}
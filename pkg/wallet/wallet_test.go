@@ -0,0 +1,402 @@
+// Copyright 2021 The Penguin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wallet_test
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/penguintop/penguin/pkg/logging"
+	"github.com/penguintop/penguin/pkg/property"
+	"github.com/penguintop/penguin/pkg/settlement/swap/erc20"
+	erc20mock "github.com/penguintop/penguin/pkg/settlement/swap/erc20/mock"
+	statestore "github.com/penguintop/penguin/pkg/statestore/mock"
+	"github.com/penguintop/penguin/pkg/transaction"
+	"github.com/penguintop/penguin/pkg/transaction/backendmock"
+	transactionmock "github.com/penguintop/penguin/pkg/transaction/mock"
+	"github.com/penguintop/penguin/pkg/wallet"
+	"github.com/penguintop/penguin/pkg/xwcfmt"
+	"github.com/penguintop/penguin/pkg/xwctypes"
+)
+
+var (
+	nodeAddress  = common.HexToAddress("0xab")
+	recipient    = common.HexToAddress("0xcd")
+	tokenAddress = common.HexToAddress("0xef")
+)
+
+// chainBackend adds the blocks and the token events to the backend mock.
+type chainBackend struct {
+	transaction.Backend
+	head   uint64
+	blocks map[uint64]*xwctypes.RpcBlock
+	events []xwctypes.RpcEventJson
+}
+
+func (b *chainBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	return b.head, nil
+}
+
+func (b *chainBackend) BlockByNumber(ctx context.Context, number *big.Int) (*xwctypes.RpcBlock, error) {
+	if block, ok := b.blocks[number.Uint64()]; ok {
+		return block, nil
+	}
+	return &xwctypes.RpcBlock{Number: number.Uint64()}, nil
+}
+
+func (b *chainBackend) GetContractEventsInRange(ctx context.Context, account common.Address, start, to uint64) ([]xwctypes.RpcEventJson, error) {
+	if account != tokenAddress {
+		return nil, errors.New("wrong contract")
+	}
+	var events []xwctypes.RpcEventJson
+	for _, e := range b.events {
+		if e.BlockNum >= start && e.BlockNum <= to {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func newBackend(xwcBalance int64, receipts map[common.Hash]*xwctypes.RpcTransactionReceipt) *chainBackend {
+	return &chainBackend{Backend: backendmock.New(
+		backendmock.WithBalanceAtFunc(func(ctx context.Context, address common.Address, block *big.Int) (*big.Int, error) {
+			if address != nodeAddress {
+				return nil, errors.New("wrong address")
+			}
+			return big.NewInt(xwcBalance), nil
+		}),
+		backendmock.WithTransactionReceiptFunc(func(ctx context.Context, txHash common.Hash) (*xwctypes.RpcTransactionReceipt, error) {
+			receipt, ok := receipts[txHash]
+			if !ok {
+				return nil, errors.New("not found")
+			}
+			return receipt, nil
+		}),
+	)}
+}
+
+func newToken(penBalance int64, txHash common.Hash) wallet.TokenFunc {
+	token := erc20mock.New(
+		erc20mock.WithBalanceOfFunc(func(ctx context.Context, address common.Address) (*big.Int, error) {
+			return big.NewInt(penBalance), nil
+		}),
+		erc20mock.WithTransferFunc(func(ctx context.Context, address common.Address, value *big.Int) (common.Hash, error) {
+			if address != recipient {
+				return common.Hash{}, errors.New("wrong recipient")
+			}
+			return txHash, nil
+		}),
+	)
+	return func(ctx context.Context) (erc20.Service, common.Address, error) {
+		return token, tokenAddress, nil
+	}
+}
+
+func TestBalances(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+	store := statestore.NewStateStore()
+
+	w := wallet.New(newBackend(500, nil), transactionmock.New(), newToken(300, common.Hash{}), nodeAddress, store, logger)
+	b, err := w.Balances(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.XWC.Int64() != 500 || b.PEN.Int64() != 300 {
+		t.Fatalf("got balances %d xwc %d pen, want 500 xwc 300 pen", b.XWC, b.PEN)
+	}
+
+	w = wallet.New(newBackend(500, nil), transactionmock.New(), nil, nodeAddress, store, logger)
+	b, err = w.Balances(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.PEN != nil {
+		t.Fatalf("got pen balance %d without token", b.PEN)
+	}
+	if _, err := w.Fee(wallet.AssetPEN); !errors.Is(err, wallet.ErrNoToken) {
+		t.Fatalf("got error %v, want %v", err, wallet.ErrNoToken)
+	}
+}
+
+func TestFee(t *testing.T) {
+	w := wallet.New(newBackend(0, nil), transactionmock.New(), newToken(0, common.Hash{}), nodeAddress, statestore.NewStateStore(), logging.New(ioutil.Discard, 0))
+
+	fee, err := w.Fee(wallet.AssetXWC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee.Total.Int64() != transaction.Fee {
+		t.Fatalf("got xwc fee %d, want %d", fee.Total, transaction.Fee)
+	}
+
+	fee, err = w.Fee(wallet.AssetPEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := int64(transaction.Fee + erc20.TransferGasPrice*erc20.TransferGasLimit)
+	if fee.Total.Int64() != want {
+		t.Fatalf("got pen fee %d, want %d", fee.Total, want)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	logger := logging.New(ioutil.Discard, 0)
+	xwcHash := common.HexToHash("0x01")
+	penHash := common.HexToHash("0x02")
+	receipts := map[common.Hash]*xwctypes.RpcTransactionReceipt{
+		penHash: {TrxId: penHash, BlockNum: 7, ExecSucceed: true, AcctualFee: 2500000},
+	}
+
+	var sent *transaction.TxRequest
+	transactionService := transactionmock.New(
+		transactionmock.WithSendFunc(func(ctx context.Context, request *transaction.TxRequest) (common.Hash, error) {
+			sent = request
+			return xwcHash, nil
+		}),
+	)
+	store := statestore.NewStateStore()
+	w := wallet.New(newBackend(10000000, receipts), transactionService, newToken(300, penHash), nodeAddress, store, logger)
+
+	ctx := context.Background()
+	if _, err := w.Transfer(ctx, wallet.AssetXWC, recipient, big.NewInt(9000000)); !errors.Is(err, wallet.ErrInsufficientFunds) {
+		t.Fatalf("got error %v, want %v", err, wallet.ErrInsufficientFunds)
+	}
+	if _, err := w.Transfer(ctx, wallet.AssetPEN, recipient, big.NewInt(301)); !errors.Is(err, wallet.ErrInsufficientFunds) {
+		t.Fatalf("got error %v, want %v", err, wallet.ErrInsufficientFunds)
+	}
+	if _, err := w.Transfer(ctx, wallet.AssetXWC, recipient, big.NewInt(0)); !errors.Is(err, wallet.ErrInvalidAmount) {
+		t.Fatalf("got error %v, want %v", err, wallet.ErrInvalidAmount)
+	}
+
+	transfer, err := w.Transfer(ctx, wallet.AssetXWC, recipient, big.NewInt(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.TxHash != xwcHash || transfer.Status != wallet.StatusPending {
+		t.Fatalf("got transfer %x with status %s", transfer.TxHash, transfer.Status)
+	}
+	if sent == nil || sent.TxType != transaction.TxTypeTransfer || *sent.To != recipient || sent.Value.Int64() != 1000 {
+		t.Fatalf("sent wrong transaction %+v", sent)
+	}
+
+	if _, err := w.Transfer(ctx, wallet.AssetPEN, recipient, big.NewInt(300)); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := w.History(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("got %d transfers, want 2", len(history))
+	}
+
+	statuses := make(map[common.Hash]wallet.Transfer)
+	for _, transfer := range history {
+		statuses[transfer.TxHash] = transfer
+	}
+	if got := statuses[xwcHash]; got.Status != wallet.StatusPending || got.Asset != wallet.AssetXWC {
+		t.Fatalf("got xwc transfer %+v, want pending", got)
+	}
+	got := statuses[penHash]
+	if got.Status != wallet.StatusConfirmed || got.BlockNumber != 7 || got.Fee.Int64() != 2500000 || got.Amount.Int64() != 300 {
+		t.Fatalf("got pen transfer %+v, want confirmed in block 7", got)
+	}
+
+	// the resolved status is persisted in the journal
+	w = wallet.New(newBackend(0, nil), transactionService, nil, nodeAddress, store, logger)
+	history, err = w.History(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, transfer := range history {
+		if transfer.TxHash == penHash && transfer.Status != wallet.StatusConfirmed {
+			t.Fatalf("got status %s after reload, want %s", transfer.Status, wallet.StatusConfirmed)
+		}
+	}
+}
+
+func TestTransferLargeAmount(t *testing.T) {
+	amount, _ := new(big.Int).SetString("100000000000000000000", 10)
+	penHash := common.HexToHash("0x03")
+
+	var transferred *big.Int
+	token := erc20mock.New(
+		erc20mock.WithBalanceOfFunc(func(ctx context.Context, address common.Address) (*big.Int, error) {
+			return new(big.Int).Mul(amount, big.NewInt(2)), nil
+		}),
+		erc20mock.WithTransferFunc(func(ctx context.Context, address common.Address, value *big.Int) (common.Hash, error) {
+			transferred = value
+			return penHash, nil
+		}),
+	)
+	tokenFunc := func(ctx context.Context) (erc20.Service, common.Address, error) {
+		return token, tokenAddress, nil
+	}
+	w := wallet.New(newBackend(10000000, nil), transactionmock.New(), tokenFunc, nodeAddress, statestore.NewStateStore(), logging.New(ioutil.Discard, 0))
+
+	ctx := context.Background()
+	if _, err := w.Transfer(ctx, wallet.AssetPEN, recipient, amount); err != nil {
+		t.Fatal(err)
+	}
+	if transferred == nil || transferred.Cmp(amount) != 0 {
+		t.Fatalf("transferred %d, want %d", transferred, amount)
+	}
+
+	// xwc amounts are int64 on the chain
+	if _, err := w.Transfer(ctx, wallet.AssetXWC, recipient, amount); !errors.Is(err, wallet.ErrInvalidAmount) {
+		t.Fatalf("got error %v, want %v", err, wallet.ErrInvalidAmount)
+	}
+}
+
+func TestLazyToken(t *testing.T) {
+	lookups := 0
+	tokenErr := errors.New("token not found")
+	tokenFunc := func(ctx context.Context) (erc20.Service, common.Address, error) {
+		lookups++
+		if lookups == 1 {
+			return nil, common.Address{}, tokenErr
+		}
+		return newToken(300, common.Hash{})(ctx)
+	}
+	w := wallet.New(newBackend(500, nil), transactionmock.New(), tokenFunc, nodeAddress, statestore.NewStateStore(), logging.New(ioutil.Discard, 0))
+	if lookups != 0 {
+		t.Fatalf("looked up the token %d times on creation", lookups)
+	}
+
+	ctx := context.Background()
+	if _, err := w.Balances(ctx); !errors.Is(err, tokenErr) {
+		t.Fatalf("got error %v, want %v", err, tokenErr)
+	}
+	for i := 0; i < 2; i++ {
+		b, err := w.Balances(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.PEN.Int64() != 300 {
+			t.Fatalf("got pen balance %d, want 300", b.PEN)
+		}
+	}
+	// the failed lookup is retried, the found token is kept
+	if lookups != 2 {
+		t.Fatalf("looked up the token %d times, want 2", lookups)
+	}
+}
+
+func xwcAddress(t *testing.T, address common.Address) string {
+	t.Helper()
+	addr, err := xwcfmt.HexAddrToXwcAddr(hex.EncodeToString(address[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+func transferOperation(from, to string, amount int64) []interface{} {
+	return []interface{}{0, map[string]interface{}{
+		"fee":       map[string]interface{}{"amount": 200, "asset_id": property.XWC_ASSET_ID},
+		"from_addr": from,
+		"to_addr":   to,
+		"amount":    map[string]interface{}{"amount": amount, "asset_id": property.XWC_ASSET_ID},
+	}}
+}
+
+func TestSync(t *testing.T) {
+	var (
+		logger   = logging.New(ioutil.Discard, 0)
+		store    = statestore.NewStateStore()
+		sender   = common.HexToAddress("0x12")
+		node     = xwcAddress(t, nodeAddress)
+		incoming = common.HexToHash("0x04")
+		other    = common.HexToHash("0x05")
+		penHash  = common.HexToHash("0x06")
+		txID     = func(h common.Hash) xwcfmt.Hash {
+			var id xwcfmt.Hash
+			copy(id[:], h[common.HashLength-xwcfmt.HashLength:])
+			return id
+		}
+	)
+	backend := newBackend(10000000, map[common.Hash]*xwctypes.RpcTransactionReceipt{
+		penHash: {TrxId: penHash, BlockNum: 12, ExecSucceed: true, AcctualFee: 2500000},
+	})
+	backend.head = 10
+	w := wallet.New(backend, transactionmock.New(), newToken(1000, penHash), nodeAddress, store, logger)
+
+	ctx := context.Background()
+	// the first sync starts at the current block
+	if err := w.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Transfer(ctx, wallet.AssetPEN, recipient, big.NewInt(300)); err != nil {
+		t.Fatal(err)
+	}
+
+	bigAmount := "100000000000000000000"
+	backend.head = 12
+	backend.blocks = map[uint64]*xwctypes.RpcBlock{
+		11: {
+			Number:    11,
+			Timestamp: 1000,
+			Transactions: []interface{}{
+				map[string]interface{}{"operations": []interface{}{transferOperation(xwcAddress(t, sender), node, 5000)}},
+				map[string]interface{}{"operations": []interface{}{transferOperation(xwcAddress(t, sender), xwcAddress(t, recipient), 7000)}},
+			},
+			TransactionIds: []xwcfmt.Hash{txID(incoming), txID(other)},
+		},
+	}
+	backend.events = []xwctypes.RpcEventJson{
+		{EventName: "Transfer", EventArg: `{"from":"` + xwcAddress(t, sender) + `","to":"` + node + `","amount":` + bigAmount + `}`, BlockNum: 11, OpNum: 1},
+		{EventName: "Transfer", EventArg: `{"from":"` + node + `","to":"` + xwcAddress(t, recipient) + `","amount":"300"}`, BlockNum: 12, OpNum: 0},
+		{EventName: "Transfer", EventArg: `{"from":"` + xwcAddress(t, sender) + `","to":"` + xwcAddress(t, recipient) + `","amount":1}`, BlockNum: 12, OpNum: 1},
+		{EventName: "Approval", EventArg: `{"from":"` + node + `","to":"` + xwcAddress(t, recipient) + `","amount":1}`, BlockNum: 12, OpNum: 2},
+	}
+	if err := w.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := w.History(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("got %d transfers, want 3: %+v", len(history), history)
+	}
+
+	var xwcIn, penIn, penOut *wallet.Transfer
+	for i, transfer := range history {
+		switch {
+		case transfer.Asset == wallet.AssetXWC:
+			xwcIn = &history[i]
+		case transfer.Incoming:
+			penIn = &history[i]
+		default:
+			penOut = &history[i]
+		}
+	}
+	if xwcIn == nil || xwcIn.TxHash != incoming || !xwcIn.Incoming || xwcIn.From != sender || xwcIn.Amount.Int64() != 5000 || xwcIn.BlockNumber != 11 || xwcIn.Created.Unix() != 1000 {
+		t.Fatalf("got incoming xwc transfer %+v", xwcIn)
+	}
+	if penIn == nil || penIn.Amount.String() != bigAmount || penIn.From != sender || penIn.Status != wallet.StatusConfirmed {
+		t.Fatalf("got incoming pen transfer %+v", penIn)
+	}
+	// the sent transfer is merged with its event
+	if penOut == nil || penOut.TxHash != penHash || !penOut.OnChain || penOut.To != recipient || penOut.BlockNumber != 12 {
+		t.Fatalf("got outgoing pen transfer %+v", penOut)
+	}
+
+	// synced blocks are not synced again
+	if err := w.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if history, err := w.History(ctx); err != nil || len(history) != 3 {
+		t.Fatalf("got %d transfers after resync, err %v", len(history), err)
+	}
+}